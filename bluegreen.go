@@ -0,0 +1,194 @@
+package caddy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// SmokeCheck is a request that must get the expected response
+// status from a new configuration before traffic cuts over to it.
+// The URL is absolute, like https://example.com/health; it is
+// requested from the server that listens on its port.
+type SmokeCheck struct {
+	URL    string
+	Status int
+}
+
+// RestartChecked is like Restart, but it first instantiates the
+// new configuration on internal ports on the loopback interface
+// and runs checks against it. Only if they all pass does traffic
+// cut over to the new configuration; then the checks run again
+// against the running servers, and if any fails, the old
+// configuration is restored. Without checks, it is like Restart.
+func (i *Instance) RestartChecked(newCaddyfile Input, checks []SmokeCheck) (*Instance, error) {
+	if len(checks) == 0 {
+		return i.Restart(newCaddyfile)
+	}
+	if newCaddyfile == nil {
+		newCaddyfile = i.caddyfileInput
+	}
+	oldCaddyfile := i.caddyfileInput
+
+	log.Println("[INFO] Staging new configuration")
+	staged, err := stage(newCaddyfile)
+	if err != nil {
+		return i, fmt.Errorf("staging new configuration: %v", err)
+	}
+	err = runSmokeChecks(checks, checkAddrs(staged.servers, false))
+	staged.unstage()
+	if err != nil {
+		return i, fmt.Errorf("new configuration failed smoke check: %v", err)
+	}
+
+	newInst, err := i.Restart(newCaddyfile)
+	if err != nil {
+		return newInst, err
+	}
+	err = runSmokeChecks(checks, checkAddrs(newInst.servers, true))
+	if err == nil {
+		return newInst, nil
+	}
+
+	log.Printf("[ERROR] Smoke check failed after cutover, rolling back: %v", err)
+	rolledBack, rbErr := newInst.Restart(oldCaddyfile)
+	if rbErr != nil {
+		return rolledBack, fmt.Errorf("smoke check failed after cutover: %v; rolling back: %v", err, rbErr)
+	}
+	return rolledBack, fmt.Errorf("smoke check failed after cutover, rolled back: %v", err)
+}
+
+// stage instantiates cdyfile and serves its TCP servers on
+// internal ports. The staged instance does not replace any
+// other and must be released with unstage.
+func stage(cdyfile Input) (*Instance, error) {
+	inst := &Instance{serverType: cdyfile.ServerType(), wg: new(sync.WaitGroup)}
+	slist, err := inst.makeServers(cdyfile)
+	if err != nil {
+		inst.unstage()
+		return nil, err
+	}
+	for _, startupFunc := range inst.onStartup {
+		if err := startupFunc.fn(); err != nil {
+			inst.unstage()
+			return nil, err
+		}
+	}
+	for _, s := range slist {
+		gs, ok := s.(GracefulServer)
+		if !ok {
+			continue
+		}
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			inst.unstage()
+			return nil, err
+		}
+		inst.servers = append(inst.servers, ServerListener{server: gs, listener: ln})
+		go gs.Serve(ln)
+	}
+	return inst, nil
+}
+
+// unstage stops the servers of a staged instance and runs its
+// shutdown callbacks.
+func (i *Instance) unstage() {
+	for _, s := range i.servers {
+		if err := s.server.(GracefulServer).Stop(); err != nil {
+			log.Printf("[ERROR] Stopping staged %s: %v", s.server.(GracefulServer).Address(), err)
+		}
+		s.listener.Close()
+	}
+	for _, shutdownFunc := range i.onShutdown {
+		if err := shutdownFunc.fn(); err != nil {
+			log.Printf("[ERROR] Shutting down staged configuration: %v", err)
+		}
+	}
+}
+
+// checkAddrs maps the ports the servers are configured to listen
+// on to the addresses they can be reached at. The listeners of
+// live servers listen on their ports; those bound to all
+// interfaces are reached on the loopback interface.
+func checkAddrs(servers []ServerListener, live bool) map[string]string {
+	addrs := make(map[string]string)
+	for _, s := range servers {
+		gs, ok := s.server.(GracefulServer)
+		if !ok || s.listener == nil {
+			continue
+		}
+		_, port, err := net.SplitHostPort(gs.Address())
+		if err != nil {
+			continue
+		}
+		host, lnPort, err := net.SplitHostPort(s.listener.Addr().String())
+		if err != nil {
+			continue
+		}
+		if live {
+			if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+				host = "127.0.0.1"
+			}
+		}
+		addrs[port] = net.JoinHostPort(host, lnPort)
+	}
+	return addrs
+}
+
+// runSmokeChecks requests each check's URL from the address addrs
+// maps its port to, keeping its host name for the Host header and
+// TLS server name, and returns an error for the first response
+// that does not have the expected status.
+func runSmokeChecks(checks []SmokeCheck, addrs map[string]string) error {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	client := &http.Client{
+		Timeout: smokeCheckTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				_, port, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+				target, ok := addrs[port]
+				if !ok {
+					return nil, fmt.Errorf("no server listens on port %s", port)
+				}
+				return dialer.DialContext(ctx, network, target)
+			},
+			// the certificate need not be trusted yet, such as a self-signed one
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	for _, check := range checks {
+		u, err := url.Parse(check.URL)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.New("smoke check URL must be http or https: " + check.URL)
+		}
+		resp, err := client.Get(check.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != check.Status {
+			return fmt.Errorf("%s responded with HTTP %d, expected %d", check.URL, resp.StatusCode, check.Status)
+		}
+	}
+	return nil
+}
+
+// smokeCheckTimeout is how long a smoke check may take.
+var smokeCheckTimeout = 30 * time.Second
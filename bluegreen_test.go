@@ -0,0 +1,89 @@
+package caddy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunSmokeChecks(t *testing.T) {
+	var hosts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+		switch r.URL.Path {
+		case "/health":
+			w.WriteHeader(http.StatusOK)
+		case "/old":
+			http.Redirect(w, r, "/health", http.StatusMovedPermanently)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	addrs := map[string]string{"80": srv.Listener.Addr().String()}
+
+	for i, test := range []struct {
+		checks    []SmokeCheck
+		shouldErr bool
+	}{
+		{[]SmokeCheck{{"http://example.com/health", 200}}, false},
+		{[]SmokeCheck{{"http://example.com/health", 200}, {"http://example.com/nope", 404}}, false},
+		{[]SmokeCheck{{"http://example.com/old", 301}}, false}, // redirects are not followed
+		{[]SmokeCheck{{"http://example.com/health", 200}, {"http://example.com/nope", 200}}, true},
+		{[]SmokeCheck{{"http://example.com:8080/health", 200}}, true}, // nothing on the port
+		{[]SmokeCheck{{"ftp://example.com/health", 200}}, true},
+	} {
+		err := runSmokeChecks(test.checks, addrs)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error, got none", i)
+		}
+		if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+	}
+	if len(hosts) == 0 || hosts[0] != "example.com" {
+		t.Errorf("Expected the check's host in the Host header, got %v", hosts)
+	}
+}
+
+// addrServer is a GracefulServer with an address.
+type addrServer struct {
+	GracefulServer
+	addr string
+}
+
+func (s addrServer) Address() string { return s.addr }
+
+func TestCheckAddrs(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	servers := []ServerListener{{server: addrServer{addr: ":443"}, listener: ln}}
+	if got := checkAddrs(servers, false)["443"]; got != ln.Addr().String() {
+		t.Errorf("Expected staged port 443 to map to %s, got '%s'", ln.Addr(), got)
+	}
+
+	all, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer all.Close()
+	_, port, _ := net.SplitHostPort(all.Addr().String())
+	servers = []ServerListener{{server: addrServer{addr: ":" + port}, listener: all}}
+	if got := checkAddrs(servers, true)[port]; got != "127.0.0.1:"+port {
+		t.Errorf("Expected live port %s to map to the loopback interface, got '%s'", port, got)
+	}
+}
+
+func TestRestartCheckedStagingFails(t *testing.T) {
+	i := &Instance{serverType: "http"}
+	_, err := i.RestartChecked(CaddyfileInput{ServerTypeName: "nonexistent"}, []SmokeCheck{{"http://localhost/", 200}})
+	if err == nil || !strings.Contains(err.Error(), "staging") {
+		t.Errorf("Expected staging error, got: %v", err)
+	}
+}
@@ -78,12 +78,25 @@ type Instance struct {
 	// servers is the list of servers with their listeners.
 	servers []ServerListener
 
+	// serverBlocks are the server blocks the instance was set
+	// up with, after the context inspected them
+	serverBlocks []caddyfile.ServerBlock
+
 	// these callbacks execute when certain events occur
-	onFirstStartup  []func() error // starting, not as part of a restart
-	onStartup       []func() error // starting, even as part of a restart
-	onRestart       []func() error // before restart commences
-	onShutdown      []func() error // stopping, even as part of a restart
-	onFinalShutdown []func() error // stopping, not as part of a restart
+	onFirstStartup  []callback // starting, not as part of a restart
+	onStartup       []callback // starting, even as part of a restart
+	onRestart       []callback // before restart commences
+	onShutdown      []callback // stopping, even as part of a restart
+	onFinalShutdown []callback // stopping, not as part of a restart
+}
+
+// callback is a function to execute when an event occurs,
+// with the directive that registered it and the keys of its
+// server block, if any.
+type callback struct {
+	fn        func() error
+	block     string
+	directive string
 }
 
 // Servers returns the ServerListeners in i.
@@ -121,13 +134,13 @@ func (i *Instance) Stop() error {
 func (i *Instance) ShutdownCallbacks() []error {
 	var errs []error
 	for _, shutdownFunc := range i.onShutdown {
-		err := shutdownFunc()
+		err := shutdownFunc.fn()
 		if err != nil {
 			errs = append(errs, err)
 		}
 	}
 	for _, finalShutdownFunc := range i.onFinalShutdown {
-		err := finalShutdownFunc()
+		err := finalShutdownFunc.fn()
 		if err != nil {
 			errs = append(errs, err)
 		}
@@ -146,7 +159,7 @@ func (i *Instance) Restart(newCaddyfile Input) (*Instance, error) {
 
 	// run restart callbacks
 	for _, fn := range i.onRestart {
-		err := fn()
+		err := fn.fn()
 		if err != nil {
 			return i, err
 		}
@@ -156,6 +169,17 @@ func (i *Instance) Restart(newCaddyfile Input) (*Instance, error) {
 		newCaddyfile = i.caddyfileInput
 	}
 
+	// changes to some directives can be applied without
+	// restarting the servers
+	reloaded, err := i.reloadInPlace(newCaddyfile)
+	if err != nil {
+		return i, err
+	}
+	if reloaded {
+		log.Println("[INFO] Reloading complete")
+		return i, nil
+	}
+
 	// Add file descriptors of all the sockets that are capable of it
 	restartFds := make(map[string]restartTriple)
 	for _, s := range i.servers {
@@ -182,14 +206,14 @@ func (i *Instance) Restart(newCaddyfile Input) (*Instance, error) {
 	newInst := &Instance{serverType: newCaddyfile.ServerType(), wg: i.wg}
 
 	// attempt to start new instance
-	err := startWithListenerFds(newCaddyfile, newInst, restartFds)
+	err = startWithListenerFds(newCaddyfile, newInst, restartFds)
 	if err != nil {
 		return i, err
 	}
 
 	// success! stop the old instance
 	for _, shutdownFunc := range i.onShutdown {
-		err := shutdownFunc()
+		err := shutdownFunc.fn()
 		if err != nil {
 			return i, err
 		}
@@ -432,36 +456,7 @@ func startWithListenerFds(cdyfile Input, inst *Instance, restartFds map[string]r
 		cdyfile = CaddyfileInput{}
 	}
 
-	stypeName := cdyfile.ServerType()
-
-	stype, err := getServerType(stypeName)
-	if err != nil {
-		return err
-	}
-
-	inst.caddyfileInput = cdyfile
-
-	sblocks, err := loadServerBlocks(stypeName, cdyfile.Path(), bytes.NewReader(cdyfile.Body()))
-	if err != nil {
-		return err
-	}
-
-	inst.context = stype.NewContext()
-	if inst.context == nil {
-		return fmt.Errorf("server type %s produced a nil Context", stypeName)
-	}
-
-	sblocks, err = inst.context.InspectServerBlocks(cdyfile.Path(), sblocks)
-	if err != nil {
-		return err
-	}
-
-	err = executeDirectives(inst, cdyfile.Path(), stype.Directives(), sblocks)
-	if err != nil {
-		return err
-	}
-
-	slist, err := inst.context.MakeServers()
+	slist, err := inst.makeServers(cdyfile)
 	if err != nil {
 		return err
 	}
@@ -469,14 +464,14 @@ func startWithListenerFds(cdyfile Input, inst *Instance, restartFds map[string]r
 	// run startup callbacks
 	if restartFds == nil {
 		for _, firstStartupFunc := range inst.onFirstStartup {
-			err := firstStartupFunc()
+			err := firstStartupFunc.fn()
 			if err != nil {
 				return err
 			}
 		}
 	}
 	for _, startupFunc := range inst.onStartup {
-		err := startupFunc()
+		err := startupFunc.fn()
 		if err != nil {
 			return err
 		}
@@ -516,6 +511,46 @@ func startWithListenerFds(cdyfile Input, inst *Instance, restartFds map[string]r
 	return nil
 }
 
+// makeServers sets i up with cdyfile and returns the servers
+// it makes, without starting them or running any callbacks.
+func (i *Instance) makeServers(cdyfile Input) ([]Server, error) {
+	stypeName := cdyfile.ServerType()
+
+	stype, err := getServerType(stypeName)
+	if err != nil {
+		return nil, err
+	}
+
+	i.caddyfileInput = cdyfile
+
+	sblocks, err := loadServerBlocks(stypeName, cdyfile.Path(), bytes.NewReader(cdyfile.Body()))
+	if err != nil {
+		return nil, err
+	}
+
+	i.context = stype.NewContext()
+	if i.context == nil {
+		return nil, fmt.Errorf("server type %s produced a nil Context", stypeName)
+	}
+
+	sblocks, err = i.context.InspectServerBlocks(cdyfile.Path(), sblocks)
+	if err != nil {
+		return nil, err
+	}
+	i.serverBlocks = sblocks
+
+	err = executeDirectives(i, cdyfile.Path(), stype.Directives(), sblocks)
+	if err != nil {
+		return nil, err
+	}
+
+	slist, err := i.context.MakeServers()
+	if err != nil {
+		return nil, err
+	}
+	return slist, nil
+}
+
 func executeDirectives(inst *Instance, filename string,
 	directives []string, sblocks []caddyfile.ServerBlock) error {
 
@@ -538,6 +573,7 @@ func executeDirectives(inst *Instance, filename string,
 				if tokens, ok := sb.Tokens[dir]; ok {
 					controller := &Controller{
 						instance:  inst,
+						directive: dir,
 						Key:       key,
 						Dispenser: caddyfile.NewDispenserTokens(filename, tokens),
 						OncePerServerBlock: func(f func() error) error {
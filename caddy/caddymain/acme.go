@@ -0,0 +1,98 @@
+package caddymain
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/mholt/caddy/caddytls"
+)
+
+// runACME runs the acme command with args, which manages
+// the stored accounts with the CA of the -ca flag:
+//
+//	acme account show [email]
+//	acme account update-contact email new_email
+//	acme account deactivate [email]
+//	acme account key-rollover [email]
+//
+// Without email, the account of the -email flag is used,
+// else the most recent one.
+func runACME(out io.Writer, args []string) error {
+	if len(args) < 2 || args[0] != "account" {
+		return errors.New(acmeUsage)
+	}
+	caURL := caddytls.DefaultCAUrl
+	cmd, args := args[1], args[2:]
+	switch cmd {
+	case "show":
+		if len(args) > 1 {
+			return errors.New(acmeUsage)
+		}
+		accounts, err := caddytls.Accounts(caURL)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "EMAIL\tKEY\tTHUMBPRINT\tURI")
+		var shown bool
+		for _, a := range accounts {
+			if len(args) == 1 && a.Email != args[0] {
+				continue
+			}
+			email := a.Email
+			if email == "" {
+				email = "(none)"
+			}
+			uri := a.URI
+			if uri == "" {
+				uri = "(not registered)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", email, a.KeyType, a.KeyThumbprint, uri)
+			shown = true
+		}
+		if !shown {
+			return fmt.Errorf("no accounts with %s", caURL)
+		}
+		return w.Flush()
+	case "update-contact":
+		if len(args) != 2 {
+			return errors.New(acmeUsage)
+		}
+		if err := caddytls.UpdateAccountContact(caURL, args[0], args[1]); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Updated contact of %s to %s\n", args[0], args[1])
+	case "deactivate":
+		if len(args) > 1 {
+			return errors.New(acmeUsage)
+		}
+		if err := caddytls.DeactivateAccount(caURL, accountArg(args)); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "Deactivated account")
+	case "key-rollover":
+		if len(args) > 1 {
+			return errors.New(acmeUsage)
+		}
+		if err := caddytls.RolloverAccountKey(caURL, accountArg(args)); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "Rolled over account key")
+	default:
+		return errors.New(acmeUsage)
+	}
+	return nil
+}
+
+// accountArg returns the email of the account args name,
+// if any; the caddytls functions default to the others.
+func accountArg(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+	return ""
+}
+
+const acmeUsage = "usage: acme account show [email] | update-contact email new_email | deactivate [email] | key-rollover [email]"
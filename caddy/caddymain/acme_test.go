@@ -0,0 +1,24 @@
+package caddymain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRunACMEUsage(t *testing.T) {
+	for i, args := range [][]string{
+		{},
+		{"account"},
+		{"accounts", "show"},
+		{"account", "list"},
+		{"account", "show", "a@example.com", "b@example.com"},
+		{"account", "update-contact", "a@example.com"},
+		{"account", "deactivate", "a@example.com", "b@example.com"},
+		{"account", "key-rollover", "a@example.com", "b@example.com"},
+	} {
+		var out bytes.Buffer
+		if err := runACME(&out, args); err == nil || err.Error() != acmeUsage {
+			t.Errorf("Test %d: Expected usage error, got: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package caddymain
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mholt/caddy/caddytls"
+)
+
+// runCerts runs the certs command with args, which lists the
+// certificates in storage for the CA of the -ca flag, or renews
+// one of them now, regardless of when it expires:
+//
+//	certs list
+//	certs -renew-now name
+//
+// Renewed certificates are loaded by running processes when
+// they next check storage; the certs_admin directive renews
+// the certificates a running process has loaded instead.
+func runCerts(out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("certs", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	renewNow := fs.String("renew-now", "", "Name of the certificate to renew now")
+	if err := fs.Parse(args); err != nil {
+		return errors.New(certsUsage)
+	}
+	list := fs.Arg(0) == "list"
+	if list {
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return errors.New(certsUsage)
+		}
+	}
+	if fs.NArg() > 0 || (!list && *renewNow == "") {
+		return errors.New(certsUsage)
+	}
+
+	caURL := caddytls.DefaultCAUrl
+	if *renewNow != "" {
+		if err := caddytls.RenewStoredCertificate(caURL, *renewNow); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Renewed certificate for %s\n", *renewNow)
+	}
+	if !list {
+		return nil
+	}
+
+	certs, err := caddytls.StoredCertificates(caURL)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMES\tISSUER\tEXPIRES\tOCSP\tSTORAGE")
+	for _, c := range certs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", strings.Join(c.Names, ","), c.Issuer,
+			c.NotAfter.UTC().Format(time.RFC3339), c.OCSP, c.Storage)
+	}
+	return w.Flush()
+}
+
+const certsUsage = "usage: certs list | certs [list] -renew-now name"
@@ -0,0 +1,22 @@
+package caddymain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRunCertsUsage(t *testing.T) {
+	for i, args := range [][]string{
+		{},
+		{"show"},
+		{"list", "extra"},
+		{"-renew-now"},
+		{"-unknown", "x"},
+		{"list", "-renew-now"},
+	} {
+		var out bytes.Buffer
+		if err := runCerts(&out, args); err == nil || err.Error() != certsUsage {
+			t.Errorf("Test %d: Expected usage error, got: %v", i, err)
+		}
+	}
+}
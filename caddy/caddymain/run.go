@@ -4,6 +4,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -30,6 +31,7 @@ func init() {
 
 	flag.BoolVar(&caddytls.Agreed, "agree", false, "Agree to the CA's Subscriber Agreement")
 	flag.StringVar(&caddytls.DefaultCAUrl, "ca", "https://acme-v01.api.letsencrypt.org/directory", "URL to certificate authority's ACME server directory")
+	flag.BoolVar(&caTest, "ca-test", false, "Obtain new certificates from the staging CA, to protect rate limits")
 	flag.StringVar(&conf, "conf", "", "Caddyfile to load (default \""+caddy.DefaultConfigFile+"\")")
 	flag.StringVar(&cpu, "cpu", "100%", "CPU cap")
 	flag.BoolVar(&plugins, "plugins", false, "List installed plugins")
@@ -41,6 +43,8 @@ func init() {
 	flag.StringVar(&revoke, "revoke", "", "Hostname for which to revoke the certificate")
 	flag.StringVar(&serverType, "type", "http", "Type of server to run")
 	flag.BoolVar(&version, "version", false, "Show version")
+	flag.IntVar(&workers, "workers", 0, "Number of worker processes to run (0 serves in this process)")
+	flag.StringVar(&workerStats, "workerstats", "", "Address on which the master serves worker status as JSON")
 
 	caddy.RegisterCaddyfileLoader("flag", caddy.LoaderFunc(confLoader))
 	caddy.SetDefaultCaddyfileLoader("default", caddy.LoaderFunc(defaultLoader))
@@ -71,6 +75,13 @@ func Run() {
 		})
 	}
 
+	// Certificates obtained from the staging CA are kept
+	// apart, in the storage for that CA
+	if caTest {
+		caddytls.DefaultCAUrl = caddytls.StagingCAUrl
+		log.Printf("[INFO] Obtaining new certificates from the staging CA (%s)", caddytls.StagingCAUrl)
+	}
+
 	// Check for one-time actions
 	if revoke != "" {
 		err := caddytls.Revoke(revoke)
@@ -91,6 +102,21 @@ func Run() {
 		fmt.Println(caddy.DescribePlugins())
 		os.Exit(0)
 	}
+	if command, ok := commands[flag.Arg(0)]; ok {
+		err := command(os.Stdout, flag.Args()[1:])
+		if err != nil {
+			mustLogFatalf(err.Error())
+		}
+		os.Exit(0)
+	}
+
+	// Supervise worker processes instead of serving, if desired
+	if workers > 0 && caddy.WorkerID() == 0 {
+		runWorkers(workers)
+	}
+	if caddy.WorkerID() > 0 {
+		caddy.PidFile = "" // the master writes the pidfile
+	}
 
 	moveStorage() // TODO: This is temporary for the 0.9 release, or until most users upgrade to 0.9+
 
@@ -111,6 +137,9 @@ func Run() {
 	if err != nil {
 		mustLogFatalf(err.Error())
 	}
+	if caddy.WorkerID() > 0 {
+		notifyMaster()
+	}
 
 	// Twiddle your thumbs
 	instance.Wait()
@@ -129,6 +158,14 @@ func mustLogFatalf(format string, args ...interface{}) {
 	log.Fatalf(format, args...)
 }
 
+// commands are the one-time actions run instead
+// of serving when their name is the first argument.
+var commands = map[string]func(io.Writer, []string) error{
+	"acme":    runACME,
+	"certs":   runCerts,
+	"storage": runStorage,
+}
+
 // confLoader loads the Caddyfile using the -conf flag.
 func confLoader(serverType string) (caddy.Input, error) {
 	if conf == "" {
@@ -272,8 +309,12 @@ var (
 	cpu        string
 	logfile    string
 	revoke     string
+	caTest     bool
 	version    bool
 	plugins    bool
+
+	workers     int
+	workerStats string
 )
 
 // Build information obtained with the help of -ldflags
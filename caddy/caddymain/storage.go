@@ -0,0 +1,48 @@
+package caddymain
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/mholt/caddy/caddytls"
+)
+
+// runStorage runs the storage command with args, which copies
+// the certificates, keys and accounts for the CA of the -ca
+// flag between storage backends, like to move a single
+// instance into a cluster that shares its storage:
+//
+//	storage migrate -to name [-from name] [-overwrite]
+//
+// The source is the file storage by default. Assets the
+// destination already has are kept unless -overwrite is given.
+func runStorage(out io.Writer, args []string) error {
+	if len(args) == 0 || args[0] != "migrate" {
+		return errors.New(storageUsage)
+	}
+	fs := flag.NewFlagSet("storage migrate", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	from := fs.String("from", "file", "Storage to copy from")
+	to := fs.String("to", "", "Storage to copy to")
+	overwrite := fs.Bool("overwrite", false, "Replace assets the destination has")
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 0 || *to == "" {
+		return errors.New(storageUsage)
+	}
+
+	m, err := caddytls.MigrateStorage(caddytls.DefaultCAUrl, *from, *to, *overwrite)
+	for _, domain := range m.Sites {
+		fmt.Fprintf(out, "Copied certificate for %s\n", domain)
+	}
+	for _, email := range m.Users {
+		fmt.Fprintf(out, "Copied account %s\n", email)
+	}
+	for _, name := range m.Skipped {
+		fmt.Fprintf(out, "Skipped %s, which %s already has\n", name, *to)
+	}
+	return err
+}
+
+const storageUsage = "usage: storage migrate -to name [-from name] [-overwrite]"
@@ -0,0 +1,22 @@
+package caddymain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRunStorageUsage(t *testing.T) {
+	for i, args := range [][]string{
+		{},
+		{"copy", "-to", "consul"},
+		{"migrate"},
+		{"migrate", "-from", "file"},
+		{"migrate", "-to", "consul", "extra"},
+		{"migrate", "-to"},
+	} {
+		var out bytes.Buffer
+		if err := runStorage(&out, args); err == nil || err.Error() != storageUsage {
+			t.Errorf("Test %d: Expected usage error, got: %v", i, err)
+		}
+	}
+}
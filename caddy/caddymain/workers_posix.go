@@ -0,0 +1,312 @@
+// +build !windows
+
+package caddymain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mholt/caddy"
+)
+
+// runWorkers runs this process as the master of n worker
+// processes, each of which runs Caddy with the same arguments
+// and serves on the same listeners. Workers that exit are
+// restarted until the master is signaled to stop. It does
+// not return.
+func runWorkers(n int) {
+	if conf == "stdin" {
+		mustLogFatalf("-workers cannot be used with -conf stdin")
+	}
+
+	s := &supervisor{stop: make(chan struct{})}
+	for i := 1; i <= n; i++ {
+		s.workers = append(s.workers, &worker{id: i})
+	}
+
+	// the master handles signals itself, to relay them to workers
+	signal.Reset()
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP, syscall.SIGUSR1)
+
+	if caddy.PidFile != "" {
+		err := ioutil.WriteFile(caddy.PidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+		if err != nil {
+			mustLogFatalf("[ERROR] Writing pidfile: %v", err)
+		}
+	}
+
+	if workerStats != "" {
+		go func() {
+			err := http.ListenAndServe(workerStats, s)
+			if err != nil {
+				log.Printf("[ERROR] Worker stats: %v", err)
+			}
+		}()
+	}
+
+	// the first worker obtains any certificates, so that
+	// the others find them in storage instead of all asking
+	// the CA at once
+	if err := s.workers[0].start(); err != nil {
+		if caddy.PidFile != "" {
+			os.Remove(caddy.PidFile)
+		}
+		mustLogFatalf("[ERROR] Starting worker 1: %v", err)
+	}
+	for _, w := range s.workers[1:] {
+		if err := w.start(); err != nil {
+			log.Printf("[ERROR] Starting worker %d: %v", w.id, err)
+		}
+	}
+	for _, w := range s.workers {
+		s.wg.Add(1)
+		go s.supervise(w)
+	}
+	if !caddy.Quiet {
+		fmt.Printf("Started %d workers\n", n)
+	}
+
+	go func() {
+		for sig := range sigchan {
+			if sig == syscall.SIGUSR1 {
+				log.Println("[INFO] SIGUSR1: Reloading workers")
+			} else {
+				log.Printf("[INFO] %v: Stopping workers", sig)
+				s.stopOnce.Do(func() { close(s.stop) })
+			}
+			s.signal(sig)
+		}
+	}()
+
+	s.wg.Wait()
+	if caddy.PidFile != "" {
+		os.Remove(caddy.PidFile)
+	}
+	os.Exit(0)
+}
+
+// supervisor keeps worker processes running.
+type supervisor struct {
+	workers  []*worker
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// supervise waits for w to exit and restarts it,
+// until the supervisor stops.
+func (s *supervisor) supervise(w *worker) {
+	defer s.wg.Done()
+	var backoff time.Duration
+	for {
+		w.wait()
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		ran := w.uptime()
+		backoff = nextRestartDelay(backoff, ran)
+		log.Printf("[ERROR] Worker %d exited after %v (%s); restarting in %v",
+			w.id, ran, w.status().LastExit, backoff)
+
+		for {
+			select {
+			case <-time.After(backoff):
+			case <-s.stop:
+				return
+			}
+			err := w.start()
+			if err == nil {
+				break
+			}
+			backoff = nextRestartDelay(backoff, 0)
+			log.Printf("[ERROR] Restarting worker %d: %v; retrying in %v", w.id, err, backoff)
+		}
+	}
+}
+
+// signal sends sig to all running workers.
+func (s *supervisor) signal(sig os.Signal) {
+	for _, w := range s.workers {
+		w.signal(sig)
+	}
+}
+
+// ServeHTTP serves the status of the workers as JSON.
+func (s *supervisor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var stats []workerStatus
+	for _, wk := range s.workers {
+		stats = append(stats, wk.status())
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// nextRestartDelay returns how long to wait before restarting a
+// worker that ran for the given time, after waiting prev last
+// time. Workers that crash right away are restarted ever more
+// slowly, so a broken configuration does not spin the CPU.
+func nextRestartDelay(prev, ran time.Duration) time.Duration {
+	if ran >= stableUptime || prev < minRestartDelay {
+		return minRestartDelay
+	}
+	next := prev * 2
+	if next > maxRestartDelay {
+		next = maxRestartDelay
+	}
+	return next
+}
+
+// worker is a worker process.
+type worker struct {
+	id int
+
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	done     chan struct{} // closed when cmd exits
+	started  time.Time
+	restarts int
+	lastExit string
+}
+
+// workerStatus is the status of a worker,
+// as served by the supervisor.
+type workerStatus struct {
+	ID       int    `json:"id"`
+	PID      int    `json:"pid,omitempty"`
+	Running  bool   `json:"running"`
+	Started  string `json:"started,omitempty"`
+	Uptime   string `json:"uptime,omitempty"`
+	Restarts int    `json:"restarts"`
+	LastExit string `json:"last_exit,omitempty"`
+}
+
+// start starts the worker process and waits until it is
+// serving, or returns an error if it exits before that.
+func (w *worker) start() error {
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+
+	cmd := exec.Command(os.Args[0], os.Args[1:]...)
+	cmd.Env = append(os.Environ(), caddy.WorkerEnv+"="+strconv.Itoa(w.id))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{readyW} // fd 3 in the worker
+	// signals are relayed by the master, so workers
+	// don't get them twice from the terminal
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	w.mu.Lock()
+	if w.cmd != nil {
+		w.restarts++
+	}
+	w.cmd, w.done, w.started = cmd, done, time.Now()
+	w.mu.Unlock()
+
+	go func() {
+		err := cmd.Wait()
+		w.mu.Lock()
+		if err != nil {
+			w.lastExit = err.Error()
+		} else {
+			w.lastExit = "exit status 0"
+		}
+		w.mu.Unlock()
+		close(done)
+	}()
+
+	// the worker writes to the pipe once it is serving; if
+	// it exits before, reading returns EOF without data
+	buf := make([]byte, 1)
+	if n, _ := ready.Read(buf); n == 0 {
+		<-done
+		return fmt.Errorf("worker exited before it was ready (%s)", w.status().LastExit)
+	}
+	return nil
+}
+
+// wait waits for the worker process to exit.
+func (w *worker) wait() {
+	w.mu.Lock()
+	done := w.done
+	w.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// signal sends sig to the worker process if it is running.
+func (w *worker) signal(sig os.Signal) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cmd == nil || w.cmd.Process == nil {
+		return
+	}
+	select {
+	case <-w.done:
+	default:
+		w.cmd.Process.Signal(sig)
+	}
+}
+
+// uptime returns how long the current or last
+// worker process ran.
+func (w *worker) uptime() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return time.Since(w.started)
+}
+
+// status returns the status of the worker.
+func (w *worker) status() workerStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	st := workerStatus{ID: w.id, Restarts: w.restarts, LastExit: w.lastExit}
+	if w.cmd != nil && w.cmd.Process != nil {
+		select {
+		case <-w.done:
+		default:
+			st.Running = true
+			st.PID = w.cmd.Process.Pid
+			st.Started = w.started.Format(time.RFC3339)
+			st.Uptime = time.Since(w.started).String()
+		}
+	}
+	return st
+}
+
+// notifyMaster tells the master process that
+// this worker is serving.
+func notifyMaster() {
+	f := os.NewFile(3, "ready")
+	f.Write([]byte{1})
+	f.Close()
+}
+
+const (
+	minRestartDelay = 1 * time.Second
+	maxRestartDelay = 1 * time.Minute
+	stableUptime    = 1 * time.Minute // a worker that ran this long is not crash-looping
+)
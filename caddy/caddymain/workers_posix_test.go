@@ -0,0 +1,26 @@
+// +build !windows
+
+package caddymain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextRestartDelay(t *testing.T) {
+	for i, test := range []struct {
+		prev, ran time.Duration
+		expect    time.Duration
+	}{
+		{0, 0, minRestartDelay},
+		{minRestartDelay, time.Second, 2 * minRestartDelay},
+		{4 * time.Second, 10 * time.Second, 8 * time.Second},
+		{maxRestartDelay, 0, maxRestartDelay},
+		{40 * time.Second, 0, maxRestartDelay},
+		{30 * time.Second, stableUptime, minRestartDelay},
+	} {
+		if actual := nextRestartDelay(test.prev, test.ran); actual != test.expect {
+			t.Errorf("Test %d: Expected %v, got %v", i, test.expect, actual)
+		}
+	}
+}
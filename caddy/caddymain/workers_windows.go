@@ -0,0 +1,10 @@
+package caddymain
+
+// runWorkers is not supported on Windows, which
+// lacks SO_REUSEPORT for sharing listeners.
+func runWorkers(n int) {
+	mustLogFatalf("-workers is not supported on Windows")
+}
+
+// notifyMaster is a no-op on Windows.
+func notifyMaster() {}
@@ -0,0 +1,62 @@
+// Command caddyrelay runs the public end of Caddy's tunnels. Run it
+// on a machine with a public address and point DNS for the tunneled
+// hostnames (for example, a wildcard record under -domain) at it;
+// Caddy instances with the tunnel directive connect to it and serve
+// their sites through it, obtaining certificates as usual.
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"log"
+	"net"
+
+	"github.com/mholt/caddy/caddyhttp/tunnel"
+)
+
+var (
+	tunnelAddr = flag.String("tunnel", ":"+tunnel.DefaultRelayPort, "Address on which Caddy instances connect")
+	httpAddr   = flag.String("http", ":80", "Address of the public HTTP listener")
+	httpsAddr  = flag.String("https", ":443", "Address of the public HTTPS listener")
+	token      = flag.String("token", "", "Token Caddy instances must present")
+	open       = flag.Bool("open", false, "Let Caddy instances register without a token")
+	domain     = flag.String("domain", "", "Only allow hostnames under this domain")
+	certFile   = flag.String("cert", "", "Certificate for the tunnel listener (enables TLS)")
+	keyFile    = flag.String("key", "", "Private key for the tunnel listener")
+	maxIdle    = flag.Int("maxidle", tunnel.DefaultMaxIdle, "Maximum idle tunnel connections per hostname")
+)
+
+func main() {
+	flag.Parse()
+
+	if *token == "" {
+		if !*open {
+			log.Fatal("No -token given; use -open to let anybody register hostnames")
+		}
+		log.Println("[WARNING] No -token given; anybody can register a hostname")
+	}
+
+	tunnelLn, err := net.Listen("tcp", *tunnelAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *certFile != "" || *keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tunnelLn = tls.NewListener(tunnelLn, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}
+	httpLn, err := net.Listen("tcp", *httpAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	httpsLn, err := net.Listen("tcp", *httpsAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	relay := &tunnel.Relay{Token: *token, Open: *open, Domain: *domain, MaxIdle: *maxIdle}
+	log.Printf("Relaying %s and %s through tunnels on %s", httpLn.Addr(), httpsLn.Addr(), tunnelLn.Addr())
+	log.Fatal(relay.Serve(tunnelLn, httpLn, httpsLn))
+}
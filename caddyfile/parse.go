@@ -1,7 +1,9 @@
 package caddyfile
 
 import (
+	"bytes"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
@@ -88,7 +90,10 @@ func (p *parser) addresses() error {
 	var expectingAnother bool
 
 	for {
-		tkn := replaceEnvVars(p.Val())
+		tkn, err := p.replacePlaceholders(p.Val())
+		if err != nil {
+			return err
+		}
 
 		// special case: import directive replaces tokens during parse-time
 		if tkn == "import" && p.isNewLine() {
@@ -200,7 +205,10 @@ func (p *parser) doImport() error {
 	if !p.NextArg() {
 		return p.ArgErr()
 	}
-	importPattern := replaceEnvVars(p.Val())
+	importPattern, err := p.replacePlaceholders(p.Val())
+	if err != nil {
+		return err
+	}
 	if importPattern == "" {
 		return p.Err("Import requires a non-empty filepath")
 	}
@@ -338,7 +346,11 @@ func (p *parser) directive() error {
 		} else if p.Val() == "}" && nesting == 0 {
 			return p.Err("Unexpected '}' because no matching opening brace")
 		}
-		p.tokens[p.cursor].Text = replaceEnvVars(p.tokens[p.cursor].Text)
+		text, err := p.replacePlaceholders(p.tokens[p.cursor].Text)
+		if err != nil {
+			return err
+		}
+		p.tokens[p.cursor].Text = text
 		p.block.Tokens[dir] = append(p.block.Tokens[dir], p.tokens[p.cursor])
 	}
 
@@ -383,29 +395,79 @@ func (p *parser) validDirective(dir string) bool {
 	return false
 }
 
+// replacePlaceholders replaces the environment variables and file
+// references in s, a token of the current file. A file reference
+// {file:path} is replaced with the contents of the file, without
+// leading and trailing white space; relative paths are relative
+// to the file the token is in.
+func (p *parser) replacePlaceholders(s string) (string, error) {
+	s = replaceEnvVars(s)
+	var err error
+	s = replaceReferences(s, "{file:", "}", func(name string) string {
+		if err != nil {
+			return ""
+		}
+		if !filepath.IsAbs(name) {
+			file := p.Dispenser.filename
+			if p.cursor >= 0 && p.cursor < len(p.tokens) && p.tokens[p.cursor].File != "" {
+				file = p.tokens[p.cursor].File
+			}
+			name = filepath.Join(filepath.Dir(file), name)
+		}
+		contents, readErr := ioutil.ReadFile(name)
+		if readErr != nil {
+			err = p.Errf("Reading file for placeholder: %v", readErr)
+			return ""
+		}
+		return strings.TrimSpace(string(contents))
+	})
+	return s, err
+}
+
 // replaceEnvVars replaces environment variables that appear in the token
-// and understands both the $UNIX and %WINDOWS% syntaxes.
+// and understands both the $UNIX and %WINDOWS% syntaxes. A default value
+// for when a variable is empty can follow its name after a colon, as in
+// {$PORT:8080}.
 func replaceEnvVars(s string) string {
-	s = replaceEnvReferences(s, "{%", "%}")
-	s = replaceEnvReferences(s, "{$", "}")
+	s = replaceReferences(s, "{%", "%}", getenv)
+	s = replaceReferences(s, "{$", "}", getenv)
 	return s
 }
 
-// replaceEnvReferences performs the actual replacement of env variables
-// in s, given the placeholder start and placeholder end strings.
-func replaceEnvReferences(s, refStart, refEnd string) string {
-	index := strings.Index(s, refStart)
-	for index != -1 {
-		endIndex := strings.Index(s, refEnd)
-		if endIndex != -1 {
-			ref := s[index : endIndex+len(refEnd)]
-			s = strings.Replace(s, ref, os.Getenv(ref[len(refStart):len(ref)-len(refEnd)]), -1)
-		} else {
-			return s
+// getenv returns the value of the environment variable
+// name[:default], or the default if it is empty.
+func getenv(name string) string {
+	var def string
+	if i := strings.Index(name, ":"); i >= 0 {
+		name, def = name[:i], name[i+1:]
+	}
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// replaceReferences replaces each reference in s, which starts
+// with refStart and ends with refEnd, with the value of what it
+// refers to. Values are not searched for further references.
+func replaceReferences(s, refStart, refEnd string, value func(string) string) string {
+	var buf bytes.Buffer
+	for {
+		start := strings.Index(s, refStart)
+		if start == -1 {
+			break
 		}
-		index = strings.Index(s, refStart)
+		end := strings.Index(s[start+len(refStart):], refEnd)
+		if end == -1 {
+			break
+		}
+		end += start + len(refStart)
+		buf.WriteString(s[:start])
+		buf.WriteString(value(s[start+len(refStart) : end]))
+		s = s[end+len(refEnd):]
 	}
-	return s
+	buf.WriteString(s)
+	return buf.String()
 }
 
 // ServerBlock associates any number of keys (usually addresses
@@ -495,6 +495,60 @@ func TestEnvironmentReplacement(t *testing.T) {
 	}
 }
 
+func TestPlaceholderDefaultsAndFiles(t *testing.T) {
+	os.Setenv("PORT", "8080")
+	os.Setenv("EMPTY", "")
+
+	// defaults of empty and unset env vars
+	p := testParser(":{$PORT:2015}\ndir1 {$EMPTY:one} {$UNSET_VAR:two} {%UNSET_VAR:three%}")
+	blocks, err := p.parseAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expected := blocks[0].Keys[0], ":8080"; expected != actual {
+		t.Errorf("Expected key to be '%s' but was '%s'", expected, actual)
+	}
+	for i, expected := range []string{"one", "two", "three"} {
+		if actual := blocks[0].Tokens["dir1"][i+1].Text; expected != actual {
+			t.Errorf("Expected argument %d to be '%s' but was '%s'", i, expected, actual)
+		}
+	}
+
+	// values are not replaced again
+	os.Setenv("BRACES", "{$PORT}")
+	p = testParser(":1234\ndir1 {$BRACES}{$PORT}")
+	blocks, _ = p.parseAll()
+	if actual, expected := blocks[0].Tokens["dir1"][1].Text, "{$PORT}8080"; expected != actual {
+		t.Errorf("Expected argument to be '%s' but was '%s'", expected, actual)
+	}
+
+	// file contents, relative to the Caddyfile
+	file, err := filepath.Abs("testdata/placeholder_file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte("  /etc/ssl/site.pem\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file)
+
+	for _, ref := range []string{"testdata/placeholder_file", file} {
+		p = testParser(":1234\ntls {file:" + ref + "} key.pem")
+		blocks, err = p.parseAll()
+		if err != nil {
+			t.Fatalf("Expected no error for %s, got %v", ref, err)
+		}
+		if actual, expected := blocks[0].Tokens["tls"][1].Text, "/etc/ssl/site.pem"; expected != actual {
+			t.Errorf("Expected argument to be '%s' but was '%s'", expected, actual)
+		}
+	}
+
+	p = testParser(":1234\ntls {file:testdata/no_such_file}")
+	if _, err = p.parseAll(); err == nil {
+		t.Error("Expected error for missing file, got none")
+	}
+}
+
 func testParser(input string) parser {
 	buf := strings.NewReader(input)
 	p := parser{Dispenser: NewDispenser("Caddyfile", buf)}
@@ -0,0 +1,276 @@
+// Package apikeys provides middleware that admits requests only
+// with a known API key, within the paths, times of day and daily
+// and monthly request quotas of the key, and serves an API for
+// the usage of the keys.
+package apikeys
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// APIKeys is middleware that requires an API key for
+// requests to Paths, and serves the usage API at AdminPath.
+type APIKeys struct {
+	Next httpserver.Handler
+
+	// Paths are the base paths that require a key
+	Paths []string
+
+	// Header is the request header the key is in
+	Header string
+
+	// Query is the query string parameter the key may be
+	// in instead of the header; if empty, it may not
+	Query string
+
+	// Location is the time zone of the days, months
+	// and times of day of the keys
+	Location *time.Location
+
+	// AdminPath is where the usage API is served, if not empty
+	AdminPath string
+
+	// AllowRemote is whether clients other than those on
+	// the loopback interface may use the usage API
+	AllowRemote bool
+
+	Keys  map[[sha256.Size]byte]*Key // by hash of the key
+	Usage *UsageTable
+}
+
+// Key is an API key, as it is in the keys file.
+type Key struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+
+	// Paths are the base paths the key may be used for;
+	// if empty, any path that requires a key
+	Paths []string `json:"paths,omitempty"`
+
+	// Max requests per day and per month; 0 is no limit
+	Daily   int64 `json:"daily,omitempty"`
+	Monthly int64 `json:"monthly,omitempty"`
+
+	// Hours is the time of day the key may be used,
+	// such as 08:00-18:00; if empty, any time
+	Hours string `json:"hours,omitempty"`
+
+	// Days are the days of the week the key may be
+	// used, such as mon or sat; if empty, any day
+	Days []string `json:"days,omitempty"`
+
+	// The key may be used from NotBefore until
+	// NotAfter, if they are set
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	NotAfter  *time.Time `json:"not_after,omitempty"`
+
+	from, to time.Duration // parsed Hours, since midnight
+	days     map[time.Weekday]bool
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (a APIKeys) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if a.AdminPath != "" && httpserver.Path(r.URL.Path).Matches(a.AdminPath) {
+		return a.serveAdmin(w, r)
+	}
+	if !matches(r.URL.Path, a.Paths) {
+		return a.Next.ServeHTTP(w, r)
+	}
+
+	value := r.Header.Get(a.Header)
+	if value == "" && a.Query != "" {
+		value = r.URL.Query().Get(a.Query)
+	}
+	k, ok := a.Keys[sha256.Sum256([]byte(value))]
+	if value == "" || !ok {
+		return http.StatusUnauthorized, nil
+	}
+	if len(k.Paths) > 0 && !matches(r.URL.Path, k.Paths) {
+		return http.StatusForbidden, nil
+	}
+	now := time.Now().In(a.Location)
+	if !k.allowedAt(now) {
+		return http.StatusForbidden, nil
+	}
+	if wait, ok := a.Usage.use(k, now); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+		return http.StatusTooManyRequests, nil
+	}
+
+	r = httpserver.SetRequestPlaceholder(r, "api_key", k.Name)
+	return a.Next.ServeHTTP(w, r)
+}
+
+func matches(path string, bases []string) bool {
+	for _, base := range bases {
+		if httpserver.Path(path).Matches(base) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedAt returns whether k may be used at now.
+func (k *Key) allowedAt(now time.Time) bool {
+	if k.NotBefore != nil && now.Before(*k.NotBefore) ||
+		k.NotAfter != nil && now.After(*k.NotAfter) {
+		return false
+	}
+	if k.days != nil && !k.days[now.Weekday()] {
+		return false
+	}
+	if k.Hours == "" {
+		return true
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	t := now.Sub(midnight)
+	if k.from <= k.to {
+		return t >= k.from && t < k.to
+	}
+	// the window spans midnight
+	return t >= k.from || t < k.to
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// LoadKeys reads the keys in the JSON file name,
+// which is an array of keys, and checks them.
+func LoadKeys(name string) (map[[sha256.Size]byte]*Key, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Key
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	keys := make(map[[sha256.Size]byte]*Key, len(list))
+	names := make(map[string]bool, len(list))
+	for i, k := range list {
+		if k.Key == "" || k.Name == "" {
+			return nil, fmt.Errorf("%s: key %d has no key or name", name, i)
+		}
+		if names[k.Name] {
+			return nil, fmt.Errorf("%s: duplicate key name '%s'", name, k.Name)
+		}
+		names[k.Name] = true
+		hash := sha256.Sum256([]byte(k.Key))
+		if _, dup := keys[hash]; dup {
+			return nil, fmt.Errorf("%s: key of '%s' is used twice", name, k.Name)
+		}
+		if k.Hours != "" {
+			window := strings.Split(k.Hours, "-")
+			if len(window) != 2 {
+				return nil, fmt.Errorf("%s: invalid hours '%s' of '%s'", name, k.Hours, k.Name)
+			}
+			if k.from, err = httpserver.ParseTimeOfDay(window[0]); err == nil {
+				k.to, err = httpserver.ParseTimeOfDay(window[1])
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid hours '%s' of '%s'", name, k.Hours, k.Name)
+			}
+			if k.from == k.to {
+				return nil, fmt.Errorf("%s: hours '%s' of '%s' are empty", name, k.Hours, k.Name)
+			}
+		}
+		if len(k.Days) > 0 {
+			k.days = make(map[time.Weekday]bool)
+			for _, day := range k.Days {
+				wd, ok := weekdays[strings.ToLower(day)]
+				if !ok {
+					return nil, fmt.Errorf("%s: invalid day '%s' of '%s'", name, day, k.Name)
+				}
+				k.days[wd] = true
+			}
+		}
+		keys[hash] = k
+	}
+	return keys, nil
+}
+
+// KeyUsage is how much a key was used, as
+// it is listed by the usage API.
+type KeyUsage struct {
+	Name      string   `json:"name"`
+	Paths     []string `json:"paths,omitempty"`
+	Daily     int64    `json:"daily,omitempty"`
+	Monthly   int64    `json:"monthly,omitempty"`
+	Today     int64    `json:"today"`
+	ThisMonth int64    `json:"this_month"`
+}
+
+type byName []KeyUsage
+
+func (u byName) Len() int           { return len(u) }
+func (u byName) Less(i, j int) bool { return u[i].Name < u[j].Name }
+func (u byName) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
+
+// serveAdmin serves the usage API:
+//
+//	GET  {path}                lists the usage of the keys
+//	POST {path}/reset?name=n   resets the usage of key n
+func (a APIKeys) serveAdmin(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !a.AllowRemote && !caddy.IsLoopback(r.RemoteAddr) {
+		return http.StatusForbidden, nil
+	}
+	now := time.Now().In(a.Location)
+
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, a.AdminPath), "/") {
+	case "":
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			return http.StatusMethodNotAllowed, nil
+		}
+		list := make([]KeyUsage, 0, len(a.Keys))
+		for _, k := range a.Keys {
+			today, thisMonth := a.Usage.get(k.Name, now)
+			list = append(list, KeyUsage{
+				Name:      k.Name,
+				Paths:     k.Paths,
+				Daily:     k.Daily,
+				Monthly:   k.Monthly,
+				Today:     today,
+				ThisMonth: thisMonth,
+			})
+		}
+		sort.Sort(byName(list))
+		body, err := json.Marshal(list)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(body)
+		return 0, nil
+	case "reset":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			return http.StatusMethodNotAllowed, nil
+		}
+		name := r.FormValue("name")
+		for _, k := range a.Keys {
+			if k.Name == name {
+				a.Usage.reset(name)
+				w.WriteHeader(http.StatusNoContent)
+				return 0, nil
+			}
+		}
+		httpserver.WriteTextResponse(w, http.StatusNotFound, "no key named '"+name+"'\n")
+		return 0, nil
+	}
+	return http.StatusNotFound, nil
+}
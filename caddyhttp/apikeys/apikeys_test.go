@@ -0,0 +1,187 @@
+package apikeys
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func testKeys(keys ...*Key) map[[sha256.Size]byte]*Key {
+	m := make(map[[sha256.Size]byte]*Key)
+	for _, k := range keys {
+		m[sha256.Sum256([]byte(k.Key))] = k
+	}
+	return m
+}
+
+func TestAPIKeys(t *testing.T) {
+	a := APIKeys{
+		Paths:    []string{"/api"},
+		Header:   "X-API-Key",
+		Query:    "api_key",
+		Location: time.UTC,
+		Keys: testKeys(
+			&Key{Key: "secret1", Name: "one", Daily: 2},
+			&Key{Key: "secret2", Name: "two", Paths: []string{"/api/two"}},
+		),
+		Usage: &UsageTable{counts: make(map[string]*usage)},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+	}
+
+	for i, test := range []struct {
+		path, key      string
+		expectedStatus int
+	}{
+		{"/public", "", http.StatusOK},
+		{"/api/x", "", http.StatusUnauthorized},
+		{"/api/x", "wrong", http.StatusUnauthorized},
+		{"/api/x", "secret1", http.StatusOK},
+		{"/api/x?api_key=secret1", "", http.StatusOK},
+		{"/api/x", "secret1", http.StatusTooManyRequests},
+		{"/api/x", "secret2", http.StatusForbidden},
+		{"/api/two/y", "secret2", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", test.path, nil)
+		if test.key != "" {
+			req.Header.Set("X-API-Key", test.key)
+		}
+		w := httptest.NewRecorder()
+		status, err := a.ServeHTTP(w, req)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if status == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("Test %d: Expected Retry-After to be set", i)
+		}
+	}
+}
+
+func TestKeyAllowedAt(t *testing.T) {
+	notAfter := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i, test := range []struct {
+		key      Key
+		at       time.Time
+		expected bool
+	}{
+		{Key{}, time.Date(2017, 5, 1, 3, 0, 0, 0, time.UTC), true},
+		{Key{Hours: "08:00-18:00", from: 8 * time.Hour, to: 18 * time.Hour}, time.Date(2017, 5, 1, 9, 30, 0, 0, time.UTC), true},
+		{Key{Hours: "08:00-18:00", from: 8 * time.Hour, to: 18 * time.Hour}, time.Date(2017, 5, 1, 18, 0, 0, 0, time.UTC), false},
+		{Key{Hours: "22:00-06:00", from: 22 * time.Hour, to: 6 * time.Hour}, time.Date(2017, 5, 1, 23, 0, 0, 0, time.UTC), true},
+		{Key{Hours: "22:00-06:00", from: 22 * time.Hour, to: 6 * time.Hour}, time.Date(2017, 5, 1, 12, 0, 0, 0, time.UTC), false},
+		{Key{days: map[time.Weekday]bool{time.Saturday: true}}, time.Date(2017, 5, 6, 12, 0, 0, 0, time.UTC), true},
+		{Key{days: map[time.Weekday]bool{time.Saturday: true}}, time.Date(2017, 5, 1, 12, 0, 0, 0, time.UTC), false},
+		{Key{NotAfter: &notAfter}, time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC), false},
+	} {
+		if actual := test.key.allowedAt(test.at); actual != test.expected {
+			t.Errorf("Test %d: Expected %v, got %v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestUsageTable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_api_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "usage.json")
+
+	table, err := GetUsageTable(file, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Key{Name: "k", Monthly: 3}
+	day := time.Date(2017, 5, 31, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if _, ok := table.use(k, day); !ok {
+			t.Fatalf("Expected use %d to be allowed", i)
+		}
+	}
+	wait, ok := table.use(k, day)
+	if ok || wait != 12*time.Hour {
+		t.Errorf("Expected to wait 12h for the next month, got %v %v", wait, ok)
+	}
+	if today, _ := table.get("k", day.Add(24*time.Hour)); today != 0 {
+		t.Errorf("Expected counts of a new day to start at 0, got %d", today)
+	}
+
+	if err := table.save(); err != nil {
+		t.Fatal(err)
+	}
+	var saved map[string]*usage
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved["k"] == nil || saved["k"].ThisMonth != 0 || saved["k"].Month != "2017-06" {
+		t.Errorf("Expected saved usage of the new month, got %+v", saved["k"])
+	}
+
+	table.reset("k")
+	if _, ok := table.use(k, day); !ok {
+		t.Error("Expected use to be allowed after reset")
+	}
+}
+
+func TestServeAdmin(t *testing.T) {
+	a := APIKeys{
+		Paths:     []string{"/"},
+		Location:  time.UTC,
+		AdminPath: "/api-usage",
+		Keys:      testKeys(&Key{Key: "secret", Name: "one", Daily: 10}),
+		Usage:     &UsageTable{counts: make(map[string]*usage)},
+	}
+	a.Usage.use(a.Keys[sha256.Sum256([]byte("secret"))], time.Now().In(time.UTC))
+
+	req := httptest.NewRequest("GET", "/api-usage", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if status, _ := a.ServeHTTP(httptest.NewRecorder(), req); status != http.StatusForbidden {
+		t.Errorf("Expected remote clients to be forbidden, got %d", status)
+	}
+
+	req.RemoteAddr = "127.0.0.1:1234"
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, req)
+	var list []KeyUsage
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Expected JSON, got %q: %v", w.Body.String(), err)
+	}
+	if len(list) != 1 || list[0].Name != "one" || list[0].Today != 1 || list[0].Daily != 10 {
+		t.Errorf("Expected usage of key one, got %+v", list)
+	}
+
+	req = httptest.NewRequest("POST", "/api-usage/reset?name=one", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 after reset, got %d", w.Code)
+	}
+	if today, _ := a.Usage.get("one", time.Now().In(time.UTC)); today != 0 {
+		t.Errorf("Expected usage to be reset, got %d", today)
+	}
+
+	req = httptest.NewRequest("POST", "/api-usage/reset?name=none", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown key, got %d", w.Code)
+	}
+}
@@ -0,0 +1,150 @@
+package apikeys
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("api_keys", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new APIKeys middleware instance. Syntax:
+//
+//	api_keys [paths...] {
+//	    keys     file
+//	    header   name
+//	    query    name
+//	    usage    file
+//	    timezone zone
+//	    admin    path
+//	    allow_remote
+//	}
+//
+// The keys file is required; it is a JSON array of keys, each
+// with its key, name and optional paths, daily and monthly
+// quotas, hours, days, not_before and not_after. Keys are sent
+// in the X-API-Key header by default. Usage is saved to the
+// usage file, if given, every minute and on shutdown. Unless
+// allow_remote is given, only clients on the loopback interface
+// may use the usage API at the admin path.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+	a, usageFile, err := apiKeysParse(c, cfg.Root)
+	if err != nil {
+		return err
+	}
+
+	id := usageFile
+	if id == "" {
+		id = cfg.Addr.String()
+	}
+	if a.Usage, err = GetUsageTable(id, usageFile); err != nil {
+		return c.Errf("api_keys: loading usage: %v", err)
+	}
+	if usageFile != "" {
+		stop := make(chan struct{})
+		c.OnStartup(func() error {
+			go a.Usage.run(DefaultSaveInterval, stop)
+			return nil
+		})
+		c.OnShutdown(func() error {
+			close(stop)
+			return a.Usage.save()
+		})
+	}
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		a.Next = next
+		return a
+	})
+	return nil
+}
+
+func apiKeysParse(c *caddy.Controller, root string) (APIKeys, string, error) {
+	a := APIKeys{Header: "X-API-Key", Location: time.Local}
+	var keysFile, usageFile string
+
+	var seen bool
+	for c.Next() {
+		if seen {
+			return a, "", c.Err("api_keys: can only be specified once per site")
+		}
+		seen = true
+
+		a.Paths = c.RemainingArgs()
+		if len(a.Paths) == 0 {
+			a.Paths = []string{"/"}
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			if what == "allow_remote" {
+				if len(args) != 0 {
+					return a, "", c.ArgErr()
+				}
+				a.AllowRemote = true
+				continue
+			}
+			if len(args) != 1 {
+				return a, "", c.ArgErr()
+			}
+			switch what {
+			case "keys":
+				keysFile = args[0]
+			case "header":
+				a.Header = args[0]
+			case "query":
+				a.Query = args[0]
+			case "usage":
+				usageFile = args[0]
+			case "timezone":
+				loc, err := time.LoadLocation(args[0])
+				if err != nil {
+					return a, "", c.Errf("api_keys: invalid timezone '%s'", args[0])
+				}
+				a.Location = loc
+			case "admin":
+				if !strings.HasPrefix(args[0], "/") {
+					return a, "", c.Errf("api_keys: invalid admin path '%s'", args[0])
+				}
+				a.AdminPath = args[0]
+			default:
+				return a, "", c.Errf("api_keys: unknown property '%s'", what)
+			}
+		}
+	}
+	if !seen {
+		return a, "", nil
+	}
+
+	if keysFile == "" {
+		return a, "", c.Err("api_keys: keys file is required")
+	}
+	if !filepath.IsAbs(keysFile) {
+		if err := httpserver.CheckStaticRoot(c); err != nil {
+			return a, "", err
+		}
+		keysFile = filepath.Join(root, keysFile)
+	}
+	keys, err := LoadKeys(keysFile)
+	if err != nil {
+		return a, "", c.Errf("api_keys: %v", err)
+	}
+	a.Keys = keys
+	if usageFile != "" && !filepath.IsAbs(usageFile) {
+		if err := httpserver.CheckStaticRoot(c); err != nil {
+			return a, "", err
+		}
+		usageFile = filepath.Join(root, usageFile)
+	}
+	return a, usageFile, nil
+}
@@ -0,0 +1,139 @@
+package apikeys
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func writeKeys(t *testing.T, dir, content string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, "keys.json"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_api_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeKeys(t, dir, `[{"key": "secret", "name": "one"}]`)
+
+	c := caddy.NewTestController("http", "api_keys {\nkeys "+filepath.Join(dir, "keys.json")+"\n}")
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	a, ok := handler.(APIKeys)
+	if !ok {
+		t.Fatalf("Expected handler to be type APIKeys, got: %#v", handler)
+	}
+	if !httpserver.SameNext(a.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if a.Usage == nil || len(a.Keys) != 1 || a.Header != "X-API-Key" {
+		t.Errorf("Expected defaults and one key, got %+v", a)
+	}
+}
+
+func TestAPIKeysParse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_api_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, test := range []struct {
+		keys      string
+		input     string
+		shouldErr bool
+		paths     []string
+	}{
+		{`[{"key": "a", "name": "one"}]`, `api_keys {
+			keys keys.json
+		}`, false, []string{"/"}},
+		{`[{"key": "a", "name": "one", "hours": "08:00-18:00", "days": ["Mon", "tue"]}]`, `api_keys /api /v2 {
+			keys keys.json
+			header Authorization
+			query key
+			timezone UTC
+			usage usage.json
+			admin /usage
+			allow_remote
+		}`, false, []string{"/api", "/v2"}},
+		{`[{"key": "a", "name": "one"}]`, `api_keys /api`, true, nil},
+		{`[{"key": "a", "name": "one"}]`, `api_keys {
+			keys keys.json
+			what x
+		}`, true, nil},
+		{`[{"key": "a", "name": "one"}]`, `api_keys {
+			keys keys.json
+			timezone Nowhere/Nothing
+		}`, true, nil},
+		{`[{"key": "a", "name": "one"}]`, `api_keys {
+			keys keys.json
+			admin usage
+		}`, true, nil},
+		{`[{"key": "a", "name": "one"}]`, `api_keys {
+			keys keys.json
+			allow_remote yes
+		}`, true, nil},
+		{`[{"key": "a", "name": "one"}]`, `api_keys {
+			keys keys.json
+		}
+		api_keys {
+			keys keys.json
+		}`, true, nil},
+		{`[{"key": "a", "name": "one"}, {"key": "b", "name": "one"}]`, `api_keys {
+			keys keys.json
+		}`, true, nil},
+		{`[{"key": "a", "name": "one"}, {"key": "a", "name": "two"}]`, `api_keys {
+			keys keys.json
+		}`, true, nil},
+		{`[{"key": "a"}]`, `api_keys {
+			keys keys.json
+		}`, true, nil},
+		{`[{"key": "a", "name": "one", "hours": "8-18"}]`, `api_keys {
+			keys keys.json
+		}`, true, nil},
+		{`[{"key": "a", "name": "one", "hours": "00:00-00:00"}]`, `api_keys {
+			keys keys.json
+		}`, true, nil},
+		{`[{"key": "a", "name": "one", "days": ["someday"]}]`, `api_keys {
+			keys keys.json
+		}`, true, nil},
+		{`{"key": "a"}`, `api_keys {
+			keys keys.json
+		}`, true, nil},
+	} {
+		writeKeys(t, dir, test.keys)
+		a, _, err := apiKeysParse(caddy.NewTestController("http", test.input), dir)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if len(a.Paths) != len(test.paths) {
+			t.Errorf("Test %d: Expected paths %v, got %v", i, test.paths, a.Paths)
+		}
+		for j := range test.paths {
+			if j < len(a.Paths) && a.Paths[j] != test.paths[j] {
+				t.Errorf("Test %d: Expected paths %v, got %v", i, test.paths, a.Paths)
+			}
+		}
+	}
+}
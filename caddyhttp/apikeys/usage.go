@@ -0,0 +1,156 @@
+package apikeys
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// UsageTable counts the requests made with each key, by
+// name, in the current day and month, and saves the counts
+// to a file, if it has one, so they outlive the process.
+type UsageTable struct {
+	mu     sync.Mutex
+	counts map[string]*usage
+	file   string
+	dirty  bool
+}
+
+// usage is how often a key was used, as it is saved.
+type usage struct {
+	Day       string `json:"day"`
+	Today     int64  `json:"today"`
+	Month     string `json:"month"`
+	ThisMonth int64  `json:"this_month"`
+}
+
+// roll starts new counts for the day and the month of now,
+// if they are not the ones being counted.
+func (u *usage) roll(now time.Time) {
+	if day := now.Format("2006-01-02"); u.Day != day {
+		u.Day, u.Today = day, 0
+	}
+	if month := now.Format("2006-01"); u.Month != month {
+		u.Month, u.ThisMonth = month, 0
+	}
+}
+
+var (
+	usageTables   = make(map[string]*UsageTable)
+	usageTablesMu sync.Mutex
+)
+
+// GetUsageTable returns the usage table with id, which is its file
+// if it has one, loading it from the file if it was not before. The
+// table is kept, so its counts are not lost when the server reloads.
+func GetUsageTable(id, file string) (*UsageTable, error) {
+	usageTablesMu.Lock()
+	defer usageTablesMu.Unlock()
+	if t, ok := usageTables[id]; ok {
+		return t, nil
+	}
+	t := &UsageTable{counts: make(map[string]*usage), file: file}
+	if file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &t.counts); err != nil {
+				return nil, err
+			}
+		}
+	}
+	usageTables[id] = t
+	return t, nil
+}
+
+// use counts a request made at now with k, if the quotas of k
+// allow it; otherwise it returns how long until they do.
+func (t *UsageTable) use(k *Key, now time.Time) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ok := t.counts[k.Name]
+	if !ok {
+		u = new(usage)
+		t.counts[k.Name] = u
+	}
+	u.roll(now)
+	if k.Monthly > 0 && u.ThisMonth >= k.Monthly {
+		next := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+		return next.Sub(now), false
+	}
+	if k.Daily > 0 && u.Today >= k.Daily {
+		next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+		return next.Sub(now), false
+	}
+	u.Today++
+	u.ThisMonth++
+	t.dirty = true
+	return 0, true
+}
+
+// get returns how many requests were made with the
+// key named name on the day and in the month of now.
+func (t *UsageTable) get(name string, now time.Time) (today, thisMonth int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ok := t.counts[name]
+	if !ok {
+		return 0, 0
+	}
+	u.roll(now)
+	return u.Today, u.ThisMonth
+}
+
+// reset forgets the requests made with the key named name.
+func (t *UsageTable) reset(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.counts, name)
+	t.dirty = true
+}
+
+// save writes the counts to the file of t, if they changed.
+func (t *UsageTable) save() error {
+	t.mu.Lock()
+	if t.file == "" || !t.dirty {
+		t.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(t.counts)
+	t.dirty = false
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// written aside first, so the file is never partly written
+	tmp := t.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.file)
+}
+
+// run saves the counts every interval, until stop is closed.
+func (t *UsageTable) run(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := t.save(); err != nil {
+				log.Printf("[ERROR] api_keys: saving usage: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// DefaultSaveInterval is how often usage is saved.
+const DefaultSaveInterval = 1 * time.Minute
@@ -0,0 +1,62 @@
+// Package assets provides middleware that serves files at URLs
+// with the hash of their contents in them, so that they can be
+// cached by clients forever and still be updated.
+package assets
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Assets is middleware that serves the file at /app.js for
+// requests for /app.3f9ab2c1.js under Paths, whose hash is
+// that of its contents, with headers that let clients cache
+// it forever. The URLs are made by the Asset template action.
+type Assets struct {
+	Next  httpserver.Handler
+	Root  http.FileSystem
+	Paths []string
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (a Assets) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, p := range a.Paths {
+		if httpserver.Path(r.URL.Path).Matches(p) {
+			return a.serveAsset(w, r)
+		}
+	}
+	return a.Next.ServeHTTP(w, r)
+}
+
+func (a Assets) serveAsset(w http.ResponseWriter, r *http.Request) (int, error) {
+	name, hash, ok := httpserver.SplitHashedAssetPath(r.URL.Path)
+	if !ok {
+		return a.Next.ServeHTTP(w, r)
+	}
+	current, err := httpserver.AssetHash(a.Root, name)
+	if err != nil {
+		// a file may just have a name that looks hashed
+		return a.Next.ServeHTTP(w, r)
+	}
+	if current == hash {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		// a file may just have a name that looks hashed
+		if f, err := a.Root.Open(r.URL.Path); err == nil {
+			f.Close()
+			return a.Next.ServeHTTP(w, r)
+		}
+		// pages that link to the file as it was get
+		// the file as it is, but must not keep it
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = name
+	return a.Next.ServeHTTP(w, r2)
+}
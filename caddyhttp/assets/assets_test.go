@@ -0,0 +1,72 @@
+package assets
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+func TestAssets(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	os.Mkdir(filepath.Join(root, "assets"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "assets", "app.js"), []byte("console.log(1)"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "assets", "font.deadbeef.woff"), []byte("font"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "app.js"), []byte("outside"), 0644)
+
+	a := Assets{
+		Next:  staticfiles.FileServer{Root: http.Dir(root)},
+		Root:  http.Dir(root),
+		Paths: []string{"/assets"},
+	}
+	ctx := httpserver.Context{Root: http.Dir(root)}
+	hashed, err := ctx.Asset("assets/app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, hash, ok := httpserver.SplitHashedAssetPath(hashed)
+	if !ok || name != "/assets/app.js" || len(hash) != httpserver.AssetHashLength {
+		t.Fatalf("Expected hashed path of /assets/app.js, got %s", hashed)
+	}
+
+	for i, test := range []struct {
+		path          string
+		expectStatus  int
+		expectBody    string
+		expectCaching string
+	}{
+		{hashed, http.StatusOK, "console.log(1)", "public, max-age=31536000, immutable"},
+		{"/assets/app.00000000.js", http.StatusOK, "console.log(1)", "no-cache"},
+		{"/assets/app.js", http.StatusOK, "console.log(1)", ""},
+		{"/assets/font.deadbeef.woff", http.StatusOK, "font", ""},
+		{"/assets/missing.0123abcd.js", http.StatusNotFound, "", ""},
+		{"/app." + hash + ".js", http.StatusNotFound, "", ""},
+	} {
+		w := httptest.NewRecorder()
+		status, _ := a.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if status != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if test.expectBody != "" && w.Body.String() != test.expectBody {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.expectBody, w.Body.String())
+		}
+		if got := w.Header().Get("Cache-Control"); got != test.expectCaching {
+			t.Errorf("Test %d: Expected Cache-Control '%s', got '%s'", i, test.expectCaching, got)
+		}
+	}
+
+	// the hash changes with the contents
+	ioutil.WriteFile(filepath.Join(root, "assets", "app.js"), []byte("console.log(22)"), 0644)
+	if changed, _ := ctx.Asset("/assets/app.js"); changed == hashed {
+		t.Errorf("Expected hashed path to change with the file, got %s again", changed)
+	}
+}
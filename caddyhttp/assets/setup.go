@@ -0,0 +1,66 @@
+package assets
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("assets", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
+	})
+}
+
+// setup configures a new Assets middleware instance. Syntax:
+//
+//	assets [paths...]
+//
+// Hashed URLs of files under the paths (/assets by default)
+// are served with far-future, immutable caching. Templates
+// make the URLs with {{.Asset "/assets/app.js"}}.
+func setup(c *caddy.Controller) error {
+	if err := httpserver.CheckStaticRoot(c); err != nil {
+		return err
+	}
+	paths, err := assetsParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Assets{Next: next, Root: cfg.FileSystem(), Paths: paths}
+	})
+	return nil
+}
+
+func assetsParse(c *caddy.Controller) ([]string, error) {
+	var paths []string
+	var seen bool
+	for c.Next() {
+		if seen {
+			return nil, c.Err("assets: can only be specified once per site")
+		}
+		seen = true
+
+		paths = c.RemainingArgs()
+		for _, p := range paths {
+			if !strings.HasPrefix(p, "/") {
+				return nil, c.Errf("assets: invalid path '%s'", p)
+			}
+		}
+		if c.NextBlock() {
+			return nil, c.ArgErr()
+		}
+	}
+	if len(paths) == 0 {
+		paths = []string{defaultPath}
+	}
+	return paths, nil
+}
+
+const defaultPath = "/assets"
@@ -0,0 +1,52 @@
+package assets
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `assets /static /js`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler, ok := mids[0](httpserver.EmptyNext).(Assets)
+	if !ok {
+		t.Fatalf("Expected handler to be type Assets, got: %#v", mids[0](httpserver.EmptyNext))
+	}
+	if !httpserver.SameNext(handler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if !reflect.DeepEqual(handler.Paths, []string{"/static", "/js"}) {
+		t.Errorf("Expected paths [/static /js], got %v", handler.Paths)
+	}
+}
+
+func TestAssetsParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		paths     []string
+	}{
+		{`assets`, false, []string{"/assets"}},
+		{`assets /static`, false, []string{"/static"}},
+		{`assets static`, true, nil},
+		{"assets {\n foo\n}", true, nil},
+		{"assets\nassets", true, nil},
+	} {
+		paths, err := assetsParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: Expected error %v, got: %v", i, test.shouldErr, err)
+		}
+		if !test.shouldErr && !reflect.DeepEqual(paths, test.paths) {
+			t.Errorf("Test %d: Expected paths %v, got %v", i, test.paths, paths)
+		}
+	}
+}
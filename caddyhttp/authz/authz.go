@@ -0,0 +1,184 @@
+// Package authz provides middleware that authorizes requests with
+// ordered allow and deny rules over request attributes and the
+// identity placeholders set by authentication middleware, or by
+// asking an external policy service.
+package authz
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Authz is middleware that allows or denies requests by policy.
+type Authz struct {
+	Next     httpserver.Handler
+	Policies []*Policy
+}
+
+// Action is what a rule decides.
+type Action int
+
+// Actions of rules.
+const (
+	Deny Action = iota
+	Allow
+	Query // ask the policy service
+)
+
+// Policy decides about requests for its paths.
+type Policy struct {
+	// Base paths the policy applies to
+	Paths []string
+
+	// Rules in order; the first that matches decides
+	Rules []Rule
+
+	// What is decided if no rule matches
+	Default Action
+
+	// Placeholder whose value lists the roles of the
+	// user, separated by commas, such as {oidc.groups}
+	Roles string
+
+	// Policy service to query, if any
+	Service *Service
+}
+
+// Rule decides about requests that meet all its conditions.
+type Rule struct {
+	Action     Action
+	Conditions []Condition
+}
+
+// Condition is a test of an attribute of a request.
+type Condition struct {
+	// path, method, role, or a placeholder
+	Key string
+
+	// Whether the attribute must not match
+	Negate bool
+
+	// Values the attribute may have, or an expression
+	// it must match
+	Values []string
+	Regexp *regexp.Regexp
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (a Authz) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	policy := a.match(r.URL.Path)
+	if policy == nil {
+		return a.Next.ServeHTTP(w, r)
+	}
+	allowed, err := policy.allows(r)
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+	if !allowed {
+		return http.StatusForbidden, nil
+	}
+	return a.Next.ServeHTTP(w, r)
+}
+
+// match returns the policy with the longest base path
+// that urlPath is in, or nil if there is none.
+func (a Authz) match(urlPath string) *Policy {
+	var policy *Policy
+	var longest int
+	for _, p := range a.Policies {
+		for _, base := range p.Paths {
+			if httpserver.Path(urlPath).Matches(base) && (policy == nil || len(base) > longest) {
+				policy, longest = p, len(base)
+			}
+		}
+	}
+	return policy
+}
+
+// allows returns whether policy allows r.
+func (p *Policy) allows(r *http.Request) (bool, error) {
+	repl := httpserver.NewReplacer(r, nil, "")
+	var roles []string
+	if p.Roles != "" {
+		roles = splitList(repl.Replace(p.Roles))
+	}
+
+	action := p.Default
+	for _, rule := range p.Rules {
+		if rule.matches(r, repl, roles) {
+			action = rule.Action
+			break
+		}
+	}
+	switch action {
+	case Allow:
+		return true, nil
+	case Query:
+		return p.Service.allows(r, repl, roles)
+	}
+	return false, nil
+}
+
+// matches returns whether r meets all conditions of rule.
+func (rule Rule) matches(r *http.Request, repl httpserver.Replacer, roles []string) bool {
+	for _, cond := range rule.Conditions {
+		var values []string
+		switch cond.Key {
+		case "path":
+			values = []string{r.URL.Path}
+		case "method":
+			values = []string{r.Method}
+		case "role":
+			values = roles
+		default:
+			values = []string{repl.Replace(cond.Key)}
+		}
+		if cond.matches(values) == cond.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+// matches returns whether any of values satisfies cond.
+func (cond Condition) matches(values []string) bool {
+	for _, v := range values {
+		if cond.Regexp != nil {
+			if cond.Regexp.MatchString(v) {
+				return true
+			}
+			continue
+		}
+		for _, want := range cond.Values {
+			switch cond.Key {
+			case "path":
+				if httpserver.Path(v).Matches(want) {
+					return true
+				}
+			case "method":
+				if strings.EqualFold(v, want) {
+					return true
+				}
+			default:
+				if v == want {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,130 @@
+package authz
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestAuthz(t *testing.T) {
+	a := Authz{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+		Policies: []*Policy{
+			{
+				Paths: []string{"/"},
+				Rules: []Rule{
+					{Action: Deny, Conditions: []Condition{{Key: "path", Values: []string{"/admin"}}, {Key: "role", Negate: true, Values: []string{"admins"}}}},
+					{Action: Allow, Conditions: []Condition{{Key: "method", Values: []string{"GET", "HEAD"}}}},
+					{Action: Allow, Conditions: []Condition{{Key: "{user}", Negate: true, Values: []string{""}}}},
+				},
+				Default: Deny,
+				Roles:   "{>X-Roles}",
+			},
+			{
+				Paths: []string{"/api"},
+				Rules: []Rule{
+					{Action: Allow, Conditions: []Condition{{Key: "{>X-Client}", Regexp: regexp.MustCompile(`^svc-[a-z]+$`)}}},
+				},
+				Default: Deny,
+			},
+		},
+	}
+
+	for i, test := range []struct {
+		method, path, user, roles, client string
+		expected                          int
+	}{
+		{"GET", "/docs", "", "", "", http.StatusOK},
+		{"POST", "/docs", "", "", "", http.StatusForbidden},
+		{"POST", "/docs", "alice", "", "", http.StatusOK},
+		{"GET", "/admin/users", "alice", "staff", "", http.StatusForbidden},
+		{"GET", "/admin/users", "alice", "staff, admins", "", http.StatusOK},
+		{"GET", "/api/items", "", "", "svc-billing", http.StatusOK},
+		{"GET", "/api/items", "", "", "svc-billing-2", http.StatusForbidden},
+		{"GET", "/api/items", "", "", "", http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		if test.user != "" {
+			r = httpserver.SetRequestPlaceholder(r, "user", test.user)
+		}
+		r.Header.Set("X-Roles", test.roles)
+		r.Header.Set("X-Client", test.client)
+		status, err := a.ServeHTTP(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status != test.expected {
+			t.Errorf("Test %d: Expected status %d for %s %s, got %d", i, test.expected, test.method, test.path, status)
+		}
+	}
+}
+
+func TestService(t *testing.T) {
+	var received map[string]serviceRequest
+	var answer string
+	var status int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+		w.Write([]byte(answer))
+	}))
+	defer ts.Close()
+
+	service := NewService(ts.URL, time.Second)
+	service.Inputs = []Input{{Name: "user", Placeholder: "{user}"}}
+	a := Authz{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+		Policies: []*Policy{{
+			Paths:   []string{"/"},
+			Rules:   []Rule{{Action: Allow, Conditions: []Condition{{Key: "path", Values: []string{"/public"}}}}},
+			Default: Query,
+			Roles:   "{>X-Roles}",
+			Service: service,
+		}},
+	}
+
+	for i, test := range []struct {
+		path     string
+		status   int
+		answer   string
+		expected int
+		err      bool
+	}{
+		{"/public/index.html", http.StatusInternalServerError, "", http.StatusOK, false},
+		{"/reports", http.StatusOK, `{"allow": true}`, http.StatusOK, false},
+		{"/reports", http.StatusOK, `{"allow": false}`, http.StatusForbidden, false},
+		{"/reports", http.StatusOK, `{"result": true}`, http.StatusOK, false},
+		{"/reports", http.StatusOK, `{"result": {"allow": true}}`, http.StatusOK, false},
+		{"/reports", http.StatusOK, `{}`, http.StatusForbidden, false},
+		{"/reports", http.StatusOK, `not json`, http.StatusBadGateway, true},
+		{"/reports", http.StatusInternalServerError, "", http.StatusBadGateway, true},
+	} {
+		status, answer, received = test.status, test.answer, nil
+		r := httptest.NewRequest("POST", test.path, nil)
+		r = httpserver.SetRequestPlaceholder(r, "user", "alice")
+		r.Header.Set("X-Roles", "staff,dev")
+		actual, err := a.ServeHTTP(httptest.NewRecorder(), r)
+		if (err != nil) != test.err {
+			t.Errorf("Test %d: Expected error %v, got %v", i, test.err, err)
+		}
+		if actual != test.expected {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expected, actual)
+		}
+	}
+
+	// the service is told about the request
+	in := received["input"]
+	if in.Method != "POST" || in.Path != "/reports" || in.Host != "example.com" || in.Remote != "192.0.2.1" ||
+		len(in.Roles) != 2 || in.Roles[1] != "dev" || in.Attributes["user"] != "alice" {
+		t.Errorf("Unexpected input %+v", in)
+	}
+}
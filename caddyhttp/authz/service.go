@@ -0,0 +1,121 @@
+package authz
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Service is an external policy service, which is sent
+// the attributes of a request as JSON, and answers with
+// whether to allow it.
+type Service struct {
+	URL     string
+	Timeout time.Duration
+
+	// Placeholders whose values are sent as
+	// attributes, by name
+	Inputs []Input
+
+	client *http.Client
+}
+
+// Input names a placeholder that is sent to the policy service.
+type Input struct {
+	Name        string
+	Placeholder string
+}
+
+// NewService returns a service at url.
+func NewService(url string, timeout time.Duration) *Service {
+	return &Service{
+		URL:     url,
+		Timeout: timeout,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// serviceRequest is what is sent to the policy service.
+type serviceRequest struct {
+	Method     string            `json:"method"`
+	Host       string            `json:"host"`
+	Path       string            `json:"path"`
+	Remote     string            `json:"remote"`
+	Roles      []string          `json:"roles"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// serviceResponse is the answer of the policy service. Besides
+// {"allow": bool}, the {"result": ...} wrapping of Open Policy
+// Agent is understood.
+type serviceResponse struct {
+	Allow  *bool           `json:"allow"`
+	Result json.RawMessage `json:"result"`
+}
+
+// allows asks the service whether to allow r.
+func (s *Service) allows(r *http.Request, repl httpserver.Replacer, roles []string) (bool, error) {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	req := serviceRequest{
+		Method: r.Method,
+		Host:   r.Host,
+		Path:   r.URL.Path,
+		Remote: remote,
+		Roles:  roles,
+	}
+	if req.Roles == nil {
+		req.Roles = []string{}
+	}
+	if len(s.Inputs) > 0 {
+		req.Attributes = make(map[string]string, len(s.Inputs))
+		for _, in := range s.Inputs {
+			req.Attributes[in.Name] = repl.Replace(in.Placeholder)
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{"input": req})
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := s.client.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("authz: querying policy service: %v", err)
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("authz: policy service returned status %d", resp.StatusCode)
+	}
+
+	var answer serviceResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&answer); err != nil {
+		return false, fmt.Errorf("authz: decoding policy service response: %v", err)
+	}
+	if answer.Allow != nil {
+		return *answer.Allow, nil
+	}
+	var result bool
+	if err := json.Unmarshal(answer.Result, &result); err == nil {
+		return result, nil
+	}
+	var nested serviceResponse
+	if err := json.Unmarshal(answer.Result, &nested); err == nil && nested.Allow != nil {
+		return *nested.Allow, nil
+	}
+	// a policy that does not decide denies
+	return false, nil
+}
+
+const maxResponseSize = 1 << 20
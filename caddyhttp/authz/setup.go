@@ -0,0 +1,175 @@
+package authz
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("authz", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
+	})
+}
+
+// setup configures a new Authz middleware instance.
+func setup(c *caddy.Controller) error {
+	policies, err := authzParse(c)
+	if err != nil {
+		return err
+	}
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Authz{Next: next, Policies: policies}
+	})
+	return nil
+}
+
+// authzParse parses authz directives, which have the form
+//
+//	authz [paths...] {
+//	    allow|deny|query [conditions...]
+//	    default          allow|deny|query
+//	    roles            placeholder
+//	    service          url
+//	    timeout          duration
+//	    input            name placeholder
+//	}
+//
+// Conditions are key=values, key!=values or key~=regexp, where
+// key is path, method, role or a placeholder, and values are
+// separated by commas. A rule applies if all its conditions are
+// met, and the first rule that applies decides; query rules ask
+// the policy service. Requests no rule applies to are denied by
+// default. Without paths, the policy is for the whole site.
+func authzParse(c *caddy.Controller) ([]*Policy, error) {
+	var policies []*Policy
+	for c.Next() {
+		policy := &Policy{Paths: c.RemainingArgs(), Default: Deny}
+		if len(policy.Paths) == 0 {
+			policy.Paths = []string{"/"}
+		}
+		var serviceURL string
+		var inputs []Input
+		timeout := defaultTimeout
+		var queries bool
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "allow", "deny", "query":
+				rule := Rule{Action: actions[what]}
+				for _, arg := range args {
+					cond, err := parseCondition(arg)
+					if err != nil {
+						return nil, c.Errf("authz: invalid condition '%s': %v", arg, err)
+					}
+					rule.Conditions = append(rule.Conditions, cond)
+				}
+				policy.Rules = append(policy.Rules, rule)
+				queries = queries || rule.Action == Query
+				continue
+			case "input":
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				inputs = append(inputs, Input{Name: args[0], Placeholder: args[1]})
+				continue
+			}
+
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			value := args[0]
+			switch what {
+			case "default":
+				action, ok := actions[value]
+				if !ok {
+					return nil, c.Errf("authz: invalid default '%s'", value)
+				}
+				policy.Default = action
+				queries = queries || action == Query
+			case "roles":
+				policy.Roles = value
+			case "service":
+				u, err := url.Parse(value)
+				if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+					return nil, c.Errf("authz: invalid service '%s'", value)
+				}
+				serviceURL = value
+			case "timeout":
+				dur, err := time.ParseDuration(value)
+				if err != nil || dur <= 0 {
+					return nil, c.Errf("authz: invalid timeout '%s'", value)
+				}
+				timeout = dur
+			default:
+				return nil, c.Errf("authz: unknown property '%s'", what)
+			}
+		}
+
+		if queries && serviceURL == "" {
+			return nil, c.Err("authz: query needs a service")
+		}
+		if serviceURL != "" {
+			policy.Service = NewService(serviceURL, timeout)
+			policy.Service.Inputs = inputs
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// parseCondition parses a condition of the form
+// key=values, key!=values or key~=regexp.
+func parseCondition(s string) (Condition, error) {
+	var cond Condition
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return cond, errMissingOperator
+	}
+	cond.Key = s[:i]
+	value := s[i+1:]
+	switch cond.Key[len(cond.Key)-1] {
+	case '!':
+		cond.Key, cond.Negate = cond.Key[:len(cond.Key)-1], true
+	case '~':
+		cond.Key = cond.Key[:len(cond.Key)-1]
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return cond, err
+		}
+		cond.Regexp = re
+	}
+	switch cond.Key {
+	case "path", "method", "role":
+	default:
+		if !strings.HasPrefix(cond.Key, "{") || !strings.HasSuffix(cond.Key, "}") {
+			return cond, errUnknownKey
+		}
+	}
+	if cond.Regexp == nil {
+		cond.Values = strings.Split(value, ",")
+	}
+	return cond, nil
+}
+
+var actions = map[string]Action{
+	"allow": Allow,
+	"deny":  Deny,
+	"query": Query,
+}
+
+var (
+	errMissingOperator = errors.New("expected key=values, key!=values or key~=regexp")
+	errUnknownKey      = errors.New("key must be path, method, role or a placeholder")
+)
+
+const defaultTimeout = 2 * time.Second
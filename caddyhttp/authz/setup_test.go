@@ -0,0 +1,95 @@
+package authz
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `authz {
+		allow method=GET
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Authz)
+	if !ok {
+		t.Fatalf("Expected handler to be type Authz, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestAuthzParse(t *testing.T) {
+	policies, err := authzParse(caddy.NewTestController("http", `authz /admin /reports {
+		deny    method=DELETE role!=admins
+		allow   {user}!= path~=^/reports/[0-9]+$
+		query   {tls_client_subject}=CN=svc
+		default query
+		roles   {oidc.groups}
+		service http://localhost:8181/v1/data/http/allow
+		timeout 1s
+		input   email {oidc.email}
+	}
+	authz`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(policies) != 2 {
+		t.Fatalf("Expected 2 policies, got %d", len(policies))
+	}
+	p := policies[0]
+	if p.Service == nil || p.Service.URL != "http://localhost:8181/v1/data/http/allow" || p.Service.Timeout != time.Second ||
+		!reflect.DeepEqual(p.Service.Inputs, []Input{{Name: "email", Placeholder: "{oidc.email}"}}) {
+		t.Errorf("Expected service to be set up, got %+v", p.Service)
+	}
+	if len(p.Rules) != 3 || p.Rules[1].Conditions[1].Regexp == nil {
+		t.Fatalf("Expected 3 rules, got %+v", p.Rules)
+	}
+	p.Rules[1].Conditions[1].Regexp = nil
+	p.Service = nil
+	expected := &Policy{
+		Paths: []string{"/admin", "/reports"},
+		Rules: []Rule{
+			{Action: Deny, Conditions: []Condition{{Key: "method", Values: []string{"DELETE"}}, {Key: "role", Negate: true, Values: []string{"admins"}}}},
+			{Action: Allow, Conditions: []Condition{{Key: "{user}", Negate: true, Values: []string{""}}, {Key: "path"}}},
+			{Action: Query, Conditions: []Condition{{Key: "{tls_client_subject}", Values: []string{"CN=svc"}}}},
+		},
+		Default: Query,
+		Roles:   "{oidc.groups}",
+	}
+	if !reflect.DeepEqual(p, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, p)
+	}
+	if !reflect.DeepEqual(policies[1], &Policy{Paths: []string{"/"}, Default: Deny}) {
+		t.Errorf("Expected policy that denies everything, got %+v", policies[1])
+	}
+
+	for i, input := range []string{
+		"authz {\n allow method \n}",
+		"authz {\n allow user=alice \n}",
+		"authz {\n allow path~=( \n}",
+		"authz {\n query method=GET \n}",
+		"authz {\n default query \n}",
+		"authz {\n default maybe \n}",
+		"authz {\n service localhost:8181 \n}",
+		"authz {\n timeout soon \n}",
+		"authz {\n input email \n}",
+		"authz {\n permit method=GET \n}",
+	} {
+		if _, err := authzParse(caddy.NewTestController("http", input)); err == nil {
+			t.Errorf("Test %d: Expected error for %q but got none", i, input)
+		}
+	}
+}
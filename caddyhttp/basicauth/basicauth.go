@@ -36,10 +36,11 @@ type BasicAuth struct {
 func (a BasicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	var hasAuth bool
 	var isAuthenticated bool
+	var user string
 
 	for _, rule := range a.Rules {
 		for _, res := range rule.Resources {
-			if !httpserver.Path(r.URL.Path).Matches(res) {
+			if !rule.matches(r, res) {
 				continue
 			}
 
@@ -48,14 +49,24 @@ func (a BasicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 			hasAuth = true
 
 			// Check credentials
-			if !ok ||
-				username != rule.Username ||
-				!rule.Password(password) {
+			if !ok {
+				continue
+			}
+			if rule.Backend != nil {
+				authenticated, err := rule.Backend.Authenticate(username, password)
+				if err != nil {
+					return http.StatusBadGateway, err
+				}
+				if !authenticated {
+					continue
+				}
+			} else if username != rule.Username || !rule.Password(password) {
 				continue
 			}
 
 			// Flag set only on successful authentication
 			isAuthenticated = true
+			user = username
 		}
 	}
 
@@ -64,6 +75,7 @@ func (a BasicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 			w.Header().Set("WWW-Authenticate", "Basic realm=\"Restricted\"")
 			return http.StatusUnauthorized, nil
 		}
+		r = httpserver.SetRequestPlaceholder(r, "user", user)
 		// "It's an older code, sir, but it checks out. I was about to clear them."
 		return a.Next.ServeHTTP(w, r)
 	}
@@ -73,12 +85,25 @@ func (a BasicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 }
 
 // Rule represents a BasicAuth rule. A username and password
-// combination protect the associated resources, which are
-// file or directory paths.
+// combination, or the users of a backend, protect the associated
+// resources, which are file or directory paths, or the @names of
+// named matchers.
 type Rule struct {
 	Username  string
 	Password  func(string) bool
+	Backend   Backend
 	Resources []string
+
+	// The named matchers of the resources that are @names
+	Matchers map[string]httpserver.RequestMatcher
+}
+
+// matches returns whether r is for the resource res of rule.
+func (rule Rule) matches(r *http.Request, res string) bool {
+	if m, ok := rule.Matchers[res]; ok {
+		return m.Match(r)
+	}
+	return httpserver.Path(r.URL.Path).Matches(res)
 }
 
 // PasswordMatcher determines whether a password matches a rule.
@@ -144,3 +144,19 @@ md5:$apr1$l42y8rex$pOA2VJ0x/0TwaFeAF9nX61`
 		}
 	}
 }
+
+func TestUserPlaceholder(t *testing.T) {
+	var user string
+	rw := BasicAuth{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			user = httpserver.NewReplacer(r, nil, "").Replace("{user}")
+			return http.StatusOK, nil
+		}),
+		Rules: []Rule{{Username: "test", Password: PlainMatcher("ttest"), Resources: []string{"/testing"}}},
+	}
+	req := httptest.NewRequest("GET", "/testing", nil)
+	req.SetBasicAuth("test", "ttest")
+	if result, _ := rw.ServeHTTP(httptest.NewRecorder(), req); result != http.StatusOK || user != "test" {
+		t.Errorf("Expected {user} to be the authenticated user, got %d and '%s'", result, user)
+	}
+}
@@ -0,0 +1,340 @@
+package basicauth
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The subset of BER (Basic Encoding Rules) that LDAP messages
+// use: definite lengths and single-byte tags.
+
+const (
+	berBoolean     = 0x01
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berEnumerated  = 0x0a
+	berSequence    = 0x30
+	berSet         = 0x31
+)
+
+// berElement is a decoded BER element.
+type berElement struct {
+	tag     byte
+	content []byte
+}
+
+// berEncode returns an element with tag whose content
+// is the concatenation of contents.
+func berEncode(tag byte, contents ...[]byte) []byte {
+	var n int
+	for _, c := range contents {
+		n += len(c)
+	}
+	b := append([]byte{tag}, berLength(n)...)
+	for _, c := range contents {
+		b = append(b, c...)
+	}
+	return b
+}
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// berInt returns a non-negative integer element.
+func berInt(tag byte, v int) []byte {
+	b := []byte{byte(v)}
+	for v >>= 8; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return berEncode(tag, b)
+}
+
+func berString(tag byte, s string) []byte {
+	return berEncode(tag, []byte(s))
+}
+
+func berBool(v bool) []byte {
+	if v {
+		return berEncode(berBoolean, []byte{0xff})
+	}
+	return berEncode(berBoolean, []byte{0})
+}
+
+// maxBERLength is the largest element that is read,
+// so that a server cannot make us allocate any size.
+const maxBERLength = 1 << 24
+
+// berRead reads one element from r.
+func berRead(r *bufio.Reader) (berElement, error) {
+	var e berElement
+	tag, err := r.ReadByte()
+	if err != nil {
+		return e, err
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return e, err
+	}
+	n := int(first)
+	if first&0x80 != 0 {
+		size := int(first &^ 0x80)
+		if size == 0 || size > 4 {
+			return e, errors.New("unsupported BER length")
+		}
+		n = 0
+		for i := 0; i < size; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return e, err
+			}
+			n = n<<8 | int(b)
+		}
+	}
+	if n > maxBERLength {
+		return e, fmt.Errorf("BER element of %d bytes is too large", n)
+	}
+	e.tag, e.content = tag, make([]byte, n)
+	_, err = io.ReadFull(r, e.content)
+	return e, err
+}
+
+// berChildren decodes the elements in the content of a
+// constructed element.
+func berChildren(b []byte) ([]berElement, error) {
+	var children []berElement
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, errors.New("truncated BER element")
+		}
+		tag, n, i := b[0], int(b[1]), 2
+		if b[1]&0x80 != 0 {
+			size := int(b[1] &^ 0x80)
+			if size == 0 || size > 4 || len(b) < 2+size {
+				return nil, errors.New("invalid BER length")
+			}
+			n = 0
+			for _, c := range b[2 : 2+size] {
+				n = n<<8 | int(c)
+			}
+			i += size
+		}
+		if n < 0 || len(b)-i < n {
+			return nil, errors.New("truncated BER element")
+		}
+		children = append(children, berElement{tag: tag, content: b[i : i+n]})
+		b = b[i+n:]
+	}
+	return children, nil
+}
+
+// berParseInt decodes the content of an integer element.
+func berParseInt(b []byte) int {
+	var v int
+	for i, c := range b {
+		if i == 0 && c&0x80 != 0 {
+			v = -1
+		}
+		v = v<<8 | int(c)
+	}
+	return v
+}
+
+// ldapFilter encodes a search filter in its string
+// representation (RFC 4515).
+func ldapFilter(s string) ([]byte, error) {
+	p := &filterParser{s: s}
+	f, err := p.filter()
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %v", s, err)
+	}
+	if p.i != len(s) {
+		return nil, fmt.Errorf("invalid filter %q: unexpected %q", s, s[p.i:])
+	}
+	return f, nil
+}
+
+type filterParser struct {
+	s string
+	i int
+}
+
+func (p *filterParser) filter() ([]byte, error) {
+	if p.i >= len(p.s) || p.s[p.i] != '(' {
+		return nil, errors.New("expected (")
+	}
+	p.i++
+	if p.i >= len(p.s) {
+		return nil, errors.New("unexpected end")
+	}
+	var f []byte
+	var err error
+	switch p.s[p.i] {
+	case '&', '|':
+		tag := byte(0xa0)
+		if p.s[p.i] == '|' {
+			tag = 0xa1
+		}
+		p.i++
+		var list [][]byte
+		for p.i < len(p.s) && p.s[p.i] == '(' {
+			item, err := p.filter()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		f = berEncode(tag, list...)
+	case '!':
+		p.i++
+		var item []byte
+		if item, err = p.filter(); err != nil {
+			return nil, err
+		}
+		f = berEncode(0xa2, item)
+	default:
+		end := strings.IndexByte(p.s[p.i:], ')')
+		if end < 0 {
+			return nil, errors.New("expected )")
+		}
+		if f, err = filterItem(p.s[p.i : p.i+end]); err != nil {
+			return nil, err
+		}
+		p.i += end
+	}
+	if p.i >= len(p.s) || p.s[p.i] != ')' {
+		return nil, errors.New("expected )")
+	}
+	p.i++
+	return f, nil
+}
+
+// filterItem encodes a simple filter item such as cn=value.
+func filterItem(item string) ([]byte, error) {
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, errors.New("expected attribute=value")
+	}
+	attr, value := item[:eq], item[eq+1:]
+	tag := byte(0xa3) // equalityMatch
+	switch attr[len(attr)-1] {
+	case '>':
+		tag, attr = 0xa5, attr[:len(attr)-1]
+	case '<':
+		tag, attr = 0xa6, attr[:len(attr)-1]
+	case '~':
+		tag, attr = 0xa8, attr[:len(attr)-1]
+	}
+	if attr == "" {
+		return nil, errors.New("expected attribute")
+	}
+
+	if tag == 0xa3 && value == "*" {
+		return berString(0x87, attr), nil // present
+	}
+	// wildcards are split on before unescaping,
+	// so that escaped asterisks are literal
+	parts := strings.Split(value, "*")
+	if tag != 0xa3 && len(parts) > 1 {
+		return nil, errors.New("unexpected *")
+	}
+	values := make([][]byte, len(parts))
+	for i, part := range parts {
+		v, err := unescapeFilterValue(part)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	if len(parts) == 1 {
+		return berEncode(tag, berString(berOctetString, attr), berEncode(berOctetString, values[0])), nil
+	}
+
+	// substrings: [0] initial, [1] any, [2] final
+	var substrings [][]byte
+	for i, v := range values {
+		if len(v) == 0 {
+			continue
+		}
+		switch i {
+		case 0:
+			substrings = append(substrings, berEncode(0x80, v))
+		case len(values) - 1:
+			substrings = append(substrings, berEncode(0x82, v))
+		default:
+			substrings = append(substrings, berEncode(0x81, v))
+		}
+	}
+	return berEncode(0xa4, berString(berOctetString, attr), berEncode(berSequence, substrings...)), nil
+}
+
+func unescapeFilterValue(s string) ([]byte, error) {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+3 > len(s) {
+				return nil, errors.New("truncated escape")
+			}
+			c, err := hex.DecodeString(s[i+1 : i+3])
+			if err != nil {
+				return nil, errors.New("invalid escape")
+			}
+			b = append(b, c...)
+			i += 2
+		case '(', ')':
+			return nil, fmt.Errorf("unescaped %c", s[i])
+		default:
+			b = append(b, s[i])
+		}
+	}
+	return b, nil
+}
+
+// escapeFilterValue escapes s for use as a value in a filter.
+func escapeFilterValue(s string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '*', '(', ')', '\\', 0:
+			b = append(b, fmt.Sprintf("\\%02x", c)...)
+		default:
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
+
+// escapeDNValue escapes s for use as an attribute
+// value in a distinguished name (RFC 4514).
+func escapeDNValue(s string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == 0:
+			b = append(b, `\00`...)
+		case strings.IndexByte(`,+"\<>;=`, c) >= 0,
+			i == 0 && (c == ' ' || c == '#'),
+			i == len(s)-1 && c == ' ':
+			b = append(b, '\\', c)
+		default:
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
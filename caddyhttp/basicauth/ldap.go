@@ -0,0 +1,509 @@
+package basicauth
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backend authenticates users against an
+// external store of credentials.
+type Backend interface {
+	// Authenticate returns whether password is the password
+	// of username. An error means the backend could not tell.
+	Authenticate(username, password string) (bool, error)
+}
+
+// LDAP is a Backend that authenticates users with an LDAP
+// directory, such as Active Directory, by binding as them.
+//
+// If UserDN is set, users bind directly as the DN it makes;
+// otherwise their entry is first searched for with Filter,
+// after binding as BindDN, if set. In the templates UserDN
+// and Filter, {username} is replaced with the username.
+type LDAP struct {
+	// URL of the directory, with the scheme
+	// ldap or, for TLS, ldaps
+	URL string
+
+	// Whether to upgrade ldap connections to TLS
+	StartTLS bool
+
+	// TLS configuration for ldaps and StartTLS; its
+	// ServerName must be set
+	TLSConfig *tls.Config
+
+	// Template of the DN users bind as, such as
+	// uid={username},ou=people,dc=example,dc=com, or
+	// {username}@example.com for Active Directory
+	UserDN string
+
+	// DN and password to bind as to search for users
+	BindDN       string
+	BindPassword string
+
+	// Where and how to search for the entry of users, such
+	// as (&(objectClass=person)(sAMAccountName={username}));
+	// with UserDN, the search is done as the user
+	BaseDN string
+	Filter string
+
+	// DNs of groups users must be in one of, and the
+	// attribute of their entry that lists their groups
+	Groups         []string
+	GroupAttribute string
+
+	// How long successful logins are remembered,
+	// and how long the directory has to answer
+	CacheTTL time.Duration
+	Timeout  time.Duration
+
+	cache *authCache
+}
+
+// NewLDAP returns an LDAP backend without configuration.
+func NewLDAP() *LDAP {
+	return &LDAP{
+		GroupAttribute: "memberOf",
+		CacheTTL:       time.Minute,
+		Timeout:        5 * time.Second,
+		cache:          newAuthCache(),
+	}
+}
+
+// Authenticate implements Backend.
+func (l *LDAP) Authenticate(username, password string) (bool, error) {
+	// servers take a bind with an empty password
+	// as unauthenticated, and let it succeed
+	if username == "" || password == "" {
+		return false, nil
+	}
+	if l.cache.valid(username, password) {
+		return true, nil
+	}
+	ok, err := l.authenticate(username, password)
+	if err != nil {
+		return false, fmt.Errorf("ldap: %v", err)
+	}
+	if ok && l.CacheTTL > 0 {
+		l.cache.add(username, password, time.Now().Add(l.CacheTTL))
+	}
+	return ok, nil
+}
+
+func (l *LDAP) authenticate(username, password string) (bool, error) {
+	conn, err := l.dial()
+	if err != nil {
+		return false, err
+	}
+	defer conn.close()
+
+	var entry *ldapEntry
+	if l.UserDN != "" {
+		dn := strings.Replace(l.UserDN, "{username}", escapeDNValue(username), -1)
+		if err := conn.bind(dn, password); err != nil {
+			return invalidCredentials(err)
+		}
+		switch {
+		case l.Filter != "":
+			if entry, err = l.findUser(conn, username); err != nil || entry == nil {
+				return false, err
+			}
+		case len(l.Groups) > 0:
+			// the DN made from the template
+			// is the entry of the user
+			filter, _ := ldapFilter("(objectClass=*)")
+			entries, err := conn.search(dn, scopeBaseObject, filter, l.attributes())
+			if err != nil {
+				return false, err
+			}
+			if len(entries) != 1 {
+				return false, nil
+			}
+			entry = &entries[0]
+		}
+	} else {
+		if l.BindDN != "" {
+			if err := conn.bind(l.BindDN, l.BindPassword); err != nil {
+				return false, fmt.Errorf("binding as %s: %v", l.BindDN, err)
+			}
+		}
+		if entry, err = l.findUser(conn, username); err != nil || entry == nil {
+			return false, err
+		}
+		if err := conn.bind(entry.dn, password); err != nil {
+			return invalidCredentials(err)
+		}
+	}
+
+	if len(l.Groups) == 0 {
+		return true, nil
+	}
+	for _, group := range entry.attributes[strings.ToLower(l.GroupAttribute)] {
+		for _, allowed := range l.Groups {
+			if strings.EqualFold(strings.TrimSpace(group), allowed) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// findUser returns the entry of username, or nil if
+// there is not exactly one.
+func (l *LDAP) findUser(conn *ldapConn, username string) (*ldapEntry, error) {
+	filter, err := ldapFilter(strings.Replace(l.Filter, "{username}", escapeFilterValue(username), -1))
+	if err != nil {
+		return nil, err
+	}
+	entries, err := conn.search(l.BaseDN, scopeWholeSubtree, filter, l.attributes())
+	if err != nil || len(entries) != 1 {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// attributes returns the attributes to read from the entry of users.
+func (l *LDAP) attributes() []string {
+	if len(l.Groups) > 0 {
+		return []string{l.GroupAttribute}
+	}
+	return []string{"1.1"} // no attributes
+}
+
+// invalidCredentials returns false, and err unless it
+// is the result of a bind with a wrong password.
+func invalidCredentials(err error) (bool, error) {
+	if e, ok := err.(ldapError); ok && e.code == resultInvalidCredentials {
+		return false, nil
+	}
+	return false, err
+}
+
+// dial connects to the directory.
+func (l *LDAP) dial() (*ldapConn, error) {
+	u, err := url.Parse(l.URL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		if u.Scheme == "ldaps" {
+			host = net.JoinHostPort(host, "636")
+		} else {
+			host = net.JoinHostPort(host, "389")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: l.Timeout}
+	var nc net.Conn
+	if u.Scheme == "ldaps" {
+		nc, err = tls.DialWithDialer(dialer, "tcp", host, l.TLSConfig)
+	} else {
+		nc, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	nc.SetDeadline(time.Now().Add(l.Timeout))
+	conn := &ldapConn{conn: nc, r: bufio.NewReader(nc)}
+	if l.StartTLS && u.Scheme == "ldap" {
+		if err := conn.startTLS(l.TLSConfig); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// ldapConn is a connection to an LDAP directory (RFC 4511),
+// on which one operation is done at a time.
+type ldapConn struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	msgID int
+}
+
+// ldapEntry is an entry of the results of a search, with
+// the names of its attributes in lower case.
+type ldapEntry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+// ldapError is an unsuccessful result of an operation.
+type ldapError struct {
+	code    int
+	message string
+}
+
+func (e ldapError) Error() string {
+	if e.message == "" {
+		return fmt.Sprintf("result code %d", e.code)
+	}
+	return fmt.Sprintf("result code %d: %s", e.code, e.message)
+}
+
+const (
+	appBindRequest      = 0x60
+	appBindResponse     = 0x61
+	appUnbindRequest    = 0x42
+	appSearchRequest    = 0x63
+	appSearchEntry      = 0x64
+	appSearchDone       = 0x65
+	appSearchReference  = 0x73
+	appExtendedRequest  = 0x77
+	appExtendedResponse = 0x78
+
+	scopeBaseObject   = 0
+	scopeWholeSubtree = 2
+
+	resultSuccess            = 0
+	resultSizeLimitExceeded  = 4
+	resultInvalidCredentials = 49
+
+	startTLSOID = "1.3.6.1.4.1.1466.20037"
+)
+
+// send sends the protocol operation op in a new message.
+func (c *ldapConn) send(op []byte) error {
+	c.msgID++
+	_, err := c.conn.Write(berEncode(berSequence, berInt(berInteger, c.msgID), op))
+	return err
+}
+
+// receive reads the protocol operation of the
+// response to the last message that was sent.
+func (c *ldapConn) receive() (berElement, error) {
+	msg, err := berRead(c.r)
+	if err != nil {
+		return berElement{}, err
+	}
+	parts, err := berChildren(msg.content)
+	if err != nil {
+		return berElement{}, err
+	}
+	if msg.tag != berSequence || len(parts) < 2 || parts[0].tag != berInteger {
+		return berElement{}, errors.New("malformed message")
+	}
+	if id := berParseInt(parts[0].content); id != c.msgID {
+		// such as a notice of disconnection, with ID 0
+		code, message, _ := parseResult(parts[1].content)
+		return berElement{}, fmt.Errorf("unexpected message %d: %v", id, ldapError{code, message})
+	}
+	return parts[1], nil
+}
+
+// result reads the response to the last message that was
+// sent, which must have tag, and returns its result.
+func (c *ldapConn) result(tag byte) error {
+	op, err := c.receive()
+	if err != nil {
+		return err
+	}
+	if op.tag != tag {
+		return fmt.Errorf("unexpected response 0x%x", op.tag)
+	}
+	code, message, err := parseResult(op.content)
+	if err != nil {
+		return err
+	}
+	if code != resultSuccess {
+		return ldapError{code, message}
+	}
+	return nil
+}
+
+// parseResult decodes the result code and diagnostic
+// message of a response.
+func parseResult(b []byte) (int, string, error) {
+	parts, err := berChildren(b)
+	if err != nil {
+		return 0, "", err
+	}
+	if len(parts) < 3 || parts[0].tag != berEnumerated {
+		return 0, "", errors.New("malformed result")
+	}
+	return berParseInt(parts[0].content), string(parts[2].content), nil
+}
+
+// bind authenticates the connection as dn with a simple bind.
+func (c *ldapConn) bind(dn, password string) error {
+	err := c.send(berEncode(appBindRequest,
+		berInt(berInteger, 3),
+		berString(berOctetString, dn),
+		berString(0x80, password)))
+	if err != nil {
+		return err
+	}
+	return c.result(appBindResponse)
+}
+
+// search returns the entries under base, within scope, that
+// match filter, with attributes. At most two are returned, as
+// more than one is of no use.
+func (c *ldapConn) search(base string, scope int, filter []byte, attributes []string) ([]ldapEntry, error) {
+	var attrs [][]byte
+	for _, a := range attributes {
+		attrs = append(attrs, berString(berOctetString, a))
+	}
+	err := c.send(berEncode(appSearchRequest,
+		berString(berOctetString, base),
+		berInt(berEnumerated, scope),
+		berInt(berEnumerated, 0), // never dereference aliases
+		berInt(berInteger, 2),    // size limit
+		berInt(berInteger, 0),    // no time limit but the deadline
+		berBool(false),
+		filter,
+		berEncode(berSequence, attrs...)))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ldapEntry
+	for {
+		op, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case appSearchEntry:
+			entry, err := parseEntry(op.content)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case appSearchReference:
+			// referrals to other servers are not followed
+		case appSearchDone:
+			code, message, err := parseResult(op.content)
+			if err != nil {
+				return nil, err
+			}
+			if code != resultSuccess && code != resultSizeLimitExceeded {
+				return nil, ldapError{code, message}
+			}
+			return entries, nil
+		default:
+			return nil, fmt.Errorf("unexpected response 0x%x", op.tag)
+		}
+	}
+}
+
+// parseEntry decodes a SearchResultEntry.
+func parseEntry(b []byte) (ldapEntry, error) {
+	entry := ldapEntry{attributes: make(map[string][]string)}
+	parts, err := berChildren(b)
+	if err != nil {
+		return entry, err
+	}
+	if len(parts) != 2 || parts[0].tag != berOctetString || parts[1].tag != berSequence {
+		return entry, errors.New("malformed entry")
+	}
+	entry.dn = string(parts[0].content)
+	attrs, err := berChildren(parts[1].content)
+	if err != nil {
+		return entry, err
+	}
+	for _, attr := range attrs {
+		fields, err := berChildren(attr.content)
+		if err != nil {
+			return entry, err
+		}
+		if len(fields) != 2 || fields[0].tag != berOctetString || fields[1].tag != berSet {
+			return entry, errors.New("malformed attribute")
+		}
+		values, err := berChildren(fields[1].content)
+		if err != nil {
+			return entry, err
+		}
+		name := strings.ToLower(string(fields[0].content))
+		for _, v := range values {
+			entry.attributes[name] = append(entry.attributes[name], string(v.content))
+		}
+	}
+	return entry, nil
+}
+
+// startTLS upgrades the connection to TLS.
+func (c *ldapConn) startTLS(config *tls.Config) error {
+	if err := c.send(berEncode(appExtendedRequest, berString(0x80, startTLSOID))); err != nil {
+		return err
+	}
+	if err := c.result(appExtendedResponse); err != nil {
+		return fmt.Errorf("StartTLS: %v", err)
+	}
+	tc := tls.Client(c.conn, config)
+	if err := tc.Handshake(); err != nil {
+		return err
+	}
+	c.conn, c.r = tc, bufio.NewReader(tc)
+	return nil
+}
+
+// close unbinds and closes the connection.
+func (c *ldapConn) close() error {
+	c.send(berEncode(appUnbindRequest))
+	return c.conn.Close()
+}
+
+// authCache remembers successful logins until they expire. It
+// keeps salted hashes of the credentials, not the credentials.
+type authCache struct {
+	salt []byte
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]time.Time
+}
+
+func newAuthCache() *authCache {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+	return &authCache{salt: salt, entries: make(map[[sha256.Size]byte]time.Time)}
+}
+
+func (ac *authCache) key(username, password string) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(ac.salt)
+	h.Write([]byte(username))
+	h.Write([]byte{0})
+	h.Write([]byte(password))
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+// valid returns whether a login with username
+// and password succeeded, and has not expired.
+func (ac *authCache) valid(username, password string) bool {
+	key := ac.key(username, password)
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	expires, ok := ac.entries[key]
+	return ok && time.Now().Before(expires)
+}
+
+// add remembers that a login with username and
+// password succeeded, until expires.
+func (ac *authCache) add(username, password string, expires time.Time) {
+	key := ac.key(username, password)
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	now := time.Now()
+	for k, exp := range ac.entries {
+		if now.After(exp) {
+			delete(ac.entries, k)
+		}
+	}
+	ac.entries[key] = expires
+}
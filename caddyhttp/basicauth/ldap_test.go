@@ -0,0 +1,393 @@
+package basicauth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// fakeDirectory is an LDAP server with a few entries, which
+// understands just enough of LDAP to test the backend.
+type fakeDirectory struct {
+	net.Listener
+	passwords map[string]string // by DN
+	entries   []ldapEntry
+	tls       *tls.Config // for StartTLS
+
+	mu    sync.Mutex
+	binds []string
+}
+
+func newFakeDirectory(t *testing.T, tlsConfig *tls.Config, ldaps bool) *fakeDirectory {
+	var ln net.Listener
+	var err error
+	if ldaps {
+		ln, err = tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &fakeDirectory{
+		Listener: ln,
+		tls:      tlsConfig,
+		passwords: map[string]string{
+			"cn=search,dc=example,dc=com":           "search-secret",
+			"uid=alice,ou=people,dc=example,dc=com": "alice-secret",
+			"uid=bob,ou=people,dc=example,dc=com":   "bob-secret",
+		},
+		entries: []ldapEntry{
+			{dn: "uid=alice,ou=people,dc=example,dc=com", attributes: map[string][]string{
+				"objectclass": {"person"},
+				"uid":         {"alice"},
+				"memberof":    {"cn=staff,ou=groups,dc=example,dc=com", "CN=Admins,OU=Groups,DC=example,DC=com"},
+			}},
+			{dn: "uid=bob,ou=people,dc=example,dc=com", attributes: map[string][]string{
+				"objectclass": {"person"},
+				"uid":         {"bob"},
+				"memberof":    {"cn=staff,ou=groups,dc=example,dc=com"},
+			}},
+		},
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	return d
+}
+
+func (d *fakeDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	var bound string
+	for {
+		msg, err := berRead(r)
+		if err != nil {
+			return
+		}
+		parts, _ := berChildren(msg.content)
+		id := berParseInt(parts[0].content)
+		reply := func(op []byte) {
+			conn.Write(berEncode(berSequence, berInt(berInteger, id), op))
+		}
+		result := func(tag byte, code int) []byte {
+			return berEncode(tag, berInt(berEnumerated, code), berString(berOctetString, ""), berString(berOctetString, ""))
+		}
+		op := parts[1]
+		fields, _ := berChildren(op.content)
+		switch op.tag {
+		case appBindRequest:
+			dn, password := string(fields[1].content), string(fields[2].content)
+			d.mu.Lock()
+			d.binds = append(d.binds, dn)
+			d.mu.Unlock()
+			if pw, ok := d.passwords[dn]; !ok || pw != password {
+				reply(result(appBindResponse, resultInvalidCredentials))
+				continue
+			}
+			bound = dn
+			reply(result(appBindResponse, resultSuccess))
+		case appSearchRequest:
+			if bound == "" {
+				reply(result(appSearchDone, 50)) // insufficientAccessRights
+				continue
+			}
+			base, scope := string(fields[0].content), berParseInt(fields[1].content)
+			filter := berElement{fields[6].tag, fields[6].content}
+			for _, e := range d.entries {
+				if (scope == scopeBaseObject && e.dn != base) || !strings.HasSuffix(e.dn, base) || !matches(filter, e) {
+					continue
+				}
+				var attrs [][]byte
+				for name, values := range e.attributes {
+					var vals [][]byte
+					for _, v := range values {
+						vals = append(vals, berString(berOctetString, v))
+					}
+					attrs = append(attrs, berEncode(berSequence, berString(berOctetString, name), berEncode(berSet, vals...)))
+				}
+				reply(berEncode(appSearchEntry, berString(berOctetString, e.dn), berEncode(berSequence, attrs...)))
+			}
+			reply(result(appSearchDone, resultSuccess))
+		case appExtendedRequest:
+			if d.tls == nil {
+				reply(result(appExtendedResponse, 2)) // protocolError
+				continue
+			}
+			reply(result(appExtendedResponse, resultSuccess))
+			tc := tls.Server(conn, d.tls)
+			conn, r = tc, bufio.NewReader(tc)
+		case appUnbindRequest:
+			return
+		}
+	}
+}
+
+// matches evaluates the and, equality and presence filters.
+func matches(filter berElement, e ldapEntry) bool {
+	switch filter.tag {
+	case 0xa0:
+		items, _ := berChildren(filter.content)
+		for _, item := range items {
+			if !matches(item, e) {
+				return false
+			}
+		}
+		return true
+	case 0xa3:
+		ava, _ := berChildren(filter.content)
+		for _, v := range e.attributes[strings.ToLower(string(ava[0].content))] {
+			if v == string(ava[1].content) {
+				return true
+			}
+		}
+	case 0x87:
+		return len(e.attributes[strings.ToLower(string(filter.content))]) > 0
+	}
+	return false
+}
+
+func (d *fakeDirectory) url(scheme string) string {
+	return scheme + "://" + d.Addr().String()
+}
+
+func testTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldap.example.com"},
+		DNSNames:              []string{"ldap.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	client = &tls.Config{ServerName: "ldap.example.com", RootCAs: pool}
+	return server, client
+}
+
+func TestLDAPSearchAndBind(t *testing.T) {
+	d := newFakeDirectory(t, nil, false)
+	defer d.Close()
+	l := NewLDAP()
+	l.URL = d.url("ldap")
+	l.BindDN, l.BindPassword = "cn=search,dc=example,dc=com", "search-secret"
+	l.BaseDN = "ou=people,dc=example,dc=com"
+	l.Filter = "(&(objectClass=person)(uid={username}))"
+	l.Groups = []string{"cn=admins,ou=groups,dc=example,dc=com"}
+
+	for i, test := range []struct {
+		username, password string
+		expected           bool
+	}{
+		{"alice", "alice-secret", true},
+		{"alice", "wrong", false},
+		{"alice", "", false},
+		{"bob", "bob-secret", false}, // not in the group
+		{"carol", "alice-secret", false},
+		{"*", "alice-secret", false},
+		{"alice)(uid=*", "alice-secret", false},
+	} {
+		actual, err := l.Authenticate(test.username, test.password)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+		}
+		if actual != test.expected {
+			t.Errorf("Test %d: Expected %s:%s to authenticate %v, got %v", i, test.username, test.password, test.expected, actual)
+		}
+	}
+
+	// successful logins are remembered
+	d.Close()
+	if ok, err := l.Authenticate("alice", "alice-secret"); !ok || err != nil {
+		t.Errorf("Expected cached login to succeed without directory, got %v and %v", ok, err)
+	}
+	if _, err := l.Authenticate("alice", "wrong"); err == nil {
+		t.Error("Expected error without directory")
+	}
+}
+
+func TestLDAPUserBind(t *testing.T) {
+	d := newFakeDirectory(t, nil, false)
+	defer d.Close()
+	l := NewLDAP()
+	l.URL = d.url("ldap")
+	l.UserDN = "uid={username},ou=people,dc=example,dc=com"
+	l.CacheTTL = 0
+
+	if ok, err := l.Authenticate("bob", "bob-secret"); !ok || err != nil {
+		t.Errorf("Expected bob to authenticate, got %v and %v", ok, err)
+	}
+	if ok, _ := l.Authenticate("bob", "wrong"); ok {
+		t.Error("Expected wrong password not to authenticate")
+	}
+	d.mu.Lock()
+	lastBind := d.binds[len(d.binds)-1]
+	d.mu.Unlock()
+	if lastBind != "uid=bob,ou=people,dc=example,dc=com" {
+		t.Errorf("Expected bind as bob, got '%s'", lastBind)
+	}
+
+	// groups are read from the entry of the user
+	l.Groups = []string{"cn=admins,ou=groups,dc=example,dc=com"}
+	if ok, _ := l.Authenticate("bob", "bob-secret"); ok {
+		t.Error("Expected bob not to authenticate outside the group")
+	}
+	if ok, err := l.Authenticate("alice", "alice-secret"); !ok || err != nil {
+		t.Errorf("Expected alice to authenticate, got %v and %v", ok, err)
+	}
+}
+
+func TestLDAPTLS(t *testing.T) {
+	serverConfig, clientConfig := testTLSConfigs(t)
+	for _, ldaps := range []bool{true, false} {
+		d := newFakeDirectory(t, serverConfig, ldaps)
+		l := NewLDAP()
+		l.URL = d.url("ldap")
+		l.StartTLS = true
+		if ldaps {
+			l.URL, l.StartTLS = d.url("ldaps"), false
+		}
+		l.TLSConfig = clientConfig
+		l.UserDN = "uid={username},ou=people,dc=example,dc=com"
+		if ok, err := l.Authenticate("alice", "alice-secret"); !ok || err != nil {
+			t.Errorf("ldaps %v: Expected alice to authenticate over TLS, got %v and %v", ldaps, ok, err)
+		}
+
+		// the certificate of the directory is verified
+		l = NewLDAP()
+		l.URL, l.StartTLS = d.url("ldap"), !ldaps
+		if ldaps {
+			l.URL = d.url("ldaps")
+		}
+		l.TLSConfig = &tls.Config{ServerName: "ldap.example.com"}
+		l.UserDN = "uid={username},ou=people,dc=example,dc=com"
+		if _, err := l.Authenticate("alice", "alice-secret"); err == nil {
+			t.Errorf("ldaps %v: Expected untrusted certificate to fail", ldaps)
+		}
+		d.Close()
+	}
+}
+
+func TestLDAPFilter(t *testing.T) {
+	actual, err := ldapFilter(`(&(objectClass=person)(!(uid=a\2a\29))(cn=j*h*n)(mail=*))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := berEncode(0xa0,
+		berEncode(0xa3, berString(berOctetString, "objectClass"), berString(berOctetString, "person")),
+		berEncode(0xa2, berEncode(0xa3, berString(berOctetString, "uid"), berString(berOctetString, "a*)"))),
+		berEncode(0xa4, berString(berOctetString, "cn"), berEncode(berSequence,
+			berString(0x80, "j"), berString(0x81, "h"), berString(0x82, "n"))),
+		berString(0x87, "mail"))
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("Expected %x, got %x", expected, actual)
+	}
+
+	for i, filter := range []string{
+		"uid=alice",
+		"(uid=alice",
+		"(uid=alice))",
+		"(=alice)",
+		"(uid=a(b)",
+		`(uid=\2)`,
+		"(uid>=a*)",
+	} {
+		if _, err := ldapFilter(filter); err == nil {
+			t.Errorf("Test %d: Expected error for %q", i, filter)
+		}
+	}
+
+	if actual := escapeFilterValue(`a*(b)\`); actual != `a\2a\28b\29\5c` {
+		t.Errorf("Expected escaped filter value, got '%s'", actual)
+	}
+	if actual := escapeDNValue(` a,b=c `); actual != `\ a\,b\=c\ ` {
+		t.Errorf("Expected escaped DN value, got '%s'", actual)
+	}
+}
+
+func TestBER(t *testing.T) {
+	for _, n := range []int{0, 1, 127, 128, 255, 256, 65536} {
+		b := berInt(berInteger, n)
+		e, err := berRead(bufio.NewReader(bytes.NewReader(b)))
+		if err != nil || e.tag != berInteger || berParseInt(e.content) != n {
+			t.Errorf("Expected %d to round trip, got %v and %v", n, e, err)
+		}
+	}
+	long := berString(berOctetString, strings.Repeat("x", 300))
+	if !bytes.Equal(long[:4], []byte{berOctetString, 0x82, 0x01, 0x2c}) {
+		t.Errorf("Expected long form length, got %x", long[:4])
+	}
+	if _, err := berChildren([]byte{berSequence, 0x05, 0x01}); err == nil {
+		t.Error("Expected error for truncated element")
+	}
+}
+
+type stubBackend struct {
+	err error
+}
+
+func (b stubBackend) Authenticate(username, password string) (bool, error) {
+	return username == "alice" && password == "secret", b.err
+}
+
+func TestBasicAuthBackend(t *testing.T) {
+	for i, test := range []struct {
+		backend Backend
+		cred    string
+		result  int
+	}{
+		{stubBackend{}, "alice:secret", http.StatusOK},
+		{stubBackend{}, "alice:wrong", http.StatusUnauthorized},
+		{stubBackend{}, "", http.StatusUnauthorized},
+		{stubBackend{errors.New("unreachable")}, "alice:secret", http.StatusBadGateway},
+	} {
+		rw := BasicAuth{
+			Next:  httpserver.HandlerFunc(contentHandler),
+			Rules: []Rule{{Backend: test.backend, Resources: []string{"/"}}},
+		}
+		req := httptest.NewRequest("GET", "/testing", nil)
+		if test.cred != "" {
+			req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(test.cred)))
+		}
+		result, _ := rw.ServeHTTP(httptest.NewRecorder(), req)
+		if result != test.result {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.result, result)
+		}
+	}
+}
@@ -1,7 +1,13 @@
 package basicauth
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -9,8 +15,9 @@ import (
 
 func init() {
 	caddy.RegisterPlugin("basicauth", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
@@ -45,6 +52,30 @@ func basicAuthParse(c *caddy.Controller) ([]Rule, error) {
 
 		args := c.RemainingArgs()
 
+		// usernames cannot have colons, so there
+		// is no mistaking a URL for one
+		if len(args) > 0 && (strings.HasPrefix(args[0], "ldap://") || strings.HasPrefix(args[0], "ldaps://")) {
+			if rule.Backend, err = ldapParse(c, args[0]); err != nil {
+				return rules, err
+			}
+			rule.Resources = args[1:]
+			if len(rule.Resources) == 0 {
+				rule.Resources = []string{"/"}
+			}
+			if err := resolveMatchers(c, &rule); err != nil {
+				return rules, err
+			}
+			rules = append(rules, rule)
+			continue
+		}
+
+		// htpasswd files are in the site root
+		if len(args) > 0 && strings.HasPrefix(args[len(args)-1], "htpasswd=") {
+			if err := httpserver.CheckStaticRoot(c); err != nil {
+				return rules, err
+			}
+		}
+
 		switch len(args) {
 		case 2:
 			rule.Username = args[0]
@@ -68,15 +99,149 @@ func basicAuthParse(c *caddy.Controller) ([]Rule, error) {
 			return rules, c.ArgErr()
 		}
 
+		if err := resolveMatchers(c, &rule); err != nil {
+			return rules, err
+		}
 		rules = append(rules, rule)
 	}
 
 	return rules, nil
 }
 
+// resolveMatchers looks up the named matchers of the
+// resources of rule that are @names.
+func resolveMatchers(c *caddy.Controller, rule *Rule) error {
+	for _, res := range rule.Resources {
+		if !httpserver.IsMatcherRef(res) {
+			continue
+		}
+		m, err := httpserver.MatcherRef(c, res)
+		if err != nil {
+			return err
+		}
+		if rule.Matchers == nil {
+			rule.Matchers = make(map[string]httpserver.RequestMatcher)
+		}
+		rule.Matchers[res] = m
+	}
+	return nil
+}
+
 func passwordMatcher(username, passw, siteRoot string) (PasswordMatcher, error) {
 	if !strings.HasPrefix(passw, "htpasswd=") {
 		return PlainMatcher(passw), nil
 	}
 	return GetHtpasswdMatcher(passw[9:], username, siteRoot)
 }
+
+// ldapParse parses the block of a basicauth directive that
+// authenticates users with an LDAP directory, which has the form
+//
+//	basicauth ldap[s]://host[:port] [paths...] {
+//	    starttls
+//	    ca              file
+//	    user_dn         template
+//	    bind_dn         dn
+//	    bind_password   password
+//	    base_dn         dn
+//	    filter          template
+//	    group           dns...
+//	    group_attribute attribute
+//	    cache           duration
+//	    timeout         duration
+//	}
+//
+// Either user_dn, or base_dn and filter, are required. In the
+// templates, {username} is replaced with the username. Without
+// paths, the whole site is protected.
+func ldapParse(c *caddy.Controller, rawurl string) (*LDAP, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return nil, c.Errf("basicauth: invalid LDAP URL '%s'", rawurl)
+	}
+	l := NewLDAP()
+	l.URL = u.Scheme + "://" + u.Host
+	l.TLSConfig = &tls.Config{ServerName: u.Host}
+	if host, _, err := net.SplitHostPort(u.Host); err == nil {
+		l.TLSConfig.ServerName = host
+	}
+
+	for c.NextBlock() {
+		what := c.Val()
+		args := c.RemainingArgs()
+		switch what {
+		case "starttls":
+			if len(args) != 0 {
+				return nil, c.ArgErr()
+			}
+			if u.Scheme != "ldap" {
+				return nil, c.Err("basicauth: starttls is for ldap URLs")
+			}
+			l.StartTLS = true
+			continue
+		case "group":
+			if len(args) == 0 {
+				return nil, c.ArgErr()
+			}
+			l.Groups = append(l.Groups, args...)
+			continue
+		}
+
+		if len(args) != 1 {
+			return nil, c.ArgErr()
+		}
+		value := args[0]
+		switch what {
+		case "ca":
+			pem, err := ioutil.ReadFile(value)
+			if err != nil {
+				return nil, c.Errf("basicauth: reading ca: %v", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, c.Errf("basicauth: no certificates in '%s'", value)
+			}
+			l.TLSConfig.RootCAs = pool
+		case "user_dn":
+			l.UserDN = value
+		case "bind_dn":
+			l.BindDN = value
+		case "bind_password":
+			l.BindPassword = value
+		case "base_dn":
+			l.BaseDN = value
+		case "filter":
+			if _, err := ldapFilter(strings.Replace(value, "{username}", "user", -1)); err != nil {
+				return nil, c.Errf("basicauth: %v", err)
+			}
+			l.Filter = value
+		case "group_attribute":
+			l.GroupAttribute = value
+		case "cache":
+			dur, err := time.ParseDuration(value)
+			if err != nil || dur < 0 {
+				return nil, c.Errf("basicauth: invalid cache '%s'", value)
+			}
+			l.CacheTTL = dur
+		case "timeout":
+			dur, err := time.ParseDuration(value)
+			if err != nil || dur <= 0 {
+				return nil, c.Errf("basicauth: invalid timeout '%s'", value)
+			}
+			l.Timeout = dur
+		default:
+			return nil, c.Errf("basicauth: unknown LDAP property '%s'", what)
+		}
+	}
+
+	if l.UserDN == "" && l.Filter == "" {
+		return nil, c.Err("basicauth: LDAP needs user_dn or filter")
+	}
+	if l.Filter != "" && l.BaseDN == "" {
+		return nil, c.Err("basicauth: LDAP filter needs base_dn")
+	}
+	if l.BindDN != "" && l.UserDN != "" {
+		return nil, c.Err("basicauth: LDAP bind_dn is for searching without user_dn")
+	}
+	return l, nil
+}
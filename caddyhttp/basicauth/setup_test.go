@@ -3,9 +3,11 @@ package basicauth
 import (
 	"fmt"
 	"io/ioutil"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -130,3 +132,91 @@ md5:$apr1$l42y8rex$pOA2VJ0x/0TwaFeAF9nX61`
 		}
 	}
 }
+
+func TestBasicAuthParseLDAP(t *testing.T) {
+	rules, err := basicAuthParse(caddy.NewTestController("http", `basicauth ldaps://dc.example.com /admin /private {
+		user_dn         {username}@example.com
+		base_dn         "dc=example,dc=com"
+		filter          (&(objectClass=user)(sAMAccountName={username}))
+		group           "CN=Admins,CN=Users,DC=example,DC=com"
+		group_attribute memberOf
+		cache           30s
+		timeout         2s
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(rules) != 1 || fmt.Sprint(rules[0].Resources) != "[/admin /private]" {
+		t.Fatalf("Expected one rule for the paths, got %+v", rules)
+	}
+	l, ok := rules[0].Backend.(*LDAP)
+	if !ok {
+		t.Fatalf("Expected LDAP backend, got %#v", rules[0].Backend)
+	}
+	if l.URL != "ldaps://dc.example.com" || l.TLSConfig.ServerName != "dc.example.com" ||
+		l.UserDN != "{username}@example.com" || l.BaseDN != "dc=example,dc=com" ||
+		l.Filter != "(&(objectClass=user)(sAMAccountName={username}))" ||
+		fmt.Sprint(l.Groups) != "[CN=Admins,CN=Users,DC=example,DC=com]" ||
+		l.CacheTTL != 30*time.Second || l.Timeout != 2*time.Second {
+		t.Errorf("Unexpected LDAP backend %+v", l)
+	}
+
+	rules, err = basicAuthParse(caddy.NewTestController("http", `basicauth ldap://dc.example.com:3389 {
+		starttls
+		user_dn uid={username},ou=people,dc=example,dc=com
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	l = rules[0].Backend.(*LDAP)
+	if fmt.Sprint(rules[0].Resources) != "[/]" || !l.StartTLS || l.TLSConfig.ServerName != "dc.example.com" {
+		t.Errorf("Expected whole site protected with StartTLS, got %+v and %+v", rules[0], l)
+	}
+
+	for i, input := range []string{
+		"basicauth ldap://dc.example.com",
+		"basicauth ldap:// {\n user_dn uid={username} \n}",
+		"basicauth ldap://dc.example.com/dc=example {\n user_dn uid={username} \n}",
+		"basicauth ldaps://dc.example.com {\n starttls \n user_dn uid={username} \n}",
+		"basicauth ldap://dc.example.com {\n filter (uid={username}) \n}",
+		"basicauth ldap://dc.example.com {\n base_dn dc=example \n filter uid={username} \n}",
+		"basicauth ldap://dc.example.com {\n user_dn uid={username} \n bind_dn cn=search \n}",
+		"basicauth ldap://dc.example.com {\n user_dn uid={username} \n cache forever \n}",
+		"basicauth ldap://dc.example.com {\n user_dn uid={username} \n ca /nonexistent/ca.pem \n}",
+		"basicauth ldap://dc.example.com {\n user_dn uid={username} \n password secret \n}",
+	} {
+		if _, err := basicAuthParse(caddy.NewTestController("http", input)); err == nil {
+			t.Errorf("Test %d: Expected error for %q but got none", i, input)
+		}
+	}
+}
+
+func TestBasicAuthNamedMatcher(t *testing.T) {
+	c := caddy.NewTestController("http", "basicauth user pwd {\n /admin\n @api\n}")
+	httpserver.GetConfig(c).AddMatcher(&httpserver.Matcher{Name: "@api", Methods: []string{"POST"}})
+	rules, err := basicAuthParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for i, test := range []struct {
+		method, path string
+		expected     bool
+	}{
+		{"GET", "/admin/users", true},
+		{"POST", "/", true},
+		{"GET", "/", false},
+	} {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		var matched bool
+		for _, res := range rules[0].Resources {
+			matched = matched || rules[0].matches(r, res)
+		}
+		if matched != test.expected {
+			t.Errorf("Test %d: Expected match %v, got %v", i, test.expected, matched)
+		}
+	}
+
+	if _, err := basicAuthParse(caddy.NewTestController("http", "basicauth @web user pwd")); err == nil {
+		t.Error("Expected error for unknown matcher, got none")
+	}
+}
@@ -12,13 +12,17 @@ import (
 
 func init() {
 	caddy.RegisterPlugin("browse", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
 // setup configures a new Browse middleware instance.
 func setup(c *caddy.Controller) error {
+	if err := httpserver.CheckStaticRoot(c); err != nil {
+		return err
+	}
 	configs, err := browseParse(c)
 	if err != nil {
 		return err
@@ -78,4 +78,11 @@ func TestSetup(t *testing.T) {
 	if err != nil {
 		t.Errorf("Test for non-existent browse path received an error, but shouldn't have: %v", err)
 	}
+
+	// the root is not resolved for each request by browse
+	controller = caddy.NewTestController("http", "browse")
+	httpserver.GetConfig(controller).Root = "/srv/{label1}"
+	if err := setup(controller); err == nil {
+		t.Error("Expected error for a root with placeholders, got none")
+	}
 }
@@ -5,27 +5,74 @@ import (
 	_ "github.com/mholt/caddy/caddyhttp/httpserver"
 
 	// plug in the standard directives
+	_ "github.com/mholt/caddy/caddyhttp/apikeys"
+	_ "github.com/mholt/caddy/caddyhttp/assets"
+	_ "github.com/mholt/caddy/caddyhttp/authz"
 	_ "github.com/mholt/caddy/caddyhttp/basicauth"
 	_ "github.com/mholt/caddy/caddyhttp/bind"
 	_ "github.com/mholt/caddy/caddyhttp/browse"
+	_ "github.com/mholt/caddy/caddyhttp/certsadmin"
+	_ "github.com/mholt/caddy/caddyhttp/cron"
+	_ "github.com/mholt/caddy/caddyhttp/debug"
+	_ "github.com/mholt/caddy/caddyhttp/defaultserver"
+	_ "github.com/mholt/caddy/caddyhttp/deploy"
+	_ "github.com/mholt/caddy/caddyhttp/earlyhints"
 	_ "github.com/mholt/caddy/caddyhttp/errors"
+	_ "github.com/mholt/caddy/caddyhttp/etag"
+	_ "github.com/mholt/caddy/caddyhttp/exec"
+	_ "github.com/mholt/caddy/caddyhttp/expectct"
+	_ "github.com/mholt/caddy/caddyhttp/experiment"
 	_ "github.com/mholt/caddy/caddyhttp/expvar"
 	_ "github.com/mholt/caddy/caddyhttp/extensions"
 	_ "github.com/mholt/caddy/caddyhttp/fastcgi"
+	_ "github.com/mholt/caddy/caddyhttp/git"
+	_ "github.com/mholt/caddy/caddyhttp/graphql"
 	_ "github.com/mholt/caddy/caddyhttp/gzip"
+	_ "github.com/mholt/caddy/caddyhttp/handleerrors"
 	_ "github.com/mholt/caddy/caddyhttp/header"
+	_ "github.com/mholt/caddy/caddyhttp/hostcheck"
 	_ "github.com/mholt/caddy/caddyhttp/internalsrv"
+	_ "github.com/mholt/caddy/caddyhttp/keepalive"
+	_ "github.com/mholt/caddy/caddyhttp/lang"
+	_ "github.com/mholt/caddy/caddyhttp/limits"
+	_ "github.com/mholt/caddy/caddyhttp/listen"
+	_ "github.com/mholt/caddy/caddyhttp/listeneropts"
 	_ "github.com/mholt/caddy/caddyhttp/log"
+	_ "github.com/mholt/caddy/caddyhttp/lua"
 	_ "github.com/mholt/caddy/caddyhttp/markdown"
+	_ "github.com/mholt/caddy/caddyhttp/matcher"
+	_ "github.com/mholt/caddy/caddyhttp/maxconns"
 	_ "github.com/mholt/caddy/caddyhttp/maxrequestbody"
 	_ "github.com/mholt/caddy/caddyhttp/mime"
+	_ "github.com/mholt/caddy/caddyhttp/minrate"
+	_ "github.com/mholt/caddy/caddyhttp/multiplex"
+	_ "github.com/mholt/caddy/caddyhttp/normalize"
+	_ "github.com/mholt/caddy/caddyhttp/notify"
+	_ "github.com/mholt/caddy/caddyhttp/oidc"
 	_ "github.com/mholt/caddy/caddyhttp/pprof"
 	_ "github.com/mholt/caddy/caddyhttp/proxy"
+	_ "github.com/mholt/caddy/caddyhttp/ranges"
+	_ "github.com/mholt/caddy/caddyhttp/realip"
+	_ "github.com/mholt/caddy/caddyhttp/recentrequests"
 	_ "github.com/mholt/caddy/caddyhttp/redirect"
+	_ "github.com/mholt/caddy/caddyhttp/reloadadmin"
 	_ "github.com/mholt/caddy/caddyhttp/rewrite"
 	_ "github.com/mholt/caddy/caddyhttp/root"
+	_ "github.com/mholt/caddy/caddyhttp/saml"
+	_ "github.com/mholt/caddy/caddyhttp/schedule"
+	_ "github.com/mholt/caddy/caddyhttp/servertiming"
+	_ "github.com/mholt/caddy/caddyhttp/share"
+	_ "github.com/mholt/caddy/caddyhttp/shed"
+	_ "github.com/mholt/caddy/caddyhttp/sitemap"
+	_ "github.com/mholt/caddy/caddyhttp/soap"
 	_ "github.com/mholt/caddy/caddyhttp/status"
 	_ "github.com/mholt/caddy/caddyhttp/templates"
+	_ "github.com/mholt/caddy/caddyhttp/throttle"
+	_ "github.com/mholt/caddy/caddyhttp/transform"
+	_ "github.com/mholt/caddy/caddyhttp/tunnel"
+	_ "github.com/mholt/caddy/caddyhttp/vars"
+	_ "github.com/mholt/caddy/caddyhttp/vhost"
 	_ "github.com/mholt/caddy/caddyhttp/websocket"
+	_ "github.com/mholt/caddy/caddyhttp/wellknown"
 	_ "github.com/mholt/caddy/startupshutdown"
 )
@@ -0,0 +1,81 @@
+// Package certsadmin provides middleware that serves an API to
+// list the certificates the process has loaded and to renew
+// managed ones on demand.
+package certsadmin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddytls"
+)
+
+// DefaultPath is the path of the API by default.
+const DefaultPath = "/certs-admin"
+
+// CertsAdmin is middleware that serves the API at Path:
+//
+//	GET  {path}                lists the loaded certificates
+//	POST {path}/renew?name=n   renews the certificate for n now
+//
+// Each certificate is listed with its names, issuer, expiry,
+// OCSP staple status and where it is stored or was loaded
+// from. Only managed certificates can be renewed; renewal
+// happens regardless of when the certificate expires.
+type CertsAdmin struct {
+	Next httpserver.Handler
+	Path string
+
+	// AllowRemote is whether clients other than those on
+	// the loopback interface may use the API.
+	AllowRemote bool
+}
+
+// renewCertificate renews a certificate; it is a
+// variable so tests can replace it.
+var renewCertificate = caddytls.RenewCertificate
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (a CertsAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !httpserver.Path(r.URL.Path).Matches(a.Path) {
+		return a.Next.ServeHTTP(w, r)
+	}
+	if !a.AllowRemote && !caddy.IsLoopback(r.RemoteAddr) {
+		return http.StatusForbidden, nil
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, a.Path), "/") {
+	case "":
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			return http.StatusMethodNotAllowed, nil
+		}
+		return httpserver.WriteJSONResponse(w, http.StatusOK, caddytls.CachedCertificates())
+	case "renew":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			return http.StatusMethodNotAllowed, nil
+		}
+		name := r.FormValue("name")
+		if name == "" {
+			httpserver.WriteTextResponse(w, http.StatusBadRequest, "name is required\n")
+			return 0, nil
+		}
+		if err := renewCertificate(name); err != nil {
+			httpserver.WriteTextResponse(w, http.StatusBadGateway, err.Error()+"\n")
+			return 0, nil
+		}
+		for _, info := range caddytls.CachedCertificates() {
+			for _, n := range info.Names {
+				if strings.EqualFold(n, name) {
+					return httpserver.WriteJSONResponse(w, http.StatusOK, info)
+				}
+			}
+		}
+		return http.StatusNoContent, nil
+	}
+	return http.StatusNotFound, nil
+}
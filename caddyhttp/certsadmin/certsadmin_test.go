@@ -0,0 +1,58 @@
+package certsadmin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddytls"
+)
+
+func TestCertsAdmin(t *testing.T) {
+	var renewed []string
+	renewCertificate = func(name string) error {
+		if name == "unmanaged.example.com" {
+			return errors.New("certificate for unmanaged.example.com is not managed")
+		}
+		renewed = append(renewed, name)
+		return nil
+	}
+	defer func() { renewCertificate = caddytls.RenewCertificate }()
+
+	admin := CertsAdmin{Next: httpserver.EmptyNext, Path: DefaultPath}
+	for i, test := range []struct {
+		method, target, remote string
+		expectStatus           int
+		expectBody             string
+	}{
+		{"GET", "/other", "127.0.0.1:1", 0, ""},
+		{"GET", "/certs-admin", "10.0.0.1:1", http.StatusForbidden, ""},
+		{"GET", "/certs-admin", "127.0.0.1:1", 0, "["},
+		{"DELETE", "/certs-admin", "127.0.0.1:1", http.StatusMethodNotAllowed, ""},
+		{"GET", "/certs-admin/renew?name=example.com", "127.0.0.1:1", http.StatusMethodNotAllowed, ""},
+		{"POST", "/certs-admin/renew", "127.0.0.1:1", 0, "name is required"},
+		{"POST", "/certs-admin/renew?name=unmanaged.example.com", "127.0.0.1:1", 0, "is not managed"},
+		{"POST", "/certs-admin/renew?name=example.com", "127.0.0.1:1", http.StatusNoContent, ""},
+		{"POST", "/certs-admin/revoke", "127.0.0.1:1", http.StatusNotFound, ""},
+	} {
+		r := httptest.NewRequest(test.method, test.target, nil)
+		r.RemoteAddr = test.remote
+		w := httptest.NewRecorder()
+		status, err := admin.ServeHTTP(w, r)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if status != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if !strings.Contains(w.Body.String(), test.expectBody) {
+			t.Errorf("Test %d: Expected body with '%s', got '%s'", i, test.expectBody, w.Body.String())
+		}
+	}
+	if len(renewed) != 1 || renewed[0] != "example.com" {
+		t.Errorf("Expected example.com to be renewed, got %v", renewed)
+	}
+}
@@ -0,0 +1,72 @@
+package certsadmin
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("certs_admin", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
+	})
+}
+
+// setup configures a new CertsAdmin middleware instance. Syntax:
+//
+//	certs_admin [path] {
+//	    allow_remote
+//	}
+//
+// The path defaults to /certs-admin. Unless allow_remote is
+// given, only clients on the loopback interface may use the
+// API; otherwise it should be protected, such as by basicauth.
+func setup(c *caddy.Controller) error {
+	admin, err := certsAdminParse(c)
+	if err != nil {
+		return err
+	}
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		admin.Next = next
+		return admin
+	})
+	return nil
+}
+
+func certsAdminParse(c *caddy.Controller) (CertsAdmin, error) {
+	admin := CertsAdmin{Path: DefaultPath}
+	var seen bool
+	for c.Next() {
+		if seen {
+			return admin, c.Err("certs_admin: can only be specified once per site")
+		}
+		seen = true
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			if !strings.HasPrefix(args[0], "/") {
+				return admin, c.Errf("certs_admin: invalid path '%s'", args[0])
+			}
+			admin.Path = args[0]
+		default:
+			return admin, c.ArgErr()
+		}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "allow_remote":
+				if c.NextArg() {
+					return admin, c.ArgErr()
+				}
+				admin.AllowRemote = true
+			default:
+				return admin, c.Errf("certs_admin: unknown property '%s'", c.Val())
+			}
+		}
+	}
+	return admin, nil
+}
@@ -0,0 +1,61 @@
+package certsadmin
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `certs_admin /certs`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler, ok := mids[0](httpserver.EmptyNext).(CertsAdmin)
+	if !ok {
+		t.Fatalf("Expected handler to be type CertsAdmin, got: %#v", mids[0](httpserver.EmptyNext))
+	}
+	if !httpserver.SameNext(handler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if handler.Path != "/certs" {
+		t.Errorf("Expected path /certs, got %s", handler.Path)
+	}
+}
+
+func TestCertsAdminParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  CertsAdmin
+	}{
+		{`certs_admin`, false, CertsAdmin{Path: DefaultPath}},
+		{`certs_admin /certs`, false, CertsAdmin{Path: "/certs"}},
+		{"certs_admin {\n allow_remote\n}", false, CertsAdmin{Path: DefaultPath, AllowRemote: true}},
+		{`certs_admin certs`, true, CertsAdmin{}},
+		{`certs_admin /a /b`, true, CertsAdmin{}},
+		{"certs_admin {\n allow_remote yes\n}", true, CertsAdmin{}},
+		{"certs_admin {\n token x\n}", true, CertsAdmin{}},
+		{"certs_admin\ncerts_admin /b", true, CertsAdmin{}},
+	} {
+		actual, err := certsAdminParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if actual != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
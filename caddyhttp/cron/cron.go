@@ -0,0 +1,182 @@
+// Package cron provides a directive that runs routine operational
+// tasks at times given like in a crontab: reloading the
+// configuration, rotating the logs, purging caches, taking the
+// site into and out of maintenance, and making HTTP requests.
+package cron
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Actions that can be scheduled.
+const (
+	// Reload loads the configuration again and applies it.
+	Reload = "reload"
+
+	// RotateLogs rolls over the logs that have a roller.
+	RotateLogs = "rotate_logs"
+
+	// PurgeCaches empties the caches of the server.
+	PurgeCaches = "purge_caches"
+
+	// MaintenanceOn takes the site into maintenance, during
+	// which it responds with 503 Service Unavailable.
+	MaintenanceOn = "maintenance_on"
+
+	// MaintenanceOff takes the site out of maintenance.
+	MaintenanceOff = "maintenance_off"
+
+	// SendRequest makes the HTTP request of the job.
+	SendRequest = "request"
+)
+
+// Job is an action and when it runs.
+type Job struct {
+	Spec   Spec
+	Action string
+
+	// Request is the request made by a SendRequest job
+	Request *Request
+}
+
+// Cron runs the jobs of a site.
+type Cron struct {
+	// Address of the site, whose maintenance the jobs toggle
+	Site string
+	Jobs []Job
+
+	stop <-chan struct{}
+}
+
+// run runs the jobs that are due each minute until stop is closed.
+func (c *Cron) run(stop <-chan struct{}) {
+	c.stop = stop
+	for {
+		next := now().Truncate(time.Minute).Add(time.Minute)
+		timer := time.NewTimer(next.Sub(now()))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		c.runDue(next)
+	}
+}
+
+// runDue runs the jobs that are due in the minute of t.
+func (c *Cron) runDue(t time.Time) {
+	for _, job := range c.Jobs {
+		if !job.Spec.Matches(t) {
+			continue
+		}
+		if job.Action == SendRequest {
+			// requests may take a while, with their retries,
+			// so they don't hold up the other jobs
+			go job.Request.run(c.Site, c.stop)
+			continue
+		}
+		c.runAction(job.Action, t)
+	}
+}
+
+// runAction runs action, which is due at t.
+func (c *Cron) runAction(action string, t time.Time) {
+	log.Printf("[INFO] %s: cron: %s", c.Site, action)
+	switch action {
+	case Reload:
+		// the reload shuts down the jobs it replaces,
+		// so it mustn't wait for them
+		go func() {
+			if err := reload(); err != nil {
+				log.Printf("[ERROR] %s: cron: reload: %v", c.Site, err)
+			}
+		}()
+	case RotateLogs:
+		if err := httpserver.RotateLogs(); err != nil {
+			log.Printf("[ERROR] %s: cron: rotating logs: %v", c.Site, err)
+		}
+	case PurgeCaches:
+		httpserver.PurgeCaches()
+	case MaintenanceOn:
+		setMaintenance(c.Site, c.nextMaintenanceOff(t))
+	case MaintenanceOff:
+		clearMaintenance(c.Site)
+	}
+}
+
+// nextMaintenanceOff returns when the site is next scheduled
+// to go out of maintenance after t, or the zero time if never.
+func (c *Cron) nextMaintenanceOff(t time.Time) time.Time {
+	var next time.Time
+	for _, job := range c.Jobs {
+		if job.Action != MaintenanceOff {
+			continue
+		}
+		if n := job.Spec.Next(t); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	return next
+}
+
+// Maintenance is middleware that responds with 503 Service
+// Unavailable while its site is in maintenance.
+type Maintenance struct {
+	Next httpserver.Handler
+	Site string
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (m Maintenance) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	until, ok := inMaintenance(m.Site)
+	if !ok {
+		return m.Next.ServeHTTP(w, r)
+	}
+	if !until.IsZero() {
+		if wait := until.Sub(now()); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+		}
+	}
+	return http.StatusServiceUnavailable, nil
+}
+
+// maintenance holds the sites in maintenance, by address, and
+// when they are scheduled to go out of it. It is kept when
+// the configuration is reloaded.
+var (
+	maintenance   = make(map[string]time.Time)
+	maintenanceMu sync.RWMutex
+)
+
+func setMaintenance(site string, until time.Time) {
+	maintenanceMu.Lock()
+	maintenance[site] = until
+	maintenanceMu.Unlock()
+}
+
+func clearMaintenance(site string) {
+	maintenanceMu.Lock()
+	delete(maintenance, site)
+	maintenanceMu.Unlock()
+}
+
+func inMaintenance(site string) (time.Time, bool) {
+	maintenanceMu.RLock()
+	defer maintenanceMu.RUnlock()
+	until, ok := maintenance[site]
+	return until, ok
+}
+
+// reload and now are variables so they can be mocked in tests.
+var (
+	reload = caddy.Reload
+	now    = time.Now
+)
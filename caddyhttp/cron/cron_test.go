@@ -0,0 +1,147 @@
+package cron
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestRunDue(t *testing.T) {
+	reloads := make(chan struct{}, 1)
+	defer func(r func() error) { reload = r }(reload)
+	reload = func() error {
+		reloads <- struct{}{}
+		return errors.New("no instance")
+	}
+	purged := make(chan struct{}, 1)
+	httpserver.RegisterCache("cron test", func() {
+		select {
+		case purged <- struct{}{}:
+		default:
+		}
+	})
+
+	every := func(spec string) Spec {
+		s, err := ParseSpec(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	c := &Cron{Site: "http://cron.example.com", Jobs: []Job{
+		{Spec: every("0 4 * * *"), Action: Reload},
+		{Spec: every("*/15 * * * *"), Action: PurgeCaches},
+		{Spec: every("0 2 * * 0"), Action: MaintenanceOn},
+		{Spec: every("30 2 * * 0"), Action: MaintenanceOff},
+	}}
+	defer clearMaintenance(c.Site)
+
+	// 4 AM on a Sunday
+	sunday := time.Date(2017, time.March, 5, 4, 0, 0, 0, time.Local)
+	c.runDue(sunday)
+	select {
+	case <-reloads:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected reload")
+	}
+	select {
+	case <-purged:
+	default:
+		t.Error("Expected caches to be purged")
+	}
+	if _, ok := inMaintenance(c.Site); ok {
+		t.Error("Expected site not to be in maintenance")
+	}
+
+	// into maintenance at 2 AM, until 2:30
+	c.runDue(sunday.Add(-2 * time.Hour))
+	until, ok := inMaintenance(c.Site)
+	if !ok || !until.Equal(sunday.Add(-90*time.Minute)) {
+		t.Errorf("Expected maintenance until 2:30, got %v %v", until, ok)
+	}
+	c.runDue(sunday.Add(-90 * time.Minute))
+	if _, ok := inMaintenance(c.Site); ok {
+		t.Error("Expected site to be out of maintenance")
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	current := time.Date(2017, time.March, 5, 2, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	m := Maintenance{Next: httpserver.EmptyNext, Site: "http://maintained.example.com"}
+	serve := func() (int, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		status, _ := m.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return status, w
+	}
+	if status, _ := serve(); status == http.StatusServiceUnavailable {
+		t.Error("Expected site not to be in maintenance")
+	}
+
+	setMaintenance(m.Site, current.Add(30*time.Minute))
+	defer clearMaintenance(m.Site)
+	status, w := serve()
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", status)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1800" {
+		t.Errorf("Expected Retry-After of 1800 seconds, got '%s'", got)
+	}
+
+	// without a scheduled end, there's no Retry-After
+	setMaintenance(m.Site, time.Time{})
+	if status, w := serve(); status != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "" {
+		t.Errorf("Expected 503 without Retry-After, got %d '%s'", status, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestRequestJob(t *testing.T) {
+	defer func(w time.Duration) { retryWait = w }(retryWait)
+	retryWait = time.Millisecond
+
+	hits := make(chan *http.Request, 10)
+	var fail int32 = 2
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits <- r
+		if atomic.AddInt32(&fail, -1) >= 0 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer backend.Close()
+
+	req, err := newRequest([]string{"post", backend.URL + "/warm", "header=X-Token: abc", "retries=2", "jitter=1ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.run("http://cron.example.com", nil)
+	if len(hits) != 3 {
+		t.Fatalf("Expected 2 retries, got %d requests", len(hits))
+	}
+	r := <-hits
+	if r.Method != "POST" || r.URL.Path != "/warm" || r.Header.Get("X-Token") != "abc" {
+		t.Errorf("Expected the configured request, got %s %s %v", r.Method, r.URL.Path, r.Header)
+	}
+
+	// a request still running when it is due again is skipped
+	req.running = 1
+	req.run("http://cron.example.com", nil)
+	if len(hits) != 2 {
+		t.Errorf("Expected no request while one is running, got %d", len(hits)-2)
+	}
+	req.running = 0
+
+	if status, err := req.do(); err != nil || status != http.StatusOK {
+		t.Errorf("Expected 200, got %d %v", status, err)
+	}
+	req.Expect = http.StatusNoContent
+	if _, err := req.do(); err == nil {
+		t.Error("Expected an error for an unexpected status")
+	}
+}
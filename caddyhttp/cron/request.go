@@ -0,0 +1,177 @@
+package cron
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Request is an HTTP request that a job makes, such as to keep
+// a service warm, to warm a cache or to ping a webhook.
+type Request struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   string
+
+	// Jitter is the most the request is delayed by, at random,
+	// so that requests scheduled alike do not all go at once
+	Jitter time.Duration
+
+	// Retries is how many times a failed request is tried
+	// again, waiting twice as long before each
+	Retries int
+
+	// Timeout is how long each try may take
+	Timeout time.Duration
+
+	// Expect is the status of a successful response;
+	// if 0, any status below 400
+	Expect int
+
+	running int32 // 1 while the request is being made
+}
+
+// retryWait is how long to wait before the first retry.
+var retryWait = 1 * time.Second
+
+// newRequest parses the arguments of a request job, which are
+// the method, the URL and options of the form key=value: header
+// (which may be repeated, as Name:value), body, jitter, retries,
+// timeout and expect.
+func newRequest(args []string) (*Request, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("request needs a method and a URL")
+	}
+	req := &Request{
+		Method:  strings.ToUpper(args[0]),
+		URL:     args[1],
+		Header:  make(http.Header),
+		Timeout: defaultRequestTimeout,
+	}
+	if !strings.HasPrefix(req.URL, "http://") && !strings.HasPrefix(req.URL, "https://") {
+		return nil, fmt.Errorf("invalid URL '%s'", req.URL)
+	}
+	for _, arg := range args[2:] {
+		eq := strings.Index(arg, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid option '%s'", arg)
+		}
+		key, value := arg[:eq], arg[eq+1:]
+		var err error
+		switch key {
+		case "header":
+			colon := strings.Index(value, ":")
+			if colon < 1 {
+				return nil, fmt.Errorf("invalid header '%s'", value)
+			}
+			req.Header.Add(value[:colon], strings.TrimSpace(value[colon+1:]))
+		case "body":
+			req.Body = value
+		case "jitter":
+			req.Jitter, err = time.ParseDuration(value)
+			if err == nil && req.Jitter < 0 {
+				err = fmt.Errorf("negative")
+			}
+		case "retries":
+			req.Retries, err = strconv.Atoi(value)
+			if err == nil && req.Retries < 0 {
+				err = fmt.Errorf("negative")
+			}
+		case "timeout":
+			req.Timeout, err = time.ParseDuration(value)
+			if err == nil && req.Timeout <= 0 {
+				err = fmt.Errorf("not positive")
+			}
+		case "expect":
+			req.Expect, err = strconv.Atoi(value)
+			if err == nil && (req.Expect < 100 || req.Expect > 599) {
+				err = fmt.Errorf("not a status")
+			}
+		default:
+			return nil, fmt.Errorf("unknown option '%s'", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s': %v", key, value, err)
+		}
+	}
+	return req, nil
+}
+
+// run makes the request after a random delay of up to Jitter,
+// retrying it if it fails, unless stop is closed first. A request
+// that is still being made when it is due again is skipped.
+func (r *Request) run(site string, stop <-chan struct{}) {
+	if !atomic.CompareAndSwapInt32(&r.running, 0, 1) {
+		log.Printf("[WARNING] %s: cron: %s %s is still running; skipped", site, r.Method, r.URL)
+		return
+	}
+	defer atomic.StoreInt32(&r.running, 0)
+
+	wait := time.Duration(0)
+	if r.Jitter > 0 {
+		wait = time.Duration(rand.Int63n(int64(r.Jitter)))
+	}
+	for try := 0; ; try++ {
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		start := time.Now()
+		status, err := r.do()
+		if err == nil {
+			log.Printf("[INFO] %s: cron: %s %s: %d in %v", site, r.Method, r.URL, status, time.Since(start))
+			return
+		}
+		if try >= r.Retries {
+			log.Printf("[ERROR] %s: cron: %s %s: %v", site, r.Method, r.URL, err)
+			return
+		}
+		log.Printf("[WARNING] %s: cron: %s %s: %v; retrying", site, r.Method, r.URL, err)
+		wait = retryWait << uint(try)
+	}
+}
+
+// do makes the request once, and returns the status of
+// the response, or an error if it was not successful.
+func (r *Request) do() (int, error) {
+	var body io.Reader
+	if r.Body != "" {
+		body = strings.NewReader(r.Body)
+	}
+	req, err := http.NewRequest(r.Method, r.URL, body)
+	if err != nil {
+		return 0, err
+	}
+	for name, values := range r.Header {
+		req.Header[name] = values
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	client := http.Client{Timeout: r.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if r.Expect != 0 && resp.StatusCode != r.Expect || r.Expect == 0 && resp.StatusCode >= 400 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+const defaultRequestTimeout = 30 * time.Second
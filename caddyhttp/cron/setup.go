@@ -0,0 +1,104 @@
+package cron
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("cron", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures the jobs of a site, and a Maintenance
+// middleware instance if they toggle maintenance.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+	jobs, err := cronParse(c)
+	if err != nil {
+		return err
+	}
+	cron := &Cron{Site: cfg.Addr.String(), Jobs: jobs}
+
+	stop := make(chan struct{})
+	c.OnStartup(func() error {
+		go cron.run(stop)
+		return nil
+	})
+	c.OnShutdown(func() error {
+		close(stop)
+		return nil
+	})
+
+	for _, job := range jobs {
+		if job.Action == MaintenanceOn {
+			cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+				return Maintenance{Next: next, Site: cron.Site}
+			})
+			break
+		}
+	}
+	return nil
+}
+
+// cronParse parses the cron directive, which has the form
+//
+//	cron {
+//	    "schedule" action
+//	    "schedule" request method url [key=value...]
+//	}
+//
+// where the schedule is in the format of crontab, like
+// "0 4 * * *" for 4 AM every day, in local time, and the
+// action is reload, rotate_logs, purge_caches, maintenance_on
+// or maintenance_off. Reloads, log rotations and cache purges
+// apply to the whole server; maintenance only to the site,
+// which then responds with 503 Service Unavailable. A request
+// job makes an HTTP request; its options are header=Name:value,
+// which may be repeated, body, jitter, retries, timeout (30s by
+// default) and expect, the status it should respond with, which
+// is any below 400 by default.
+func cronParse(c *caddy.Controller) ([]Job, error) {
+	var jobs []Job
+	var seen bool
+	for c.Next() {
+		if seen {
+			return nil, c.Err("cron: can only be specified once per site")
+		}
+		seen = true
+		if len(c.RemainingArgs()) != 0 {
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			spec, err := ParseSpec(c.Val())
+			if err != nil {
+				return nil, c.Errf("cron: invalid schedule '%s': %v", c.Val(), err)
+			}
+			args := c.RemainingArgs()
+			if len(args) > 0 && args[0] == SendRequest {
+				req, err := newRequest(args[1:])
+				if err != nil {
+					return nil, c.Errf("cron: %v", err)
+				}
+				jobs = append(jobs, Job{Spec: spec, Action: SendRequest, Request: req})
+				continue
+			}
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			switch args[0] {
+			case Reload, RotateLogs, PurgeCaches, MaintenanceOn, MaintenanceOff:
+			default:
+				return nil, c.Errf("cron: unknown action '%s'", args[0])
+			}
+			jobs = append(jobs, Job{Spec: spec, Action: args[0]})
+		}
+	}
+	if len(jobs) == 0 {
+		return nil, c.Err("cron: no jobs")
+	}
+	return jobs, nil
+}
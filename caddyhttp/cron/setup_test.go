@@ -0,0 +1,93 @@
+package cron
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `cron {
+		"0 2 * * 0"  maintenance_on
+		"30 2 * * 0" maintenance_off
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) != 1 {
+		t.Fatalf("Expected 1 middleware, had %d instead", len(mids))
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Maintenance)
+	if !ok {
+		t.Fatalf("Expected handler to be type Maintenance, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+
+	// jobs that don't toggle maintenance add no middleware
+	c = caddy.NewTestController("http", "cron {\n \"0 4 * * *\" reload\n}")
+	if err := setup(c); err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	if mids := httpserver.GetConfig(c).Middleware(); len(mids) != 0 {
+		t.Errorf("Expected no middleware, had %d", len(mids))
+	}
+}
+
+func TestCronParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []string
+	}{
+		{`cron {
+			"0 4 * * *"    reload
+			"0 0 * * *"    rotate_logs
+			"*/15 * * * *" purge_caches
+		}`, false, []string{Reload, RotateLogs, PurgeCaches}},
+		{`cron {
+			"*/5 * * * *" request GET https://example.com/health jitter=30s retries=3 expect=200
+			"0 * * * *"   request POST http://localhost/hook header=Content-Type:application/json body={}
+		}`, false, []string{SendRequest, SendRequest}},
+		{"cron {\n \"0 4 * * *\" request GET\n}", true, nil},
+		{"cron {\n \"0 4 * * *\" request GET example.com\n}", true, nil},
+		{"cron {\n \"0 4 * * *\" request GET http://example.com jitter\n}", true, nil},
+		{"cron {\n \"0 4 * * *\" request GET http://example.com retries=-1\n}", true, nil},
+		{"cron {\n \"0 4 * * *\" request GET http://example.com expect=2000\n}", true, nil},
+		{"cron {\n \"0 4 * * *\" request GET http://example.com header=nocolon\n}", true, nil},
+		{"cron {\n \"0 4 * * *\" request GET http://example.com when=now\n}", true, nil},
+		{`cron`, true, nil},
+		{`cron reload`, true, nil},
+		{"cron {\n \"0 4 * *\" reload\n}", true, nil},
+		{"cron {\n \"0 4 * * *\"\n}", true, nil},
+		{"cron {\n \"0 4 * * *\" restart\n}", true, nil},
+		{"cron {\n \"0 4 * * *\" reload now\n}", true, nil},
+		{"cron {\n \"0 4 * * *\" reload\n}\ncron {\n \"0 5 * * *\" reload\n}", true, nil},
+	}
+	for i, test := range tests {
+		jobs, err := cronParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if len(jobs) != len(test.expected) {
+			t.Fatalf("Test %d: Expected %d jobs, got %d", i, len(test.expected), len(jobs))
+		}
+		for j, job := range jobs {
+			if job.Action != test.expected[j] {
+				t.Errorf("Test %d, job %d: Expected action %s, got %s", i, j, test.expected[j], job.Action)
+			}
+		}
+	}
+}
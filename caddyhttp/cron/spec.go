@@ -0,0 +1,129 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spec is a schedule in the format of crontab: the minutes,
+// hours, days of the month, months and days of the week
+// (0 or 7 is Sunday) at which something happens.
+type Spec struct {
+	minute, hour, dom, month, dow uint64 // bit sets
+
+	// whether days of the month or of the week are
+	// restricted; if both are, either one matches
+	domRestricted, dowRestricted bool
+}
+
+// ParseSpec parses a crontab schedule like "30 4 * * 1-5". Each
+// of the five fields is *, or a list of numbers and ranges like
+// 1-5, which may be followed by a step like */15 or 0-30/10.
+func ParseSpec(s string) (Spec, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return Spec{}, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+	var spec Spec
+	var err error
+	if spec.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return Spec{}, fmt.Errorf("minute: %v", err)
+	}
+	if spec.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return Spec{}, fmt.Errorf("hour: %v", err)
+	}
+	if spec.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return Spec{}, fmt.Errorf("day of month: %v", err)
+	}
+	if spec.month, err = parseField(fields[3], 1, 12); err != nil {
+		return Spec{}, fmt.Errorf("month: %v", err)
+	}
+	if spec.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return Spec{}, fmt.Errorf("day of week: %v", err)
+	}
+	if spec.dow&(1<<7) != 0 {
+		spec.dow |= 1 // Sunday
+	}
+	spec.domRestricted = fields[2] != "*"
+	spec.dowRestricted = fields[4] != "*"
+	return spec, nil
+}
+
+// parseField parses a field whose values are from min to max.
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in '%s'", part)
+			}
+			part = part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid value '%s'", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value '%s'", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+			if lo < min || hi > max || lo > hi {
+				return 0, fmt.Errorf("'%s' is out of range %d-%d", part, min, max)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Matches returns whether t is in a minute of the schedule.
+func (s Spec) Matches(t time.Time) bool {
+	return s.minute&(1<<uint(t.Minute())) != 0 &&
+		s.hour&(1<<uint(t.Hour())) != 0 &&
+		s.dayMatches(t)
+}
+
+// dayMatches returns whether t is on a day of the schedule.
+func (s Spec) dayMatches(t time.Time) bool {
+	if s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// Next returns the first minute of the schedule after t, or
+// the zero time if there is none within the next five years.
+func (s Spec) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for end := t.AddDate(5, 0, 0); t.Before(end); {
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.Matches(t) {
+			return t
+		}
+		t = t.Add(time.Minute)
+	}
+	return time.Time{}
+}
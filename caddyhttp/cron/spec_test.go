@@ -0,0 +1,85 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSpec(t *testing.T) {
+	for i, test := range []struct {
+		spec      string
+		shouldErr bool
+	}{
+		{"* * * * *", false},
+		{"0 4 * * *", false},
+		{"*/15 9-17 * * 1-5", false},
+		{"0,30 0 1,15 */2 7", false},
+		{"5/10 * * * *", false},
+		{"* * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * 8", true},
+		{"5-1 * * * *", true},
+		{"*/0 * * * *", true},
+		{"a * * * *", true},
+	} {
+		_, err := ParseSpec(test.spec)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error for '%s', got none", i, test.spec)
+		}
+		if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error for '%s', got: %v", i, test.spec, err)
+		}
+	}
+}
+
+func TestSpecMatches(t *testing.T) {
+	// Monday, March 6, 2017
+	monday := time.Date(2017, time.March, 6, 9, 30, 0, 0, time.UTC)
+	for i, test := range []struct {
+		spec   string
+		t      time.Time
+		expect bool
+	}{
+		{"* * * * *", monday, true},
+		{"30 9 * * *", monday, true},
+		{"30 9 * * *", monday.Add(time.Minute), false},
+		{"*/15 9-17 * * 1-5", monday, true},
+		{"*/15 9-17 * * 1-5", monday.AddDate(0, 0, 5), false}, // Saturday
+		{"0 0 * * 0", time.Date(2017, time.March, 5, 0, 0, 0, 0, time.UTC), true},
+		{"0 0 * * 7", time.Date(2017, time.March, 5, 0, 0, 0, 0, time.UTC), true},
+		{"30 9 1 * 1", monday, true},                          // day of month or of week
+		{"30 9 6 * 2", monday, true},                          // day of month or of week
+		{"30 9 1 * 2", monday, false},                         // neither
+		{"30 9 * 4 *", monday, false},                         // month
+		{"5/10 * * * *", monday.Add(-15 * time.Minute), true}, // 9:15
+	} {
+		spec, err := ParseSpec(test.spec)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if got := spec.Matches(test.t); got != test.expect {
+			t.Errorf("Test %d: Expected '%s' matching %v to be %v, got %v", i, test.spec, test.t, test.expect, got)
+		}
+	}
+}
+
+func TestSpecNext(t *testing.T) {
+	start := time.Date(2017, time.March, 6, 9, 30, 20, 0, time.UTC)
+	for i, test := range []struct {
+		spec   string
+		expect time.Time
+	}{
+		{"* * * * *", time.Date(2017, time.March, 6, 9, 31, 0, 0, time.UTC)},
+		{"30 9 * * *", time.Date(2017, time.March, 7, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		spec, _ := ParseSpec(test.spec)
+		if got := spec.Next(start); !got.Equal(test.expect) {
+			t.Errorf("Test %d: Expected next of '%s' to be %v, got %v", i, test.spec, test.expect, got)
+		}
+	}
+}
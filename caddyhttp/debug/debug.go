@@ -0,0 +1,103 @@
+// Package debug provides middleware that echoes back how a request
+// was parsed and routed, to help debug the interactions of rewrites,
+// proxies and the like.
+package debug
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// DefaultPath is the path at which requests are echoed by default.
+const DefaultPath = "/debug/request"
+
+// Debug is middleware that responds to requests for Path
+// with a description of the request.
+type Debug struct {
+	Next httpserver.Handler
+	Path string
+	Site *httpserver.SiteConfig
+}
+
+// Echo is how a request was parsed and routed.
+type Echo struct {
+	Method           string   `json:"method"`
+	RequestURI       string   `json:"request_uri"`
+	Path             string   `json:"path"`
+	Query            string   `json:"query"`
+	Proto            string   `json:"proto"`
+	Host             string   `json:"host"`
+	RemoteAddr       string   `json:"remote_addr"`
+	Headers          []string `json:"headers"`
+	ContentLength    int64    `json:"content_length"`
+	TransferEncoding []string `json:"transfer_encoding"`
+	BodyLength       int64    `json:"body_length"`
+	BodyError        string   `json:"body_error,omitempty"`
+	TLSServerName    string   `json:"tls_server_name,omitempty"`
+	Site             string   `json:"site"`
+	Middleware       []string `json:"middleware"`
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (d Debug) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !httpserver.Path(r.URL.Path).Matches(d.Path) {
+		return d.Next.ServeHTTP(w, r)
+	}
+
+	echo := Echo{
+		Method:           r.Method,
+		RequestURI:       r.RequestURI,
+		Path:             r.URL.Path,
+		Query:            r.URL.RawQuery,
+		Proto:            r.Proto,
+		Host:             r.Host,
+		RemoteAddr:       r.RemoteAddr,
+		Headers:          headerList(r.Header),
+		ContentLength:    r.ContentLength,
+		TransferEncoding: r.TransferEncoding,
+		Site:             d.Site.Addr.String(),
+		Middleware:       d.Site.Directives,
+	}
+	if r.TLS != nil {
+		echo.TLSServerName = r.TLS.ServerName
+	}
+	if r.Body != nil {
+		n, err := io.Copy(ioutil.Discard, r.Body)
+		echo.BodyLength = n
+		if err != nil {
+			echo.BodyError = err.Error()
+		}
+	}
+
+	body, err := json.MarshalIndent(echo, "", "  ")
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(append(body, '\n'))
+	return 0, nil
+}
+
+// headerList returns the fields of h as "Name: value"
+// lines, sorted by name; a field given several times
+// has a line for each value, in the order received.
+func headerList(h http.Header) []string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, name := range names {
+		for _, value := range h[name] {
+			lines = append(lines, name+": "+value)
+		}
+	}
+	return lines
+}
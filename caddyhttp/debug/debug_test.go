@@ -0,0 +1,69 @@
+package debug
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestDebug(t *testing.T) {
+	d := Debug{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Path: DefaultPath,
+		Site: &httpserver.SiteConfig{
+			Addr:       httpserver.Address{Original: "example.com", Host: "example.com"},
+			Directives: []string{"rewrite", "debug", "proxy"},
+		},
+	}
+
+	r := httptest.NewRequest("POST", "https://example.com/debug/request/x?a=1", strings.NewReader("hello"))
+	r.Header.Add("X-Forwarded-For", "10.0.0.1")
+	r.Header.Add("X-Forwarded-For", "10.0.0.2")
+	r.Header.Set("Accept", "*/*")
+	r.TLS = &tls.ConnectionState{ServerName: "example.com"}
+	w := httptest.NewRecorder()
+	status, err := d.ServeHTTP(w, r)
+	if status != 0 || err != nil {
+		t.Fatalf("Expected response to be written, got %d %v", status, err)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Expected JSON response, got Content-Type %s", ct)
+	}
+
+	var echo Echo
+	if err := json.Unmarshal(w.Body.Bytes(), &echo); err != nil {
+		t.Fatal(err)
+	}
+	expected := Echo{
+		Method:        "POST",
+		RequestURI:    "https://example.com/debug/request/x?a=1",
+		Path:          "/debug/request/x",
+		Query:         "a=1",
+		Proto:         "HTTP/1.1",
+		Host:          "example.com",
+		RemoteAddr:    r.RemoteAddr,
+		Headers:       []string{"Accept: */*", "X-Forwarded-For: 10.0.0.1", "X-Forwarded-For: 10.0.0.2"},
+		ContentLength: 5,
+		BodyLength:    5,
+		TLSServerName: "example.com",
+		Site:          "http://example.com",
+		Middleware:    []string{"rewrite", "debug", "proxy"},
+	}
+	if !reflect.DeepEqual(echo, expected) {
+		t.Errorf("Expected echo\n%+v\ngot\n%+v", expected, echo)
+	}
+
+	// other requests are passed on
+	w = httptest.NewRecorder()
+	if status, _ := d.ServeHTTP(w, httptest.NewRequest("GET", "/debug", nil)); status != http.StatusTeapot {
+		t.Errorf("Expected request to be passed on, got status %d", status)
+	}
+}
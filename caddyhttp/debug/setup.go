@@ -0,0 +1,63 @@
+package debug
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("debug", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
+	})
+}
+
+// setup configures a new Debug middleware instance. Syntax:
+//
+//	debug [path]
+//
+// Requests for path (/debug/request by default) are answered
+// with a JSON description of the request as it reaches the
+// directive, after normalization and rewrites: its method,
+// path, headers, body length, and the site and directives
+// that serve it. Other requests are passed through.
+func setup(c *caddy.Controller) error {
+	path, err := debugParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Debug{Next: next, Path: path, Site: cfg}
+	})
+	return nil
+}
+
+func debugParse(c *caddy.Controller) (string, error) {
+	path := DefaultPath
+	var seen bool
+	for c.Next() {
+		if seen {
+			return "", c.Err("debug: can only be specified once per site")
+		}
+		seen = true
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			if args[0] == "" || args[0][0] != '/' {
+				return "", c.Errf("debug: invalid path '%s'", args[0])
+			}
+			path = args[0]
+		default:
+			return "", c.ArgErr()
+		}
+		if c.NextBlock() {
+			return "", c.ArgErr()
+		}
+	}
+	return path, nil
+}
@@ -0,0 +1,62 @@
+package debug
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `debug /echo`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler, ok := mids[0](httpserver.EmptyNext).(Debug)
+	if !ok {
+		t.Fatalf("Expected handler to be type Debug, got: %#v", mids[0](httpserver.EmptyNext))
+	}
+	if !httpserver.SameNext(handler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if handler.Path != "/echo" {
+		t.Errorf("Expected path /echo, got %s", handler.Path)
+	}
+	if handler.Site != httpserver.GetConfig(c) {
+		t.Error("Expected handler to have the site's config")
+	}
+}
+
+func TestDebugParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		path      string
+	}{
+		{`debug`, false, DefaultPath},
+		{`debug /echo`, false, "/echo"},
+		{`debug echo`, true, ""},
+		{`debug /a /b`, true, ""},
+		{"debug {\n foo\n}", true, ""},
+		{"debug\ndebug /b", true, ""},
+	} {
+		path, err := debugParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if path != test.path {
+			t.Errorf("Test %d: Expected path '%s', got '%s'", i, test.path, path)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Package defaultserver configures what a listener does with
+// requests and TLS handshakes for hosts that match none of its sites.
+package defaultserver
+
+import (
+	"strconv"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("default_server", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupDefaultServer,
+	})
+}
+
+// setupDefaultServer configures the default server of the site's
+// listener. Syntax:
+//
+//	default_server [close | status code | redirect to]
+//
+// Without arguments, the site serves requests for unknown hosts,
+// and its certificate is used for handshakes with unknown names.
+// With close, such connections are closed and such handshakes
+// fail. With status or redirect, such requests get the status
+// code or a redirect (which may use placeholders).
+func setupDefaultServer(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+
+	for c.Next() {
+		if config.DefaultServer != nil {
+			return c.Err("default_server can only be specified once per site")
+		}
+		ds, err := parseDefaultServer(c)
+		if err != nil {
+			return err
+		}
+		config.DefaultServer = ds
+		switch ds.Mode {
+		case httpserver.DefaultServerSite:
+			config.TLS.DefaultServer = true
+		case httpserver.DefaultServerClose:
+			config.TLS.RejectUnknownSNI = true
+		}
+	}
+
+	return nil
+}
+
+func parseDefaultServer(c *caddy.Controller) (*httpserver.DefaultServer, error) {
+	args := c.RemainingArgs()
+	if len(args) == 0 {
+		return &httpserver.DefaultServer{Mode: httpserver.DefaultServerSite}, nil
+	}
+
+	ds := &httpserver.DefaultServer{Mode: args[0]}
+	switch args[0] {
+	case httpserver.DefaultServerClose:
+		if len(args) != 1 {
+			return nil, c.ArgErr()
+		}
+	case httpserver.DefaultServerStatus:
+		if len(args) != 2 {
+			return nil, c.ArgErr()
+		}
+		code, err := strconv.Atoi(args[1])
+		if err != nil || code < 100 || code > 999 {
+			return nil, c.Errf("invalid status code '%s'", args[1])
+		}
+		ds.Status = code
+	case httpserver.DefaultServerRedirect:
+		if len(args) != 2 {
+			return nil, c.ArgErr()
+		}
+		ds.RedirectTo = args[1]
+	default:
+		return nil, c.Errf("unknown default_server mode '%s'", args[0])
+	}
+	return ds, nil
+}
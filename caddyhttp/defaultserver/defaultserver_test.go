@@ -0,0 +1,53 @@
+package defaultserver
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupDefaultServer(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  httpserver.DefaultServer
+		tlsDflt   bool
+		tlsReject bool
+	}{
+		{`default_server`, false, httpserver.DefaultServer{Mode: "site"}, true, false},
+		{`default_server close`, false, httpserver.DefaultServer{Mode: "close"}, false, true},
+		{`default_server status 404`, false, httpserver.DefaultServer{Mode: "status", Status: 404}, false, false},
+		{`default_server redirect https://example.com{uri}`, false, httpserver.DefaultServer{Mode: "redirect", RedirectTo: "https://example.com{uri}"}, false, false},
+		{`default_server close now`, true, httpserver.DefaultServer{}, false, false},
+		{`default_server status`, true, httpserver.DefaultServer{}, false, false},
+		{`default_server status abc`, true, httpserver.DefaultServer{}, false, false},
+		{`default_server status 42`, true, httpserver.DefaultServer{}, false, false},
+		{`default_server redirect`, true, httpserver.DefaultServer{}, false, false},
+		{`default_server ignore`, true, httpserver.DefaultServer{}, false, false},
+		{"default_server\ndefault_server close", true, httpserver.DefaultServer{}, false, false},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setupDefaultServer(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		cfg := httpserver.GetConfig(c)
+		if cfg.DefaultServer == nil || *cfg.DefaultServer != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, cfg.DefaultServer)
+		}
+		if cfg.TLS.DefaultServer != test.tlsDflt {
+			t.Errorf("Test %d: Expected TLS DefaultServer %v, got %v", i, test.tlsDflt, cfg.TLS.DefaultServer)
+		}
+		if cfg.TLS.RejectUnknownSNI != test.tlsReject {
+			t.Errorf("Test %d: Expected TLS RejectUnknownSNI %v, got %v", i, test.tlsReject, cfg.TLS.RejectUnknownSNI)
+		}
+	}
+}
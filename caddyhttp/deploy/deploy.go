@@ -0,0 +1,290 @@
+// Package deploy provides middleware that serves an API to publish
+// the content of a site: an archive is uploaded, signed with a shared
+// secret, and swapped in as the site root in one step, so that CI can
+// deploy to the server without SFTP or SCP.
+package deploy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// DefaultPath is the path of the API by default.
+const DefaultPath = "/deploy"
+
+// SignatureHeader is the request header with the signature, as
+// sha256=HEX, an HMAC-SHA256 keyed with the secret of the timestamp,
+// the method and the path of the request, each followed by a newline,
+// and then of the body.
+const SignatureHeader = "X-Deploy-Signature"
+
+// TimestampHeader is the request header with the Unix time at which
+// the request was signed. Requests signed more than maxClockSkew
+// before or after the time of the server are refused, and so are
+// signatures that were accepted before, so requests cannot be replayed.
+const TimestampHeader = "X-Deploy-Timestamp"
+
+// Deploy is middleware that serves the API at Path:
+//
+//	GET  {path}           lists the releases
+//	POST {path}           publishes the archive in the body
+//	POST {path}/rollback  goes back to the release named in
+//	                      the body, or else to the previous one
+//
+// Every request must be signed, and recently; the archive may be a tar file,
+// gzipped or not, or a zip file. Each archive becomes a release,
+// a directory in Releases, and Root is a symbolic link that is
+// replaced to point to the current release.
+type Deploy struct {
+	Next httpserver.Handler
+	Path string
+
+	// Secret is the key of the signatures
+	Secret []byte
+
+	// Root is the site root, which is replaced
+	Root string
+
+	// Releases is the directory the releases are kept in
+	Releases string
+
+	// Keep is how many releases before the current
+	// one are kept, to be rolled back to
+	Keep int
+
+	// MaxSize is the most an archive may be,
+	// and also what is in it
+	MaxSize int64
+}
+
+// State is the state of the releases, as the API reports it.
+type State struct {
+	Current  string   `json:"current"`
+	Releases []string `json:"releases"`
+}
+
+// deploying is held while releases are changed, so that
+// deploys and rollbacks happen one at a time.
+var deploying sync.Mutex
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (d Deploy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !httpserver.Path(r.URL.Path).Matches(d.Path) {
+		return d.Next.ServeHTTP(w, r)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, d.Path), "/") {
+	case "":
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			if _, ok := d.readSigned(w, r); !ok {
+				return http.StatusUnauthorized, nil
+			}
+			deploying.Lock()
+			state, err := d.state()
+			deploying.Unlock()
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
+			return httpserver.WriteJSONResponse(w, http.StatusOK, state)
+		case http.MethodPost:
+			return d.publish(w, r)
+		}
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		return http.StatusMethodNotAllowed, nil
+	case "rollback":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			return http.StatusMethodNotAllowed, nil
+		}
+		body, ok := d.readSigned(w, r)
+		if !ok {
+			return http.StatusUnauthorized, nil
+		}
+		return d.rollback(w, strings.TrimSpace(string(body)))
+	}
+	return http.StatusNotFound, nil
+}
+
+// publish receives the archive in the body of r, and
+// makes it the current release if its signature is valid.
+func (d Deploy) publish(w http.ResponseWriter, r *http.Request) (int, error) {
+	deploying.Lock()
+	defer deploying.Unlock()
+	if err := d.prepare(); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// the archive is kept aside until it is known to be signed
+	archive, err := ioutil.TempFile(d.Releases, ".upload-")
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+	mac := d.mac(r)
+	size, err := io.Copy(io.MultiWriter(archive, mac), http.MaxBytesReader(w, r.Body, d.MaxSize))
+	if err != nil {
+		if _, ok := err.(*os.PathError); ok {
+			return http.StatusInternalServerError, err
+		}
+		httpserver.WriteTextResponse(w, http.StatusRequestEntityTooLarge, "archive too large or incomplete\n")
+		return 0, nil
+	}
+	if !d.validSignature(r, mac) {
+		return http.StatusUnauthorized, nil
+	}
+
+	release, err := d.unpack(archive, size)
+	if err != nil {
+		if _, ok := err.(archiveError); ok {
+			httpserver.WriteTextResponse(w, http.StatusBadRequest, err.Error()+"\n")
+			return 0, nil
+		}
+		return http.StatusInternalServerError, err
+	}
+	if err := d.activate(release); err != nil {
+		os.RemoveAll(d.release(release))
+		return http.StatusInternalServerError, err
+	}
+	return d.respond(w, http.StatusCreated)
+}
+
+// rollback makes the release named name current,
+// or the one before the current one if name is empty.
+func (d Deploy) rollback(w http.ResponseWriter, name string) (int, error) {
+	deploying.Lock()
+	defer deploying.Unlock()
+	state, err := d.state()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if name == "" {
+		for _, release := range state.Releases {
+			if release >= state.Current {
+				break
+			}
+			name = release
+		}
+		if name == "" {
+			httpserver.WriteTextResponse(w, http.StatusConflict, "no release to roll back to\n")
+			return 0, nil
+		}
+	}
+	var found bool
+	for _, release := range state.Releases {
+		found = found || release == name
+	}
+	if !found {
+		httpserver.WriteTextResponse(w, http.StatusNotFound, "no release named '"+name+"'\n")
+		return 0, nil
+	}
+	if err := d.activate(name); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return d.respond(w, http.StatusOK)
+}
+
+// respond purges caches, which may hold the content of the
+// release that was replaced, and writes the new state.
+func (d Deploy) respond(w http.ResponseWriter, status int) (int, error) {
+	httpserver.PurgeCaches()
+	if err := d.prune(); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	state, err := d.state()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return httpserver.WriteJSONResponse(w, status, state)
+}
+
+// mac returns the MAC of r, which the body of r is to be written to.
+func (d Deploy) mac(r *http.Request) hash.Hash {
+	mac := hmac.New(sha256.New, d.Secret)
+	io.WriteString(mac, r.Header.Get(TimestampHeader)+"\n"+r.Method+"\n"+r.URL.Path+"\n")
+	return mac
+}
+
+// validSignature returns whether the signature of r is mac,
+// which has been written the body of r, and r is recent and
+// was not accepted before.
+func (d Deploy) validSignature(r *http.Request, mac hash.Hash) bool {
+	ts, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return false
+	}
+	signed, now := time.Unix(ts, 0), time.Now()
+	if signed.Before(now.Add(-maxClockSkew)) || signed.After(now.Add(maxClockSkew)) {
+		return false
+	}
+	sig := r.Header.Get(SignatureHeader)
+	if !strings.HasPrefix(sig, "sha256=") {
+		return false
+	}
+	given, err := hex.DecodeString(strings.TrimPrefix(sig, "sha256="))
+	if err != nil || !hmac.Equal(given, mac.Sum(nil)) {
+		return false
+	}
+	return accepted.first(string(given), signed.Add(maxClockSkew), now)
+}
+
+// signatures are the signatures that were accepted, until
+// the requests they signed are too old to be accepted anyway.
+type signatures struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+var accepted = &signatures{expires: make(map[string]time.Time)}
+
+// first records that sig, which expires at expires, is
+// accepted at now, and returns whether it was not before.
+func (s *signatures) first(sig string, expires, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for seen, exp := range s.expires {
+		if now.After(exp) {
+			delete(s.expires, seen)
+		}
+	}
+	if _, ok := s.expires[sig]; ok {
+		return false
+	}
+	s.expires[sig] = expires
+	return true
+}
+
+// readSigned reads the body of r, which is small, and
+// returns it and whether it is signed.
+func (d Deploy) readSigned(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxCommandSize))
+	if err != nil {
+		return nil, false
+	}
+	mac := d.mac(r)
+	mac.Write(body)
+	return body, d.validSignature(r, mac)
+}
+
+const (
+	// maxCommandSize is the size limit of bodies other than archives.
+	maxCommandSize = 1 << 10
+
+	// maxClockSkew is how long before or after
+	// the time of the server requests may be signed.
+	maxClockSkew = 5 * time.Minute
+)
@@ -0,0 +1,244 @@
+package deploy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// sign signs req, which has body, with secret as signed at t.
+func sign(req *http.Request, secret, body []byte, t time.Time) {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "\n" + req.Method + "\n" + req.URL.Path + "\n"))
+	mac.Write(body)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+func makeTar(t *testing.T, gzipped bool, files map[string]string) []byte {
+	var buf bytes.Buffer
+	var tw *tar.Writer
+	var gz *gzip.Writer
+	if gzipped {
+		gz = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gz)
+	} else {
+		tw = tar.NewWriter(&buf)
+	}
+	for name, content := range files {
+		h := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	if gz != nil {
+		gz.Close()
+	}
+	return buf.Bytes()
+}
+
+func makeZip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestDeploy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "site")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "index.html"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := []byte("s3cret")
+	d := Deploy{
+		Next:     httpserver.EmptyNext,
+		Path:     DefaultPath,
+		Secret:   secret,
+		Root:     root,
+		Releases: root + ".releases",
+		Keep:     1,
+		MaxSize:  1 << 20,
+	}
+	purged := make(chan struct{}, 10)
+	httpserver.RegisterCache("deploy test", func() { purged <- struct{}{} })
+
+	// requests are signed a second apart, so that
+	// they are not taken as replays of each other
+	signedAt := time.Now().Add(-time.Minute)
+	do := func(method, path string, body []byte, secret []byte) (int, State, string) {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if secret != nil {
+			signedAt = signedAt.Add(time.Second)
+			sign(req, secret, body, signedAt)
+		}
+		w := httptest.NewRecorder()
+		status, err := d.ServeHTTP(w, req)
+		if err != nil {
+			t.Fatalf("%s %s: Expected no error, got: %v", method, path, err)
+		}
+		if status == 0 {
+			status = w.Code
+		}
+		var state State
+		json.Unmarshal(w.Body.Bytes(), &state)
+		return status, state, w.Body.String()
+	}
+	content := func(name string) string {
+		b, _ := ioutil.ReadFile(filepath.Join(root, name))
+		return string(b)
+	}
+
+	archive := makeTar(t, true, map[string]string{"index.html": "v1", "css/site.css": "body{}"})
+	if status, _, _ := do("POST", "/deploy", archive, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected unsigned upload to be unauthorized, got %d", status)
+	}
+	if status, _, _ := do("POST", "/deploy", archive, []byte("wrong")); status != http.StatusUnauthorized {
+		t.Errorf("Expected upload signed with another secret to be unauthorized, got %d", status)
+	}
+	if content("index.html") != "old" {
+		t.Fatalf("Expected rejected uploads to leave the site alone, got %q", content("index.html"))
+	}
+
+	status, state, body := do("POST", "/deploy", archive, secret)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", status, body)
+	}
+	if content("index.html") != "v1" || content("css/site.css") != "body{}" {
+		t.Errorf("Expected the content of the archive, got %q %q", content("index.html"), content("css/site.css"))
+	}
+	if len(state.Releases) != 2 || state.Releases[0] != initialRelease || state.Current != state.Releases[1] {
+		t.Errorf("Expected the old root and a new release, got %+v", state)
+	}
+	select {
+	case <-purged:
+	default:
+		t.Error("Expected caches to be purged")
+	}
+	v1 := state.Current
+
+	archive = makeZip(t, map[string]string{"index.html": "v2"})
+	if status, state, body = do("POST", "/deploy", archive, secret); status != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", status, body)
+	}
+	if content("index.html") != "v2" || content("css/site.css") != "" {
+		t.Errorf("Expected only the content of the zip file, got %q %q", content("index.html"), content("css/site.css"))
+	}
+	if len(state.Releases) != 2 || state.Releases[0] != v1 {
+		t.Errorf("Expected the initial release to be pruned, got %+v", state)
+	}
+
+	if status, state, body = do("POST", "/deploy/rollback", nil, secret); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", status, body)
+	}
+	if content("index.html") != "v1" || state.Current != v1 {
+		t.Errorf("Expected to roll back to %s, got %q and %+v", v1, content("index.html"), state)
+	}
+	if status, _, _ = do("POST", "/deploy/rollback", nil, secret); status != http.StatusConflict {
+		t.Errorf("Expected no release to roll back to, got %d", status)
+	}
+	if status, _, _ = do("POST", "/deploy/rollback", []byte("nope"), secret); status != http.StatusNotFound {
+		t.Errorf("Expected unknown release to be not found, got %d", status)
+	}
+
+	if status, state, _ = do("GET", "/deploy", nil, secret); status != http.StatusOK || state.Current != v1 {
+		t.Errorf("Expected the state, got %d %+v", status, state)
+	}
+	if status, _, _ = do("GET", "/deploy", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected unsigned request to be unauthorized, got %d", status)
+	}
+
+	for i, bad := range [][]byte{
+		[]byte("not an archive"),
+		makeTar(t, false, map[string]string{"big": strings.Repeat("x", 2<<20)}),
+	} {
+		if status, _, _ = do("POST", "/deploy", bad, secret); status != http.StatusBadRequest && status != http.StatusRequestEntityTooLarge {
+			t.Errorf("Test %d: Expected bad archive to be rejected, got %d", i, status)
+		}
+	}
+	if content("index.html") != "v1" {
+		t.Errorf("Expected bad archives to leave the site alone, got %q", content("index.html"))
+	}
+}
+
+func TestTarget(t *testing.T) {
+	for i, test := range []struct {
+		name, expected string
+	}{
+		{"index.html", "/d/index.html"},
+		{"./a/b.txt", "/d/a/b.txt"},
+		{"../../etc/passwd", "/d/etc/passwd"},
+		{"/abs/file", "/d/abs/file"},
+		{`..\..\win`, "/d/win"},
+	} {
+		if actual := target("/d", test.name); actual != filepath.FromSlash(test.expected) {
+			t.Errorf("Test %d: Expected %s, got %s", i, test.expected, actual)
+		}
+	}
+}
+
+func TestSignatureReplay(t *testing.T) {
+	secret := []byte("secret")
+	d := Deploy{Secret: secret}
+	now := time.Now()
+	newRequest := func(path string, signedAt time.Time) *http.Request {
+		req := httptest.NewRequest("POST", path, strings.NewReader("v1"))
+		sign(req, secret, []byte("v1"), signedAt)
+		return req
+	}
+	check := func(i int, req *http.Request, expected bool) {
+		if _, ok := d.readSigned(httptest.NewRecorder(), req); ok != expected {
+			t.Errorf("Test %d: Expected signature to be valid: %v, got %v", i, expected, ok)
+		}
+	}
+
+	check(0, newRequest("/deploy/rollback", now), true)
+	check(1, newRequest("/deploy/rollback", now), false)
+	check(2, newRequest("/deploy/rollback", now.Add(-time.Second)), true)
+	check(3, newRequest("/deploy/rollback", now.Add(-10*time.Minute)), false)
+	check(4, newRequest("/deploy/rollback", now.Add(10*time.Minute)), false)
+
+	req := newRequest("/deploy/rollback", now.Add(-2*time.Second))
+	req.URL.Path = "/deploy"
+	check(5, req, false)
+	req = newRequest("/deploy/rollback", now.Add(-3*time.Second))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Add(-4*time.Second).Unix(), 10))
+	check(6, req, false)
+	req = newRequest("/deploy/rollback", now.Add(-5*time.Second))
+	req.Header.Del(TimestampHeader)
+	check(7, req, false)
+}
@@ -0,0 +1,255 @@
+package deploy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// initialRelease is the name of the release that the content of
+// the site root becomes if it was a directory before the first
+// deploy; it sorts before the names of other releases.
+const initialRelease = "00000000T000000Z"
+
+// archiveError is an error in an uploaded archive,
+// rather than one of the server.
+type archiveError string
+
+func (e archiveError) Error() string { return string(e) }
+
+// release returns the directory of the release named name.
+func (d Deploy) release(name string) string {
+	return filepath.Join(d.Releases, name)
+}
+
+// prepare creates the directory of the releases, and turns a
+// site root that is a directory into the first release, so that
+// the root can become a symbolic link.
+func (d Deploy) prepare() error {
+	if err := os.MkdirAll(d.Releases, 0755); err != nil {
+		return err
+	}
+	info, err := os.Lstat(d.Root)
+	if os.IsNotExist(err) || err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("site root %s is not a directory", d.Root)
+	}
+	if err := os.Rename(d.Root, d.release(initialRelease)); err != nil {
+		return err
+	}
+	return d.activate(initialRelease)
+}
+
+// unpack extracts the archive, which is size bytes, into a new
+// release, and returns its name.
+func (d Deploy) unpack(archive *os.File, size int64) (string, error) {
+	staging, err := ioutil.TempDir(d.Releases, ".staging-")
+	if err != nil {
+		return "", err
+	}
+	if err := extract(archive, size, staging, d.MaxSize); err != nil {
+		os.RemoveAll(staging)
+		return "", err
+	}
+
+	// releases are named by when they were made, so
+	// they sort in order
+	base := time.Now().UTC().Format("20060102T150405Z")
+	name := base
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(d.release(name)); os.IsNotExist(err) {
+			break
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	if err := os.Rename(staging, d.release(name)); err != nil {
+		os.RemoveAll(staging)
+		return "", err
+	}
+	return name, nil
+}
+
+// activate makes the release named name current by replacing
+// the site root with a link to it, which is atomic: requests see
+// either the old release or the new one.
+func (d Deploy) activate(name string) error {
+	link := d.Root + ".deploying"
+	os.Remove(link)
+	if err := os.Symlink(d.release(name), link); err != nil {
+		return err
+	}
+	if err := os.Rename(link, d.Root); err != nil {
+		os.Remove(link)
+		return err
+	}
+	return nil
+}
+
+// state returns the current release and all releases, oldest first.
+func (d Deploy) state() (State, error) {
+	state := State{Releases: []string{}}
+	if target, err := os.Readlink(d.Root); err == nil && filepath.Dir(target) == filepath.Clean(d.Releases) {
+		state.Current = filepath.Base(target)
+	}
+	infos, err := ioutil.ReadDir(d.Releases)
+	if err != nil && !os.IsNotExist(err) {
+		return state, err
+	}
+	for _, info := range infos {
+		if info.IsDir() && !strings.HasPrefix(info.Name(), ".") {
+			state.Releases = append(state.Releases, info.Name())
+		}
+	}
+	return state, nil
+}
+
+// prune removes the releases before the current one but the
+// last Keep. Releases after the current one, which was rolled
+// back to, are kept, so the rollback can be undone.
+func (d Deploy) prune() error {
+	state, err := d.state()
+	if err != nil {
+		return err
+	}
+	var before []string
+	for _, name := range state.Releases {
+		if name < state.Current {
+			before = append(before, name)
+		}
+	}
+	for len(before) > d.Keep {
+		if err := os.RemoveAll(d.release(before[0])); err != nil {
+			return err
+		}
+		before = before[1:]
+	}
+	return nil
+}
+
+// extract extracts the archive, a tar file, gzipped or not, or a
+// zip file, which is size bytes, into dir; what is in it may be
+// at most max bytes.
+func extract(archive *os.File, size int64, dir string, max int64) error {
+	var magic [4]byte
+	n, _ := archive.ReadAt(magic[:], 0)
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	budget := &max
+
+	switch {
+	case n >= 4 && string(magic[:4]) == "PK\x03\x04":
+		zr, err := zip.NewReader(archive, size)
+		if err != nil {
+			return archiveError("invalid zip file: " + err.Error())
+		}
+		for _, f := range zr.File {
+			mode := f.Mode()
+			if mode.IsDir() {
+				if err := makeDir(dir, f.Name); err != nil {
+					return err
+				}
+				continue
+			}
+			if !mode.IsRegular() {
+				return archiveError("unsupported file " + f.Name)
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return archiveError("invalid zip file: " + err.Error())
+			}
+			err = writeFile(dir, f.Name, rc, budget)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case n >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		gz, err := gzip.NewReader(archive)
+		if err != nil {
+			return archiveError("invalid gzip file: " + err.Error())
+		}
+		defer gz.Close()
+		return extractTar(gz, dir, budget)
+	}
+	return extractTar(archive, dir, budget)
+}
+
+func extractTar(r io.Reader, dir string, budget *int64) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return archiveError("invalid tar file: " + err.Error())
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := makeDir(dir, h.Name); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := writeFile(dir, h.Name, tr, budget); err != nil {
+				return err
+			}
+		default:
+			return archiveError("unsupported file " + h.Name)
+		}
+	}
+}
+
+// target returns where the file named name in an archive is
+// extracted to in dir; names cannot lead out of dir.
+func target(dir, name string) string {
+	clean := path.Clean("/" + strings.Replace(name, "\\", "/", -1))
+	return filepath.Join(dir, filepath.FromSlash(clean))
+}
+
+func makeDir(dir, name string) error {
+	return os.MkdirAll(target(dir, name), 0755)
+}
+
+// writeFile writes the file named name with the content of r,
+// which may be at most *budget bytes, and deducts its size.
+func writeFile(dir, name string, r io.Reader, budget *int64) error {
+	where := target(dir, name)
+	if where == filepath.Clean(dir) {
+		return archiveError("invalid file name " + name)
+	}
+	if err := os.MkdirAll(filepath.Dir(where), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(where, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := io.CopyN(f, r, *budget+1)
+	if err != nil && err != io.EOF {
+		if _, ok := err.(*os.PathError); ok {
+			return err
+		}
+		return archiveError("invalid archive: " + err.Error())
+	}
+	*budget -= n
+	if *budget < 0 {
+		return archiveError("archive content too large")
+	}
+	return nil
+}
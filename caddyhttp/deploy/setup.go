@@ -0,0 +1,122 @@
+package deploy
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("deploy", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Deploy middleware instance. Syntax:
+//
+//	deploy [path] {
+//	    secret   key
+//	    releases dir
+//	    keep     n
+//	    max_size size
+//	}
+//
+// The path defaults to /deploy. The secret, which signs requests,
+// is required. Releases are kept in the directory named like the
+// site root with .releases appended by default; a relative dir is
+// in the directory of the site root. By default, 3 releases before
+// the current one are kept, and archives may be 100 MB.
+func setup(c *caddy.Controller) error {
+	if err := httpserver.CheckStaticRoot(c); err != nil {
+		return err
+	}
+	cfg := httpserver.GetConfig(c)
+	d, err := deployParse(c)
+	if err != nil {
+		return err
+	}
+
+	root, err := filepath.Abs(cfg.Root)
+	if err != nil {
+		return c.Errf("deploy: %v", err)
+	}
+	d.Root = root
+	if d.Releases == "" {
+		d.Releases = root + ".releases"
+	} else if !filepath.IsAbs(d.Releases) {
+		d.Releases = filepath.Join(filepath.Dir(root), d.Releases)
+	}
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		d.Next = next
+		return d
+	})
+	return nil
+}
+
+func deployParse(c *caddy.Controller) (Deploy, error) {
+	d := Deploy{Path: DefaultPath, Keep: defaultKeep, MaxSize: defaultMaxSize}
+	var seen bool
+	for c.Next() {
+		if seen {
+			return d, c.Err("deploy: can only be specified once per site")
+		}
+		seen = true
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			if !strings.HasPrefix(args[0], "/") {
+				return d, c.Errf("deploy: invalid path '%s'", args[0])
+			}
+			d.Path = args[0]
+		default:
+			return d, c.ArgErr()
+		}
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return d, c.ArgErr()
+			}
+			value := c.Val()
+			if c.NextArg() {
+				return d, c.ArgErr()
+			}
+			switch what {
+			case "secret":
+				d.Secret = []byte(value)
+			case "releases":
+				d.Releases = value
+			case "keep":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					return d, c.Errf("deploy: invalid keep '%s'", value)
+				}
+				d.Keep = n
+			case "max_size":
+				size, err := humanize.ParseBytes(value)
+				if err != nil || size == 0 {
+					return d, c.Errf("deploy: invalid max_size '%s'", value)
+				}
+				d.MaxSize = int64(size)
+			default:
+				return d, c.Errf("deploy: unknown property '%s'", what)
+			}
+		}
+	}
+	if seen && len(d.Secret) == 0 {
+		return d, c.Err("deploy: secret is required")
+	}
+	return d, nil
+}
+
+const (
+	defaultKeep    = 3
+	defaultMaxSize = 100 << 20
+)
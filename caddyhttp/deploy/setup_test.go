@@ -0,0 +1,68 @@
+package deploy
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", "deploy {\nsecret abc\n}")
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	d, ok := handler.(Deploy)
+	if !ok {
+		t.Fatalf("Expected handler to be type Deploy, got: %#v", handler)
+	}
+	if !httpserver.SameNext(d.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if !filepath.IsAbs(d.Root) || d.Releases != d.Root+".releases" {
+		t.Errorf("Expected absolute root and releases next to it, got %s and %s", d.Root, d.Releases)
+	}
+}
+
+func TestDeployParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  Deploy
+	}{
+		{"deploy {\nsecret abc\n}", false, Deploy{Path: DefaultPath, Secret: []byte("abc"), Keep: defaultKeep, MaxSize: defaultMaxSize}},
+		{"deploy /publish {\nsecret abc\nreleases /srv/releases\nkeep 0\nmax_size 1MB\n}", false,
+			Deploy{Path: "/publish", Secret: []byte("abc"), Releases: "/srv/releases", Keep: 0, MaxSize: 1000000}},
+		{"deploy", true, Deploy{}},
+		{"deploy publish {\nsecret abc\n}", true, Deploy{}},
+		{"deploy /a /b {\nsecret abc\n}", true, Deploy{}},
+		{"deploy {\nsecret\n}", true, Deploy{}},
+		{"deploy {\nsecret abc def\n}", true, Deploy{}},
+		{"deploy {\nsecret abc\nkeep -1\n}", true, Deploy{}},
+		{"deploy {\nsecret abc\nmax_size lots\n}", true, Deploy{}},
+		{"deploy {\nsecret abc\nwhat x\n}", true, Deploy{}},
+		{"deploy {\nsecret abc\n}\ndeploy {\nsecret abc\n}", true, Deploy{}},
+	} {
+		actual, err := deployParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if actual.Path != test.expected.Path || string(actual.Secret) != string(test.expected.Secret) ||
+			actual.Releases != test.expected.Releases || actual.Keep != test.expected.Keep || actual.MaxSize != test.expected.MaxSize {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
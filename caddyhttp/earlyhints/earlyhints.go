@@ -0,0 +1,141 @@
+// Package earlyhints provides middleware that sends 103 Early
+// Hints responses, so browsers can preload the resources of a
+// page while the server is still producing it.
+package earlyhints
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// EarlyHints is middleware that sends early hints
+// to requests matching a rule.
+type EarlyHints struct {
+	Next  httpserver.Handler
+	Rules []Rule
+}
+
+// Rule is the hints sent to requests to a base path.
+type Rule struct {
+	Path string
+
+	// Links are the values of the Link
+	// header fields sent, if any
+	Links []string
+
+	// Upstream is whether the early hints of the
+	// upstreams of a proxy are passed on
+	Upstream bool
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (e EarlyHints) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var rule *Rule
+	for i := range e.Rules {
+		if !httpserver.Path(r.URL.Path).Matches(e.Rules[i].Path) {
+			continue
+		}
+		if rule == nil || len(e.Rules[i].Path) > len(rule.Path) {
+			rule = &e.Rules[i]
+		}
+	}
+	// HTTP/1.0 clients do not expect informational responses
+	if rule == nil || r.Method != http.MethodGet || !r.ProtoAtLeast(1, 1) {
+		return e.Next.ServeHTTP(w, r)
+	}
+
+	hw := &hintsWriter{ResponseWriter: w}
+	if rule.Upstream {
+		r = httpserver.WithEarlyHints(r, hw.send)
+	}
+	hw.send(rule.Links)
+	return e.Next.ServeHTTP(hw, r)
+}
+
+// hintsWriter sends early hints until the
+// header of the final response is written.
+type hintsWriter struct {
+	http.ResponseWriter
+	mu          sync.Mutex
+	wroteHeader bool
+}
+
+// send sends links in a 103 Early Hints response, unless
+// the header of the final response was written.
+func (w *hintsWriter) send(links []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.wroteHeader || len(links) == 0 {
+		return
+	}
+
+	// the informational response has the fields that are
+	// set when it is written, which are only the links
+	h := w.Header()
+	saved := make(http.Header, len(h))
+	for field, values := range h {
+		saved[field] = values
+		delete(h, field)
+	}
+	h["Link"] = links
+	w.ResponseWriter.WriteHeader(http.StatusEarlyHints)
+	delete(h, "Link")
+	for field, values := range saved {
+		h[field] = values
+	}
+}
+
+// WriteHeader writes the header of the final response.
+func (w *hintsWriter) WriteHeader(status int) {
+	w.mu.Lock()
+	w.wroteHeader = true
+	w.mu.Unlock()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes p, after the header if it was not yet written.
+func (w *hintsWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.wroteHeader = true
+	w.mu.Unlock()
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher. It simply wraps the underlying
+// ResponseWriter's Flush method if there is one, or panics.
+func (w *hintsWriter) Flush() {
+	w.mu.Lock()
+	w.wroteHeader = true
+	w.mu.Unlock()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	} else {
+		panic(httpserver.NonFlusherError{Underlying: w.ResponseWriter}) // should be recovered at the beginning of middleware stack
+	}
+}
+
+// Hijack implements http.Hijacker. It simply wraps the underlying
+// ResponseWriter's Hijack method if there is one, or returns an error.
+func (w *hintsWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.mu.Lock()
+	w.wroteHeader = true
+	w.mu.Unlock()
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, httpserver.NonHijackerError{Underlying: w.ResponseWriter}
+}
+
+// CloseNotify implements http.CloseNotifier.
+// It just inherits the underlying ResponseWriter's CloseNotify method.
+// It panics if the underlying ResponseWriter is not a CloseNotifier.
+func (w *hintsWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	panic(httpserver.NonCloseNotifierError{Underlying: w.ResponseWriter})
+}
@@ -0,0 +1,83 @@
+package earlyhints
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestEarlyHints(t *testing.T) {
+	e := EarlyHints{
+		Rules: []Rule{
+			{Path: "/", Links: []string{"</site.css>; rel=preload; as=style"}},
+			{Path: "/app", Links: []string{"</app.js>; rel=preload; as=script"}, Upstream: true},
+		},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			// as a proxy upstream would
+			httpserver.SendEarlyHints(r, []string{"</data.json>; rel=preload; as=fetch"})
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("page"))
+			// too late for hints
+			httpserver.SendEarlyHints(r, []string{"</late.css>; rel=preload"})
+			return 0, nil
+		}),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "Caddy")
+		e.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	for i, test := range []struct {
+		method, path string
+		expected     [][]string
+	}{
+		{"GET", "/", [][]string{{"</site.css>; rel=preload; as=style"}}},
+		{"GET", "/app/home", [][]string{
+			{"</app.js>; rel=preload; as=script"},
+			{"</data.json>; rel=preload; as=fetch"},
+		}},
+		{"POST", "/", nil},
+	} {
+		var hints [][]string
+		var hintHeaders []textproto.MIMEHeader
+		trace := &httptrace.ClientTrace{
+			Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+				if code == http.StatusEarlyHints {
+					hints = append(hints, header["Link"])
+					hintHeaders = append(hintHeaders, header)
+				}
+				return nil
+			},
+		}
+		req, _ := http.NewRequest(test.method, server.URL+test.path, nil)
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if !reflect.DeepEqual(hints, test.expected) {
+			t.Errorf("Test %d: Expected hints %v, got %v", i, test.expected, hints)
+		}
+		for _, h := range hintHeaders {
+			if h.Get("Server") != "" {
+				t.Errorf("Test %d: Expected only links in hints, got %v", i, h)
+			}
+		}
+		if resp.StatusCode != http.StatusOK || string(body) != "page" || resp.Header.Get("Server") != "Caddy" {
+			t.Errorf("Test %d: Expected final response with its header, got %d %q %v", i, resp.StatusCode, body, resp.Header)
+		}
+		if resp.Header.Get("Link") != "" {
+			t.Errorf("Test %d: Expected no links in final response, got %s", i, resp.Header.Get("Link"))
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package earlyhints
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("early_hints", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new EarlyHints middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := earlyHintsParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return EarlyHints{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// earlyHintsParse parses early_hints directives of the form
+//
+//	early_hints [path] {
+//	    preload url [type]
+//	    link    value
+//	    upstream
+//	}
+//
+// preload hints that the resource at url, of a type such as
+// style, script or font, is needed; link sends any Link header
+// field value. upstream passes on the early hints of proxy
+// upstreams. Hints are only sent to GET requests.
+func earlyHintsParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{Path: "/"}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			rule.Path = args[0]
+		default:
+			return rules, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			property := c.Val()
+			args := c.RemainingArgs()
+			switch property {
+			case "preload":
+				if len(args) != 1 && len(args) != 2 {
+					return rules, c.ArgErr()
+				}
+				link := "<" + args[0] + ">; rel=preload"
+				if len(args) == 2 {
+					link += "; as=" + args[1]
+				}
+				rule.Links = append(rule.Links, link)
+			case "link":
+				if len(args) != 1 {
+					return rules, c.ArgErr()
+				}
+				rule.Links = append(rule.Links, args[0])
+			case "upstream":
+				if len(args) != 0 {
+					return rules, c.ArgErr()
+				}
+				rule.Upstream = true
+			default:
+				return rules, c.Errf("early_hints: unknown property '%s'", property)
+			}
+		}
+		if len(rule.Links) == 0 && !rule.Upstream {
+			return rules, c.Err("early_hints: no hints to send")
+		}
+
+		for _, existing := range rules {
+			if existing.Path == rule.Path {
+				return rules, c.Errf("early_hints: duplicate path '%s'", rule.Path)
+			}
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
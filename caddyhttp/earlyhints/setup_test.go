@@ -0,0 +1,93 @@
+package earlyhints
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `early_hints {
+		preload /site.css style
+	}`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) != 1 {
+		t.Fatalf("Expected 1 middleware, got %d", len(mids))
+	}
+	handler, ok := mids[0](httpserver.EmptyNext).(EarlyHints)
+	if !ok {
+		t.Fatalf("Expected handler to be type EarlyHints, got: %#v", handler)
+	}
+	if !httpserver.SameNext(handler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestEarlyHintsParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{`early_hints {
+			preload /site.css style
+			preload /logo.svg
+			link "</font.woff2>; rel=preload; as=font; crossorigin"
+		}`, false, []Rule{{Path: "/", Links: []string{
+			"</site.css>; rel=preload; as=style",
+			"</logo.svg>; rel=preload",
+			"</font.woff2>; rel=preload; as=font; crossorigin",
+		}}}},
+		{`early_hints /app {
+			upstream
+		}
+		early_hints /blog {
+			preload /blog.css style
+		}`, false, []Rule{
+			{Path: "/app", Upstream: true},
+			{Path: "/blog", Links: []string{"</blog.css>; rel=preload; as=style"}},
+		}},
+		{`early_hints`, true, nil},
+		{`early_hints /a /b {
+			upstream
+		}`, true, nil},
+		{`early_hints {
+			preload
+		}`, true, nil},
+		{`early_hints {
+			link a b
+		}`, true, nil},
+		{`early_hints {
+			upstream all
+		}`, true, nil},
+		{`early_hints {
+			push /site.css
+		}`, true, nil},
+		{`early_hints {
+			upstream
+		}
+		early_hints / {
+			upstream
+		}`, true, nil},
+	} {
+		rules, err := earlyHintsParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules, test.expected) {
+			t.Errorf("Test %d: Expected rules %+v, got %+v", i, test.expected, rules)
+		}
+	}
+}
@@ -2,12 +2,18 @@
 package errors
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"html/template"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,8 +23,9 @@ import (
 
 func init() {
 	caddy.RegisterPlugin("errors", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
@@ -28,27 +35,77 @@ type ErrorHandler struct {
 	GenericErrorPage string         // default error page filename
 	ErrorPages       map[int]string // map of status code to filename
 	LogFile          string
+	LogLevel         Level  // least level of entries that are logged
+	LogFormat        string // "text" (default) or "json"
+	LogRequestID     bool   // if true, text entries have the ID of the request too
 	Log              *log.Logger
 	LogRoller        *httpserver.LogRoller
 	Debug            bool     // if true, errors are written out to client rather than to a log
 	file             *os.File // a log file to close when done
+
+	// Page of responses to panics
+	PanicTemplate *template.Template
+
+	// Directory that diagnostic bundles of panics are
+	// written to, with the recent lines of the log
+	CrashDir string
+	recent   *logRing
+}
+
+// Level is the severity of a log entry.
+type Level int
+
+// Levels of log entries; the zero value is LevelInfo.
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// levels maps the names of levels to them.
+var levels = map[string]Level{
+	"debug": LevelDebug,
+	"info":  LevelInfo,
+	"warn":  LevelWarn,
+	"error": LevelError,
+}
+
+func (l Level) String() string {
+	for name, level := range levels {
+		if level == l {
+			return name
+		}
+	}
+	return strconv.Itoa(int(l))
 }
 
 func (h ErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if h.LogRequestID || h.LogFormat == "json" {
+		r = httpserver.SetRequestPlaceholder(r, "request_id", requestID(r))
+	} else {
+		r = httpserver.WithRequestPlaceholders(r)
+	}
 	defer h.recovery(w, r)
 
 	status, err := h.Next.ServeHTTP(w, r)
 
 	if err != nil {
-		errMsg := fmt.Sprintf("%s [ERROR %d %s] %v", time.Now().Format(timeFormat), status, r.URL.Path, err)
 		if h.Debug {
 			// Write error to response instead of to log
+			errMsg := fmt.Sprintf("%s [ERROR %d %s] %v", time.Now().Format(timeFormat), status, r.URL.Path, err)
 			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 			w.WriteHeader(status)
 			fmt.Fprintln(w, errMsg)
 			return 0, err // returning 0 signals that a response has been written
 		}
-		h.Log.Println(errMsg)
+		level := LevelError
+		if status >= 400 && status < 500 {
+			level = LevelWarn
+		}
+		h.logEntry(r, level, fmt.Sprintf("%s %d %s", strings.ToUpper(level.String()), status, r.URL.Path), status, err.Error())
+	} else if status >= 400 && !h.Debug {
+		h.logEntry(r, LevelDebug, fmt.Sprintf("DEBUG %d %s", status, r.URL.Path), status, http.StatusText(status))
 	}
 
 	if status >= 400 {
@@ -59,6 +116,85 @@ func (h ErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, er
 	return status, err
 }
 
+// logEntry writes an entry about r to the log if it is at least
+// at the level of the log. Text entries are tagged with tag.
+// Entries of all levels are kept for crash bundles.
+func (h ErrorHandler) logEntry(r *http.Request, level Level, tag string, status int, msg string) {
+	if (level < h.LogLevel || h.Log == nil) && h.recent == nil {
+		return
+	}
+	now := time.Now()
+	requestID, _ := httpserver.RequestPlaceholder(r, "request_id")
+	upstream, _ := httpserver.RequestPlaceholder(r, "upstream")
+
+	var line string
+	if h.LogFormat == "json" {
+		remote, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			remote = r.RemoteAddr
+		}
+		entry, err := json.Marshal(jsonEntry{
+			Time:      now.Format(time.RFC3339),
+			Level:     level.String(),
+			Status:    status,
+			Method:    r.Method,
+			Host:      r.Host,
+			URI:       r.URL.RequestURI(),
+			Remote:    remote,
+			RequestID: requestID,
+			Upstream:  upstream,
+			Message:   msg,
+		})
+		if err != nil {
+			return
+		}
+		line = string(entry)
+	} else {
+		line = fmt.Sprintf("%s [%s] %s", now.Format(timeFormat), tag, msg)
+		if requestID != "" {
+			line += " request_id=" + requestID
+		}
+		if upstream != "" {
+			line += " upstream=" + upstream
+		}
+	}
+
+	h.recent.add(line)
+	if level >= h.LogLevel && h.Log != nil {
+		h.Log.Println(line)
+	}
+}
+
+// jsonEntry is an entry of a JSON error log.
+type jsonEntry struct {
+	Time      string `json:"ts"`
+	Level     string `json:"level"`
+	Status    int    `json:"status,omitempty"`
+	Method    string `json:"method"`
+	Host      string `json:"host"`
+	URI       string `json:"uri"`
+	Remote    string `json:"remote"`
+	RequestID string `json:"request_id,omitempty"`
+	Upstream  string `json:"upstream,omitempty"`
+	Message   string `json:"msg"`
+}
+
+// requestID returns the ID of r given by the X-Request-Id
+// header, or a new random one if there is no usable ID.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-Id"); id != "" && len(id) <= maxRequestIDLen &&
+		strings.IndexFunc(id, func(c rune) bool { return c <= ' ' || c > '~' }) == -1 {
+		return id
+	}
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b[:])
+}
+
+const maxRequestIDLen = 128
+
 // errorPage serves a static error page to w according to the status
 // code. If there is an error serving the error page, a plaintext error
 // message is written instead, and the extra error is logged.
@@ -69,8 +205,8 @@ func (h ErrorHandler) errorPage(w http.ResponseWriter, r *http.Request, code int
 		errorPage, err := os.Open(pagePath)
 		if err != nil {
 			// An additional error handling an error... <insert grumpy cat here>
-			h.Log.Printf("%s [NOTICE %d %s] could not load error page: %v",
-				time.Now().Format(timeFormat), code, r.URL.String(), err)
+			h.logEntry(r, LevelWarn, fmt.Sprintf("NOTICE %d %s", code, r.URL.String()), code,
+				fmt.Sprintf("could not load error page: %v", err))
 			httpserver.DefaultErrorFunc(w, r, code)
 			return
 		}
@@ -83,8 +219,8 @@ func (h ErrorHandler) errorPage(w http.ResponseWriter, r *http.Request, code int
 
 		if err != nil {
 			// Epic fail... sigh.
-			h.Log.Printf("%s [NOTICE %d %s] could not respond with %s: %v",
-				time.Now().Format(timeFormat), code, r.URL.String(), pagePath, err)
+			h.logEntry(r, LevelWarn, fmt.Sprintf("NOTICE %d %s", code, r.URL.String()), code,
+				fmt.Sprintf("could not respond with %s: %v", pagePath, err))
 			httpserver.DefaultErrorFunc(w, r, code)
 		}
 
@@ -138,15 +274,40 @@ func (h ErrorHandler) recovery(w http.ResponseWriter, r *http.Request) {
 		file = file[pkgPathPos+len(delim):]
 	}
 
-	panicMsg := fmt.Sprintf("%s [PANIC %s] %s:%d - %v", time.Now().Format(timeFormat), r.URL.String(), file, line, rec)
+	// Currently we don't use the function name, since file:line is more conventional
+	panicMsg := fmt.Sprintf("%s:%d - %v", file, line, rec)
+	panics.Add(1)
 	if h.Debug {
 		// Write error and stack trace to the response rather than to a log
 		var stackBuf [4096]byte
 		stack := stackBuf[:runtime.Stack(stackBuf[:], false)]
-		httpserver.WriteTextResponse(w, http.StatusInternalServerError, fmt.Sprintf("%s\n\n%s", panicMsg, stack))
+		httpserver.WriteTextResponse(w, http.StatusInternalServerError, fmt.Sprintf("%s [PANIC %s] %s\n\n%s",
+			time.Now().Format(timeFormat), r.URL.String(), panicMsg, stack))
+		return
+	}
+
+	h.logEntry(r, LevelError, "PANIC "+r.URL.String(), http.StatusInternalServerError, panicMsg)
+	// requests are given IDs here, if not before, for the
+	// panic page and the crash bundle to refer to
+	id, ok := httpserver.RequestPlaceholder(r, "request_id")
+	if !ok && (h.CrashDir != "" || h.PanicTemplate != nil) {
+		id = requestID(r)
+	}
+	if h.CrashDir != "" {
+		stack := make([]byte, maxStackSize)
+		stack = stack[:runtime.Stack(stack, false)]
+		name, err := h.writeCrashBundle(r, id, panicMsg, stack)
+		if err != nil {
+			h.logEntry(r, LevelWarn, "NOTICE "+r.URL.String(), http.StatusInternalServerError,
+				fmt.Sprintf("could not write crash bundle: %v", err))
+		} else {
+			h.logEntry(r, LevelInfo, "NOTICE "+r.URL.String(), http.StatusInternalServerError,
+				"wrote crash bundle "+name)
+		}
+	}
+	if h.PanicTemplate != nil {
+		h.panicPage(w, r, id)
 	} else {
-		// Currently we don't use the function name, since file:line is more conventional
-		h.Log.Printf(panicMsg)
 		h.errorPage(w, r, http.StatusInternalServerError)
 	}
 }
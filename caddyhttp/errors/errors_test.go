@@ -232,6 +232,74 @@ func TestGenericErrorPage(t *testing.T) {
 	}
 }
 
+func TestLogLevelsAndFormat(t *testing.T) {
+	var buf bytes.Buffer
+	em := ErrorHandler{
+		ErrorPages: make(map[int]string),
+		Log:        log.New(&buf, "", 0),
+	}
+	testErr := errors.New("test error")
+	upstreamErr := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		httpserver.SetRequestPlaceholder(r, "upstream", "http://backend:8080")
+		return http.StatusBadGateway, testErr
+	})
+
+	tests := []struct {
+		level       Level
+		format      string
+		requestID   bool
+		next        httpserver.Handler
+		expectedLog string
+	}{
+		{LevelInfo, "", false, genErrorHandler(http.StatusNotFound, nil, ""), ""},
+		{LevelDebug, "", false, genErrorHandler(http.StatusNotFound, nil, ""),
+			"[DEBUG 404 /a] Not Found\n"},
+		{LevelInfo, "", false, genErrorHandler(http.StatusForbidden, testErr, ""),
+			"[WARN 403 /a] test error\n"},
+		{LevelError, "", false, genErrorHandler(http.StatusForbidden, testErr, ""), ""},
+		{LevelError, "", false, upstreamErr,
+			"[ERROR 502 /a] test error upstream=http://backend:8080\n"},
+		{LevelError, "", true, upstreamErr,
+			"[ERROR 502 /a] test error request_id=abc upstream=http://backend:8080\n"},
+		{LevelInfo, "json", false, upstreamErr,
+			`"level":"error","status":502,"method":"GET","host":"example.com","uri":"/a?b=c","remote":"10.0.0.1","request_id":"abc","upstream":"http://backend:8080","msg":"test error"}`},
+		{LevelInfo, "json", false, genErrorHandler(http.StatusForbidden, testErr, ""),
+			`"level":"warn","status":403,`},
+	}
+
+	for i, test := range tests {
+		em.LogLevel, em.LogFormat, em.LogRequestID, em.Next = test.level, test.format, test.requestID, test.next
+		buf.Reset()
+		req := httptest.NewRequest("GET", "http://example.com/a?b=c", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Request-Id", "abc")
+		em.ServeHTTP(httptest.NewRecorder(), req)
+
+		log := buf.String()
+		if test.expectedLog == "" && log != "" {
+			t.Errorf("Test %d: Expected no log, got %q", i, log)
+		}
+		if !strings.Contains(log, test.expectedLog) {
+			t.Errorf("Test %d: Expected log %q, but got %q", i, test.expectedLog, log)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if id := requestID(req); len(id) != 16 || id == requestID(req) {
+		t.Errorf("Expected new random IDs, got %q", id)
+	}
+	req.Header.Set("X-Request-Id", "abc-123")
+	if id := requestID(req); id != "abc-123" {
+		t.Errorf("Expected ID of header, got %q", id)
+	}
+	req.Header.Set("X-Request-Id", "abc 123\nforged")
+	if id := requestID(req); len(id) != 16 {
+		t.Errorf("Expected invalid ID to be replaced, got %q", id)
+	}
+}
+
 func genErrorHandler(status int, err error, body string) httpserver.Handler {
 	return httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
 		if len(body) > 0 {
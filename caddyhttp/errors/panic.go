@@ -0,0 +1,160 @@
+package errors
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// logRing keeps the most recent lines of a log.
+type logRing struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+// newLogRing returns a ring that keeps size lines.
+func newLogRing(size int) *logRing {
+	return &logRing{lines: make([]string, size)}
+}
+
+// add adds line to the ring, replacing the oldest
+// line if it is full.
+func (l *logRing) add(line string) {
+	if l == nil || len(l.lines) == 0 {
+		return
+	}
+	l.mu.Lock()
+	l.lines[l.next] = line
+	l.next = (l.next + 1) % len(l.lines)
+	l.full = l.full || l.next == 0
+	l.mu.Unlock()
+}
+
+// recent returns the lines in the ring, oldest first.
+func (l *logRing) recent() []string {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]string(nil), l.lines[:l.next]...)
+	}
+	return append(append([]string(nil), l.lines[l.next:]...), l.lines[:l.next]...)
+}
+
+// panicPageData is what panic templates are executed with.
+type panicPageData struct {
+	RequestID string
+	Method    string
+	Path      string
+	Time      time.Time
+}
+
+// panicPage writes the panic template in response to r, or
+// the default error response if it cannot be executed.
+func (h ErrorHandler) panicPage(w http.ResponseWriter, r *http.Request, requestID string) {
+	var buf bytes.Buffer
+	err := h.PanicTemplate.Execute(&buf, panicPageData{
+		RequestID: requestID,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Time:      time.Now(),
+	})
+	if err != nil {
+		h.logEntry(r, LevelWarn, fmt.Sprintf("NOTICE %d %s", http.StatusInternalServerError, r.URL.String()),
+			http.StatusInternalServerError, fmt.Sprintf("could not execute panic template: %v", err))
+		h.errorPage(w, r, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	buf.WriteTo(w)
+}
+
+// writeCrashBundle writes a diagnostic bundle of a panic while
+// serving r to the crash directory, and returns its filename.
+func (h ErrorHandler) writeCrashBundle(r *http.Request, requestID, panicMsg string, stack []byte) (string, error) {
+	if atomic.AddInt32(&crashBundles, 1) > maxCrashBundles {
+		return "", fmt.Errorf("not more than %d bundles are written", maxCrashBundles)
+	}
+	now := time.Now()
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Time: %s\n", now.Format(time.RFC3339Nano))
+	fmt.Fprintf(&buf, "Request ID: %s\n", requestID)
+	fmt.Fprintf(&buf, "Panic: %s\n", panicMsg)
+
+	fmt.Fprintf(&buf, "\nRequest:\n%s %s %s\n", r.Method, r.URL.RequestURI(), r.Proto)
+	fmt.Fprintf(&buf, "Host: %s\n", r.Host)
+	fmt.Fprintf(&buf, "Remote: %s\n", r.RemoteAddr)
+	if r.TLS != nil {
+		fmt.Fprintf(&buf, "TLS: %s\n", r.TLS.ServerName)
+	}
+	names := make([]string, 0, len(r.Header))
+	for name := range r.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := strings.Join(r.Header[name], ", ")
+		if redactedHeaders[http.CanonicalHeaderKey(name)] {
+			value = "[redacted]"
+		}
+		fmt.Fprintf(&buf, "%s: %s\n", name, value)
+	}
+
+	fmt.Fprintf(&buf, "\nStack:\n%s\n", stack)
+
+	fmt.Fprintf(&buf, "\nRecent log:\n")
+	for _, line := range h.recent.recent() {
+		fmt.Fprintln(&buf, line)
+	}
+
+	// the request ID may come from the client
+	safeID := strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' {
+			return c
+		}
+		return '_'
+	}, requestID)
+	name := filepath.Join(h.CrashDir, fmt.Sprintf("crash-%s-%s.txt", now.Format("20060102T150405.000000000"), safeID))
+	return name, ioutil.WriteFile(name, buf.Bytes(), 0600)
+}
+
+// redactedHeaders are request headers whose values are
+// left out of crash bundles.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+}
+
+var (
+	// panics counts the panics recovered from, and
+	// is published as a metric.
+	panics        = new(expvar.Int)
+	publishPanics sync.Once
+
+	// crashBundles counts the crash bundles written
+	crashBundles int32
+)
+
+const (
+	// maxCrashBundles limits the crash bundles written by
+	// a process, so a panic loop does not fill the disk
+	maxCrashBundles = 100
+
+	defaultCrashLogLines = 100
+	maxStackSize         = 64 << 10
+)
@@ -0,0 +1,102 @@
+package errors
+
+import (
+	"bytes"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestLogRing(t *testing.T) {
+	ring := newLogRing(3)
+	for i, expected := range []string{"[a]", "[a b]", "[a b c]", "[b c d]", "[c d e]"} {
+		ring.add(string('a' + rune(i)))
+		if actual := "[" + strings.Join(ring.recent(), " ") + "]"; actual != expected {
+			t.Errorf("After %d lines: expected %s, got %s", i+1, expected, actual)
+		}
+	}
+	var none *logRing
+	none.add("a")
+	if lines := none.recent(); len(lines) != 0 {
+		t.Errorf("Expected no lines in nil ring, got %v", lines)
+	}
+}
+
+func TestPanicCrashBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy-crash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	em := ErrorHandler{
+		ErrorPages:    make(map[int]string),
+		Log:           log.New(&buf, "", 0),
+		LogLevel:      LevelError,
+		PanicTemplate: template.Must(template.New("panic").Parse(`<p>Sorry; reference {{.RequestID}} for {{.Path}}</p>`)),
+		CrashDir:      dir,
+		recent:        newLogRing(10),
+	}
+
+	em.Next = genErrorHandler(http.StatusNotFound, nil, "")
+	em.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+	em.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		panic("something broke")
+	})
+	before := panics.Value()
+	req := httptest.NewRequest("POST", "/crash?x=<y>", nil)
+	req.Header.Set("X-Request-Id", "../req/1")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("User-Agent", "tester")
+	rec := httptest.NewRecorder()
+	code, err := em.ServeHTTP(rec, req)
+
+	if code != 0 || err != nil {
+		t.Errorf("Expected response to be written, got %d, %v", code, err)
+	}
+	if rec.Code != http.StatusInternalServerError || rec.Body.String() != "<p>Sorry; reference ../req/1 for /crash</p>" {
+		t.Errorf("Expected panic page, got %d %q", rec.Code, rec.Body.String())
+	}
+	if panics.Value() != before+1 {
+		t.Errorf("Expected panic to be counted, got %d after %d", panics.Value(), before)
+	}
+	if log := buf.String(); !strings.Contains(log, "[PANIC /crash?x=<y>] ") || !strings.Contains(log, "something broke") {
+		t.Errorf("Expected panic to be logged, got %q", log)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "crash-*-___req_1.txt"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one crash bundle, got %v (%v)", files, err)
+	}
+	bundle, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"Request ID: ../req/1\n",
+		"Panic: ",
+		"something broke\n",
+		"POST /crash?x=<y> HTTP/1.1\n",
+		"Authorization: [redacted]\n",
+		"User-Agent: tester\n",
+		"TestPanicCrashBundle",
+		"[DEBUG 404 /missing] Not Found",
+	} {
+		if !strings.Contains(string(bundle), expected) {
+			t.Errorf("Expected crash bundle to contain %q, but it didn't:\n%s", expected, bundle)
+		}
+	}
+	if strings.Contains(string(bundle), "secret") {
+		t.Errorf("Expected credentials to be left out of crash bundle:\n%s", bundle)
+	}
+}
@@ -1,11 +1,14 @@
 package errors
 
 import (
+	"expvar"
+	"html/template"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/hashicorp/go-syslog"
 	"github.com/mholt/caddy"
@@ -19,11 +22,21 @@ func setup(c *caddy.Controller) error {
 		return err
 	}
 
+	publishPanics.Do(func() {
+		expvar.Publish("Panics", panics)
+	})
+
 	// Open the log file for writing when the server starts
 	c.OnStartup(func() error {
 		var err error
 		var writer io.Writer
 
+		if handler.CrashDir != "" {
+			if err = os.MkdirAll(handler.CrashDir, 0700); err != nil {
+				return err
+			}
+		}
+
 		switch handler.LogFile {
 		case "visible":
 			handler.Debug = true
@@ -84,6 +97,7 @@ func errorsParse(c *caddy.Controller) (*ErrorHandler, error) {
 	handler := &ErrorHandler{ErrorPages: make(map[int]string)}
 
 	cfg := httpserver.GetConfig(c)
+	crashLogLines := defaultCrashLogLines
 
 	optionalBlock := func() (bool, error) {
 		var hadBlock bool
@@ -97,6 +111,51 @@ func errorsParse(c *caddy.Controller) (*ErrorHandler, error) {
 			}
 			where := c.Val()
 
+			switch what {
+			case "level":
+				level, ok := levels[where]
+				if !ok {
+					return hadBlock, c.Errf("Unknown log level '%s'", where)
+				}
+				handler.LogLevel = level
+				continue
+			case "format":
+				if where != "text" && where != "json" {
+					return hadBlock, c.Errf("Unknown log format '%s'", where)
+				}
+				handler.LogFormat = where
+				continue
+			case "request_id":
+				if where != "on" && where != "off" {
+					return hadBlock, c.Errf("Invalid request_id '%s'; must be on or off", where)
+				}
+				handler.LogRequestID = where == "on"
+				continue
+			case "panic_template":
+				if !filepath.IsAbs(where) {
+					if err := httpserver.CheckStaticRoot(c); err != nil {
+						return hadBlock, err
+					}
+					where = filepath.Join(cfg.Root, where)
+				}
+				tpl, err := template.ParseFiles(where)
+				if err != nil {
+					return hadBlock, c.Errf("Loading panic template: %v", err)
+				}
+				handler.PanicTemplate = tpl
+				continue
+			case "crash_dir":
+				handler.CrashDir = where
+				continue
+			case "crash_log_lines":
+				n, err := strconv.Atoi(where)
+				if err != nil || n < 0 {
+					return hadBlock, c.Errf("Invalid number of crash log lines '%s'", where)
+				}
+				crashLogLines = n
+				continue
+			}
+
 			if what == "log" {
 				if where == "visible" {
 					handler.Debug = true
@@ -116,6 +175,9 @@ func errorsParse(c *caddy.Controller) (*ErrorHandler, error) {
 			} else {
 				// Error page; ensure it exists
 				if !filepath.IsAbs(where) {
+					if err := httpserver.CheckStaticRoot(c); err != nil {
+						return hadBlock, err
+					}
 					where = filepath.Join(cfg.Root, where)
 				}
 				f, err := os.Open(where)
@@ -169,5 +231,13 @@ func errorsParse(c *caddy.Controller) (*ErrorHandler, error) {
 		}
 	}
 
+	if handler.CrashDir != "" {
+		handler.recent = newLogRing(crashLogLines)
+	}
+
+	// The log file may be named after the site, so that
+	// sites sharing configuration have their own logs
+	handler.LogFile = strings.NewReplacer("{host}", cfg.Addr.Host, "{port}", cfg.Addr.Port).Replace(handler.LogFile)
+
 	return handler, nil
 }
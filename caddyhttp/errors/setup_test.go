@@ -1,6 +1,8 @@
 package errors
 
 import (
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
@@ -132,6 +134,25 @@ func TestErrorsParse(t *testing.T) {
 					404: testAbs,
 				},
 			}},
+		{`errors {
+			log errors.txt
+			level debug
+			format json
+		}`, false, ErrorHandler{
+			LogFile:    "errors.txt",
+			LogLevel:   LevelDebug,
+			LogFormat:  "json",
+			ErrorPages: map[int]string{},
+		}},
+		{`errors {
+			request_id on
+		}`, false, ErrorHandler{
+			LogRequestID: true,
+			ErrorPages:   map[int]string{},
+		}},
+		{`errors { request_id yes }`, true, ErrorHandler{ErrorPages: map[int]string{}}},
+		{`errors { level verbose }`, true, ErrorHandler{ErrorPages: map[int]string{}}},
+		{`errors { format xml }`, true, ErrorHandler{ErrorPages: map[int]string{}}},
 		// Next two test cases is the detection of duplicate status codes
 		{`errors {
         503 503.html
@@ -158,3 +179,46 @@ func TestErrorsParse(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorsParseSiteLogFile(t *testing.T) {
+	c := caddy.NewTestController("http", `errors /var/log/{host}-{port}.log`)
+	httpserver.GetConfig(c).Addr = httpserver.Address{Host: "example.com", Port: "443"}
+	handler, err := errorsParse(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "/var/log/example.com-443.log"; handler.LogFile != expected {
+		t.Errorf("Expected LogFile %s, got %s", expected, handler.LogFile)
+	}
+}
+
+func TestErrorsParsePanic(t *testing.T) {
+	tpl, err := ioutil.TempFile("", "panic-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tpl.Name())
+	tpl.WriteString("<p>{{.RequestID}}</p>")
+	tpl.Close()
+
+	handler, err := errorsParse(caddy.NewTestController("http", `errors {
+		panic_template `+tpl.Name()+`
+		crash_dir /var/lib/caddy/crashes
+		crash_log_lines 20
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handler.PanicTemplate == nil || handler.CrashDir != "/var/lib/caddy/crashes" || len(handler.recent.lines) != 20 {
+		t.Errorf("Unexpected panic handling %+v", handler)
+	}
+
+	for i, input := range []string{
+		"errors { panic_template /nonexistent/panic.html }",
+		"errors { crash_log_lines many }",
+	} {
+		if _, err := errorsParse(caddy.NewTestController("http", input)); err == nil {
+			t.Errorf("Test %d: Expected error for %q but got none", i, input)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package etag provides middleware that gives small dynamic
+// responses a strong ETag computed from their body, and answers
+// conditional requests for them with 304 Not Modified, so clients
+// that poll them do not download them again while unchanged.
+package etag
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// ETag is middleware that buffers successful responses no larger
+// than MaxSize, which do not have an ETag already, to tag them.
+type ETag struct {
+	Next httpserver.Handler
+
+	// Paths are the base paths of the responses tagged
+	Paths []string
+
+	// Responses larger than this are written through untagged
+	MaxSize int64
+}
+
+// DefaultMaxSize is the largest response tagged,
+// unless configured otherwise.
+const DefaultMaxSize = 512 << 10
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (e ETag) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodGet || !e.matches(r.URL.Path) {
+		return e.Next.ServeHTTP(w, r)
+	}
+
+	ew := &etagWriter{ResponseWriter: w, maxSize: e.MaxSize}
+	status, err := e.Next.ServeHTTP(ew, r)
+	if !ew.buffering {
+		return status, err
+	}
+	// errors are written further out, so there is nothing to tag
+	if status >= 400 {
+		return status, err
+	}
+
+	sum := sha256.Sum256(ew.buf.Bytes())
+	tag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", tag)
+	if noneMatch(r.Header.Get("If-None-Match"), tag) {
+		h := w.Header()
+		delete(h, "Content-Type")
+		delete(h, "Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return status, err
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(ew.buf.Len()))
+	w.WriteHeader(ew.status)
+	w.Write(ew.buf.Bytes())
+	return status, err
+}
+
+func (e ETag) matches(path string) bool {
+	for _, p := range e.Paths {
+		if httpserver.Path(path).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// noneMatch returns whether the If-None-Match header value
+// header lists tag, with the weak comparison RFC 7232 requires.
+func noneMatch(header, tag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagWriter buffers a successful response to tag it,
+// if it is not too large and not tagged already;
+// otherwise it writes the response through.
+type etagWriter struct {
+	http.ResponseWriter
+	buf         bytes.Buffer
+	maxSize     int64
+	status      int
+	wroteHeader bool
+	buffering   bool
+}
+
+// WriteHeader decides whether to buffer the response.
+func (w *etagWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	h := w.Header()
+	length, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+	if status == http.StatusOK && h.Get("ETag") == "" &&
+		!strings.HasPrefix(h.Get("Content-Type"), "text/event-stream") &&
+		(err != nil || length <= w.maxSize) {
+		w.buffering = true
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write buffers p, unless the response is not being
+// tagged or grows too large to be.
+func (w *etagWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.buffering {
+		return w.ResponseWriter.Write(p)
+	}
+	if int64(w.buf.Len()+len(p)) > w.maxSize {
+		if err := w.writeThrough(); err != nil {
+			return 0, err
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+// writeThrough writes what was buffered as it is,
+// and stops buffering.
+func (w *etagWriter) writeThrough() error {
+	w.buffering = false
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.buf.WriteTo(w.ResponseWriter)
+	return err
+}
+
+// Flush implements http.Flusher. Responses that are flushed
+// are being streamed, so they are written through untagged.
+func (w *etagWriter) Flush() {
+	if w.buffering {
+		if err := w.writeThrough(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	} else {
+		panic(httpserver.NonFlusherError{Underlying: w.ResponseWriter}) // should be recovered at the beginning of middleware stack
+	}
+}
+
+// Hijack implements http.Hijacker. It simply wraps the underlying
+// ResponseWriter's Hijack method if there is one, or returns an error.
+func (w *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, httpserver.NonHijackerError{Underlying: w.ResponseWriter}
+}
+
+// CloseNotify implements http.CloseNotifier.
+// It just inherits the underlying ResponseWriter's CloseNotify method.
+// It panics if the underlying ResponseWriter is not a CloseNotifier.
+func (w *etagWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	panic(httpserver.NonCloseNotifierError{Underlying: w.ResponseWriter})
+}
@@ -0,0 +1,118 @@
+package etag
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestETag(t *testing.T) {
+	body := "<p>dynamic</p>"
+	var status int
+	var header http.Header
+	e := ETag{
+		Paths:   []string{"/page", "/big", "/tagged", "/missing", "/stream"},
+		MaxSize: 100,
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			switch r.URL.Path {
+			case "/missing":
+				return http.StatusNotFound, nil
+			case "/big":
+				w.Write([]byte(strings.Repeat("x", 60)))
+				w.Write([]byte(strings.Repeat("x", 60)))
+				return 0, nil
+			case "/tagged":
+				w.Header().Set("ETag", `"v1"`)
+			case "/stream":
+				w.Write([]byte("event"))
+				w.(http.Flusher).Flush()
+			}
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+			return 0, nil
+		}),
+	}
+	serve := func(method, path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	status = http.StatusOK
+	header = http.Header{"Content-Type": {"text/html"}}
+	w := serve("GET", "/page", "")
+	tag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != body || tag == "" {
+		t.Fatalf("Expected tagged response, got %d %q with ETag %q", w.Code, w.Body.String(), tag)
+	}
+	if w.Header().Get("Content-Length") != "14" {
+		t.Errorf("Expected Content-Length 14, got %s", w.Header().Get("Content-Length"))
+	}
+	if again := serve("GET", "/page", "").Header().Get("ETag"); again != tag {
+		t.Errorf("Expected the same ETag for the same body, got %s and %s", tag, again)
+	}
+
+	for i, test := range []struct {
+		ifNoneMatch string
+		expected    int
+	}{
+		{tag, http.StatusNotModified},
+		{`"other", ` + tag, http.StatusNotModified},
+		{"W/" + tag, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{`"other"`, http.StatusOK},
+	} {
+		w := serve("GET", "/page", test.ifNoneMatch)
+		if w.Code != test.expected {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expected, w.Code)
+		}
+		if w.Code == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("Content-Type") != "") {
+			t.Errorf("Test %d: Expected no body and Content-Type, got %q and %q", i, w.Body.String(), w.Header().Get("Content-Type"))
+		}
+	}
+
+	// a different body gets a different tag
+	body = "<p>changed</p>"
+	if w := serve("GET", "/page", tag); w.Code != http.StatusOK || w.Header().Get("ETag") == tag {
+		t.Errorf("Expected changed response with a new ETag, got %d with %s", w.Code, w.Header().Get("ETag"))
+	}
+
+	for i, test := range []struct {
+		method, path string
+		status       int
+		header       http.Header
+	}{
+		{"GET", "/big", http.StatusOK, nil},
+		{"GET", "/tagged", http.StatusOK, nil},
+		{"GET", "/stream", http.StatusOK, nil},
+		{"GET", "/elsewhere", http.StatusOK, nil},
+		{"HEAD", "/page", http.StatusOK, nil},
+		{"POST", "/page", http.StatusOK, nil},
+		{"GET", "/page", http.StatusCreated, nil},
+		{"GET", "/page", http.StatusOK, http.Header{"Content-Length": {"1000"}}},
+		{"GET", "/page", http.StatusOK, http.Header{"Content-Type": {"text/event-stream"}}},
+	} {
+		status, header = test.status, test.header
+		w := serve(test.method, test.path, "")
+		if got := w.Header().Get("ETag"); got != "" && got != `"v1"` {
+			t.Errorf("Test %d: Expected response not to be tagged, got ETag %s", i, got)
+		}
+	}
+
+	if w := serve("GET", "/big", ""); w.Body.Len() != 120 {
+		t.Errorf("Expected large response written through whole, got %d bytes", w.Body.Len())
+	}
+	if w := serve("GET", "/missing", ""); w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("Expected error left for errors further out, got %d %q", w.Code, w.Body.String())
+	}
+}
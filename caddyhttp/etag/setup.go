@@ -0,0 +1,75 @@
+package etag
+
+import (
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("etag", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new ETag middleware instance.
+func setup(c *caddy.Controller) error {
+	e, err := etagParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		e.Next = next
+		return e
+	})
+
+	return nil
+}
+
+// etagParse parses the etag directive, of the form
+//
+//	etag [paths...] {
+//	    max_size size
+//	}
+//
+// Responses to GET requests to the paths, or to any path if
+// none are given, are tagged if they are no larger than size.
+func etagParse(c *caddy.Controller) (ETag, error) {
+	e := ETag{MaxSize: DefaultMaxSize}
+	seen := false
+
+	for c.Next() {
+		if seen {
+			return e, c.Err("etag: can only be specified once per site")
+		}
+		seen = true
+
+		e.Paths = c.RemainingArgs()
+		if len(e.Paths) == 0 {
+			e.Paths = []string{"/"}
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "max_size":
+				if !c.NextArg() {
+					return e, c.ArgErr()
+				}
+				size, err := humanize.ParseBytes(c.Val())
+				if err != nil || size == 0 {
+					return e, c.Errf("etag: invalid max_size '%s'", c.Val())
+				}
+				e.MaxSize = int64(size)
+				if c.NextArg() {
+					return e, c.ArgErr()
+				}
+			default:
+				return e, c.Errf("etag: unknown property '%s'", c.Val())
+			}
+		}
+	}
+
+	return e, nil
+}
@@ -0,0 +1,70 @@
+package etag
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `etag /api`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	e, ok := handler.(ETag)
+	if !ok {
+		t.Fatalf("Expected handler to be type ETag, got: %#v", handler)
+	}
+	if !httpserver.SameNext(e.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestETagParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		paths     []string
+		maxSize   int64
+	}{
+		{`etag`, false, []string{"/"}, DefaultMaxSize},
+		{`etag /api /status`, false, []string{"/api", "/status"}, DefaultMaxSize},
+		{`etag {
+			max_size 64KB
+		}`, false, []string{"/"}, 64000},
+		{`etag {
+			max_size
+		}`, true, nil, 0},
+		{`etag {
+			max_size lots
+		}`, true, nil, 0},
+		{`etag {
+			weak
+		}`, true, nil, 0},
+		{`etag /a
+		etag /b`, true, nil, 0},
+	} {
+		e, err := etagParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(e.Paths, test.paths) || e.MaxSize != test.maxSize {
+			t.Errorf("Test %d: Expected paths %v and max size %d, got %v and %d",
+				i, test.paths, test.maxSize, e.Paths, e.MaxSize)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Package exec provides middleware that runs commands when requests
+// are made to specific paths, for automation driven by webhooks.
+package exec
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Exec is middleware that runs the command of a rule when
+// a request is made to its path.
+type Exec struct {
+	Next  httpserver.Handler
+	Rules []*Rule
+}
+
+// Rule is a command that a request to Path runs. The command
+// is fixed; only its arguments may have placeholders, and each
+// argument stays one argument whatever it is replaced with,
+// since the command is not run by a shell. Requests for which
+// an argument would start with - only because of what its
+// placeholders were replaced with are refused, so that they
+// cannot pass options to the command.
+type Rule struct {
+	// Path is the path that runs the command
+	Path string
+
+	// Methods are the methods of requests that may run it
+	Methods []string
+
+	Command string
+	Args    []string
+
+	// Dir is the working directory of the command; if
+	// empty, that of the server
+	Dir string
+
+	// Env are variables, as NAME=value, added to the
+	// environment of the server for the command
+	Env []string
+
+	// Timeout is how long the command may run before it is killed
+	Timeout time.Duration
+
+	// MaxOutput is how much of the output of the command is kept
+	MaxOutput int64
+
+	// Async makes requests return before the command
+	// finishes, in which case its output is logged
+	Async bool
+
+	// slots has room for each command that may run at once
+	slots chan struct{}
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (e Exec) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, rule := range e.Rules {
+		if r.URL.Path != rule.Path {
+			continue
+		}
+		if !rule.allows(r.Method) {
+			w.Header().Set("Allow", strings.Join(rule.Methods, ", "))
+			return http.StatusMethodNotAllowed, nil
+		}
+		select {
+		case rule.slots <- struct{}{}:
+		default:
+			w.Header().Set("Retry-After", "1")
+			return http.StatusTooManyRequests, nil
+		}
+
+		// the replacer is made first, so the
+		// request body is available to it
+		repl := httpserver.NewReplacer(r, nil, "")
+		stdin, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			<-rule.slots
+			return http.StatusRequestEntityTooLarge, nil
+		}
+		args := make([]string, len(rule.Args))
+		for i, arg := range rule.Args {
+			args[i] = repl.Replace(arg)
+			if strings.HasPrefix(args[i], "-") && !strings.HasPrefix(arg, "-") {
+				// a value of the request would be taken as an option
+				<-rule.slots
+				return http.StatusBadRequest, nil
+			}
+		}
+
+		if rule.Async {
+			go func() {
+				defer func() { <-rule.slots }()
+				out, _, err := rule.run(args, stdin)
+				if err != nil {
+					log.Printf("[ERROR] exec %s: %v: %s", rule.Path, err, bytes.TrimSpace(out))
+				}
+			}()
+			httpserver.WriteTextResponse(w, http.StatusAccepted, "started\n")
+			return 0, nil
+		}
+
+		out, truncated, err := rule.run(args, stdin)
+		<-rule.slots
+		if truncated {
+			w.Header().Set("X-Output-Truncated", "true")
+		}
+		switch err {
+		case nil:
+			httpserver.WriteTextResponse(w, http.StatusOK, string(out))
+		case context.DeadlineExceeded:
+			log.Printf("[ERROR] exec %s: timed out after %v", rule.Path, rule.Timeout)
+			httpserver.WriteTextResponse(w, http.StatusGatewayTimeout, string(out))
+		default:
+			log.Printf("[ERROR] exec %s: %v", rule.Path, err)
+			httpserver.WriteTextResponse(w, http.StatusInternalServerError, string(out))
+		}
+		return 0, nil
+	}
+	return e.Next.ServeHTTP(w, r)
+}
+
+// allows returns whether requests with method may run the command.
+func (rule *Rule) allows(method string) bool {
+	for _, m := range rule.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// run runs the command with args and stdin, and returns what it
+// wrote to stdout and stderr, up to MaxOutput, and whether there
+// was more. The error is context.DeadlineExceeded if it timed out.
+func (rule *Rule) run(args []string, stdin []byte) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rule.Timeout)
+	defer cancel()
+
+	out := &cappedBuffer{max: rule.MaxOutput}
+	cmd := exec.CommandContext(ctx, rule.Command, args...)
+	cmd.Dir = rule.Dir
+	cmd.Env = append(os.Environ(), rule.Env...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err := cmd.Run()
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = context.DeadlineExceeded
+	}
+	return out.buf.Bytes(), out.truncated, err
+}
+
+// cappedBuffer keeps what is written to it up
+// to max bytes, and discards the rest.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int64
+	truncated bool
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	if room := c.max - int64(c.buf.Len()); int64(len(p)) > room {
+		c.buf.Write(p[:room])
+		c.truncated = true
+		return len(p), nil
+	}
+	return c.buf.Write(p)
+}
+
+// maxBodySize is the size limit of the body of a request,
+// which is given to the command as its standard input.
+const maxBodySize = 1 << 20
@@ -0,0 +1,107 @@
+package exec
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func newRule(t *testing.T, path, command string, args ...string) *Rule {
+	name, err := exec.LookPath(command)
+	if err != nil {
+		t.Skipf("%s is not installed", command)
+	}
+	return &Rule{
+		Path:      path,
+		Methods:   []string{"POST"},
+		Command:   name,
+		Args:      args,
+		Timeout:   defaultTimeout,
+		MaxOutput: defaultMaxOutput,
+		slots:     make(chan struct{}, 1),
+	}
+}
+
+func TestExec(t *testing.T) {
+	echo := newRule(t, "/hooks/echo", "echo", "{query}", "{>X-Name}")
+	cat := newRule(t, "/hooks/cat", "cat")
+	fail := newRule(t, "/hooks/fail", "sh", "-c", "echo oops; exit 3")
+	slow := newRule(t, "/hooks/slow", "sleep", "5")
+	slow.Timeout = 50 * time.Millisecond
+	long := newRule(t, "/hooks/long", "echo", "0123456789")
+	long.MaxOutput = 4
+	option := newRule(t, "/hooks/option", "echo", "--ref={query}")
+	e := Exec{
+		Next:  httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) { return http.StatusTeapot, nil }),
+		Rules: []*Rule{echo, cat, fail, slow, long, option},
+	}
+
+	for i, test := range []struct {
+		method, path, body string
+		status             int
+		output             string
+	}{
+		{"POST", "/hooks/echo?ref=main", "", http.StatusOK, "ref=main x; rm -rf /\n"},
+		{"POST", "/hooks/cat", "payload", http.StatusOK, "payload"},
+		{"POST", "/hooks/fail", "", http.StatusInternalServerError, "oops\n"},
+		{"POST", "/hooks/slow", "", http.StatusGatewayTimeout, ""},
+		{"POST", "/hooks/long", "", http.StatusOK, "0123"},
+		{"GET", "/hooks/echo", "", http.StatusMethodNotAllowed, ""},
+		{"POST", "/hooks/echo/more", "", http.StatusTeapot, ""},
+		{"POST", "/hooks/echo?--output=/etc/x", "", http.StatusBadRequest, ""},
+		{"POST", "/hooks/option?-n", "", http.StatusOK, "--ref=-n\n"},
+	} {
+		r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		r.Header.Set("X-Name", "x; rm -rf /")
+		w := httptest.NewRecorder()
+		status, err := e.ServeHTTP(w, r)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if status == 0 {
+			status = w.Code
+		}
+		if status != test.status {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.status, status)
+		}
+		if w.Body.String() != test.output {
+			t.Errorf("Test %d: Expected output %q, got %q", i, test.output, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("POST", "/hooks/long", nil))
+	if w.Header().Get("X-Output-Truncated") != "true" {
+		t.Error("Expected truncated output to be marked")
+	}
+}
+
+func TestExecConcurrency(t *testing.T) {
+	rule := newRule(t, "/hooks/slow", "sleep", "5")
+	rule.Timeout = 200 * time.Millisecond
+	rule.Async = true
+	e := Exec{Next: httpserver.EmptyNext, Rules: []*Rule{rule}}
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("POST", "/hooks/slow", nil))
+	if w.Code != http.StatusAccepted {
+		t.Errorf("Expected the first request to be accepted, got %d", w.Code)
+	}
+	status, _ := e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/hooks/slow", nil))
+	if status != http.StatusTooManyRequests {
+		t.Errorf("Expected the second request to be refused with %d, got %d", http.StatusTooManyRequests, status)
+	}
+
+	// the slot is freed once the command is killed
+	time.Sleep(500 * time.Millisecond)
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("POST", "/hooks/slow", nil))
+	if w.Code != http.StatusAccepted {
+		t.Errorf("Expected a request after the command ended to be accepted, got %d", w.Code)
+	}
+}
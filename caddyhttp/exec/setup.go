@@ -0,0 +1,149 @@
+package exec
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("exec", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Exec middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := execParse(c)
+	if err != nil {
+		return err
+	}
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Exec{Next: next, Rules: rules}
+	})
+	return nil
+}
+
+// execParse parses the exec directives, which have the form
+//
+//	exec path command [args...] {
+//	    method      methods...
+//	    timeout     duration
+//	    max_output  size
+//	    concurrency n
+//	    dir         dir
+//	    env         name value
+//	    async
+//	}
+//
+// The command must be installed; its arguments may have placeholders,
+// but not ones that make them start with -, which would be options.
+// Only POST requests run it by default. It may run for 30 seconds
+// and keep 1 MB of output by default, and only once at a time.
+func execParse(c *caddy.Controller) ([]*Rule, error) {
+	var rules []*Rule
+	paths := make(map[string]bool)
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) < 2 {
+			return nil, c.ArgErr()
+		}
+		if !strings.HasPrefix(args[0], "/") {
+			return nil, c.Errf("exec: invalid path '%s'", args[0])
+		}
+		if paths[args[0]] {
+			return nil, c.Errf("exec: duplicate path '%s'", args[0])
+		}
+		paths[args[0]] = true
+		if strings.Contains(args[1], "{") {
+			return nil, c.Errf("exec: command '%s' may not have placeholders", args[1])
+		}
+		command, err := exec.LookPath(args[1])
+		if err != nil {
+			return nil, c.Errf("exec: %v", err)
+		}
+		rule := &Rule{
+			Path:      args[0],
+			Methods:   []string{"POST"},
+			Command:   command,
+			Args:      args[2:],
+			Timeout:   defaultTimeout,
+			MaxOutput: defaultMaxOutput,
+		}
+		concurrency := 1
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "method":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				rule.Methods = nil
+				for _, m := range args {
+					rule.Methods = append(rule.Methods, strings.ToUpper(m))
+				}
+			case "timeout":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				rule.Timeout, err = time.ParseDuration(args[0])
+				if err != nil || rule.Timeout <= 0 {
+					return nil, c.Errf("exec: invalid timeout '%s'", args[0])
+				}
+			case "max_output":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				size, err := humanize.ParseBytes(args[0])
+				if err != nil || size == 0 {
+					return nil, c.Errf("exec: invalid max_output '%s'", args[0])
+				}
+				rule.MaxOutput = int64(size)
+			case "concurrency":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				concurrency, err = strconv.Atoi(args[0])
+				if err != nil || concurrency < 1 {
+					return nil, c.Errf("exec: invalid concurrency '%s'", args[0])
+				}
+			case "dir":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				rule.Dir = args[0]
+			case "env":
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				if args[0] == "" || strings.Contains(args[0], "=") {
+					return nil, c.Errf("exec: invalid env name '%s'", args[0])
+				}
+				rule.Env = append(rule.Env, args[0]+"="+args[1])
+			case "async":
+				if len(args) != 0 {
+					return nil, c.ArgErr()
+				}
+				rule.Async = true
+			default:
+				return nil, c.Errf("exec: unknown property '%s'", what)
+			}
+		}
+		rule.slots = make(chan struct{}, concurrency)
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+const (
+	defaultTimeout   = 30 * time.Second
+	defaultMaxOutput = 1 << 20
+)
@@ -0,0 +1,97 @@
+package exec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `exec /hooks/deploy echo deploying`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Exec)
+	if !ok {
+		t.Fatalf("Expected handler to be type Exec, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestExecParse(t *testing.T) {
+	tests := []struct {
+		input       string
+		shouldErr   bool
+		rules       int
+		concurrency int
+	}{
+		{`exec /hooks/deploy echo {query}`, false, 1, 1},
+		{`exec /hooks/deploy echo {
+			method      post PUT
+			timeout     5m
+			max_output  64KB
+			concurrency 2
+			dir         /tmp
+			env         STAGE production
+			async
+		}
+		exec /hooks/test echo`, false, 2, 2},
+		{`exec /hooks/deploy`, true, 0, 0},
+		{`exec hooks/deploy echo`, true, 0, 0},
+		{`exec /hooks/deploy echo
+		exec /hooks/deploy echo`, true, 0, 0},
+		{`exec /hooks/deploy {>X-Command}`, true, 0, 0},
+		{`exec /hooks/deploy no-such-command-anywhere`, true, 0, 0},
+		{"exec /hooks/deploy echo {\ntimeout 0s\n}", true, 0, 0},
+		{"exec /hooks/deploy echo {\nmax_output lots\n}", true, 0, 0},
+		{"exec /hooks/deploy echo {\nconcurrency 0\n}", true, 0, 0},
+		{"exec /hooks/deploy echo {\nenv A=B c\n}", true, 0, 0},
+		{"exec /hooks/deploy echo {\nasync yes\n}", true, 0, 0},
+		{"exec /hooks/deploy echo {\nshell bash\n}", true, 0, 0},
+	}
+	for i, test := range tests {
+		rules, err := execParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if len(rules) != test.rules {
+			t.Errorf("Test %d: Expected %d rules, got %d", i, test.rules, len(rules))
+			continue
+		}
+		if cap(rules[0].slots) != test.concurrency {
+			t.Errorf("Test %d: Expected concurrency %d, got %d", i, test.concurrency, cap(rules[0].slots))
+		}
+	}
+
+	rules, err := execParse(caddy.NewTestController("http", "exec /hooks/deploy echo {\nmethod post PUT\ntimeout 5m\nmax_output 64KB\nenv STAGE production\nasync\n}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := rules[0]
+	if len(rule.Methods) != 2 || rule.Methods[0] != "POST" || rule.Methods[1] != "PUT" {
+		t.Errorf("Expected methods POST and PUT, got %v", rule.Methods)
+	}
+	if rule.Timeout != 5*time.Minute || rule.MaxOutput != 64000 || !rule.Async {
+		t.Errorf("Expected timeout 5m, max output 64000 and async, got %v, %d and %v", rule.Timeout, rule.MaxOutput, rule.Async)
+	}
+	if len(rule.Env) != 1 || rule.Env[0] != "STAGE=production" {
+		t.Errorf("Expected env STAGE=production, got %v", rule.Env)
+	}
+}
@@ -0,0 +1,150 @@
+// Package expectct provides middleware that sends the Expect-CT
+// header and, optionally, a report-only set of public key pins,
+// and receives the reports browsers send about violations of
+// them, so that interception of TLS connections to a site by
+// certificates it does not know of can be noticed.
+package expectct
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// ExpectCT is middleware that adds the Expect-CT header, and
+// Public-Key-Pins-Report-Only if there are Pins, to responses
+// to requests over TLS. Browsers ignore them over plain HTTP.
+type ExpectCT struct {
+	Next httpserver.Handler
+
+	// MaxAge is how long browsers expect certificates
+	// of the site to be logged for CT
+	MaxAge time.Duration
+
+	// Enforce makes browsers refuse connections with
+	// certificates that are not logged, rather than
+	// only reporting them
+	Enforce bool
+
+	// Report is where browsers send reports to: a URL, or a
+	// path on the site, which is served by this middleware
+	Report string
+
+	// Pins are the SHA-256 hashes of the public keys, base64
+	// encoded, that a certificate chain of the site should
+	// have one of; violations are only reported
+	Pins              []string
+	PinMaxAge         time.Duration
+	IncludeSubdomains bool
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (e ExpectCT) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if e.servesReports() && r.URL.Path == e.Report {
+		return e.receive(w, r)
+	}
+	if r.TLS != nil {
+		reportURI := e.reportURI(r)
+		w.Header().Set("Expect-CT", e.expectCT(reportURI))
+		if len(e.Pins) > 0 && reportURI != "" {
+			w.Header().Set("Public-Key-Pins-Report-Only", e.pins(reportURI))
+		}
+	}
+	return e.Next.ServeHTTP(w, r)
+}
+
+func (e ExpectCT) servesReports() bool {
+	return strings.HasPrefix(e.Report, "/")
+}
+
+// reportURI returns the absolute URL of the reports for r.
+func (e ExpectCT) reportURI(r *http.Request) string {
+	if !e.servesReports() {
+		return e.Report
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + e.Report
+}
+
+func (e ExpectCT) expectCT(reportURI string) string {
+	value := "max-age=" + strconv.Itoa(int(e.MaxAge.Seconds()))
+	if e.Enforce {
+		value += ", enforce"
+	}
+	if reportURI != "" {
+		value += `, report-uri="` + reportURI + `"`
+	}
+	return value
+}
+
+func (e ExpectCT) pins(reportURI string) string {
+	var values []string
+	for _, pin := range e.Pins {
+		values = append(values, `pin-sha256="`+pin+`"`)
+	}
+	values = append(values, "max-age="+strconv.Itoa(int(e.PinMaxAge.Seconds())))
+	if e.IncludeSubdomains {
+		values = append(values, "includeSubDomains")
+	}
+	values = append(values, `report-uri="`+reportURI+`"`)
+	return strings.Join(values, "; ")
+}
+
+// receive logs the violation report r carries.
+func (e ExpectCT) receive(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		return http.StatusMethodNotAllowed, nil
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxReportSize))
+	if err != nil {
+		return http.StatusRequestEntityTooLarge, nil
+	}
+	kind, host, err := parseReport(body)
+	if err != nil {
+		return http.StatusBadRequest, nil
+	}
+	var compact bytes.Buffer
+	json.Compact(&compact, body)
+	log.Printf("[WARNING] %s violation reported for %s by %s: %s", kind, host, r.RemoteAddr, compact.String())
+	return http.StatusNoContent, nil
+}
+
+// parseReport returns the kind of the violation that report is
+// about, Expect-CT or key pinning, and the host it happened on.
+func parseReport(report []byte) (kind, host string, err error) {
+	var fields struct {
+		ExpectCT *struct {
+			Hostname string `json:"hostname"`
+			Port     int    `json:"port"`
+		} `json:"expect-ct-report"`
+		Hostname string `json:"hostname"`
+		Port     int    `json:"port"`
+	}
+	if err := json.Unmarshal(report, &fields); err != nil {
+		return "", "", err
+	}
+	if ct := fields.ExpectCT; ct != nil {
+		return "Expect-CT", ct.Hostname + ":" + strconv.Itoa(ct.Port), nil
+	}
+	if fields.Hostname == "" {
+		return "", "", errUnknownReport
+	}
+	return "Public key pinning", fields.Hostname + ":" + strconv.Itoa(fields.Port), nil
+}
+
+var errUnknownReport = errors.New("unknown report")
+
+// maxReportSize is the size limit of a report.
+const maxReportSize = 64 << 10
@@ -0,0 +1,87 @@
+package expectct
+
+import (
+	"bytes"
+	"crypto/tls"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestServeHTTP(t *testing.T) {
+	e := ExpectCT{
+		Next:              httpserver.EmptyNext,
+		MaxAge:            time.Hour,
+		Enforce:           true,
+		Report:            "/ct-report",
+		Pins:              []string{pin1, pin2},
+		PinMaxAge:         time.Minute,
+		IncludeSubdomains: true,
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Expect-CT"); got != "" {
+		t.Errorf("Expected no header over HTTP, got %s", got)
+	}
+
+	req = httptest.NewRequest("GET", "https://example.com/", nil)
+	req.TLS = new(tls.ConnectionState)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if got, want := rec.Header().Get("Expect-CT"), `max-age=3600, enforce, report-uri="https://example.com/ct-report"`; got != want {
+		t.Errorf("Expected Expect-CT %s, got %s", want, got)
+	}
+	want := `pin-sha256="` + pin1 + `"; pin-sha256="` + pin2 + `"; max-age=60; includeSubDomains; report-uri="https://example.com/ct-report"`
+	if got := rec.Header().Get("Public-Key-Pins-Report-Only"); got != want {
+		t.Errorf("Expected Public-Key-Pins-Report-Only %s, got %s", want, got)
+	}
+
+	e = ExpectCT{Next: httpserver.EmptyNext, MaxAge: time.Hour, Report: "https://report.example.net/ct"}
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if got, want := rec.Header().Get("Expect-CT"), `max-age=3600, report-uri="https://report.example.net/ct"`; got != want {
+		t.Errorf("Expected Expect-CT %s, got %s", want, got)
+	}
+}
+
+func TestReports(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	e := ExpectCT{Next: httpserver.EmptyNext, Report: "/ct-report"}
+	for i, test := range []struct {
+		method, body string
+		status       int
+		logged       string
+	}{
+		{"POST", `{"expect-ct-report": {"hostname": "example.com", "port": 443, "scts": []}}`, http.StatusNoContent, "Expect-CT violation reported for example.com:443"},
+		{"POST", `{"hostname": "example.com", "port": 443, "known-pins": []}`, http.StatusNoContent, "Public key pinning violation reported for example.com:443"},
+		{"POST", `{"other": true}`, http.StatusBadRequest, ""},
+		{"POST", `not json`, http.StatusBadRequest, ""},
+		{"POST", `{"hostname": "` + strings.Repeat("a", maxReportSize) + `"}`, http.StatusRequestEntityTooLarge, ""},
+		{"GET", ``, http.StatusMethodNotAllowed, ""},
+	} {
+		buf.Reset()
+		req := httptest.NewRequest(test.method, "https://example.com/ct-report", strings.NewReader(test.body))
+		rec := httptest.NewRecorder()
+		status, err := e.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if status != test.status {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.status, status)
+		}
+		if !strings.Contains(buf.String(), test.logged) || (test.logged == "" && buf.Len() > 0) {
+			t.Errorf("Test %d: Expected log %q, got %q", i, test.logged, buf.String())
+		}
+	}
+}
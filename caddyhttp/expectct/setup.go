@@ -0,0 +1,152 @@
+package expectct
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("expect_ct", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
+	})
+}
+
+// setup configures a new ExpectCT middleware instance. Syntax:
+//
+//	expect_ct [max_age] {
+//	    enforce
+//	    report             path|url
+//	    pin                sha256
+//	    pin_max_age        max_age
+//	    include_subdomains
+//	}
+//
+// The max age defaults to 24h. If report is a path on the
+// site, reports sent to it are logged. Pins are base64 SHA-256
+// hashes of public keys; at least two are needed, including a
+// backup, and a report location, as pins are only reported.
+func setup(c *caddy.Controller) error {
+	e, err := expectCTParse(c)
+	if err != nil {
+		return err
+	}
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		e.Next = next
+		return e
+	})
+	return nil
+}
+
+func expectCTParse(c *caddy.Controller) (ExpectCT, error) {
+	e := ExpectCT{MaxAge: DefaultMaxAge, PinMaxAge: DefaultMaxAge}
+	var seen bool
+	for c.Next() {
+		if seen {
+			return e, c.Err("expect_ct: can only be specified once per site")
+		}
+		seen = true
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			maxAge, err := parseMaxAge(args[0])
+			if err != nil {
+				return e, c.Errf("expect_ct: invalid max age '%s'", args[0])
+			}
+			e.MaxAge = maxAge
+		default:
+			return e, c.ArgErr()
+		}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "enforce":
+				if c.NextArg() {
+					return e, c.ArgErr()
+				}
+				e.Enforce = true
+			case "report":
+				if !c.NextArg() {
+					return e, c.ArgErr()
+				}
+				if !validReport(c.Val()) {
+					return e, c.Errf("expect_ct: invalid report location '%s'", c.Val())
+				}
+				e.Report = c.Val()
+				if c.NextArg() {
+					return e, c.ArgErr()
+				}
+			case "pin":
+				if !c.NextArg() {
+					return e, c.ArgErr()
+				}
+				if hash, err := base64.StdEncoding.DecodeString(c.Val()); err != nil || len(hash) != 32 {
+					return e, c.Errf("expect_ct: invalid pin '%s'", c.Val())
+				}
+				e.Pins = append(e.Pins, c.Val())
+				if c.NextArg() {
+					return e, c.ArgErr()
+				}
+			case "pin_max_age":
+				if !c.NextArg() {
+					return e, c.ArgErr()
+				}
+				maxAge, err := parseMaxAge(c.Val())
+				if err != nil {
+					return e, c.Errf("expect_ct: invalid pin max age '%s'", c.Val())
+				}
+				e.PinMaxAge = maxAge
+				if c.NextArg() {
+					return e, c.ArgErr()
+				}
+			case "include_subdomains":
+				if c.NextArg() {
+					return e, c.ArgErr()
+				}
+				e.IncludeSubdomains = true
+			default:
+				return e, c.Errf("expect_ct: unknown property '%s'", c.Val())
+			}
+		}
+	}
+	if len(e.Pins) > 0 {
+		if len(e.Pins) < 2 {
+			return e, c.Err("expect_ct: at least two pins are needed, one of them a backup")
+		}
+		if e.Report == "" {
+			return e, c.Err("expect_ct: pins need a report location")
+		}
+	}
+	return e, nil
+}
+
+// parseMaxAge parses a duration, or a number of seconds.
+func parseMaxAge(s string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(s); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d < 0 {
+		err = strconv.ErrRange
+	}
+	return d, err
+}
+
+func validReport(s string) bool {
+	if strings.HasPrefix(s, "/") {
+		return true
+	}
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+// DefaultMaxAge is how long browsers remember the policy by default.
+const DefaultMaxAge = 24 * time.Hour
@@ -0,0 +1,81 @@
+package expectct
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `expect_ct 1h`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler, ok := mids[0](httpserver.EmptyNext).(ExpectCT)
+	if !ok {
+		t.Fatalf("Expected handler to be type ExpectCT, got: %#v", mids[0](httpserver.EmptyNext))
+	}
+	if !httpserver.SameNext(handler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if handler.MaxAge != time.Hour {
+		t.Errorf("Expected max age 1h, got %v", handler.MaxAge)
+	}
+}
+
+const (
+	pin1 = "d6qzRu9zOECb90Uez27xWltNsj0e1Md7GkYYkVoZWmM="
+	pin2 = "E9CZ9INDbd+2eRQozYqqbQ2yXLVKB9+xcprMF+44U1g="
+)
+
+func TestExpectCTParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  ExpectCT
+	}{
+		{`expect_ct`, false, ExpectCT{MaxAge: DefaultMaxAge, PinMaxAge: DefaultMaxAge}},
+		{`expect_ct 86400`, false, ExpectCT{MaxAge: 24 * time.Hour, PinMaxAge: DefaultMaxAge}},
+		{"expect_ct 30m {\n enforce\n report /ct-report\n}", false, ExpectCT{
+			MaxAge: 30 * time.Minute, PinMaxAge: DefaultMaxAge, Enforce: true, Report: "/ct-report",
+		}},
+		{"expect_ct {\n report https://example.report-uri.com/r/d/ct\n pin " + pin1 + "\n pin " + pin2 + "\n pin_max_age 1h\n include_subdomains\n}", false, ExpectCT{
+			MaxAge: DefaultMaxAge, Report: "https://example.report-uri.com/r/d/ct",
+			Pins: []string{pin1, pin2}, PinMaxAge: time.Hour, IncludeSubdomains: true,
+		}},
+		{`expect_ct -1`, true, ExpectCT{}},
+		{`expect_ct soon`, true, ExpectCT{}},
+		{`expect_ct 1h 2h`, true, ExpectCT{}},
+		{"expect_ct {\n report example.com\n}", true, ExpectCT{}},
+		{"expect_ct {\n report\n}", true, ExpectCT{}},
+		{"expect_ct {\n enforce now\n}", true, ExpectCT{}},
+		{"expect_ct {\n pin abc\n}", true, ExpectCT{}},
+		{"expect_ct {\n report /r\n pin " + pin1 + "\n}", true, ExpectCT{}},
+		{"expect_ct {\n pin " + pin1 + "\n pin " + pin2 + "\n}", true, ExpectCT{}},
+		{"expect_ct {\n pin_max_age forever\n}", true, ExpectCT{}},
+		{"expect_ct {\n strict\n}", true, ExpectCT{}},
+		{"expect_ct\nexpect_ct", true, ExpectCT{}},
+	} {
+		actual, err := expectCTParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Package experiment implements A/B testing and feature flags. It
+// assigns each client to one of the named buckets of an experiment,
+// deterministically and in proportion to the buckets' weights, and
+// makes the assignment available as the {experiment.name} placeholder
+// and a cookie. Buckets can be served from their own root or have
+// their requests rewritten; rewriting to a path that a separate
+// proxy directive handles sends a bucket to its own upstream pool.
+package experiment
+
+import (
+	"hash/fnv"
+	"net"
+	"net/http"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/rewrite"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+// Experiment is middleware that assigns requests to
+// the buckets of experiments.
+type Experiment struct {
+	Next    httpserver.Handler
+	Configs []Config
+	FileSys http.FileSystem
+}
+
+// Config is an experiment.
+type Config struct {
+	// Name of the experiment, used in its placeholder
+	Name string
+
+	// Base path of requests the experiment applies to
+	PathScope string
+
+	// Buckets clients are assigned to
+	Buckets []Bucket
+
+	// What to hash to assign a client: KeyIP, KeyCookie or KeyHeader
+	Key string
+
+	// Name of the cookie or header hashed, for KeyCookie or KeyHeader
+	KeyName string
+
+	// Name of the cookie that remembers the assignment;
+	// if empty, no cookie is used
+	Cookie string
+
+	// Max-Age of the cookie, in seconds
+	CookieMaxAge int
+}
+
+// Bucket is a variant of an experiment.
+type Bucket struct {
+	Name string
+
+	// Share of clients assigned to the bucket, relative
+	// to the weights of the other buckets
+	Weight int
+
+	// Directory to serve static files from, if not the site's root
+	Root string
+
+	// Destination to rewrite requests to, with placeholders
+	Rewrite string
+}
+
+// Keys that clients can be assigned by.
+const (
+	KeyIP     = "ip"
+	KeyCookie = "cookie"
+	KeyHeader = "header"
+)
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (e Experiment) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for i := range e.Configs {
+		cfg := &e.Configs[i]
+		if !httpserver.Path(r.URL.Path).Matches(cfg.PathScope) {
+			continue
+		}
+
+		// the response depends on what the client is assigned by,
+		// so caches must know that
+		if cfg.Key == KeyHeader {
+			w.Header().Add("Vary", cfg.KeyName)
+		}
+		if cfg.Key == KeyCookie || cfg.Cookie != "" {
+			w.Header().Add("Vary", "Cookie")
+		}
+
+		bucket := cfg.Assign(r)
+		r = httpserver.SetRequestPlaceholder(r, "experiment."+cfg.Name, bucket.Name)
+
+		if cfg.Cookie != "" {
+			if c, err := r.Cookie(cfg.Cookie); err != nil || c.Value != bucket.Name {
+				http.SetCookie(w, &http.Cookie{
+					Name:   cfg.Cookie,
+					Value:  bucket.Name,
+					Path:   "/",
+					MaxAge: cfg.CookieMaxAge,
+					Secure: r.TLS != nil,
+				})
+			}
+		}
+
+		fs := e.FileSys
+		if bucket.Root != "" {
+			fs = http.Dir(bucket.Root)
+			r = staticfiles.WithRoot(r, fs)
+		}
+		if bucket.Rewrite != "" {
+			replacer := httpserver.NewReplacer(r, nil, "")
+			rewrite.To(fs, r, bucket.Rewrite, replacer)
+		}
+	}
+
+	return e.Next.ServeHTTP(w, r)
+}
+
+// Assign returns the bucket the client of r is in. A client that
+// has the cookie of the experiment stays in the bucket named in it,
+// unless that bucket's weight is 0; other clients are assigned by
+// hashing their key, so that the same client always gets the same
+// bucket as long as the buckets and their weights stay the same.
+func (cfg *Config) Assign(r *http.Request) *Bucket {
+	if cfg.Cookie != "" {
+		if c, err := r.Cookie(cfg.Cookie); err == nil {
+			for i := range cfg.Buckets {
+				if cfg.Buckets[i].Name == c.Value && cfg.Buckets[i].Weight > 0 {
+					return &cfg.Buckets[i]
+				}
+			}
+		}
+	}
+
+	var total int
+	for _, b := range cfg.Buckets {
+		total += b.Weight
+	}
+	h := fnv.New32a()
+	h.Write([]byte(cfg.Name + "/" + cfg.key(r)))
+	n := int(h.Sum32() % uint32(total))
+	for i := range cfg.Buckets {
+		if n < cfg.Buckets[i].Weight {
+			return &cfg.Buckets[i]
+		}
+		n -= cfg.Buckets[i].Weight
+	}
+	return &cfg.Buckets[len(cfg.Buckets)-1] // not reached
+}
+
+// key returns the value identifying the client of r.
+// Clients without the configured cookie or header
+// are identified by their IP address.
+func (cfg *Config) key(r *http.Request) string {
+	switch cfg.Key {
+	case KeyCookie:
+		if c, err := r.Cookie(cfg.KeyName); err == nil && c.Value != "" {
+			return c.Value
+		}
+	case KeyHeader:
+		if v := r.Header.Get(cfg.KeyName); v != "" {
+			return v
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,101 @@
+package experiment
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestAssign(t *testing.T) {
+	cfg := Config{
+		Name:    "checkout",
+		Key:     KeyIP,
+		Buckets: []Bucket{{Name: "a", Weight: 3}, {Name: "b", Weight: 1}},
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "10.0." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256) + ":1234"
+		bucket := cfg.Assign(r)
+		counts[bucket.Name]++
+
+		// the same client must always get the same bucket
+		r.RemoteAddr = "10.0." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256) + ":5678"
+		if again := cfg.Assign(r); again != bucket {
+			t.Fatalf("Client %d: Assigned %s, then %s", i, bucket.Name, again.Name)
+		}
+	}
+	if counts["a"] < 2700 || counts["a"] > 3300 {
+		t.Errorf("Expected about 3000 clients in bucket a, got %d", counts["a"])
+	}
+
+	// the cookie takes precedence, unless its bucket is turned off
+	cfg.Cookie = "exp"
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, name := range []string{"a", "b"} {
+		r.Header.Set("Cookie", "exp="+name)
+		if bucket := cfg.Assign(r); bucket.Name != name {
+			t.Errorf("Expected bucket %s from cookie, got %s", name, bucket.Name)
+		}
+	}
+	cfg.Buckets[1].Weight = 0
+	if bucket := cfg.Assign(r); bucket.Name != "a" {
+		t.Errorf("Expected bucket a instead of turned off bucket, got %s", bucket.Name)
+	}
+}
+
+func TestExperiment(t *testing.T) {
+	var gotPath, gotBucket string
+	e := Experiment{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			gotPath = r.URL.Path
+			gotBucket = httpserver.NewReplacer(r, nil, "").Replace("{experiment.checkout}")
+			return http.StatusOK, nil
+		}),
+		Configs: []Config{{
+			Name:      "checkout",
+			PathScope: "/shop",
+			Key:       KeyHeader,
+			KeyName:   "X-User",
+			Cookie:    "exp",
+			Buckets: []Bucket{
+				{Name: "old", Weight: 0},
+				{Name: "new", Weight: 1, Rewrite: "/new{uri}"},
+			},
+		}},
+		FileSys: http.Dir("."),
+	}
+
+	r := httptest.NewRequest("GET", "/shop/cart", nil)
+	r.Header.Set("X-User", "alice")
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, r)
+	if gotBucket != "new" {
+		t.Errorf("Expected placeholder to be 'new', got '%s'", gotBucket)
+	}
+	if gotPath != "/new/shop/cart" {
+		t.Errorf("Expected path to be rewritten to /new/shop/cart, got %s", gotPath)
+	}
+	if got := w.Header().Get("Set-Cookie"); got == "" {
+		t.Error("Expected assignment cookie to be set")
+	}
+	if got := w.Header()["Vary"]; len(got) != 2 || got[0] != "X-User" || got[1] != "Cookie" {
+		t.Errorf("Expected Vary on X-User and Cookie, got %v", got)
+	}
+
+	// requests outside the path scope are left alone
+	gotBucket = ""
+	r = httptest.NewRequest("GET", "/about", nil)
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, r)
+	if gotPath != "/about" || gotBucket != "" {
+		t.Errorf("Expected request outside scope to be unchanged, got path %s and bucket '%s'", gotPath, gotBucket)
+	}
+	if len(w.Header()) != 0 {
+		t.Errorf("Expected no headers outside scope, got %v", w.Header())
+	}
+}
@@ -0,0 +1,162 @@
+package experiment
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("experiment", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Experiment middleware instance.
+func setup(c *caddy.Controller) error {
+	if err := httpserver.CheckStaticRoot(c); err != nil {
+		return err
+	}
+	configs, err := experimentParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	fileSys := cfg.FileSystem()
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Experiment{Next: next, Configs: configs, FileSys: fileSys}
+	})
+
+	return nil
+}
+
+// experimentParse parses experiment directives. Syntax:
+//
+//	experiment name [path] {
+//	    bucket  name weight
+//	    key     ip | cookie name | header name
+//	    cookie  name [max_age] | off
+//	    root    bucket directory
+//	    rewrite bucket to...
+//	}
+//
+// At least one bucket with a positive weight is required.
+// Clients are assigned by IP address and remembered with
+// a cookie named after the experiment by default.
+func experimentParse(c *caddy.Controller) ([]Config, error) {
+	var configs []Config
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) < 1 || len(args) > 2 {
+			return configs, c.ArgErr()
+		}
+		cfg := Config{
+			Name:         args[0],
+			PathScope:    "/",
+			Key:          KeyIP,
+			Cookie:       "caddy_exp_" + args[0],
+			CookieMaxAge: defaultCookieMaxAge,
+		}
+		if len(args) > 1 {
+			cfg.PathScope = args[1]
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "bucket":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return configs, c.ArgErr()
+				}
+				weight, err := strconv.Atoi(args[1])
+				if err != nil || weight < 0 {
+					return configs, c.Errf("invalid weight '%s'", args[1])
+				}
+				if cfg.bucket(args[0]) != nil {
+					return configs, c.Errf("duplicate bucket '%s'", args[0])
+				}
+				cfg.Buckets = append(cfg.Buckets, Bucket{Name: args[0], Weight: weight})
+			case "key":
+				args := c.RemainingArgs()
+				switch {
+				case len(args) == 1 && args[0] == KeyIP:
+				case len(args) == 2 && (args[0] == KeyCookie || args[0] == KeyHeader):
+					cfg.KeyName = args[1]
+				default:
+					return configs, c.ArgErr()
+				}
+				cfg.Key = args[0]
+			case "cookie":
+				args := c.RemainingArgs()
+				switch {
+				case len(args) == 1 && args[0] == "off":
+					cfg.Cookie = ""
+				case len(args) == 1:
+					cfg.Cookie = args[0]
+				case len(args) == 2:
+					cfg.Cookie = args[0]
+					maxAge, err := strconv.Atoi(args[1])
+					if err != nil || maxAge < 0 {
+						return configs, c.Errf("invalid cookie max age '%s'", args[1])
+					}
+					cfg.CookieMaxAge = maxAge
+				default:
+					return configs, c.ArgErr()
+				}
+			case "root", "rewrite":
+				property := c.Val()
+				args := c.RemainingArgs()
+				if len(args) < 2 || (property == "root" && len(args) != 2) {
+					return configs, c.ArgErr()
+				}
+				bucket := cfg.bucket(args[0])
+				if bucket == nil {
+					return configs, c.Errf("unknown bucket '%s'; buckets must be defined before their %s", args[0], property)
+				}
+				if property == "root" {
+					bucket.Root = args[1]
+				} else {
+					bucket.Rewrite = strings.Join(args[1:], " ")
+				}
+			default:
+				return configs, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+
+		var total int
+		for _, b := range cfg.Buckets {
+			total += b.Weight
+		}
+		if total == 0 {
+			return configs, c.Errf("experiment %s: at least one bucket with a positive weight is required", cfg.Name)
+		}
+		for _, existing := range configs {
+			if existing.Name == cfg.Name {
+				return configs, c.Errf("duplicate experiment '%s'", cfg.Name)
+			}
+		}
+		configs = append(configs, cfg)
+	}
+
+	return configs, nil
+}
+
+// bucket returns the bucket of cfg with the given name, or nil.
+func (cfg *Config) bucket(name string) *Bucket {
+	for i := range cfg.Buckets {
+		if cfg.Buckets[i].Name == name {
+			return &cfg.Buckets[i]
+		}
+	}
+	return nil
+}
+
+// defaultCookieMaxAge is how long clients remember their
+// assignment by default: 30 days.
+const defaultCookieMaxAge = 30 * 24 * 60 * 60
@@ -0,0 +1,125 @@
+package experiment
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `experiment checkout {
+		bucket a 50
+		bucket b 50
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Experiment)
+	if !ok {
+		t.Fatalf("Expected handler to be type Experiment, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestExperimentParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []Config
+	}{
+		{`experiment`, true, nil},
+		{`experiment checkout`, true, nil},
+		{`experiment checkout {
+			bucket a 0
+		}`, true, nil},
+		{`experiment checkout {
+			bucket a 90
+			bucket b 10
+		}`, false, []Config{{
+			Name: "checkout", PathScope: "/", Key: KeyIP,
+			Cookie: "caddy_exp_checkout", CookieMaxAge: defaultCookieMaxAge,
+			Buckets: []Bucket{{Name: "a", Weight: 90}, {Name: "b", Weight: 10}},
+		}}},
+		{`experiment checkout /shop {
+			bucket a 1
+			bucket b 1
+			key header X-User
+			cookie off
+			root b /var/www/b
+			rewrite b /b{uri} /b/index.html
+		}`, false, []Config{{
+			Name: "checkout", PathScope: "/shop", Key: KeyHeader, KeyName: "X-User",
+			CookieMaxAge: defaultCookieMaxAge,
+			Buckets: []Bucket{
+				{Name: "a", Weight: 1},
+				{Name: "b", Weight: 1, Root: "/var/www/b", Rewrite: "/b{uri} /b/index.html"},
+			},
+		}}},
+		{`experiment flag {
+			bucket on 1
+			key cookie session
+			cookie flag 3600
+		}`, false, []Config{{
+			Name: "flag", PathScope: "/", Key: KeyCookie, KeyName: "session",
+			Cookie: "flag", CookieMaxAge: 3600,
+			Buckets: []Bucket{{Name: "on", Weight: 1}},
+		}}},
+		{`experiment checkout {
+			bucket a -1
+		}`, true, nil},
+		{`experiment checkout {
+			bucket a 1
+			bucket a 2
+		}`, true, nil},
+		{`experiment checkout {
+			root a /var/www/a
+			bucket a 1
+		}`, true, nil},
+		{`experiment checkout {
+			bucket a 1
+			key cookie
+		}`, true, nil},
+		{`experiment checkout {
+			bucket a 1
+			color blue
+		}`, true, nil},
+		{`experiment checkout /a /b {
+			bucket a 1
+		}`, true, nil},
+		{`experiment checkout {
+			bucket a 1
+		}
+		experiment checkout {
+			bucket b 1
+		}`, true, nil},
+	}
+
+	for i, test := range tests {
+		actual, err := experimentParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but found none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but found: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
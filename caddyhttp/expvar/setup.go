@@ -2,6 +2,7 @@ package expvar
 
 import (
 	"expvar"
+	"os"
 	"runtime"
 	"sync"
 
@@ -11,8 +12,9 @@ import (
 
 func init() {
 	caddy.RegisterPlugin("expvar", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
@@ -62,6 +64,12 @@ func publishExtraVars() {
 		expvar.Publish("Goroutines", expvar.Func(func() interface{} {
 			return runtime.NumGoroutine()
 		}))
+		expvar.Publish("SlowConnectionsDropped", expvar.Func(func() interface{} {
+			return httpserver.SlowConnectionsDropped()
+		}))
+		expvar.Publish("Worker", expvar.Func(func() interface{} {
+			return map[string]int{"ID": caddy.WorkerID(), "PID": os.Getpid()}
+		}))
 	})
 }
 
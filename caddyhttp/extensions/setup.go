@@ -7,13 +7,17 @@ import (
 
 func init() {
 	caddy.RegisterPlugin("ext", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
 // setup configures a new instance of 'extensions' middleware for clean URLs.
 func setup(c *caddy.Controller) error {
+	if err := httpserver.CheckStaticRoot(c); err != nil {
+		return err
+	}
 	cfg := httpserver.GetConfig(c)
 	root := cfg.Root
 
@@ -12,13 +12,17 @@ import (
 
 func init() {
 	caddy.RegisterPlugin("fastcgi", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
 // setup configures a new FastCGI middleware instance.
 func setup(c *caddy.Controller) error {
+	if err := httpserver.CheckStaticRoot(c); err != nil {
+		return err
+	}
 	cfg := httpserver.GetConfig(c)
 	absRoot, err := filepath.Abs(cfg.Root)
 	if err != nil {
@@ -0,0 +1,193 @@
+// Package git provides a directive that keeps the content of a site
+// in a directory checked out from a Git repository, pulling it on an
+// interval or when a webhook is called, and middleware that serves
+// the webhook and hides the .git directory.
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Repo is a Git repository checked out in a directory.
+type Repo struct {
+	// URL is where the repository is cloned from
+	URL string
+
+	// Path is the directory it is checked out in
+	Path string
+
+	// Branch or Tag is what is checked out; if
+	// neither is set, the default branch
+	Branch string
+	Tag    string
+
+	// KeyPath is the SSH private key, a deploy key, that
+	// the repository is cloned with, if set
+	KeyPath string
+
+	// Interval is how often the repository is pulled;
+	// if 0, it is pulled only when the webhook is called
+	Interval time.Duration
+
+	// Sparse are the paths in the repository that are
+	// checked out; if empty, all of it is
+	Sparse []string
+
+	// Then are the commands run in Path when a
+	// pull checked out a new commit
+	Then []Command
+}
+
+// Command is a command run after a pull.
+type Command struct {
+	Name string
+	Args []string
+}
+
+// checkedOut is the commit checked out in each directory, so
+// that a reload of the server, which makes new Repos, does not
+// run the commands again for a commit that was checked out.
+var (
+	checkedOut   = make(map[string]string)
+	checkedOutMu sync.Mutex
+)
+
+// pulling is held while repositories are pulled, so
+// pulls of the same directory do not run at once.
+var pulling sync.Mutex
+
+// ref returns the reference that is checked out.
+func (r *Repo) ref() string {
+	switch {
+	case r.Tag != "":
+		return "refs/tags/" + r.Tag
+	case r.Branch != "":
+		return "refs/heads/" + r.Branch
+	}
+	return "HEAD"
+}
+
+// Pull fetches the latest commit of the branch or tag, checks
+// it out, and runs the commands if it was not checked out before.
+func (r *Repo) Pull() error {
+	pulling.Lock()
+	defer pulling.Unlock()
+
+	if err := os.MkdirAll(r.Path, 0755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(r.Path, ".git")); os.IsNotExist(err) {
+		if _, err := r.git("init", "-q"); err != nil {
+			return err
+		}
+		if _, err := r.git("remote", "add", "origin", r.URL); err != nil {
+			return err
+		}
+	} else if _, err := r.git("remote", "set-url", "origin", r.URL); err != nil {
+		return err
+	}
+
+	// the checkout is always sparse, of everything by default, so
+	// that paths that were left out are checked out once they are not
+	patterns := "/*\n"
+	if len(r.Sparse) > 0 {
+		patterns = ""
+		for _, p := range r.Sparse {
+			patterns += "/" + strings.TrimPrefix(p, "/") + "\n"
+		}
+	}
+	if _, err := r.git("config", "core.sparseCheckout", "true"); err != nil {
+		return err
+	}
+	info := filepath.Join(r.Path, ".git", "info")
+	if err := os.MkdirAll(info, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(info, "sparse-checkout"), []byte(patterns), 0644); err != nil {
+		return err
+	}
+
+	if _, err := r.git("fetch", "-q", "--depth", "1", "origin", r.ref()); err != nil {
+		return err
+	}
+	if _, err := r.git("checkout", "-q", "-f", "FETCH_HEAD"); err != nil {
+		return err
+	}
+	if _, err := r.git("read-tree", "-mu", "HEAD"); err != nil {
+		return err
+	}
+	commit, err := r.git("rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+
+	checkedOutMu.Lock()
+	previous := checkedOut[r.Path]
+	checkedOut[r.Path] = commit
+	checkedOutMu.Unlock()
+	if commit == previous {
+		return nil
+	}
+	log.Printf("[INFO] git: checked out %s of %s in %s", commit, r.URL, r.Path)
+
+	for _, command := range r.Then {
+		cmd := exec.Command(command.Name, command.Args...)
+		cmd.Dir = r.Path
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %v: %s", command.Name, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// git runs git with args in the directory of the
+// repository, and returns what it printed.
+func (r *Repo) git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.Path
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if r.KeyPath != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %q -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new", r.KeyPath))
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// run pulls the repository every Interval and whenever
+// there is a value on trigger, until stop is closed.
+func (r *Repo) run(trigger <-chan struct{}, stop <-chan struct{}) {
+	var tick <-chan time.Time
+	if r.Interval > 0 {
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+		case <-trigger:
+		case <-stop:
+			return
+		}
+		r.pull()
+	}
+}
+
+// pull pulls the repository and logs if it fails.
+func (r *Repo) pull() {
+	if err := r.Pull(); err != nil {
+		log.Printf("[ERROR] git: pulling %s: %v", r.URL, err)
+	}
+}
@@ -0,0 +1,100 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// gitRun runs git with args in dir for a test.
+func gitRun(t *testing.T, dir string, args ...string) {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+}
+
+func writeTestFile(t *testing.T, name, content string) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepoPull(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "caddy_git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	writeTestFile(t, filepath.Join(src, "index.html"), "v1")
+	writeTestFile(t, filepath.Join(src, "docs", "a.txt"), "docs")
+	gitRun(t, src, "init", "-q")
+	gitRun(t, src, "checkout", "-q", "-b", "main")
+	gitRun(t, src, "add", ".")
+	gitRun(t, src, "commit", "-q", "-m", "one")
+	gitRun(t, src, "tag", "v1")
+	writeTestFile(t, filepath.Join(src, "index.html"), "v2")
+	gitRun(t, src, "commit", "-q", "-am", "two")
+
+	site := filepath.Join(dir, "site")
+	read := func(name string) string {
+		b, _ := ioutil.ReadFile(filepath.Join(site, name))
+		return string(b)
+	}
+	repo := &Repo{
+		URL:    "file://" + filepath.ToSlash(src),
+		Path:   site,
+		Branch: "main",
+		Then:   []Command{{Name: "sh", Args: []string{"-c", "echo ran >> hooks.log"}}},
+	}
+	if err := repo.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	if read("index.html") != "v2" || read("docs/a.txt") != "docs" {
+		t.Errorf("Expected the branch to be checked out, got %q %q", read("index.html"), read("docs/a.txt"))
+	}
+
+	// pulling the same commit again does not run the commands
+	if err := repo.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	if read("hooks.log") != "ran\n" {
+		t.Errorf("Expected the commands to run once, got %q", read("hooks.log"))
+	}
+
+	repo.Branch, repo.Tag = "", "v1"
+	repo.Sparse = []string{"index.html"}
+	if err := repo.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	if read("index.html") != "v1" || read("docs/a.txt") != "" {
+		t.Errorf("Expected only index.html of the tag, got %q %q", read("index.html"), read("docs/a.txt"))
+	}
+	if read("hooks.log") != "ran\nran\n" {
+		t.Errorf("Expected the commands to run for the new commit, got %q", read("hooks.log"))
+	}
+
+	repo.Sparse = nil
+	if err := repo.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	if read("docs/a.txt") != "docs" {
+		t.Error("Expected all paths to be checked out once the checkout is not sparse")
+	}
+
+	repo.Tag = "nope"
+	if err := repo.Pull(); err == nil {
+		t.Error("Expected an error pulling a tag that does not exist")
+	}
+}
@@ -0,0 +1,98 @@
+package git
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Git is middleware that serves the webhook of a repository at
+// HookPath, if set, and hides its .git directory at HiddenPath.
+type Git struct {
+	Next httpserver.Handler
+	Repo *Repo
+
+	// HookPath is the path of the webhook
+	HookPath string
+
+	// Secret authenticates calls of the webhook, as the key
+	// of the signature of GitHub or Gitea or the token of
+	// GitLab; if empty, no call is authentic
+	Secret string
+
+	// HiddenPath is the .git directory, if it is in the site
+	HiddenPath string
+
+	trigger chan struct{}
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (g Git) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if g.HiddenPath != "" && httpserver.Path(r.URL.Path).Matches(g.HiddenPath) {
+		return http.StatusNotFound, nil
+	}
+	if g.HookPath == "" || r.URL.Path != g.HookPath {
+		return g.Next.ServeHTTP(w, r)
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		return http.StatusMethodNotAllowed, nil
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		return http.StatusRequestEntityTooLarge, nil
+	}
+	if !g.authentic(r, body) {
+		return http.StatusUnauthorized, nil
+	}
+
+	// pushes of other branches or tags are not pulled
+	var push struct {
+		Ref string `json:"ref"`
+	}
+	if json.Unmarshal(body, &push) == nil && push.Ref != "" && g.Repo.ref() != "HEAD" && push.Ref != g.Repo.ref() {
+		httpserver.WriteTextResponse(w, http.StatusOK, "ignored "+push.Ref+"\n")
+		return 0, nil
+	}
+
+	select {
+	case g.trigger <- struct{}{}:
+	default:
+		// a pull is already due
+	}
+	httpserver.WriteTextResponse(w, http.StatusAccepted, "pulling\n")
+	return 0, nil
+}
+
+// authentic returns whether the call r of the webhook, with
+// body, is authenticated with the secret.
+func (g Git) authentic(r *http.Request, body []byte) bool {
+	if g.Secret == "" {
+		return false
+	}
+	if token := r.Header.Get("X-Gitlab-Token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(g.Secret)) == 1
+	}
+	sig := strings.TrimPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	if sig == "" {
+		sig = r.Header.Get("X-Gitea-Signature")
+	}
+	given, err := hex.DecodeString(sig)
+	if sig == "" || err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(g.Secret))
+	mac.Write(body)
+	return hmac.Equal(given, mac.Sum(nil))
+}
+
+// maxPayloadSize is the size limit of the body of a webhook call.
+const maxPayloadSize = 10 << 20
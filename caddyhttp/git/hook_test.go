@@ -0,0 +1,80 @@
+package git
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestGitHook(t *testing.T) {
+	g := Git{
+		Next:       httpserver.EmptyNext,
+		Repo:       &Repo{Branch: "main"},
+		HookPath:   "/hook",
+		Secret:     "s3cret",
+		HiddenPath: "/.git",
+		trigger:    make(chan struct{}, 1),
+	}
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write([]byte(body))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	push := `{"ref": "refs/heads/main"}`
+
+	for i, test := range []struct {
+		method, path, body string
+		header, value      string
+		expectedStatus     int
+		expectedTrigger    bool
+	}{
+		{"GET", "/.git/config", "", "", "", http.StatusNotFound, false},
+		{"GET", "/index.html", "", "", "", http.StatusOK, false},
+		{"GET", "/hook", "", "", "", http.StatusMethodNotAllowed, false},
+		{"POST", "/hook", push, "", "", http.StatusUnauthorized, false},
+		{"POST", "/hook", push, "X-Hub-Signature-256", "sha256=" + sign("other"), http.StatusUnauthorized, false},
+		{"POST", "/hook", push, "X-Hub-Signature-256", "sha256=" + sign(push), http.StatusAccepted, true},
+		{"POST", "/hook", push, "X-Gitea-Signature", sign(push), http.StatusAccepted, true},
+		{"POST", "/hook", push, "X-Gitlab-Token", "s3cret", http.StatusAccepted, true},
+		{"POST", "/hook", push, "X-Gitlab-Token", "wrong", http.StatusUnauthorized, false},
+		{"POST", "/hook", `{"ref": "refs/heads/dev"}`, "X-Gitlab-Token", "s3cret", http.StatusOK, false},
+	} {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		w := httptest.NewRecorder()
+		status, err := g.ServeHTTP(w, req)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if status == 0 {
+			status = w.Code
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		var triggered bool
+		select {
+		case <-g.trigger:
+			triggered = true
+		default:
+		}
+		if triggered != test.expectedTrigger {
+			t.Errorf("Test %d: Expected pull to be triggered: %v, got %v", i, test.expectedTrigger, triggered)
+		}
+	}
+
+	// without a secret, no call is authentic
+	g.Secret = ""
+	status, _ := g.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/hook", strings.NewReader(push)))
+	if status != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without a secret, got %d", http.StatusUnauthorized, status)
+	}
+}
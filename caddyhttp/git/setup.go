@@ -0,0 +1,202 @@
+package git
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("git", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a repository to pull, and a Git
+// middleware instance that serves its webhook and
+// hides its .git directory.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+	repos, err := gitParse(c, cfg.Root)
+	if err != nil {
+		return err
+	}
+	if len(repos) > 0 {
+		if _, err := exec.LookPath("git"); err != nil {
+			return c.Err("git: git is not installed")
+		}
+	}
+
+	for _, g := range repos {
+		g := g
+		g.trigger = make(chan struct{}, 1)
+		if rel, ok := within(cfg.Root, g.Repo.Path); ok {
+			g.HiddenPath = "/" + filepath.ToSlash(filepath.Join(rel, ".git"))
+		}
+
+		// the first pull is waited for, so the site
+		// has its content when it starts serving
+		stop := make(chan struct{})
+		c.OnStartup(func() error {
+			g.Repo.pull()
+			go g.Repo.run(g.trigger, stop)
+			return nil
+		})
+		c.OnShutdown(func() error {
+			close(stop)
+			return nil
+		})
+
+		cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+			g.Next = next
+			return g
+		})
+	}
+	return nil
+}
+
+// within returns the path of dir relative to root,
+// and whether dir is in root.
+func within(root, dir string) (string, bool) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absRoot, absDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// gitParse parses the git directives of a site, of the form
+//
+//	git [url [path]] {
+//	    repo     url
+//	    path     dir
+//	    branch   name
+//	    tag      name
+//	    key      file
+//	    interval duration
+//	    hook     path secret
+//	    sparse   paths...
+//	    then     command [args...]
+//	}
+//
+// The path is relative to the site root, which it is by default.
+// The default branch is checked out unless a branch or a tag is
+// given. The repository is pulled every hour by default; an
+// interval of 0 pulls only when the webhook at the hook path is
+// called, which must be authenticated with the secret. Each then is a command run in the path after a pull
+// checked out a new commit.
+func gitParse(c *caddy.Controller, root string) ([]Git, error) {
+	var repos []Git
+	for c.Next() {
+		repo := &Repo{Interval: defaultInterval}
+		g := Git{Repo: repo}
+
+		args := c.RemainingArgs()
+		if len(args) > 2 {
+			return nil, c.ArgErr()
+		}
+		if len(args) > 0 {
+			repo.URL = args[0]
+		}
+		if len(args) > 1 {
+			repo.Path = args[1]
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "sparse":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				repo.Sparse = append(repo.Sparse, args...)
+				continue
+			case "then":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				repo.Then = append(repo.Then, Command{Name: args[0], Args: args[1:]})
+				continue
+			case "hook":
+				if len(args) == 1 {
+					return nil, c.Errf("git: hook '%s' requires a secret", args[0])
+				}
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				if !strings.HasPrefix(args[0], "/") {
+					return nil, c.Errf("git: invalid hook path '%s'", args[0])
+				}
+				if args[1] == "" {
+					return nil, c.Errf("git: hook '%s' requires a secret", args[0])
+				}
+				g.HookPath, g.Secret = args[0], args[1]
+				continue
+			}
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			switch what {
+			case "repo":
+				repo.URL = args[0]
+			case "path":
+				repo.Path = args[0]
+			case "branch":
+				repo.Branch = args[0]
+			case "tag":
+				repo.Tag = args[0]
+			case "key":
+				repo.KeyPath = args[0]
+			case "interval":
+				dur, err := time.ParseDuration(args[0])
+				if err != nil || dur < 0 {
+					return nil, c.Errf("git: invalid interval '%s'", args[0])
+				}
+				repo.Interval = dur
+			default:
+				return nil, c.Errf("git: unknown property '%s'", what)
+			}
+		}
+
+		if repo.URL == "" {
+			return nil, c.Err("git: repo is required")
+		}
+		if repo.Branch != "" && repo.Tag != "" {
+			return nil, c.Err("git: branch and tag cannot both be given")
+		}
+		if repo.Interval == 0 && g.HookPath == "" {
+			return nil, c.Err("git: an interval of 0 requires a hook")
+		}
+		if !filepath.IsAbs(repo.Path) {
+			if err := httpserver.CheckStaticRoot(c); err != nil {
+				return nil, err
+			}
+			repo.Path = filepath.Join(root, repo.Path)
+		}
+		if repo.KeyPath != "" && !filepath.IsAbs(repo.KeyPath) {
+			abs, err := filepath.Abs(repo.KeyPath)
+			if err != nil {
+				return nil, c.Errf("git: %v", err)
+			}
+			repo.KeyPath = abs
+		}
+		repos = append(repos, g)
+	}
+	return repos, nil
+}
+
+const defaultInterval = 1 * time.Hour
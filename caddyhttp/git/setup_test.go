@@ -0,0 +1,99 @@
+package git
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `git https://example.com/site.git public`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	g, ok := handler.(Git)
+	if !ok {
+		t.Fatalf("Expected handler to be type Git, got: %#v", handler)
+	}
+	if !httpserver.SameNext(g.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if g.HiddenPath != "/public/.git" {
+		t.Errorf("Expected the .git directory to be hidden, got %q", g.HiddenPath)
+	}
+}
+
+func TestGitParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []Repo
+		hooks     []string
+	}{
+		{`git https://example.com/site.git`, false, []Repo{
+			{URL: "https://example.com/site.git", Path: "/srv", Interval: defaultInterval},
+		}, []string{""}},
+		{`git {
+			repo     git@example.com:site.git
+			path     /var/www
+			tag      v1.0
+			key      /keys/deploy
+			interval 0
+			hook     /_hook secret
+			sparse   public docs
+			then     make "build site"
+		}
+		git https://example.com/other.git other {
+			branch dev
+		}`, false, []Repo{
+			{URL: "git@example.com:site.git", Path: "/var/www", Tag: "v1.0", KeyPath: "/keys/deploy",
+				Sparse: []string{"public", "docs"}, Then: []Command{{Name: "make", Args: []string{"build site"}}}},
+			{URL: "https://example.com/other.git", Path: "/srv/other", Branch: "dev", Interval: defaultInterval},
+		}, []string{"/_hook", ""}},
+		{`git`, true, nil, nil},
+		{`git a b c`, true, nil, nil},
+		{"git a {\nbranch dev\ntag v1\n}", true, nil, nil},
+		{"git a {\ninterval 0\n}", true, nil, nil},
+		{"git a {\ninterval soon\n}", true, nil, nil},
+		{"git a {\nhook _hook secret\n}", true, nil, nil},
+		{"git a {\nhook /_hook\n}", true, nil, nil},
+		{"git a {\nhook /_hook \"\"\n}", true, nil, nil},
+		{"git a {\nsparse\n}", true, nil, nil},
+		{"git a {\nthen\n}", true, nil, nil},
+		{"git a {\nbranch\n}", true, nil, nil},
+		{"git a {\nwhat x\n}", true, nil, nil},
+	} {
+		actual, err := gitParse(caddy.NewTestController("http", test.input), "/srv")
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if len(actual) != len(test.expected) {
+			t.Fatalf("Test %d: Expected %d repos, got %d", i, len(test.expected), len(actual))
+		}
+		for j, g := range actual {
+			expected := test.expected[j]
+			expected.Path = filepath.FromSlash(expected.Path)
+			if !reflect.DeepEqual(*g.Repo, expected) {
+				t.Errorf("Test %d, repo %d: Expected %+v, got %+v", i, j, expected, *g.Repo)
+			}
+			if g.HookPath != test.hooks[j] {
+				t.Errorf("Test %d, repo %d: Expected hook %q, got %q", i, j, test.hooks[j], g.HookPath)
+			}
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// Package graphql provides middleware that protects GraphQL
+// backends from abusive queries, by limiting how deeply they
+// nest and how many fields they select, and how often each
+// operation may be requested, before they are forwarded.
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Scopes of rate limits.
+const (
+	// PerIP limits each client IP address separately.
+	PerIP = "ip"
+
+	// Global limits all clients together.
+	Global = "global"
+)
+
+// GraphQL is middleware that checks GraphQL requests
+// to an endpoint against limits.
+type GraphQL struct {
+	Next   httpserver.Handler
+	Config *Config
+}
+
+// Config is the configuration of a GraphQL endpoint.
+type Config struct {
+	// Path of the endpoint
+	Path string
+
+	// MaxDepth limits the nesting of operations, if positive
+	MaxDepth int
+
+	// MaxComplexity limits the fields operations select,
+	// if positive
+	MaxComplexity int
+
+	// MaxBody limits the size of request bodies
+	MaxBody int64
+
+	// Rates limits how often operations are requested, by
+	// operation name; "*" applies to operations without
+	// a rate of their own, including anonymous ones
+	Rates map[string]Rate
+
+	// Per is whether rates apply per IP or globally
+	Per string
+
+	// Store, if not nil, counts the requests of each window
+	// of a rate together with other instances; the requests
+	// are leased from it Batch at a time (a tenth of a
+	// window's requests if not positive)
+	Store CounterStore
+	Batch int
+
+	mu               sync.Mutex
+	buckets          map[string]*bucket
+	leases           map[string]*lease
+	storeRetry       time.Time
+	storeErrorLogged time.Time
+}
+
+// Rate allows Requests operations per Window.
+type Rate struct {
+	Requests int
+	Window   time.Duration
+}
+
+// request is a GraphQL request, as sent in a POST body.
+type request struct {
+	Query         string `json:"query"`
+	OperationName string `json:"operationName"`
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (g GraphQL) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !httpserver.Path(r.URL.Path).Matches(g.Config.Path) {
+		return g.Next.ServeHTTP(w, r)
+	}
+
+	var reqs []request
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		if q.Get("query") == "" {
+			// such as a page to explore the schema
+			return g.Next.ServeHTTP(w, r)
+		}
+		reqs = []request{{Query: q.Get("query"), OperationName: q.Get("operationName")}}
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, g.Config.MaxBody+1))
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		if int64(len(body)) > g.Config.MaxBody {
+			return writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		}
+		// the backend reads the body as it was sent
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+
+		reqs, err = parseBody(r, body)
+		if err != nil {
+			return writeError(w, http.StatusBadRequest, err.Error())
+		}
+	default:
+		return g.Next.ServeHTTP(w, r)
+	}
+
+	// the operations of a batch count towards complexity
+	// together, so a batch cannot be used to get around it
+	var complexity int
+	for _, req := range reqs {
+		ops, err := Analyze(req.Query)
+		if err != nil {
+			return writeError(w, http.StatusBadRequest, "invalid query: "+err.Error())
+		}
+		name := req.OperationName
+		if name == "" && len(ops) == 1 {
+			name = ops[0].Name
+		}
+		for _, op := range ops {
+			if g.Config.MaxDepth > 0 && op.Depth > g.Config.MaxDepth {
+				return writeError(w, http.StatusBadRequest,
+					fmt.Sprintf("query depth %d exceeds limit of %d", op.Depth, g.Config.MaxDepth))
+			}
+			complexity = add(complexity, op.Complexity)
+			if g.Config.MaxComplexity > 0 && complexity > g.Config.MaxComplexity {
+				return writeError(w, http.StatusBadRequest,
+					fmt.Sprintf("query complexity %d exceeds limit of %d", complexity, g.Config.MaxComplexity))
+			}
+		}
+		if wait := g.Config.reserve(r, name); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		}
+	}
+
+	return g.Next.ServeHTTP(w, r)
+}
+
+// parseBody returns the GraphQL requests in body, which may
+// be a single request or a batch of them.
+func parseBody(r *http.Request, body []byte) ([]request, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/graphql" {
+		return []request{{Query: string(body), OperationName: r.URL.Query().Get("operationName")}}, nil
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var reqs []request
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			return nil, fmt.Errorf("invalid request body: %v", err)
+		}
+		if len(reqs) == 0 {
+			return nil, fmt.Errorf("empty batch")
+		}
+		return reqs, nil
+	}
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("invalid request body: %v", err)
+	}
+	return []request{req}, nil
+}
+
+// writeError writes a GraphQL error response.
+func writeError(w http.ResponseWriter, status int, msg string) (int, error) {
+	body, err := json.Marshal(map[string][]map[string]string{"errors": {{"message": msg}}})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body)
+	return 0, nil
+}
+
+// reserve takes a request of the operation named name by the
+// client of r from its bucket, and returns how long to wait
+// before retrying if there is none left. With a store, the
+// request is taken from the window shared with the other
+// instances instead, unless the store can't be reached.
+func (c *Config) reserve(r *http.Request, name string) time.Duration {
+	rate, ok := c.Rates[name]
+	if !ok {
+		if rate, ok = c.Rates["*"]; !ok {
+			return 0
+		}
+		name = "*"
+	}
+	key := name
+	if c.Per == PerIP {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		key = name + " " + host
+	}
+
+	t := now()
+	if c.Store != nil {
+		if wait, ok := c.reserveShared(key, rate, t); ok {
+			return wait
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.buckets == nil {
+		c.buckets = make(map[string]*bucket)
+	}
+	b, ok := c.buckets[key]
+	if !ok {
+		if len(c.buckets) >= maxBuckets {
+			c.forgetFull(t)
+		}
+		b = &bucket{tokens: float64(rate.Requests), last: t}
+		c.buckets[key] = b
+	}
+	return b.take(rate, t)
+}
+
+// forgetFull forgets the buckets that have refilled by t,
+// as they are the same as new ones.
+func (c *Config) forgetFull(t time.Time) {
+	for key, b := range c.buckets {
+		if t.Sub(b.last) >= b.window {
+			delete(c.buckets, key)
+		}
+	}
+}
+
+// bucket is a token bucket where each token is a request.
+type bucket struct {
+	tokens float64
+	last   time.Time
+	window time.Duration // of the rate the bucket is used with
+}
+
+// take takes a token from b, which is refilled at rate, and
+// returns how long to wait for one if there is none.
+func (b *bucket) take(rate Rate, t time.Time) time.Duration {
+	perSecond := float64(rate.Requests) / rate.Window.Seconds()
+	b.tokens += t.Sub(b.last).Seconds() * perSecond
+	if b.tokens > float64(rate.Requests) {
+		b.tokens = float64(rate.Requests)
+	}
+	b.last, b.window = t, rate.Window
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// maxBuckets is how many buckets are kept before
+// those that refilled are forgotten.
+const maxBuckets = 10000
+
+// now is a variable so it can be mocked in tests.
+var now = time.Now
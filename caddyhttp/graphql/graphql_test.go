@@ -0,0 +1,123 @@
+package graphql
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestGraphQL(t *testing.T) {
+	var forwarded string
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		body, _ := ioutil.ReadAll(r.Body)
+		forwarded = string(body)
+		return http.StatusOK, nil
+	})
+	g := GraphQL{Next: next, Config: &Config{
+		Path:          "/graphql",
+		MaxDepth:      3,
+		MaxComplexity: 5,
+		MaxBody:       256,
+		Per:           PerIP,
+	}}
+
+	for i, test := range []struct {
+		method, target, contentType, body string
+		expectStatus                      int
+		expectError                       string
+	}{
+		{"POST", "/graphql", "application/json", `{"query": "{ me { name } }"}`, http.StatusOK, ""},
+		{"POST", "/graphql", "application/json", `{"query": "{ a { b { c { d } } } }"}`, 0, "depth 4 exceeds limit of 3"},
+		{"POST", "/graphql", "application/json", `{"query": "{ a b c d e f }"}`, 0, "complexity 6 exceeds limit of 5"},
+		{"POST", "/graphql", "application/json", `[{"query": "{ a b c }"}, {"query": "{ d e f }"}]`, 0, "complexity 6 exceeds limit of 5"},
+		{"POST", "/graphql", "application/json", `[{"query": "{ a b }"}, {"query": "{ d e }"}]`, http.StatusOK, ""},
+		{"POST", "/graphql", "application/graphql", `{ a { b { c { d } } } }`, 0, "depth 4 exceeds limit of 3"},
+		{"POST", "/graphql", "application/json", `{"query": "{ a "}`, 0, "invalid query"},
+		{"POST", "/graphql", "application/json", `{"query": `, 0, "invalid request body"},
+		{"POST", "/graphql", "application/json", `[]`, 0, "empty batch"},
+		{"POST", "/graphql", "application/json", `{"query": "{ a }", "x": "` + strings.Repeat("x", 256) + `"}`, 0, "too large"},
+		{"GET", "/graphql?query=" + url.QueryEscape("{ a { b { c { d } } } }"), "", "", 0, "depth 4 exceeds limit of 3"},
+		{"GET", "/graphql", "", "", http.StatusOK, ""},
+		{"POST", "/other", "application/json", `{"query": "{ a { b { c { d } } } }"}`, http.StatusOK, ""},
+	} {
+		forwarded = ""
+		r := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+		r.Header.Set("Content-Type", test.contentType)
+		w := httptest.NewRecorder()
+
+		status, err := g.ServeHTTP(w, r)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if status != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if test.expectError != "" && !strings.Contains(w.Body.String(), test.expectError) {
+			t.Errorf("Test %d: Expected error containing '%s', got '%s'", i, test.expectError, w.Body.String())
+		}
+		if status == http.StatusOK && forwarded != test.body {
+			t.Errorf("Test %d: Expected body '%s' to be forwarded, got '%s'", i, test.body, forwarded)
+		}
+	}
+}
+
+func TestGraphQLRates(t *testing.T) {
+	current := time.Now()
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	g := GraphQL{Next: httpserver.EmptyNext, Config: &Config{
+		Path:    "/",
+		MaxBody: 1024,
+		Per:     PerIP,
+		Rates: map[string]Rate{
+			"Search": {Requests: 2, Window: time.Minute},
+			"*":      {Requests: 1, Window: time.Second},
+		},
+	}}
+	request := func(remote, body string) (int, *httptest.ResponseRecorder) {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, r)
+		return w.Code, w
+	}
+	search := `{"query": "query Search { a }"}`
+	named := `{"query": "query A { a } query Search { b }", "operationName": "Search"}`
+	other := `{"query": "{ a }"}`
+
+	for i, test := range []struct {
+		remote, body string
+		limited      bool
+	}{
+		{"1.2.3.4:1", search, false},
+		{"1.2.3.4:2", named, false},
+		{"1.2.3.4:3", search, true},
+		{"5.6.7.8:1", search, false},
+		{"1.2.3.4:1", other, false},
+		{"1.2.3.4:1", other, true},
+	} {
+		code, w := request(test.remote, test.body)
+		if limited := code == http.StatusTooManyRequests; limited != test.limited {
+			t.Errorf("Test %d: Expected rate limited to be %v, got status %d", i, test.limited, code)
+		}
+		if test.limited && w.Header().Get("Retry-After") == "" {
+			t.Errorf("Test %d: Expected Retry-After header", i)
+		}
+	}
+
+	// the buckets refill over time
+	current = current.Add(30 * time.Second)
+	if code, _ := request("1.2.3.4:1", search); code == http.StatusTooManyRequests {
+		t.Error("Expected bucket to have refilled")
+	}
+	if code, _ := request("1.2.3.4:1", search); code != http.StatusTooManyRequests {
+		t.Error("Expected bucket to be empty again")
+	}
+}
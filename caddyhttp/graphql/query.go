@@ -0,0 +1,486 @@
+package graphql
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Operation is what is known about an operation of
+// a GraphQL document without executing it.
+type Operation struct {
+	// Type is query, mutation or subscription
+	Type string
+
+	// Name is empty for anonymous operations
+	Name string
+
+	// Depth is how deeply the selections are nested,
+	// with fragments expanded
+	Depth int
+
+	// Complexity is the number of fields selected,
+	// with fragments expanded
+	Complexity int
+}
+
+// Analyze parses the GraphQL document query and returns its
+// operations. Values, such as arguments, are not validated.
+func Analyze(query string) ([]Operation, error) {
+	p := &queryParser{lexer: lexer{src: query}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	var ops []Operation
+	p.fragments = make(map[string]selectionSet)
+	var sets []selectionSet
+	for p.tok.kind != tokEOF {
+		switch {
+		case p.tok.is(tokPunct, "{"):
+			set, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, Operation{Type: "query"})
+			sets = append(sets, set)
+		case p.tok.is(tokName, "query"), p.tok.is(tokName, "mutation"), p.tok.is(tokName, "subscription"):
+			op := Operation{Type: p.tok.text}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if p.tok.kind == tokName {
+				op.Name = p.tok.text
+				if err := p.advance(); err != nil {
+					return nil, err
+				}
+			}
+			if p.tok.is(tokPunct, "(") {
+				if err := p.skipBalanced(); err != nil {
+					return nil, err
+				}
+			}
+			if err := p.directives(); err != nil {
+				return nil, err
+			}
+			set, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, op)
+			sets = append(sets, set)
+		case p.tok.is(tokName, "fragment"):
+			if err := p.fragment(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, p.errorf("unexpected %s", p.tok)
+		}
+	}
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("no operations")
+	}
+
+	a := &analyzer{fragments: p.fragments, done: make(map[string]stats), visiting: make(map[string]bool)}
+	for i, set := range sets {
+		s, err := a.selectionSet(set)
+		if err != nil {
+			return nil, err
+		}
+		ops[i].Depth, ops[i].Complexity = s.depth, s.complexity
+	}
+	return ops, nil
+}
+
+// selectionSet is a parsed selection set; only its
+// shape is kept.
+type selectionSet []selection
+
+// selection is a field, which may have a selection set, or a
+// fragment, either inline, with a selection set, or a spread,
+// with the fragment's name.
+type selection struct {
+	field    bool
+	fragment string
+	set      selectionSet
+}
+
+type queryParser struct {
+	lexer
+	tok       token
+	fragments map[string]selectionSet
+	depth     int
+}
+
+func (p *queryParser) advance() error {
+	tok, err := p.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *queryParser) expect(kind tokenKind, text string) error {
+	if !p.tok.is(kind, text) {
+		return p.errorf("expected %s, got %s", text, p.tok)
+	}
+	return p.advance()
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%d: %s", p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// selectionSet parses a selection set, starting at its "{".
+func (p *queryParser) selectionSet() (selectionSet, error) {
+	if p.depth++; p.depth > maxNesting {
+		return nil, p.errorf("selections nested too deeply")
+	}
+	defer func() { p.depth-- }()
+
+	if err := p.expect(tokPunct, "{"); err != nil {
+		return nil, err
+	}
+	var set selectionSet
+	for !p.tok.is(tokPunct, "}") {
+		var sel selection
+		switch {
+		case p.tok.is(tokPunct, "..."):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if p.tok.kind == tokName && p.tok.text != "on" {
+				sel.fragment = p.tok.text
+				if err := p.advance(); err != nil {
+					return nil, err
+				}
+				if err := p.directives(); err != nil {
+					return nil, err
+				}
+				break
+			}
+			if p.tok.is(tokName, "on") {
+				if err := p.advance(); err != nil {
+					return nil, err
+				}
+				if err := p.name(); err != nil {
+					return nil, err
+				}
+			}
+			if err := p.directives(); err != nil {
+				return nil, err
+			}
+			inner, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			sel.set = inner
+		case p.tok.kind == tokName:
+			sel.field = true
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if p.tok.is(tokPunct, ":") { // the name was an alias
+				if err := p.advance(); err != nil {
+					return nil, err
+				}
+				if err := p.name(); err != nil {
+					return nil, err
+				}
+			}
+			if p.tok.is(tokPunct, "(") {
+				if err := p.skipBalanced(); err != nil {
+					return nil, err
+				}
+			}
+			if err := p.directives(); err != nil {
+				return nil, err
+			}
+			if p.tok.is(tokPunct, "{") {
+				inner, err := p.selectionSet()
+				if err != nil {
+					return nil, err
+				}
+				sel.set = inner
+			}
+		default:
+			return nil, p.errorf("unexpected %s", p.tok)
+		}
+		set = append(set, sel)
+	}
+	if len(set) == 0 {
+		return nil, p.errorf("empty selection set")
+	}
+	return set, p.advance()
+}
+
+// fragment parses a fragment definition.
+func (p *queryParser) fragment() error {
+	if err := p.advance(); err != nil {
+		return err
+	}
+	name := p.tok.text
+	if err := p.name(); err != nil {
+		return err
+	}
+	if _, dup := p.fragments[name]; dup {
+		return p.errorf("duplicate fragment %s", name)
+	}
+	if err := p.expect(tokName, "on"); err != nil {
+		return err
+	}
+	if err := p.name(); err != nil {
+		return err
+	}
+	if err := p.directives(); err != nil {
+		return err
+	}
+	set, err := p.selectionSet()
+	if err != nil {
+		return err
+	}
+	p.fragments[name] = set
+	return nil
+}
+
+// name parses a name.
+func (p *queryParser) name() error {
+	if p.tok.kind != tokName {
+		return p.errorf("expected name, got %s", p.tok)
+	}
+	return p.advance()
+}
+
+// directives parses any directives, like @include(if: $x).
+func (p *queryParser) directives() error {
+	for p.tok.is(tokPunct, "@") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if err := p.name(); err != nil {
+			return err
+		}
+		if p.tok.is(tokPunct, "(") {
+			if err := p.skipBalanced(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// skipBalanced skips the tokens from an opening bracket to
+// its closing one, such as arguments and their values.
+func (p *queryParser) skipBalanced() error {
+	var open []string
+	for {
+		switch {
+		case p.tok.kind == tokEOF:
+			return p.errorf("unexpected end of document")
+		case p.tok.is(tokPunct, "("), p.tok.is(tokPunct, "["), p.tok.is(tokPunct, "{"):
+			if len(open) >= maxNesting {
+				return p.errorf("values nested too deeply")
+			}
+			open = append(open, closing[p.tok.text])
+		case p.tok.is(tokPunct, ")"), p.tok.is(tokPunct, "]"), p.tok.is(tokPunct, "}"):
+			if len(open) == 0 || open[len(open)-1] != p.tok.text {
+				return p.errorf("unexpected %s", p.tok)
+			}
+			open = open[:len(open)-1]
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if len(open) == 0 {
+			return nil
+		}
+	}
+}
+
+var closing = map[string]string{"(": ")", "[": "]", "{": "}"}
+
+// stats are the depth and complexity of a selection set.
+type stats struct {
+	depth, complexity int
+}
+
+// analyzer computes the stats of selection sets, expanding
+// fragments, whose stats are computed only once.
+type analyzer struct {
+	fragments map[string]selectionSet
+	done      map[string]stats
+	visiting  map[string]bool
+}
+
+func (a *analyzer) selectionSet(set selectionSet) (stats, error) {
+	var s stats
+	for _, sel := range set {
+		var inner stats
+		if sel.fragment != "" {
+			var err error
+			inner, err = a.fragment(sel.fragment)
+			if err != nil {
+				return s, err
+			}
+		} else if sel.set != nil {
+			var err error
+			inner, err = a.selectionSet(sel.set)
+			if err != nil {
+				return s, err
+			}
+		}
+		if sel.field {
+			inner.depth++
+			inner.complexity = add(inner.complexity, 1)
+		}
+		if inner.depth > s.depth {
+			s.depth = inner.depth
+		}
+		s.complexity = add(s.complexity, inner.complexity)
+	}
+	return s, nil
+}
+
+func (a *analyzer) fragment(name string) (stats, error) {
+	if s, ok := a.done[name]; ok {
+		return s, nil
+	}
+	set, ok := a.fragments[name]
+	if !ok {
+		return stats{}, fmt.Errorf("unknown fragment %s", name)
+	}
+	if a.visiting[name] {
+		return stats{}, fmt.Errorf("fragment %s spreads itself", name)
+	}
+	a.visiting[name] = true
+	s, err := a.selectionSet(set)
+	if err != nil {
+		return s, err
+	}
+	delete(a.visiting, name)
+	a.done[name] = s
+	return s, nil
+}
+
+// add adds a and b, saturating instead of overflowing, as
+// fragments can multiply complexity exponentially.
+func add(a, b int) int {
+	if a > maxComplexity-b {
+		return maxComplexity
+	}
+	return a + b
+}
+
+const (
+	// maxNesting limits the nesting of a document's selection
+	// sets and values while parsing it
+	maxNesting = 256
+
+	maxComplexity = 1 << 30
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokValue // numbers and strings
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) is(kind tokenKind, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of document"
+	}
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+// lexer splits a GraphQL document into tokens, skipping
+// whitespace, commas and comments.
+type lexer struct {
+	src string
+	pos int
+}
+
+func (l *lexer) next() (token, error) {
+skip:
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "\ufeff"): // byte order mark
+			l.pos += len("\ufeff")
+		default:
+			break skip
+		}
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.pos += 3
+		return token{kind: tokPunct, text: "...", pos: start}, nil
+	case strings.IndexByte("!$()[]{}:=@|&", c) >= 0:
+		l.pos++
+		return token{kind: tokPunct, text: string(c), pos: start}, nil
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for l.pos < len(l.src) && isNameChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokName, text: l.src[start:l.pos], pos: start}, nil
+	case c == '-' || c >= '0' && c <= '9':
+		l.pos++
+		for l.pos < len(l.src) && (isNameChar(l.src[l.pos]) || strings.IndexByte(".+-", l.src[l.pos]) >= 0) {
+			l.pos++
+		}
+		return token{kind: tokValue, text: l.src[start:l.pos], pos: start}, nil
+	case strings.HasPrefix(l.src[l.pos:], `"""`):
+		end := strings.Index(strings.Replace(l.src[l.pos+3:], `\"""`, `xxxx`, -1), `"""`)
+		if end < 0 {
+			return token{}, fmt.Errorf("%d: unterminated string", start)
+		}
+		l.pos += 3 + end + 3
+		return token{kind: tokValue, text: l.src[start:l.pos], pos: start}, nil
+	case c == '"':
+		l.pos++
+		for l.pos < len(l.src) {
+			switch l.src[l.pos] {
+			case '\\':
+				l.pos += 2
+				continue
+			case '\n', '\r':
+				return token{}, fmt.Errorf("%d: unterminated string", start)
+			case '"':
+				l.pos++
+				return token{kind: tokValue, text: l.src[start:l.pos], pos: start}, nil
+			}
+			l.pos++
+		}
+		return token{}, fmt.Errorf("%d: unterminated string", start)
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+	return token{}, fmt.Errorf("%d: unexpected character %q", start, r)
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
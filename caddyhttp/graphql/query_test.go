@@ -0,0 +1,75 @@
+package graphql
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	for i, test := range []struct {
+		query     string
+		shouldErr bool
+		expected  []Operation
+	}{
+		{`{ me { name } }`, false, []Operation{{Type: "query", Depth: 2, Complexity: 2}}},
+		{`query Me { me { name, friends(first: 10) { name } } }`, false,
+			[]Operation{{Type: "query", Name: "Me", Depth: 3, Complexity: 4}}},
+		{`mutation Add($x: Int = 1, $y: [String!]) @log(level: "info") {
+			add(input: {x: $x, y: ["a", "}"]}) @include(if: true) { id }
+		}`, false, []Operation{{Type: "mutation", Name: "Add", Depth: 2, Complexity: 2}}},
+		{`query { a: me { ...F } } fragment F on User { name friends { ...G } } fragment G on User { name }`, false,
+			[]Operation{{Type: "query", Depth: 3, Complexity: 4}}},
+		{`{ node { ... on User { name } ... @skip(if: false) { id } } }`, false,
+			[]Operation{{Type: "query", Depth: 2, Complexity: 3}}},
+		{"# comment\n{ a { b(s: \"\"\"block \\\"\"\" {\"\"\") } }", false, []Operation{{Type: "query", Depth: 2, Complexity: 2}}},
+		{`query A { a } subscription B { b { c } }`, false,
+			[]Operation{{Type: "query", Name: "A", Depth: 1, Complexity: 1}, {Type: "subscription", Name: "B", Depth: 2, Complexity: 2}}},
+		{``, true, nil},
+		{`fragment F on User { name }`, true, nil},
+		{`{ me { name }`, true, nil},
+		{`{ me { } }`, true, nil},
+		{`{ me(x: [1) }`, true, nil},
+		{`{ ...F }`, true, nil},
+		{`{ ...F } fragment F on T { ...F }`, true, nil},
+		{`{ a } fragment F on T { a } fragment F on T { b }`, true, nil},
+		{`{ a(s: "unterminated) }`, true, nil},
+		{`{ a % }`, true, nil},
+		{strings.Repeat("{a", maxNesting+1) + strings.Repeat("}", maxNesting+1), true, nil},
+	} {
+		ops, err := Analyze(test.query)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if !reflect.DeepEqual(ops, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, ops)
+		}
+	}
+}
+
+func TestAnalyzeFragmentExplosion(t *testing.T) {
+	// each fragment spreads the next twice, doubling complexity
+	query := "{ ...F0 }"
+	for i := 0; i < 64; i++ {
+		query += " fragment F" + strconv.Itoa(i) + " on T { a: x { ...F" + strconv.Itoa(i+1) + " } b: x { ...F" + strconv.Itoa(i+1) + " } }"
+	}
+	query += " fragment F64 on T { x }"
+
+	ops, err := Analyze(query)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if ops[0].Complexity != maxComplexity {
+		t.Errorf("Expected complexity to saturate at %d, got %d", maxComplexity, ops[0].Complexity)
+	}
+	if ops[0].Depth != 65 {
+		t.Errorf("Expected depth 65, got %d", ops[0].Depth)
+	}
+}
@@ -0,0 +1,182 @@
+package graphql
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("graphql", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
+	})
+}
+
+// setup configures a new GraphQL middleware instance.
+func setup(c *caddy.Controller) error {
+	configs, err := graphqlParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	for _, config := range configs {
+		config := config
+		cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+			return GraphQL{Next: next, Config: config}
+		})
+	}
+	return nil
+}
+
+// graphqlParse parses graphql directives of the form
+//
+//	graphql [path] {
+//	    max_depth      n
+//	    max_complexity n
+//	    max_body       size
+//	    rate           operation|* requests/window
+//	    per            ip|global
+//	    rate_store     url [batch]
+//	}
+//
+// The path defaults to /graphql and the body size to 1MB.
+// Complexity is the number of fields an operation selects.
+// Windows are s, m, h or a duration like 10s, and rates apply
+// per client IP unless they are global. With a rate store, like
+// redis://host:6379/0 or memcache://host:11211, the instances
+// sharing it enforce each rate together over windows aligned
+// to their clocks, leasing batch requests at a time from it so
+// bursts are absorbed locally; if it can't be reached, each
+// instance enforces the rates on its own.
+func graphqlParse(c *caddy.Controller) ([]*Config, error) {
+	var configs []*Config
+
+	for c.Next() {
+		config := &Config{Path: defaultPath, MaxBody: defaultMaxBody, Per: PerIP, Rates: make(map[string]Rate)}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			config.Path = args[0]
+		default:
+			return configs, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "max_depth", "max_complexity":
+				if len(args) != 1 {
+					return configs, c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 1 {
+					return configs, c.Errf("graphql: invalid %s '%s'", what, args[0])
+				}
+				if what == "max_depth" {
+					config.MaxDepth = n
+				} else {
+					config.MaxComplexity = n
+				}
+			case "max_body":
+				if len(args) != 1 {
+					return configs, c.ArgErr()
+				}
+				size, err := humanize.ParseBytes(args[0])
+				if err != nil || size == 0 {
+					return configs, c.Errf("graphql: invalid max_body '%s'", args[0])
+				}
+				config.MaxBody = int64(size)
+			case "rate":
+				if len(args) != 2 {
+					return configs, c.ArgErr()
+				}
+				if _, dup := config.Rates[args[0]]; dup {
+					return configs, c.Errf("graphql: duplicate rate for '%s'", args[0])
+				}
+				rate, err := parseRate(args[1])
+				if err != nil {
+					return configs, c.Errf("graphql: invalid rate '%s'", args[1])
+				}
+				config.Rates[args[0]] = rate
+			case "per":
+				if len(args) != 1 {
+					return configs, c.ArgErr()
+				}
+				if args[0] != PerIP && args[0] != Global {
+					return configs, c.Errf("graphql: invalid scope '%s'", args[0])
+				}
+				config.Per = args[0]
+			case "rate_store":
+				if len(args) != 1 && len(args) != 2 {
+					return configs, c.ArgErr()
+				}
+				u, err := url.Parse(args[0])
+				if err != nil {
+					return configs, c.Errf("graphql: invalid rate_store '%s'", args[0])
+				}
+				newStore, ok := supportedCounterStores[u.Scheme]
+				if !ok || u.Host == "" {
+					return configs, c.Errf("graphql: invalid rate_store '%s'", args[0])
+				}
+				config.Store, err = newStore(u)
+				if err != nil {
+					return configs, c.Errf("graphql: invalid rate_store '%s': %v", args[0], err)
+				}
+				if len(args) == 2 {
+					config.Batch, err = strconv.Atoi(args[1])
+					if err != nil || config.Batch < 1 {
+						return configs, c.Errf("graphql: invalid batch '%s'", args[1])
+					}
+				}
+			default:
+				return configs, c.Errf("graphql: unknown property '%s'", what)
+			}
+		}
+
+		for _, existing := range configs {
+			if existing.Path == config.Path {
+				return configs, c.Errf("graphql: duplicate path '%s'", config.Path)
+			}
+		}
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+// parseRate parses a rate like 10/s or 100/5m.
+func parseRate(s string) (Rate, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Rate{}, strconv.ErrSyntax
+	}
+	n, err := strconv.Atoi(parts[0])
+	if err != nil || n < 1 {
+		return Rate{}, strconv.ErrSyntax
+	}
+	window := parts[1]
+	if window == "s" || window == "m" || window == "h" {
+		window = "1" + window
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Rate{}, strconv.ErrSyntax
+	}
+	return Rate{Requests: n, Window: d}, nil
+}
+
+const (
+	defaultPath    = "/graphql"
+	defaultMaxBody = 1 << 20
+)
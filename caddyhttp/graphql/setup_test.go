@@ -0,0 +1,104 @@
+package graphql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/internal/kvstore"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `graphql /api {
+		max_depth 5
+	}`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) != 1 {
+		t.Fatalf("Expected 1 middleware, got %d", len(mids))
+	}
+	handler, ok := mids[0](httpserver.EmptyNext).(GraphQL)
+	if !ok {
+		t.Fatalf("Expected handler to be type GraphQL, got: %#v", handler)
+	}
+	if !httpserver.SameNext(handler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if handler.Config.Path != "/api" || handler.Config.MaxDepth != 5 {
+		t.Errorf("Unexpected config: %+v", handler.Config)
+	}
+}
+
+func TestGraphQLParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []*Config
+	}{
+		{`graphql`, false, []*Config{{Path: "/graphql", MaxBody: 1 << 20, Per: PerIP, Rates: map[string]Rate{}}}},
+		{`graphql /api {
+			max_depth 10
+			max_complexity 200
+			max_body 64KB
+			rate Search 10/s
+			rate * 100/5m
+			per global
+		}`, false, []*Config{{
+			Path: "/api", MaxDepth: 10, MaxComplexity: 200, MaxBody: 64000, Per: Global,
+			Rates: map[string]Rate{"Search": {10, time.Second}, "*": {100, 5 * time.Minute}},
+		}}},
+		{"graphql /a\ngraphql /b", false, []*Config{
+			{Path: "/a", MaxBody: 1 << 20, Per: PerIP, Rates: map[string]Rate{}},
+			{Path: "/b", MaxBody: 1 << 20, Per: PerIP, Rates: map[string]Rate{}},
+		}},
+		{"graphql /a\ngraphql /a", true, nil},
+		{`graphql /a /b`, true, nil},
+		{"graphql {\n max_depth 0\n}", true, nil},
+		{"graphql {\n max_depth\n}", true, nil},
+		{"graphql {\n max_complexity x\n}", true, nil},
+		{"graphql {\n max_body nope\n}", true, nil},
+		{"graphql {\n rate Search\n}", true, nil},
+		{"graphql {\n rate Search 10\n}", true, nil},
+		{"graphql {\n rate Search 0/s\n}", true, nil},
+		{"graphql {\n rate Search 10/week\n}", true, nil},
+		{"graphql {\n rate Search 10/s\n rate Search 20/s\n}", true, nil},
+		{"graphql {\n per user\n}", true, nil},
+		{"graphql {\n cache on\n}", true, nil},
+		{"graphql {\n rate_store\n}", true, nil},
+		{"graphql {\n rate_store ftp://cache.local\n}", true, nil},
+		{"graphql {\n rate_store redis://cache.local/db\n}", true, nil},
+		{"graphql {\n rate_store redis://cache.local 0\n}", true, nil},
+	} {
+		configs, err := graphqlParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if !reflect.DeepEqual(configs, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, configs)
+		}
+	}
+}
+
+func TestGraphQLParseRateStore(t *testing.T) {
+	configs, err := graphqlParse(caddy.NewTestController("http", "graphql {\n rate_store memcache://cache.local 20\n}"))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	store, ok := configs[0].Store.(*kvstore.Memcache)
+	if !ok || store.Addr() != "cache.local:11211" {
+		t.Errorf("Expected memcache store at cache.local:11211, got %#v", configs[0].Store)
+	}
+	if configs[0].Batch != 20 {
+		t.Errorf("Expected batch of 20, got %d", configs[0].Batch)
+	}
+}
@@ -0,0 +1,176 @@
+package graphql
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"log"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/internal/kvstore"
+)
+
+var supportedCounterStores = make(map[string]func(*url.URL) (CounterStore, error))
+
+func init() {
+	RegisterCounterStore("redis", newRedisStore)
+	RegisterCounterStore("memcache", newMemcacheStore)
+}
+
+func newRedisStore(u *url.URL) (CounterStore, error) {
+	store, err := kvstore.NewRedis(u)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func newMemcacheStore(u *url.URL) (CounterStore, error) {
+	store, err := kvstore.NewMemcache(u)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// CounterStore keeps counters shared by several Caddy instances,
+// so that the instances enforce rates together, as one.
+type CounterStore interface {
+	// Add adds n to the counter of key, which starts at 0
+	// and expires after ttl, and returns its new value.
+	Add(key string, n int64, ttl time.Duration) (int64, error)
+}
+
+// RegisterCounterStore adds a kind of counter store for rates.
+// Stores of that kind are configured with a URL of the given
+// scheme, which is passed to newStore.
+func RegisterCounterStore(scheme string, newStore func(*url.URL) (CounterStore, error)) {
+	supportedCounterStores[scheme] = newStore
+}
+
+// lease is the part of the requests allowed in a window
+// of a shared rate that an instance took from the store,
+// so that most requests need no round trip to the store.
+type lease struct {
+	mu        sync.Mutex
+	window    int64
+	left      int64
+	exhausted bool
+}
+
+// reserveShared takes a request for key, limited by rate, from
+// the requests leased from the store in the current window, and
+// returns how long to wait before retrying if there is none
+// left. It returns false if the store could not be reached
+// now or a short while ago.
+func (c *Config) reserveShared(key string, rate Rate, t time.Time) (time.Duration, bool) {
+	window := t.UnixNano() / int64(rate.Window)
+	end := time.Unix(0, (window+1)*int64(rate.Window))
+
+	c.mu.Lock()
+	if t.Before(c.storeRetry) {
+		c.mu.Unlock()
+		return 0, false
+	}
+	if c.leases == nil {
+		c.leases = make(map[string]*lease)
+	}
+	l, ok := c.leases[key]
+	if !ok {
+		if len(c.leases) >= maxBuckets {
+			c.forgetLeases(window)
+		}
+		l = new(lease)
+		c.leases[key] = l
+	}
+	c.mu.Unlock()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.window != window {
+		l.window, l.left, l.exhausted = window, 0, false
+	}
+	if l.left > 0 {
+		l.left--
+		return 0, true
+	}
+	if l.exhausted {
+		return end.Sub(t), true
+	}
+
+	batch := c.batch(rate)
+	total, err := c.Store.Add(c.storeKey(key, window), batch, end.Sub(t)+time.Second)
+	if err != nil {
+		c.storeFailed(err, t)
+		return 0, false
+	}
+	granted := batch
+	if over := total - int64(rate.Requests); over > 0 {
+		granted -= over
+	}
+	if granted <= 0 {
+		l.exhausted = true
+		return end.Sub(t), true
+	}
+	l.left = granted - 1
+	return 0, true
+}
+
+// batch returns how many requests of rate are
+// leased from the store at a time.
+func (c *Config) batch(rate Rate) int64 {
+	batch := c.Batch
+	if batch < 1 {
+		batch = rate.Requests / defaultBatchDivisor
+	}
+	if batch > rate.Requests {
+		batch = rate.Requests
+	}
+	if batch < 1 {
+		batch = 1
+	}
+	return int64(batch)
+}
+
+// storeKey returns the key of the counter of key in window,
+// which is safe to use with any store.
+func (c *Config) storeKey(key string, window int64) string {
+	sum := sha1.Sum([]byte(c.Path + "\x00" + key))
+	return "caddy-graphql-" + hex.EncodeToString(sum[:]) + "-" + strconv.FormatInt(window, 10)
+}
+
+// forgetLeases forgets the leases of windows before window.
+// The lock on c must be held.
+func (c *Config) forgetLeases(window int64) {
+	for key, l := range c.leases {
+		l.mu.Lock()
+		old := l.window < window
+		l.mu.Unlock()
+		if old {
+			delete(c.leases, key)
+		}
+	}
+}
+
+// storeFailed makes the store be skipped for a while after it
+// failed with err at t, and logs err at most once a minute.
+func (c *Config) storeFailed(err error, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.storeRetry = t.Add(storeRetryInterval)
+	if t.Sub(c.storeErrorLogged) < time.Minute {
+		return
+	}
+	c.storeErrorLogged = t
+	log.Printf("[ERROR] graphql: counter store: %v; enforcing rates locally", err)
+}
+
+const (
+	// defaultBatchDivisor is the share of the requests of a
+	// window that are leased at a time if not configured.
+	defaultBatchDivisor = 10
+
+	storeRetryInterval = 5 * time.Second
+)
@@ -0,0 +1,102 @@
+package graphql
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSharedRates(t *testing.T) {
+	current := time.Unix(1000*60, 0)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	store := newMemoryCounterStore()
+
+	// two instances share 10 requests a minute,
+	// leasing 3 of them at a time
+	newConfig := func() *Config {
+		return &Config{
+			Path:  "/",
+			Per:   Global,
+			Rates: map[string]Rate{"*": {Requests: 10, Window: time.Minute}},
+			Store: store,
+			Batch: 3,
+		}
+	}
+	a, b := newConfig(), newConfig()
+	var allowed int
+	for i := 0; i < 20; i++ {
+		instance := a
+		if i%2 == 1 {
+			instance = b
+		}
+		if instance.reserve(nil, "") == 0 {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Errorf("Expected 10 requests to be allowed in total, got %d", allowed)
+	}
+	if wait := a.reserve(nil, ""); wait != time.Minute {
+		t.Errorf("Expected to wait for the next window, got %v", wait)
+	}
+
+	// the next window has requests again
+	current = current.Add(time.Minute)
+	if wait := b.reserve(nil, ""); wait != 0 {
+		t.Errorf("Expected request in next window to be allowed, got wait %v", wait)
+	}
+
+	// without the store, each instance limits on its own
+	store.down = true
+	a = newConfig()
+	for i := 0; i < 10; i++ {
+		if wait := a.reserve(nil, ""); wait != 0 {
+			t.Fatalf("Request %d: Expected local bucket to allow request, got wait %v", i, wait)
+		}
+	}
+	if wait := a.reserve(nil, ""); wait == 0 {
+		t.Error("Expected local bucket to be empty")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	for i, test := range []struct {
+		batch, requests int
+		expected        int64
+	}{
+		{0, 100, 10},
+		{0, 5, 1},
+		{20, 100, 20},
+		{20, 5, 5},
+	} {
+		c := &Config{Batch: test.batch}
+		if got := c.batch(Rate{Requests: test.requests, Window: time.Second}); got != test.expected {
+			t.Errorf("Test %d: Expected batch of %d, got %d", i, test.expected, got)
+		}
+	}
+}
+
+// memoryCounterStore is a CounterStore in memory, like
+// the ones of the kvstore package, which fails while down.
+type memoryCounterStore struct {
+	mu       sync.Mutex
+	counters map[string]int64
+	down     bool
+}
+
+func newMemoryCounterStore() *memoryCounterStore {
+	return &memoryCounterStore{counters: make(map[string]int64)}
+}
+
+func (s *memoryCounterStore) Add(key string, n int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		return 0, errors.New("store is down")
+	}
+	s.counters[key] += n
+	return s.counters[key], nil
+}
@@ -0,0 +1,82 @@
+package gzip
+
+import (
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// DictEncoding is the content coding of responses compressed
+// with a dictionary that the client has: a zlib stream (RFC 1950)
+// with the dictionary preset, which it names by its Adler-32
+// checksum. The standard library has neither Brotli nor
+// Zstandard, whose shared dictionary codings browsers use, so
+// this is for clients that negotiate it, like API clients that
+// ship with the dictionary.
+const DictEncoding = "deflate-dict"
+
+// maxDictSize is the size of the window of DEFLATE; only the
+// last this many bytes of a dictionary are used.
+const maxDictSize = 32 << 10
+
+// Dictionary is a shared compression dictionary, such as a
+// sample of the repetitive JSON of an API's responses.
+type Dictionary struct {
+	// Data is the content of the dictionary.
+	Data []byte
+
+	// Hash is the dictionary's SHA-256 as a structured field
+	// byte sequence, like in the Available-Dictionary header:
+	// the base64 encoding between colons.
+	Hash string
+}
+
+// NewDictionary returns the Dictionary of data.
+func NewDictionary(data []byte) Dictionary {
+	if len(data) > maxDictSize {
+		data = data[len(data)-maxDictSize:]
+	}
+	sum := sha256.Sum256(data)
+	return Dictionary{Data: data, Hash: ":" + base64.StdEncoding.EncodeToString(sum[:]) + ":"}
+}
+
+// LoadDictionary reads the dictionary in file.
+func LoadDictionary(file string) (Dictionary, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return Dictionary{}, err
+	}
+	return NewDictionary(data), nil
+}
+
+// dictionary returns the dictionary of c that r may be
+// compressed with: the one whose hash the client sent in the
+// Available-Dictionary header, if it accepts DictEncoding.
+func (c Config) dictionary(r *http.Request) *Dictionary {
+	if len(c.Dictionaries) == 0 || !httpserver.AcceptsEncoding(r, DictEncoding) {
+		return nil
+	}
+	hash := strings.TrimSpace(r.Header.Get("Available-Dictionary"))
+	for i := range c.Dictionaries {
+		if c.Dictionaries[i].Hash == hash {
+			return &c.Dictionaries[i]
+		}
+	}
+	return nil
+}
+
+// newDictWriter creates a new writer of DictEncoding with the
+// dictionary d, at the compression level of c if it is valid.
+func newDictWriter(c Config, d *Dictionary, w io.Writer) (*zlib.Writer, error) {
+	level := zlib.DefaultCompression
+	if c.Level >= zlib.BestSpeed && c.Level <= zlib.BestCompression {
+		level = c.Level
+	}
+	return zlib.NewWriterLevelDict(w, level, d.Data)
+}
@@ -0,0 +1,88 @@
+package gzip
+
+import (
+	"compress/zlib"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestDictionaryCompression(t *testing.T) {
+	body := `{"id":1,"name":"widget","price":{"amount":100,"currency":"EUR"},"tags":["a","b"]}`
+	dict := NewDictionary([]byte(`{"id":,"name":"","price":{"amount":,"currency":"EUR"},"tags":[]}`))
+	other := NewDictionary([]byte("something else"))
+	gz := Gzip{
+		Configs: []Config{{Dictionaries: []Dictionary{other, dict}}},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(body))
+			return 0, nil
+		}),
+	}
+
+	for i, test := range []struct {
+		acceptEncoding      string
+		availableDictionary string
+		expectedEncoding    string
+	}{
+		{"gzip, " + DictEncoding, dict.Hash, DictEncoding},
+		{DictEncoding, other.Hash, DictEncoding},
+		{"gzip, " + DictEncoding, ":bm9wZQ==:", "gzip"},
+		{"gzip, " + DictEncoding, "", "gzip"},
+		{"gzip", dict.Hash, "gzip"},
+		{DictEncoding + ";q=0, gzip", dict.Hash, "gzip"},
+		{DictEncoding, ":bm9wZQ==:", ""},
+	} {
+		r := httptest.NewRequest("GET", "/api/items", nil)
+		r.Header.Set("Accept-Encoding", test.acceptEncoding)
+		if test.availableDictionary != "" {
+			r.Header.Set("Available-Dictionary", test.availableDictionary)
+		}
+		w := httptest.NewRecorder()
+		if _, err := gz.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != test.expectedEncoding {
+			t.Errorf("Test %d: Expected Content-Encoding '%s', got '%s'", i, test.expectedEncoding, got)
+		}
+		if test.expectedEncoding != DictEncoding {
+			continue
+		}
+		if vary := w.Header()["Vary"]; !strings.Contains(strings.Join(vary, ","), "Available-Dictionary") {
+			t.Errorf("Test %d: Expected Vary to include Available-Dictionary, got %v", i, vary)
+		}
+		d := dict
+		if test.availableDictionary == other.Hash {
+			d = other
+		}
+		zr, err := zlib.NewReaderDict(w.Body, d.Data)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error reading the response, got: %v", i, err)
+		}
+		got, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error reading the response, got: %v", i, err)
+		}
+		if string(got) != body {
+			t.Errorf("Test %d: Expected body %s, got %s", i, body, got)
+		}
+	}
+}
+
+func TestNewDictionary(t *testing.T) {
+	// the hash is that of the part of the dictionary in use
+	d := NewDictionary([]byte(strings.Repeat("x", maxDictSize+10)))
+	if len(d.Data) != maxDictSize {
+		t.Errorf("Expected dictionary of %d bytes, got %d", maxDictSize, len(d.Data))
+	}
+	if NewDictionary(d.Data).Hash != d.Hash {
+		t.Error("Expected hash of the truncated dictionary")
+	}
+	if d := NewDictionary([]byte("abc")); d.Hash != ":ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=:" {
+		t.Errorf("Expected SHA-256 of abc, got %s", d.Hash)
+	}
+}
@@ -17,8 +17,9 @@ import (
 
 func init() {
 	caddy.RegisterPlugin("gzip", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
@@ -36,11 +37,22 @@ type Config struct {
 	RequestFilters  []RequestFilter
 	ResponseFilters []ResponseFilter
 	Level           int // Compression level
+
+	// Dictionaries that clients may have, to compress
+	// responses with
+	Dictionaries []Dictionary
+
+	// Precompress, if set, writes compressed copies of
+	// the files of the site, for the static file server
+	Precompress *Precompressor
 }
 
-// ServeHTTP serves a gzipped response if the client supports it.
+// ServeHTTP serves a gzipped response if the client supports it,
+// or one compressed with a dictionary the client has.
 func (g Gzip) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
-	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+	acceptsGzip := strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+	if !acceptsGzip && !strings.Contains(r.Header.Get("Accept-Encoding"), DictEncoding) &&
+		!strings.Contains(r.Header.Get("Accept-Encoding"), "br") {
 		return g.Next.ServeHTTP(w, r)
 	}
 outer:
@@ -53,19 +65,36 @@ outer:
 			}
 		}
 
+		dict := c.dictionary(r)
+		if dict == nil && c.Precompress != nil {
+			// the static file server sends compressed copies, if any
+			r = c.Precompress.withEncodings(r)
+		}
+		if dict == nil && !acceptsGzip {
+			continue
+		}
+
 		// Delete this header so gzipping is not repeated later in the chain
 		r.Header.Del("Accept-Encoding")
 
 		// gzipWriter modifies underlying writer at init,
 		// use a discard writer instead to leave ResponseWriter in
 		// original form.
-		gzipWriter, err := newWriter(c, ioutil.Discard)
+		var gzipWriter compressor
+		var err error
+		encoding := "gzip"
+		if dict != nil {
+			gzipWriter, err = newDictWriter(c, dict, ioutil.Discard)
+			encoding = DictEncoding
+		} else {
+			gzipWriter, err = newWriter(c, ioutil.Discard)
+		}
 		if err != nil {
 			// should not happen
 			return http.StatusInternalServerError, err
 		}
 		defer gzipWriter.Close()
-		gz := &gzipResponseWriter{Writer: gzipWriter, ResponseWriter: w}
+		gz := &gzipResponseWriter{Writer: gzipWriter, ResponseWriter: w, encoding: encoding}
 
 		var rw http.ResponseWriter
 		// if no response filter is used
@@ -105,12 +134,19 @@ func newWriter(c Config, w io.Writer) (*gzip.Writer, error) {
 	return gzip.NewWriter(w), nil
 }
 
+// compressor is a writer of compressed data.
+type compressor interface {
+	io.WriteCloser
+	Reset(io.Writer)
+}
+
 // gzipResponeWriter wraps the underlying Write method
 // with a gzip.Writer to compress the output.
 type gzipResponseWriter struct {
 	io.Writer
 	http.ResponseWriter
 	statusCodeWritten bool
+	encoding          string // gzip if empty
 }
 
 // WriteHeader wraps the underlying WriteHeader method to prevent
@@ -118,9 +154,27 @@ type gzipResponseWriter struct {
 // example, a backend system that calculates Content-Length would
 // be wrong because it doesn't know it's being gzipped.
 func (w *gzipResponseWriter) WriteHeader(code int) {
+	if w.Header().Get("Content-Encoding") != "" {
+		// already compressed, like the copies that the static
+		// file server sends, so written as is
+		if c, ok := w.Writer.(compressor); ok {
+			c.Reset(ioutil.Discard)
+		}
+		w.Writer = w.ResponseWriter
+		w.ResponseWriter.WriteHeader(code)
+		w.statusCodeWritten = true
+		return
+	}
 	w.Header().Del("Content-Length")
-	w.Header().Set("Content-Encoding", "gzip")
+	encoding := w.encoding
+	if encoding == "" {
+		encoding = "gzip"
+	}
+	w.Header().Set("Content-Encoding", encoding)
 	w.Header().Add("Vary", "Accept-Encoding")
+	if encoding == DictEncoding {
+		w.Header().Add("Vary", "Available-Dictionary")
+	}
 	w.ResponseWriter.WriteHeader(code)
 	w.statusCodeWritten = true
 }
@@ -0,0 +1,213 @@
+package gzip
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+// Precompressor writes compressed copies, with a .gz and a .br
+// extension, of the files of a site that would be compressed
+// anyway, at startup and when they change, so they are not
+// compressed again for every request. The static file server
+// serves them, once the request went through all middleware.
+type Precompressor struct {
+	// Root is the directory of the site
+	Root string
+
+	// FallbackRoots are the directories whose
+	// files the site serves if Root has not
+	FallbackRoots []string
+
+	// Hide are the files of the site that are not
+	// served, so neither are copies written of them
+	Hide []string
+
+	// Files shorter than this are not compressed
+	MinLength int64
+
+	// How often files are checked for changes
+	Interval time.Duration
+
+	// Filters select the files compressed, as if requested
+	Filters []RequestFilter
+}
+
+// run compresses the files, and then the files that
+// change, until stop is closed.
+func (p *Precompressor) run(stop chan struct{}) {
+	p.compressAll()
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.compressAll()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// compressAll compresses the files of all roots
+// whose compressed copy is missing or older than
+// the file.
+func (p *Precompressor) compressAll() {
+	for _, root := range append([]string{p.Root}, p.FallbackRoots...) {
+		p.compressRoot(root)
+	}
+}
+
+// compressRoot compresses the files in root.
+func (p *Precompressor) compressRoot(root string) {
+	hidden := p.hiddenFiles(root)
+	filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if name != root && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || isCompressedCopy(name) || info.Size() < p.MinLength {
+			return nil
+		}
+		for _, h := range hidden {
+			if os.SameFile(info, h) {
+				return nil
+			}
+		}
+		if !p.shouldCompress(root, name) {
+			return nil
+		}
+		for _, enc := range encoders {
+			if c, err := os.Stat(name + enc.ext); err == nil && !c.ModTime().Before(info.ModTime()) {
+				continue
+			}
+			if err := compressFile(name, info, enc); err != nil {
+				log.Printf("[ERROR] gzip: precompressing %s: %v", name+enc.ext, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (p *Precompressor) hiddenFiles(root string) []os.FileInfo {
+	var hidden []os.FileInfo
+	for _, name := range p.Hide {
+		if info, err := os.Stat(filepath.Join(root, name)); err == nil {
+			hidden = append(hidden, info)
+		}
+	}
+	return hidden
+}
+
+// shouldCompress returns whether the file name in
+// root would be compressed if it were requested.
+func (p *Precompressor) shouldCompress(root, name string) bool {
+	rel, err := filepath.Rel(root, name)
+	if err != nil {
+		return false
+	}
+	r := &http.Request{URL: &url.URL{Path: "/" + filepath.ToSlash(rel)}}
+	for _, filter := range p.Filters {
+		if !filter.ShouldCompress(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// encoder writes the compressed copies with extension ext.
+type encoder struct {
+	ext       string
+	newWriter func(io.Writer) io.WriteCloser
+}
+
+// encoders write the compressed copies of files.
+var encoders = []encoder{
+	{".gz", func(w io.Writer) io.WriteCloser {
+		gz, _ := gzip.NewWriterLevel(w, gzip.BestCompression)
+		return gz
+	}},
+	{".br", func(w io.Writer) io.WriteCloser {
+		return brotli.NewWriterLevel(w, brotli.BestCompression)
+	}},
+}
+
+// isCompressedCopy returns whether the file name
+// is a compressed copy that an encoder writes.
+func isCompressedCopy(name string) bool {
+	for _, enc := range encoders {
+		if strings.HasSuffix(name, enc.ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressFile writes the compressed copy of the file name,
+// with its modification time, so it is known to be fresh.
+func compressFile(name string, info os.FileInfo, enc encoder) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// written aside first, so the copy is never served partly written
+	tmp := name + enc.ext + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	cw := enc.newWriter(out)
+	_, err = io.Copy(cw, in)
+	if closeErr := cw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp, name+enc.ext)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// withEncodings returns r, for which the static file server
+// serves the compressed copies of files that r accepts.
+func (p *Precompressor) withEncodings(r *http.Request) *http.Request {
+	var encodings []string
+	for _, enc := range []string{"br", "gzip"} {
+		if httpserver.AcceptsEncoding(r, enc) {
+			encodings = append(encodings, enc)
+		}
+	}
+	if len(encodings) == 0 {
+		return r
+	}
+	return staticfiles.WithPrecompressed(r, encodings)
+}
+
+// DefaultPrecompressInterval is how often files are
+// checked for changes, unless configured otherwise.
+const DefaultPrecompressInterval = 1 * time.Minute
@@ -0,0 +1,182 @@
+package gzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+func TestPrecompress(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_gzip_precompress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	long := strings.Repeat("compress me ", 100)
+	files := map[string]string{
+		"index.html":        long,
+		"css/site.css":      long,
+		"short.txt":         "tiny",
+		"logo.png":          long,
+		"Caddyfile":         long,
+		".git/config":       long,
+		"already.html.gz":   long,
+		"excluded/page.htm": long,
+	}
+	for name, content := range files {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := &Precompressor{
+		Root:      root,
+		Hide:      []string{"Caddyfile"},
+		MinLength: 10,
+		Filters: []RequestFilter{
+			PathFilter{IgnoredPaths: Set{"/excluded": struct{}{}}},
+			DefaultExtFilter(),
+		},
+	}
+	p.compressAll()
+
+	for name := range files {
+		for _, ext := range []string{".gz", ".br"} {
+			_, err := os.Stat(filepath.Join(root, filepath.FromSlash(name)) + ext)
+			expected := name == "index.html" || name == "css/site.css"
+			if expected != (err == nil) {
+				t.Errorf("Expected %s copy of %s: %v, got error %v", ext, name, expected, err)
+			}
+		}
+	}
+	index := filepath.Join(root, "index.html")
+	if got := gunzipFile(t, index+".gz"); got != long {
+		t.Errorf("Expected compressed copy of the file, got %q", got)
+	}
+	if got := unbrotliFile(t, index+".br"); got != long {
+		t.Errorf("Expected Brotli copy of the file, got %q", got)
+	}
+
+	// changed files are compressed again
+	ioutil.WriteFile(index, []byte("changed "+long), 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(index, later, later)
+	p.compressAll()
+	if got := gunzipFile(t, index+".gz"); got != "changed "+long {
+		t.Errorf("Expected compressed copy of the changed file, got %q", got)
+	}
+
+	// the copies are sent by the static file server,
+	// after the middleware that runs before it
+	g := Gzip{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if r.Header.Get("Authorization") == "" {
+				return http.StatusUnauthorized, nil
+			}
+			return staticfiles.FileServer{Root: http.Dir(root), Hide: p.Hide}.ServeHTTP(w, r)
+		}),
+		Configs: []Config{{RequestFilters: p.Filters, Precompress: p}},
+	}
+	gz, _ := ioutil.ReadFile(index + ".gz")
+	br, _ := ioutil.ReadFile(index + ".br")
+	for i, test := range []struct {
+		path, accept     string
+		expectedEncoding string
+		expectedBody     []byte
+	}{
+		{"/index.html", "gzip", "gzip", gz},
+		{"/", "gzip", "gzip", gz},
+		{"/index.html", "gzip, br", "br", br},
+		{"/index.html", "br", "br", br},
+		{"/index.html", "gzip, br;q=0", "gzip", gz},
+		{"/index.html", "identity", "", []byte("changed " + long)},
+	} {
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Header.Set("Accept-Encoding", test.accept)
+		req.Header.Set("Authorization", "yes")
+		w := httptest.NewRecorder()
+		if status, _ := g.ServeHTTP(w, req); status != http.StatusOK {
+			t.Errorf("Test %d: Expected status 200, got %d", i, status)
+		}
+		if enc := w.Header().Get("Content-Encoding"); enc != test.expectedEncoding {
+			t.Errorf("Test %d: Expected encoding %q, got %q", i, test.expectedEncoding, enc)
+		}
+		if !bytes.Equal(w.Body.Bytes(), test.expectedBody) {
+			t.Errorf("Test %d: Expected the compressed copy to be sent as is", i)
+		}
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+			t.Errorf("Test %d: Expected the type of the file, got %s", i, w.Header().Get("Content-Type"))
+		}
+	}
+
+	// copies are not sent past the middleware before the file server
+	req := httptest.NewRequest("GET", "/index.html", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without authorization, got %d", w.Code)
+	}
+
+	// a stale copy is not sent; the file is compressed instead
+	ioutil.WriteFile(index, []byte("newer"), 0644)
+	evenLater := later.Add(time.Minute)
+	os.Chtimes(index, evenLater, evenLater)
+	req = httptest.NewRequest("GET", "/index.html", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	req.Header.Set("Authorization", "yes")
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected response to be compressed, got encoding %q", w.Header().Get("Content-Encoding"))
+	}
+	r, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := ioutil.ReadAll(r); string(body) != "newer" {
+		t.Errorf("Expected the file to be compressed instead of the stale copy, got %q", body)
+	}
+}
+
+func gunzipFile(t *testing.T, name string) string {
+	compressed, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func unbrotliFile(t *testing.T, name string) string {
+	compressed, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(brotli.NewReader(bytes.NewReader(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -16,13 +17,52 @@ func setup(c *caddy.Controller) error {
 		return err
 	}
 
-	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+	cfg := httpserver.GetConfig(c)
+	for _, config := range configs {
+		p := config.Precompress
+		if p == nil {
+			continue
+		}
+		if err := httpserver.CheckStaticRoot(c); err != nil {
+			return err
+		}
+		p.Root, p.FallbackRoots, p.Hide = cfg.Root, cfg.FallbackRoots, cfg.HiddenFiles
+		stop := make(chan struct{})
+		c.OnStartup(func() error {
+			go p.run(stop)
+			return nil
+		})
+		c.OnShutdown(func() error {
+			close(stop)
+			return nil
+		})
+	}
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
 		return Gzip{Next: next, Configs: configs}
 	})
 
 	return nil
 }
 
+// gzipParse parses gzip directives. Syntax:
+//
+//	gzip {
+//	    ext        extensions...
+//	    not        paths...
+//	    level      compression_level
+//	    min_length bytes
+//	    dictionary files...
+//	    precompress [interval]
+//	}
+//
+// Clients that have one of the dictionaries, as sent in the
+// Available-Dictionary header by its SHA-256, and that accept
+// the deflate-dict coding get responses compressed with it.
+// With precompress, gzip and Brotli compressed copies of the files
+// of the site are written at startup, and every interval if they
+// changed; the static file server sends them to clients that accept
+// them instead of the files.
 func gzipParse(c *caddy.Controller) ([]Config, error) {
 	var configs []Config
 
@@ -85,6 +125,30 @@ func gzipParse(c *caddy.Controller) ([]Config, error) {
 					return configs, fmt.Errorf(`gzip: min_length must be greater than 0`)
 				}
 				lengthFilter = LengthFilter(length)
+			case "dictionary":
+				files := c.RemainingArgs()
+				if len(files) == 0 {
+					return configs, c.ArgErr()
+				}
+				for _, file := range files {
+					dict, err := LoadDictionary(file)
+					if err != nil {
+						return configs, fmt.Errorf(`gzip: loading dictionary: %v`, err)
+					}
+					config.Dictionaries = append(config.Dictionaries, dict)
+				}
+			case "precompress":
+				config.Precompress = &Precompressor{Interval: DefaultPrecompressInterval}
+				if c.NextArg() {
+					interval, err := time.ParseDuration(c.Val())
+					if err != nil || interval <= 0 {
+						return configs, fmt.Errorf(`gzip: invalid precompress interval "%v"`, c.Val())
+					}
+					config.Precompress.Interval = interval
+				}
+				if c.NextArg() {
+					return configs, c.ArgErr()
+				}
 			default:
 				return configs, c.ArgErr()
 			}
@@ -112,6 +176,11 @@ func gzipParse(c *caddy.Controller) ([]Config, error) {
 			config.ResponseFilters = append(config.ResponseFilters, lengthFilter)
 		}
 
+		if p := config.Precompress; p != nil {
+			p.Filters = config.RequestFilters
+			p.MinLength = int64(lengthFilter)
+		}
+
 		configs = append(configs, config)
 	}
 
@@ -89,6 +89,27 @@ func TestSetup(t *testing.T) {
 		 min_length 1000
 		}
 		`, false},
+		{`gzip {
+		 dictionary testdata/test.txt
+		}`, false},
+		{`gzip {
+		 dictionary
+		}`, true},
+		{`gzip {
+		 dictionary testdata/nonexistent.json
+		}`, true},
+		{`gzip {
+		 precompress
+		}`, false},
+		{`gzip {
+		 precompress 10s
+		}`, false},
+		{`gzip {
+		 precompress never
+		}`, true},
+		{`gzip {
+		 precompress 10s 20s
+		}`, true},
 	}
 	for i, test := range tests {
 		_, err := gzipParse(caddy.NewTestController("http", test.input))
@@ -0,0 +1,176 @@
+// Package handleerrors implements a middleware that hands the
+// errors of the rest of the site's middleware to a chain of
+// middleware of their own, which can respond to them like to
+// any request: with a page, a redirect, a proxied error
+// service or a structured error.
+package handleerrors
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+// HandleErrors passes the errors of the next handler that have
+// not been responded to, including statuses of 400 and above
+// that no middleware wrote, to the first of its Handlers that
+// handles their status.
+type HandleErrors struct {
+	Next     httpserver.Handler
+	Handlers []Handler
+}
+
+// Handler is a chain of middleware that handles errors.
+type Handler struct {
+	// Statuses that the chain handles; all errors if empty
+	Statuses []httpserver.StatusRange
+
+	// Chain of middleware, which ends in serving the file
+	// the chain rewrote the request to, if any
+	Chain httpserver.Handler
+}
+
+// Handles returns whether h handles errors with status.
+func (h Handler) Handles(status int) bool {
+	if len(h.Statuses) == 0 {
+		return true
+	}
+	for _, sr := range h.Statuses {
+		if sr.Contains(status) {
+			return true
+		}
+	}
+	return false
+}
+
+func (he HandleErrors) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	tw := &trackingWriter{ResponseRecorder: httpserver.NewResponseRecorder(w)}
+	status, err := he.Next.ServeHTTP(tw, r)
+	if tw.wrote || (err == nil && status < 400) {
+		return status, err
+	}
+	if status < 400 {
+		status = http.StatusInternalServerError
+	}
+
+	for _, h := range he.Handlers {
+		if !h.Handles(status) {
+			continue
+		}
+		msg := http.StatusText(status)
+		if err != nil {
+			msg = err.Error()
+		}
+		er := r
+		er = httpserver.SetRequestPlaceholder(er, "err.status", strconv.Itoa(status))
+		er = httpserver.SetRequestPlaceholder(er, "err.status_text", http.StatusText(status))
+		er = httpserver.SetRequestPlaceholder(er, "err.message", msg)
+		er = er.WithContext(context.WithValue(er.Context(), origErrCtxKey, origErr{
+			path:   r.URL.Path,
+			status: status,
+			err:    err,
+		}))
+
+		sw := &statusWriter{ResponseRecorder: httpserver.NewResponseRecorder(w), status: status}
+		s, e := h.Chain.ServeHTTP(sw, er)
+		if sw.wrote {
+			return 0, nil
+		}
+		return s, e
+	}
+	return status, err
+}
+
+// origErr is the error that a chain of Handler handles.
+type origErr struct {
+	path   string
+	status int
+	err    error
+}
+
+type ctxKey string
+
+const origErrCtxKey ctxKey = "handle_errors_orig"
+
+// FileServer ends the chain of a Handler. If the chain rewrote
+// the request, it serves the file the request was rewritten to,
+// with the status of the error; otherwise, or if there is no
+// such file, it returns the error to the site's error handling.
+type FileServer struct {
+	Site *httpserver.SiteConfig
+}
+
+func (fs FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	orig, _ := r.Context().Value(origErrCtxKey).(origErr)
+	if r.URL.Path == orig.path {
+		return orig.status, orig.err
+	}
+	status, err := staticfiles.FileServer{
+		Root:   fs.Site.FileSystem(),
+		Hide:   fs.Site.HiddenFiles,
+		Ranges: fs.Site.Ranges,
+	}.ServeHTTP(w, r)
+	if status >= 400 {
+		return orig.status, orig.err
+	}
+	return status, err
+}
+
+// trackingWriter records whether a response was written.
+type trackingWriter struct {
+	*httpserver.ResponseRecorder
+	wrote bool
+}
+
+func (w *trackingWriter) WriteHeader(status int) {
+	w.wrote = true
+	w.ResponseRecorder.WriteHeader(status)
+}
+
+func (w *trackingWriter) Write(buf []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseRecorder.Write(buf)
+}
+
+func (w *trackingWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.wrote = true
+	return w.ResponseRecorder.ReadFrom(src)
+}
+
+// statusWriter writes responses with the status of the
+// error they answer, unless a handler sets another one
+// than 200 OK.
+type statusWriter struct {
+	*httpserver.ResponseRecorder
+	status int
+	wrote  bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.wrote {
+		return
+	}
+	w.wrote = true
+	if status == http.StatusOK {
+		status = w.status
+	}
+	w.ResponseRecorder.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(buf []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(w.status)
+	}
+	return w.ResponseRecorder.Write(buf)
+}
+
+func (w *statusWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !w.wrote {
+		w.WriteHeader(w.status)
+	}
+	return w.ResponseRecorder.ReadFrom(src)
+}
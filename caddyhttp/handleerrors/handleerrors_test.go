@@ -0,0 +1,97 @@
+package handleerrors
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestHandleErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handleerrors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "error.html"), []byte("oops"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	site := &httpserver.SiteConfig{Root: dir}
+
+	respond := func(status int, err error, body string) httpserver.Handler {
+		return httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if body != "" {
+				w.WriteHeader(status)
+				w.Write([]byte(body))
+				return 0, nil
+			}
+			return status, err
+		})
+	}
+	// the chain of the handler answers with the error's placeholders
+	apiError := Handler{
+		Statuses: []httpserver.StatusRange{{Min: 500, Max: 599}},
+		Chain: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			status, _ := httpserver.RequestPlaceholder(r, "err.status")
+			msg, _ := httpserver.RequestPlaceholder(r, "err.message")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status":` + status + `,"error":"` + msg + `"}`))
+			return 0, nil
+		}),
+	}
+	// the chain of the handler rewrites to an error page
+	notFoundPage := Handler{
+		Statuses: []httpserver.StatusRange{{Min: 404, Max: 404}},
+		Chain: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			r.URL.Path = "/error.html"
+			return FileServer{Site: site}.ServeHTTP(w, r)
+		}),
+	}
+	// the chain of the handler doesn't respond
+	passThrough := Handler{Chain: FileServer{Site: site}}
+
+	for i, test := range []struct {
+		next           httpserver.Handler
+		handlers       []Handler
+		expectedStatus int
+		expectedCode   int
+		expectedBody   string
+		expectedErr    bool
+	}{
+		{respond(http.StatusBadGateway, errors.New("upstream down"), ""), []Handler{notFoundPage, apiError},
+			0, http.StatusBadGateway, `{"status":502,"error":"upstream down"}`, false},
+		{respond(http.StatusNotFound, nil, ""), []Handler{notFoundPage, apiError},
+			0, http.StatusNotFound, "oops", false},
+		{respond(http.StatusForbidden, nil, ""), []Handler{notFoundPage, apiError},
+			http.StatusForbidden, http.StatusOK, "", false},
+		{respond(http.StatusNotFound, nil, "custom"), []Handler{notFoundPage},
+			0, http.StatusNotFound, "custom", false},
+		{respond(http.StatusOK, nil, ""), []Handler{notFoundPage, apiError},
+			http.StatusOK, http.StatusOK, "", false},
+		{respond(0, errors.New("broken"), ""), []Handler{apiError},
+			0, http.StatusInternalServerError, `{"status":500,"error":"broken"}`, false},
+		{respond(http.StatusServiceUnavailable, errors.New("busy"), ""), []Handler{passThrough},
+			http.StatusServiceUnavailable, http.StatusOK, "", true},
+	} {
+		he := HandleErrors{Next: test.next, Handlers: test.handlers}
+		rec := httptest.NewRecorder()
+		status, err := he.ServeHTTP(rec, httptest.NewRequest("GET", "/page", nil))
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected returned status %d, got %d", i, test.expectedStatus, status)
+		}
+		if test.expectedErr != (err != nil) {
+			t.Errorf("Test %d: Expected error %v, got %v", i, test.expectedErr, err)
+		}
+		if rec.Code != test.expectedCode {
+			t.Errorf("Test %d: Expected response code %d, got %d", i, test.expectedCode, rec.Code)
+		}
+		if got := rec.Body.String(); got != test.expectedBody {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.expectedBody, got)
+		}
+	}
+}
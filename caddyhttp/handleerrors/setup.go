@@ -0,0 +1,55 @@
+package handleerrors
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("handle_errors", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new HandleErrors middleware instance.
+// Syntax:
+//
+//	handle_errors [statuses...] {
+//	    directives...
+//	}
+//
+// Statuses are codes like 404, ranges like 500-504 or classes
+// like 5xx of errors; without any, the block handles every
+// error. The directives in the block, which may be any that
+// add middleware, make up a chain that errors are handed to,
+// with the placeholders {err.status}, {err.status_text} and
+// {err.message}. Its responses get the status of the error
+// unless they set another; a rewrite in it serves the file
+// rewritten to. Errors the chain doesn't respond to go on to
+// the errors directive.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+
+	var handlers []Handler
+	for c.Next() {
+		args, mids, err := httpserver.SetupSubchain(c)
+		if err != nil {
+			return err
+		}
+		h := Handler{Chain: httpserver.Compose(mids, FileServer{Site: cfg})}
+		for _, arg := range args {
+			sr, err := httpserver.ParseStatusRange(arg)
+			if err != nil || sr.Min < 400 {
+				return c.Errf("handle_errors: invalid status '%s'", arg)
+			}
+			h.Statuses = append(h.Statuses, sr)
+		}
+		handlers = append(handlers, h)
+	}
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return HandleErrors{Next: next, Handlers: handlers}
+	})
+	return nil
+}
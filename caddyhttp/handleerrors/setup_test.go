@@ -0,0 +1,77 @@
+package handleerrors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy"
+	_ "github.com/mholt/caddy/caddyhttp/header"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	_ "github.com/mholt/caddy/caddyhttp/rewrite"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", "handle_errors 404 5xx {\n header / X-Error {err.status}\n rewrite / /error.html\n}\nhandle_errors {\n header / X-Other yes\n}")
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) != 1 {
+		t.Fatalf("Expected 1 middleware, had %d instead", len(mids))
+	}
+	he, ok := mids[0](httpserver.EmptyNext).(HandleErrors)
+	if !ok {
+		t.Fatalf("Expected handler to be type HandleErrors, got: %#v", mids[0](httpserver.EmptyNext))
+	}
+	if len(he.Handlers) != 2 {
+		t.Fatalf("Expected 2 handlers, got %d", len(he.Handlers))
+	}
+	if expected := []httpserver.StatusRange{{Min: 404, Max: 404}, {Min: 500, Max: 599}}; len(he.Handlers[0].Statuses) != 2 ||
+		he.Handlers[0].Statuses[0] != expected[0] || he.Handlers[0].Statuses[1] != expected[1] {
+		t.Errorf("Expected statuses %v, got %v", expected, he.Handlers[0].Statuses)
+	}
+	if len(he.Handlers[1].Statuses) != 0 {
+		t.Errorf("Expected second handler to handle all errors, got %v", he.Handlers[1].Statuses)
+	}
+
+	// the directives of the block run in their own chain
+	he.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusNotFound, nil
+	})
+	rec := httptest.NewRecorder()
+	he.ServeHTTP(rec, httptest.NewRequest("GET", "/missing", nil))
+	if got := rec.Header().Get("X-Error"); got != "404" {
+		t.Errorf("Expected X-Error header 404, got '%s'", got)
+	}
+}
+
+func TestSetupParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+	}{
+		{"handle_errors {\n header / X-A b\n}", false},
+		{"handle_errors 404 4XX 503 {\n header / X-A b\n}", false},
+		{"handle_errors {\n}", false},
+		{"handle_errors 500-504 {\n header / X-A b\n}", false},
+		{"handle_errors 300-404 {\n header / X-A b\n}", true},
+		{"handle_errors", true},
+		{"handle_errors 404", true},
+		{"handle_errors 200 {\n header / X-A b\n}", true},
+		{"handle_errors 3xx {\n header / X-A b\n}", true},
+		{"handle_errors abc {\n header / X-A b\n}", true},
+		{"handle_errors {\n root /srv\n}", true},
+		{"handle_errors {\n handle_errors {\n }\n}", true},
+		{"handle_errors {\n nonexistent\n}", true},
+		{"handle_errors {\n header / X-A b\n", true},
+	} {
+		err := setup(caddy.NewTestController("http", test.input))
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error, got none", i)
+		}
+		if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+	}
+}
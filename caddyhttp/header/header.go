@@ -25,7 +25,7 @@ func (h Headers) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 	replacer := httpserver.NewReplacer(r, nil, "")
 	rww := &responseWriterWrapper{w: w}
 	for _, rule := range h.Rules {
-		if httpserver.Path(r.URL.Path).Matches(rule.Path) {
+		if rule.Match(r) {
 			for name := range rule.Headers {
 
 				// One can either delete a header, add multiple values to a header, or simply
@@ -53,9 +53,21 @@ type (
 	Rule struct {
 		Path    string
 		Headers http.Header
+
+		// If set, the rule applies to the requests it
+		// matches instead; Path is the matcher's @name
+		Matcher httpserver.RequestMatcher
 	}
 )
 
+// Match returns whether the rule applies to r.
+func (rule Rule) Match(r *http.Request) bool {
+	if rule.Matcher != nil {
+		return rule.Matcher.Match(r)
+	}
+	return httpserver.Path(r.URL.Path).Matches(rule.Path)
+}
+
 // headerOperation represents an operation on the header
 type headerOperation func(http.Header)
 
@@ -9,8 +9,9 @@ import (
 
 func init() {
 	caddy.RegisterPlugin("header", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
@@ -53,6 +54,13 @@ func headersParse(c *caddy.Controller) ([]Rule, error) {
 		if head.Path == "" {
 			head.Path = pattern
 			isNewPattern = true
+			if httpserver.IsMatcherRef(pattern) {
+				m, err := httpserver.MatcherRef(c, pattern)
+				if err != nil {
+					return rules, err
+				}
+				head.Matcher = m
+			}
 		}
 
 		for c.NextBlock() {
@@ -86,3 +86,22 @@ func TestHeadersParse(t *testing.T) {
 		}
 	}
 }
+
+func TestHeadersNamedMatcher(t *testing.T) {
+	c := caddy.NewTestController("http", "header @api Cache-Control no-store")
+	httpserver.GetConfig(c).AddMatcher(&httpserver.Matcher{Name: "@api", Methods: []string{"POST"}})
+	rules, err := headersParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Matcher == nil {
+		t.Fatalf("Expected a rule with a matcher, got %+v", rules)
+	}
+	if !rules[0].Match(&http.Request{Method: "POST"}) || rules[0].Match(&http.Request{Method: "GET"}) {
+		t.Error("Expected rule to apply to POST requests only")
+	}
+
+	if _, err := headersParse(caddy.NewTestController("http", "header @web X-A b")); err == nil {
+		t.Error("Expected error for unknown matcher, got none")
+	}
+}
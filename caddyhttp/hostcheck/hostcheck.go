@@ -0,0 +1,114 @@
+// Package hostcheck provides middleware that rejects requests whose
+// Host header is not one the site expects, so that backends and
+// caches never see (and generate links from) a forged host.
+package hostcheck
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// HostCheck is middleware that only lets requests for
+// allowed hosts through.
+type HostCheck struct {
+	Next httpserver.Handler
+
+	// Hosts that are allowed, lower-cased; a "*" label
+	// matches any one label, as in certificates
+	Allowed []string
+
+	// Status written for requests for other hosts;
+	// malformed hosts always get 400 Bad Request
+	Status int
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (h HostCheck) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	status := h.check(r.Host)
+	if status == 0 {
+		// hosts forwarded by a proxy in front of us must be allowed, too
+		for _, fwd := range r.Header["X-Forwarded-Host"] {
+			for _, host := range strings.Split(fwd, ",") {
+				if status = h.check(strings.TrimSpace(host)); status != 0 {
+					break
+				}
+			}
+		}
+	}
+	if status != 0 {
+		remoteHost, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			remoteHost = r.RemoteAddr
+		}
+		log.Printf("[WARNING] host_check: rejected host %q (forwarded: %q) from %s",
+			r.Host, r.Header.Get("X-Forwarded-Host"), remoteHost)
+		return status, nil
+	}
+	return h.Next.ServeHTTP(w, r)
+}
+
+// check returns the status to reject hostport with,
+// or 0 if it is allowed.
+func (h HostCheck) check(hostport string) int {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if !validHost(host) {
+		return http.StatusBadRequest
+	}
+	for _, pattern := range h.Allowed {
+		if matchHost(pattern, host) {
+			return 0
+		}
+	}
+	return h.Status
+}
+
+// matchHost returns true if host matches pattern,
+// in which a "*" label matches any one label.
+func matchHost(pattern, host string) bool {
+	if pattern == host {
+		return true
+	}
+	patternLabels := strings.Split(pattern, ".")
+	hostLabels := strings.Split(host, ".")
+	if len(patternLabels) != len(hostLabels) {
+		return false
+	}
+	for i := range patternLabels {
+		if patternLabels[i] != "*" && patternLabels[i] != hostLabels[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// validHost returns true if host, without port, is
+// a syntactically valid hostname or IP address.
+func validHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	if net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return true
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, ch := range label {
+			switch {
+			case ch >= 'a' && ch <= 'z', ch >= '0' && ch <= '9', ch == '-', ch == '_':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
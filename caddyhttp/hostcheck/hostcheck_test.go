@@ -0,0 +1,52 @@
+package hostcheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestHostCheck(t *testing.T) {
+	hc := HostCheck{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+		Allowed: []string{"example.com", "*.example.com", "127.0.0.1"},
+		Status:  statusMisdirectedRequest,
+	}
+
+	for i, test := range []struct {
+		host      string
+		forwarded []string
+		expected  int
+	}{
+		{"example.com", nil, http.StatusOK},
+		{"EXAMPLE.com:8080", nil, http.StatusOK},
+		{"example.com.", nil, http.StatusOK},
+		{"www.example.com", nil, http.StatusOK},
+		{"127.0.0.1:2015", nil, http.StatusOK},
+		{"a.b.example.com", nil, statusMisdirectedRequest},
+		{"evil.com", nil, statusMisdirectedRequest},
+		{"example.com.evil.com", nil, statusMisdirectedRequest},
+		{"[::1]:80", nil, statusMisdirectedRequest},
+		{"", nil, http.StatusBadRequest},
+		{"exa mple.com", nil, http.StatusBadRequest},
+		{"example..com", nil, http.StatusBadRequest},
+		{"example.com", []string{"www.example.com"}, http.StatusOK},
+		{"example.com", []string{"www.example.com, evil.com"}, statusMisdirectedRequest},
+		{"example.com", []string{"example.com", "evil.com"}, statusMisdirectedRequest},
+		{"example.com", []string{"<script>"}, http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = test.host
+		if test.forwarded != nil {
+			r.Header["X-Forwarded-Host"] = test.forwarded
+		}
+		status, _ := hc.ServeHTTP(httptest.NewRecorder(), r)
+		if status != test.expected {
+			t.Errorf("Test %d (%s, %v): Expected status %d, got %d", i, test.host, test.forwarded, test.expected, status)
+		}
+	}
+}
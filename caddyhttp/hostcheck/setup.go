@@ -0,0 +1,98 @@
+package hostcheck
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("host_check", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new HostCheck middleware instance. Syntax:
+//
+//	host_check [hosts...] {
+//	    allow  hosts...
+//	    status 400|421
+//	}
+//
+// If no hosts are given, only the host of the site's address is
+// allowed. Requests for other hosts get 421 Misdirected Request
+// by default.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+
+	hc, err := hostCheckParse(c)
+	if err != nil {
+		return err
+	}
+	if len(hc.Allowed) == 0 {
+		if cfg.Addr.Host == "" {
+			return c.Err("host_check: site has no hostname; list the allowed hosts")
+		}
+		hc.Allowed = []string{strings.ToLower(cfg.Addr.Host)}
+	}
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		hc.Next = next
+		return hc
+	})
+
+	return nil
+}
+
+func hostCheckParse(c *caddy.Controller) (HostCheck, error) {
+	hc := HostCheck{Status: statusMisdirectedRequest}
+
+	var seen bool
+	for c.Next() {
+		if seen {
+			return hc, c.Err("host_check: can only be specified once per site")
+		}
+		seen = true
+
+		hc.Allowed = append(hc.Allowed, lowerAll(c.RemainingArgs())...)
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "allow":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return hc, c.ArgErr()
+				}
+				hc.Allowed = append(hc.Allowed, lowerAll(args)...)
+			case "status":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return hc, c.ArgErr()
+				}
+				status, err := strconv.Atoi(args[0])
+				if err != nil || (status != http.StatusBadRequest && status != statusMisdirectedRequest) {
+					return hc, c.Errf("host_check: status must be 400 or 421, not '%s'", args[0])
+				}
+				hc.Status = status
+			default:
+				return hc, c.Errf("host_check: unknown property '%s'", c.Val())
+			}
+		}
+	}
+
+	return hc, nil
+}
+
+func lowerAll(hosts []string) []string {
+	for i := range hosts {
+		hosts[i] = strings.TrimSuffix(strings.ToLower(hosts[i]), ".")
+	}
+	return hosts
+}
+
+// statusMisdirectedRequest is 421 Misdirected Request (RFC 7540).
+const statusMisdirectedRequest = 421
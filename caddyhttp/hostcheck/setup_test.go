@@ -0,0 +1,83 @@
+package hostcheck
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `host_check`)
+	cfg := httpserver.GetConfig(c)
+	cfg.Addr.Host = "Example.com"
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := cfg.Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	hc, ok := mids[0](httpserver.EmptyNext).(HostCheck)
+	if !ok {
+		t.Fatalf("Expected handler to be type HostCheck, got: %#v", mids[0](httpserver.EmptyNext))
+	}
+	if !reflect.DeepEqual(hc.Allowed, []string{"example.com"}) {
+		t.Errorf("Expected site's host to be allowed, got %v", hc.Allowed)
+	}
+
+	c = caddy.NewTestController("http", `host_check`)
+	if err := setup(c); err == nil {
+		t.Error("Expected error for site without hostname, got none")
+	}
+}
+
+func TestHostCheckParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		allowed   []string
+		status    int
+	}{
+		{`host_check example.com *.Example.com.`, false, []string{"example.com", "*.example.com"}, 421},
+		{`host_check example.com {
+			allow www.example.com api.example.com
+			status 400
+		}`, false, []string{"example.com", "www.example.com", "api.example.com"}, 400},
+		{`host_check {
+			allow example.com
+		}`, false, []string{"example.com"}, 421},
+		{`host_check {
+			allow
+		}`, true, nil, 0},
+		{`host_check {
+			status 404
+		}`, true, nil, 0},
+		{`host_check {
+			status
+		}`, true, nil, 0},
+		{`host_check {
+			deny evil.com
+		}`, true, nil, 0},
+		{"host_check a.com\nhost_check b.com", true, nil, 0},
+	} {
+		hc, err := hostCheckParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(hc.Allowed, test.allowed) {
+			t.Errorf("Test %d: Expected allowed %v, got %v", i, test.allowed, hc.Allowed)
+		}
+		if hc.Status != test.status {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.status, hc.Status)
+		}
+	}
+}
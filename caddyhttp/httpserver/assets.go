@@ -0,0 +1,117 @@
+package httpserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+// AssetHashLength is the number of hex digits of the
+// content hash in the URLs of hashed assets.
+const AssetHashLength = 8
+
+// AssetHash returns the hash of the contents of the file
+// name in root, as used in the URLs of hashed assets. The
+// hashes of files in directories, or overlays of them,
+// are kept until the files change.
+func AssetHash(root http.FileSystem, name string) (string, error) {
+	name = path.Clean("/" + name)
+	f, err := root.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if fi.IsDir() {
+		return "", fmt.Errorf("%s is a directory", name)
+	}
+
+	var key string
+	switch root.(type) {
+	case http.Dir, staticfiles.Overlay:
+		key = fmt.Sprint(root) + "\x00" + name
+		assetHashesMu.Lock()
+		cached, ok := assetHashes[key]
+		assetHashesMu.Unlock()
+		if ok && cached.modTime.Equal(fi.ModTime()) && cached.size == fi.Size() {
+			return cached.hash, nil
+		}
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))[:AssetHashLength]
+	if key != "" {
+		assetHashesMu.Lock()
+		assetHashes[key] = assetHash{hash: hash, modTime: fi.ModTime(), size: fi.Size()}
+		assetHashesMu.Unlock()
+	}
+	return hash, nil
+}
+
+// HashedAssetPath returns the URL path of the file at
+// name with hash, which goes before its extension:
+// /assets/app.js becomes /assets/app.3f9ab2c1.js.
+func HashedAssetPath(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// SplitHashedAssetPath returns the path of the file and
+// the hash in the URL path of a hashed asset, and whether
+// p is such a path.
+func SplitHashedAssetPath(p string) (name, hash string, ok bool) {
+	ext := path.Ext(p)
+	base := strings.TrimSuffix(p, ext)
+	dot := strings.LastIndex(base, ".")
+	if dot < 0 || dot < strings.LastIndex(base, "/") {
+		// the file may have no extension
+		if isAssetHash(strings.TrimPrefix(ext, ".")) && !strings.HasSuffix(base, "/") {
+			return base, ext[1:], true
+		}
+		return "", "", false
+	}
+	hash = base[dot+1:]
+	if !isAssetHash(hash) {
+		return "", "", false
+	}
+	return base[:dot] + ext, hash, true
+}
+
+// isAssetHash returns whether s looks like an asset hash.
+func isAssetHash(s string) bool {
+	return len(s) == AssetHashLength && strings.Trim(s, "0123456789abcdef") == ""
+}
+
+// assetHash is the hash of a file when it had modTime and size.
+type assetHash struct {
+	hash    string
+	modTime time.Time
+	size    int64
+}
+
+var (
+	assetHashes   = make(map[string]assetHash)
+	assetHashesMu sync.Mutex
+)
+
+func init() {
+	RegisterCache("asset hashes", func() {
+		assetHashesMu.Lock()
+		assetHashes = make(map[string]assetHash)
+		assetHashesMu.Unlock()
+	})
+}
@@ -0,0 +1,33 @@
+package httpserver
+
+import "testing"
+
+func TestHashedAssetPath(t *testing.T) {
+	for i, test := range []struct {
+		name, hash, hashed string
+	}{
+		{"/assets/app.js", "3f9ab2c1", "/assets/app.3f9ab2c1.js"},
+		{"/assets/app.min.css", "3f9ab2c1", "/assets/app.min.3f9ab2c1.css"},
+		{"/assets/LICENSE", "3f9ab2c1", "/assets/LICENSE.3f9ab2c1"},
+	} {
+		if got := HashedAssetPath(test.name, test.hash); got != test.hashed {
+			t.Errorf("Test %d: Expected %s, got %s", i, test.hashed, got)
+		}
+		name, hash, ok := SplitHashedAssetPath(test.hashed)
+		if !ok || name != test.name || hash != test.hash {
+			t.Errorf("Test %d: Expected %s and %s, got %s and %s (%v)", i, test.name, test.hash, name, hash, ok)
+		}
+	}
+
+	for i, p := range []string{
+		"/assets/app.js",
+		"/assets/app.3F9AB2C1.js",
+		"/assets/app.3f9ab2.js",
+		"/assets.3f9ab2c1/app",
+		"/assets/.3f9ab2c1",
+	} {
+		if name, _, ok := SplitHashedAssetPath(p); ok {
+			t.Errorf("Test %d: Expected %s not to be hashed, got %s", i, p, name)
+		}
+	}
+}
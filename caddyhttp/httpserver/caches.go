@@ -0,0 +1,27 @@
+package httpserver
+
+import "sync"
+
+// RegisterCache registers purge as the function that empties
+// the cache with the given name, replacing the function of a
+// cache with the same name, like one of a site before it was
+// reloaded.
+func RegisterCache(name string, purge func()) {
+	cachesMu.Lock()
+	caches[name] = purge
+	cachesMu.Unlock()
+}
+
+// PurgeCaches empties the registered caches.
+func PurgeCaches() {
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+	for _, purge := range caches {
+		purge()
+	}
+}
+
+var (
+	caches   = make(map[string]func())
+	cachesMu sync.Mutex
+)
@@ -10,7 +10,9 @@ import (
 )
 
 // SetupIfMatcher parses `if` or `if_op` in the current dispenser block.
-// It returns a RequestMatcher and an error if any.
+// It returns a RequestMatcher and an error if any. An `if` is a
+// condition like `if a operator b`, a named matcher like `if @name`,
+// or an expression (see Expr).
 func SetupIfMatcher(controller *caddy.Controller) (RequestMatcher, error) {
 	var c = controller.Dispenser // copy the dispenser
 	var matcher IfMatcher
@@ -18,14 +20,32 @@ func SetupIfMatcher(controller *caddy.Controller) (RequestMatcher, error) {
 		switch c.Val() {
 		case "if":
 			args1 := c.RemainingArgs()
-			if len(args1) != 3 {
+			if len(args1) == 0 {
 				return matcher, c.ArgErr()
 			}
-			ifc, err := newIfCond(args1[0], args1[1], args1[2])
+			if len(args1) == 3 {
+				if _, ok := ifConditions[args1[1]]; ok {
+					ifc, err := newIfCond(args1[0], args1[1], args1[2])
+					if err != nil {
+						return matcher, err
+					}
+					matcher.ifs = append(matcher.ifs, ifc)
+					continue
+				}
+			}
+			if len(args1) == 1 && IsMatcherRef(args1[0]) {
+				named, err := MatcherRef(controller, args1[0])
+				if err != nil {
+					return matcher, err
+				}
+				matcher.matchers = append(matcher.matchers, named)
+				continue
+			}
+			expr, err := ParseExprArgs(args1)
 			if err != nil {
-				return matcher, err
+				return matcher, c.Err(err.Error())
 			}
-			matcher.ifs = append(matcher.ifs, ifc)
+			matcher.matchers = append(matcher.matchers, expr)
 		case "if_op":
 			if !c.NextArg() {
 				return matcher, c.ArgErr()
@@ -161,8 +181,9 @@ func (i ifCond) True(r *http.Request) bool {
 
 // IfMatcher is a RequestMatcher for 'if' conditions.
 type IfMatcher struct {
-	ifs  []ifCond // list of If
-	isOr bool     // if true, conditions are 'or' instead of 'and'
+	ifs      []ifCond         // list of If
+	matchers []RequestMatcher // list of If expressions and named matchers
+	isOr     bool             // if true, conditions are 'or' instead of 'and'
 }
 
 // Match satisfies RequestMatcher interface.
@@ -181,6 +202,11 @@ func (m IfMatcher) And(r *http.Request) bool {
 			return false
 		}
 	}
+	for _, e := range m.matchers {
+		if !e.Match(r) {
+			return false
+		}
+	}
 	return true
 }
 
@@ -191,9 +217,31 @@ func (m IfMatcher) Or(r *http.Request) bool {
 			return true
 		}
 	}
+	for _, e := range m.matchers {
+		if e.Match(r) {
+			return true
+		}
+	}
 	return false
 }
 
+// ParseExprArgs parses the expression made of the arguments of a
+// directive. Arguments that were quoted to contain spaces become
+// string literals again.
+func ParseExprArgs(args []string) (*Expr, error) {
+	if len(args) == 1 {
+		return ParseExpr(args[0])
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if strings.ContainsAny(arg, " \t") {
+			arg = "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(arg) + "'"
+		}
+		quoted[i] = arg
+	}
+	return ParseExpr(strings.Join(quoted, " "))
+}
+
 // IfMatcherKeyword checks if the next value in the dispenser is a keyword for 'if' config block.
 // If true, remaining arguments in the dispinser are cleard to keep the dispenser valid for use.
 func IfMatcherKeyword(c *caddy.Controller) bool {
@@ -0,0 +1,61 @@
+package httpserver
+
+import (
+	"net"
+	"net/http"
+)
+
+// identifyingListener wraps accepted connections so that they can
+// be told apart, even if their remote addresses are the same, as
+// with Unix sockets, or meaningless.
+type identifyingListener struct {
+	net.Listener
+}
+
+// Accept accepts the next connection.
+func (ln identifyingListener) Accept() (net.Conn, error) {
+	c, err := ln.Listener.Accept()
+	if err != nil {
+		return c, err
+	}
+	return &identifiedConn{Conn: c}, nil
+}
+
+// identifiedConn is a connection accepted by a server. State kept
+// per connection is keyed by it, whatever other connections wrap
+// it. Its local address refers back to it; net/http adds the local
+// address to the context of requests, and connections that wrap
+// it, such as those of TLS, return it, too.
+type identifiedConn struct {
+	net.Conn
+}
+
+// LocalAddr returns the local address of the connection.
+func (c *identifiedConn) LocalAddr() net.Addr {
+	return connAddr{Addr: c.Conn.LocalAddr(), conn: c}
+}
+
+// connAddr is the local address of an identifiedConn.
+type connAddr struct {
+	net.Addr
+	conn *identifiedConn
+}
+
+// baseConn returns the connection accepted by the server
+// which c is or wraps, or nil if there is none.
+func baseConn(c net.Conn) net.Conn {
+	if addr, ok := c.LocalAddr().(connAddr); ok {
+		return addr.conn
+	}
+	return nil
+}
+
+// requestConn returns the connection accepted by the server
+// on which r was received, or nil if there is none, as with
+// QUIC.
+func requestConn(r *http.Request) net.Conn {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(connAddr); ok {
+		return addr.conn
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package httpserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ConnLimits limits the number of connections to a site.
+// Zero values mean no limit. A connection counts against the
+// limits of a site from its first request to the site until it
+// is closed, so idle keep-alive connections count too.
+type ConnLimits struct {
+	// Max number of open connections to the site
+	Total int
+
+	// Max number of open connections to the site
+	// from the same client IP
+	PerIP int
+
+	// Max number of connections accepted by the whole
+	// process, across all sites and listeners
+	Global int
+
+	// How long a connection over the limit waits for a
+	// slot; if zero, it is refused immediately
+	QueueTimeout time.Duration
+}
+
+// connLimiter limits the number of connections, in total
+// and per client IP. Connections are identified by a key,
+// usually the connection itself, and may be acquired more
+// than once, as happens with concurrent HTTP/2 streams.
+type connLimiter struct {
+	max, perIP int
+
+	mu      sync.Mutex
+	conns   map[interface{}]*connHolds // by connection key
+	ips     map[string]int             // client IP -> number of connections
+	changed chan struct{}              // closed and replaced on every release
+}
+
+// connHolds are the holds of a connection on its slot.
+type connHolds struct {
+	ip string // the client IP of the connection
+	n  int
+}
+
+func newConnLimiter(max, perIP int) *connLimiter {
+	return &connLimiter{
+		max:     max,
+		perIP:   perIP,
+		conns:   make(map[interface{}]*connHolds),
+		ips:     make(map[string]int),
+		changed: make(chan struct{}),
+	}
+}
+
+// acquire holds a slot for the connection identified by key, whose
+// remote address is addr, waiting up to timeout for one to become
+// available. It returns false if no slot became available in time.
+func (l *connLimiter) acquire(key interface{}, addr string, timeout time.Duration) bool {
+	ip := clientIP(addr)
+	var expired <-chan time.Time
+	for {
+		l.mu.Lock()
+		if h := l.conns[key]; h != nil {
+			h.n++
+			l.mu.Unlock()
+			return true
+		}
+		if (l.max <= 0 || len(l.conns) < l.max) && (l.perIP <= 0 || l.ips[ip] < l.perIP) {
+			l.conns[key] = &connHolds{ip: ip, n: 1}
+			l.ips[ip]++
+			l.mu.Unlock()
+			return true
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		if timeout <= 0 {
+			return false
+		}
+		if expired == nil {
+			expired = time.After(timeout)
+		}
+		select {
+		case <-changed:
+		case <-expired:
+			return false
+		}
+	}
+}
+
+// release releases one hold on the slot of the
+// connection identified by key.
+func (l *connLimiter) release(key interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	h := l.conns[key]
+	if h == nil {
+		return
+	}
+	h.n--
+	if h.n == 0 {
+		delete(l.conns, key)
+		l.ips[h.ip]--
+		if l.ips[h.ip] == 0 {
+			delete(l.ips, h.ip)
+		}
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// clientIP returns the host portion of the remote address addr.
+func clientIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// siteConnTracker keeps the slots of the sites' connection
+// limiters that each connection holds, from its first request
+// to a site until it is closed. Connections are keyed as
+// returned by baseConn.
+type siteConnTracker struct {
+	sync.Mutex
+	conns    map[net.Conn]map[*connLimiter]bool // connection -> limiters held
+	hijacked map[net.Conn]map[*connLimiter]bool // held until the hijacking request returns
+}
+
+func newSiteConnTracker() *siteConnTracker {
+	return &siteConnTracker{
+		conns:    make(map[net.Conn]map[*connLimiter]bool),
+		hijacked: make(map[net.Conn]map[*connLimiter]bool),
+	}
+}
+
+// hold holds a slot of l for the connection r was received on,
+// unless it holds one already, waiting up to timeout for one to
+// become available. It returns false if none did, and otherwise
+// a function to call once the request is served. Slots of
+// connections the tracker does not know about, like those of
+// QUIC, are only held while the request is served.
+func (t *siteConnTracker) hold(r *http.Request, l *connLimiter, timeout time.Duration) (func(), bool) {
+	c := requestConn(r)
+	if c == nil {
+		if !l.acquire(r, r.RemoteAddr, timeout) {
+			return nil, false
+		}
+		return func() { l.release(r) }, true
+	}
+
+	done := func() { t.done(c) }
+	t.Lock()
+	held, tracked := t.conns[c]
+	if held[l] {
+		t.Unlock()
+		return done, true
+	}
+	t.Unlock()
+
+	if !l.acquire(c, r.RemoteAddr, timeout) {
+		return nil, false
+	}
+	if !tracked {
+		return func() { l.release(c) }, true
+	}
+	t.Lock()
+	defer t.Unlock()
+	if held, ok := t.conns[c]; ok && !held[l] {
+		held[l] = true
+		return done, true
+	}
+	// another request of the connection got the slot first,
+	// or the connection was closed meanwhile
+	return func() { l.release(c) }, true
+}
+
+// done releases the slots that the connection c held if it
+// was hijacked, which the request that hijacked it calls
+// once it returns.
+func (t *siteConnTracker) done(c net.Conn) {
+	t.Lock()
+	held := t.hijacked[c]
+	delete(t.hijacked, c)
+	t.Unlock()
+	for l := range held {
+		l.release(c)
+	}
+}
+
+// connState starts tracking new connections and releases the
+// slots of those that are closed. Hijacked connections keep
+// theirs until the request that hijacked them returns.
+func (t *siteConnTracker) connState(c net.Conn, cs http.ConnState) {
+	c = baseConn(c)
+	if c == nil {
+		return
+	}
+	t.Lock()
+	held := t.conns[c]
+	switch cs {
+	case http.StateNew:
+		t.conns[c] = make(map[*connLimiter]bool)
+		held = nil
+	case http.StateHijacked:
+		delete(t.conns, c)
+		t.hijacked[c] = held
+		held = nil
+	case http.StateClosed:
+		delete(t.conns, c)
+	default:
+		held = nil
+	}
+	t.Unlock()
+	for l := range held {
+		l.release(c)
+	}
+}
+
+var (
+	globalConnLimiter   *connLimiter
+	globalConnLimiterMu sync.Mutex
+)
+
+// getGlobalConnLimiter returns the process-wide limiter for
+// max connections. All sites of a config agree on max, which
+// MakeServers checks, so the current limiter is only replaced
+// when a restart loads a config with a different limit.
+func getGlobalConnLimiter(max int) *connLimiter {
+	globalConnLimiterMu.Lock()
+	defer globalConnLimiterMu.Unlock()
+	if globalConnLimiter == nil || globalConnLimiter.max != max {
+		globalConnLimiter = newConnLimiter(max, 0)
+	}
+	return globalConnLimiter
+}
+
+// globalConnLimits returns the global connection limit and queue
+// timeout configured for group, or an error if sites disagree.
+func globalConnLimits(group []*SiteConfig) (int, time.Duration, error) {
+	var max int
+	var timeout time.Duration
+	for _, site := range group {
+		limits := site.ConnLimits
+		if limits.Global == 0 {
+			continue
+		}
+		if max != 0 && limits.Global != max {
+			return 0, 0, fmt.Errorf("%s: conflicting global connection limits %d and %d",
+				site.Addr, max, limits.Global)
+		}
+		max, timeout = limits.Global, limits.QueueTimeout
+	}
+	return max, timeout, nil
+}
+
+// limitListener is a listener which accepts no more connections
+// than its limiter allows. Connections over the limit are closed
+// immediately or, if there is a queue timeout, wait for a slot
+// before the first byte is read from them.
+type limitListener struct {
+	net.Listener
+	limiter   *connLimiter
+	timeout   time.Duration
+	plaintext bool // whether refused connections can be sent a 503
+}
+
+// Accept accepts the next connection that is within the limit.
+func (ln limitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := ln.Listener.Accept()
+		if err != nil {
+			return c, err
+		}
+		lc := &limitedConn{Conn: c, limiter: ln.limiter}
+		if ln.limiter.acquire(lc, c.RemoteAddr().String(), 0) {
+			lc.admitted = true
+			return lc, nil
+		}
+		if ln.timeout > 0 {
+			lc.timeout = ln.timeout
+			return lc, nil
+		}
+		if ln.plaintext {
+			c.SetWriteDeadline(time.Now().Add(time.Second))
+			c.Write(connLimitResponse)
+		}
+		c.Close()
+	}
+}
+
+// limitedConn is a connection that holds a slot of a
+// limiter, which it releases when it is closed.
+type limitedConn struct {
+	net.Conn
+	limiter  *connLimiter
+	timeout  time.Duration
+	mu       sync.Mutex
+	admitted bool
+	closed   bool
+}
+
+// Read reads from the connection once it has a slot.
+func (c *limitedConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	admitted := c.admitted
+	c.mu.Unlock()
+	if !admitted {
+		if !c.limiter.acquire(c, c.RemoteAddr().String(), c.timeout) {
+			return 0, errConnLimit
+		}
+		c.mu.Lock()
+		c.admitted = true
+		if c.closed {
+			c.limiter.release(c)
+		}
+		c.mu.Unlock()
+	}
+	return c.Conn.Read(p)
+}
+
+// Close closes the connection and releases its slot.
+func (c *limitedConn) Close() error {
+	c.mu.Lock()
+	if c.admitted && !c.closed {
+		c.limiter.release(c)
+	}
+	c.closed = true
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+// connLimitResponse is written to plaintext connections
+// that are refused because of the connection limit.
+var connLimitResponse = []byte("HTTP/1.1 503 Service Unavailable\r\nConnection: close\r\nContent-Length: 0\r\n\r\n")
+
+// errConnLimit is returned when reading from a connection
+// which did not get a slot before its queue timeout.
+var errConnLimit = fmt.Errorf("connection limit reached")
@@ -0,0 +1,193 @@
+package httpserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddytls"
+)
+
+func TestConnLimiter(t *testing.T) {
+	l := newConnLimiter(2, 1)
+
+	if !l.acquire("c1", "10.0.0.1:1000", 0) {
+		t.Fatal("Expected first connection to be admitted")
+	}
+	if !l.acquire("c1", "10.0.0.1:1000", 0) {
+		t.Error("Expected same connection to be admitted again")
+	}
+	if l.acquire("c2", "10.0.0.1:1001", 0) {
+		t.Error("Expected second connection from same IP to be refused")
+	}
+	if !l.acquire("c3", "10.0.0.2:1000", 0) {
+		t.Error("Expected connection from other IP to be admitted")
+	}
+	if l.acquire("c4", "10.0.0.3:1000", 0) {
+		t.Error("Expected connection over total limit to be refused")
+	}
+
+	// a queued connection gets the slot once it's released
+	admitted := make(chan bool)
+	go func() { admitted <- l.acquire("c4", "10.0.0.3:1000", time.Second) }()
+	l.release("c3")
+	if !<-admitted {
+		t.Error("Expected queued connection to be admitted after release")
+	}
+
+	// the first connection was acquired twice
+	l.release("c1")
+	if l.acquire("c2", "10.0.0.1:1001", 0) {
+		t.Error("Expected connection to be held until all holds are released")
+	}
+	l.release("c1")
+	if !l.acquire("c2", "10.0.0.1:1001", 0) {
+		t.Error("Expected connection from same IP to be admitted after release")
+	}
+
+	if l.acquire("c5", "10.0.0.4:1000", 10*time.Millisecond) {
+		t.Error("Expected queued connection to time out")
+	}
+
+	// connections are told apart even if their addresses are the same
+	l = newConnLimiter(0, 1)
+	if !l.acquire("c1", "@", 0) {
+		t.Fatal("Expected first Unix socket connection to be admitted")
+	}
+	if l.acquire("c2", "@", 0) {
+		t.Error("Expected second Unix socket connection to count against the limit")
+	}
+}
+
+func TestGlobalConnLimits(t *testing.T) {
+	group := []*SiteConfig{
+		{ConnLimits: ConnLimits{Global: 10, QueueTimeout: time.Second}},
+		{},
+	}
+	max, timeout, err := globalConnLimits(group)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if max != 10 || timeout != time.Second {
+		t.Errorf("Expected limit 10 and timeout 1s, got %d and %v", max, timeout)
+	}
+
+	group = append(group, &SiteConfig{ConnLimits: ConnLimits{Global: 20}})
+	if _, _, err := globalConnLimits(group); err == nil {
+		t.Error("Expected error for conflicting global limits, got none")
+	}
+}
+
+func TestSiteConnTracker(t *testing.T) {
+	l := newConnLimiter(1, 0)
+	tracker := newSiteConnTracker()
+	c1 := &identifiedConn{Conn: addrConn{addr: "10.0.0.1:1000"}}
+	c2 := &identifiedConn{Conn: addrConn{addr: "10.0.0.2:1000"}}
+
+	tracker.connState(c1, http.StateNew)
+	done, ok := tracker.hold(connRequest(c1), l, 0)
+	if !ok {
+		t.Fatal("Expected first connection to get a slot")
+	}
+	done()
+	if _, ok := tracker.hold(connRequest(c1), l, 0); !ok {
+		t.Error("Expected next request of the connection to keep its slot")
+	}
+
+	// the slot is held while the connection is idle
+	tracker.connState(c2, http.StateNew)
+	if _, ok := tracker.hold(connRequest(c2), l, 0); ok {
+		t.Error("Expected second connection to be refused while the first is open")
+	}
+	tracker.connState(c1, http.StateClosed)
+	done, ok = tracker.hold(connRequest(c2), l, 0)
+	if !ok {
+		t.Fatal("Expected second connection to get the slot once the first is closed")
+	}
+
+	// a hijacked connection holds its slot until its request returns
+	untracked := func() *http.Request {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "10.0.0.3:1000"
+		return r
+	}
+	tracker.connState(c2, http.StateHijacked)
+	if _, ok := tracker.hold(untracked(), l, 0); ok {
+		t.Error("Expected request to be refused while the hijacking request runs")
+	}
+	done()
+	done, ok = tracker.hold(untracked(), l, 0)
+	if !ok {
+		t.Fatal("Expected request to get the slot once the hijacking request returned")
+	}
+
+	// connections that are not tracked only hold it during requests
+	done()
+	if _, ok := tracker.hold(untracked(), l, 0); !ok {
+		t.Error("Expected slot of untracked connection to be released after its request")
+	}
+}
+
+func TestSiteConnTrackerSameAddress(t *testing.T) {
+	l := newConnLimiter(1, 0)
+	tracker := newSiteConnTracker()
+
+	// connections over Unix sockets have the same remote address
+	c1 := &identifiedConn{Conn: addrConn{addr: "@"}}
+	c2 := &identifiedConn{Conn: addrConn{addr: "@"}}
+	tracker.connState(c1, http.StateNew)
+	tracker.connState(c2, http.StateNew)
+	if _, ok := tracker.hold(connRequest(c1), l, 0); !ok {
+		t.Fatal("Expected first connection to get a slot")
+	}
+	if _, ok := tracker.hold(connRequest(c2), l, 0); ok {
+		t.Error("Expected second connection with the same address to be refused")
+	}
+	tracker.connState(c2, http.StateClosed)
+	if _, ok := tracker.hold(connRequest(c2), l, 0); ok {
+		t.Error("Expected closing the second connection to leave the slot of the first held")
+	}
+	tracker.connState(c1, http.StateClosed)
+	c3 := &identifiedConn{Conn: addrConn{addr: "@"}}
+	tracker.connState(c3, http.StateNew)
+	if _, ok := tracker.hold(connRequest(c3), l, 0); !ok {
+		t.Error("Expected slot to be free once the first connection closed")
+	}
+}
+
+// addrConn is a connection that only has addresses.
+type addrConn struct {
+	net.Conn
+	addr string
+}
+
+func (c addrConn) RemoteAddr() net.Addr {
+	if addr, err := net.ResolveTCPAddr("tcp", c.addr); err == nil {
+		return addr
+	}
+	return &net.UnixAddr{Name: c.addr, Net: "unix"}
+}
+
+func (c addrConn) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 80}
+}
+
+// connRequest returns a request received on the connection c,
+// as net/http would make it.
+func connRequest(c net.Conn) *http.Request {
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.RemoteAddr = c.RemoteAddr().String()
+	return r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, c.LocalAddr()))
+}
+
+func TestMakeServersConflictingGlobalConnLimits(t *testing.T) {
+	h := &httpContext{siteConfigs: []*SiteConfig{
+		{Addr: Address{Host: "a.com", Port: "8080"}, ListenHost: "127.0.0.1", TLS: new(caddytls.Config), ConnLimits: ConnLimits{Global: 10}},
+		{Addr: Address{Host: "b.com", Port: "8081"}, ListenHost: "127.0.0.1", TLS: new(caddytls.Config), ConnLimits: ConnLimits{Global: 20}},
+	}}
+	if _, err := h.MakeServers(); err == nil {
+		t.Error("Expected error for global limits that servers disagree on, got none")
+	}
+}
@@ -289,6 +289,18 @@ func (c Context) Map(values ...interface{}) (map[string]interface{}, error) {
 	return dict, nil
 }
 
+// Asset returns the URL path of the file at name relative
+// to the root with the hash of its contents in it, which the
+// assets directive serves with far-future caching; so the URL
+// changes whenever the file does.
+func (c Context) Asset(name string) (string, error) {
+	hash, err := AssetHash(c.Root, name)
+	if err != nil {
+		return "", err
+	}
+	return HashedAssetPath(path.Clean("/"+name), hash), nil
+}
+
 // Files reads and returns a slice of names from the given directory
 // relative to the root of Context c.
 func (c Context) Files(name string) ([]string, error) {
@@ -0,0 +1,85 @@
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// DefaultServer says how a server handles requests whose Host
+// matches none of its sites.
+type DefaultServer struct {
+	// Mode is one of the DefaultServer* constants.
+	Mode string
+
+	// Status is the status code written in DefaultServerStatus mode.
+	Status int
+
+	// RedirectTo is where clients are redirected in
+	// DefaultServerRedirect mode; it may contain placeholders.
+	RedirectTo string
+}
+
+// The modes of a DefaultServer.
+const (
+	// DefaultServerSite serves such requests with the site
+	// that configured the default server.
+	DefaultServerSite = "site"
+
+	// DefaultServerClose closes the connection without a response.
+	DefaultServerClose = "close"
+
+	// DefaultServerStatus responds with a status code.
+	DefaultServerStatus = "status"
+
+	// DefaultServerRedirect redirects the client.
+	DefaultServerRedirect = "redirect"
+)
+
+// defaultServer returns the site and default server configured by
+// the sites in group, if any. Only one site per listener may be the
+// default site, and the others may not disagree about the mode.
+func defaultServer(group []*SiteConfig) (*SiteConfig, *DefaultServer, error) {
+	var site *SiteConfig
+	var ds *DefaultServer
+	for _, s := range group {
+		if s.DefaultServer == nil {
+			continue
+		}
+		if ds != nil && (*ds != *s.DefaultServer || ds.Mode == DefaultServerSite) {
+			return nil, nil, fmt.Errorf("%s and %s: conflicting default_server on the same listener", site.Addr, s.Addr)
+		}
+		site, ds = s, s.DefaultServer
+	}
+	return site, ds, nil
+}
+
+// serveNoSite handles r, a request for which there is no site, as
+// configured by the server's default server. It returns the site that should serve r instead,
+// if any, or else whether r was handled.
+func (s *Server) serveNoSite(w http.ResponseWriter, r *http.Request) (*SiteConfig, bool) {
+	switch s.defaultServer.Mode {
+	case DefaultServerSite:
+		s.sitesMu.RLock()
+		defer s.sitesMu.RUnlock()
+		return s.defaultSite, false
+	case DefaultServerClose:
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return nil, true
+			}
+		}
+		// can't close the connection (HTTP/2); refuse just this request
+		w.Header().Set("Connection", "close")
+		w.WriteHeader(421) // Misdirected Request
+		return nil, true
+	case DefaultServerStatus:
+		WriteTextResponse(w, s.defaultServer.Status, http.StatusText(s.defaultServer.Status))
+		return nil, true
+	case DefaultServerRedirect:
+		to := NewReplacer(r, nil, "").Replace(s.defaultServer.RedirectTo)
+		http.Redirect(w, r, to, http.StatusFound)
+		return nil, true
+	}
+	return nil, false
+}
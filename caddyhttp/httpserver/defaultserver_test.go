@@ -0,0 +1,82 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDefaultServer(t *testing.T) {
+	newSite := func(host string, ds *DefaultServer) *SiteConfig {
+		return &SiteConfig{
+			Addr:          Address{Original: host, Host: host},
+			DefaultServer: ds,
+			middleware: []Middleware{func(Handler) Handler {
+				return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+					w.Write([]byte(host))
+					return 0, nil
+				})
+			}},
+		}
+	}
+
+	for i, test := range []struct {
+		ds           *DefaultServer
+		expectStatus int
+		expectBody   string
+		expectHeader string
+	}{
+		{nil, http.StatusNotFound, "No such site at :80", ""},
+		{&DefaultServer{Mode: DefaultServerSite}, http.StatusOK, "b.example.com", ""},
+		{&DefaultServer{Mode: DefaultServerStatus, Status: 410}, 410, "Gone", ""},
+		{&DefaultServer{Mode: DefaultServerRedirect, RedirectTo: "https://a.example.com{uri}"}, http.StatusFound, "", "https://a.example.com/foo?x=1"},
+		{&DefaultServer{Mode: DefaultServerClose}, 421, "", ""},
+	} {
+		s, err := NewServer(":80", []*SiteConfig{
+			newSite("a.example.com", nil),
+			newSite("b.example.com", test.ds),
+		})
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error creating server, got: %v", i, err)
+		}
+
+		// requests for a site are not affected
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "http://a.example.com/foo", nil))
+		if got := w.Body.String(); got != "a.example.com" {
+			t.Errorf("Test %d: Expected request for site to be served by it, got: %s", i, got)
+		}
+
+		w = httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "http://unknown.example.com/foo?x=1", nil))
+		if w.Code != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, w.Code)
+		}
+		if test.expectBody != "" && w.Body.String() != test.expectBody {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.expectBody, w.Body.String())
+		}
+		if got := w.Header().Get("Location"); got != test.expectHeader {
+			t.Errorf("Test %d: Expected Location '%s', got '%s'", i, test.expectHeader, got)
+		}
+	}
+}
+
+func TestDefaultServerConflict(t *testing.T) {
+	for i, test := range []struct {
+		a, b      *DefaultServer
+		shouldErr bool
+	}{
+		{&DefaultServer{Mode: DefaultServerClose}, &DefaultServer{Mode: DefaultServerClose}, false},
+		{&DefaultServer{Mode: DefaultServerClose}, nil, false},
+		{&DefaultServer{Mode: DefaultServerClose}, &DefaultServer{Mode: DefaultServerStatus, Status: 404}, true},
+		{&DefaultServer{Mode: DefaultServerSite}, &DefaultServer{Mode: DefaultServerSite}, true},
+	} {
+		_, _, err := defaultServer([]*SiteConfig{
+			{Addr: Address{Host: "a"}, DefaultServer: test.a},
+			{Addr: Address{Host: "b"}, DefaultServer: test.b},
+		})
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: Expected error %v, got: %v", i, test.shouldErr, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package httpserver
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+// IsDynamicRoot returns whether root has placeholders,
+// which are replaced with the values of each request.
+func IsDynamicRoot(root string) bool {
+	return strings.Contains(root, "{")
+}
+
+// ResolveRoot returns root with its placeholders replaced
+// with their values for r, and whether every value can
+// safely be part of a path: it must be a single path
+// element that is not empty, hidden, . or .., so that
+// clients can't choose a directory outside of those
+// the root is meant to be.
+func ResolveRoot(root string, r *http.Request) (string, bool) {
+	if !IsDynamicRoot(root) {
+		return root, true
+	}
+	repl := NewReplacer(r, nil, "")
+	var resolved bytes.Buffer
+	for {
+		start := strings.Index(root, "{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(root[start:], "}")
+		if end < 0 {
+			break
+		}
+		end += start
+		value := repl.Replace(root[start : end+1])
+		if value == "" || value[0] == '.' || strings.ContainsAny(value, "/\\\x00") {
+			return "", false
+		}
+		resolved.WriteString(root[:start])
+		resolved.WriteString(value)
+		root = root[end+1:]
+	}
+	resolved.WriteString(root)
+	return resolved.String(), true
+}
+
+// CheckStaticRoot returns an error if the root of the site of c,
+// or one of its fallback roots, has placeholders. Only the static
+// file server resolves them for each request; directives that use
+// the root as it is configured must call it when they do.
+func CheckStaticRoot(c *caddy.Controller) error {
+	cfg := GetConfig(c)
+	for _, root := range append([]string{cfg.Root}, cfg.FallbackRoots...) {
+		if IsDynamicRoot(root) {
+			return c.Errf("%s: can't be used with root '%s', which has placeholders", c.Directive(), root)
+		}
+	}
+	return nil
+}
+
+// hasDynamicFallback returns whether any of the
+// site's fallback roots has placeholders.
+func (s *SiteConfig) hasDynamicFallback() bool {
+	for _, root := range s.FallbackRoots {
+		if IsDynamicRoot(root) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestFileSystem returns the file system of the site's
+// files for r, whose roots may have placeholders, and
+// whether the roots could be resolved for r.
+func (s *SiteConfig) requestFileSystem(r *http.Request) (http.FileSystem, bool) {
+	root, ok := ResolveRoot(s.Root, r)
+	if !ok {
+		return nil, false
+	}
+	if len(s.FallbackRoots) == 0 {
+		return http.Dir(root), true
+	}
+	overlay := staticfiles.Overlay{http.Dir(root)}
+	for _, fallback := range s.FallbackRoots {
+		if fallback, ok = ResolveRoot(fallback, r); !ok {
+			return nil, false
+		}
+		overlay = append(overlay, http.Dir(fallback))
+	}
+	return overlay, true
+}
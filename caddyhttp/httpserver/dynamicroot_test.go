@@ -0,0 +1,99 @@
+package httpserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy"
+)
+
+func TestResolveRoot(t *testing.T) {
+	for i, test := range []struct {
+		root, host string
+		expect     string
+		ok         bool
+	}{
+		{"/srv/site", "a.example.com", "/srv/site", true},
+		{"/srv/{label1}", "Acme.example.com:8080", "/srv/acme", true},
+		{"/srv/{label2}/{label1}/www", "acme.example.com", "/srv/example/acme/www", true},
+		{"/srv/{label4}", "acme.example.com", "", false},
+		{"/srv/{label1}", "..", "", false},
+		{"/srv/{label1}", ".hidden.example.com", "", false},
+		{"/srv/{label1}", "a\\..\\b.example.com", "", false},
+		{"/srv/{host}", "a/../../etc", "", false},
+		{"/srv/{unknown}", "acme.example.com", "", false},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = test.host
+		got, ok := ResolveRoot(test.root, r)
+		if ok != test.ok || got != test.expect {
+			t.Errorf("Test %d: Expected '%s' %v, got '%s' %v", i, test.expect, test.ok, got, ok)
+		}
+	}
+}
+
+func TestServeDynamicRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_dynamicroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"acme", "initech"} {
+		os.Mkdir(filepath.Join(dir, name), 0755)
+		ioutil.WriteFile(filepath.Join(dir, name, "index.txt"), []byte(name), 0644)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644)
+
+	s, err := NewServer(":80", []*SiteConfig{{
+		Addr: Address{Original: "*.example.com", Host: "*.example.com"},
+		Root: filepath.Join(dir, "{label1}"),
+	}})
+	if err != nil {
+		t.Fatalf("Expected no error creating server, got: %v", err)
+	}
+
+	for i, test := range []struct {
+		host, path   string
+		expectStatus int
+		expectBody   string
+	}{
+		{"acme.example.com", "/index.txt", http.StatusOK, "acme"},
+		{"initech.example.com", "/index.txt", http.StatusOK, "initech"},
+		{"initech.example.com", "/../secret.txt", http.StatusNotFound, ""},
+		{"globex.example.com", "/index.txt", http.StatusNotFound, ""},
+	} {
+		r := httptest.NewRequest("GET", "http://"+test.host+test.path, nil)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, w.Code)
+		}
+		if test.expectBody != "" && w.Body.String() != test.expectBody {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.expectBody, w.Body.String())
+		}
+	}
+}
+
+func TestCheckStaticRoot(t *testing.T) {
+	for i, test := range []struct {
+		root      string
+		fallbacks []string
+		shouldErr bool
+	}{
+		{"/srv/site", nil, false},
+		{"/srv/site", []string{"/srv/base"}, false},
+		{"/srv/{label1}", nil, true},
+		{"/srv/site", []string{"/srv/{label2}"}, true},
+	} {
+		c := caddy.NewTestController("http", "")
+		cfg := GetConfig(c)
+		cfg.Root, cfg.FallbackRoots = test.root, test.fallbacks
+		if err := CheckStaticRoot(c); (err != nil) != test.shouldErr {
+			t.Errorf("Test %d: Expected error to be %v, got: %v", i, test.shouldErr, err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+)
+
+// earlyHintsCtxKey is the context key of the function
+// that sends 103 Early Hints responses to a request.
+const earlyHintsCtxKey ctxKey = "early_hints"
+
+// WithEarlyHints returns a copy of r to which handlers may send
+// 103 Early Hints responses with send, before the final response.
+// send is given the values of the Link header fields of a response,
+// and must be safe to call from other goroutines.
+func WithEarlyHints(r *http.Request, send func(links []string)) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), earlyHintsCtxKey, send))
+}
+
+// EarlyHintsAllowed returns whether 103 Early
+// Hints responses may be sent to r.
+func EarlyHintsAllowed(r *http.Request) bool {
+	_, ok := r.Context().Value(earlyHintsCtxKey).(func(links []string))
+	return ok
+}
+
+// SendEarlyHints sends links, the values of Link header fields, to
+// r in a 103 Early Hints response, if early hints may be sent to r.
+func SendEarlyHints(r *http.Request, links []string) {
+	if send, ok := r.Context().Value(earlyHintsCtxKey).(func(links []string)); ok && len(links) > 0 {
+		send(links)
+	}
+}
@@ -0,0 +1,53 @@
+package httpserver
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AcceptsEncoding returns whether the client of r accepts the
+// content coding enc by the Accept-Encoding header of r: enc,
+// or x-gzip for gzip, or else *, must be listed with a q-value
+// above 0.
+func AcceptsEncoding(r *http.Request, enc string) bool {
+	q, wildcard := -1.0, -1.0
+	for _, v := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, weight := strings.TrimSpace(v), 1.0
+		if i := strings.Index(coding, ";"); i >= 0 {
+			weight = qValue(coding[i+1:])
+			coding = strings.TrimSpace(coding[:i])
+		}
+		switch {
+		case strings.EqualFold(coding, enc) ||
+			(strings.EqualFold(enc, "gzip") && strings.EqualFold(coding, "x-gzip")):
+			if weight > q {
+				q = weight
+			}
+		case coding == "*":
+			wildcard = weight
+		}
+	}
+	if q >= 0 {
+		return q > 0
+	}
+	return wildcard > 0
+}
+
+// qValue returns the q-value in params, the parameters of an
+// element of a header like Accept-Encoding, which is 1 if they
+// have none, or 0 if it is invalid.
+func qValue(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "q") {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil || q < 0 || q > 1 {
+			return 0
+		}
+		return q
+	}
+	return 1
+}
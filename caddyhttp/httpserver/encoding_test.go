@@ -0,0 +1,39 @@
+package httpserver
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	for i, test := range []struct {
+		header   string
+		enc      string
+		expected bool
+	}{
+		{"", "gzip", false},
+		{"gzip", "gzip", true},
+		{"GZIP", "gzip", true},
+		{"deflate, gzip;q=0.5", "gzip", true},
+		{"x-gzip", "gzip", true},
+		{"x-gzip", "br", false},
+		{"gzip;q=0", "gzip", false},
+		{"gzip; q=0.000", "gzip", false},
+		{"gzip;Q = 0", "gzip", false},
+		{"gzip;q=2", "gzip", false},
+		{"gzip;q=x", "gzip", false},
+		{"gzipped", "gzip", false},
+		{"*", "br", true},
+		{"*;q=0", "br", false},
+		{"gzip;q=0, *", "gzip", false},
+		{"br, *;q=0", "gzip", false},
+		{"br, *;q=0", "br", true},
+		{"gzip;q=0, x-gzip", "gzip", true},
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", test.header)
+		if got := AcceptsEncoding(r, test.enc); got != test.expected {
+			t.Errorf("Test %d: Expected %q to accept %s: %v, got %v", i, test.header, test.enc, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a boolean expression over the placeholders of a request,
+// such as:
+//
+//	{method} == 'POST' && {>Content-Type} matches 'json'
+//
+// Operands are placeholders, which are replaced for each request,
+// and literals: strings in single or double quotes, numbers, true
+// and false. Literals are taken as they are; placeholders in them
+// are not replaced. The operators, from lowest precedence, are:
+//
+//	||                          either is true
+//	&&                          both are true
+//	!                           negation
+//	== != < <= > >=             comparison; numeric if both are numbers
+//	matches                     regular expression match
+//	contains starts_with ends_with
+//
+// An operand on its own is true unless it is empty, false or 0.
+// Parentheses group. Expr implements RequestMatcher.
+type Expr struct {
+	source string
+	root   exprNode
+}
+
+// ParseExpr parses expr, reporting malformed expressions,
+// unknown operators and invalid regular expressions.
+func ParseExpr(expr string) (*Expr, error) {
+	tokens, err := lexExpr(expr)
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %v", expr, err)
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil {
+		if tok, ok := p.peek(); ok {
+			err = fmt.Errorf("unexpected %s", tok.text)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %v", expr, err)
+	}
+	return &Expr{source: expr, root: root}, nil
+}
+
+// Match implements RequestMatcher. It returns whether e is true for r.
+func (e *Expr) Match(r *http.Request) bool {
+	return e.root.eval(&exprEnv{r: r}) == "true"
+}
+
+// String returns the source of e.
+func (e *Expr) String() string { return e.source }
+
+// exprEnv is what an expression is evaluated against.
+type exprEnv struct {
+	r    *http.Request
+	repl Replacer
+}
+
+func (env *exprEnv) replace(placeholder string) string {
+	if env.r == nil {
+		return ""
+	}
+	if env.repl == nil {
+		env.repl = NewReplacer(env.r, nil, "")
+	}
+	return env.repl.Replace(placeholder)
+}
+
+// exprNode is a node of a parsed expression. Boolean
+// nodes evaluate to "true" or "false".
+type exprNode interface {
+	eval(env *exprEnv) string
+}
+
+type (
+	exprLiteral     string
+	exprPlaceholder string
+	exprNot         struct{ x exprNode }
+	exprTruth       struct{ x exprNode }
+	exprLogic       struct {
+		and  bool
+		x, y exprNode
+	}
+	exprCompare struct {
+		op   string
+		x, y exprNode
+		re   *regexp.Regexp // for matches with a literal pattern
+	}
+)
+
+func (n exprLiteral) eval(env *exprEnv) string     { return string(n) }
+func (n exprPlaceholder) eval(env *exprEnv) string { return env.replace(string(n)) }
+func (n exprNot) eval(env *exprEnv) string         { return boolString(n.x.eval(env) != "true") }
+
+func (n exprTruth) eval(env *exprEnv) string {
+	v := n.x.eval(env)
+	return boolString(v != "" && v != "false" && v != "0")
+}
+
+func (n exprLogic) eval(env *exprEnv) string {
+	x := n.x.eval(env) == "true"
+	if x != n.and {
+		return boolString(x)
+	}
+	return n.y.eval(env)
+}
+
+func (n exprCompare) eval(env *exprEnv) string {
+	x, y := n.x.eval(env), n.y.eval(env)
+	switch n.op {
+	case "==":
+		return boolString(x == y)
+	case "!=":
+		return boolString(x != y)
+	case "contains":
+		return boolString(strings.Contains(x, y))
+	case "starts_with":
+		return boolString(strings.HasPrefix(x, y))
+	case "ends_with":
+		return boolString(strings.HasSuffix(x, y))
+	case "matches":
+		re := n.re
+		if re == nil {
+			var err error
+			if re, err = regexp.Compile(y); err != nil {
+				return "false"
+			}
+		}
+		return boolString(re.MatchString(x))
+	}
+
+	// ordering comparisons
+	cmp := strings.Compare(x, y)
+	if a, err := strconv.ParseFloat(x, 64); err == nil {
+		if b, err := strconv.ParseFloat(y, 64); err == nil {
+			switch {
+			case a < b:
+				cmp = -1
+			case a > b:
+				cmp = 1
+			default:
+				cmp = 0
+			}
+		}
+	}
+	switch n.op {
+	case "<":
+		return boolString(cmp < 0)
+	case "<=":
+		return boolString(cmp <= 0)
+	case ">":
+		return boolString(cmp > 0)
+	default:
+		return boolString(cmp >= 0)
+	}
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+// exprOperators are the binary comparison operators.
+var exprOperators = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+	"matches": true, "contains": true, "starts_with": true, "ends_with": true,
+}
+
+// exprToken is a token of an expression.
+type exprToken struct {
+	text   string
+	quoted bool // a string literal, unquoted in text
+}
+
+// lexExpr splits expr into tokens.
+func lexExpr(expr string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, exprToken{text: expr[i : i+1]})
+			i++
+		case c == '{':
+			end := strings.IndexByte(expr[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated placeholder")
+			}
+			tokens = append(tokens, exprToken{text: expr[i : i+end+1]})
+			i += end + 1
+		case c == '\'' || c == '"':
+			var lit []byte
+			j := i + 1
+			for ; j < len(expr) && expr[j] != c; j++ {
+				if expr[j] == '\\' && j+1 < len(expr) {
+					j++
+				}
+				lit = append(lit, expr[j])
+			}
+			if j == len(expr) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, exprToken{text: string(lit), quoted: true})
+			i = j + 1
+		case strings.IndexByte("!=<>&|", c) >= 0:
+			j := i + 1
+			for j < len(expr) && strings.IndexByte("=&|", expr[j]) >= 0 && j-i < 2 {
+				j++
+			}
+			op := expr[i:j]
+			if op != "!" && op != "&&" && op != "||" && !exprOperators[op] {
+				return nil, fmt.Errorf("unknown operator %s", op)
+			}
+			tokens = append(tokens, exprToken{text: op})
+			i = j
+		default:
+			j := i
+			for j < len(expr) && (unicode.IsLetter(rune(expr[j])) || unicode.IsDigit(rune(expr[j])) ||
+				strings.IndexByte("_.-+", expr[j]) >= 0) {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			tokens = append(tokens, exprToken{text: expr[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// exprParser parses tokens by recursive descent.
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() (exprToken, bool) {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos], true
+	}
+	return exprToken{}, false
+}
+
+// accept consumes the next token if it is the operator or
+// punctuation op.
+func (p *exprParser) accept(op string) bool {
+	if tok, ok := p.peek(); ok && !tok.quoted && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = exprLogic{and: false, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = exprLogic{and: true, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.accept("!") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return exprNot{x}, nil
+	}
+	if p.accept("(") {
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("expected )")
+		}
+		return x, nil
+	}
+
+	x, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	tok, ok := p.peek()
+	if !ok || tok.quoted || !exprOperators[tok.text] {
+		return exprTruth{x}, nil
+	}
+	p.pos++
+	y, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	cmp := exprCompare{op: tok.text, x: x, y: y}
+	if lit, ok := y.(exprLiteral); ok && cmp.op == "matches" {
+		if cmp.re, err = regexp.Compile(string(lit)); err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", lit, err)
+		}
+	}
+	return cmp, nil
+}
+
+func (p *exprParser) parseOperand() (exprNode, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	switch {
+	case tok.quoted:
+		return exprLiteral(tok.text), nil
+	case strings.HasPrefix(tok.text, "{"):
+		return exprPlaceholder(tok.text), nil
+	case tok.text == "true" || tok.text == "false":
+		return exprLiteral(tok.text), nil
+	}
+	if _, err := strconv.ParseFloat(tok.text, 64); err == nil {
+		return exprLiteral(tok.text), nil
+	}
+	return nil, fmt.Errorf("unexpected %s; strings must be quoted", tok.text)
+}
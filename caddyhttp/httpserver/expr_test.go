@@ -0,0 +1,105 @@
+package httpserver
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy"
+)
+
+func TestExpr(t *testing.T) {
+	r := httptest.NewRequest("POST", "http://example.com/api/items?page=12", nil)
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	r.Header.Set("X-Debug", "0")
+	r.Header.Set("X-Page", "12")
+	r.Header.Set("X-Pattern", "items$")
+
+	for i, test := range []struct {
+		expr     string
+		expected bool
+	}{
+		{`{method} == 'POST' && {>Content-Type} matches 'json'`, true},
+		{`{method} == "GET" || {>Content-Type} matches '^text/'`, false},
+		{`{method} != 'GET'`, true},
+		{`!({method} == 'POST')`, false},
+		{`{path} starts_with '/api/' && {path} ends_with 'items'`, true},
+		{`{>Content-Type} contains 'json' && !{>X-Debug}`, true},
+		{`{>X-Missing}`, false},
+		{`{host}`, true},
+		{`{>X-Page} > 9`, true},   // numeric
+		{`{>X-Page} > '9'`, true}, // numeric, though quoted
+		{`{>X-Page} <= 12 && {>X-Page} >= 12`, true},
+		{`{host} < 'f'`, true}, // lexical
+		{`false || {method} == 'POST' && false`, false},
+		{`true || {method} == 'POST' && false`, true},
+		{`{path} matches {>X-Pattern}`, true}, // pattern from a placeholder
+		{`'it\'s' == "it's"`, true},
+		{`'{method}' == 'POST'`, false}, // literals are not replaced
+	} {
+		e, err := ParseExpr(test.expr)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if got := e.Match(r); got != test.expected {
+			t.Errorf("Test %d: Expected %q to be %v, got %v", i, test.expr, test.expected, got)
+		}
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	for i, expr := range []string{
+		``,
+		`{method} == POST`,
+		`{method} = 'POST'`,
+		`{method} == 'POST`,
+		`{method`,
+		`({method} == 'POST'`,
+		`{method} == 'POST')`,
+		`{path} matches '('`,
+		`{method} == 'POST' &&`,
+		`{method} == 'POST' & {host}`,
+		`{method} 'POST'`,
+		`{method} ~ 'POST'`,
+	} {
+		if _, err := ParseExpr(expr); err == nil {
+			t.Errorf("Test %d: Expected error for %q, got none", i, expr)
+		}
+	}
+}
+
+func TestSetupIfMatcherExpr(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		method    string
+		expected  bool
+	}{
+		{"rewrite {\n if {method} == 'POST' && {>Content-Type} matches json\n}", true, "", false},
+		{"rewrite {\n if {method} == 'POST' && {path} starts_with '/api'\n}", false, "POST", true},
+		{"rewrite {\n if {method} == 'POST' && {path} starts_with '/api'\n}", false, "GET", false},
+		{"rewrite {\n if \"{method} == 'GET'\"\n}", false, "GET", true},
+		{"rewrite {\n if {path} == \"/api/a b\"\n}", false, "GET", true},
+		{"rewrite {\n if {method} is GET\n if {path} ends_with 'b'\n if_op or\n}", false, "GET", true},
+		{"rewrite {\n if {method} is GET\n if {path} ends_with 'a'\n}", false, "GET", false},
+		{"rewrite {\n if\n}", true, "", false},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		c.Next()
+		m, err := SetupIfMatcher(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		r := httptest.NewRequest(test.method, "/api/a%20b", nil)
+		if got := m.Match(r); got != test.expected {
+			t.Errorf("Test %d: Expected match %v, got %v", i, test.expected, got)
+		}
+	}
+}
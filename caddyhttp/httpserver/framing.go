@@ -0,0 +1,295 @@
+package httpserver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// framingListener wraps accepted connections so that requests
+// with ambiguous framing are rejected before they are parsed.
+// net/http removes the Transfer-Encoding and Content-Length fields
+// of requests before handlers see them, so the framing can only be
+// checked on the bytes received.
+type framingListener struct {
+	net.Listener
+}
+
+// Accept accepts the next connection and starts checking it.
+func (ln framingListener) Accept() (net.Conn, error) {
+	c, err := ln.Listener.Accept()
+	if err != nil {
+		return c, err
+	}
+	return &framingConn{Conn: c}, nil
+}
+
+// framingConn is a connection which checks the header block of
+// every HTTP/1 request read from it. If the length of a request's
+// body could be interpreted in more than one way, reading fails,
+// so net/http responds with 400 Bad Request and closes the
+// connection.
+type framingConn struct {
+	net.Conn
+
+	mu      sync.Mutex
+	scanner framingScanner
+	started bool  // whether data was read yet
+	stopped bool  // the connection is not HTTP/1 (anymore)
+	err     error // framing error, returned by every read
+}
+
+// Read reads from the connection and checks the data read.
+func (c *framingConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	n, err := c.Conn.Read(p)
+	if !c.started && n > 0 {
+		c.started = true
+		// the TLS handshake is done by now; HTTP/2 is framed by itself
+		if tc, ok := c.Conn.(*tls.Conn); ok && tc.ConnectionState().NegotiatedProtocol == "h2" {
+			c.stopped = true
+		}
+	}
+	if c.stopped || n == 0 {
+		return n, err
+	}
+
+	valid, ferr := c.scanner.scan(p[:n])
+	if ferr == nil {
+		return n, err
+	}
+	remoteHost, _, splitErr := net.SplitHostPort(c.RemoteAddr().String())
+	if splitErr != nil {
+		remoteHost = c.RemoteAddr().String()
+	}
+	log.Printf("[WARNING] rejected request from %s: %v", remoteHost, ferr)
+	c.err = ferr
+	if valid > 0 {
+		// let the requests before the offending one be served
+		return valid, nil
+	}
+	return 0, ferr
+}
+
+// stop stops checking the connection, which has been hijacked.
+func (c *framingConn) stop() {
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+}
+
+// framingConnState stops checking c once it is hijacked,
+// since it no longer carries HTTP requests after that.
+func framingConnState(c net.Conn, cs http.ConnState) {
+	if fc, ok := c.(*framingConn); ok && cs == http.StateHijacked {
+		fc.stop()
+	}
+}
+
+// maxFramingLine is the longest line framingScanner accepts;
+// net/http rejects longer request headers, too.
+const maxFramingLine = http.DefaultMaxHeaderBytes
+
+// States of a framingScanner.
+const (
+	scanRequestLine = iota // before the request line
+	scanHeader             // in the header block
+	scanBody               // in a body of known length
+	scanChunkSize          // at the size line of a chunk
+	scanChunkData          // in the data of a chunk
+	scanChunkEnd           // at the line ending chunk data
+	scanTrailer            // in the trailer of a chunked body
+)
+
+// framingScanner follows a stream of HTTP/1 requests, skipping
+// their bodies, and checks the framing of each header block.
+type framingScanner struct {
+	state     int
+	line      []byte // incomplete line
+	remaining int64  // bytes left of the body or chunk
+
+	proto    string
+	lastName string // name of the previous header field
+	te, cl   []string
+}
+
+// scan scans the next data p of the stream. If it returns an
+// error, n is how many bytes of p precede the offending request.
+func (s *framingScanner) scan(p []byte) (n int, err error) {
+	var off int // of the rest of p
+	for off < len(p) {
+		rest := p[off:]
+		if s.state == scanBody || s.state == scanChunkData {
+			skip := int64(len(rest))
+			if skip > s.remaining {
+				skip = s.remaining
+			}
+			off += int(skip)
+			s.remaining -= skip
+			if s.remaining == 0 {
+				if s.state == scanBody {
+					s.state = scanRequestLine
+				} else {
+					s.state = scanChunkEnd
+				}
+			}
+			continue
+		}
+
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			i = len(rest)
+		}
+		if len(s.line)+i > maxFramingLine {
+			return n, fmt.Errorf("line too long")
+		}
+		if s.state == scanRequestLine && len(s.line) == 0 {
+			// the next request may start here
+			n = off
+		}
+		s.line = append(s.line, rest[:i]...)
+		if i == len(rest) {
+			return n, nil
+		}
+		off += i + 1
+		line := string(bytes.TrimSuffix(s.line, []byte("\r")))
+		s.line = s.line[:0]
+		if err := s.scanLine(line); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// scanLine scans a complete line without its line ending.
+func (s *framingScanner) scanLine(line string) error {
+	switch s.state {
+	case scanRequestLine:
+		if line == "" {
+			// empty lines before a request are ignored
+			return nil
+		}
+		s.proto = line[strings.LastIndex(line, " ")+1:]
+		s.lastName, s.te, s.cl = "", nil, nil
+		s.state = scanHeader
+
+	case scanHeader:
+		if line == "" {
+			return s.endHeader()
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			// continuation of the previous field
+			switch s.lastName {
+			case "transfer-encoding":
+				s.te = append(s.te, transferCodings(line)...)
+			case "content-length":
+				s.cl[len(s.cl)-1] += " " + strings.TrimSpace(line)
+			}
+			return nil
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			s.lastName = ""
+			return nil
+		}
+		name := strings.ToLower(line[:colon])
+		if name != strings.TrimRight(name, " \t") {
+			return fmt.Errorf("whitespace before colon in header field %q", line[:colon])
+		}
+		s.lastName = name
+		switch name {
+		case "transfer-encoding":
+			s.te = append(s.te, transferCodings(line[colon+1:])...)
+		case "content-length":
+			s.cl = append(s.cl, strings.TrimSpace(line[colon+1:]))
+		}
+
+	case scanChunkSize:
+		size := line
+		if i := strings.IndexAny(size, "; \t"); i > -1 {
+			size = size[:i]
+		}
+		n, err := strconv.ParseInt(size, 16, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid chunk size %q", line)
+		}
+		if n == 0 {
+			s.state = scanTrailer
+		} else {
+			s.state, s.remaining = scanChunkData, n
+		}
+
+	case scanChunkEnd:
+		if line != "" {
+			return fmt.Errorf("chunk data longer than its size")
+		}
+		s.state = scanChunkSize
+
+	case scanTrailer:
+		if line == "" {
+			s.state = scanRequestLine
+		}
+	}
+	return nil
+}
+
+// endHeader checks the framing of the header block
+// that just ended and starts scanning its body.
+func (s *framingScanner) endHeader() error {
+	if len(s.te) > 0 {
+		if len(s.cl) > 0 {
+			return fmt.Errorf("both Transfer-Encoding and Content-Length present")
+		}
+		if s.proto == "HTTP/1.0" {
+			return fmt.Errorf("Transfer-Encoding in HTTP/1.0 request")
+		}
+		if len(s.te) != 1 || !strings.EqualFold(s.te[0], "chunked") {
+			return fmt.Errorf("unsupported Transfer-Encoding %q", strings.Join(s.te, ", "))
+		}
+		s.state = scanChunkSize
+		return nil
+	}
+
+	if len(s.cl) > 1 {
+		return fmt.Errorf("multiple Content-Length fields")
+	}
+	if len(s.cl) == 1 {
+		n, err := strconv.ParseInt(s.cl[0], 10, 64)
+		if err != nil || n < 0 || strings.Trim(s.cl[0], "0123456789") != "" {
+			return fmt.Errorf("invalid Content-Length %q", s.cl[0])
+		}
+		if n > 0 {
+			s.state, s.remaining = scanBody, n
+			return nil
+		}
+	}
+	s.state = scanRequestLine
+	return nil
+}
+
+// transferCodings splits the Transfer-Encoding field value into
+// its trimmed, non-empty codings. An empty value is returned as an
+// empty coding, which is not supported.
+func transferCodings(value string) []string {
+	var codings []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			codings = append(codings, v)
+		}
+	}
+	if len(codings) == 0 {
+		codings = []string{""}
+	}
+	return codings
+}
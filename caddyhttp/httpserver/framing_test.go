@@ -0,0 +1,90 @@
+package httpserver
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFramingListener(t *testing.T) {
+	s, err := NewServer("127.0.0.1:0", []*SiteConfig{{
+		Addr:          Address{Original: "localhost", Host: "localhost", Port: "80"},
+		StrictFraming: true,
+		middleware: []Middleware{func(Handler) Handler {
+			return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				body, _ := ioutil.ReadAll(r.Body)
+				w.Write(body)
+				return 0, nil
+			})
+		}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	defer ln.Close()
+
+	for i, test := range []struct {
+		raw      string
+		statuses []int // of the responses, in order; 400 may also be a closed connection
+	}{
+		{"GET / HTTP/1.1\r\nHost: localhost\r\n\r\n", []int{200}},
+		{"POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello", []int{200}},
+		{"POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n", []int{200}},
+		{"POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\nContent-Length: 4\r\n\r\n0\r\n\r\n", []int{400}},
+		{"POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", []int{400}},
+		{"POST / HTTP/1.1\r\nHost: localhost\r\ntransfer-encoding: chunked\r\ncontent-length: 4\r\n\r\n0\r\n\r\n", []int{400}},
+		{"POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding : chunked\r\n\r\n0\r\n\r\n", []int{400}},
+		{"POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n", []int{400}},
+		{"POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: xchunked\r\n\r\n0\r\n\r\n", []int{400}},
+		{"POST / HTTP/1.0\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", []int{400}},
+		{"POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello", []int{400}},
+		{"POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: +5\r\n\r\nhello", []int{400}},
+		// header-like data in bodies is not mistaken for headers
+		{"POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 59\r\n\r\n" +
+			"GET / HTTP/1.1\r\nContent-Length: 1\r\nTransfer-Encoding: x\r\n\r\n" +
+			"GET / HTTP/1.1\r\nHost: localhost\r\n\r\n", []int{200, 200}},
+		{"POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"c\r\nA: 1\r\nB: 2\r\n\r\n0\r\nTrailer: 1\r\n\r\n" +
+			"GET / HTTP/1.1\r\nHost: localhost\r\n\r\n", []int{200, 200}},
+		// requests following a valid one are checked, too
+		{"POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 2\r\n\r\nhi" +
+			"POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", []int{200, 400}},
+	} {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write([]byte(test.raw)); err != nil {
+			t.Fatalf("Test %d: Writing request: %v", i, err)
+		}
+
+		br := bufio.NewReader(conn)
+		for j, want := range test.statuses {
+			resp, err := http.ReadResponse(br, nil)
+			if err != nil && want == http.StatusBadRequest && j > 0 {
+				// net/http closes the connection if the
+				// request fails while it reads ahead
+				break
+			}
+			if err != nil {
+				t.Errorf("Test %d: Reading response %d: %v", i, j, err)
+				break
+			}
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != want {
+				t.Errorf("Test %d: Expected status %d for response %d, got %d", i, want, j, resp.StatusCode)
+			}
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,204 @@
+package httpserver
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// KeepAlive controls whether and for how long connections
+// are kept alive after serving a request to a site.
+type KeepAlive struct {
+	// Whether keep-alive is disabled for the whole site
+	Disabled bool
+
+	// Max number of requests served on one connection,
+	// after which it is closed (0 for no limit)
+	MaxRequests int
+
+	// Max time a connection may be idle between
+	// requests (0 for no limit)
+	Timeout time.Duration
+
+	// Paths for which keep-alive is disabled
+	DisabledPaths []string
+
+	// User agents for which keep-alive is disabled
+	DisabledAgents []*regexp.Regexp
+}
+
+// isZero returns true if k does not change the default behavior.
+func (k KeepAlive) isZero() bool {
+	return !k.Disabled && k.MaxRequests == 0 && k.Timeout == 0 &&
+		len(k.DisabledPaths) == 0 && len(k.DisabledAgents) == 0
+}
+
+// disabledFor returns true if keep-alive is disabled for r.
+func (k KeepAlive) disabledFor(r *http.Request) bool {
+	if k.Disabled {
+		return true
+	}
+	for _, p := range k.DisabledPaths {
+		if Path(r.URL.Path).Matches(p) {
+			return true
+		}
+	}
+	if ua := r.Header.Get("User-Agent"); ua != "" {
+		for _, re := range k.DisabledAgents {
+			if re.MatchString(ua) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keepAliveTracker keeps per-connection state needed to
+// apply the sites' keep-alive settings.
+type keepAliveTracker struct {
+	sync.Mutex
+	conns map[net.Conn]*keepAliveConn // by connection, as returned by baseConn
+}
+
+type keepAliveConn struct {
+	requests int           // requests served so far
+	timeout  time.Duration // idle timeout of the last site served
+	conn     *idleConn     // nil if not accepted by a keepAliveListener
+}
+
+func newKeepAliveTracker() *keepAliveTracker {
+	return &keepAliveTracker{conns: make(map[net.Conn]*keepAliveConn)}
+}
+
+// get returns the state of the connection c,
+// which is created if there is none.
+func (t *keepAliveTracker) get(c net.Conn) *keepAliveConn {
+	t.Lock()
+	defer t.Unlock()
+	kc, ok := t.conns[c]
+	if !ok {
+		kc = new(keepAliveConn)
+		t.conns[c] = kc
+	}
+	return kc
+}
+
+// serve applies the keep-alive settings k of a site to the
+// response to r, which is about to be served.
+func (t *keepAliveTracker) serve(k KeepAlive, w http.ResponseWriter, r *http.Request) {
+	c := requestConn(r)
+	if c == nil {
+		return
+	}
+	kc := t.get(c)
+	t.Lock()
+	kc.requests++
+	kc.timeout = k.Timeout
+	requests := kc.requests
+	t.Unlock()
+
+	// HTTP/2 connections can't be closed this way
+	if r.ProtoMajor != 1 {
+		return
+	}
+	if k.disabledFor(r) || (k.MaxRequests > 0 && requests >= k.MaxRequests) {
+		w.Header().Set("Connection", "close")
+	}
+}
+
+// connState enforces the idle timeout of c and forgets
+// about c once it is closed.
+func (t *keepAliveTracker) connState(c net.Conn, cs http.ConnState) {
+	c = baseConn(c)
+	if c == nil {
+		return
+	}
+	switch cs {
+	case http.StateIdle:
+		t.Lock()
+		kc, ok := t.conns[c]
+		var timeout time.Duration
+		if ok {
+			timeout = kc.timeout
+		}
+		t.Unlock()
+		if ok && kc.conn != nil && timeout > 0 {
+			kc.conn.idle(timeout)
+		}
+	case http.StateClosed, http.StateHijacked:
+		t.Lock()
+		delete(t.conns, c)
+		t.Unlock()
+	}
+}
+
+// keepAliveListener wraps accepted connections so
+// that their idle timeouts can be enforced.
+type keepAliveListener struct {
+	net.Listener
+	tracker *keepAliveTracker
+}
+
+// Accept accepts the next connection and tracks it.
+func (ln keepAliveListener) Accept() (net.Conn, error) {
+	c, err := ln.Listener.Accept()
+	if err != nil {
+		return c, err
+	}
+	ic := &idleConn{Conn: c}
+	base := baseConn(c)
+	if base == nil {
+		return ic, nil
+	}
+	kc := ln.tracker.get(base)
+	ln.tracker.Lock()
+	kc.conn = ic
+	ln.tracker.Unlock()
+	return ic, nil
+}
+
+// idleConn is a connection whose read deadline, while it
+// waits for the next request, is its idle timeout, which
+// net/http would otherwise clear as it waits.
+type idleConn struct {
+	net.Conn
+
+	mu           sync.Mutex
+	idleDeadline time.Time // zero unless idle with a timeout
+}
+
+// Read reads from the connection, which is no longer
+// idle once the next request starts to arrive.
+func (c *idleConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.mu.Lock()
+		if !c.idleDeadline.IsZero() {
+			c.idleDeadline = time.Time{}
+			c.Conn.SetReadDeadline(time.Time{})
+		}
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+// SetReadDeadline sets the read deadline of the connection,
+// but not past its idle timeout while it is idle.
+func (c *idleConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.idleDeadline.IsZero() && (t.IsZero() || t.After(c.idleDeadline)) {
+		t = c.idleDeadline
+	}
+	return c.Conn.SetReadDeadline(t)
+}
+
+// idle lets the connection idle for timeout.
+func (c *idleConn) idle(timeout time.Duration) {
+	c.mu.Lock()
+	c.idleDeadline = time.Now().Add(timeout)
+	c.Conn.SetReadDeadline(c.idleDeadline)
+	c.mu.Unlock()
+}
@@ -0,0 +1,104 @@
+package httpserver
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestKeepAliveServe(t *testing.T) {
+	k := KeepAlive{
+		MaxRequests:    3,
+		DisabledPaths:  []string{"/upload"},
+		DisabledAgents: []*regexp.Regexp{regexp.MustCompile("^BadBot")},
+	}
+	tracker := newKeepAliveTracker()
+
+	// the connections have the same address, like Unix socket ones
+	conns := []net.Conn{
+		&identifiedConn{Conn: addrConn{addr: "@"}},
+		&identifiedConn{Conn: addrConn{addr: "@"}},
+	}
+	for i, test := range []struct {
+		conn            int
+		path, userAgent string
+		expectClose     bool
+	}{
+		{0, "/", "", false},
+		{0, "/upload/file", "", true},
+		{1, "/", "BadBot/1.0", true},
+		{1, "/", "GoodBot/1.0", false},
+		{0, "/", "", true}, // third request on this connection
+	} {
+		r := connRequest(conns[test.conn])
+		r.URL.Path = test.path
+		r.Header.Set("User-Agent", test.userAgent)
+		w := httptest.NewRecorder()
+
+		tracker.serve(k, w, r)
+
+		if got := w.Header().Get("Connection") == "close"; got != test.expectClose {
+			t.Errorf("Test %d: Expected connection close to be %v, got %v", i, test.expectClose, got)
+		}
+	}
+}
+
+func TestKeepAliveTimeout(t *testing.T) {
+	s, err := NewServer("127.0.0.1:0", []*SiteConfig{{
+		Addr:      Address{Original: "localhost", Host: "localhost", Port: "80"},
+		KeepAlive: KeepAlive{Timeout: 200 * time.Millisecond},
+		middleware: []Middleware{func(Handler) Handler {
+			return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				w.Write([]byte("ok"))
+				return 0, nil
+			})
+		}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	defer ln.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	// requests within the idle timeout are served on the same connection
+	for i := 0; i < 2; i++ {
+		conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("Request %d: %v", i, err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Close {
+			t.Fatalf("Request %d: Expected kept-alive connection with status 200, got status %d and close %v", i, resp.StatusCode, resp.Close)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// then it is closed once it idles for longer
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = ioutil.ReadAll(br)
+	if isTimeout(err) {
+		t.Fatal("Expected idle connection to be closed, but it was not")
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("Expected connection to be closed after its idle timeout, closed after %v", d)
+	}
+}
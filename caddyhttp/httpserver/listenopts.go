@@ -0,0 +1,81 @@
+package httpserver
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// ListenerOptions tune the socket of a site's listener and the
+// connections accepted on it. All sites on an address share one
+// listener, so sites on the same address must not disagree.
+type ListenerOptions struct {
+	// Let several processes listen on the same address
+	ReusePort bool
+
+	// Queue length for TCP Fast Open; 0 disables it
+	FastOpen int
+
+	// "on" or "off" to set TCP_NODELAY on connections;
+	// empty keeps Go's default, which is on
+	NoDelay string
+
+	// Period of TCP keep-alive probes; 0 means 3 minutes,
+	// and a negative period disables keep-alive probes
+	KeepAlive time.Duration
+
+	// Length of the queue of pending connections; 0 means
+	// the system default
+	Backlog int
+}
+
+// needsSocket returns true if the options must be set
+// on the socket before it starts listening.
+func (o ListenerOptions) needsSocket() bool {
+	return o.ReusePort || o.FastOpen > 0 || o.Backlog > 0
+}
+
+// listenerOptions returns the listener options of the sites
+// in group, or an error if sites that set options disagree.
+func listenerOptions(group []*SiteConfig) (ListenerOptions, error) {
+	var opts ListenerOptions
+	var from *SiteConfig
+	for _, site := range group {
+		if site.ListenerOptions == (ListenerOptions{}) {
+			continue
+		}
+		if from != nil && site.ListenerOptions != opts {
+			return opts, fmt.Errorf("%s and %s: conflicting listener_options on the same address", from.Addr, site.Addr)
+		}
+		opts, from = site.ListenerOptions, site
+	}
+	return opts, nil
+}
+
+// listen listens on the TCP address addr with opts.
+func listen(addr string, opts ListenerOptions) (net.Listener, error) {
+	if opts.needsSocket() {
+		return listenSocket(addr, opts)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// tuneConn applies the per-connection options of opts to tc.
+func tuneConn(tc *net.TCPConn, opts ListenerOptions) {
+	switch {
+	case opts.KeepAlive < 0:
+		tc.SetKeepAlive(false)
+	case opts.KeepAlive > 0:
+		tc.SetKeepAlive(true)
+		tc.SetKeepAlivePeriod(opts.KeepAlive)
+	default:
+		tc.SetKeepAlive(true)
+		tc.SetKeepAlivePeriod(3 * time.Minute)
+	}
+	switch opts.NoDelay {
+	case "on":
+		tc.SetNoDelay(true)
+	case "off":
+		tc.SetNoDelay(false)
+	}
+}
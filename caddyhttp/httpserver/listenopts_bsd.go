@@ -0,0 +1,10 @@
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package httpserver
+
+import "syscall"
+
+const (
+	soReusePort = syscall.SO_REUSEPORT
+	tcpFastOpen = 0 // not supported
+)
@@ -0,0 +1,7 @@
+package httpserver
+
+// Socket options missing from package syscall on Linux
+const (
+	soReusePort = 0xf
+	tcpFastOpen = 0x17
+)
@@ -0,0 +1,13 @@
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package httpserver
+
+import (
+	"fmt"
+	"net"
+)
+
+// listenSocket is not supported on this system.
+func listenSocket(addr string, opts ListenerOptions) (net.Listener, error) {
+	return nil, fmt.Errorf("listen tcp %s: reuseport, fastopen, and backlog are not supported on this system", addr)
+}
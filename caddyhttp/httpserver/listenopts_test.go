@@ -0,0 +1,62 @@
+package httpserver
+
+import (
+	"net"
+	"runtime"
+	"testing"
+)
+
+func TestListenerOptionsConflict(t *testing.T) {
+	for i, test := range []struct {
+		a, b      ListenerOptions
+		shouldErr bool
+	}{
+		{ListenerOptions{}, ListenerOptions{}, false},
+		{ListenerOptions{ReusePort: true}, ListenerOptions{}, false},
+		{ListenerOptions{ReusePort: true}, ListenerOptions{ReusePort: true}, false},
+		{ListenerOptions{ReusePort: true}, ListenerOptions{Backlog: 10}, true},
+	} {
+		opts, err := listenerOptions([]*SiteConfig{
+			{Addr: Address{Host: "a"}, ListenerOptions: test.a},
+			{Addr: Address{Host: "b"}, ListenerOptions: test.b},
+		})
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: Expected error %v, got: %v", i, test.shouldErr, err)
+		}
+		if !test.shouldErr && opts != test.a {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.a, opts)
+		}
+	}
+}
+
+func TestListenReusePort(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_REUSEPORT semantics differ by platform")
+	}
+	opts := ListenerOptions{ReusePort: true, Backlog: 16}
+	ln1, err := listen("127.0.0.1:0", opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer ln1.Close()
+	if _, ok := ln1.(*net.TCPListener); !ok {
+		t.Fatalf("Expected a *net.TCPListener for graceful restarts, got %T", ln1)
+	}
+
+	// a second listener on the same address works only with reuseport
+	ln2, err := listen(ln1.Addr().String(), opts)
+	if err != nil {
+		t.Fatalf("Expected to listen again with reuseport, got: %v", err)
+	}
+	ln2.Close()
+	if ln3, err := listen(ln1.Addr().String(), ListenerOptions{}); err == nil {
+		ln3.Close()
+		t.Error("Expected error listening again without reuseport")
+	}
+
+	conn, err := net.Dial("tcp", ln1.Addr().String())
+	if err != nil {
+		t.Fatalf("Expected to connect, got: %v", err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,91 @@
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package httpserver
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenSocket creates, configures, binds, and listens on a TCP
+// socket for addr, then hands it over to the net package.
+func listenSocket(addr string, opts ListenerOptions) (net.Listener, error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var family int
+	var sa syscall.Sockaddr
+	if ip4 := tcpAddr.IP.To4(); ip4 != nil {
+		sa4 := &syscall.SockaddrInet4{Port: tcpAddr.Port}
+		copy(sa4.Addr[:], ip4)
+		family, sa = syscall.AF_INET, sa4
+	} else {
+		// IPv6, or all addresses (IPv4 and IPv6) like net.Listen
+		sa6 := &syscall.SockaddrInet6{Port: tcpAddr.Port}
+		copy(sa6.Addr[:], tcpAddr.IP.To16())
+		family, sa = syscall.AF_INET6, sa6
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM, syscall.IPPROTO_TCP)
+	if err != nil && tcpAddr.IP == nil {
+		// no IPv6 on this system; all IPv4 addresses will do
+		family, sa = syscall.AF_INET, &syscall.SockaddrInet4{Port: tcpAddr.Port}
+		fd, err = syscall.Socket(family, syscall.SOCK_STREAM, syscall.IPPROTO_TCP)
+	}
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	syscall.CloseOnExec(fd)
+
+	err = setSocketOptions(fd, opts)
+	if err == nil {
+		err = os.NewSyscallError("bind", syscall.Bind(fd, sa))
+	}
+	if err == nil {
+		backlog := opts.Backlog
+		if backlog <= 0 {
+			backlog = syscall.SOMAXCONN
+		}
+		err = os.NewSyscallError("listen", syscall.Listen(fd, backlog))
+	}
+	if err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("listen tcp %s: %v", addr, err)
+	}
+
+	// net.FileListener dups the descriptor, so close ours after
+	file := os.NewFile(uintptr(fd), "tcp:"+addr)
+	defer file.Close()
+	return net.FileListener(file)
+}
+
+// setSocketOptions sets the options in opts on the socket fd.
+func setSocketOptions(fd int, opts ListenerOptions) error {
+	err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	if err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	if opts.ReusePort {
+		if soReusePort == 0 {
+			return fmt.Errorf("reuseport is not supported on this system")
+		}
+		err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, soReusePort, 1)
+		if err != nil {
+			return os.NewSyscallError("setsockopt SO_REUSEPORT", err)
+		}
+	}
+	if opts.FastOpen > 0 {
+		if tcpFastOpen == 0 {
+			return fmt.Errorf("TCP fast open is not supported on this system")
+		}
+		err := syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, tcpFastOpen, opts.FastOpen)
+		if err != nil {
+			return os.NewSyscallError("setsockopt TCP_FASTOPEN", err)
+		}
+	}
+	return nil
+}
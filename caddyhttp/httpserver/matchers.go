@@ -0,0 +1,180 @@
+package httpserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/mholt/caddy"
+)
+
+// Matcher is a named set of conditions on requests, defined once
+// per site with the matcher directive and referred to as @name
+// by other directives. A request matches if it meets all of the
+// conditions that are set; of several values for a condition,
+// such as Methods, it must match one.
+type Matcher struct {
+	Name string
+
+	// Paths are prefixes, or globs like /api/*/items;
+	// a trailing * matches everything below
+	Paths []string
+
+	// Headers must each match one of their values;
+	// a value of * matches any value, and a trailing
+	// * matches by prefix
+	Headers []HeaderMatch
+
+	// Methods are HTTP methods
+	Methods []string
+
+	// RemoteIPs are the networks clients must be in
+	RemoteIPs []*net.IPNet
+
+	// Exprs must all be true
+	Exprs []*Expr
+}
+
+// HeaderMatch is a header field and its accepted values.
+type HeaderMatch struct {
+	Field  string
+	Values []string
+}
+
+// Match implements RequestMatcher.
+func (m *Matcher) Match(r *http.Request) bool {
+	if len(m.Paths) > 0 && !matchAny(m.Paths, func(p string) bool { return matchPathGlob(r.URL.Path, p) }) {
+		return false
+	}
+	for _, h := range m.Headers {
+		values := r.Header[http.CanonicalHeaderKey(h.Field)]
+		if !matchAny(values, func(value string) bool {
+			return matchAny(h.Values, func(v string) bool { return matchValue(value, v) })
+		}) {
+			return false
+		}
+	}
+	if len(m.Methods) > 0 && !matchAny(m.Methods, func(method string) bool { return r.Method == method }) {
+		return false
+	}
+	if len(m.RemoteIPs) > 0 {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return false
+		}
+		var in bool
+		for _, n := range m.RemoteIPs {
+			if n.Contains(ip) {
+				in = true
+				break
+			}
+		}
+		if !in {
+			return false
+		}
+	}
+	for _, e := range m.Exprs {
+		if !e.Match(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathGlob returns whether upath matches pattern, which is
+// a prefix unless it has glob characters other than a trailing *.
+func matchPathGlob(upath, pattern string) bool {
+	prefix := strings.TrimSuffix(pattern, "*")
+	if !strings.ContainsAny(prefix, "*?[") {
+		return Path(upath).Matches(prefix)
+	}
+	if !CaseSensitivePath {
+		upath, pattern = strings.ToLower(upath), strings.ToLower(pattern)
+	}
+	if ok, _ := path.Match(pattern, upath); ok {
+		return true
+	}
+	// a trailing * also matches deeper paths
+	if strings.HasSuffix(pattern, "/*") {
+		for dir := path.Dir(upath); dir != "/" && dir != "."; dir = path.Dir(dir) {
+			if ok, _ := path.Match(pattern, dir); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchValue returns whether value matches pattern, which is
+// *, a prefix followed by *, or an exact value.
+func matchValue(value, pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(value, pattern[:len(pattern)-1])
+	}
+	return value == pattern
+}
+
+// IsMatcherRef returns whether arg refers to a named matcher.
+func IsMatcherRef(arg string) bool {
+	return len(arg) > 1 && arg[0] == '@'
+}
+
+// AddMatcher defines the named matcher m for the site.
+func (s *SiteConfig) AddMatcher(m *Matcher) error {
+	if _, ok := s.matchers[m.Name]; ok {
+		return fmt.Errorf("matcher %s is already defined", m.Name)
+	}
+	if s.matchers == nil {
+		s.matchers = make(map[string]*Matcher)
+	}
+	s.matchers[m.Name] = m
+	return nil
+}
+
+// MatcherRef returns the named matcher that the argument
+// ref (like @name) of the current directive refers to.
+// Named matchers are defined before the directives that
+// refer to them run.
+func MatcherRef(c *caddy.Controller, ref string) (*Matcher, error) {
+	m, ok := GetConfig(c).matchers[ref]
+	if !ok {
+		return nil, c.Errf("unknown matcher '%s'", ref)
+	}
+	return m, nil
+}
+
+// ParseIPRange parses a CIDR range, or an IP address
+// as the range of only that address.
+func ParseIPRange(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, &net.ParseError{Type: "IP address", Text: s}
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	return n, err
+}
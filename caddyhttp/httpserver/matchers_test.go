@@ -0,0 +1,112 @@
+package httpserver
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy"
+)
+
+func TestMatcher(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("10.0.0.0/8")
+	expr, err := ParseExpr(`{>X-Beta} == 'on'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		matcher  Matcher
+		method   string
+		target   string
+		remote   string
+		headers  map[string]string
+		expected bool
+	}{
+		{Matcher{Paths: []string{"/api"}}, "GET", "/api/items", "", nil, true},
+		{Matcher{Paths: []string{"/api/*"}}, "GET", "/apiary", "", nil, false},
+		{Matcher{Paths: []string{"/api/*"}}, "GET", "/api/items", "", nil, true},
+		{Matcher{Paths: []string{"/users/*/posts"}}, "GET", "/users/42/posts", "", nil, true},
+		{Matcher{Paths: []string{"/users/*/posts"}}, "GET", "/users/42/likes", "", nil, false},
+		{Matcher{Paths: []string{"/*/admin/*"}}, "GET", "/site/admin/users/1", "", nil, true},
+		{Matcher{Paths: []string{"*.php"}}, "GET", "/index.php", "", nil, false},
+		{Matcher{Paths: []string{"/*.php"}}, "GET", "/index.php", "", nil, true},
+		{Matcher{Methods: []string{"POST", "PUT"}}, "PUT", "/", "", nil, true},
+		{Matcher{Methods: []string{"POST", "PUT"}}, "GET", "/", "", nil, false},
+		{Matcher{Headers: []HeaderMatch{{"Content-Type", []string{"application/json*"}}}}, "GET", "/", "",
+			map[string]string{"Content-Type": "application/json; charset=utf-8"}, true},
+		{Matcher{Headers: []HeaderMatch{{"X-Token", []string{"*"}}}}, "GET", "/", "", nil, false},
+		{Matcher{Headers: []HeaderMatch{{"X-Token", []string{"*"}}}}, "GET", "/", "", map[string]string{"X-Token": "x"}, true},
+		{Matcher{RemoteIPs: []*net.IPNet{lan}}, "GET", "/", "10.1.2.3:1234", nil, true},
+		{Matcher{RemoteIPs: []*net.IPNet{lan}}, "GET", "/", "192.168.1.1:1234", nil, false},
+		{Matcher{Exprs: []*Expr{expr}}, "GET", "/", "", map[string]string{"X-Beta": "on"}, true},
+		// all conditions must match
+		{Matcher{Paths: []string{"/api"}, Methods: []string{"POST"}}, "GET", "/api", "", nil, false},
+		{Matcher{Paths: []string{"/api"}, Methods: []string{"POST"}}, "POST", "/api", "", nil, true},
+	} {
+		r := httptest.NewRequest(test.method, test.target, nil)
+		if test.remote != "" {
+			r.RemoteAddr = test.remote
+		}
+		for k, v := range test.headers {
+			r.Header.Set(k, v)
+		}
+		if got := test.matcher.Match(r); got != test.expected {
+			t.Errorf("Test %d: Expected match %v, got %v", i, test.expected, got)
+		}
+	}
+}
+
+func TestMatcherRef(t *testing.T) {
+	c := caddy.NewTestController("http", "rewrite {\n if @api\n to /api.php\n}")
+	cfg := GetConfig(c)
+	api := &Matcher{Name: "@api", Methods: []string{"POST"}}
+	if err := cfg.AddMatcher(api); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := cfg.AddMatcher(&Matcher{Name: "@api"}); err == nil {
+		t.Error("Expected error redefining a matcher, got none")
+	}
+	if m, err := MatcherRef(c, "@api"); err != nil || m != api {
+		t.Errorf("Expected matcher @api, got %v, %v", m, err)
+	}
+	if _, err := MatcherRef(c, "@web"); err == nil {
+		t.Error("Expected error for unknown matcher, got none")
+	}
+
+	c.Next()
+	m, err := SetupIfMatcher(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !m.Match(httptest.NewRequest("POST", "/", nil)) || m.Match(httptest.NewRequest("GET", "/", nil)) {
+		t.Error("Expected if @api to match POST requests only")
+	}
+}
+
+func TestParseIPRange(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		expected  string
+		shouldErr bool
+	}{
+		{"10.0.0.0/8", "10.0.0.0/8", false},
+		{"10.1.2.3/8", "10.0.0.0/8", false},
+		{"192.168.1.1", "192.168.1.1/32", false},
+		{"::1", "::1/128", false},
+		{"fc00::/7", "fc00::/7", false},
+		{"::ffff:10.0.0.1", "10.0.0.1/32", false},
+		{"localhost", "", true},
+		{"10.0.0.0/33", "", true},
+		{"", "", true},
+	} {
+		n, err := ParseIPRange(test.input)
+		if (err != nil) != test.shouldErr {
+			t.Errorf("Test %d: Expected error to be %v, got: %v", i, test.shouldErr, err)
+			continue
+		}
+		if err == nil && n.String() != test.expected {
+			t.Errorf("Test %d: Expected %s, got %s", i, test.expected, n)
+		}
+	}
+}
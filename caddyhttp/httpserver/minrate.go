@@ -0,0 +1,297 @@
+package httpserver
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MinTransferRates protects a site from clients that send or
+// receive data so slowly that they tie up connections for a
+// long time (slowloris attacks). Zero values disable a check.
+type MinTransferRates struct {
+	// Max time a client may take to send the request headers,
+	// starting when the connection is accepted or, on kept-alive
+	// connections, when the first byte of the next request arrives
+	HeaderTimeout time.Duration
+
+	// Min rate, in bytes per second, at which request
+	// bodies must be received
+	Upload int64
+
+	// Min rate, in bytes per second, at which response
+	// bodies must be accepted by the client
+	Download int64
+
+	// Time allowed for each transfer before its rate is
+	// enforced, to absorb connection start-up and jitter
+	Grace time.Duration
+}
+
+// slowConnsDropped counts connections that were dropped
+// for transferring data too slowly.
+var slowConnsDropped int64
+
+// SlowConnectionsDropped returns the number of connections that
+// were dropped for transferring data slower than the minimum rate.
+func SlowConnectionsDropped() int64 {
+	return atomic.LoadInt64(&slowConnsDropped)
+}
+
+// deadline returns when transferring n bytes at rate bytes per
+// second, starting at start and allowing for grace, must be done.
+func deadline(start time.Time, grace time.Duration, n, rate int64) time.Time {
+	return start.Add(grace + time.Duration(n)*time.Second/time.Duration(rate))
+}
+
+// isTimeout returns true if err is a network timeout.
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// connTracker keeps the connections accepted by a server, keyed
+// as returned by baseConn, so request handlers can adjust their
+// deadlines.
+type connTracker struct {
+	sync.Mutex
+	conns         map[net.Conn]*slowConn
+	headerTimeout time.Duration
+}
+
+func newConnTracker(headerTimeout time.Duration) *connTracker {
+	return &connTracker{conns: make(map[net.Conn]*slowConn), headerTimeout: headerTimeout}
+}
+
+// get returns the slowConn of the connection c, or nil.
+func (t *connTracker) get(c net.Conn) *slowConn {
+	t.Lock()
+	defer t.Unlock()
+	return t.conns[c]
+}
+
+// connState updates the state of the tracked connection c.
+func (t *connTracker) connState(c net.Conn, cs http.ConnState) {
+	sc := t.get(baseConn(c))
+	if sc == nil {
+		return
+	}
+	switch cs {
+	case http.StateActive:
+		// the request headers have been read
+		sc.stopHeaderTimer()
+	case http.StateIdle:
+		sc.awaitRequest()
+	}
+}
+
+// slowConnListener wraps accepted connections so that they
+// are tracked and subject to the header timeout.
+type slowConnListener struct {
+	net.Listener
+	tracker *connTracker
+}
+
+// Accept accepts the next connection and starts its header timer.
+func (ln slowConnListener) Accept() (net.Conn, error) {
+	c, err := ln.Listener.Accept()
+	if err != nil {
+		return c, err
+	}
+	sc := &slowConn{Conn: c, tracker: ln.tracker, key: baseConn(c)}
+	if sc.key != nil {
+		ln.tracker.Lock()
+		ln.tracker.conns[sc.key] = sc
+		ln.tracker.Unlock()
+	}
+	sc.startHeaderTimer()
+	return sc, nil
+}
+
+// slowConn is a connection which enforces a deadline for reading
+// the request headers. It can be looked up by the connection it
+// wraps while serving a request to enforce minimum transfer rates.
+type slowConn struct {
+	net.Conn
+	tracker *connTracker
+	key     net.Conn // in tracker; nil if not tracked
+
+	mu             sync.Mutex
+	awaitingHeader bool      // header timer starts with next byte read
+	headerDeadline time.Time // zero when the timer is not running
+	dropped        bool      // the header timeout passed
+}
+
+// Read reads from the connection, starting the header timer if
+// this is the first data of a request on a kept-alive connection.
+func (c *slowConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+
+	c.mu.Lock()
+	if n > 0 && c.awaitingHeader {
+		c.awaitingHeader = false
+		c.setHeaderDeadline()
+	}
+	expired := !c.headerDeadline.IsZero() && !time.Now().Before(c.headerDeadline)
+	if err != nil && expired && isTimeout(err) && !c.dropped {
+		// the connection is read again after the timeout
+		c.dropped = true
+		atomic.AddInt64(&slowConnsDropped, 1)
+	}
+	c.mu.Unlock()
+	return n, err
+}
+
+// SetReadDeadline sets the read deadline of the connection, but
+// not past that of the header timer while it is running, as net/http
+// clears the deadline when it starts reading a request.
+func (c *slowConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.headerDeadline.IsZero() && (t.IsZero() || t.After(c.headerDeadline)) {
+		t = c.headerDeadline
+	}
+	return c.Conn.SetReadDeadline(t)
+}
+
+// Close closes the connection and stops tracking it.
+func (c *slowConn) Close() error {
+	c.tracker.Lock()
+	if c.key != nil && c.tracker.conns[c.key] == c {
+		delete(c.tracker.conns, c.key)
+	}
+	c.tracker.Unlock()
+	return c.Conn.Close()
+}
+
+func (c *slowConn) startHeaderTimer() {
+	c.mu.Lock()
+	c.setHeaderDeadline()
+	c.mu.Unlock()
+}
+
+func (c *slowConn) stopHeaderTimer() {
+	c.mu.Lock()
+	c.awaitingHeader = false
+	if !c.headerDeadline.IsZero() {
+		c.headerDeadline = time.Time{}
+		c.Conn.SetReadDeadline(time.Time{})
+	}
+	c.mu.Unlock()
+}
+
+// awaitRequest lets the connection idle until the
+// next request starts, then starts the header timer.
+func (c *slowConn) awaitRequest() {
+	c.mu.Lock()
+	c.awaitingHeader = c.tracker.headerTimeout > 0
+	c.headerDeadline = time.Time{}
+	c.Conn.SetReadDeadline(time.Time{})
+	c.mu.Unlock()
+}
+
+// setHeaderDeadline must be called with c.mu locked.
+func (c *slowConn) setHeaderDeadline() {
+	if c.tracker.headerTimeout <= 0 {
+		return
+	}
+	c.headerDeadline = time.Now().Add(c.tracker.headerTimeout)
+	c.Conn.SetReadDeadline(c.headerDeadline)
+}
+
+// minRateReader is a request body which must be
+// read at a minimum rate or the read times out.
+type minRateReader struct {
+	io.ReadCloser
+	conn  net.Conn
+	rate  int64
+	grace time.Duration
+	start time.Time
+	n     int64
+	done  bool
+}
+
+// Read reads from the body, setting the connection's read
+// deadline so that the body is received at the minimum rate.
+func (r *minRateReader) Read(p []byte) (int, error) {
+	if r.done {
+		return r.ReadCloser.Read(p)
+	}
+	r.conn.SetReadDeadline(deadline(r.start, r.grace, r.n+int64(len(p)), r.rate))
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	if err != nil {
+		if isTimeout(err) {
+			atomic.AddInt64(&slowConnsDropped, 1)
+			r.conn.Close()
+		}
+		r.finish()
+	}
+	return n, err
+}
+
+// Close closes the body and clears the read deadline.
+func (r *minRateReader) Close() error {
+	r.finish()
+	return r.ReadCloser.Close()
+}
+
+func (r *minRateReader) finish() {
+	if !r.done {
+		r.done = true
+		r.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// minRateWriter is a response writer whose writes must be
+// accepted by the client at a minimum rate or they time out.
+type minRateWriter struct {
+	http.ResponseWriter
+	conn  net.Conn
+	rate  int64
+	grace time.Duration
+}
+
+// Write writes p, setting the connection's write deadline so
+// that p is received by the client at the minimum rate.
+func (w minRateWriter) Write(p []byte) (int, error) {
+	w.conn.SetWriteDeadline(deadline(time.Now(), w.grace, int64(len(p)), w.rate))
+	n, err := w.ResponseWriter.Write(p)
+	if isTimeout(err) {
+		atomic.AddInt64(&slowConnsDropped, 1)
+	}
+	return n, err
+}
+
+// Hijack implements http.Hijacker. It clears the write deadline
+// and wraps the underlying ResponseWriter's Hijack method.
+func (w minRateWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		w.conn.SetWriteDeadline(time.Time{})
+		return hj.Hijack()
+	}
+	return nil, nil, NonHijackerError{Underlying: w.ResponseWriter}
+}
+
+// Flush implements http.Flusher. It simply wraps the underlying
+// ResponseWriter's Flush method if there is one, or panics.
+func (w minRateWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	} else {
+		panic(NonFlusherError{Underlying: w.ResponseWriter}) // should be recovered at the beginning of middleware stack
+	}
+}
+
+// CloseNotify implements http.CloseNotifier.
+// It just inherits the underlying ResponseWriter's CloseNotify method.
+func (w minRateWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	panic(NonCloseNotifierError{Underlying: w.ResponseWriter})
+}
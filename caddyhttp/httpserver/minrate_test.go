@@ -0,0 +1,141 @@
+package httpserver
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSlowConnHeaderTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := newConnTracker(50 * time.Millisecond)
+	sln := slowConnListener{Listener: identifyingListener{Listener: ln}, tracker: tracker}
+	defer sln.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	conn, err := sln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracker.get(baseConn(conn)) == nil {
+		t.Error("Expected accepted connection to be tracked")
+	}
+
+	before := SlowConnectionsDropped()
+	_, err = conn.Read(make([]byte, 1))
+	if !isTimeout(err) {
+		t.Errorf("Expected read to time out, got: %v", err)
+	}
+	if got := SlowConnectionsDropped(); got != before+1 {
+		t.Errorf("Expected dropped connection count to be %d, got %d", before+1, got)
+	}
+
+	conn.Close()
+	if tracker.get(baseConn(conn)) != nil {
+		t.Error("Expected closed connection to no longer be tracked")
+	}
+}
+
+func TestHeaderTimeoutKeptAlive(t *testing.T) {
+	s, err := NewServer("127.0.0.1:0", []*SiteConfig{{
+		Addr:     Address{Original: "localhost", Host: "localhost", Port: "80"},
+		MinRates: MinTransferRates{HeaderTimeout: 100 * time.Millisecond},
+		middleware: []Middleware{func(Handler) Handler {
+			return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				w.Write([]byte("ok"))
+				return 0, nil
+			})
+		}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	defer ln.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	// the first request is served, and the connection kept alive
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Close {
+		t.Fatalf("Expected kept-alive connection with status 200, got status %d and close %v", resp.StatusCode, resp.Close)
+	}
+
+	// idling is fine, but the next request's headers must be sent in time
+	time.Sleep(200 * time.Millisecond)
+	before := SlowConnectionsDropped()
+	conn.Write([]byte("GET / HTTP/1.1\r\n"))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = ioutil.ReadAll(br)
+	if isTimeout(err) {
+		t.Fatal("Expected connection to be closed when the header timeout passed, but it was not")
+	}
+	if got := SlowConnectionsDropped(); got != before+1 {
+		t.Errorf("Expected dropped connection count to be %d, got %d", before+1, got)
+	}
+}
+
+func TestMinRateReader(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the client sends 1 byte, then stalls; at 100 bytes/s
+	// with a short grace period the read must time out
+	client.Write([]byte("x"))
+	body := &minRateReader{ReadCloser: conn, conn: conn, rate: 100, grace: 10 * time.Millisecond, start: time.Now()}
+	_, err = ioutil.ReadAll(body)
+	if !isTimeout(err) {
+		t.Errorf("Expected read to time out, got: %v", err)
+	}
+	if body.n != 1 {
+		t.Errorf("Expected 1 byte to be read, got %d", body.n)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	start := time.Unix(0, 0)
+	if got, want := deadline(start, time.Second, 2048, 1024), start.Add(3*time.Second); !got.Equal(want) {
+		t.Errorf("Expected deadline %v, got %v", want, got)
+	}
+}
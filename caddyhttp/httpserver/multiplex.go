@@ -0,0 +1,302 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Multiplex says how a server sniffs the first bytes of its
+// connections to serve other protocols on the same port. HTTP and
+// TLS connections are served by the server itself; connections of
+// other protocols are passed through to backends.
+type Multiplex struct {
+	// Routes pass connections that start with a prefix
+	// through to a backend; they are tried in order,
+	// before HTTP and TLS are recognized
+	Routes []MultiplexRoute
+
+	// Silent is the backend of connections on which the client
+	// sends nothing within Timeout, like SSH clients that wait
+	// for the server to speak first; empty closes them
+	Silent string
+
+	// Default is the backend of connections of any other
+	// protocol; empty closes them
+	Default string
+
+	// Timeout is how long to wait for the first bytes;
+	// 0 means DefaultMultiplexTimeout
+	Timeout time.Duration
+}
+
+// MultiplexRoute passes connections that start with Prefix
+// through to the TCP address Backend.
+type MultiplexRoute struct {
+	Prefix  string
+	Backend string
+}
+
+// DefaultMultiplexTimeout is how long multiplexed connections
+// have to send their first bytes by default.
+const DefaultMultiplexTimeout = 2 * time.Second
+
+// multiplex returns the multiplex settings of the sites in group,
+// or an error if sites that configure it disagree.
+func multiplex(group []*SiteConfig) (*Multiplex, error) {
+	var mux *Multiplex
+	var from *SiteConfig
+	for _, site := range group {
+		if site.Multiplex == nil {
+			continue
+		}
+		if from != nil && !reflect.DeepEqual(site.Multiplex, mux) {
+			return nil, fmt.Errorf("%s and %s: conflicting multiplex on the same address", from.Addr, site.Addr)
+		}
+		mux, from = site.Multiplex, site
+	}
+	return mux, nil
+}
+
+// The protocols a multiplexed connection can be sniffed as.
+const (
+	sniffUndecided = iota
+	sniffHTTP
+	sniffTLS
+	sniffRoute
+	sniffOther
+)
+
+// sniff returns the protocol of a connection that started with
+// data, and the route it matched, if any. It returns
+// sniffUndecided if more data is needed to tell.
+func (m *Multiplex) sniff(data []byte) (int, *MultiplexRoute) {
+	for i := range m.Routes {
+		prefix := []byte(m.Routes[i].Prefix)
+		if bytes.HasPrefix(data, prefix) {
+			return sniffRoute, &m.Routes[i]
+		}
+		if bytes.HasPrefix(prefix, data) {
+			return sniffUndecided, nil
+		}
+	}
+	if len(data) == 0 {
+		return sniffUndecided, nil
+	}
+	if data[0] == 0x16 { // TLS handshake record
+		return sniffTLS, nil
+	}
+	// HTTP/1.x requests start with a method token and a space
+	for i, b := range data {
+		switch {
+		case b >= 'A' && b <= 'Z':
+			if i >= maxMethodLength {
+				return sniffOther, nil
+			}
+		case b == ' ' && i >= 3:
+			return sniffHTTP, nil
+		default:
+			return sniffOther, nil
+		}
+	}
+	return sniffUndecided, nil
+}
+
+// maxMethodLength is the length of the longest HTTP
+// method that multiplexed connections may start with.
+const maxMethodLength = 16
+
+// maxSniffLength is the most bytes read from a
+// connection to tell its protocol.
+const maxSniffLength = 256
+
+// muxListener sniffs the connections accepted from a listener
+// and dispatches them to the sub-listeners for the protocols
+// the server serves, or passes them through to backends.
+type muxListener struct {
+	net.Listener
+	mux       *Multiplex
+	tlsServer bool
+
+	serve chan net.Conn // connections of the server's own protocol
+	plain chan net.Conn // plaintext HTTP on a TLS server
+
+	done chan struct{}
+	err  error // why accepting stopped; set before done is closed
+	once sync.Once
+}
+
+// newMuxListener starts accepting connections from ln and
+// sniffing them as configured by mux. tlsServer is whether
+// the server is served over TLS.
+func newMuxListener(ln net.Listener, mux *Multiplex, tlsServer bool) *muxListener {
+	m := &muxListener{
+		Listener:  ln,
+		mux:       mux,
+		tlsServer: tlsServer,
+		serve:     make(chan net.Conn),
+		plain:     make(chan net.Conn),
+		done:      make(chan struct{}),
+	}
+	go m.acceptLoop()
+	return m
+}
+
+// Serving returns the listener of the connections of the
+// server's protocol: TLS if it is served over TLS, or
+// plaintext HTTP otherwise.
+func (m *muxListener) Serving() net.Listener {
+	return muxSubListener{muxListener: m, conns: m.serve}
+}
+
+// Plaintext returns the listener of plaintext HTTP connections
+// to a server that is served over TLS.
+func (m *muxListener) Plaintext() net.Listener {
+	return muxSubListener{muxListener: m, conns: m.plain}
+}
+
+func (m *muxListener) acceptLoop() {
+	for {
+		c, err := m.Listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+			m.stop(err)
+			return
+		}
+		go m.dispatch(c)
+	}
+}
+
+// stop stops dispatching connections because of err.
+func (m *muxListener) stop(err error) {
+	m.once.Do(func() {
+		m.err = err
+		close(m.done)
+	})
+}
+
+// Close closes the listener and stops dispatching connections.
+func (m *muxListener) Close() error {
+	err := m.Listener.Close()
+	m.stop(fmt.Errorf("use of closed network connection"))
+	return err
+}
+
+// dispatch sniffs the protocol of c and sends it where it goes.
+func (m *muxListener) dispatch(c net.Conn) {
+	timeout := m.mux.Timeout
+	if timeout == 0 {
+		timeout = DefaultMultiplexTimeout
+	}
+	sc := &sniffedConn{Conn: c, r: bufio.NewReaderSize(c, maxSniffLength)}
+
+	c.SetReadDeadline(time.Now().Add(timeout))
+	var proto int
+	var route *MultiplexRoute
+	for {
+		data, _ := sc.r.Peek(sc.r.Buffered())
+		proto, route = m.mux.sniff(data)
+		if proto == sniffUndecided && len(data) >= maxSniffLength {
+			proto = sniffOther
+		}
+		if proto != sniffUndecided {
+			break
+		}
+		// wait for more data
+		if _, err := sc.r.Peek(len(data) + 1); err != nil {
+			if len(data) == 0 && isTimeout(err) && m.mux.Silent != "" {
+				c.SetReadDeadline(time.Time{})
+				passThrough(sc, m.mux.Silent)
+				return
+			}
+			if len(data) == 0 || !isTimeout(err) {
+				c.Close()
+				return
+			}
+			proto = sniffOther
+			break
+		}
+	}
+	c.SetReadDeadline(time.Time{})
+
+	switch {
+	case proto == sniffRoute:
+		passThrough(sc, route.Backend)
+	case proto == sniffTLS && m.tlsServer, proto == sniffHTTP && !m.tlsServer:
+		m.deliver(m.serve, sc)
+	case proto == sniffHTTP:
+		m.deliver(m.plain, sc)
+	case m.mux.Default != "":
+		passThrough(sc, m.mux.Default)
+	default:
+		c.Close()
+	}
+}
+
+// deliver hands c to the sub-listener that accepts from conns.
+func (m *muxListener) deliver(conns chan net.Conn, c net.Conn) {
+	select {
+	case conns <- c:
+	case <-m.done:
+		c.Close()
+	}
+}
+
+// muxSubListener accepts the connections of one
+// protocol that a muxListener dispatches.
+type muxSubListener struct {
+	*muxListener
+	conns chan net.Conn
+}
+
+// Accept waits for the next connection of the protocol.
+func (ln muxSubListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-ln.conns:
+		return c, nil
+	case <-ln.done:
+		return nil, ln.err
+	}
+}
+
+// sniffedConn is a connection whose first bytes
+// have been read into r to sniff its protocol.
+type sniffedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Read reads from the sniffed bytes first.
+func (c *sniffedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// passThrough copies data between c and a new
+// connection to the TCP address backend until
+// the backend is done responding.
+func passThrough(c net.Conn, backend string) {
+	defer c.Close()
+	bc, err := net.DialTimeout("tcp", backend, 10*time.Second)
+	if err != nil {
+		log.Printf("[ERROR] multiplex: connecting to %s: %v", backend, err)
+		return
+	}
+	defer bc.Close()
+
+	go func() {
+		io.Copy(bc, c)
+		if tc, ok := bc.(*net.TCPConn); ok {
+			tc.CloseWrite()
+		}
+	}()
+	io.Copy(c, bc)
+}
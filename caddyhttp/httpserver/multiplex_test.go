@@ -0,0 +1,151 @@
+package httpserver
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMultiplexSniff(t *testing.T) {
+	mux := &Multiplex{Routes: []MultiplexRoute{
+		{Prefix: "SSH-", Backend: "ssh"},
+		{Prefix: "\x00\x0eOpenVPN", Backend: "vpn"},
+	}}
+	for i, test := range []struct {
+		data    string
+		proto   int
+		backend string
+	}{
+		{"", sniffUndecided, ""},
+		{"SS", sniffUndecided, ""},
+		{"SSH-2.0-OpenSSH_7.4\r\n", sniffRoute, "ssh"},
+		{"\x00\x0eOpen", sniffUndecided, ""},
+		{"\x00\x0eOpenVPN", sniffRoute, "vpn"},
+		{"\x00\x01", sniffOther, ""},
+		{"\x16\x03\x01\x02\x00", sniffTLS, ""},
+		{"GET / HTTP/1.1\r\n", sniffHTTP, ""},
+		{"OPTIONS * HTTP/1.1\r\n", sniffHTTP, ""},
+		{"PRI * HTTP/2.0\r\n", sniffHTTP, ""},
+		{"GE", sniffUndecided, ""},
+		{"GET", sniffUndecided, ""},
+		{"GO /", sniffOther, ""},
+		{"get / HTTP/1.1", sniffOther, ""},
+		{strings.Repeat("A", maxMethodLength+1), sniffOther, ""},
+	} {
+		proto, route := mux.sniff([]byte(test.data))
+		if proto != test.proto {
+			t.Errorf("Test %d: Expected protocol %d, got %d", i, test.proto, proto)
+		}
+		if (route == nil && test.backend != "") || (route != nil && route.Backend != test.backend) {
+			t.Errorf("Test %d: Expected backend '%s', got %+v", i, test.backend, route)
+		}
+	}
+}
+
+func TestMultiplexConflict(t *testing.T) {
+	a := &Multiplex{Default: ":9000"}
+	b := &Multiplex{Default: ":9000"}
+	mux, err := multiplex([]*SiteConfig{{Multiplex: a}, {}, {Multiplex: b}})
+	if err != nil || mux == nil || mux.Default != ":9000" {
+		t.Errorf("Expected the same settings to agree, got %+v, %v", mux, err)
+	}
+	if _, err := multiplex([]*SiteConfig{{Multiplex: a}, {Multiplex: &Multiplex{Default: ":9001"}}}); err == nil {
+		t.Error("Expected error for conflicting settings, got none")
+	}
+}
+
+func TestMuxListener(t *testing.T) {
+	// a backend that greets first, like an SSH server, then echoes a line
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		for {
+			c, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				c.Write([]byte("hello\n"))
+				line, _ := bufio.NewReader(c).ReadString('\n')
+				c.Write([]byte("echo " + line))
+			}(c)
+		}
+	}()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := newMuxListener(ln, &Multiplex{
+		Routes:  []MultiplexRoute{{Prefix: "SSH-", Backend: backend.Addr().String()}},
+		Silent:  backend.Addr().String(),
+		Timeout: 100 * time.Millisecond,
+	}, true)
+	defer mux.Close()
+	serving, plain := mux.Serving(), mux.Plaintext()
+
+	dial := func(data string) net.Conn {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+		c.Write([]byte(data))
+		return c
+	}
+	accept := func(ln net.Listener, expected string) {
+		c, err := ln.Accept()
+		if err != nil {
+			t.Fatalf("Expected to accept a connection, got: %v", err)
+		}
+		defer c.Close()
+		buf := make([]byte, len(expected))
+		if _, err := c.Read(buf); err != nil || string(buf) != expected {
+			t.Errorf("Expected to read '%s', got '%s' (%v)", expected, buf, err)
+		}
+	}
+
+	c := dial("\x16\x03\x01")
+	accept(serving, "\x16\x03\x01")
+	c.Close()
+
+	c = dial("GET / HTTP/1.1\r\n")
+	accept(plain, "GET ")
+	c.Close()
+
+	// clients that speak first and silent clients both reach the backend
+	for _, data := range []string{"SSH-2.0-test\n", ""} {
+		c = dial(data)
+		r := bufio.NewReader(c)
+		if line, _ := r.ReadString('\n'); line != "hello\n" {
+			t.Errorf("Expected backend greeting, got '%s'", line)
+		}
+		if data == "" {
+			c.Write([]byte("late\n"))
+			data = "late\n"
+		}
+		if line, _ := r.ReadString('\n'); line != "echo "+data {
+			t.Errorf("Expected echo of '%s', got '%s'", data, line)
+		}
+		c.Close()
+	}
+
+	// other protocols are closed without a default backend
+	c = dial("\x00\x01\x02\x03")
+	if data, _ := ioutil.ReadAll(c); len(data) != 0 {
+		t.Errorf("Expected connection to be closed, got '%s'", data)
+	}
+	c.Close()
+
+	ln.Close()
+	if _, err := serving.Accept(); !isClosedErr(err) {
+		t.Errorf("Expected closed error after closing the listener, got: %v", err)
+	}
+}
@@ -61,6 +61,14 @@ type httpContext struct {
 
 	// siteConfigs is the master list of all site configs.
 	siteConfigs []*SiteConfig
+
+	// servers are the servers made from the site configs,
+	// whose sites may be replaced on reload.
+	servers []*Server
+
+	// running is the context whose sites the sites of a
+	// reload context start out as; nil otherwise.
+	running *httpContext
 }
 
 func (h *httpContext) saveConfig(key string, cfg *SiteConfig) {
@@ -100,6 +108,13 @@ func (h *httpContext) InspectServerBlocks(sourceFile string, serverBlocks []cadd
 				TLS:         &caddytls.Config{Hostname: addr.Host},
 				HiddenFiles: []string{sourceFile},
 			}
+			if h.running != nil {
+				running, ok := h.running.keysToSiteConfigs[key]
+				if !ok {
+					return serverBlocks, fmt.Errorf("%s is not running", key)
+				}
+				cfg = running.reloadCopy()
+			}
 			h.saveConfig(key, cfg)
 		}
 	}
@@ -116,6 +131,19 @@ func (h *httpContext) InspectServerBlocks(sourceFile string, serverBlocks []cadd
 		}
 	}
 
+	// Record the directives of each site, for diagnostics
+	for _, sb := range serverBlocks {
+		var names []string
+		for _, dir := range directives {
+			if _, ok := sb.Tokens[dir]; ok {
+				names = append(names, dir)
+			}
+		}
+		for _, key := range sb.Keys {
+			h.keysToSiteConfigs[strings.ToLower(key)].Directives = names
+		}
+	}
+
 	return serverBlocks, nil
 }
 
@@ -147,6 +175,12 @@ func (h *httpContext) MakeServers() ([]caddy.Server, error) {
 		}
 	}
 
+	// the global connection limit is shared by all servers,
+	// so all sites that set it must agree on it
+	if _, _, err := globalConnLimits(h.siteConfigs); err != nil {
+		return nil, err
+	}
+
 	// we must map (group) each config to a bind address
 	groups, err := groupSiteConfigsByListenAddr(h.siteConfigs)
 	if err != nil {
@@ -160,6 +194,7 @@ func (h *httpContext) MakeServers() ([]caddy.Server, error) {
 		if err != nil {
 			return nil, err
 		}
+		h.servers = append(h.servers, s)
 		servers = append(servers, s)
 	}
 
@@ -173,12 +208,13 @@ func GetConfig(c *caddy.Controller) *SiteConfig {
 	ctx := c.Context().(*httpContext)
 	key := strings.ToLower(c.Key)
 	if cfg, ok := ctx.keysToSiteConfigs[key]; ok {
+		cfg.directive = c.Directive()
 		return cfg
 	}
 	// we should only get here during tests because directive
 	// actions typically skip the server blocks where we make
 	// the configs
-	cfg := &SiteConfig{Root: Root, TLS: new(caddytls.Config)}
+	cfg := &SiteConfig{Root: Root, TLS: new(caddytls.Config), directive: c.Directive()}
 	ctx.saveConfig(key, cfg)
 	return cfg
 }
@@ -393,41 +429,88 @@ var directives = []string{
 	// primitive actions that set up the fundamental vitals of each config
 	"root",
 	"bind",
+	"listen",
+	"listener_options",
+	"vhost",
+	"default_server",
 	"maxrequestbody",
+	"limits",
+	"ranges",
+	"minrate",
+	"max_connections",
+	"keepalive",
+	"multiplex",
+	"tunnel", // before tls, so certificates can be obtained through the tunnel
 	"tls",
+	"matcher", // before the directives that refer to named matchers
 
 	// services/utilities, or other directives that don't necessarily inject handlers
 	"startup",
 	"shutdown",
 	"realip", // github.com/captncraig/caddy-realip
-	"git",    // github.com/abiosoft/caddy-git
+	"git",
 
 	// directives that add middleware to the stack
+	"real_ip",       // first, so all see the client's address
+	"early_hints",   // before any middleware that wraps the response
+	"server_timing", // early, so it times the rest of the chain
+	"normalize",
+	"host_check",
 	"locale", // github.com/simia-tech/caddy-locale
+	"lang",
+	"experiment",
+	"vars", // before log and rewrite, so they can use its placeholders
 	"log",
+	"well_known", // before the handlers that would pass them on
+	"notify",
+	"recent_requests",
+	"shed",
+	"schedule",
+	"assets",
+	"lua", // before rewrite, so scripts see the paths requested
 	"rewrite",
 	"ext",
+	"throttle",
+	"etag", // before gzip, so compressed responses are tagged apart
 	"gzip",
 	"header",
+	"expect_ct",
 	"errors",
+	"handle_errors",
+	"cron",      // maintenance, after errors so its pages apply
 	"minify",    // github.com/hacdias/caddy-minify
 	"ipfilter",  // github.com/pyed/ipfilter
 	"ratelimit", // github.com/xuqingfeng/caddy-rate-limit
 	"search",    // github.com/pedronasser/caddy-search
 	"expires",   // github.com/epicagency/caddy-expires
+	"oidc",
+	"saml",
+	"api_keys",
 	"basicauth",
 	"redir",
 	"status",
 	"cors", // github.com/captncraig/cors/caddy
 	"mime",
-	"jwt",       // github.com/BTBurke/caddy-jwt
+	"jwt", // github.com/BTBurke/caddy-jwt
+	"authz",
 	"jsonp",     // github.com/pschlump/caddy-jsonp
 	"upload",    // blitznote.com/src/caddy.upload
 	"multipass", // github.com/namsral/multipass/caddy
 	"internal",
+	"share",
+	"sitemap",
 	"pprof",
 	"expvar",
 	"prometheus", // github.com/miekg/caddy-prometheus
+	"graphql",
+	"transform",
+	"soap",
+	"debug",
+	"reload_admin",
+	"certs_admin",
+	"deploy",
+	"exec",
+	"proxy_admin",
 	"proxy",
 	"fastcgi",
 	"websocket",
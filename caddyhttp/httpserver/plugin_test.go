@@ -1,6 +1,7 @@
 package httpserver
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 
@@ -153,6 +154,25 @@ func TestInspectServerBlocksCaseInsensitiveKey(t *testing.T) {
 	}
 }
 
+func TestInspectServerBlocksDirectives(t *testing.T) {
+	filename := "Testfile"
+	ctx := newContext().(*httpContext)
+	input := strings.NewReader("a.example.com, b.example.com {\n proxy / localhost:8080\n gzip\n rewrite /a /b\n}")
+	sblocks, err := caddyfile.Parse(filename, input, nil)
+	if err != nil {
+		t.Fatalf("Expected no error setting up test, got: %v", err)
+	}
+	if _, err := ctx.InspectServerBlocks(filename, sblocks); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := []string{"rewrite", "gzip", "errors", "proxy"}
+	for _, key := range []string{"a.example.com", "b.example.com"} {
+		if got := ctx.keysToSiteConfigs[key].Directives; !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected directives of %s to be %v, got %v", key, expected, got)
+		}
+	}
+}
+
 func TestGetConfig(t *testing.T) {
 	// case insensitivity for key
 	con := caddy.NewTestController("http", "")
@@ -2,6 +2,7 @@ package httpserver
 
 import (
 	"bufio"
+	"io"
 	"net"
 	"net/http"
 	"time"
@@ -58,6 +59,21 @@ func (r *ResponseRecorder) Write(buf []byte) (int, error) {
 	return n, err
 }
 
+// ReadFrom copies the body from src, with zero-copy
+// system calls like sendfile where the platform and
+// the underlying ResponseWriter allow.
+func (r *ResponseRecorder) ReadFrom(src io.Reader) (int64, error) {
+	var n int64
+	var err error
+	if rf, ok := r.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(r.ResponseWriter, src)
+	}
+	r.size += int(n)
+	return n, err
+}
+
 // Size is a Getter to size property
 func (r *ResponseRecorder) Size() int {
 	return r.size
@@ -3,6 +3,7 @@ package httpserver
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -38,3 +39,18 @@ func TestWrite(t *testing.T) {
 		t.Fatalf("Expected Response Body to be %s , but found %s\n", responseTestString, w.Body.String())
 	}
 }
+
+func TestReadFrom(t *testing.T) {
+	w := httptest.NewRecorder()
+	recordRequest := NewResponseRecorder(w)
+	n, err := recordRequest.ReadFrom(strings.NewReader("test body"))
+	if err != nil || n != 9 {
+		t.Fatalf("Expected 9 bytes copied, got %d (%v)", n, err)
+	}
+	if recordRequest.Size() != 9 {
+		t.Errorf("Expected the bytes written counter to be 9, but instead found %d", recordRequest.Size())
+	}
+	if w.Body.String() != "test body" {
+		t.Errorf("Expected Response Body to be 'test body', but found %s", w.Body.String())
+	}
+}
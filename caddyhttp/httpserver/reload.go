@@ -0,0 +1,139 @@
+package httpserver
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mholt/caddy"
+)
+
+// ReplaceSites implements caddy.InPlaceReloader. Every site of
+// servers must already be served by one of the servers made by h,
+// at the same address and with the same server settings, so that
+// only its middleware changes.
+func (h *httpContext) ReplaceSites(servers []caddy.Server) (func(), error) {
+	replacements := make(map[*Server]map[*SiteConfig]*SiteConfig)
+	for _, srv := range servers {
+		newServer, ok := srv.(*Server)
+		if !ok {
+			return nil, fmt.Errorf("unexpected server type %T", srv)
+		}
+		var running *Server
+		for _, s := range h.servers {
+			if s.Server.Addr == newServer.Server.Addr {
+				running = s
+				break
+			}
+		}
+		if running == nil {
+			return nil, fmt.Errorf("no server is listening on %s", newServer.Server.Addr)
+		}
+
+		sites := make(map[*SiteConfig]*SiteConfig)
+		for _, site := range newServer.sites {
+			old := running.site(site.Addr)
+			if old == nil {
+				return nil, fmt.Errorf("%s is not served on %s", site.Addr, newServer.Server.Addr)
+			}
+			if err := sameServerSettings(old, site); err != nil {
+				return nil, fmt.Errorf("%s: %v", site.Addr, err)
+			}
+			sites[old] = site
+		}
+		replacements[running] = sites
+	}
+
+	return func() {
+		for s, sites := range replacements {
+			s.replaceSites(sites)
+		}
+	}, nil
+}
+
+// ReloadContext implements caddy.InPlaceReloader.
+func (h *httpContext) ReloadContext() caddy.Context {
+	return &httpContext{keysToSiteConfigs: make(map[string]*SiteConfig), running: h}
+}
+
+// reloadCopy returns a copy of s without the middleware and
+// named matchers of the directives that are reloaded in place,
+// for them to be set up on it again. What the other directives
+// set up, like its TLS config, is that of s.
+func (s *SiteConfig) reloadCopy() *SiteConfig {
+	cfg := *s
+	cfg.middleware, cfg.middlewareDirectives = nil, nil
+	for i, m := range s.middleware {
+		if !caddy.DirectiveReloadsInPlace("http", s.middlewareDirectives[i]) {
+			cfg.middleware = append(cfg.middleware, m)
+			cfg.middlewareDirectives = append(cfg.middlewareDirectives, s.middlewareDirectives[i])
+		}
+	}
+	cfg.middlewareChain = nil
+	cfg.matchers = nil
+	cfg.connLimiter = nil
+	return &cfg
+}
+
+// sameServerSettings returns an error if the settings of site that
+// its server applies differ from those of old, or it has additional
+// listeners, which are only opened when a server starts.
+func sameServerSettings(old, site *SiteConfig) error {
+	if len(old.listenerFuncs) > 0 || len(site.listenerFuncs) > 0 {
+		return fmt.Errorf("sites with additional listeners must be restarted")
+	}
+	if old.ListenHost != site.ListenHost ||
+		tlsEnabled(old) != tlsEnabled(site) ||
+		old.HostPriority != site.HostPriority ||
+		fmt.Sprint(old.HostRegexp) != fmt.Sprint(site.HostRegexp) ||
+		old.RequestLimits != site.RequestLimits ||
+		old.MinRates != site.MinRates ||
+		old.ConnLimits != site.ConnLimits ||
+		!reflect.DeepEqual(old.KeepAlive, site.KeepAlive) ||
+		old.ListenerOptions != site.ListenerOptions ||
+		!reflect.DeepEqual(old.DefaultServer, site.DefaultServer) ||
+		!reflect.DeepEqual(old.Multiplex, site.Multiplex) {
+		return fmt.Errorf("server settings changed")
+	}
+	return nil
+}
+
+// tlsEnabled returns whether site is served over TLS.
+func tlsEnabled(site *SiteConfig) bool {
+	return site.TLS != nil && site.TLS.Enabled
+}
+
+// site returns the site of s at addr, or nil if there is none.
+func (s *Server) site(addr Address) *SiteConfig {
+	s.sitesMu.RLock()
+	defer s.sitesMu.RUnlock()
+	for _, site := range s.sites {
+		if site.Addr == addr {
+			return site
+		}
+	}
+	return nil
+}
+
+// replaceSites makes s serve the new site of each old site in
+// sites instead of it. Requests being served are not affected.
+func (s *Server) replaceSites(sites map[*SiteConfig]*SiteConfig) {
+	s.sitesMu.Lock()
+	defer s.sitesMu.Unlock()
+
+	newSites := make([]*SiteConfig, len(s.sites))
+	vhosts := newVHostTrie()
+	for i, site := range s.sites {
+		if replacement, ok := sites[site]; ok {
+			// keep counting the connections the site has
+			replacement.connLimiter = site.connLimiter
+			if s.defaultSite == site {
+				s.defaultSite = replacement
+			}
+			site = replacement
+		}
+		newSites[i] = site
+		vhosts.Insert(site.Addr.VHost(), site)
+	}
+	s.sites = newSites
+	s.vhosts = vhosts
+}
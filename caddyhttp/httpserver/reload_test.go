@@ -0,0 +1,153 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyfile"
+)
+
+func init() {
+	// stand-ins for plugins, which are not imported here
+	noop := func(*caddy.Controller) error { return nil }
+	caddy.RegisterPlugin("gzip", caddy.Plugin{ServerType: "http", Action: noop})
+	caddy.RegisterPlugin("header", caddy.Plugin{ServerType: "http", Action: noop, ReloadInPlace: true})
+	caddy.RegisterPlugin("errors", caddy.Plugin{ServerType: "http", Action: noop})
+}
+
+func TestReplaceSites(t *testing.T) {
+	newSite := func(host, body string) *SiteConfig {
+		return &SiteConfig{
+			Addr: Address{Original: host, Host: host, Port: "80"},
+			middleware: []Middleware{func(Handler) Handler {
+				return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+					w.Write([]byte(body))
+					return 0, nil
+				})
+			}},
+		}
+	}
+	get := func(s *Server, host string) string {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "http://"+host+"/", nil))
+		return w.Body.String()
+	}
+
+	running, err := NewServer(":80", []*SiteConfig{newSite("a.com", "a1"), newSite("b.com", "b1")})
+	if err != nil {
+		t.Fatalf("Expected no error creating server, got: %v", err)
+	}
+	h := &httpContext{servers: []*Server{running}}
+
+	newServer, err := NewServer(":80", []*SiteConfig{newSite("b.com", "b2")})
+	if err != nil {
+		t.Fatalf("Expected no error creating server, got: %v", err)
+	}
+	replace, err := h.ReplaceSites([]caddy.Server{newServer})
+	if err != nil {
+		t.Fatalf("Expected no error replacing sites, got: %v", err)
+	}
+	if got := get(running, "b.com"); got != "b1" {
+		t.Errorf("Expected site to be served until replaced, got: %s", got)
+	}
+	replace()
+	if got := get(running, "a.com"); got != "a1" {
+		t.Errorf("Expected unchanged site to be served as before, got: %s", got)
+	}
+	if got := get(running, "b.com"); got != "b2" {
+		t.Errorf("Expected replaced site to be served by its new middleware, got: %s", got)
+	}
+
+	// sites that cannot be replaced
+	for i, site := range []*SiteConfig{
+		newSite("c.com", "c"),
+		func() *SiteConfig {
+			site := newSite("a.com", "a2")
+			site.ListenHost = "127.0.0.1"
+			return site
+		}(),
+		func() *SiteConfig {
+			site := newSite("a.com", "a2")
+			site.DefaultServer = &DefaultServer{Mode: DefaultServerClose}
+			return site
+		}(),
+	} {
+		s, err := NewServer(":80", []*SiteConfig{site})
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error creating server, got: %v", i, err)
+		}
+		if _, err := h.ReplaceSites([]caddy.Server{s}); err == nil {
+			t.Errorf("Test %d: Expected error replacing sites, got none", i)
+		}
+	}
+
+	s, err := NewServer(":8080", []*SiteConfig{newSite("a.com", "a2")})
+	if err != nil {
+		t.Fatalf("Expected no error creating server, got: %v", err)
+	}
+	if _, err := h.ReplaceSites([]caddy.Server{s}); err == nil {
+		t.Errorf("Expected error replacing sites of a server that is not running, got none")
+	}
+}
+
+func TestReloadContext(t *testing.T) {
+	type label string
+	add := func(site *SiteConfig, directive string, l label) {
+		site.directive = directive
+		site.AddMiddleware(func(Handler) Handler {
+			return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				w.Write([]byte(l))
+				return 0, nil
+			})
+		})
+	}
+	labels := func(site *SiteConfig) string {
+		var all string
+		for _, m := range site.middleware {
+			w := httptest.NewRecorder()
+			m(nil).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			all += w.Body.String()
+		}
+		return all
+	}
+
+	running := &SiteConfig{Addr: Address{Original: "a.com", Host: "a.com", Scheme: "https", Port: "443"}, Root: "/srv"}
+	add(running, "gzip", "g1")
+	add(running, "header", "h1")
+	add(running, "errors", "e1")
+	running.matchers = map[string]*Matcher{"m": {Name: "m"}}
+	h := &httpContext{keysToSiteConfigs: map[string]*SiteConfig{"a.com": running}}
+
+	reload := h.ReloadContext().(*httpContext)
+	blocks := []caddyfile.ServerBlock{{Keys: []string{"a.com"}, Tokens: map[string][]caddyfile.Token{}}}
+	if _, err := reload.InspectServerBlocks("Caddyfile", blocks); err != nil {
+		t.Fatalf("Expected no error inspecting server blocks, got: %v", err)
+	}
+	site := reload.keysToSiteConfigs["a.com"]
+	if site == running {
+		t.Fatal("Expected a copy of the running site")
+	}
+	if site.Addr != running.Addr || site.Root != running.Root {
+		t.Errorf("Expected the settings of the running site, got address %v and root %s", site.Addr, site.Root)
+	}
+	if site.matchers != nil {
+		t.Errorf("Expected named matchers to be defined again, got: %v", site.matchers)
+	}
+	if got := labels(site); got != "g1e1" {
+		t.Errorf("Expected only the middleware of directives not reloaded in place, got: %s", got)
+	}
+	add(site, "header", "h2")
+	if got := labels(site); got != "g1h2e1" {
+		t.Errorf("Expected middleware set up again in the order of the directives, got: %s", got)
+	}
+	if got := labels(running); got != "g1h1e1" {
+		t.Errorf("Expected the running site to be unchanged, got: %s", got)
+	}
+
+	blocks = []caddyfile.ServerBlock{{Keys: []string{"b.com"}, Tokens: map[string][]caddyfile.Token{}}}
+	if _, err := h.ReloadContext().InspectServerBlocks("Caddyfile", blocks); err == nil {
+		t.Error("Expected error inspecting a server block that is not running, got none")
+	}
+}
@@ -2,6 +2,8 @@ package httpserver
 
 import (
 	"bytes"
+	"context"
+	"crypto/x509"
 	"io"
 	"io/ioutil"
 	"net"
@@ -13,6 +15,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/mholt/caddy/caddytls"
 )
 
 // requestReplacer is a strings.Replacer which is used to
@@ -91,13 +95,58 @@ func NewReplacer(r *http.Request, rr *ResponseRecorder, emptyValue string) Repla
 			io.Closer
 		}{io.TeeReader(r.Body, rb), io.Closer(r.Body)}
 	}
-	return &replacer{
+	rep := &replacer{
 		request:            r,
 		requestBody:        rb,
 		responseRecorder:   rr,
 		customReplacements: make(map[string]string),
 		emptyValue:         emptyValue,
 	}
+	if values, ok := r.Context().Value(placeholdersCtxKey).(map[string]string); ok {
+		for key, value := range values {
+			rep.customReplacements[key] = value
+		}
+	}
+	return rep
+}
+
+// ctxKey is the type of context keys used by this package.
+type ctxKey string
+
+// placeholdersCtxKey is the context key under which the custom
+// placeholder values of a request are stored.
+const placeholdersCtxKey ctxKey = "placeholders"
+
+// SetRequestPlaceholder sets the placeholder {key} to value for
+// the lifetime of r, so that replacers created for r further down
+// the middleware chain can substitute it. It returns the request
+// carrying the value, which should be passed to the next handler.
+func SetRequestPlaceholder(r *http.Request, key, value string) *http.Request {
+	if values, ok := r.Context().Value(placeholdersCtxKey).(map[string]string); ok {
+		values["{"+key+"}"] = value
+		return r
+	}
+	values := map[string]string{"{" + key + "}": value}
+	return r.WithContext(context.WithValue(r.Context(), placeholdersCtxKey, values))
+}
+
+// WithRequestPlaceholders returns r ready to carry custom
+// placeholders, so that the values set for it further down the
+// middleware chain can be read with RequestPlaceholder once the
+// request has been served.
+func WithRequestPlaceholders(r *http.Request) *http.Request {
+	if _, ok := r.Context().Value(placeholdersCtxKey).(map[string]string); ok {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), placeholdersCtxKey, make(map[string]string)))
+}
+
+// RequestPlaceholder returns the value of the placeholder {key}
+// set for r with SetRequestPlaceholder, and whether it is set.
+func RequestPlaceholder(r *http.Request, key string) (string, bool) {
+	values, _ := r.Context().Value(placeholdersCtxKey).(map[string]string)
+	value, ok := values["{"+key+"}"]
+	return value, ok
 }
 
 func canLogRequest(r *http.Request) bool {
@@ -232,6 +281,40 @@ func (r *replacer) getSubstitution(key string) string {
 		return r.request.URL.Fragment
 	case "{proto}":
 		return r.request.Proto
+	case "{tls_protocol}":
+		if r.request.TLS == nil {
+			return r.emptyValue
+		}
+		return caddytls.ProtocolName(r.request.TLS.Version)
+	case "{tls_cipher}":
+		if r.request.TLS == nil {
+			return r.emptyValue
+		}
+		return caddytls.CipherName(r.request.TLS.CipherSuite)
+	case "{tls_sni}":
+		if r.request.TLS == nil {
+			return r.emptyValue
+		}
+		return r.request.TLS.ServerName
+	case "{tls_client_cert}":
+		return strconv.FormatBool(clientCert(r.request) != nil)
+	case "{tls_client_verified}":
+		return strconv.FormatBool(r.request.TLS != nil && len(r.request.TLS.VerifiedChains) > 0)
+	case "{tls_client_subject}":
+		if cert := clientCert(r.request); cert != nil {
+			return cert.Subject.CommonName
+		}
+		return r.emptyValue
+	case "{tls_client_issuer}":
+		if cert := clientCert(r.request); cert != nil {
+			return cert.Issuer.CommonName
+		}
+		return r.emptyValue
+	case "{tls_client_serial}":
+		if cert := clientCert(r.request); cert != nil {
+			return cert.SerialNumber.String()
+		}
+		return r.emptyValue
 	case "{remote}":
 		host, _, err := net.SplitHostPort(r.request.RemoteAddr)
 		if err != nil {
@@ -296,9 +379,31 @@ func (r *replacer) getSubstitution(key string) string {
 		return strconv.FormatInt(convertToMilliseconds(elapsedDuration), 10)
 	}
 
+	// {labelN} is the Nth label of the requested host, from the left
+	if strings.HasPrefix(key, "{label") {
+		if n, err := strconv.Atoi(key[6 : len(key)-1]); err == nil && n > 0 {
+			host, _, err := net.SplitHostPort(r.request.Host)
+			if err != nil {
+				host = r.request.Host
+			}
+			if labels := strings.Split(strings.ToLower(host), "."); n <= len(labels) {
+				return labels[n-1]
+			}
+		}
+	}
+
 	return r.emptyValue
 }
 
+// clientCert returns the certificate the client of r
+// presented during the TLS handshake, or nil if none.
+func clientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
 //convertToMilliseconds returns the number of milliseconds in the given duration
 func convertToMilliseconds(d time.Duration) int64 {
 	return d.Nanoseconds() / 1e6
@@ -1,6 +1,10 @@
 package httpserver
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -131,6 +135,88 @@ func TestSet(t *testing.T) {
 	}
 }
 
+func TestSetRequestPlaceholder(t *testing.T) {
+	request, err := http.NewRequest("GET", "http://localhost", nil)
+	if err != nil {
+		t.Fatalf("Request Formation Failed: %s\n", err.Error())
+	}
+	request = SetRequestPlaceholder(request, "lang", "de")
+	request = SetRequestPlaceholder(request, "variant", "b")
+
+	repl := NewReplacer(request, nil, "")
+	if got, want := repl.Replace("{lang}/{variant}"), "de/b"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	repl.Set("lang", "fr")
+	if got, want := repl.Replace("{lang}"), "fr"; got != want {
+		t.Errorf("Expected Set to override request placeholder; expected %q, got %q", want, got)
+	}
+}
+
+func TestReplaceTLS(t *testing.T) {
+	request, err := http.NewRequest("GET", "https://localhost/admin", nil)
+	if err != nil {
+		t.Fatalf("Request Formation Failed: %s\n", err.Error())
+	}
+
+	// without TLS
+	repl := NewReplacer(request, nil, "-")
+	for placeholder, expected := range map[string]string{
+		"{tls_protocol}":        "-",
+		"{tls_sni}":             "-",
+		"{tls_client_cert}":     "false",
+		"{tls_client_verified}": "false",
+		"{tls_client_subject}":  "-",
+	} {
+		if actual := repl.Replace(placeholder); actual != expected {
+			t.Errorf("Without TLS: Expected %s to be '%s', got '%s'", placeholder, expected, actual)
+		}
+	}
+
+	// with a verified client certificate
+	cert := &x509.Certificate{
+		Subject:      pkix.Name{CommonName: "alice"},
+		Issuer:       pkix.Name{CommonName: "Example CA"},
+		SerialNumber: big.NewInt(1234),
+	}
+	request.TLS = &tls.ConnectionState{
+		Version:          tls.VersionTLS12,
+		CipherSuite:      tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		ServerName:       "example.com",
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	repl = NewReplacer(request, nil, "-")
+	for placeholder, expected := range map[string]string{
+		"{tls_protocol}":        "tls1.2",
+		"{tls_cipher}":          "ECDHE-RSA-AES128-GCM-SHA256",
+		"{tls_sni}":             "example.com",
+		"{tls_client_cert}":     "true",
+		"{tls_client_verified}": "true",
+		"{tls_client_subject}":  "alice",
+		"{tls_client_issuer}":   "Example CA",
+		"{tls_client_serial}":   "1234",
+	} {
+		if actual := repl.Replace(placeholder); actual != expected {
+			t.Errorf("With TLS: Expected %s to be '%s', got '%s'", placeholder, expected, actual)
+		}
+	}
+
+	// the placeholders can be used in 'if' conditions
+	ifc, err := newIfCond("{tls_client_verified}", "is", "true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ifc.True(request) {
+		t.Error("Expected condition on verified client to be true")
+	}
+	request.TLS.VerifiedChains = nil
+	if ifc.True(request) {
+		t.Error("Expected condition on unverified client to be false")
+	}
+}
+
 func TestRound(t *testing.T) {
 	var tests = map[time.Duration]time.Duration{
 		// 599.935µs -> 560µs
@@ -168,3 +254,20 @@ func TestMillisecondConverstion(t *testing.T) {
 		}
 	}
 }
+
+func TestReplaceLabels(t *testing.T) {
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Host = "Www.Example.com:8080"
+	repl := NewReplacer(request, nil, "-")
+	for placeholder, expect := range map[string]string{
+		"{label1}": "www",
+		"{label3}": "com",
+		"{label4}": "-",
+		"{label0}": "-",
+		"{labelx}": "-",
+	} {
+		if got := repl.Replace(placeholder); got != expect {
+			t.Errorf("Expected %s to be '%s', got '%s'", placeholder, expect, got)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package httpserver
 import (
 	"io"
 	"strconv"
+	"sync"
 
 	"github.com/mholt/caddy"
 
@@ -20,15 +21,39 @@ type LogRoller struct {
 
 // GetLogWriter returns an io.Writer that writes to a rolling logger.
 func (l LogRoller) GetLogWriter() io.Writer {
-	return &lumberjack.Logger{
+	logger := &lumberjack.Logger{
 		Filename:   l.Filename,
 		MaxSize:    l.MaxSize,
 		MaxAge:     l.MaxAge,
 		MaxBackups: l.MaxBackups,
 		LocalTime:  l.LocalTime,
 	}
+	rollingLogsMu.Lock()
+	rollingLogs[l.Filename] = logger
+	rollingLogsMu.Unlock()
+	return logger
 }
 
+// RotateLogs rolls over the logs written by rolling loggers,
+// which then start writing to new, empty files.
+func RotateLogs() error {
+	rollingLogsMu.Lock()
+	defer rollingLogsMu.Unlock()
+	var firstErr error
+	for _, logger := range rollingLogs {
+		if err := logger.Rotate(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// rollingLogs are the latest rolling loggers, by file name.
+var (
+	rollingLogs   = make(map[string]*lumberjack.Logger)
+	rollingLogsMu sync.Mutex
+)
+
 // ParseRoller parses roller contents out of c.
 func ParseRoller(c *caddy.Controller) (*LogRoller, error) {
 	var size, age, keep int
@@ -2,7 +2,9 @@
 package httpserver
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -28,10 +30,24 @@ type Server struct {
 	listener    net.Listener
 	listenerMu  sync.Mutex
 	sites       []*SiteConfig
+	sitesMu     sync.RWMutex   // protects sites, vhosts and defaultSite on reload
 	connTimeout time.Duration  // max time to wait for a connection before force stop
 	connWg      sync.WaitGroup // one increment per connection
 	tlsGovChan  chan struct{}  // close to stop the TLS maintenance goroutine
 	vhosts      *vhostTrie
+	conns       *connTracker      // nil unless minimum transfer rates are enforced
+	connLimiter *connLimiter      // nil unless there is a global connection limit
+	connQueue   time.Duration     // how long connections over the global limit wait
+	siteConns   *siteConnTracker  // nil unless a site limits its connections
+	keepAlives  *keepAliveTracker // nil unless a site tunes keep-alive
+	handshakes  *handshakeTracker // nil unless a site reports TLS handshake times
+	extraLns    []net.Listener    // additional listeners opened by sites
+	framing     bool              // whether request framing is checked
+
+	defaultServer *DefaultServer // handles requests for no site; may be nil
+	defaultSite   *SiteConfig    // the site of a DefaultServerSite
+	listenerOpts  ListenerOptions
+	multiplex     *Multiplex // sniffs the protocols of connections; may be nil
 }
 
 // ensure it satisfies the interface
@@ -54,6 +70,21 @@ func NewServer(addr string, group []*SiteConfig) (*Server, error) {
 	}
 	s.Server.Handler = s // this is weird, but whatever
 	s.Server.ConnState = func(c net.Conn, cs http.ConnState) {
+		if s.conns != nil {
+			s.conns.connState(c, cs)
+		}
+		if s.keepAlives != nil {
+			s.keepAlives.connState(c, cs)
+		}
+		if s.handshakes != nil {
+			s.handshakes.connState(c, cs)
+		}
+		if s.siteConns != nil {
+			s.siteConns.connState(c, cs)
+		}
+		if s.framing {
+			framingConnState(c, cs)
+		}
 		if cs == http.StateIdle {
 			s.listenerMu.Lock()
 			// server stopped, close idle connection
@@ -99,9 +130,104 @@ func NewServer(addr string, group []*SiteConfig) (*Server, error) {
 		s.Server.TLSConfig.NextProtos = []string{"h2"}
 	}
 
+	// If every site limits the URI and header size, there is no
+	// reason for the server to read more than the largest of them
+	var maxHeaderBytes int64
+	for _, site := range group {
+		limits := site.RequestLimits
+		if limits.URILength == 0 || limits.HeaderBytes == 0 {
+			maxHeaderBytes = 0
+			break
+		}
+		if size := limits.URILength + limits.HeaderBytes; size > maxHeaderBytes {
+			maxHeaderBytes = size
+		}
+	}
+	if maxHeaderBytes > 0 {
+		s.Server.MaxHeaderBytes = int(maxHeaderBytes)
+	}
+
+	// The header timeout applies before we know which site a request
+	// is for, so it's only enforced if every site has one, in which
+	// case the most lenient one is used
+	var headerTimeout time.Duration
+	for _, site := range group {
+		if site.MinRates.HeaderTimeout == 0 {
+			headerTimeout = 0
+			break
+		}
+		if site.MinRates.HeaderTimeout > headerTimeout {
+			headerTimeout = site.MinRates.HeaderTimeout
+		}
+	}
+	var enforceRates bool
+	for _, site := range group {
+		if site.MinRates.Upload > 0 || site.MinRates.Download > 0 {
+			enforceRates = true
+		}
+	}
+	if headerTimeout > 0 || enforceRates {
+		s.conns = newConnTracker(headerTimeout)
+	}
+
+	// Set up connection limits; the global limit is shared by
+	// all servers, while other limits apply per site
+	globalMax, globalTimeout, err := globalConnLimits(group)
+	if err != nil {
+		return nil, err
+	}
+	if globalMax > 0 {
+		s.connLimiter = getGlobalConnLimiter(globalMax)
+		s.connQueue = globalTimeout
+	}
+	for _, site := range group {
+		if site.ConnLimits.Total > 0 || site.ConnLimits.PerIP > 0 {
+			site.connLimiter = newConnLimiter(site.ConnLimits.Total, site.ConnLimits.PerIP)
+			if s.siteConns == nil {
+				s.siteConns = newSiteConnTracker()
+			}
+		}
+	}
+
+	for _, site := range group {
+		if !site.KeepAlive.isZero() {
+			s.keepAlives = newKeepAliveTracker()
+			break
+		}
+	}
+
+	for _, site := range group {
+		if site.StrictFraming {
+			s.framing = true
+			break
+		}
+	}
+
+	for _, site := range group {
+		if site.TimeTLSHandshakes && site.TLS != nil && site.TLS.Enabled {
+			s.handshakes = newHandshakeTracker()
+			break
+		}
+	}
+
+	s.listenerOpts, err = listenerOptions(group)
+	if err != nil {
+		return nil, err
+	}
+
+	s.defaultSite, s.defaultServer, err = defaultServer(group)
+	if err != nil {
+		return nil, err
+	}
+
+	s.multiplex, err = multiplex(group)
+	if err != nil {
+		return nil, err
+	}
+
 	// Compile custom middleware for every site (enables virtual hosting)
 	for _, site := range group {
-		stack := Handler(staticfiles.FileServer{Root: http.Dir(site.Root), Hide: site.HiddenFiles})
+		stack := Handler(staticfiles.FileServer{Root: site.FileSystem(), Hide: site.HiddenFiles, Ranges: site.Ranges})
 		for i := len(site.middleware) - 1; i >= 0; i-- {
 			stack = site.middleware[i](stack)
 		}
@@ -126,7 +252,13 @@ func (s *Server) Listen() (net.Listener, error) {
 		return nil, fmt.Errorf("Server field is nil")
 	}
 
-	ln, err := net.Listen("tcp", s.Server.Addr)
+	opts := s.listenerOpts
+	if caddy.WorkerID() > 0 {
+		// worker processes share their listeners
+		opts.ReusePort = true
+	}
+
+	ln, err := listen(s.Server.Addr, opts)
 	if err != nil {
 		var succeeded bool
 		if runtime.GOOS == "windows" {
@@ -135,7 +267,7 @@ func (s *Server) Listen() (net.Listener, error) {
 			// in succession. TODO: Better way to handle this? And why limit this to Windows?
 			for i := 0; i < 20; i++ {
 				time.Sleep(100 * time.Millisecond)
-				ln, err = net.Listen("tcp", s.Server.Addr)
+				ln, err = listen(s.Server.Addr, opts)
 				if err == nil {
 					succeeded = true
 					break
@@ -158,7 +290,7 @@ func (s *Server) ListenPacket() (net.PacketConn, error) { return nil, nil }
 // Serve serves requests on ln. It blocks until ln is closed.
 func (s *Server) Serve(ln net.Listener) error {
 	if tcpLn, ok := ln.(*net.TCPListener); ok {
-		ln = tcpKeepAliveListener{TCPListener: tcpLn}
+		ln = tcpKeepAliveListener{TCPListener: tcpLn, opts: s.listenerOpts}
 	}
 
 	ln = newGracefulListener(ln, &s.connWg)
@@ -167,6 +299,23 @@ func (s *Server) Serve(ln net.Listener) error {
 	s.listener = ln
 	s.listenerMu.Unlock()
 
+	// Connections are told apart by what they are wrapped in here
+	ln = identifyingListener{Listener: ln}
+
+	// Sniff the protocols of connections before anything else
+	// reads from them; plaintext HTTP connections to a TLS server
+	// are served on a listener of their own, and redirected
+	var plainLn net.Listener
+	if s.multiplex != nil {
+		mux := newMuxListener(ln, s.multiplex, s.Server.TLSConfig != nil)
+		ln = mux.Serving()
+		if s.Server.TLSConfig != nil {
+			plainLn = s.limitConns(mux.Plaintext(), true)
+		}
+	}
+
+	ln = s.limitConns(ln, s.Server.TLSConfig == nil)
+
 	if s.Server.TLSConfig != nil {
 		// Create TLS listener - note that we do not replace s.listener
 		// with this TLS listener; tls.listener is unexported and does
@@ -174,11 +323,20 @@ func (s *Server) Serve(ln net.Listener) error {
 		// on POSIX systems.
 		// TODO: Is this ^ still relevant anymore? Maybe we can now that it's a net.Listener...
 		ln = tls.NewListener(ln, s.Server.TLSConfig)
+		if s.handshakes != nil {
+			ln = handshakeTimingListener{Listener: ln, tracker: s.handshakes}
+		}
 
 		// Rotate TLS session ticket keys
 		s.tlsGovChan = caddytls.RotateSessionTicketKeys(s.Server.TLSConfig)
 	}
 
+	// Request framing is checked on the decrypted bytes
+	ln = s.checkFraming(ln)
+	if plainLn != nil {
+		plainLn = s.checkFraming(plainLn)
+	}
+
 	if QUIC {
 		go func() {
 			err := s.quicServer.ListenAndServe()
@@ -188,6 +346,36 @@ func (s *Server) Serve(ln net.Listener) error {
 		}()
 	}
 
+	if plainLn != nil {
+		go func() {
+			err := s.Server.Serve(plainLn)
+			if err != nil && !isClosedErr(err) {
+				log.Printf("[ERROR] Serving plaintext HTTP on %s: %v", plainLn.Addr(), err)
+			}
+		}()
+	}
+
+	// Serve on any additional listeners the sites have, such as tunnels
+	for _, site := range s.sites {
+		for _, open := range site.listenerFuncs {
+			extraLn, err := open(s.Server.TLSConfig)
+			if err != nil {
+				return err
+			}
+			extraLn = identifyingListener{Listener: newGracefulListener(extraLn, &s.connWg)}
+			extraLn = s.checkFraming(extraLn)
+			s.listenerMu.Lock()
+			s.extraLns = append(s.extraLns, extraLn)
+			s.listenerMu.Unlock()
+			go func(addr Address) {
+				err := s.Server.Serve(extraLn)
+				if err != nil && !isClosedErr(err) {
+					log.Printf("[ERROR] Serving %s on %s: %v", addr, extraLn.Addr(), err)
+				}
+			}(site.Addr)
+		}
+	}
+
 	err := s.Server.Serve(ln)
 	if QUIC {
 		s.quicServer.Close()
@@ -195,6 +383,45 @@ func (s *Server) Serve(ln net.Listener) error {
 	return err
 }
 
+// limitConns wraps ln to enforce the connection limits, minimum
+// transfer rates and keep-alive idle timeouts of s. plaintext is
+// whether ln is not served over TLS.
+func (s *Server) limitConns(ln net.Listener, plaintext bool) net.Listener {
+	if s.connLimiter != nil {
+		ln = limitListener{
+			Listener:  ln,
+			limiter:   s.connLimiter,
+			timeout:   s.connQueue,
+			plaintext: plaintext,
+		}
+	}
+
+	// Track connections to enforce minimum transfer rates; this is
+	// done below the TLS layer so slow handshakes are caught, too
+	if s.conns != nil {
+		ln = slowConnListener{Listener: ln, tracker: s.conns}
+	}
+	if s.keepAlives != nil {
+		ln = keepAliveListener{Listener: ln, tracker: s.keepAlives}
+	}
+	return ln
+}
+
+// checkFraming wraps ln to reject requests with
+// ambiguous framing, if any site of s asks for it.
+func (s *Server) checkFraming(ln net.Listener) net.Listener {
+	if s.framing {
+		ln = framingListener{Listener: ln}
+	}
+	return ln
+}
+
+// isClosedErr returns true if err was returned because
+// a listener was closed.
+func isClosedErr(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "use of closed network connection")
+}
+
 // ServePacket is a noop to implement the Server interface.
 func (s *Server) ServePacket(pc net.PacketConn) error { return nil }
 
@@ -213,6 +440,13 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	sanitizePath(r)
 
+	// plaintext HTTP multiplexed onto a TLS server is only redirected
+	if s.multiplex != nil && r.TLS == nil && s.Server.TLSConfig != nil {
+		w.Header().Set("Connection", "close")
+		http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusMovedPermanently)
+		return
+	}
+
 	status, _ := s.serveHTTP(w, r)
 
 	// Fallback error response in case error handling wasn't chained in
@@ -231,7 +465,10 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 	}
 
 	// look up the virtualhost; if no match, serve error
-	vhost, pathPrefix := s.vhosts.Match(hostname + r.URL.Path)
+	s.sitesMu.RLock()
+	vhosts := s.vhosts
+	s.sitesMu.RUnlock()
+	vhost, pathPrefix, captures := vhosts.Match(hostname + r.URL.Path)
 
 	if vhost == nil {
 		// check for ACME challenge even if vhost is nil;
@@ -239,6 +476,17 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 		if caddytls.HTTPChallengeHandler(w, r, caddytls.DefaultHTTPAlternatePort) {
 			return 0, nil
 		}
+		// then do what the default server says, if there is one
+		if s.defaultServer != nil {
+			site, handled := s.serveNoSite(w, r)
+			if handled {
+				return 0, nil
+			}
+			vhost, pathPrefix = site, "/"
+		}
+	}
+
+	if vhost == nil {
 		// otherwise, log the error and write a message to the client
 		remoteHost, _, err := net.SplitHostPort(r.RemoteAddr)
 		if err != nil {
@@ -250,12 +498,25 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 		return 0, nil
 	}
 
+	// make what wildcards or the host regexp captured available
+	// as {vhost.1}, {vhost.2}, ..., and {vhost.name}
+	for key, value := range captures {
+		r = SetRequestPlaceholder(r, "vhost."+key, value)
+	}
+
 	// we still check for ACME challenge if the vhost exists,
 	// because we must apply its HTTP challenge config settings
 	if s.proxyHTTPChallenge(vhost, w, r) {
 		return 0, nil
 	}
 
+	// a site that authenticates clients has its own handshake,
+	// so it must not be reached on a connection made for another
+	if r.TLS != nil && vhost.TLS != nil && vhost.TLS.ClientAuth != tls.NoClientCert &&
+		!strings.EqualFold(r.TLS.ServerName, hostname) {
+		return 421, nil // Misdirected Request
+	}
+
 	// trim the path portion of the site address from the beginning of
 	// the URL path, so a request to example.com/foo/blog on the site
 	// defined as example.com/foo appears as /blog instead of /foo/blog.
@@ -266,6 +527,46 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 		}
 	}
 
+	// Reject requests with an oversized URI or headers
+	if status := vhost.RequestLimits.Check(r); status != 0 {
+		return status, nil
+	}
+
+	// Hold one of the site's connection slots until the connection is closed
+	if vhost.connLimiter != nil {
+		done, ok := s.siteConns.hold(r, vhost.connLimiter, vhost.ConnLimits.QueueTimeout)
+		if !ok {
+			return http.StatusServiceUnavailable, nil
+		}
+		defer done()
+	}
+
+	if s.keepAlives != nil {
+		s.keepAlives.serve(vhost.KeepAlive, w, r)
+	}
+
+	// The first request on a connection carries the time of its handshake
+	if s.handshakes != nil && r.TLS != nil {
+		if d, ok := s.handshakes.take(requestConn(r)); ok {
+			r = r.WithContext(context.WithValue(r.Context(), tlsHandshakeCtxKey, d))
+		}
+	}
+
+	// Enforce minimum transfer rates; HTTP/2 streams share
+	// a connection, so its deadlines can't be used for this
+	if s.conns != nil && r.ProtoMajor == 1 {
+		if conn := s.conns.get(requestConn(r)); conn != nil {
+			rates := vhost.MinRates
+			if rates.Upload > 0 && r.Body != nil {
+				r.Body = &minRateReader{ReadCloser: r.Body, conn: conn, rate: rates.Upload, grace: rates.Grace, start: time.Now()}
+			}
+			if rates.Download > 0 {
+				w = minRateWriter{ResponseWriter: w, conn: conn, rate: rates.Download, grace: rates.Grace}
+				defer conn.SetWriteDeadline(time.Time{})
+			}
+		}
+	}
+
 	// Apply the path-based request body size limit
 	// The error returned by MaxBytesReader is meant to be handled
 	// by whichever middleware/plugin that receives it when calling
@@ -279,6 +580,15 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 		}
 	}
 
+	// serve files from the roots for this very request
+	if IsDynamicRoot(vhost.Root) || vhost.hasDynamicFallback() {
+		root, ok := vhost.requestFileSystem(r)
+		if !ok {
+			return http.StatusNotFound, nil
+		}
+		r = staticfiles.WithRoot(r, root)
+	}
+
 	return vhost.middlewareChain.ServeHTTP(w, r)
 }
 
@@ -333,6 +643,10 @@ func (s *Server) Stop() (err error) {
 		err = s.listener.Close()
 		s.listener = nil
 	}
+	for _, ln := range s.extraLns {
+		ln.Close()
+	}
+	s.extraLns = nil
 	s.listenerMu.Unlock()
 
 	// Closing this signals any TLS governor goroutines to exit
@@ -371,6 +685,8 @@ func (s *Server) OnStartupComplete() {
 	if caddy.Quiet {
 		return
 	}
+	s.sitesMu.RLock()
+	defer s.sitesMu.RUnlock()
 	for _, site := range s.sites {
 		output := site.Addr.String()
 		if caddy.IsLoopback(s.Address()) && !caddy.IsLoopback(site.Addr.Host) {
@@ -384,11 +700,12 @@ func (s *Server) OnStartupComplete() {
 // tcpKeepAliveListener sets TCP keep-alive timeouts on accepted
 // connections. It's used by ListenAndServe and ListenAndServeTLS so
 // dead TCP connections (e.g. closing laptop mid-download) eventually
-// go away.
+// go away. It also applies the other per-connection listener options.
 //
 // Borrowed from the Go standard library.
 type tcpKeepAliveListener struct {
 	*net.TCPListener
+	opts ListenerOptions
 }
 
 // Accept accepts the connection with a keep-alive enabled.
@@ -397,8 +714,7 @@ func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
 	if err != nil {
 		return
 	}
-	tc.SetKeepAlive(true)
-	tc.SetKeepAlivePeriod(3 * time.Minute)
+	tuneConn(tc, ln.opts)
 	return tc, nil
 }
 
@@ -489,3 +805,19 @@ func WriteTextResponse(w http.ResponseWriter, status int, body string) {
 	w.WriteHeader(status)
 	w.Write([]byte(body))
 }
+
+// WriteJSONResponse writes v encoded as JSON with code status to w.
+// It returns what a Handler that wrote the response returns, which
+// is 0, or if v could not be encoded, http.StatusInternalServerError
+// and the error, and then nothing is written.
+func WriteJSONResponse(w http.ResponseWriter, status int, v interface{}) (int, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(body)
+	return 0, nil
+}
@@ -1,8 +1,12 @@
 package httpserver
 
 import (
+	"crypto/tls"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/mholt/caddy/caddytls"
 )
 
 func TestAddress(t *testing.T) {
@@ -13,3 +17,62 @@ func TestAddress(t *testing.T) {
 		t.Errorf("Expected '%s' but got '%s'", want, got)
 	}
 }
+
+func TestClientAuthMisdirected(t *testing.T) {
+	newSite := func(host string, clientAuth tls.ClientAuthType) *SiteConfig {
+		return &SiteConfig{
+			Addr: Address{Original: host, Host: host},
+			TLS:  &caddytls.Config{Hostname: host, ClientAuth: clientAuth},
+			middleware: []Middleware{func(Handler) Handler {
+				return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+					w.Write([]byte(host))
+					return 0, nil
+				})
+			}},
+		}
+	}
+	s, err := NewServer(":443", []*SiteConfig{
+		newSite("a.example.com", tls.RequireAndVerifyClientCert),
+		newSite("b.example.com", tls.NoClientCert),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error creating server, got: %v", err)
+	}
+
+	for i, test := range []struct {
+		serverName, url string
+		expectStatus    int
+	}{
+		{"a.example.com", "https://a.example.com/", http.StatusOK},
+		{"A.example.com", "https://a.example.com:443/", http.StatusOK},
+		{"b.example.com", "https://a.example.com/", 421},
+		{"", "https://a.example.com/", 421},
+		{"a.example.com", "https://b.example.com/", http.StatusOK},
+	} {
+		r := httptest.NewRequest("GET", test.url, nil)
+		r.TLS = &tls.ConnectionState{ServerName: test.serverName}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, w.Code)
+		}
+	}
+}
+
+func TestWriteJSONResponse(t *testing.T) {
+	w := httptest.NewRecorder()
+	status, err := WriteJSONResponse(w, http.StatusCreated, map[string]int{"n": 1})
+	if status != 0 || err != nil {
+		t.Errorf("Expected response to be written, got %d, %v", status, err)
+	}
+	if w.Code != http.StatusCreated || w.Body.String() != `{"n":1}` ||
+		w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Errorf("Expected JSON response, got %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	status, err = WriteJSONResponse(w, http.StatusOK, func() {})
+	if status != http.StatusInternalServerError || err == nil || w.Body.Len() != 0 {
+		t.Errorf("Expected error and nothing written, got %d, %v, %q", status, err, w.Body.String())
+	}
+}
@@ -0,0 +1,164 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerTimings collects how long the phases of handling a
+// request took, to report them in the Server-Timing header.
+type ServerTimings struct {
+	mu      sync.Mutex
+	metrics []ServerTiming
+}
+
+// ServerTiming is how long a phase of handling a request took.
+type ServerTiming struct {
+	Name     string
+	Desc     string
+	Duration time.Duration
+}
+
+// Add adds d to the duration of the phase named name,
+// which is described by desc.
+func (t *ServerTimings) Add(name, desc string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.metrics {
+		if t.metrics[i].Name == name {
+			t.metrics[i].Duration += d
+			return
+		}
+	}
+	t.metrics = append(t.metrics, ServerTiming{Name: name, Desc: desc, Duration: d})
+}
+
+// Header returns the value of the Server-Timing header
+// reporting the phases for which names is true.
+func (t *ServerTimings) Header(names map[string]bool) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var metrics []string
+	for _, m := range t.metrics {
+		if !names[m.Name] {
+			continue
+		}
+		ms := strconv.FormatFloat(float64(m.Duration)/float64(time.Millisecond), 'f', -1, 64)
+		metrics = append(metrics, m.Name+`;desc="`+m.Desc+`";dur=`+ms)
+	}
+	return strings.Join(metrics, ", ")
+}
+
+// serverTimingsCtxKey is the context key under which
+// the timings of a request are collected.
+const serverTimingsCtxKey ctxKey = "server_timings"
+
+// WithServerTimings returns a copy of r, the phases of
+// handling which are timed, and the timings.
+func WithServerTimings(r *http.Request) (*http.Request, *ServerTimings) {
+	t := new(ServerTimings)
+	return r.WithContext(context.WithValue(r.Context(), serverTimingsCtxKey, t)), t
+}
+
+// AddServerTiming adds d to the duration of the phase named
+// name of handling r, if the phases of handling r are timed.
+func AddServerTiming(r *http.Request, name, desc string, d time.Duration) {
+	if t, ok := r.Context().Value(serverTimingsCtxKey).(*ServerTimings); ok {
+		t.Add(name, desc, d)
+	}
+}
+
+// tlsHandshakeCtxKey is the context key under which the duration
+// of the TLS handshake of the first request of a connection is.
+const tlsHandshakeCtxKey ctxKey = "tls_handshake"
+
+// TLSHandshakeDuration returns how long the TLS handshake of the
+// connection of r took, if r is the first request on it and the
+// handshake was timed.
+func TLSHandshakeDuration(r *http.Request) (time.Duration, bool) {
+	d, ok := r.Context().Value(tlsHandshakeCtxKey).(time.Duration)
+	return d, ok
+}
+
+// handshakeTracker times the TLS handshakes of the connections
+// accepted by a server, keyed as returned by baseConn, until the
+// first request on each connection takes the time of its handshake.
+type handshakeTracker struct {
+	sync.Mutex
+	conns map[net.Conn]*handshakeTime
+}
+
+// handshakeTime is how long the handshake of a connection took.
+type handshakeTime struct {
+	done     chan struct{} // closed when the handshake is over
+	duration time.Duration
+	ok       bool // whether the handshake succeeded
+}
+
+func newHandshakeTracker() *handshakeTracker {
+	return &handshakeTracker{conns: make(map[net.Conn]*handshakeTime)}
+}
+
+// timeHandshake does the handshake of c, concurrently with the server,
+// which waits for it to complete, and records how long it took
+// from accepted.
+func (t *handshakeTracker) timeHandshake(c *tls.Conn, h *handshakeTime, accepted time.Time) {
+	if err := c.Handshake(); err == nil {
+		h.duration, h.ok = time.Since(accepted), true
+	}
+	close(h.done)
+}
+
+// take returns how long the handshake of the connection c took,
+// if it was timed and was not taken before. A request is read
+// only after the handshake, so this does not wait for more than
+// the timing goroutine takes to notice it is over.
+func (t *handshakeTracker) take(c net.Conn) (time.Duration, bool) {
+	t.Lock()
+	h := t.conns[c]
+	delete(t.conns, c)
+	t.Unlock()
+	if h == nil {
+		return 0, false
+	}
+	<-h.done
+	return h.duration, h.ok
+}
+
+// connState forgets connections that are closed or hijacked.
+func (t *handshakeTracker) connState(c net.Conn, cs http.ConnState) {
+	if cs == http.StateClosed || cs == http.StateHijacked {
+		t.Lock()
+		delete(t.conns, baseConn(c))
+		t.Unlock()
+	}
+}
+
+// handshakeTimingListener times the TLS handshakes of the
+// connections accepted from a TLS listener.
+type handshakeTimingListener struct {
+	net.Listener
+	tracker *handshakeTracker
+}
+
+// Accept accepts the next connection and starts timing its handshake.
+func (ln handshakeTimingListener) Accept() (net.Conn, error) {
+	c, err := ln.Listener.Accept()
+	if err != nil {
+		return c, err
+	}
+	if tc, ok := c.(*tls.Conn); ok && baseConn(tc) != nil {
+		h := &handshakeTime{done: make(chan struct{})}
+		ln.tracker.Lock()
+		ln.tracker.conns[baseConn(tc)] = h
+		ln.tracker.Unlock()
+		go ln.tracker.timeHandshake(tc, h, time.Now())
+	}
+	return c, nil
+}
@@ -0,0 +1,69 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServerTimingsHeader(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	AddServerTiming(r, "upstream", "Upstream", time.Millisecond) // not timed, so ignored
+
+	r, timings := WithServerTimings(r)
+	AddServerTiming(r, "upstream", "Upstream", 1500*time.Microsecond)
+	AddServerTiming(r, "upstream", "Upstream", 2*time.Millisecond)
+	timings.Add("total", "Middleware chain", 10*time.Millisecond)
+	timings.Add("other", "Other", time.Second)
+
+	expected := `upstream;desc="Upstream";dur=3.5, total;desc="Middleware chain";dur=10`
+	if got := timings.Header(map[string]bool{"upstream": true, "total": true}); got != expected {
+		t.Errorf("Expected header %s, got %s", expected, got)
+	}
+	if got := timings.Header(map[string]bool{"tls": true}); got != "" {
+		t.Errorf("Expected empty header, got %s", got)
+	}
+}
+
+func TestHandshakeTimingListener(t *testing.T) {
+	// borrow the certificate of a test server
+	ts := httptest.NewTLSServer(nil)
+	tlsConfig := ts.TLS
+	ts.Close()
+
+	rawLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := newHandshakeTracker()
+	ln := handshakeTimingListener{Listener: tls.NewListener(identifyingListener{Listener: rawLn}, tlsConfig), tracker: tracker}
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if d, ok := tracker.take(requestConn(r)); ok && d > 0 {
+				w.Write([]byte("timed"))
+			}
+		}),
+		ConnState: tracker.connState,
+	}
+	go srv.Serve(ln)
+	defer ln.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	for i, expected := range []string{"timed", ""} {
+		resp, err := client.Get("https://" + rawLn.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != expected {
+			t.Errorf("Request %d: Expected %q, got %q", i, expected, body)
+		}
+	}
+}
@@ -1,6 +1,15 @@
 package httpserver
 
-import "github.com/mholt/caddy/caddytls"
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+	"github.com/mholt/caddy/caddytls"
+)
 
 // SiteConfig contains information about a site
 // (also known as a virtual host).
@@ -18,12 +27,41 @@ type SiteConfig struct {
 	// Uncompiled middleware stack
 	middleware []Middleware
 
+	// The directive that added each middleware
+	middlewareDirectives []string
+
+	// The directive being set up, whose middleware is added
+	directive string
+
 	// Compiled middleware stack
 	middlewareChain Handler
 
+	// The directives in the site's block, in the
+	// order they are executed
+	Directives []string
+
+	// If not nil, the site only matches hosts matching
+	// this regular expression (as well as its address)
+	HostRegexp *regexp.Regexp
+
+	// Of several sites matching a request, the one with
+	// the highest priority is used
+	HostPriority int
+
+	// How the site's server handles requests for no site;
+	// nil unless set by this site
+	DefaultServer *DefaultServer
+
 	// Directory from which to serve files
 	Root string
 
+	// Directories from which to serve the files that
+	// are not in Root, in order
+	FallbackRoots []string
+
+	// Limits on the byte ranges that may be requested of files
+	Ranges staticfiles.RangePolicy
+
 	// A list of files to hide (for example, the
 	// source Caddyfile). TODO: Enforcing this
 	// should be centralized, for example, a
@@ -33,6 +71,101 @@ type SiteConfig struct {
 
 	// Max amount of bytes a request can send on a given path
 	MaxRequestBodySizes []PathLimit
+
+	// Limits on the request line and headers
+	RequestLimits RequestLimits
+
+	// Minimum rates at which clients must transfer data
+	MinRates MinTransferRates
+
+	// Limits on the number of connections
+	ConnLimits ConnLimits
+
+	// Keep-alive settings
+	KeepAlive KeepAlive
+
+	// Whether requests whose body length could be interpreted
+	// in more than one way are rejected on the site's connections
+	StrictFraming bool
+
+	// Socket options of the site's listener
+	ListenerOptions ListenerOptions
+
+	// Protocol sniffing of the site's listener; nil if not multiplexed
+	Multiplex *Multiplex
+
+	// Whether the TLS handshakes of connections to the
+	// site are timed, for the Server-Timing header
+	TimeTLSHandshakes bool
+
+	// Named matchers, by @name
+	matchers map[string]*Matcher
+
+	// Enforces ConnLimits; nil if the site has no limits
+	connLimiter *connLimiter
+
+	// Functions that open additional listeners for the site
+	listenerFuncs []ListenerFunc
+}
+
+// ListenerFunc opens a listener on which a site is served in
+// addition to its regular listener. tlsConfig is the TLS config
+// of the site's server, or nil if it does not use TLS; the
+// listener is responsible for any TLS handshakes.
+type ListenerFunc func(tlsConfig *tls.Config) (net.Listener, error)
+
+// RequestLimits limits the size of the parts of a request
+// that are read before the body. A zero value means no limit.
+type RequestLimits struct {
+	// Max length of the request URI, in bytes
+	URILength int64
+
+	// Max number of query string parameters
+	QueryParams int
+
+	// Max combined size of all header fields, in bytes
+	HeaderBytes int64
+
+	// Max number of header fields
+	HeaderCount int
+}
+
+// Check returns the status code with which r should be
+// rejected for exceeding l, or 0 if r is within l.
+func (l RequestLimits) Check(r *http.Request) int {
+	if l.URILength > 0 && int64(len(r.RequestURI)) > l.URILength {
+		return http.StatusRequestURITooLong
+	}
+	if l.QueryParams > 0 && countQueryParams(r.URL.RawQuery) > l.QueryParams {
+		return http.StatusRequestURITooLong
+	}
+	if l.HeaderBytes > 0 || l.HeaderCount > 0 {
+		var size int64
+		var count int
+		for name, values := range r.Header {
+			for _, value := range values {
+				// name + ": " + value + "\r\n"
+				size += int64(len(name) + len(value) + 4)
+				count++
+			}
+		}
+		if (l.HeaderBytes > 0 && size > l.HeaderBytes) || (l.HeaderCount > 0 && count > l.HeaderCount) {
+			return http.StatusRequestHeaderFieldsTooLarge
+		}
+	}
+	return 0
+}
+
+// countQueryParams counts the parameters in the raw query
+// string q without allocating a url.Values map.
+func countQueryParams(q string) int {
+	var n int
+	for _, param := range strings.Split(q, "&") {
+		if param != "" {
+			n++
+		}
+	}
+	return n
 }
 
 // PathLimit is a mapping from a site's path to its corresponding
@@ -43,8 +176,46 @@ type PathLimit struct {
 }
 
 // AddMiddleware adds a middleware to a site's middleware stack.
+// It goes after the middleware of the directives that come before
+// the one being set up, even if they were not set up again when
+// the site was reloaded in place.
 func (s *SiteConfig) AddMiddleware(m Middleware) {
-	s.middleware = append(s.middleware, m)
+	i := len(s.middleware)
+	if order := directiveOrder(s.directive); order >= 0 {
+		for i > 0 && directiveOrder(s.middlewareDirectives[i-1]) > order {
+			i--
+		}
+	}
+	s.middleware = append(s.middleware, nil)
+	copy(s.middleware[i+1:], s.middleware[i:])
+	s.middleware[i] = m
+	s.middlewareDirectives = append(s.middlewareDirectives, "")
+	copy(s.middlewareDirectives[i+1:], s.middlewareDirectives[i:])
+	s.middlewareDirectives[i] = s.directive
+}
+
+// directiveOrder returns the index of dir in the
+// directives, or -1 if it is not one of them.
+func directiveOrder(dir string) int {
+	for i, d := range directives {
+		if d == dir {
+			return i
+		}
+	}
+	return -1
+}
+
+// FileSystem returns the file system of the site's files:
+// its Root, overlaying its FallbackRoots, if any.
+func (s SiteConfig) FileSystem() http.FileSystem {
+	if len(s.FallbackRoots) == 0 {
+		return http.Dir(s.Root)
+	}
+	overlay := staticfiles.Overlay{http.Dir(s.Root)}
+	for _, root := range s.FallbackRoots {
+		overlay = append(overlay, http.Dir(root))
+	}
+	return overlay
 }
 
 // TLSConfig returns s.TLS.
@@ -52,6 +223,13 @@ func (s SiteConfig) TLSConfig() *caddytls.Config {
 	return s.TLS
 }
 
+// AddListener adds a function that opens a listener on which the
+// site is served in addition to its regular listener, for example
+// a tunnel. The listener is closed when the server stops.
+func (s *SiteConfig) AddListener(fn ListenerFunc) {
+	s.listenerFuncs = append(s.listenerFuncs, fn)
+}
+
 // Host returns s.Addr.Host.
 func (s SiteConfig) Host() string {
 	return s.Addr.Host
@@ -0,0 +1,43 @@
+package httpserver
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequestLimitsCheck(t *testing.T) {
+	limits := RequestLimits{URILength: 32, QueryParams: 2, HeaderBytes: 64, HeaderCount: 3}
+
+	for i, test := range []struct {
+		uri      string
+		headers  http.Header
+		expected int
+	}{
+		{"/foo?a=1&b=2", nil, 0},
+		{"/" + strings.Repeat("a", 32), nil, http.StatusRequestURITooLong},
+		{"/foo?a=1&b=2&c=3", nil, http.StatusRequestURITooLong},
+		{"/foo?a=1&&b=2&", nil, 0},
+		{"/foo", http.Header{"Accept": {"a", "b", "c"}}, 0},
+		{"/foo", http.Header{"Accept": {"a", "b"}, "Cookie": {"c", "d"}}, http.StatusRequestHeaderFieldsTooLarge},
+		{"/foo", http.Header{"Cookie": {strings.Repeat("c", 64)}}, http.StatusRequestHeaderFieldsTooLarge},
+	} {
+		r, err := http.NewRequest("GET", test.uri, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		r.RequestURI = test.uri
+		if test.headers != nil {
+			r.Header = test.headers
+		}
+		if actual := limits.Check(r); actual != test.expected {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expected, actual)
+		}
+	}
+
+	var noLimits RequestLimits
+	r, _ := http.NewRequest("GET", "/"+strings.Repeat("a", 1024), nil)
+	if actual := noLimits.Check(r); actual != 0 {
+		t.Errorf("Expected no limits to allow request, got status %d", actual)
+	}
+}
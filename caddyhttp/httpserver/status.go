@@ -0,0 +1,39 @@
+package httpserver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StatusRange is a range of status codes, inclusive.
+type StatusRange struct {
+	Min, Max int
+}
+
+// Contains returns whether status is in the range.
+func (sr StatusRange) Contains(status int) bool {
+	return status >= sr.Min && status <= sr.Max
+}
+
+// ParseStatusRange parses a status code like 404, a range
+// of them like 500-504, or a class of them like 5xx.
+func ParseStatusRange(s string) (StatusRange, error) {
+	if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") && s[0] >= '1' && s[0] <= '5' {
+		min := int(s[0]-'0') * 100
+		return StatusRange{Min: min, Max: min + 99}, nil
+	}
+	min, max := s, s
+	if i := strings.Index(s, "-"); i >= 0 {
+		min, max = s[:i], s[i+1:]
+	}
+	lo, err := strconv.Atoi(min)
+	if err != nil || lo < 100 || lo > 599 {
+		return StatusRange{}, fmt.Errorf("invalid status '%s'", s)
+	}
+	hi, err := strconv.Atoi(max)
+	if err != nil || hi < lo || hi > 599 {
+		return StatusRange{}, fmt.Errorf("invalid status '%s'", s)
+	}
+	return StatusRange{Min: lo, Max: hi}, nil
+}
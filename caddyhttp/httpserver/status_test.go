@@ -0,0 +1,35 @@
+package httpserver
+
+import "testing"
+
+func TestParseStatusRange(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		expected  StatusRange
+		shouldErr bool
+	}{
+		{"404", StatusRange{404, 404}, false},
+		{"500-504", StatusRange{500, 504}, false},
+		{"5xx", StatusRange{500, 599}, false},
+		{"4XX", StatusRange{400, 499}, false},
+		{"1xx", StatusRange{100, 199}, false},
+		{"6xx", StatusRange{}, true},
+		{"99", StatusRange{}, true},
+		{"600", StatusRange{}, true},
+		{"504-500", StatusRange{}, true},
+		{"500-", StatusRange{}, true},
+		{"abc", StatusRange{}, true},
+		{"", StatusRange{}, true},
+	} {
+		sr, err := ParseStatusRange(test.input)
+		if (err != nil) != test.shouldErr {
+			t.Errorf("Test %d: Expected error to be %v, got: %v", i, test.shouldErr, err)
+		}
+		if sr != test.expected {
+			t.Errorf("Test %d: Expected %v, got %v", i, test.expected, sr)
+		}
+	}
+	if sr := (StatusRange{500, 504}); !sr.Contains(500) || !sr.Contains(504) || sr.Contains(505) || sr.Contains(499) {
+		t.Errorf("Expected %v to contain only 500 to 504", sr)
+	}
+}
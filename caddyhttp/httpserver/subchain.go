@@ -0,0 +1,114 @@
+package httpserver
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyfile"
+)
+
+// SetupSubchain sets up the directives in the block of the
+// current directive as a chain of middleware of their own,
+// like the site's chain but separate from it. It returns the
+// arguments of the directive before the block and the
+// middleware, in the order the directives are executed.
+// Only directives that add middleware may be in the block,
+// and the middleware sees the site's root and named matchers.
+func SetupSubchain(c *caddy.Controller) ([]string, []Middleware, error) {
+	outer := c.Val()
+	var args []string
+	for c.NextArg() {
+		if c.Val() == "{" {
+			break
+		}
+		args = append(args, c.Val())
+	}
+	if c.Val() != "{" {
+		return args, nil, c.SyntaxErr("{")
+	}
+
+	// collect the tokens of each directive in the block
+	tokens := make(map[string][]caddyfile.Token)
+	var dir string
+	var nesting, line int
+	var file string
+	for {
+		if !c.Next() {
+			return args, nil, c.EOFErr()
+		}
+		if c.Val() == "}" && nesting == 0 {
+			break
+		}
+		if nesting == 0 && (c.Line() != line || c.File() != file) {
+			dir = c.Val()
+			if dir == outer || !isMiddlewareDirective(dir) {
+				return args, nil, c.Errf("%s: directive '%s' cannot be used here", outer, dir)
+			}
+		}
+		switch c.Val() {
+		case "{":
+			nesting++
+		case "}":
+			nesting--
+		}
+		line, file = c.Line(), c.File()
+		tokens[dir] = append(tokens[dir], caddyfile.Token{File: c.File(), Line: c.Line(), Text: c.Val()})
+	}
+	var dirs []string
+	for _, d := range directives {
+		if _, ok := tokens[d]; ok {
+			dirs = append(dirs, d)
+		}
+	}
+
+	// set the directives up with a config of their own,
+	// which the lookups of the site's config return
+	ctx := c.Context().(*httpContext)
+	key := strings.ToLower(c.Key)
+	parent := GetConfig(c)
+	sub := *parent
+	sub.middleware = nil
+	sub.Directives = dirs
+	ctx.keysToSiteConfigs[key] = &sub
+	defer func() { ctx.keysToSiteConfigs[key] = parent }()
+
+	for _, dir := range dirs {
+		setup, err := caddy.DirectiveAction("http", dir)
+		if err != nil {
+			return args, nil, err
+		}
+		subc := *c
+		subc.Dispenser = caddyfile.NewDispenserTokens(c.File(), tokens[dir])
+		if err := setup(&subc); err != nil {
+			return args, nil, err
+		}
+	}
+	return args, sub.middleware, nil
+}
+
+// Compose returns the handler that passes requests through
+// mids, in order, to last.
+func Compose(mids []Middleware, last Handler) Handler {
+	for i := len(mids) - 1; i >= 0; i-- {
+		last = mids[i](last)
+	}
+	return last
+}
+
+// directiveIndex returns the position of dir in the
+// order directives are executed, or -1.
+func directiveIndex(dir string) int {
+	for i, d := range directives {
+		if d == dir {
+			return i
+		}
+	}
+	return -1
+}
+
+// isMiddlewareDirective returns whether dir is one of the
+// directives that add middleware to the stack, which come
+// after those that set up a site's vitals and services.
+func isMiddlewareDirective(dir string) bool {
+	return directiveIndex(dir) >= directiveIndex("normalize")
+}
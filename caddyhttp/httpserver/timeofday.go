@@ -0,0 +1,16 @@
+package httpserver
+
+import (
+	"strings"
+	"time"
+)
+
+// ParseTimeOfDay parses a time of day in the form HH:MM,
+// such as 02:00, into the duration since midnight.
+func ParseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,30 @@
+package httpserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeOfDay(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		expected  time.Duration
+		shouldErr bool
+	}{
+		{"00:00", 0, false},
+		{"02:00", 2 * time.Hour, false},
+		{" 18:30", 18*time.Hour + 30*time.Minute, false},
+		{"23:59", 23*time.Hour + 59*time.Minute, false},
+		{"24:00", 0, true},
+		{"8", 0, true},
+		{"", 0, true},
+	} {
+		d, err := ParseTimeOfDay(test.input)
+		if (err != nil) != test.shouldErr {
+			t.Errorf("Test %d: Expected error to be %v, got: %v", i, test.shouldErr, err)
+		}
+		if d != test.expected {
+			t.Errorf("Test %d: Expected %v, got %v", i, test.expected, d)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package httpserver
 
 import (
 	"net"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -10,9 +12,10 @@ import (
 // wildcards as TLS certificates support them), then
 // by longest matching path.
 type vhostTrie struct {
-	edges map[string]*vhostTrie
-	site  *SiteConfig // site to match on this node; also known as a virtual host
-	path  string      // the path portion of the key for the associated site
+	edges    map[string]*vhostTrie
+	site     *SiteConfig // site to match on this node; also known as a virtual host
+	path     string      // the path portion of the key for the associated site
+	extended bool        // whether a site has a HostRegexp or HostPriority; root only
 }
 
 // newVHostTrie returns a new vhostTrie.
@@ -24,6 +27,9 @@ func newVHostTrie() *vhostTrie {
 // a valid "host/path" combination (or just host).
 func (t *vhostTrie) Insert(key string, site *SiteConfig) {
 	host, path := t.splitHostPath(key)
+	if site.HostRegexp != nil || site.HostPriority != 0 {
+		t.extended = true
+	}
 	if _, ok := t.edges[host]; !ok {
 		t.edges[host] = newVHostTrie()
 	}
@@ -54,49 +60,128 @@ func (t *vhostTrie) insertPath(remainingPath, originalPath string, site *SiteCon
 // If there is no match, nil and empty string will
 // be returned.
 //
+// Only the most specific host that matches key is tried,
+// unless a site has a HostRegexp or a HostPriority: then
+// of the sites whose host and path match key (and whose
+// HostRegexp, if any, matches the host), the one with the
+// highest HostPriority is returned; ties go to the most
+// specific host. The values captured by wildcard labels in
+// the host, or by HostRegexp, are returned as captures,
+// keyed by their number (from 1) and regexp group name.
+//
 // A typical key will be in the form "host" or "host/path".
-func (t *vhostTrie) Match(key string) (*SiteConfig, string) {
+func (t *vhostTrie) Match(key string) (*SiteConfig, string, map[string]string) {
 	host, path := t.splitHostPath(key)
-	// try the given host, then, if no match, try wildcard hosts
-	branch := t.matchHost(host)
-	if branch == nil {
-		branch = t.matchHost("0.0.0.0")
+
+	// try the given host, then wildcard hosts, then catch-alls
+	candidates := t.matchHost(host, nil)
+	n := len(candidates)
+	if t.extended || len(candidates) == 0 {
+		candidates = t.matchHost("0.0.0.0", candidates)
 	}
-	if branch == nil {
-		branch = t.matchHost("")
+	if t.extended || len(candidates) == 0 {
+		candidates = t.matchHost("", candidates)
 	}
-	if branch == nil {
-		return nil, ""
+	for i := n; i < len(candidates); i++ {
+		candidates[i].wildcards = 0 // nothing of host was captured
 	}
-	node := branch.matchPath(path)
-	if node == nil {
-		return nil, ""
+	if !t.extended && len(candidates) > 1 {
+		candidates = candidates[:1]
 	}
-	return node.site, node.path
+
+	var best *vhostTrie
+	var bestMatch hostMatch
+	for _, c := range candidates {
+		node := c.branch.matchPath(path)
+		if node == nil {
+			continue
+		}
+		if re := node.site.HostRegexp; re != nil && !re.MatchString(host) {
+			continue
+		}
+		if best == nil || node.site.HostPriority > best.site.HostPriority {
+			best, bestMatch = node, c
+		}
+	}
+	if best == nil {
+		return nil, "", nil
+	}
+	return best.site, best.path, hostCaptures(host, best.site.HostRegexp, bestMatch.wildcards)
+}
+
+// hostMatch is a host node that matches a host, along with how
+// many of the first labels of the host matched wildcards.
+type hostMatch struct {
+	branch    *vhostTrie
+	wildcards int
 }
 
-// matchHost returns the vhostTrie matching host. The matching
+// matchHost appends the vhostTries matching host to matches,
+// most specific first, and returns the result. The matching
 // algorithm is the same as used to match certificates to host
 // with SNI during TLS handshakes. In other words, it supports,
 // to some degree, the use of wildcard (*) characters.
-func (t *vhostTrie) matchHost(host string) *vhostTrie {
+func (t *vhostTrie) matchHost(host string, matches []hostMatch) []hostMatch {
 	// try exact match
 	if subtree, ok := t.edges[host]; ok {
-		return subtree
+		matches = appendHostMatch(matches, subtree, 0)
 	}
 
 	// then try replacing labels in the host
-	// with wildcards until we get a match
+	// with wildcards to find more matches
 	labels := strings.Split(host, ".")
 	for i := range labels {
 		labels[i] = "*"
 		candidate := strings.Join(labels, ".")
 		if subtree, ok := t.edges[candidate]; ok {
-			return subtree
+			matches = appendHostMatch(matches, subtree, i+1)
 		}
 	}
 
-	return nil
+	return matches
+}
+
+// appendHostMatch appends the match of branch to matches,
+// unless it has one already.
+func appendHostMatch(matches []hostMatch, branch *vhostTrie, wildcards int) []hostMatch {
+	for _, m := range matches {
+		if m.branch == branch {
+			return matches
+		}
+	}
+	return append(matches, hostMatch{branch: branch, wildcards: wildcards})
+}
+
+// hostCaptures returns what re captures from host, if re is not
+// nil, or else the first n labels of host, which matched wildcards.
+// It returns nil if nothing was captured.
+func hostCaptures(host string, re *regexp.Regexp, n int) map[string]string {
+	if re != nil {
+		m := re.FindStringSubmatch(host)
+		if len(m) < 2 {
+			return nil
+		}
+		captures := make(map[string]string)
+		for i, name := range re.SubexpNames() {
+			if i == 0 {
+				continue
+			}
+			captures[strconv.Itoa(i)] = m[i]
+			if name != "" {
+				captures[name] = m[i]
+			}
+		}
+		return captures
+	}
+	if n == 0 {
+		return nil
+	}
+	labels := strings.SplitN(host, ".", n+1)
+	captures := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		captures[strconv.Itoa(i+1)] = labels[i]
+	}
+	return captures
 }
 
 // matchPath traverses t until it finds the longest key matching
@@ -3,6 +3,8 @@ package httpserver
 import (
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"regexp"
 	"testing"
 )
 
@@ -81,6 +83,90 @@ func TestVHostTriePort(t *testing.T) {
 	}, true)
 }
 
+func TestVHostTrieFallthrough(t *testing.T) {
+	// a more specific host whose paths don't match
+	// doesn't fall through to less specific hosts...
+	trie := newVHostTrie()
+	populateTestTrie(trie, []string{
+		"example.com/foo",
+		"*.com",
+	})
+	assertTestTrie(t, trie, []vhostTrieTest{
+		{"example.com/foo", true, "example.com/foo", "/foo"},
+		{"example.com/bar", false, "", ""},
+	}, true)
+
+	// ...unless a site sets a priority
+	other, _, _ := trie.Match("other.com")
+	other.HostPriority = -1
+	trie.Insert("*.com", other)
+	assertTestTrie(t, trie, []vhostTrieTest{
+		{"example.com/foo", true, "example.com/foo", "/foo"},
+		{"example.com/bar", true, "*.com", "/"},
+	}, true)
+}
+
+func TestVHostTrieCaptures(t *testing.T) {
+	trie := newVHostTrie()
+	populateTestTrie(trie, []string{
+		"example.com",
+		"*.example.com",
+		"*.*.example.com",
+		"",
+	})
+	for i, test := range []struct {
+		query    string
+		captures map[string]string
+	}{
+		{"example.com", nil},
+		{"foo.example.com", map[string]string{"1": "foo"}},
+		{"foo.bar.example.com", map[string]string{"1": "foo", "2": "bar"}},
+		{"other.org", nil},
+	} {
+		_, _, captures := trie.Match(test.query)
+		if !reflect.DeepEqual(captures, test.captures) {
+			t.Errorf("Test %d: Expected captures %v, got %v", i, test.captures, captures)
+		}
+	}
+}
+
+func TestVHostTrieRegexpAndPriority(t *testing.T) {
+	trie := newVHostTrie()
+	populateTestTrie(trie, []string{
+		"example.com",
+		"*.example.com",
+		"0.0.0.0",
+	})
+	wildcard, _, _ := trie.Match("foo.example.com")
+	wildcard.HostRegexp = regexp.MustCompile(`^(?P<app>[a-z]+)-(dev|prod)\.`)
+	trie.Insert("*.example.com", wildcard)
+	catchAll, _, _ := trie.Match("other.org")
+
+	assertTestTrie(t, trie, []vhostTrieTest{
+		{"api-dev.example.com", true, "*.example.com", "/"},
+		{"foo.example.com", true, "0.0.0.0", "/"},
+		{"example.com", true, "example.com", "/"},
+	}, true)
+
+	_, _, captures := trie.Match("api-dev.example.com")
+	expected := map[string]string{"1": "api", "2": "dev", "app": "api"}
+	if !reflect.DeepEqual(captures, expected) {
+		t.Errorf("Expected captures %v, got %v", expected, captures)
+	}
+
+	// a higher priority wins over a more specific host
+	catchAll.HostPriority = 1
+	assertTestTrie(t, trie, []vhostTrieTest{
+		{"api-dev.example.com", true, "0.0.0.0", "/"},
+		{"example.com", true, "0.0.0.0", "/"},
+	}, true)
+	wildcard.HostPriority = 2
+	assertTestTrie(t, trie, []vhostTrieTest{
+		{"api-dev.example.com", true, "*.example.com", "/"},
+		{"foo.example.com", true, "0.0.0.0", "/"},
+	}, true)
+}
+
 func populateTestTrie(trie *vhostTrie, keys []string) {
 	for _, key := range keys {
 		// we wrap this in a func, passing in the key, otherwise the
@@ -107,7 +193,7 @@ type vhostTrieTest struct {
 
 func assertTestTrie(t *testing.T, trie *vhostTrie, tests []vhostTrieTest, hasWildcardHosts bool) {
 	for i, test := range tests {
-		site, pathPrefix := trie.Match(test.query)
+		site, pathPrefix, _ := trie.Match(test.query)
 
 		if !test.expectMatch {
 			if site != nil {
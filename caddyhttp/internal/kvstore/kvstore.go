@@ -0,0 +1,82 @@
+// Package kvstore is a client of Redis and memcached servers,
+// which keep what instances of Caddy share, such as counters
+// of rates and the hosts of sessions.
+package kvstore
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"time"
+)
+
+// pool is a pool of connections to a store server.
+type pool struct {
+	addr string
+	idle chan *conn
+
+	// init, if not nil, prepares new connections
+	init func(*conn) error
+}
+
+// conn is a connection to a store server.
+type conn struct {
+	net.Conn
+	br *bufio.Reader
+}
+
+func newPool(addr string, init func(*conn) error) *pool {
+	return &pool{addr: addr, idle: make(chan *conn, maxIdleConns), init: init}
+}
+
+// do calls fn with a connection from the pool, or a new one.
+// The connection is returned to the pool unless fn fails.
+func (p *pool) do(fn func(*conn) error) error {
+	var c *conn
+	select {
+	case c = <-p.idle:
+	default:
+		nc, err := net.DialTimeout("tcp", p.addr, Timeout)
+		if err != nil {
+			return err
+		}
+		c = &conn{Conn: nc, br: bufio.NewReader(nc)}
+		c.SetDeadline(time.Now().Add(Timeout))
+		if p.init != nil {
+			if err := p.init(c); err != nil {
+				c.Close()
+				return fmt.Errorf("%s: %v", p.addr, err)
+			}
+		}
+	}
+
+	c.SetDeadline(time.Now().Add(Timeout))
+	if err := fn(c); err != nil {
+		c.Close()
+		return fmt.Errorf("%s: %v", p.addr, err)
+	}
+	select {
+	case p.idle <- c:
+	default:
+		c.Close()
+	}
+	return nil
+}
+
+// readLine reads a CRLF-terminated line, without the CRLF.
+func (c *conn) readLine() (string, error) {
+	line, err := c.br.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("malformed line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// Timeout is how long connecting to a store
+// server, or a command, may take.
+const Timeout = 1 * time.Second
+
+const maxIdleConns = 8
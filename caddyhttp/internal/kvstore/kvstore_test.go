@@ -0,0 +1,252 @@
+package kvstore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// store is what both clients are.
+type store interface {
+	Get(key string) (string, error)
+	Set(key, value string, ttl time.Duration) error
+	Add(key string, n int64, ttl time.Duration) (int64, error)
+}
+
+func TestRedis(t *testing.T) {
+	ln := fakeServer(t, serveFakeRedis)
+	defer ln.Close()
+	u, _ := url.Parse("redis://:secret@" + ln.Addr().String() + "/2")
+	s, err := NewRedis(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+
+	u, _ = url.Parse("redis://:wrong@" + ln.Addr().String())
+	s, _ = NewRedis(u)
+	if _, err := s.Get("key"); err == nil {
+		t.Error("Expected error with wrong password")
+	}
+	for _, bad := range []string{"redis://host/db", "redis://host/-1"} {
+		u, _ = url.Parse(bad)
+		if _, err := NewRedis(u); err == nil {
+			t.Errorf("Expected error for %s", bad)
+		}
+	}
+	u, _ = url.Parse("redis://cache.local")
+	if s, _ := NewRedis(u); s.Addr() != "cache.local:6379" {
+		t.Errorf("Expected default port, got %s", s.Addr())
+	}
+}
+
+func TestMemcache(t *testing.T) {
+	ln := fakeServer(t, serveFakeMemcache)
+	defer ln.Close()
+	u, _ := url.Parse("memcache://" + ln.Addr().String())
+	s, err := NewMemcache(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+
+	u, _ = url.Parse("memcache://cache.local")
+	if s, _ := NewMemcache(u); s.Addr() != "cache.local:11211" {
+		t.Errorf("Expected default port, got %s", s.Addr())
+	}
+}
+
+func testStore(t *testing.T, s store) {
+	if value, err := s.Get("session"); err != nil || value != "" {
+		t.Errorf("Expected no value, got %q (error: %v)", value, err)
+	}
+	if err := s.Set("session", "10.0.0.1:8080", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := s.Get("session"); err != nil || value != "10.0.0.1:8080" {
+		t.Errorf("Expected value that was set, got %q (error: %v)", value, err)
+	}
+	for i, expected := range []int64{5, 10, 13} {
+		n := int64(5)
+		if i == 2 {
+			n = 3
+		}
+		if value, err := s.Add("counter", n, time.Minute); err != nil || value != expected {
+			t.Errorf("Add %d: Expected %d, got %d (error: %v)", i, expected, value, err)
+		}
+	}
+}
+
+func TestMemcacheExpiration(t *testing.T) {
+	if exp := memcacheExpiration(0); exp != 1 {
+		t.Errorf("Expected expiration of at least 1 second, got %d", exp)
+	}
+	if exp := memcacheExpiration(1500 * time.Millisecond); exp != 2 {
+		t.Errorf("Expected expiration to be rounded up, got %d", exp)
+	}
+	if exp := memcacheExpiration(31 * 24 * time.Hour); exp < time.Now().Unix() {
+		t.Errorf("Expected long expiration to be absolute, got %d", exp)
+	}
+}
+
+// fakeServer serves a fake store server with serve, which is
+// given the data of the server and the state of the connection.
+func fakeServer(t *testing.T, serve func(rw *bufio.ReadWriter, data *fakeData, conn map[string]string) error) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := &fakeData{values: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+				state := make(map[string]string)
+				for {
+					err := serve(rw, data, state)
+					if err != nil || rw.Flush() != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return ln
+}
+
+// fakeData is the values of a fake store server.
+type fakeData struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (d *fakeData) get(key string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, ok := d.values[key]
+	return v, ok
+}
+
+// set sets the value of key, unless it has
+// one and only new keys are to be set.
+func (d *fakeData) set(key, value string, onlyNew bool) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.values[key]; ok && onlyNew {
+		return false
+	}
+	d.values[key] = value
+	return true
+}
+
+// incr adds n to the counter of key, if it exists.
+func (d *fakeData) incr(key string, n int64) (int64, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, ok := d.values[key]
+	if !ok {
+		return 0, false
+	}
+	i, _ := strconv.ParseInt(v, 10, 64)
+	d.values[key] = strconv.FormatInt(i+n, 10)
+	return i + n, true
+}
+
+// serveFakeRedis serves one command of the Redis protocol.
+// It requires the client to authenticate with "secret".
+func serveFakeRedis(rw *bufio.ReadWriter, data *fakeData, conn map[string]string) error {
+	var n int
+	if _, err := fmt.Fscanf(rw, "*%d\r\n", &n); err != nil {
+		return err
+	}
+	args := make([]string, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(rw, "$%d\r\n", &size); err != nil {
+			return err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rw, buf); err != nil {
+			return err
+		}
+		args[i] = string(buf[:size])
+	}
+	switch {
+	case args[0] == "AUTH" && args[1] == "secret":
+		conn["authenticated"] = "yes"
+		rw.WriteString("+OK\r\n")
+	case conn["authenticated"] != "yes":
+		rw.WriteString("-NOAUTH Authentication required.\r\n")
+	case args[0] == "SELECT":
+		rw.WriteString("+OK\r\n")
+	case args[0] == "GET" && len(args) == 2:
+		if v, ok := data.get(args[1]); ok {
+			fmt.Fprintf(rw, "$%d\r\n%s\r\n", len(v), v)
+		} else {
+			rw.WriteString("$-1\r\n")
+		}
+	case args[0] == "SET" && len(args) >= 5 && args[3] == "PX":
+		if data.set(args[1], args[2], len(args) == 6 && args[5] == "NX") {
+			rw.WriteString("+OK\r\n")
+		} else {
+			rw.WriteString("$-1\r\n")
+		}
+	case args[0] == "INCRBY" && len(args) == 3:
+		n, _ := strconv.ParseInt(args[2], 10, 64)
+		data.set(args[1], "0", true)
+		v, _ := data.incr(args[1], n)
+		fmt.Fprintf(rw, ":%d\r\n", v)
+	default:
+		rw.WriteString("-ERR unknown command\r\n")
+	}
+	return nil
+}
+
+// serveFakeMemcache serves one command of the memcached text protocol.
+func serveFakeMemcache(rw *bufio.ReadWriter, data *fakeData, conn map[string]string) error {
+	line, err := rw.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(line)
+	switch {
+	case len(fields) == 2 && fields[0] == "get":
+		if v, ok := data.get(fields[1]); ok {
+			fmt.Fprintf(rw, "VALUE %s 0 %d\r\n%s\r\n", fields[1], len(v), v)
+		}
+		rw.WriteString("END\r\n")
+	case len(fields) == 3 && fields[0] == "incr":
+		n, _ := strconv.ParseInt(fields[2], 10, 64)
+		if v, ok := data.incr(fields[1], n); ok {
+			fmt.Fprintf(rw, "%d\r\n", v)
+		} else {
+			rw.WriteString("NOT_FOUND\r\n")
+		}
+	case len(fields) == 5 && (fields[0] == "set" || fields[0] == "add"):
+		size, _ := strconv.Atoi(fields[4])
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rw, buf); err != nil {
+			return err
+		}
+		if data.set(fields[1], string(buf[:size]), fields[0] == "add") {
+			rw.WriteString("STORED\r\n")
+		} else {
+			rw.WriteString("NOT_STORED\r\n")
+		}
+	default:
+		rw.WriteString("ERROR\r\n")
+	}
+	return nil
+}
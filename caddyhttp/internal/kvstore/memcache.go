@@ -0,0 +1,143 @@
+package kvstore
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Memcache is a client of a memcached server.
+type Memcache struct {
+	pool *pool
+}
+
+// NewMemcache returns a client of the memcached server
+// at u, a URL of the form memcache://host[:port].
+func NewMemcache(u *url.URL) (*Memcache, error) {
+	addr := u.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "11211")
+	}
+	return &Memcache{pool: newPool(addr, nil)}, nil
+}
+
+// Addr returns the address of the server.
+func (s *Memcache) Addr() string {
+	return s.pool.addr
+}
+
+// Get returns the value of key, or "" if it has none.
+func (s *Memcache) Get(key string) (string, error) {
+	var value string
+	err := s.pool.do(func(c *conn) error {
+		if _, err := io.WriteString(c, "get "+key+"\r\n"); err != nil {
+			return err
+		}
+		for {
+			line, err := c.readLine()
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			fields := strings.Fields(line)
+			if len(fields) < 4 || fields[0] != "VALUE" {
+				return fmt.Errorf("unexpected memcache reply %q", line)
+			}
+			n, err := strconv.Atoi(fields[3])
+			if err != nil || n < 0 {
+				return fmt.Errorf("malformed memcache reply %q", line)
+			}
+			buf := make([]byte, n+2)
+			if _, err := io.ReadFull(c.br, buf); err != nil {
+				return err
+			}
+			value = string(buf[:n])
+		}
+	})
+	return value, err
+}
+
+// Set sets the value of key, which expires after ttl.
+func (s *Memcache) Set(key, value string, ttl time.Duration) error {
+	return s.pool.do(func(c *conn) error {
+		cmd := fmt.Sprintf("set %s 0 %d %d\r\n%s\r\n", key, memcacheExpiration(ttl), len(value), value)
+		if _, err := io.WriteString(c, cmd); err != nil {
+			return err
+		}
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if line != "STORED" {
+			return fmt.Errorf("memcache: %s", line)
+		}
+		return nil
+	})
+}
+
+// Add adds n to the counter of key, which starts at 0 and
+// expires after ttl, and returns its new value. A counter
+// that does not exist is added with n as its value, unless
+// another client added it first, in which case it is
+// incremented after all.
+func (s *Memcache) Add(key string, n int64, ttl time.Duration) (int64, error) {
+	var value int64
+	err := s.pool.do(func(c *conn) error {
+		for {
+			if _, err := fmt.Fprintf(c, "incr %s %d\r\n", key, n); err != nil {
+				return err
+			}
+			line, err := c.readLine()
+			if err != nil {
+				return err
+			}
+			if line != "NOT_FOUND" {
+				value, err = strconv.ParseInt(line, 10, 64)
+				if err != nil {
+					return fmt.Errorf("unexpected memcache reply %q", line)
+				}
+				return nil
+			}
+
+			v := strconv.FormatInt(n, 10)
+			if _, err := fmt.Fprintf(c, "add %s 0 %d %d\r\n%s\r\n", key, memcacheExpiration(ttl), len(v), v); err != nil {
+				return err
+			}
+			line, err = c.readLine()
+			if err != nil {
+				return err
+			}
+			switch line {
+			case "STORED":
+				value = n
+				return nil
+			case "NOT_STORED":
+				continue
+			default:
+				return fmt.Errorf("unexpected memcache reply %q", line)
+			}
+		}
+	})
+	return value, err
+}
+
+// memcacheExpiration returns the expiration time of an item
+// that expires after ttl, which is in seconds, at least 1,
+// or, if longer than 30 days, an absolute Unix time, as
+// memcached takes such expiration times.
+func memcacheExpiration(ttl time.Duration) int64 {
+	exp := int64((ttl + time.Second - 1) / time.Second)
+	if exp < 1 {
+		exp = 1
+	}
+	if exp > 30*24*60*60 {
+		exp += time.Now().Unix()
+	}
+	return exp
+}
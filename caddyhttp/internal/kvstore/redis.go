@@ -0,0 +1,160 @@
+package kvstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Redis is a client of a Redis server.
+type Redis struct {
+	pool *pool
+}
+
+// NewRedis returns a client of the Redis server at u,
+// a URL of the form redis://[:password@]host[:port][/db].
+func NewRedis(u *url.URL) (*Redis, error) {
+	addr := u.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "6379")
+	}
+	var password string
+	if u.User != nil {
+		password, _ = u.User.Password()
+	}
+	var db int
+	if p := strings.Trim(u.Path, "/"); p != "" {
+		var err error
+		db, err = strconv.Atoi(p)
+		if err != nil || db < 0 {
+			return nil, fmt.Errorf("invalid redis database '%s'", p)
+		}
+	}
+
+	return &Redis{pool: newPool(addr, func(c *conn) error {
+		if password != "" {
+			if _, _, err := redisDo(c, "AUTH", password); err != nil {
+				return err
+			}
+		}
+		if db != 0 {
+			if _, _, err := redisDo(c, "SELECT", strconv.Itoa(db)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})}, nil
+}
+
+// Addr returns the address of the server.
+func (s *Redis) Addr() string {
+	return s.pool.addr
+}
+
+// Get returns the value of key, or "" if it has none.
+func (s *Redis) Get(key string) (string, error) {
+	var value string
+	err := s.pool.do(func(c *conn) error {
+		var err error
+		value, _, err = redisDo(c, "GET", key)
+		return err
+	})
+	return value, err
+}
+
+// Set sets the value of key, which expires after ttl.
+func (s *Redis) Set(key, value string, ttl time.Duration) error {
+	return s.pool.do(func(c *conn) error {
+		_, _, err := redisDo(c, "SET", key, value, "PX", redisTTL(ttl))
+		return err
+	})
+}
+
+// Add adds n to the counter of key, which starts at 0 and
+// expires after ttl, and returns its new value. The counter
+// is created with its expiration if it does not exist, then
+// incremented, in one round trip.
+func (s *Redis) Add(key string, n int64, ttl time.Duration) (int64, error) {
+	var value int64
+	err := s.pool.do(func(c *conn) error {
+		cmds := redisCommand("SET", key, "0", "PX", redisTTL(ttl), "NX") +
+			redisCommand("INCRBY", key, strconv.FormatInt(n, 10))
+		if _, err := io.WriteString(c, cmds); err != nil {
+			return err
+		}
+		if _, _, err := redisReply(c); err != nil {
+			return err
+		}
+		reply, _, err := redisReply(c)
+		if err != nil {
+			return err
+		}
+		value, err = strconv.ParseInt(reply, 10, 64)
+		return err
+	})
+	return value, err
+}
+
+// redisTTL returns ttl in milliseconds, at least 1.
+func redisTTL(ttl time.Duration) string {
+	ms := int64(ttl / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	return strconv.FormatInt(ms, 10)
+}
+
+// redisDo sends a command to a Redis server and reads the reply.
+// It returns the reply, and whether it is nil.
+func redisDo(c *conn, args ...string) (string, bool, error) {
+	if _, err := io.WriteString(c, redisCommand(args...)); err != nil {
+		return "", false, err
+	}
+	return redisReply(c)
+}
+
+// redisCommand encodes a command of the Redis protocol.
+func redisCommand(args ...string) string {
+	cmd := "*" + strconv.Itoa(len(args)) + "\r\n"
+	for _, arg := range args {
+		cmd += "$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n"
+	}
+	return cmd
+}
+
+// redisReply reads the reply to a command, and whether it is nil.
+func redisReply(c *conn) (string, bool, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return "", false, err
+	}
+	if line == "" {
+		return "", false, errors.New("empty redis reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return line[1:], false, nil
+	case '-':
+		return "", false, fmt.Errorf("redis: %s", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", false, fmt.Errorf("malformed redis reply %q", line)
+		}
+		if n < 0 {
+			return "", true, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.br, buf); err != nil {
+			return "", false, err
+		}
+		return string(buf[:n]), false, nil
+	default:
+		return "", false, fmt.Errorf("unexpected redis reply %q", line)
+	}
+}
@@ -0,0 +1,84 @@
+// Package seal encrypts and authenticates the values of cookies
+// that the middleware which log users in keep their state in.
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Sealer encrypts and authenticates cookie values, so that
+// users can neither read nor forge them.
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// New returns a Sealer with a key derived from secret.
+func New(secret []byte) (*Sealer, error) {
+	key := sha256.Sum256(secret)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// Seal returns v encoded as JSON, encrypted, as the
+// value of the cookie called name.
+func (s *Sealer) Seal(name string, v interface{}) (string, error) {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	// the name is authenticated, so that one
+	// cookie cannot be passed off as another
+	sealed := s.aead.Seal(nonce, nonce, plaintext, []byte(name))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts the value of the cookie called name,
+// which Seal made, into v.
+func (s *Sealer) Open(name, value string, v interface{}) error {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return err
+	}
+	if len(sealed) < s.aead.NonceSize() {
+		return errors.New("cookie too short")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plaintext, v)
+}
+
+// Expired returns whether the Unix time expires, as kept
+// in sealed cookie values, has passed.
+func Expired(expires int64) bool {
+	return time.Now().Unix() > expires
+}
+
+// RandomString returns a random URL-safe string of n bytes of entropy.
+func RandomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,53 @@
+package seal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSealer(t *testing.T) {
+	type value struct {
+		Name    string `json:"n"`
+		Expires int64  `json:"e"`
+	}
+	s, err := New([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := s.Seal("session", value{Name: "alice", Expires: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v value
+	if err := s.Open("session", sealed, &v); err != nil || v.Name != "alice" || v.Expires != 42 {
+		t.Errorf("Expected value to round trip, got %+v and %v", v, err)
+	}
+	if err := s.Open("state", sealed, &v); err == nil {
+		t.Error("Expected cookie not to open as another cookie")
+	}
+	other, _ := New([]byte("other"))
+	if err := other.Open("session", sealed, &v); err == nil {
+		t.Error("Expected cookie not to open with another secret")
+	}
+	for _, bad := range []string{"", "abc", "not base64!", sealed[:len(sealed)-2]} {
+		if err := s.Open("session", bad, &v); err == nil {
+			t.Errorf("Expected %q not to open", bad)
+		}
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Now().Unix()
+	if Expired(now + 60) {
+		t.Error("Expected time in the future not to have expired")
+	}
+	if !Expired(now - 60) {
+		t.Error("Expected time in the past to have expired")
+	}
+}
+
+func TestRandomString(t *testing.T) {
+	if a, b := RandomString(16), RandomString(16); len(a) != 22 || a == b {
+		t.Errorf("Expected different strings of 22 characters, got %q and %q", a, b)
+	}
+}
@@ -0,0 +1,157 @@
+// Package xmltree parses XML documents into trees of elements,
+// for the middleware that read XML from clients and upstreams.
+package xmltree
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Node is an element of an XML document. Unlike the types of
+// encoding/xml, it keeps the prefixes of names as written, which
+// canonicalization needs.
+type Node struct {
+	Prefix  string
+	Local   string
+	Attrs   []xml.Attr    // with prefixes in Name.Space, including xmlns ones
+	Content []interface{} // *Node or string
+	Parent  *Node
+}
+
+// Parse parses an XML document into its root element.
+// Comments and processing instructions are dropped, and
+// documents with a DTD or elements nested deeper than
+// MaxDepth are refused.
+func Parse(r io.Reader) (*Node, error) {
+	d := xml.NewDecoder(r)
+	var root, current *Node
+	depth := 0
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if depth++; depth > MaxDepth {
+				return nil, errors.New("elements nested too deeply")
+			}
+			n := &Node{Prefix: tok.Name.Space, Local: tok.Name.Local, Parent: current}
+			n.Attrs = append(n.Attrs, tok.Attr...)
+			if current == nil {
+				if root != nil {
+					return nil, errors.New("more than one root element")
+				}
+				root = n
+			} else {
+				current.Content = append(current.Content, n)
+			}
+			current = n
+		case xml.EndElement:
+			if current == nil || tok.Name.Space != current.Prefix || tok.Name.Local != current.Local {
+				return nil, errors.New("mismatched end element")
+			}
+			current = current.Parent
+			depth--
+		case xml.CharData:
+			if current != nil {
+				current.Content = append(current.Content, string(tok))
+			}
+		case xml.Directive:
+			return nil, errors.New("document type declarations are not allowed")
+		}
+	}
+	if root == nil || current != nil {
+		return nil, errors.New("incomplete document")
+	}
+	return root, nil
+}
+
+// Namespace returns the namespace URI bound to prefix
+// at n, or "" if there is none.
+func (n *Node) Namespace(prefix string) string {
+	if prefix == "xml" {
+		return XMLNamespace
+	}
+	for e := n; e != nil; e = e.Parent {
+		for _, a := range e.Attrs {
+			if (prefix == "" && a.Name.Space == "" && a.Name.Local == "xmlns") ||
+				(prefix != "" && a.Name.Space == "xmlns" && a.Name.Local == prefix) {
+				return a.Value
+			}
+		}
+	}
+	return ""
+}
+
+// Is returns whether n is the element local in namespace space.
+func (n *Node) Is(space, local string) bool {
+	return n.Local == local && n.Namespace(n.Prefix) == space
+}
+
+// Attr returns the value of the unprefixed attribute name of n.
+func (n *Node) Attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// Elements returns the child elements of n.
+func (n *Node) Elements() []*Node {
+	var elements []*Node
+	for _, c := range n.Content {
+		if child, ok := c.(*Node); ok {
+			elements = append(elements, child)
+		}
+	}
+	return elements
+}
+
+// Children returns the child elements local in namespace space.
+func (n *Node) Children(space, local string) []*Node {
+	var children []*Node
+	for _, child := range n.Elements() {
+		if child.Is(space, local) {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// Child returns the first child element local in namespace
+// space, or nil if there is none.
+func (n *Node) Child(space, local string) *Node {
+	if children := n.Children(space, local); len(children) > 0 {
+		return children[0]
+	}
+	return nil
+}
+
+// Text returns the text content of n, not of its
+// descendants, trimmed of white space.
+func (n *Node) Text() string {
+	var buf bytes.Buffer
+	for _, c := range n.Content {
+		if s, ok := c.(string); ok {
+			buf.WriteString(s)
+		}
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+const (
+	// MaxDepth limits the nesting of elements.
+	MaxDepth = 256
+
+	// XMLNamespace is the namespace bound to the prefix xml.
+	XMLNamespace = "http://www.w3.org/XML/1998/namespace"
+)
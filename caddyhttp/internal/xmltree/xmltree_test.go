@@ -0,0 +1,54 @@
+package xmltree
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	root, err := Parse(strings.NewReader(`<?xml version="1.0"?>
+<a:root xmlns:a="urn:a" xmlns="urn:d"><!-- comment --><a:child id="1"> one <leaf>two</leaf></a:child><child id="2"/></a:root>`))
+	if err != nil {
+		t.Fatalf("Expected no error parsing, got: %v", err)
+	}
+	if !root.Is("urn:a", "root") {
+		t.Errorf("Expected root element a:root, got %s:%s", root.Prefix, root.Local)
+	}
+	if n := len(root.Elements()); n != 2 {
+		t.Errorf("Expected 2 child elements, got %d", n)
+	}
+	child := root.Child("urn:a", "child")
+	if child == nil {
+		t.Fatal("Expected to find a:child")
+	}
+	if child.Attr("id") != "1" {
+		t.Errorf("Expected id 1, got %q", child.Attr("id"))
+	}
+	if child.Text() != "one" {
+		t.Errorf("Expected text 'one', got %q", child.Text())
+	}
+	if leaf := child.Child("urn:d", "leaf"); leaf == nil || leaf.Parent != child {
+		t.Error("Expected leaf in the default namespace under a:child")
+	}
+	if children := root.Children("urn:d", "child"); len(children) != 1 || children[0].Attr("id") != "2" {
+		t.Errorf("Expected one child in the default namespace, got %d", len(children))
+	}
+	if ns := root.Namespace("xml"); ns != XMLNamespace {
+		t.Errorf("Expected xml prefix bound to %s, got %s", XMLNamespace, ns)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, doc := range []string{
+		``,
+		`<a>`,
+		`<a></b>`,
+		`<a/><b/>`,
+		`<!DOCTYPE a [<!ENTITY x "y">]><a>&x;</a>`,
+		strings.Repeat("<a>", MaxDepth+1) + strings.Repeat("</a>", MaxDepth+1),
+	} {
+		if _, err := Parse(strings.NewReader(doc)); err == nil {
+			t.Errorf("Expected error parsing %q, got none", doc)
+		}
+	}
+}
@@ -7,8 +7,9 @@ import (
 
 func init() {
 	caddy.RegisterPlugin("internal", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
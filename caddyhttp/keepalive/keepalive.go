@@ -0,0 +1,104 @@
+// Package keepalive configures how connections to a site are
+// kept alive between requests.
+package keepalive
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("keepalive", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupKeepAlive,
+	})
+}
+
+// setupKeepAlive sets the keep-alive settings of the site. Syntax:
+//
+//	keepalive off
+//
+//	keepalive {
+//	    max_requests  count
+//	    timeout       duration
+//	    disable_path  paths...
+//	    disable_agent regexp
+//	}
+func setupKeepAlive(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+
+	keepAlive, err := parseKeepAlive(c)
+	if err != nil {
+		return err
+	}
+
+	config.KeepAlive = keepAlive
+
+	return nil
+}
+
+func parseKeepAlive(c *caddy.Controller) (httpserver.KeepAlive, error) {
+	var k httpserver.KeepAlive
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			if args[0] != "off" {
+				return k, c.ArgErr()
+			}
+			k.Disabled = true
+		default:
+			return k, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return k, c.ArgErr()
+			}
+
+			switch what {
+			case "max_requests":
+				if len(args) != 1 {
+					return k, c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 1 {
+					return k, c.Errf("keepalive: invalid count '%s'", args[0])
+				}
+				k.MaxRequests = n
+			case "timeout":
+				if len(args) != 1 {
+					return k, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d <= 0 {
+					return k, c.Errf("keepalive: invalid timeout '%s'", args[0])
+				}
+				k.Timeout = d
+			case "disable_path":
+				k.DisabledPaths = append(k.DisabledPaths, args...)
+			case "disable_agent":
+				if len(args) != 1 {
+					return k, c.ArgErr()
+				}
+				re, err := regexp.Compile(args[0])
+				if err != nil {
+					return k, c.Errf("keepalive: invalid user agent pattern: %v", err)
+				}
+				k.DisabledAgents = append(k.DisabledAgents, re)
+			default:
+				return k, c.Errf("keepalive: unknown property '%s'", what)
+			}
+		}
+	}
+
+	return k, nil
+}
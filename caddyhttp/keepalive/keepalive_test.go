@@ -0,0 +1,65 @@
+package keepalive
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupKeepAlive(t *testing.T) {
+	cases := []struct {
+		input    string
+		hasError bool
+		expected httpserver.KeepAlive
+	}{
+		{`keepalive off`, false, httpserver.KeepAlive{Disabled: true}},
+		{`keepalive {
+			max_requests 100
+			timeout 30s
+			disable_path /upload /stream
+			disable_agent ^MSIE
+		}`, false, httpserver.KeepAlive{
+			MaxRequests:    100,
+			Timeout:        30 * time.Second,
+			DisabledPaths:  []string{"/upload", "/stream"},
+			DisabledAgents: []*regexp.Regexp{regexp.MustCompile("^MSIE")},
+		}},
+
+		// Wrong formats
+		{`keepalive on`, true, httpserver.KeepAlive{}},
+		{`keepalive off now`, true, httpserver.KeepAlive{}},
+		{`keepalive {
+			max_requests
+		}`, true, httpserver.KeepAlive{}},
+		{`keepalive {
+			max_requests 0
+		}`, true, httpserver.KeepAlive{}},
+		{`keepalive {
+			timeout forever
+		}`, true, httpserver.KeepAlive{}},
+		{`keepalive {
+			disable_agent (
+		}`, true, httpserver.KeepAlive{}},
+		{`keepalive {
+			linger 5s
+		}`, true, httpserver.KeepAlive{}},
+	}
+	for caseNum, c := range cases {
+		controller := caddy.NewTestController("http", c.input)
+		err := setupKeepAlive(controller)
+
+		if c.hasError && (err == nil) {
+			t.Errorf("Expecting error for case %v but none encountered", caseNum)
+		}
+		if !c.hasError && (err != nil) {
+			t.Errorf("Expecting no error for case %v but encountered %v", caseNum, err)
+		}
+		if actual := httpserver.GetConfig(controller).KeepAlive; !c.hasError && !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("Case %v: Expected %+v, got %+v", caseNum, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package lang implements content negotiation based on the
+// Accept-Language request header. It makes the negotiated
+// language available as the {lang} placeholder and can serve
+// language-specific variants of files, such as index.de.html.
+package lang
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+// Lang is middleware that negotiates the language of the
+// response for requests matching a configured path.
+type Lang struct {
+	Next    httpserver.Handler
+	Configs []Config
+	FileSys http.FileSystem
+}
+
+// Config describes how to negotiate languages for one path scope.
+type Config struct {
+	// Base path of requests this config applies to
+	PathScope string
+
+	// Languages the site can serve, in order of preference
+	Languages []string
+
+	// Language used if none of the client's are available
+	Default string
+
+	// Whether to serve language-specific variants of files
+	Files bool
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (l Lang) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var cfg *Config
+	for i := range l.Configs {
+		if !httpserver.Path(r.URL.Path).Matches(l.Configs[i].PathScope) {
+			continue
+		}
+		if cfg == nil || len(l.Configs[i].PathScope) > len(cfg.PathScope) {
+			cfg = &l.Configs[i]
+		}
+	}
+	if cfg == nil {
+		return l.Next.ServeHTTP(w, r)
+	}
+
+	// the response depends on the request's languages even if
+	// we end up choosing the default, so caches must know that
+	addVary(w.Header(), "Accept-Language")
+
+	lang := Negotiate(r.Header.Get("Accept-Language"), cfg.Languages, cfg.Default)
+	if lang == "" {
+		return l.Next.ServeHTTP(w, r)
+	}
+	r = httpserver.SetRequestPlaceholder(r, "lang", lang)
+
+	if cfg.Files && l.FileSys != nil {
+		if variant, ok := l.variant(r.URL.Path, lang); ok {
+			r.URL.Path = variant
+			w.Header().Set("Content-Language", lang)
+		}
+	}
+
+	return l.Next.ServeHTTP(w, r)
+}
+
+// variant returns the path of the lang-specific variant of
+// the resource at upath, if one exists. Directory paths are
+// resolved using their index pages.
+func (l Lang) variant(upath, lang string) (string, bool) {
+	candidates := []string{upath}
+	if strings.HasSuffix(upath, "/") {
+		candidates = candidates[:0]
+		for _, indexPage := range staticfiles.IndexPages {
+			candidates = append(candidates, upath+indexPage)
+		}
+	}
+	for _, candidate := range candidates {
+		v := variantName(candidate, lang)
+		if l.isFile(v) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// isFile returns true if name exists in l.FileSys and
+// is not a directory.
+func (l Lang) isFile(name string) bool {
+	f, err := l.FileSys.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	return err == nil && !info.IsDir()
+}
+
+// variantName inserts lang before the extension of the last
+// path element of name, so /index.html becomes /index.de.html.
+func variantName(name, lang string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + lang + ext
+}
+
+// Negotiate chooses the best language from available for the
+// given Accept-Language header value, honoring quality values.
+// A language range matches an available language if they are
+// equal or if the range is a prefix of it (followed by "-"),
+// or the other way around. If nothing matches, def is returned.
+func Negotiate(header string, available []string, def string) string {
+	for _, tag := range parseAcceptLanguage(header) {
+		if tag == "*" {
+			if def != "" {
+				return def
+			}
+			if len(available) > 0 {
+				return available[0]
+			}
+			continue
+		}
+		// exact matches are preferred over prefix matches
+		for _, lang := range available {
+			if strings.EqualFold(tag, lang) {
+				return lang
+			}
+		}
+		for _, lang := range available {
+			if matchesPrefix(tag, lang) || matchesPrefix(lang, tag) {
+				return lang
+			}
+		}
+	}
+	return def
+}
+
+// matchesPrefix returns true if prefix is a language range
+// that is a prefix of tag, like "de" is of "de-CH".
+func matchesPrefix(prefix, tag string) bool {
+	return len(tag) > len(prefix) && tag[len(prefix)] == '-' &&
+		strings.EqualFold(tag[:len(prefix)], prefix)
+}
+
+// parseAcceptLanguage returns the language ranges in header
+// ordered by descending quality. Ranges with a quality of 0
+// are omitted.
+func parseAcceptLanguage(header string) []string {
+	var ranges byQuality
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		ranges = append(ranges, languageRange{tag: tag, q: q})
+	}
+	sort.Stable(ranges)
+
+	tags := make([]string, len(ranges))
+	for i, r := range ranges {
+		tags[i] = r.tag
+	}
+	return tags
+}
+
+// languageRange is a language range with its quality value.
+type languageRange struct {
+	tag string
+	q   float64
+}
+
+// byQuality sorts language ranges by descending quality.
+type byQuality []languageRange
+
+func (b byQuality) Len() int           { return len(b) }
+func (b byQuality) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byQuality) Less(i, j int) bool { return b[i].q > b[j].q }
+
+// addVary adds field to the Vary header of h
+// unless it is already present.
+func addVary(h http.Header, field string) {
+	for _, value := range h["Vary"] {
+		for _, existing := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(existing), field) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", field)
+}
@@ -0,0 +1,95 @@
+package lang
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestNegotiate(t *testing.T) {
+	available := []string{"en", "de", "fr-CA"}
+	for i, test := range []struct {
+		header   string
+		expected string
+	}{
+		{"", "en"},
+		{"de", "de"},
+		{"DE", "de"},
+		{"de-CH", "de"},
+		{"fr", "fr-CA"},
+		{"fr-FR", "en"},
+		{"es, de;q=0.5, en;q=0.8", "en"},
+		{"en;q=0, de", "de"},
+		{"es, *;q=0.1", "en"},
+		{"es", "en"},
+	} {
+		if actual := Negotiate(test.header, available, "en"); actual != test.expected {
+			t.Errorf("Test %d: Expected %q for %q, got %q", i, test.expected, test.header, actual)
+		}
+	}
+}
+
+func TestLang(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_lang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{"index.html", "index.de.html", "about.html", "about.fr.html"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, test := range []struct {
+		path, header             string
+		expectedPath, expectLang string
+		expectContentLanguage    string
+	}{
+		{"/", "de", "/index.de.html", "de", "de"},
+		{"/", "en", "/", "en", ""},
+		{"/about.html", "de", "/about.html", "de", ""},
+		{"/about.html", "fr;q=0.9, de;q=0.1", "/about.fr.html", "fr", "fr"},
+		{"/index.html", "es", "/index.html", "en", ""},
+	} {
+		var gotPath, gotLang string
+		l := Lang{
+			Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				gotPath = r.URL.Path
+				gotLang = httpserver.NewReplacer(r, nil, "").Replace("{lang}")
+				return http.StatusOK, nil
+			}),
+			Configs: []Config{
+				{PathScope: "/", Languages: []string{"en", "de", "fr"}, Default: "en", Files: true},
+			},
+			FileSys: http.Dir(root),
+		}
+
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		req.Header.Set("Accept-Language", test.header)
+		rec := httptest.NewRecorder()
+
+		l.ServeHTTP(rec, req)
+
+		if gotPath != test.expectedPath {
+			t.Errorf("Test %d: Expected path %s, got %s", i, test.expectedPath, gotPath)
+		}
+		if gotLang != test.expectLang {
+			t.Errorf("Test %d: Expected {lang} to be %s, got %s", i, test.expectLang, gotLang)
+		}
+		if got := rec.Header().Get("Content-Language"); got != test.expectContentLanguage {
+			t.Errorf("Test %d: Expected Content-Language %q, got %q", i, test.expectContentLanguage, got)
+		}
+		if got := rec.Header().Get("Vary"); got != "Accept-Language" {
+			t.Errorf("Test %d: Expected Vary: Accept-Language, got %q", i, got)
+		}
+	}
+}
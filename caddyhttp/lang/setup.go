@@ -0,0 +1,110 @@
+package lang
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("lang", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
+	})
+}
+
+// setup configures a new Lang middleware instance.
+func setup(c *caddy.Controller) error {
+	if err := httpserver.CheckStaticRoot(c); err != nil {
+		return err
+	}
+	configs, err := langParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	fileSys := cfg.FileSystem()
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Lang{Next: next, Configs: configs, FileSys: fileSys}
+	})
+
+	return nil
+}
+
+// langParse parses lang directives. The short form
+//
+//	lang [path] languages...
+//
+// lists the available languages; the first is the default.
+// The block form allows configuring everything explicitly:
+//
+//	lang [path] {
+//	    available languages...
+//	    default   language
+//	    files
+//	}
+func langParse(c *caddy.Controller) ([]Config, error) {
+	var configs []Config
+
+	for c.Next() {
+		cfg := Config{PathScope: "/"}
+
+		args := c.RemainingArgs()
+		if len(args) > 0 && strings.HasPrefix(args[0], "/") {
+			cfg.PathScope = args[0]
+			args = args[1:]
+		}
+		cfg.Languages = args
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "available":
+				langs := c.RemainingArgs()
+				if len(langs) == 0 {
+					return configs, c.ArgErr()
+				}
+				cfg.Languages = append(cfg.Languages, langs...)
+			case "default":
+				if !c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				cfg.Default = c.Val()
+				if c.NextArg() {
+					return configs, c.ArgErr()
+				}
+			case "files":
+				if c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				cfg.Files = true
+			default:
+				return configs, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+
+		if len(cfg.Languages) == 0 {
+			return configs, c.Err("lang: at least one language is required")
+		}
+		for _, lang := range cfg.Languages {
+			if lang == "" {
+				return configs, c.Err("lang: empty language")
+			}
+		}
+		if cfg.Default == "" {
+			cfg.Default = cfg.Languages[0]
+		}
+
+		for _, existing := range configs {
+			if existing.PathScope == cfg.PathScope {
+				return configs, c.Errf("lang: duplicate path scope '%s'", cfg.PathScope)
+			}
+		}
+		configs = append(configs, cfg)
+	}
+
+	return configs, nil
+}
@@ -0,0 +1,88 @@
+package lang
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `lang en de`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Lang)
+	if !ok {
+		t.Fatalf("Expected handler to be type Lang, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestLangParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []Config
+	}{
+		{`lang`, true, nil},
+		{`lang /docs`, true, nil},
+		{`lang en de`, false, []Config{
+			{PathScope: "/", Languages: []string{"en", "de"}, Default: "en"},
+		}},
+		{`lang /docs en de`, false, []Config{
+			{PathScope: "/docs", Languages: []string{"en", "de"}, Default: "en"},
+		}},
+		{`lang {
+			available de fr
+			default en
+			files
+		}`, false, []Config{
+			{PathScope: "/", Languages: []string{"de", "fr"}, Default: "en", Files: true},
+		}},
+		{`lang en
+		  lang /docs de`, false, []Config{
+			{PathScope: "/", Languages: []string{"en"}, Default: "en"},
+			{PathScope: "/docs", Languages: []string{"de"}, Default: "de"},
+		}},
+		{`lang en
+		  lang de`, true, nil},
+		{`lang {
+			default
+		}`, true, nil},
+		{`lang {
+			available
+		}`, true, nil},
+		{`lang en { files yes }`, true, nil},
+		{`lang en { foo }`, true, nil},
+		{`lang ""`, true, nil},
+		{`lang "" en`, true, nil},
+		{`lang en {
+			available ""
+		}`, true, nil},
+	}
+	for i, test := range tests {
+		actual, err := langParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error but got none", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error but got: %v", i, err)
+			continue
+		}
+		if !test.shouldErr && !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Package limits configures limits on the request line and headers
+// of requests to a site, which complement the limits on request
+// bodies as a defense against denial-of-service attacks.
+package limits
+
+import (
+	"strconv"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("limits", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupLimits,
+	})
+}
+
+// setupLimits sets the request limits of the site. Syntax:
+//
+//	limits {
+//	    uri     size
+//	    query   count
+//	    header  size
+//	    headers count
+//	}
+func setupLimits(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+
+	limits, err := parseLimits(c)
+	if err != nil {
+		return err
+	}
+
+	config.RequestLimits = limits
+
+	return nil
+}
+
+func parseLimits(c *caddy.Controller) (httpserver.RequestLimits, error) {
+	var limits httpserver.RequestLimits
+
+	for c.Next() {
+		if len(c.RemainingArgs()) > 0 {
+			return limits, c.ArgErr()
+		}
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return limits, c.ArgErr()
+			}
+			value := c.Val()
+			if c.NextArg() {
+				return limits, c.ArgErr()
+			}
+
+			switch what {
+			case "uri", "header":
+				size, err := humanize.ParseBytes(value)
+				if err != nil || int64(size) < 1 {
+					return limits, c.Errf("limits: invalid size '%s'", value)
+				}
+				if what == "uri" {
+					limits.URILength = int64(size)
+				} else {
+					limits.HeaderBytes = int64(size)
+				}
+			case "query":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 {
+					return limits, c.Errf("limits: invalid count '%s'", value)
+				}
+				limits.QueryParams = n
+			case "headers":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 {
+					return limits, c.Errf("limits: invalid count '%s'", value)
+				}
+				limits.HeaderCount = n
+			default:
+				return limits, c.Errf("limits: unknown limit '%s'", what)
+			}
+		}
+	}
+
+	return limits, nil
+}
@@ -0,0 +1,63 @@
+package limits
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupLimits(t *testing.T) {
+	cases := []struct {
+		input    string
+		hasError bool
+		expected httpserver.RequestLimits
+	}{
+		{`limits {
+			uri 8KiB
+			query 50
+			header 16kb
+			headers 100
+		}`, false, httpserver.RequestLimits{
+			URILength: 8 * 1024, QueryParams: 50, HeaderBytes: 16 * 1000, HeaderCount: 100,
+		}},
+		{`limits {
+			uri 2048
+		}`, false, httpserver.RequestLimits{URILength: 2048}},
+
+		// Wrong formats
+		{`limits 8KB`, true, httpserver.RequestLimits{}},
+		{`limits {
+			uri
+		}`, true, httpserver.RequestLimits{}},
+		{`limits {
+			uri 8KB 16KB
+		}`, true, httpserver.RequestLimits{}},
+		{`limits {
+			uri 0
+		}`, true, httpserver.RequestLimits{}},
+		{`limits {
+			header -1KB
+		}`, true, httpserver.RequestLimits{}},
+		{`limits {
+			headers many
+		}`, true, httpserver.RequestLimits{}},
+		{`limits {
+			cookies 10
+		}`, true, httpserver.RequestLimits{}},
+	}
+	for caseNum, c := range cases {
+		controller := caddy.NewTestController("http", c.input)
+		err := setupLimits(controller)
+
+		if c.hasError && (err == nil) {
+			t.Errorf("Expecting error for case %v but none encountered", caseNum)
+		}
+		if !c.hasError && (err != nil) {
+			t.Errorf("Expecting no error for case %v but encountered %v", caseNum, err)
+		}
+		if actual := httpserver.GetConfig(controller).RequestLimits; !c.hasError && actual != c.expected {
+			t.Errorf("Case %v: Expected %+v, got %+v", caseNum, c.expected, actual)
+		}
+	}
+}
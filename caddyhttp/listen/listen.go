@@ -0,0 +1,255 @@
+// Package listen lets a site be served on addresses in addition to
+// the one in its address, including Unix domain sockets, so that for
+// example a local reverse proxy can reach the site over a socket.
+package listen
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Address is an additional address to serve a site on.
+type Address struct {
+	// Network is "tcp" or "unix".
+	Network string
+
+	// Addr is host:port for TCP or the path of the socket.
+	Addr string
+
+	// Mode sets the permissions of a socket file, if not 0.
+	Mode os.FileMode
+
+	// Owner and Group set the owner of a socket file, if not empty.
+	Owner, Group string
+}
+
+// String returns a.Addr, prefixed with "unix:" for sockets.
+func (a Address) String() string {
+	if a.Network == "unix" {
+		return "unix:" + a.Addr
+	}
+	return a.Addr
+}
+
+// Listen returns a listener on a. If tlsConfig is not nil, TCP
+// connections are served over TLS with it; connections to Unix
+// sockets are always plaintext, since they do not leave the machine.
+//
+// Listeners are shared by address and stay open as long as any
+// listener on the address does, so that a restart can listen on
+// the same address before the old servers stop.
+func (a Address) Listen(tlsConfig *tls.Config) (net.Listener, error) {
+	ln, err := acquire(a)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil && a.Network == "tcp" {
+		return tls.NewListener(ln, tlsConfig), nil
+	}
+	return ln, nil
+}
+
+// listen opens a listener on a and sets up its socket file, if any.
+func (a Address) listen() (net.Listener, error) {
+	if a.Network != "unix" {
+		return net.Listen(a.Network, a.Addr)
+	}
+
+	// a socket file left behind by a previous process would make
+	// listening fail; but don't remove anything that's not a socket
+	if info, err := os.Stat(a.Addr); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", a.Addr)
+		}
+		if err := os.Remove(a.Addr); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", a.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.setupSocketFile(); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// setupSocketFile applies a's mode and owner to its socket file.
+func (a Address) setupSocketFile() error {
+	if a.Mode != 0 {
+		if err := os.Chmod(a.Addr, a.Mode); err != nil {
+			return err
+		}
+	}
+	if a.Owner == "" && a.Group == "" {
+		return nil
+	}
+	uid, gid := -1, -1
+	if a.Owner != "" {
+		u, err := user.Lookup(a.Owner)
+		if err != nil {
+			return err
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return fmt.Errorf("user %s: unsupported uid %s", a.Owner, u.Uid)
+		}
+	}
+	if a.Group != "" {
+		g, err := user.LookupGroup(a.Group)
+		if err != nil {
+			return err
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return fmt.Errorf("group %s: unsupported gid %s", a.Group, g.Gid)
+		}
+	}
+	return os.Chown(a.Addr, uid, gid)
+}
+
+// ParseAddress parses s, which is either a TCP address
+// ([host]:port) or a socket path prefixed with "unix:".
+func ParseAddress(s string) (Address, error) {
+	if strings.HasPrefix(s, "unix:") {
+		path := strings.TrimPrefix(s, "unix:")
+		if path == "" {
+			return Address{}, errors.New("missing socket path")
+		}
+		return Address{Network: "unix", Addr: path}, nil
+	}
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return Address{}, err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return Address{}, fmt.Errorf("invalid port '%s'", port)
+	}
+	return Address{Network: "tcp", Addr: net.JoinHostPort(host, port)}, nil
+}
+
+// sharedListener is a listener shared by all the
+// servers that listen on its address.
+type sharedListener struct {
+	net.Listener
+	key   string
+	refs  int
+	conns chan net.Conn
+	errs  chan error
+	done  chan struct{}
+}
+
+// accept accepts connections and hands them to
+// whoever is accepting on the shared listener.
+func (sl *sharedListener) accept() {
+	for {
+		conn, err := sl.Listener.Accept()
+		if err != nil {
+			select {
+			case sl.errs <- err:
+			case <-sl.done:
+				return
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		select {
+		case sl.conns <- conn:
+		case <-sl.done:
+			conn.Close()
+			return
+		}
+	}
+}
+
+// acquire returns a listener on a, opening a new
+// shared listener if there is none already.
+func acquire(a Address) (net.Listener, error) {
+	key := a.Network + "/" + a.Addr
+
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+
+	sl, ok := shared[key]
+	if !ok {
+		ln, err := a.listen()
+		if err != nil {
+			return nil, err
+		}
+		if ul, ok := ln.(*net.UnixListener); ok {
+			// another server may take over the socket
+			// before we close it, so leave the file be
+			ul.SetUnlinkOnClose(false)
+		}
+		sl = &sharedListener{
+			Listener: ln,
+			key:      key,
+			conns:    make(chan net.Conn),
+			errs:     make(chan error),
+			done:     make(chan struct{}),
+		}
+		shared[key] = sl
+		go sl.accept()
+	}
+	sl.refs++
+	return &listener{shared: sl, closed: make(chan struct{})}, nil
+}
+
+// listener is one server's reference to a sharedListener.
+type listener struct {
+	shared    *sharedListener
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Accept accepts a connection on the shared listener.
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.shared.conns:
+		return conn, nil
+	case err := <-l.shared.errs:
+		return nil, err
+	case <-l.closed:
+		return nil, errClosed
+	}
+}
+
+// Close releases l; the shared listener is closed
+// once no servers listen on it anymore.
+func (l *listener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		sharedMu.Lock()
+		defer sharedMu.Unlock()
+		l.shared.refs--
+		if l.shared.refs == 0 {
+			delete(shared, l.shared.key)
+			close(l.shared.done)
+			err = l.shared.Listener.Close()
+		}
+	})
+	return err
+}
+
+// Addr returns the address of the shared listener.
+func (l *listener) Addr() net.Addr {
+	return l.shared.Listener.Addr()
+}
+
+var (
+	shared   = make(map[string]*sharedListener)
+	sharedMu sync.Mutex
+)
+
+// errClosed is returned by Accept after Close.
+var errClosed = errors.New("use of closed network connection")
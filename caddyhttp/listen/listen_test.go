@@ -0,0 +1,143 @@
+package listen
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseAddress(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		expected  Address
+		shouldErr bool
+	}{
+		{":8080", Address{Network: "tcp", Addr: ":8080"}, false},
+		{"127.0.0.1:8080", Address{Network: "tcp", Addr: "127.0.0.1:8080"}, false},
+		{"[::1]:8080", Address{Network: "tcp", Addr: "[::1]:8080"}, false},
+		{"unix:/run/caddy.sock", Address{Network: "unix", Addr: "/run/caddy.sock"}, false},
+		{"unix:", Address{}, true},
+		{"localhost", Address{}, true},
+		{"localhost:http", Address{}, true},
+		{":99999", Address{}, true},
+	} {
+		actual, err := ParseAddress(test.input)
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: Expected error %v, got: %v", i, test.shouldErr, err)
+			continue
+		}
+		if actual != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "caddy.sock")
+
+	// a stale socket file is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	addr := Address{Network: "unix", Addr: path, Mode: 0600}
+	ln, err := addr.Listen(nil)
+	if err != nil {
+		t.Fatalf("Expected no error listening, got: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected socket mode 0600, got %v", info.Mode().Perm())
+	}
+
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	client := &http.Client{Transport: &http.Transport{
+		Dial: func(string, string) (net.Conn, error) { return net.Dial("unix", path) },
+	}}
+	resp, err := client.Get("http://localhost/")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello" {
+		t.Errorf("Expected 'hello', got '%s'", body)
+	}
+	ln.Close()
+
+	// a file that is not a socket is left alone
+	notSocket := filepath.Join(dir, "file")
+	ioutil.WriteFile(notSocket, nil, 0600)
+	if _, err := (Address{Network: "unix", Addr: notSocket}).Listen(nil); err == nil {
+		t.Error("Expected error listening on regular file, got none")
+	}
+}
+
+func TestSharedListener(t *testing.T) {
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := Address{Network: "tcp", Addr: free.Addr().String()}
+	free.Close()
+
+	ln1, err := addr.Listen(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// listen on the same address again, as a restart would
+	ln2, err := addr.Listen(nil)
+	if err != nil {
+		t.Fatalf("Expected to share listener, got: %v", err)
+	}
+	if err := ln1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ln1.Accept(); err == nil {
+		t.Error("Expected error accepting on closed listener")
+	}
+
+	// the address is still served by the remaining listener
+	accepted := make(chan struct{})
+	go func() {
+		if conn, err := ln2.Accept(); err == nil {
+			conn.Close()
+			close(accepted)
+		}
+	}()
+	conn, err := net.Dial("tcp", addr.Addr)
+	if err != nil {
+		t.Fatalf("Expected to connect, got: %v", err)
+	}
+	conn.Close()
+	select {
+	case <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for connection")
+	}
+
+	// closing the last listener frees the address
+	ln2.Close()
+	ln3, err := net.Listen("tcp", addr.Addr)
+	if err != nil {
+		t.Fatalf("Expected address to be free, got: %v", err)
+	}
+	ln3.Close()
+}
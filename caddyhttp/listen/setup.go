@@ -0,0 +1,103 @@
+package listen
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("listen", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup adds listeners to the site. Syntax:
+//
+//	listen addresses... {
+//	    mode  permissions
+//	    owner user[:group]
+//	}
+//
+// Addresses are [host]:port or unix:path. Mode (in octal) and
+// owner apply to the Unix sockets. The site's TLS settings apply
+// to TCP addresses; Unix sockets are served in plaintext.
+func setup(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+
+	addrs, err := parseListen(c)
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range addrs {
+		config.AddListener(addr.Listen)
+	}
+
+	return nil
+}
+
+func parseListen(c *caddy.Controller) ([]Address, error) {
+	var all []Address
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return nil, c.ArgErr()
+		}
+		var addrs []Address
+		var hasSocket bool
+		for _, arg := range args {
+			addr, err := ParseAddress(arg)
+			if err != nil {
+				return nil, c.Errf("invalid listen address '%s': %v", arg, err)
+			}
+			hasSocket = hasSocket || addr.Network == "unix"
+			addrs = append(addrs, addr)
+		}
+
+		var mode os.FileMode
+		var owner, group string
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return nil, c.ArgErr()
+			}
+			switch what {
+			case "mode":
+				m, err := strconv.ParseUint(c.Val(), 8, 32)
+				if err != nil || m > 0777 {
+					return nil, c.Errf("invalid socket mode '%s'", c.Val())
+				}
+				mode = os.FileMode(m)
+			case "owner":
+				parts := strings.SplitN(c.Val(), ":", 2)
+				owner = parts[0]
+				if len(parts) == 2 {
+					group = parts[1]
+				}
+			default:
+				return nil, c.Errf("unknown listen property '%s'", what)
+			}
+			if !hasSocket {
+				return nil, c.Errf("%s only applies to unix: addresses", what)
+			}
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+		}
+
+		for i := range addrs {
+			if addrs[i].Network == "unix" {
+				addrs[i].Mode, addrs[i].Owner, addrs[i].Group = mode, owner, group
+			}
+		}
+		all = append(all, addrs...)
+	}
+
+	return all, nil
+}
@@ -0,0 +1,58 @@
+package listen
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+)
+
+func TestParseListen(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []Address
+	}{
+		{`listen :8080`, false, []Address{{Network: "tcp", Addr: ":8080"}}},
+		{`listen :8080 unix:/run/a.sock {
+			mode  0660
+			owner www:caddy
+		}`, false, []Address{
+			{Network: "tcp", Addr: ":8080"},
+			{Network: "unix", Addr: "/run/a.sock", Mode: 0660, Owner: "www", Group: "caddy"},
+		}},
+		{"listen unix:/run/a.sock {\nowner www\n}\nlisten :9090", false, []Address{
+			{Network: "unix", Addr: "/run/a.sock", Owner: "www"},
+			{Network: "tcp", Addr: ":9090"},
+		}},
+		{`listen`, true, nil},
+		{`listen example.com`, true, nil},
+		{`listen :8080 {
+			mode 0660
+		}`, true, nil},
+		{`listen unix:/run/a.sock {
+			mode 999
+		}`, true, nil},
+		{`listen unix:/run/a.sock {
+			mode
+		}`, true, nil},
+		{`listen unix:/run/a.sock {
+			group caddy
+		}`, true, nil},
+	} {
+		actual, err := parseListen(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Package listeneropts tunes the sockets of a site's listener.
+package listeneropts
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("listener_options", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupListenerOptions,
+	})
+}
+
+// setupListenerOptions sets the listener options of the site. Syntax:
+//
+//	listener_options {
+//	    reuseport
+//	    fastopen      [queue]
+//	    nodelay       on|off
+//	    tcp_keepalive period|off
+//	    backlog       length
+//	}
+//
+// Sites on the same address share a listener, so they must
+// not set different options. Options that apply to the socket
+// (reuseport, fastopen, and backlog) take effect when the
+// listener is created, not when it is kept over a restart.
+func setupListenerOptions(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+
+	opts, err := parseListenerOptions(c)
+	if err != nil {
+		return err
+	}
+	config.ListenerOptions = opts
+
+	return nil
+}
+
+func parseListenerOptions(c *caddy.Controller) (httpserver.ListenerOptions, error) {
+	var opts httpserver.ListenerOptions
+
+	for c.Next() {
+		if len(c.RemainingArgs()) > 0 {
+			return opts, c.ArgErr()
+		}
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "reuseport":
+				if len(args) != 0 {
+					return opts, c.ArgErr()
+				}
+				opts.ReusePort = true
+			case "fastopen":
+				switch len(args) {
+				case 0:
+					opts.FastOpen = defaultFastOpenQueue
+				case 1:
+					n, err := parsePositive(c, args[0])
+					if err != nil {
+						return opts, err
+					}
+					opts.FastOpen = n
+				default:
+					return opts, c.ArgErr()
+				}
+			case "nodelay":
+				if len(args) != 1 {
+					return opts, c.ArgErr()
+				}
+				if args[0] != "on" && args[0] != "off" {
+					return opts, c.Errf("nodelay must be on or off, not '%s'", args[0])
+				}
+				opts.NoDelay = args[0]
+			case "tcp_keepalive":
+				if len(args) != 1 {
+					return opts, c.ArgErr()
+				}
+				if args[0] == "off" {
+					opts.KeepAlive = -1
+					break
+				}
+				period, err := time.ParseDuration(args[0])
+				if err != nil || period < time.Second {
+					return opts, c.Errf("invalid keep-alive period '%s'", args[0])
+				}
+				opts.KeepAlive = period
+			case "backlog":
+				if len(args) != 1 {
+					return opts, c.ArgErr()
+				}
+				n, err := parsePositive(c, args[0])
+				if err != nil {
+					return opts, err
+				}
+				opts.Backlog = n
+			default:
+				return opts, c.Errf("unknown listener option '%s'", what)
+			}
+		}
+	}
+
+	return opts, nil
+}
+
+func parsePositive(c *caddy.Controller, s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, c.Errf("%s must be a positive number, not '%s'", c.Val(), s)
+	}
+	return n, nil
+}
+
+// defaultFastOpenQueue is the TCP Fast Open queue
+// length if none is given.
+const defaultFastOpenQueue = 256
@@ -0,0 +1,71 @@
+package listeneropts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupListenerOptions(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  httpserver.ListenerOptions
+	}{
+		{"listener_options {\n}", false, httpserver.ListenerOptions{}},
+		{`listener_options {
+			reuseport
+			fastopen
+			nodelay off
+			tcp_keepalive 30s
+			backlog 4096
+		}`, false, httpserver.ListenerOptions{
+			ReusePort: true,
+			FastOpen:  defaultFastOpenQueue,
+			NoDelay:   "off",
+			KeepAlive: 30 * time.Second,
+			Backlog:   4096,
+		}},
+		{`listener_options {
+			fastopen 16
+			tcp_keepalive off
+		}`, false, httpserver.ListenerOptions{FastOpen: 16, KeepAlive: -1}},
+		{`listener_options reuseport`, true, httpserver.ListenerOptions{}},
+		{`listener_options {
+			reuseport yes
+		}`, true, httpserver.ListenerOptions{}},
+		{`listener_options {
+			fastopen 0
+		}`, true, httpserver.ListenerOptions{}},
+		{`listener_options {
+			nodelay maybe
+		}`, true, httpserver.ListenerOptions{}},
+		{`listener_options {
+			tcp_keepalive 10ms
+		}`, true, httpserver.ListenerOptions{}},
+		{`listener_options {
+			backlog
+		}`, true, httpserver.ListenerOptions{}},
+		{`listener_options {
+			linger 5
+		}`, true, httpserver.ListenerOptions{}},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setupListenerOptions(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if got := httpserver.GetConfig(c).ListenerOptions; got != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, got)
+		}
+	}
+}
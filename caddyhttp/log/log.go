@@ -13,8 +13,9 @@ import (
 
 func init() {
 	caddy.RegisterPlugin("log", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
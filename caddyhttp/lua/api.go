@@ -0,0 +1,90 @@
+package lua
+
+import (
+	"net/http"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// requestTable makes the table that scripts are given r as. It has
+// the fields method, path, query, host and remote_addr, and the
+// functions header(name), set_header(name, value), set_path(path)
+// and set_query(query); setting a header to nil deletes it.
+func requestTable(L *lua.LState, r *http.Request) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("method", lua.LString(r.Method))
+	t.RawSetString("path", lua.LString(r.URL.Path))
+	t.RawSetString("query", lua.LString(r.URL.RawQuery))
+	t.RawSetString("host", lua.LString(r.Host))
+	t.RawSetString("remote_addr", lua.LString(r.RemoteAddr))
+	setHeaderFuncs(L, t, r.Header)
+	setFunc(L, t, "set_path", func(L *lua.LState, arg int) int {
+		r.URL.Path = L.CheckString(arg)
+		r.URL.RawPath = ""
+		t.RawSetString("path", lua.LString(r.URL.Path))
+		return 0
+	})
+	setFunc(L, t, "set_query", func(L *lua.LState, arg int) int {
+		r.URL.RawQuery = L.CheckString(arg)
+		t.RawSetString("query", lua.LString(r.URL.RawQuery))
+		return 0
+	})
+	return t
+}
+
+// responseTable makes the table that scripts are given the
+// response written to w as. It has the functions header(name)
+// and set_header(name, value), and if status is not nil, the
+// field status and the function set_status(status).
+func responseTable(L *lua.LState, w http.ResponseWriter, status *int) *lua.LTable {
+	t := L.NewTable()
+	setHeaderFuncs(L, t, w.Header())
+	if status != nil {
+		t.RawSetString("status", lua.LNumber(*status))
+		setFunc(L, t, "set_status", func(L *lua.LState, arg int) int {
+			code := L.CheckInt(arg)
+			if code < 100 || code > 999 {
+				L.ArgError(arg, "invalid status")
+			}
+			*status = code
+			t.RawSetString("status", lua.LNumber(code))
+			return 0
+		})
+	}
+	return t
+}
+
+// setHeaderFuncs sets the functions header and set_header
+// of t, which get and set fields of h.
+func setHeaderFuncs(L *lua.LState, t *lua.LTable, h http.Header) {
+	setFunc(L, t, "header", func(L *lua.LState, arg int) int {
+		value := h.Get(L.CheckString(arg))
+		if value == "" {
+			L.Push(lua.LNil)
+		} else {
+			L.Push(lua.LString(value))
+		}
+		return 1
+	})
+	setFunc(L, t, "set_header", func(L *lua.LState, arg int) int {
+		name := L.CheckString(arg)
+		if L.Get(arg+1) == lua.LNil {
+			h.Del(name)
+		} else {
+			h.Set(name, L.CheckString(arg+1))
+		}
+		return 0
+	})
+}
+
+// setFunc sets the function name of t to fn, which is given
+// the index of its first argument, so that it may be called
+// as t.name(...) or as t:name(...).
+func setFunc(L *lua.LState, t *lua.LTable, name string, fn func(L *lua.LState, arg int) int) {
+	t.RawSetString(name, L.NewFunction(func(L *lua.LState) int {
+		if L.Get(1) == t {
+			return fn(L, 2)
+		}
+		return fn(L, 1)
+	}))
+}
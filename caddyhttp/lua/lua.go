@@ -0,0 +1,140 @@
+// Package lua provides middleware that runs Lua scripts on
+// requests and responses, for logic that no directive has.
+package lua
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Lua is middleware that runs scripts on requests and responses.
+type Lua struct {
+	Next  httpserver.Handler
+	Rules []Rule
+}
+
+// Rule is a script that runs on the requests under Path.
+type Rule struct {
+	Path   string
+	Script *Script
+}
+
+// ServeHTTP implements the httpserver.Handler interface. The
+// on_request function of each script is called with the request
+// and the response, and may change them, or respond itself by
+// returning a status and, optionally, a body. The on_response
+// function is called with them when the header is written.
+func (l Lua) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, rule := range l.Rules {
+		if !httpserver.Path(r.URL.Path).Matches(rule.Path) {
+			continue
+		}
+		s := rule.Script
+		if s.onRequest {
+			status, body, err := s.call(r.Context(), "on_request", func(L *lua.LState) []lua.LValue {
+				return []lua.LValue{requestTable(L, r), responseTable(L, w, nil)}
+			})
+			if err != nil {
+				return http.StatusInternalServerError, fmt.Errorf("lua %s: %v", s.Name, err)
+			}
+			if code, ok := status.(lua.LNumber); ok && code > 0 {
+				return respond(w, int(code), body)
+			}
+		}
+		if s.onResponse {
+			w = &scriptWriter{ResponseWriter: w, script: s, r: r}
+		}
+	}
+	return l.Next.ServeHTTP(w, r)
+}
+
+// respond writes the response that a script returned.
+// Error responses without a body are left to be written
+// as error pages are.
+func respond(w http.ResponseWriter, status int, body lua.LValue) (int, error) {
+	text, ok := body.(lua.LString)
+	if !ok {
+		if status >= 400 {
+			return status, nil
+		}
+		w.WriteHeader(status)
+		return 0, nil
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(text))
+	return 0, nil
+}
+
+// scriptWriter calls the on_response function of a
+// script when the header of a response is written.
+type scriptWriter struct {
+	http.ResponseWriter
+	script      *Script
+	r           *http.Request
+	wroteHeader bool
+}
+
+// WriteHeader calls on_response, which may change the
+// status and the header, and then writes the header.
+func (w *scriptWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	_, _, err := w.script.call(w.r.Context(), "on_response", func(L *lua.LState) []lua.LValue {
+		return []lua.LValue{requestTable(L, w.r), responseTable(L, w.ResponseWriter, &status)}
+	})
+	if err != nil {
+		log.Printf("[ERROR] lua %s: %v", w.script.Name, err)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes the header, if it was not yet, and then p.
+func (w *scriptWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher. It simply wraps the underlying
+// ResponseWriter's Flush method if there is one, or panics.
+func (w *scriptWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	} else {
+		panic(httpserver.NonFlusherError{Underlying: w.ResponseWriter}) // should be recovered at the beginning of middleware stack
+	}
+}
+
+// Hijack implements http.Hijacker. It simply wraps the underlying
+// ResponseWriter's Hijack method if there is one, or returns an error.
+func (w *scriptWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, httpserver.NonHijackerError{Underlying: w.ResponseWriter}
+}
+
+// CloseNotify implements http.CloseNotifier.
+// It just inherits the underlying ResponseWriter's CloseNotify method.
+// It panics if the underlying ResponseWriter is not a CloseNotifier.
+func (w *scriptWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	panic(httpserver.NonCloseNotifierError{Underlying: w.ResponseWriter})
+}
@@ -0,0 +1,186 @@
+package lua
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func newScript(t *testing.T, src string) *Script {
+	s, err := NewScript("test.lua", strings.NewReader(src), 100*time.Millisecond, 5120, 8<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestLua(t *testing.T) {
+	s := newScript(t, `
+count = 0
+
+function on_request(req, res)
+	count = count + 1
+	if req.header("Authorization") == nil and req.path ~= "/public" then
+		res.set_header("WWW-Authenticate", "Token")
+		return 401
+	end
+	if req.path == "/old" then
+		req:set_path("/new")
+	end
+	if req.query == "teapot" then
+		res.set_header("Content-Type", "application/json")
+		return 418, "{\"short\": true}"
+	end
+	req.set_header("X-Script", "ran")
+	req.set_header("Cookie", nil)
+end
+
+function on_response(req, res)
+	res.set_header("X-Path", req.path)
+	if res.status == 404 and req.path == "/new" then
+		res:set_status(410)
+	end
+	res.set_header("Server", nil)
+end
+`)
+	l := Lua{
+		Rules: []Rule{{Path: "/", Script: s}},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("Server", "backend")
+			w.Header().Set("X-Seen", r.Header.Get("X-Script")+" "+r.Header.Get("Cookie"))
+			if r.URL.Path != "/public" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+			w.Write([]byte(r.URL.Path))
+			return 0, nil
+		}),
+	}
+
+	for i, test := range []struct {
+		path, auth string
+		status     int
+		body       string
+		header     http.Header
+	}{
+		{"/private", "", http.StatusUnauthorized, "", http.Header{"Www-Authenticate": {"Token"}}},
+		{"/public", "", http.StatusOK, "/public", http.Header{"X-Seen": {"ran "}, "X-Path": {"/public"}, "Server": nil}},
+		{"/old", "Token t", http.StatusGone, "/new", http.Header{"X-Path": {"/new"}}},
+		{"/private?teapot", "Token t", http.StatusTeapot, `{"short": true}`, http.Header{"Content-Type": {"application/json"}}},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.Header.Set("Cookie", "session=1")
+		if test.auth != "" {
+			r.Header.Set("Authorization", test.auth)
+		}
+		w := httptest.NewRecorder()
+		status, err := l.ServeHTTP(w, r)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if status == 0 {
+			status = w.Code
+		}
+		if status != test.status {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.status, status)
+		}
+		if w.Body.String() != test.body {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.body, w.Body.String())
+		}
+		for name, values := range test.header {
+			if got := w.Header()[name]; strings.Join(got, ",") != strings.Join(values, ",") {
+				t.Errorf("Test %d: Expected header %s to be %v, got %v", i, name, values, got)
+			}
+		}
+	}
+}
+
+func TestLuaSandbox(t *testing.T) {
+	for i, src := range []string{
+		`function on_request(req) while true do end end`,
+		`function on_request(req) local f = io.open("/etc/passwd") end`,
+		`function on_request(req) os.execute("true") end`,
+		`function on_request(req) dofile("/etc/passwd") end`,
+		`function on_request(req) loadstring("return 1")() end`,
+		`function on_request(req) require("os") end`,
+		`function on_request(req) local s = string.rep("x", 1e9) end`,
+		`function on_request(req) local function f() return f() + 1 end f() end`,
+	} {
+		s := newScript(t, src)
+		start := time.Now()
+		_, _, err := s.call(httptest.NewRequest("GET", "/", nil).Context(), "on_request", func(L *lua.LState) []lua.LValue {
+			return []lua.LValue{L.NewTable()}
+		})
+		if err == nil {
+			t.Errorf("Test %d: Expected script to be stopped, but it was not", i)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("Test %d: Expected script to be stopped at its timeout, took %v", i, d)
+		}
+	}
+
+	if _, err := NewScript("empty.lua", strings.NewReader(`x = 1`), time.Second, 5120, 8<<20); err == nil {
+		t.Error("Expected error for a script without functions")
+	}
+	if _, err := NewScript("broken.lua", strings.NewReader(`function on_request(`), time.Second, 5120, 8<<20); err == nil {
+		t.Error("Expected error for a script that does not compile")
+	}
+}
+
+func TestLuaMemory(t *testing.T) {
+	for i, src := range []string{
+		`function on_request(req) local s = "x" while true do s = s .. s end end`,
+		`function on_request(req) local s = "x" while true do s = s .. s .. s .. s .. s end end`,
+		`function on_request(req) local t = {} for i = 1, 1e9 do t[i] = string.rep("x", 1000) .. i end end`,
+		`t = {} function on_request(req) for i = 1, 1e9 do t[i] = {i} end end`,
+		`local t = {} function on_request(req) for i = 1, 1e9 do t[#t + 1] = tostring(i) end end`,
+		`function on_request(req) local s = string.rep("x", 2000) local t = {} for i = 1, 1000 do t[i] = s end table.concat(t) end`,
+		`function on_request(req) local s = string.rep("x", 2000) s:gsub("x", s) end`,
+		`function on_request(req) local s = string.rep("x", 2000) s:gsub("x", function() return s end) end`,
+		`function on_request(req) local s = string.rep("x", 2000) s:gsub("x", {x = s}) end`,
+		`function on_request(req) string.format("%999999d%999999d", 1, 2) end`,
+	} {
+		s, err := NewScript("test.lua", strings.NewReader(src), time.Minute, 5120, 1<<20)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		start := time.Now()
+		_, _, err = s.call(httptest.NewRequest("GET", "/", nil).Context(), "on_request", func(L *lua.LState) []lua.LValue {
+			return []lua.LValue{L.NewTable()}
+		})
+		if err == nil || !strings.Contains(err.Error(), errMemoryLimit.Error()) {
+			t.Errorf("Test %d: Expected script to be stopped for its memory, got: %v", i, err)
+		}
+		if d := time.Since(start); d > 10*time.Second {
+			t.Errorf("Test %d: Expected script to be stopped before its timeout, took %v", i, d)
+		}
+	}
+
+	// what the script makes when it is loaded counts too
+	if _, err := NewScript("big.lua", strings.NewReader(`s = "x" while true do s = s .. s end`), time.Minute, 5120, 1<<20); err == nil {
+		t.Error("Expected error for a script that takes too much memory when loaded")
+	}
+
+	// within the limit
+	s, err := NewScript("test.lua", strings.NewReader(`
+local cache = {}
+function on_request(req)
+	for i = 1, 1000 do cache[i] = string.rep("x", 100) .. i end
+	local s = table.concat(cache, ",")
+	s = s:gsub(",", ";")
+	return 200, string.format("%5d", #s)
+end`), time.Minute, 5120, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _, err := s.call(httptest.NewRequest("GET", "/", nil).Context(), "on_request", func(L *lua.LState) []lua.LValue {
+		return []lua.LValue{L.NewTable()}
+	})
+	if err != nil || status != lua.LNumber(200) {
+		t.Errorf("Expected script within its memory to run, got status %v and error %v", status, err)
+	}
+}
@@ -0,0 +1,290 @@
+package lua
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// memoryGuard is the context of a call, which stops it when what the
+// script holds is larger than its Memory. The state calls Done before
+// each instruction, so that is when it checks: every time, whether
+// one of the strings the running function has is too large, and now
+// and then, whether all the strings and tables that the function and
+// the globals refer to are. That is after tableCheckSteps instructions,
+// or as many as the entries of the tables last time, if more, so that
+// checking large tables does not take longer than making them.
+type memoryGuard struct {
+	context.Context
+	L        *lua.LState
+	max      int
+	skip     map[lua.LValue]bool
+	steps    int
+	exceeded bool
+}
+
+// errMemoryLimit is the error of calls stopped by their memoryGuard.
+var errMemoryLimit = errors.New("memory limit exceeded")
+
+// done is returned by Done once the limit is exceeded.
+var done = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// Done implements context.Context.
+func (g *memoryGuard) Done() <-chan struct{} {
+	if !g.exceeded {
+		g.steps++
+		g.exceeded = g.largeString()
+		if !g.exceeded && g.steps >= tableCheckSteps {
+			size, entries := g.size()
+			g.exceeded = size > g.max
+			g.steps = tableCheckSteps - entries
+		}
+	}
+	if g.exceeded {
+		return done
+	}
+	return g.Context.Done()
+}
+
+// Err implements context.Context.
+func (g *memoryGuard) Err() error {
+	if g.exceeded {
+		return errMemoryLimit
+	}
+	return g.Context.Err()
+}
+
+// largeString returns whether a string in the registers
+// of the running function is larger than the limit.
+func (g *memoryGuard) largeString() bool {
+	for i, top := 1, g.L.GetTop(); i <= top; i++ {
+		if s, ok := g.L.Get(i).(lua.LString); ok && len(s) > g.max {
+			return true
+		}
+	}
+	return false
+}
+
+// size returns roughly how many bytes the values that the running
+// function and the globals refer to take, or more than the limit
+// once they are found to take more, and the entries of their tables.
+// The libraries are not counted.
+func (g *memoryGuard) size() (int, int) {
+	c := &counter{seen: make(map[lua.LValue]bool), skip: g.skip, max: g.max}
+	for i, top := 1, g.L.GetTop(); i <= top; i++ {
+		c.add(g.L.Get(i))
+	}
+	c.add(g.L.G.Global)
+	return c.total, c.entries
+}
+
+// counter adds up the sizes of values and what they refer to.
+type counter struct {
+	seen    map[lua.LValue]bool
+	skip    map[lua.LValue]bool
+	total   int
+	entries int
+	max     int
+}
+
+// add adds the size of v, and of the values it refers to
+// if it is a table or a function, unless it was added.
+func (c *counter) add(v lua.LValue) {
+	if c.total > c.max {
+		return
+	}
+	switch v := v.(type) {
+	case lua.LString:
+		c.total += len(v)
+	case *lua.LTable:
+		if c.seen[v] {
+			return
+		}
+		c.seen[v] = true
+		v.ForEach(func(key, value lua.LValue) {
+			if c.skip[value] {
+				return
+			}
+			c.total += tableEntrySize
+			c.entries++
+			c.add(key)
+			c.add(value)
+		})
+		if mt, ok := v.Metatable.(*lua.LTable); ok {
+			c.add(mt)
+		}
+	case *lua.LFunction:
+		if c.seen[v] || c.skip[v] {
+			return
+		}
+		c.seen[v] = true
+		for _, uv := range v.Upvalues {
+			c.add(uv.Value())
+		}
+	}
+}
+
+// libraryValues returns the globals of L, and what their tables
+// have, which are those of the libraries before the script runs.
+func libraryValues(L *lua.LState) map[lua.LValue]bool {
+	values := make(map[lua.LValue]bool)
+	L.G.Global.ForEach(func(_, value lua.LValue) {
+		values[value] = true
+		if t, ok := value.(*lua.LTable); ok && t != L.G.Global {
+			t.ForEach(func(_, value lua.LValue) {
+				values[value] = true
+			})
+		}
+	})
+	return values
+}
+
+// rep is string.rep, but refuses to make
+// strings larger than the memory limit.
+func (s *Script) rep(L *lua.LState) int {
+	str := L.CheckString(1)
+	n := L.CheckInt(2)
+	if n > 0 && len(str) > 0 && n > s.Memory/len(str) {
+		L.RaiseError("string.rep: %v", errMemoryLimit)
+		return 0
+	}
+	if n < 0 {
+		n = 0
+	}
+	L.Push(lua.LString(strings.Repeat(str, n)))
+	return 1
+}
+
+// concat wraps table.concat, refusing to make
+// strings larger than the memory limit.
+func (s *Script) concat(concat lua.LGFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		t := L.CheckTable(1)
+		sep := L.OptString(2, "")
+		i := L.OptInt(3, 1)
+		j := L.OptInt(4, t.Len())
+		if i < 1 {
+			i = 1
+		}
+		if j > t.Len() {
+			j = t.Len()
+		}
+		size := 0
+		for k := i; k <= j && size <= s.Memory; k++ {
+			size += len(lua.LVAsString(t.RawGetInt(k)))
+			if k < j {
+				size += len(sep)
+			}
+		}
+		if size > s.Memory {
+			L.RaiseError("table.concat: %v", errMemoryLimit)
+			return 0
+		}
+		return concat(L)
+	}
+}
+
+// gsub wraps string.gsub, refusing to make strings larger than
+// the memory limit. A function or table to replace matches with
+// is called through one that counts what they are replaced with;
+// a string is counted for each match, as if each of its captures
+// were the whole string.
+func (s *Script) gsub(gsub *lua.LFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		str := L.CheckString(1)
+		pattern := L.CheckString(2)
+		repl := L.CheckAny(3)
+		limit := L.Get(4)
+		size := len(str)
+
+		if text, ok := repl.(lua.LString); ok {
+			// count the matches, replacing none of them
+			L.Push(gsub)
+			L.Push(lua.LString(str))
+			L.Push(lua.LString(pattern))
+			L.Push(L.NewFunction(func(L *lua.LState) int { return 0 }))
+			L.Push(limit)
+			L.Call(4, 2)
+			n := int(L.ToNumber(-1))
+			L.Pop(2)
+			each := len(text) + strings.Count(string(text), "%")*len(str)
+			if n > 0 && each > (s.Memory-size)/n {
+				L.RaiseError("string.gsub: %v", errMemoryLimit)
+				return 0
+			}
+			return gsub.GFunction(L)
+		}
+
+		L.Replace(3, L.NewFunction(func(L *lua.LState) int {
+			var value lua.LValue
+			switch repl := repl.(type) {
+			case *lua.LFunction:
+				args := make([]lua.LValue, L.GetTop())
+				for i := range args {
+					args[i] = L.Get(i + 1)
+				}
+				L.CallByParam(lua.P{Fn: repl, NRet: 1}, args...)
+				value = L.Get(-1)
+				L.Pop(1)
+			default:
+				value = L.GetTable(repl, L.Get(1))
+			}
+			if size += len(lua.LVAsString(value)); size > s.Memory {
+				L.RaiseError("string.gsub: %v", errMemoryLimit)
+				return 0
+			}
+			L.Push(value)
+			return 1
+		}))
+		return gsub.GFunction(L)
+	}
+}
+
+// format wraps string.format, refusing to make strings larger
+// than the memory limit. Each argument is counted as being
+// padded to the largest width or precision in the format.
+func (s *Script) format(format lua.LGFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		str := L.CheckString(1)
+		var pad int
+		for _, field := range strings.FieldsFunc(str, func(r rune) bool { return r < '0' || r > '9' }) {
+			if len(field) > 9 {
+				pad = s.Memory + 1
+				break
+			}
+			n := 0
+			for _, d := range field {
+				n = n*10 + int(d-'0')
+			}
+			if n > pad {
+				pad = n
+			}
+		}
+		size := len(str)
+		for i, top := 2, L.GetTop(); i <= top && size <= s.Memory; i++ {
+			// quoting may double a string
+			size += pad + 2*len(lua.LVAsString(L.Get(i)))
+		}
+		if size > s.Memory {
+			L.RaiseError("string.format: %v", errMemoryLimit)
+			return 0
+		}
+		return format(L)
+	}
+}
+
+const (
+	// tableCheckSteps is how many instructions are run, at
+	// least, between the checks of the size of all values.
+	tableCheckSteps = 256
+
+	// tableEntrySize is roughly how many bytes an
+	// entry of a table takes, besides its values.
+	tableEntrySize = 40
+)
@@ -0,0 +1,188 @@
+package lua
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// Script is a Lua script that handles requests and responses
+// with the functions it defines, on_request and on_response.
+// It is compiled once, and run in states that are reused, since
+// a state may only run one call at a time; so what a script
+// keeps in globals across calls may or may not be there.
+//
+// Scripts are sandboxed: they have only the base, string, table
+// and math libraries, so they cannot open files, run commands or
+// load other code; each call may run for Timeout; each state has
+// a stack of Stack values, which does not grow; and a call is
+// stopped when the strings and tables it holds, including the
+// globals, take more than about Memory bytes.
+type Script struct {
+	Name    string
+	Timeout time.Duration
+	Stack   int
+	Memory  int
+
+	proto      *lua.FunctionProto
+	onRequest  bool
+	onResponse bool
+	states     chan *state
+}
+
+// state is a state of a script, with the values of its
+// libraries, which do not count against its memory.
+type state struct {
+	*lua.LState
+	libraries map[lua.LValue]bool
+}
+
+// NewScript compiles the script read from src, which is called
+// name, and runs it once, which must define on_request or
+// on_response, or both.
+func NewScript(name string, src io.Reader, timeout time.Duration, stack, memory int) (*Script, error) {
+	chunk, err := parse.Parse(src, name)
+	if err != nil {
+		return nil, err
+	}
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return nil, err
+	}
+	s := &Script{
+		Name:    name,
+		Timeout: timeout,
+		Stack:   stack,
+		Memory:  memory,
+		proto:   proto,
+		states:  make(chan *state, maxIdleStates),
+	}
+	L, err := s.newState()
+	if err != nil {
+		return nil, err
+	}
+	s.onRequest = L.GetGlobal("on_request").Type() == lua.LTFunction
+	s.onResponse = L.GetGlobal("on_response").Type() == lua.LTFunction
+	if !s.onRequest && !s.onResponse {
+		L.Close()
+		return nil, fmt.Errorf("%s defines neither on_request nor on_response", name)
+	}
+	s.put(L)
+	return s, nil
+}
+
+// newState makes a state with the sandboxed libraries,
+// in which the script was run.
+func (s *Script) newState() (*state, error) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true, RegistrySize: s.Stack})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require", "module"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	L.SetGlobal("print", L.NewFunction(s.print))
+	str := L.GetGlobal("string").(*lua.LTable)
+	str.RawSetString("rep", L.NewFunction(s.rep))
+	str.RawSetString("gsub", L.NewFunction(s.gsub(str.RawGetString("gsub").(*lua.LFunction))))
+	str.RawSetString("format", L.NewFunction(s.format(str.RawGetString("format").(*lua.LFunction).GFunction)))
+	tab := L.GetGlobal("table").(*lua.LTable)
+	tab.RawSetString("concat", L.NewFunction(s.concat(tab.RawGetString("concat").(*lua.LFunction).GFunction)))
+	st := &state{LState: L, libraries: libraryValues(L)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	L.SetContext(s.guard(ctx, st))
+	L.Push(L.NewFunctionFromProto(s.proto))
+	if err := L.PCall(0, 0, nil); err != nil {
+		L.Close()
+		return nil, err
+	}
+	L.RemoveContext()
+	return st, nil
+}
+
+// get returns an idle state, or a new one if none is.
+func (s *Script) get() (*state, error) {
+	select {
+	case L := <-s.states:
+		return L, nil
+	default:
+		return s.newState()
+	}
+}
+
+// put keeps L to be used again, unless enough states are idle.
+func (s *Script) put(L *state) {
+	select {
+	case s.states <- L:
+	default:
+		L.Close()
+	}
+}
+
+// call calls the function hook of the script, if it defines it,
+// with the arguments that args makes, and returns what it returned.
+// The call is stopped when ctx is done or after Timeout.
+func (s *Script) call(ctx context.Context, hook string, args func(L *lua.LState) []lua.LValue) (lua.LValue, lua.LValue, error) {
+	L, err := s.get()
+	if err != nil {
+		return lua.LNil, lua.LNil, err
+	}
+	fn := L.GetGlobal(hook)
+	if fn.Type() != lua.LTFunction {
+		s.put(L)
+		return lua.LNil, lua.LNil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	L.SetContext(s.guard(ctx, L))
+	err = L.CallByParam(lua.P{Fn: fn, NRet: 2, Protect: true}, args(L.LState)...)
+	if err != nil {
+		// the state may have been stopped anywhere,
+		// so it is not used again
+		L.Close()
+		return lua.LNil, lua.LNil, err
+	}
+	L.RemoveContext()
+	first, second := L.Get(-2), L.Get(-1)
+	L.Pop(2)
+	s.put(L)
+	return first, second, nil
+}
+
+// print logs its arguments, as print would write them.
+func (s *Script) print(L *lua.LState) int {
+	parts := make([]string, L.GetTop())
+	for i := range parts {
+		parts[i] = L.ToStringMeta(L.Get(i + 1)).String()
+	}
+	log.Printf("[INFO] lua %s: %s", s.Name, strings.Join(parts, "\t"))
+	return 0
+}
+
+// guard returns ctx as the context of a call in L,
+// which stops it when it exceeds the memory limit.
+func (s *Script) guard(ctx context.Context, L *state) context.Context {
+	return &memoryGuard{Context: ctx, L: L.LState, max: s.Memory, skip: L.libraries}
+}
+
+// maxIdleStates is how many states of a script are kept idle.
+const maxIdleStates = 16
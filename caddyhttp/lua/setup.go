@@ -0,0 +1,120 @@
+package lua
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func init() {
+	caddy.RegisterPlugin("lua", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Lua middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := luaParse(c)
+	if err != nil {
+		return err
+	}
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Lua{Next: next, Rules: rules}
+	})
+	return nil
+}
+
+// luaParse parses the lua directives, which have the form
+//
+//	lua [path] file {
+//	    timeout duration
+//	    stack   size
+//	    memory  size
+//	}
+//
+// The script in file runs on requests under path, / by default.
+// Each call of its functions may run for 100ms, use a stack of
+// 5120 values and hold 8 MB of strings and tables by default.
+func luaParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+	for c.Next() {
+		rule := Rule{Path: "/"}
+		var file string
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 1:
+			file = args[0]
+		case 2:
+			if !strings.HasPrefix(args[0], "/") {
+				return nil, c.Errf("lua: invalid path '%s'", args[0])
+			}
+			rule.Path, file = args[0], args[1]
+		default:
+			return nil, c.ArgErr()
+		}
+		timeout, stack, memory := defaultTimeout, lua.RegistrySize, defaultMemory
+
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return nil, c.ArgErr()
+			}
+			value := c.Val()
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+			var err error
+			switch what {
+			case "timeout":
+				timeout, err = time.ParseDuration(value)
+				if err != nil || timeout <= 0 {
+					return nil, c.Errf("lua: invalid timeout '%s'", value)
+				}
+			case "stack":
+				stack, err = strconv.Atoi(value)
+				if err != nil || stack < minStack {
+					return nil, c.Errf("lua: invalid stack '%s'", value)
+				}
+			case "memory":
+				size, err := humanize.ParseBytes(value)
+				if err != nil || size == 0 || size > maxMemory {
+					return nil, c.Errf("lua: invalid memory '%s'", value)
+				}
+				memory = int(size)
+			default:
+				return nil, c.Errf("lua: unknown property '%s'", what)
+			}
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, c.Errf("lua: %v", err)
+		}
+		rule.Script, err = NewScript(file, f, timeout, stack, memory)
+		f.Close()
+		if err != nil {
+			return nil, c.Errf("lua: %v", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+const (
+	defaultTimeout = 100 * time.Millisecond
+	defaultMemory  = 8 << 20
+
+	// maxMemory keeps the memory limit an int on all platforms
+	maxMemory = 1 << 30
+
+	// minStack is the smallest stack that
+	// the libraries of scripts can be opened in
+	minStack = 64
+)
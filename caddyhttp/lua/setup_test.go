@@ -0,0 +1,82 @@
+package lua
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hook.lua")
+	if err := ioutil.WriteFile(file, []byte(`function on_request(req) end`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := caddy.NewTestController("http", `lua `+file)
+	err = setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Lua)
+	if !ok {
+		t.Fatalf("Expected handler to be type Lua, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		path      string
+		timeout   time.Duration
+		stack     int
+		memory    int
+	}{
+		{`lua ` + file, false, "/", defaultTimeout, 5120, defaultMemory},
+		{"lua /api " + file + " {\ntimeout 1s\nstack 1024\nmemory 1MiB\n}", false, "/api", time.Second, 1024, 1 << 20},
+		{`lua`, true, "", 0, 0, 0},
+		{`lua api ` + file, true, "", 0, 0, 0},
+		{`lua ` + filepath.Join(dir, "missing.lua"), true, "", 0, 0, 0},
+		{"lua " + file + " {\ntimeout 0s\n}", true, "", 0, 0, 0},
+		{"lua " + file + " {\nstack 10\n}", true, "", 0, 0, 0},
+		{"lua " + file + " {\nmemory 0\n}", true, "", 0, 0, 0},
+		{"lua " + file + " {\nmemory 4GB\n}", true, "", 0, 0, 0},
+		{"lua " + file + " {\nlimit 1\n}", true, "", 0, 0, 0},
+	}
+	for i, test := range tests {
+		rules, err := luaParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		rule := rules[0]
+		if rule.Path != test.path || rule.Script.Timeout != test.timeout ||
+			rule.Script.Stack != test.stack || rule.Script.Memory != test.memory {
+			t.Errorf("Test %d: Expected path %s, timeout %v, stack %d and memory %d, got %s, %v, %d and %d",
+				i, test.path, test.timeout, test.stack, test.memory,
+				rule.Path, rule.Script.Timeout, rule.Script.Stack, rule.Script.Memory)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package markdown
 
 import (
-	"net/http"
 	"path/filepath"
 
 	"github.com/mholt/caddy"
@@ -11,13 +10,17 @@ import (
 
 func init() {
 	caddy.RegisterPlugin("markdown", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
 // setup configures a new Markdown middleware instance.
 func setup(c *caddy.Controller) error {
+	if err := httpserver.CheckStaticRoot(c); err != nil {
+		return err
+	}
 	mdconfigs, err := markdownParse(c)
 	if err != nil {
 		return err
@@ -27,7 +30,7 @@ func setup(c *caddy.Controller) error {
 
 	md := Markdown{
 		Root:       cfg.Root,
-		FileSys:    http.Dir(cfg.Root),
+		FileSys:    cfg.FileSystem(),
 		Configs:    mdconfigs,
 		IndexFiles: []string{"index.md"},
 	}
@@ -0,0 +1,113 @@
+// Package matcher defines named matchers: conditions on requests
+// that are defined once per site and referred to as @name by the
+// directives that support them, instead of being repeated in each.
+package matcher
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("matcher", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setupMatcher,
+		ReloadInPlace: true,
+	})
+}
+
+// setupMatcher defines the named matchers of the site. Syntax:
+//
+//	matcher @name {
+//	    path      patterns...
+//	    header    field values...
+//	    method    methods...
+//	    remote_ip ranges...
+//	    expr      expression
+//	}
+//
+// A request matches if it meets every condition, each by one of
+// its values. Paths are prefixes or globs, header values match
+// exactly or by a prefix ending in *, and remote IP ranges are
+// addresses or CIDR ranges. An expression is like that of an if
+// clause. Directives such as rewrite (if @name), header, proxy
+// and basicauth take @name where they take a path.
+func setupMatcher(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+
+	matchers, err := matcherParse(c)
+	if err != nil {
+		return err
+	}
+	for _, m := range matchers {
+		if err := config.AddMatcher(m); err != nil {
+			return c.Err(err.Error())
+		}
+	}
+	return nil
+}
+
+func matcherParse(c *caddy.Controller) ([]*httpserver.Matcher, error) {
+	var matchers []*httpserver.Matcher
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return matchers, c.ArgErr()
+		}
+		if !httpserver.IsMatcherRef(args[0]) {
+			return matchers, c.Errf("matcher: name '%s' must start with @", args[0])
+		}
+		m := &httpserver.Matcher{Name: args[0]}
+		var conditions int
+
+		for c.NextBlock() {
+			cond := c.Val()
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return matchers, c.ArgErr()
+			}
+			conditions++
+			switch cond {
+			case "path":
+				for _, p := range args {
+					if !strings.HasPrefix(p, "/") {
+						return matchers, c.Errf("matcher: invalid path '%s'", p)
+					}
+				}
+				m.Paths = append(m.Paths, args...)
+			case "header":
+				if len(args) < 2 {
+					return matchers, c.ArgErr()
+				}
+				m.Headers = append(m.Headers, httpserver.HeaderMatch{Field: args[0], Values: args[1:]})
+			case "method":
+				for _, method := range args {
+					m.Methods = append(m.Methods, strings.ToUpper(method))
+				}
+			case "remote_ip":
+				for _, ipRange := range args {
+					n, err := httpserver.ParseIPRange(ipRange)
+					if err != nil {
+						return matchers, c.Errf("matcher: invalid IP range '%s'", ipRange)
+					}
+					m.RemoteIPs = append(m.RemoteIPs, n)
+				}
+			case "expr":
+				expr, err := httpserver.ParseExprArgs(args)
+				if err != nil {
+					return matchers, c.Errf("matcher: %v", err)
+				}
+				m.Exprs = append(m.Exprs, expr)
+			default:
+				return matchers, c.Errf("matcher: unknown condition '%s'", cond)
+			}
+		}
+		if conditions == 0 {
+			return matchers, c.Errf("matcher: %s has no conditions", m.Name)
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
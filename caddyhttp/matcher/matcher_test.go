@@ -0,0 +1,73 @@
+package matcher
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupMatcher(t *testing.T) {
+	c := caddy.NewTestController("http", "matcher @api {\n path /api/*\n method post\n}\nmatcher @office {\n remote_ip 10.0.0.0/8 192.168.1.1\n}")
+	if err := setupMatcher(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	api, err := httpserver.MatcherRef(c, "@api")
+	if err != nil {
+		t.Fatalf("Expected @api to be defined, got: %v", err)
+	}
+	if !api.Match(httptest.NewRequest("POST", "/api/items", nil)) {
+		t.Error("Expected @api to match POST /api/items")
+	}
+	if api.Match(httptest.NewRequest("GET", "/api/items", nil)) {
+		t.Error("Expected @api not to match GET /api/items")
+	}
+	office, err := httpserver.MatcherRef(c, "@office")
+	if err != nil {
+		t.Fatalf("Expected @office to be defined, got: %v", err)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.168.1.1:4321"
+	if !office.Match(r) {
+		t.Error("Expected @office to match a client at 192.168.1.1")
+	}
+
+	// names are unique per site
+	c = caddy.NewTestController("http", "matcher @a {\n method GET\n}\nmatcher @a {\n method POST\n}")
+	if err := setupMatcher(c); err == nil {
+		t.Error("Expected error defining @a twice, got none")
+	}
+}
+
+func TestMatcherParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+	}{
+		{"matcher @a {\n path /a /b/*\n header Content-Type application/json* text/plain\n method GET\n remote_ip ::1 10.0.0.0/8\n expr {>X-Beta} == 'on'\n}", false},
+		{"matcher @a {\n expr {method} == 'GET' && {path} starts_with \"/a b\"\n}", false},
+		{"matcher @a {\n header X-A *\n header X-B *\n}", false},
+		{"matcher a {\n method GET\n}", true},
+		{"matcher @ {\n method GET\n}", true},
+		{"matcher {\n method GET\n}", true},
+		{"matcher @a @b {\n method GET\n}", true},
+		{"matcher @a", true},
+		{"matcher @a {\n}", true},
+		{"matcher @a {\n path api\n}", true},
+		{"matcher @a {\n path\n}", true},
+		{"matcher @a {\n header X-A\n}", true},
+		{"matcher @a {\n remote_ip 10.0.0.0/33\n}", true},
+		{"matcher @a {\n remote_ip localhost\n}", true},
+		{"matcher @a {\n expr {method} == GET\n}", true},
+		{"matcher @a {\n host example.com\n}", true},
+	} {
+		_, err := matcherParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error, got none", i)
+		}
+		if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Package maxconns configures limits on the number of connections
+// to a site, per client IP, and to the whole process, so that one
+// site or client cannot exhaust all sockets.
+package maxconns
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("max_connections", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupMaxConns,
+	})
+}
+
+// setupMaxConns sets the connection limits of the site. Syntax:
+//
+//	max_connections [total] {
+//	    per_ip   count
+//	    global   count
+//	    overflow reject|queue duration
+//	}
+//
+// Connections over a limit are refused with 503 Service Unavailable
+// by default; with a queue, they first wait up to duration for a slot.
+// A connection counts against the site's limits from its first request
+// to the site until it is closed. All sites that set a global limit
+// must set the same one.
+func setupMaxConns(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+
+	limits, err := parseMaxConns(c)
+	if err != nil {
+		return err
+	}
+
+	config.ConnLimits = limits
+
+	return nil
+}
+
+func parseMaxConns(c *caddy.Controller) (httpserver.ConnLimits, error) {
+	var limits httpserver.ConnLimits
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			n, err := parseCount(c, args[0])
+			if err != nil {
+				return limits, err
+			}
+			limits.Total = n
+		default:
+			return limits, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "total", "per_ip", "global":
+				if len(args) != 1 {
+					return limits, c.ArgErr()
+				}
+				n, err := parseCount(c, args[0])
+				if err != nil {
+					return limits, err
+				}
+				switch what {
+				case "total":
+					limits.Total = n
+				case "per_ip":
+					limits.PerIP = n
+				case "global":
+					limits.Global = n
+				}
+			case "overflow":
+				if len(args) == 1 && args[0] == "reject" {
+					limits.QueueTimeout = 0
+					continue
+				}
+				if len(args) != 2 || args[0] != "queue" {
+					return limits, c.ArgErr()
+				}
+				timeout, err := time.ParseDuration(args[1])
+				if err != nil || timeout <= 0 {
+					return limits, c.Errf("max_connections: invalid queue timeout '%s'", args[1])
+				}
+				limits.QueueTimeout = timeout
+			default:
+				return limits, c.Errf("max_connections: unknown property '%s'", what)
+			}
+		}
+	}
+
+	if limits.Total == 0 && limits.PerIP == 0 && limits.Global == 0 {
+		return limits, c.Err("max_connections: no limit specified")
+	}
+
+	return limits, nil
+}
+
+func parseCount(c *caddy.Controller, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, c.Errf("max_connections: invalid count '%s'", value)
+	}
+	return n, nil
+}
@@ -0,0 +1,62 @@
+package maxconns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupMaxConns(t *testing.T) {
+	cases := []struct {
+		input    string
+		hasError bool
+		expected httpserver.ConnLimits
+	}{
+		{`max_connections 100`, false, httpserver.ConnLimits{Total: 100}},
+		{`max_connections 100 {
+			per_ip 10
+			global 1000
+			overflow queue 5s
+		}`, false, httpserver.ConnLimits{Total: 100, PerIP: 10, Global: 1000, QueueTimeout: 5 * time.Second}},
+		{`max_connections {
+			per_ip 10
+			overflow reject
+		}`, false, httpserver.ConnLimits{PerIP: 10}},
+
+		// Wrong formats
+		{`max_connections`, true, httpserver.ConnLimits{}},
+		{`max_connections 0`, true, httpserver.ConnLimits{}},
+		{`max_connections 10 20`, true, httpserver.ConnLimits{}},
+		{`max_connections 10 {
+			per_ip
+		}`, true, httpserver.ConnLimits{}},
+		{`max_connections 10 {
+			overflow queue
+		}`, true, httpserver.ConnLimits{}},
+		{`max_connections 10 {
+			overflow queue forever
+		}`, true, httpserver.ConnLimits{}},
+		{`max_connections 10 {
+			overflow drop
+		}`, true, httpserver.ConnLimits{}},
+		{`max_connections 10 {
+			per_host 1
+		}`, true, httpserver.ConnLimits{}},
+	}
+	for caseNum, c := range cases {
+		controller := caddy.NewTestController("http", c.input)
+		err := setupMaxConns(controller)
+
+		if c.hasError && (err == nil) {
+			t.Errorf("Expecting error for case %v but none encountered", caseNum)
+		}
+		if !c.hasError && (err != nil) {
+			t.Errorf("Expecting no error for case %v but encountered %v", caseNum, err)
+		}
+		if actual := httpserver.GetConfig(controller).ConnLimits; !c.hasError && actual != c.expected {
+			t.Errorf("Case %v: Expected %+v, got %+v", caseNum, c.expected, actual)
+		}
+	}
+}
@@ -10,8 +10,9 @@ import (
 
 func init() {
 	caddy.RegisterPlugin("mime", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
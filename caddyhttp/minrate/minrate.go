@@ -0,0 +1,93 @@
+// Package minrate configures the minimum rates at which clients
+// must send requests to and receive responses from a site, which
+// protects it from slowloris-style attacks that tie up connections.
+package minrate
+
+import (
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("minrate", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupMinRate,
+	})
+}
+
+// defaultGrace is how long transfers may take before their
+// rate is enforced if no grace period is configured.
+const defaultGrace = 5 * time.Second
+
+// setupMinRate sets the minimum transfer rates of the site. Syntax:
+//
+//	minrate {
+//	    header   duration
+//	    upload   size
+//	    download size
+//	    grace    duration
+//	}
+//
+// Rates are given in bytes per second, like 1KB or 512B.
+func setupMinRate(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+
+	rates, err := parseMinRate(c)
+	if err != nil {
+		return err
+	}
+
+	config.MinRates = rates
+
+	return nil
+}
+
+func parseMinRate(c *caddy.Controller) (httpserver.MinTransferRates, error) {
+	rates := httpserver.MinTransferRates{Grace: defaultGrace}
+
+	for c.Next() {
+		if len(c.RemainingArgs()) > 0 {
+			return rates, c.ArgErr()
+		}
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return rates, c.ArgErr()
+			}
+			value := c.Val()
+			if c.NextArg() {
+				return rates, c.ArgErr()
+			}
+
+			switch what {
+			case "header", "grace":
+				d, err := time.ParseDuration(value)
+				if err != nil || d <= 0 {
+					return rates, c.Errf("minrate: invalid duration '%s'", value)
+				}
+				if what == "header" {
+					rates.HeaderTimeout = d
+				} else {
+					rates.Grace = d
+				}
+			case "upload", "download":
+				rate, err := humanize.ParseBytes(value)
+				if err != nil || rate == 0 {
+					return rates, c.Errf("minrate: invalid rate '%s'", value)
+				}
+				if what == "upload" {
+					rates.Upload = int64(rate)
+				} else {
+					rates.Download = int64(rate)
+				}
+			default:
+				return rates, c.Errf("minrate: unknown property '%s'", what)
+			}
+		}
+	}
+
+	return rates, nil
+}
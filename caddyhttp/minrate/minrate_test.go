@@ -0,0 +1,61 @@
+package minrate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupMinRate(t *testing.T) {
+	cases := []struct {
+		input    string
+		hasError bool
+		expected httpserver.MinTransferRates
+	}{
+		{`minrate {
+			header 10s
+			upload 1KB
+			download 512B
+			grace 2s
+		}`, false, httpserver.MinTransferRates{
+			HeaderTimeout: 10 * time.Second, Upload: 1000, Download: 512, Grace: 2 * time.Second,
+		}},
+		{`minrate {
+			header 30s
+		}`, false, httpserver.MinTransferRates{HeaderTimeout: 30 * time.Second, Grace: defaultGrace}},
+
+		// Wrong formats
+		{`minrate 10s`, true, httpserver.MinTransferRates{}},
+		{`minrate {
+			header
+		}`, true, httpserver.MinTransferRates{}},
+		{`minrate {
+			header soon
+		}`, true, httpserver.MinTransferRates{}},
+		{`minrate {
+			upload 0
+		}`, true, httpserver.MinTransferRates{}},
+		{`minrate {
+			download fast
+		}`, true, httpserver.MinTransferRates{}},
+		{`minrate {
+			trickle 1B
+		}`, true, httpserver.MinTransferRates{}},
+	}
+	for caseNum, c := range cases {
+		controller := caddy.NewTestController("http", c.input)
+		err := setupMinRate(controller)
+
+		if c.hasError && (err == nil) {
+			t.Errorf("Expecting error for case %v but none encountered", caseNum)
+		}
+		if !c.hasError && (err != nil) {
+			t.Errorf("Expecting no error for case %v but encountered %v", caseNum, err)
+		}
+		if actual := httpserver.GetConfig(controller).MinRates; !c.hasError && actual != c.expected {
+			t.Errorf("Case %v: Expected %+v, got %+v", caseNum, c.expected, actual)
+		}
+	}
+}
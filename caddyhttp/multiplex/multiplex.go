@@ -0,0 +1,126 @@
+// Package multiplex configures a site's listener to serve other
+// protocols, like SSH, on the same port as HTTP and HTTPS.
+package multiplex
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("multiplex", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupMultiplex,
+	})
+}
+
+// setupMultiplex sets the protocol sniffing of the site's
+// listener. Syntax:
+//
+//	multiplex {
+//	    ssh     backend
+//	    prefix  bytes backend
+//	    default backend
+//	    timeout duration
+//	}
+//
+// The first bytes of each connection tell its protocol: HTTP and
+// TLS connections are served by the site's server, and plaintext
+// HTTP connections to a server that uses TLS are redirected to
+// HTTPS. Connections that start with one of the prefixes, which
+// may use Go escapes like \x00, are passed through to the TCP
+// address of its backend, and other connections to the default
+// backend, if any. The ssh backend also gets the connections of
+// clients that send nothing within the timeout, which is 2s by
+// default. Sites on the same address share a listener, so they
+// must not multiplex it differently.
+func setupMultiplex(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+
+	if config.Multiplex != nil {
+		return c.Err("multiplex can only be specified once per site")
+	}
+	mux, err := parseMultiplex(c)
+	if err != nil {
+		return err
+	}
+	config.Multiplex = mux
+
+	return nil
+}
+
+func parseMultiplex(c *caddy.Controller) (*httpserver.Multiplex, error) {
+	mux := new(httpserver.Multiplex)
+
+	for c.Next() {
+		if len(c.RemainingArgs()) > 0 {
+			return nil, c.ArgErr()
+		}
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "ssh":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				if err := checkBackend(c, args[0]); err != nil {
+					return nil, err
+				}
+				if mux.Silent != "" {
+					return nil, c.Err("multiplex: ssh can only be specified once")
+				}
+				mux.Silent = args[0]
+				mux.Routes = append(mux.Routes, httpserver.MultiplexRoute{Prefix: "SSH-", Backend: args[0]})
+			case "prefix":
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				prefix, err := strconv.Unquote(`"` + args[0] + `"`)
+				if err != nil || prefix == "" {
+					return nil, c.Errf("multiplex: invalid prefix '%s'", args[0])
+				}
+				if err := checkBackend(c, args[1]); err != nil {
+					return nil, err
+				}
+				mux.Routes = append(mux.Routes, httpserver.MultiplexRoute{Prefix: prefix, Backend: args[1]})
+			case "default":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				if err := checkBackend(c, args[0]); err != nil {
+					return nil, err
+				}
+				mux.Default = args[0]
+			case "timeout":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				timeout, err := time.ParseDuration(args[0])
+				if err != nil || timeout <= 0 {
+					return nil, c.Errf("multiplex: invalid timeout '%s'", args[0])
+				}
+				mux.Timeout = timeout
+			default:
+				return nil, c.Errf("multiplex: unknown property '%s'", what)
+			}
+		}
+	}
+	if len(mux.Routes) == 0 && mux.Default == "" {
+		return nil, c.Err("multiplex: no backends to pass connections through to")
+	}
+
+	return mux, nil
+}
+
+// checkBackend returns an error if addr is not a host:port address.
+func checkBackend(c *caddy.Controller, addr string) error {
+	if _, port, err := net.SplitHostPort(addr); err != nil || port == "" {
+		return c.Errf("multiplex: invalid backend '%s'", addr)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package multiplex
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupMultiplex(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  httpserver.Multiplex
+	}{
+		{`multiplex {
+			ssh     localhost:22
+			prefix  \x00\x0eOpenVPN 127.0.0.1:1194
+			default 127.0.0.1:9000
+			timeout 5s
+		}`, false, httpserver.Multiplex{
+			Routes: []httpserver.MultiplexRoute{
+				{Prefix: "SSH-", Backend: "localhost:22"},
+				{Prefix: "\x00\x0eOpenVPN", Backend: "127.0.0.1:1194"},
+			},
+			Silent:  "localhost:22",
+			Default: "127.0.0.1:9000",
+			Timeout: 5 * time.Second,
+		}},
+		{"multiplex {\n default :9000\n}", false, httpserver.Multiplex{Default: ":9000"}},
+		{`multiplex`, true, httpserver.Multiplex{}},
+		{"multiplex on {\n default :9000\n}", true, httpserver.Multiplex{}},
+		{"multiplex {\n timeout 1s\n}", true, httpserver.Multiplex{}},
+		{"multiplex {\n ssh localhost\n}", true, httpserver.Multiplex{}},
+		{"multiplex {\n ssh :22\n ssh :2222\n}", true, httpserver.Multiplex{}},
+		{"multiplex {\n prefix \\xZZ :9000\n}", true, httpserver.Multiplex{}},
+		{"multiplex {\n prefix :9000\n}", true, httpserver.Multiplex{}},
+		{"multiplex {\n default :9000\n timeout 0s\n}", true, httpserver.Multiplex{}},
+		{"multiplex {\n rdp :3389\n}", true, httpserver.Multiplex{}},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setupMultiplex(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if got := httpserver.GetConfig(c).Multiplex; got == nil || !reflect.DeepEqual(*got, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, got)
+		}
+	}
+}
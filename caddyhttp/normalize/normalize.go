@@ -0,0 +1,190 @@
+// Package normalize provides middleware that hardens request parsing
+// against request smuggling and path confusion. It has the server
+// reject requests whose framing is ambiguous, which is only visible
+// on the connection, normalizes repeated header fields, and makes
+// sure the decoded and encoded forms of the path agree, so that
+// Caddy and any backend behind it see the same request.
+package normalize
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Modes for handling path anomalies and duplicate header fields.
+const (
+	// ModeResolve silently normalizes the anomaly.
+	ModeResolve = "resolve"
+
+	// ModeReject responds with 400 Bad Request.
+	ModeReject = "reject"
+
+	// ModeFirst keeps the first of several singleton header fields.
+	ModeFirst = "first"
+)
+
+// Config is the configuration for request normalization.
+type Config struct {
+	// How to handle repeated header fields that may
+	// only appear once: ModeReject or ModeFirst
+	DuplicateHeaders string
+
+	// How to handle empty path segments ("//") in
+	// the request target: ModeResolve or ModeReject
+	MergeSlashes string
+
+	// How to handle "." and ".." segments, including
+	// encoded ones, in the request target: ModeResolve
+	// or ModeReject
+	DotSegments string
+}
+
+// Normalize is middleware that normalizes requests or
+// rejects those it cannot interpret unambiguously.
+type Normalize struct {
+	Next   httpserver.Handler
+	Config Config
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (n Normalize) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if err := n.normalize(r); err != nil {
+		remoteHost, _, splitErr := net.SplitHostPort(r.RemoteAddr)
+		if splitErr != nil {
+			remoteHost = r.RemoteAddr
+		}
+		log.Printf("[WARNING] normalize: rejected %s %s from %s: %v",
+			r.Method, r.RequestURI, remoteHost, err)
+		return http.StatusBadRequest, nil
+	}
+	return n.Next.ServeHTTP(w, r)
+}
+
+// normalize normalizes r in place, or returns an
+// error describing why r should be rejected.
+func (n Normalize) normalize(r *http.Request) error {
+	if err := n.normalizeHeaders(r.Header); err != nil {
+		return err
+	}
+	return n.normalizePath(r)
+}
+
+// singletonHeaders are header fields which must not appear
+// more than once in a request (RFC 7230 section 3.2.2).
+var singletonHeaders = []string{
+	"Authorization",
+	"Content-Length",
+	"Content-Type",
+	"From",
+	"Host",
+	"If-Modified-Since",
+	"If-Unmodified-Since",
+	"If-Range",
+	"Max-Forwards",
+	"Proxy-Authorization",
+	"Range",
+	"Referer",
+	"User-Agent",
+}
+
+// normalizeHeaders combines repeated header fields into a single
+// field, or rejects them if they are singletons that cannot be
+// combined and n is configured to reject them.
+func (n Normalize) normalizeHeaders(h http.Header) error {
+	for _, name := range singletonHeaders {
+		values := h[name]
+		if len(values) < 2 {
+			continue
+		}
+		if n.Config.DuplicateHeaders != ModeFirst {
+			return fmt.Errorf("repeated %s field", name)
+		}
+		h[name] = values[:1]
+	}
+
+	for name, values := range h {
+		if len(values) < 2 {
+			continue
+		}
+		sep := ", "
+		if name == "Cookie" {
+			sep = "; "
+		}
+		h[name] = []string{strings.Join(values, sep)}
+	}
+
+	return nil
+}
+
+// normalizePath checks the request target of r for empty and
+// dot segments, then makes sure the encoded form of the path
+// (URL.RawPath) decodes to exactly the path everyone else sees.
+func (n Normalize) normalizePath(r *http.Request) error {
+	target := r.RequestURI
+	if target == "" {
+		target = r.URL.EscapedPath()
+	}
+	if i := strings.IndexAny(target, "?#"); i > -1 {
+		target = target[:i]
+	}
+	if strings.Contains(target, "://") {
+		// absolute-form, as used with proxies; keep only the path
+		if u, err := url.Parse(target); err == nil {
+			target = u.EscapedPath()
+		}
+	}
+
+	if n.Config.MergeSlashes == ModeReject && strings.Contains(target, "//") {
+		return fmt.Errorf("empty path segment in %q", target)
+	}
+	if n.Config.DotSegments == ModeReject && hasDotSegment(target) {
+		return fmt.Errorf("dot segment in %q", target)
+	}
+
+	if r.URL.RawPath == "" {
+		return nil
+	}
+	cleaned := cleanPath(r.URL.RawPath)
+	u, err := url.Parse(cleaned)
+	if err != nil {
+		return fmt.Errorf("invalid path encoding: %v", err)
+	}
+	if u.Path == r.URL.Path {
+		r.URL.RawPath = cleaned
+	} else {
+		// the raw path no longer describes the path, for example
+		// because the site's base path was trimmed; let the URL
+		// re-encode the path rather than carry a stale raw form
+		r.URL.RawPath = ""
+	}
+	return nil
+}
+
+// hasDotSegment returns true if the escaped path p contains
+// a "." or ".." segment, whether encoded or not.
+func hasDotSegment(p string) bool {
+	for _, seg := range strings.Split(p, "/") {
+		seg = strings.Replace(strings.ToLower(seg), "%2e", ".", -1)
+		if seg == "." || seg == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanPath is like path.Clean, but it preserves a trailing
+// slash and always returns an absolute path.
+func cleanPath(p string) string {
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
@@ -0,0 +1,80 @@
+package normalize
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestNormalizeHeaders(t *testing.T) {
+	h := http.Header{
+		"Accept": []string{"text/html", "application/json"},
+		"Cookie": []string{"a=1", "b=2"},
+		"Range":  []string{"bytes=0-1", "bytes=5-6"},
+	}
+
+	if err := (Normalize{Config: Config{DuplicateHeaders: ModeReject}}).normalizeHeaders(h); err == nil {
+		t.Error("Expected error for repeated singleton header, got none")
+	}
+
+	err := (Normalize{Config: Config{DuplicateHeaders: ModeFirst}}).normalizeHeaders(h)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for name, expected := range map[string]string{
+		"Accept": "text/html, application/json",
+		"Cookie": "a=1; b=2",
+		"Range":  "bytes=0-1",
+	} {
+		if values := h[name]; len(values) != 1 || values[0] != expected {
+			t.Errorf("Expected %s to be [%s], got %v", name, expected, values)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for i, test := range []struct {
+		config          Config
+		requestURI      string
+		path, rawPath   string
+		expectedStatus  int
+		expectedRawPath string
+	}{
+		{Config{}, "/a/b", "/a/b", "", http.StatusOK, ""},
+		{Config{MergeSlashes: ModeReject}, "/a//b", "/a/b", "", http.StatusBadRequest, ""},
+		{Config{MergeSlashes: ModeResolve}, "/a//b", "/a/b", "", http.StatusOK, ""},
+		{Config{DotSegments: ModeReject}, "/a/../b", "/b", "", http.StatusBadRequest, ""},
+		{Config{DotSegments: ModeReject}, "/a/%2e%2E/b", "/b", "", http.StatusBadRequest, ""},
+		{Config{DotSegments: ModeReject}, "/a/..b", "/a/..b", "", http.StatusOK, ""},
+		{Config{}, "/a/%2F/../b%2Fc", "/a/b/c", "/a/%2F/../b%2Fc", http.StatusOK, "/a/b%2Fc"},
+		{Config{}, "/base/b%2Fc", "/b/c", "/base/b%2Fc", http.StatusOK, ""},
+		{Config{}, "/a/x/../b%2Fc", "/a/b/c", "/a/x/../b%2Fc", http.StatusOK, "/a/b%2Fc"},
+	} {
+		var gotRawPath string
+		n := Normalize{
+			Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				gotRawPath = r.URL.RawPath
+				return http.StatusOK, nil
+			}),
+			Config: test.config,
+		}
+
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		r.RequestURI = test.requestURI
+		r.URL.Path = test.path
+		r.URL.RawPath = test.rawPath
+
+		status, _ := n.ServeHTTP(httptest.NewRecorder(), r)
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if status == http.StatusOK && gotRawPath != test.expectedRawPath {
+			t.Errorf("Test %d: Expected raw path %q, got %q", i, test.expectedRawPath, gotRawPath)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package normalize
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("normalize", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Normalize middleware instance.
+func setup(c *caddy.Controller) error {
+	config, err := normalizeParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	cfg.StrictFraming = true
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Normalize{Next: next, Config: config}
+	})
+
+	return nil
+}
+
+func normalizeParse(c *caddy.Controller) (Config, error) {
+	config := Config{
+		DuplicateHeaders: ModeReject,
+		MergeSlashes:     ModeResolve,
+		DotSegments:      ModeResolve,
+	}
+
+	var seen bool
+	for c.Next() {
+		if seen {
+			return config, c.Err("normalize: can only be specified once per site")
+		}
+		seen = true
+
+		if len(c.RemainingArgs()) > 0 {
+			return config, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			var target *string
+			var modes []string
+			switch c.Val() {
+			case "duplicate_headers":
+				target, modes = &config.DuplicateHeaders, []string{ModeReject, ModeFirst}
+			case "merge_slashes":
+				target, modes = &config.MergeSlashes, []string{ModeResolve, ModeReject}
+			case "dot_segments":
+				target, modes = &config.DotSegments, []string{ModeResolve, ModeReject}
+			default:
+				return config, c.Errf("normalize: unknown property '%s'", c.Val())
+			}
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return config, c.ArgErr()
+			}
+			var valid bool
+			for _, mode := range modes {
+				if args[0] == mode {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				return config, c.Errf("normalize: invalid mode '%s' for %s", args[0], c.Val())
+			}
+			*target = args[0]
+		}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,75 @@
+package normalize
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `normalize`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Normalize)
+	if !ok {
+		t.Fatalf("Expected handler to be type Normalize, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+
+	if !httpserver.GetConfig(c).StrictFraming {
+		t.Error("Expected strict request framing to be enabled for the site")
+	}
+}
+
+func TestNormalizeParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  Config
+	}{
+		{`normalize`, false, Config{
+			DuplicateHeaders: ModeReject, MergeSlashes: ModeResolve, DotSegments: ModeResolve,
+		}},
+		{`normalize {
+			duplicate_headers first
+			merge_slashes reject
+			dot_segments reject
+		}`, false, Config{
+			DuplicateHeaders: ModeFirst, MergeSlashes: ModeReject, DotSegments: ModeReject,
+		}},
+		{`normalize foo`, true, Config{}},
+		{`normalize {
+			merge_slashes first
+		}`, true, Config{}},
+		{`normalize {
+			dot_segments
+		}`, true, Config{}},
+		{`normalize {
+			foo bar
+		}`, true, Config{}},
+		{`normalize
+		  normalize`, true, Config{}},
+	}
+	for i, test := range tests {
+		actual, err := normalizeParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error but got none", i)
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error but got: %v", i, err)
+		} else if !test.shouldErr && actual != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
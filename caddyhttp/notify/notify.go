@@ -0,0 +1,200 @@
+// Package notify provides middleware that sends webhooks when
+// responses match conditions, for alerting without having to
+// scrape the logs.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// DefaultBody is the template of the body of webhooks.
+const DefaultBody = `{"host": "{host}", "method": "{method}", "uri": "{uri}", "status": "{status}", "remote": "{remote}", "latency": "{latency}", "when": "{when_iso}"}`
+
+// Notify is middleware that sends a webhook for each
+// response that matches a rule.
+type Notify struct {
+	Next  httpserver.Handler
+	Rules []*Rule
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (n Notify) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	// the path before it is rewritten downstream
+	path := r.URL.Path
+	var rules []*Rule
+	for _, rule := range n.Rules {
+		if rule.matchesPath(path) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return n.Next.ServeHTTP(w, r)
+	}
+
+	rec := httpserver.NewResponseRecorder(w)
+	rep := httpserver.NewReplacer(r, rec, "")
+	status, err := n.Next.ServeHTTP(rec, r)
+	code := status
+	if code == 0 {
+		code = rec.Status()
+	}
+	rep.Set("status", strconv.Itoa(code))
+	for _, rule := range rules {
+		if rule.matchesStatus(code) {
+			rule.enqueue(render(rule.Body, rep))
+		}
+	}
+	return status, err
+}
+
+// Rule is a webhook and the responses it is sent for.
+// Webhooks are sent by a worker from a queue, at most
+// Rate of them per Per; the others are dropped.
+type Rule struct {
+	URL      string
+	Paths    []string
+	Statuses []httpserver.StatusRange
+	Body     string
+	Rate     int
+	Per      time.Duration
+
+	queue   chan []byte
+	dropped int64 // accessed atomically
+
+	mu          sync.Mutex
+	windowStart time.Time
+	windowCount int
+}
+
+// matchesPath returns whether the rule applies to path.
+func (rule *Rule) matchesPath(path string) bool {
+	if len(rule.Paths) == 0 {
+		return true
+	}
+	for _, p := range rule.Paths {
+		if httpserver.Path(path).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesStatus returns whether a response with
+// status is to be notified.
+func (rule *Rule) matchesStatus(status int) bool {
+	for _, s := range rule.Statuses {
+		if s.Contains(status) {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueue queues body to be sent, unless the rate
+// is exceeded or the queue is full.
+func (rule *Rule) enqueue(body []byte) {
+	if !rule.allow(time.Now()) {
+		atomic.AddInt64(&rule.dropped, 1)
+		return
+	}
+	select {
+	case rule.queue <- body:
+	default:
+		atomic.AddInt64(&rule.dropped, 1)
+	}
+}
+
+// allow returns whether another webhook may be sent at now.
+func (rule *Rule) allow(now time.Time) bool {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+	if now.Sub(rule.windowStart) >= rule.Per {
+		rule.windowStart = now
+		rule.windowCount = 0
+	}
+	if rule.windowCount >= rule.Rate {
+		return false
+	}
+	rule.windowCount++
+	return true
+}
+
+// worker sends the queued webhooks until stop is closed.
+func (rule *Rule) worker(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case body := <-rule.queue:
+			if dropped := atomic.SwapInt64(&rule.dropped, 0); dropped > 0 {
+				log.Printf("[WARNING] notify: dropped %d notifications to %s", dropped, rule.URL)
+			}
+			if err := rule.send(body); err != nil {
+				log.Printf("[ERROR] notify: %s: %v", rule.URL, err)
+			}
+		}
+	}
+}
+
+// send posts body to the rule's URL.
+func (rule *Rule) send(body []byte) error {
+	resp, err := client.Post(rule.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// render returns tmpl with its placeholders replaced by rep,
+// escaped to be inside JSON strings. Braces that do not
+// enclose a placeholder, like those of JSON objects, are
+// kept as they are.
+func render(tmpl string, rep httpserver.Replacer) []byte {
+	var buf bytes.Buffer
+	for {
+		start := strings.Index(tmpl, "{")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexAny(tmpl[start+1:], "{}\" \t\r\n")
+		if end < 0 {
+			break
+		}
+		end += start + 1
+		if tmpl[end] != '}' || end == start+1 {
+			buf.WriteString(tmpl[:end])
+			tmpl = tmpl[end:]
+			continue
+		}
+		buf.WriteString(tmpl[:start])
+		value, _ := json.Marshal(rep.Replace(tmpl[start : end+1]))
+		buf.Write(value[1 : len(value)-1])
+		tmpl = tmpl[end+1:]
+	}
+	buf.WriteString(tmpl)
+	return buf.Bytes()
+}
+
+// client is the HTTP client that sends webhooks.
+var client = &http.Client{Timeout: 10 * time.Second}
+
+const (
+	defaultRate   = 10
+	defaultPer    = time.Minute
+	defaultQueued = 100
+)
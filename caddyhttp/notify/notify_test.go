@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestNotify(t *testing.T) {
+	bodies := make(chan string, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected JSON webhook, got '%s'", r.Header.Get("Content-Type"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer hook.Close()
+
+	rule := &Rule{
+		URL:      hook.URL,
+		Paths:    []string{"/checkout"},
+		Statuses: []httpserver.StatusRange{{Min: 500, Max: 599}},
+		Body:     `{"text": "{status} on {uri} from {>X-Note}"}`,
+		Rate:     2,
+		Per:      time.Hour,
+		queue:    make(chan []byte, 10),
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go rule.worker(stop)
+
+	n := Notify{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			switch r.URL.Path {
+			case "/checkout/pay":
+				return http.StatusBadGateway, nil
+			case "/checkout/written":
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return 0, nil
+			}
+			return http.StatusOK, nil
+		}),
+		Rules: []*Rule{rule},
+	}
+	for _, path := range []string{"/checkout/ok", "/other", "/checkout/pay", "/checkout/written", "/checkout/pay"} {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("X-Note", `say "hi"`)
+		n.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	for _, expected := range []string{
+		`{"text": "502 on /checkout/pay from say \"hi\""}`,
+		`{"text": "503 on /checkout/written from say \"hi\""}`,
+	} {
+		select {
+		case body := <-bodies:
+			if body != expected {
+				t.Errorf("Expected webhook body %s, got %s", expected, body)
+			}
+			var v map[string]string
+			if err := json.Unmarshal([]byte(body), &v); err != nil {
+				t.Errorf("Expected valid JSON, got error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for webhook")
+		}
+	}
+	// the third is over the rate
+	select {
+	case body := <-bodies:
+		t.Errorf("Expected no more webhooks, got %s", body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRender(t *testing.T) {
+	rep := httpserver.NewReplacer(httptest.NewRequest("GET", "/a?b=c", nil), nil, "")
+	for tmpl, expected := range map[string]string{
+		`{"uri": "{uri}"}`:         `{"uri": "/a?b=c"}`,
+		`{"a": {"b": "{method}"}}`: `{"a": {"b": "GET"}}`,
+		`{}`:                       `{}`,
+		`{"x": "{unknown}"}`:       `{"x": ""}`,
+		`{"x": "{query}`:           `{"x": "b=c`,
+	} {
+		if got := string(render(tmpl, rep)); got != expected {
+			t.Errorf("Expected %s to render as %s, got %s", tmpl, expected, got)
+		}
+	}
+}
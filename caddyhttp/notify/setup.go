@@ -0,0 +1,138 @@
+package notify
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("notify", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Notify middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := notifyParse(c)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	c.OnStartup(func() error {
+		for _, rule := range rules {
+			go rule.worker(stop)
+		}
+		return nil
+	})
+	c.OnShutdown(func() error {
+		close(stop)
+		return nil
+	})
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Notify{Next: next, Rules: rules}
+	})
+	return nil
+}
+
+// notifyParse parses the notify directives, which have the form
+//
+//	notify url {
+//	    path   paths...
+//	    status codes...
+//	    body   template
+//	    rate   count duration
+//	    queue  size
+//	}
+//
+// A JSON webhook is posted to url for each response to a request
+// under one of the paths (all by default) whose status is one of
+// the codes, which may be ranges like 500-599 or classes like 5xx
+// (5xx by default). The template's placeholders are replaced with
+// the values of the request and response. At most count webhooks
+// are sent per duration (10 per minute by default), and up to size
+// wait to be sent (100 by default); the others are dropped.
+func notifyParse(c *caddy.Controller) ([]*Rule, error) {
+	var rules []*Rule
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return nil, c.ArgErr()
+		}
+		u, err := url.Parse(args[0])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, c.Errf("notify: invalid URL '%s'", args[0])
+		}
+		rule := &Rule{URL: args[0], Body: DefaultBody, Rate: defaultRate, Per: defaultPer}
+		queued := defaultQueued
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "path":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, p := range args {
+					if !strings.HasPrefix(p, "/") {
+						return nil, c.Errf("notify: invalid path '%s'", p)
+					}
+				}
+				rule.Paths = append(rule.Paths, args...)
+			case "status":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, arg := range args {
+					s, err := httpserver.ParseStatusRange(arg)
+					if err != nil {
+						return nil, c.Errf("notify: invalid status '%s'", arg)
+					}
+					rule.Statuses = append(rule.Statuses, s)
+				}
+			case "body":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				rule.Body = args[0]
+			case "rate":
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				rule.Rate, err = strconv.Atoi(args[0])
+				if err != nil || rule.Rate < 1 {
+					return nil, c.Errf("notify: invalid rate '%s'", args[0])
+				}
+				rule.Per, err = time.ParseDuration(args[1])
+				if err != nil || rule.Per <= 0 {
+					return nil, c.Errf("notify: invalid duration '%s'", args[1])
+				}
+			case "queue":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				queued, err = strconv.Atoi(args[0])
+				if err != nil || queued < 1 {
+					return nil, c.Errf("notify: invalid queue size '%s'", args[0])
+				}
+			default:
+				return nil, c.ArgErr()
+			}
+		}
+
+		if len(rule.Statuses) == 0 {
+			rule.Statuses = []httpserver.StatusRange{{Min: 500, Max: 599}}
+		}
+		rule.queue = make(chan []byte, queued)
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `notify https://hooks.example.com/alert`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Notify)
+	if !ok {
+		t.Fatalf("Expected handler to be type Notify, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestNotifyParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []*Rule
+		queued    []int
+	}{
+		{`notify https://hooks.example.com/alert`, false, []*Rule{
+			&Rule{URL: "https://hooks.example.com/alert", Statuses: []httpserver.StatusRange{{Min: 500, Max: 599}}, Body: DefaultBody, Rate: 10, Per: time.Minute},
+		}, []int{100}},
+		{`notify http://localhost:9000/hook {
+			path   /checkout /cart
+			status 5xx 404 429-431
+			body   "{\"text\": \"{status} on {uri}\"}"
+			rate   2 1s
+			queue  5
+		}
+		notify https://hooks.example.com/all`, false, []*Rule{
+			&Rule{URL: "http://localhost:9000/hook", Paths: []string{"/checkout", "/cart"},
+				Statuses: []httpserver.StatusRange{{Min: 500, Max: 599}, {Min: 404, Max: 404}, {Min: 429, Max: 431}},
+				Body:     `{"text": "{status} on {uri}"}`, Rate: 2, Per: time.Second},
+			&Rule{URL: "https://hooks.example.com/all", Statuses: []httpserver.StatusRange{{Min: 500, Max: 599}}, Body: DefaultBody, Rate: 10, Per: time.Minute},
+		}, []int{5, 100}},
+		{`notify`, true, nil, nil},
+		{`notify hooks.example.com`, true, nil, nil},
+		{`notify https://a https://b`, true, nil, nil},
+		{`notify https://a {
+			path checkout
+		}`, true, nil, nil},
+		{`notify https://a {
+			status 6xx
+		}`, true, nil, nil},
+		{`notify https://a {
+			status 504-500
+		}`, true, nil, nil},
+		{`notify https://a {
+			rate 0 1m
+		}`, true, nil, nil},
+		{`notify https://a {
+			rate 10
+		}`, true, nil, nil},
+		{`notify https://a {
+			queue 0
+		}`, true, nil, nil},
+		{`notify https://a {
+			retries 3
+		}`, true, nil, nil},
+	}
+	for i, test := range tests {
+		rules, err := notifyParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if len(rules) != len(test.expected) {
+			t.Errorf("Test %d: Expected %d rules, got %d", i, len(test.expected), len(rules))
+			continue
+		}
+		for j, rule := range rules {
+			if cap(rule.queue) != test.queued[j] {
+				t.Errorf("Test %d, rule %d: Expected queue of %d, got %d", i, j, test.queued[j], cap(rule.queue))
+			}
+			rule.queue = nil
+			if !reflect.DeepEqual(rule, test.expected[j]) {
+				t.Errorf("Test %d, rule %d: Expected %+v, got %+v", i, j, test.expected[j], rule)
+			}
+		}
+	}
+}
@@ -0,0 +1,353 @@
+// Package oidc provides middleware that logs users in with an
+// OpenID Connect provider, using the authorization code flow with
+// PKCE, and keeps them logged in with an encrypted session cookie.
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/internal/seal"
+)
+
+// OIDC is middleware that requires users to log in with an
+// OpenID Connect provider to access protected paths.
+type OIDC struct {
+	Next   httpserver.Handler
+	Config *Config
+}
+
+// Config is the configuration of the OIDC middleware.
+type Config struct {
+	// URL of the provider, where its discovery
+	// document is found under /.well-known
+	Issuer string
+
+	ClientID     string
+	ClientSecret string
+
+	// Scopes to request; openid is always requested
+	Scopes []string
+
+	// Path the provider redirects users to after
+	// they log in, and path to log users out
+	RedirectPath string
+	LogoutPath   string
+
+	// How long users stay logged in
+	SessionTTL time.Duration
+
+	// Request headers to set to claims of the user
+	Headers []HeaderClaim
+
+	// Claim that lists the groups of the user
+	GroupsClaim string
+
+	// Paths that require users to log in; if there
+	// are none, the whole site does
+	Rules []Rule
+
+	// Paths that do not require users to log in
+	Except []string
+
+	provider *provider
+	sealer   *seal.Sealer
+}
+
+// HeaderClaim maps a claim to a request header.
+type HeaderClaim struct {
+	Header string
+	Claim  string
+}
+
+// Rule requires users to log in to access a base path,
+// and, if there are groups, to be in one of them.
+type Rule struct {
+	Path   string
+	Groups []string
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (o OIDC) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	cfg := o.Config
+	switch r.URL.Path {
+	case cfg.RedirectPath:
+		return o.callback(w, r)
+	case cfg.LogoutPath:
+		return o.logout(w, r)
+	}
+
+	// clients must not be able to pass off
+	// their own values as those of claims
+	for _, hc := range cfg.Headers {
+		r.Header.Del(hc.Header)
+	}
+
+	sess := o.session(r)
+	if sess != nil {
+		// claims kept in the session are placeholders,
+		// such as {oidc.sub}, for other middleware
+		for claim, v := range sess.Claims {
+			r = httpserver.SetRequestPlaceholder(r, "oidc."+claim, claimString(v))
+		}
+		for _, hc := range cfg.Headers {
+			if value := claimString(sess.Claims[hc.Claim]); value != "" {
+				r.Header.Set(hc.Header, value)
+			}
+		}
+	}
+
+	rule := cfg.match(r.URL.Path)
+	if rule == nil {
+		return o.Next.ServeHTTP(w, r)
+	}
+	if sess == nil {
+		return o.login(w, r)
+	}
+	if !rule.allows(claimList(sess.Claims[cfg.GroupsClaim])) {
+		return http.StatusForbidden, nil
+	}
+	return o.Next.ServeHTTP(w, r)
+}
+
+// match returns the rule protecting urlPath, or nil if it is not protected.
+func (cfg *Config) match(urlPath string) *Rule {
+	for _, except := range cfg.Except {
+		if httpserver.Path(urlPath).Matches(except) {
+			return nil
+		}
+	}
+	var rule *Rule
+	for i := range cfg.Rules {
+		candidate := &cfg.Rules[i]
+		if httpserver.Path(urlPath).Matches(candidate.Path) &&
+			(rule == nil || len(candidate.Path) > len(rule.Path)) {
+			rule = candidate
+		}
+	}
+	return rule
+}
+
+// allows returns whether a user in groups may access the path of rule.
+func (rule *Rule) allows(groups []string) bool {
+	if len(rule.Groups) == 0 {
+		return true
+	}
+	for _, group := range groups {
+		for _, allowed := range rule.Groups {
+			if group == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// session returns the session of the user of r, or nil
+// if the user has not logged in or the session expired.
+func (o OIDC) session(r *http.Request) *session {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	var sess session
+	if err := o.Config.sealer.Open(sessionCookie, cookie.Value, &sess); err != nil || seal.Expired(sess.Expires) {
+		return nil
+	}
+	return &sess
+}
+
+// login sends the user to the provider to log in, and
+// then to return to the URL of r.
+func (o OIDC) login(w http.ResponseWriter, r *http.Request) (int, error) {
+	// other requests than page loads cannot follow
+	// the user through the provider's login page
+	if (r.Method != "GET" && r.Method != "HEAD") || r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		return http.StatusUnauthorized, nil
+	}
+	cfg := o.Config
+	config, err := cfg.provider.discover()
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+
+	state := loginState{
+		State:    seal.RandomString(24),
+		Nonce:    seal.RandomString(24),
+		Verifier: seal.RandomString(32),
+		Return:   r.URL.RequestURI(),
+		Expires:  time.Now().Add(loginTimeout).Unix(),
+	}
+	value, err := cfg.sealer.Seal(stateCookie, state)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	http.SetCookie(w, o.cookie(r, stateCookie, value, loginTimeout))
+
+	challenge := sha256.Sum256([]byte(state.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {cfg.ClientID},
+		"redirect_uri":          {cfg.redirectURI(r)},
+		"scope":                 {strings.Join(cfg.Scopes, " ")},
+		"state":                 {state.State},
+		"nonce":                 {state.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(config.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, config.AuthorizationEndpoint+sep+query.Encode(), http.StatusFound)
+	return 0, nil
+}
+
+// callback completes the login of a user whom the
+// provider redirected back with an authorization code.
+func (o OIDC) callback(w http.ResponseWriter, r *http.Request) (int, error) {
+	cfg := o.Config
+	cookie, err := r.Cookie(stateCookie)
+	if err != nil {
+		return http.StatusBadRequest, errors.New("oidc: no login in progress")
+	}
+	var state loginState
+	if err := cfg.sealer.Open(stateCookie, cookie.Value, &state); err != nil || seal.Expired(state.Expires) {
+		return http.StatusBadRequest, errors.New("oidc: invalid or expired login")
+	}
+	query := r.URL.Query()
+	if query.Get("state") != state.State {
+		return http.StatusBadRequest, errors.New("oidc: state mismatch")
+	}
+	if e := query.Get("error"); e != "" {
+		return http.StatusUnauthorized, fmt.Errorf("oidc: login failed: %s %s", e, query.Get("error_description"))
+	}
+
+	config, err := cfg.provider.discover()
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+	idToken, err := cfg.provider.exchange(config, cfg.ClientID, cfg.ClientSecret, query.Get("code"), state.Verifier, cfg.redirectURI(r))
+	if err != nil {
+		return http.StatusBadGateway, fmt.Errorf("oidc: %v", err)
+	}
+	claims, err := cfg.provider.verify(config, idToken, cfg.ClientID, state.Nonce)
+	if err != nil {
+		return http.StatusUnauthorized, fmt.Errorf("oidc: %v", err)
+	}
+
+	// keep only the claims that are used, so
+	// that the session cookie stays small
+	sess := session{
+		Claims:  map[string]interface{}{"sub": claims["sub"]},
+		Expires: time.Now().Add(cfg.SessionTTL).Unix(),
+	}
+	for _, hc := range cfg.Headers {
+		if v, ok := claims[hc.Claim]; ok {
+			sess.Claims[hc.Claim] = v
+		}
+	}
+	if v, ok := claims[cfg.GroupsClaim]; ok {
+		sess.Claims[cfg.GroupsClaim] = v
+	}
+	value, err := cfg.sealer.Seal(sessionCookie, sess)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	http.SetCookie(w, o.cookie(r, sessionCookie, value, cfg.SessionTTL))
+	http.SetCookie(w, o.cookie(r, stateCookie, "", -1))
+	http.Redirect(w, r, state.Return, http.StatusFound)
+	return 0, nil
+}
+
+// logout ends the session of the user, and sends the user to
+// the provider to end the session there too, if it can.
+func (o OIDC) logout(w http.ResponseWriter, r *http.Request) (int, error) {
+	http.SetCookie(w, o.cookie(r, sessionCookie, "", -1))
+	to := "/"
+	if config, err := o.Config.provider.discover(); err == nil && config.EndSessionEndpoint != "" {
+		to = config.EndSessionEndpoint
+	}
+	http.Redirect(w, r, to, http.StatusFound)
+	return 0, nil
+}
+
+// cookie returns a cookie for r that expires after maxAge,
+// or is deleted if maxAge is negative.
+func (o OIDC) cookie(r *http.Request, name, value string, maxAge time.Duration) *http.Cookie {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+	}
+	if maxAge < 0 {
+		c.MaxAge = -1
+	} else {
+		c.MaxAge = int(maxAge / time.Second)
+	}
+	return c
+}
+
+// redirectURI returns the URL the provider sends users to
+// after they log in, on the site of r.
+func (cfg *Config) redirectURI(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + cfg.RedirectPath
+}
+
+// claimString returns the value of a claim as header value.
+func claimString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		return strings.Join(claimList(v), ",")
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// claimList returns the values of a claim that is a list,
+// or of one that is a single string.
+func claimList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, claimString(item))
+		}
+		return list
+	}
+	return nil
+}
+
+const (
+	sessionCookie = "caddy_oidc"
+	stateCookie   = "caddy_oidc_login"
+
+	// loginTimeout is how long users have
+	// to log in at the provider.
+	loginTimeout = 10 * time.Minute
+)
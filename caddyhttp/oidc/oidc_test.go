@@ -0,0 +1,293 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/internal/seal"
+)
+
+// fakeProvider is an OpenID provider that issues ID tokens
+// with claims for any code whose PKCE challenge it was given.
+type fakeProvider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]interface{}
+
+	mu         sync.Mutex
+	challenges map[string]string // code to challenge
+	nonces     map[string]string // code to nonce
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{key: key, challenges: make(map[string]string), nonces: make(map[string]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		code := r.FormValue("code")
+		verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		p.mu.Lock()
+		challenge, nonce := p.challenges[code], p.nonces[code]
+		p.mu.Unlock()
+		if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" ||
+			challenge != base64.RawURLEncoding.EncodeToString(verifier[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := map[string]interface{}{
+			"iss":   p.URL,
+			"aud":   "client",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": nonce,
+		}
+		for k, v := range p.claims {
+			claims[k] = v
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.sign(t, "key1", claims)})
+	})
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+// authorize plays the part of the user logging in at the provider.
+func (p *fakeProvider) authorize(t *testing.T, location, code string) url.Values {
+	u, err := url.Parse(location)
+	if err != nil || !strings.HasPrefix(location, p.URL+"/authorize?") {
+		t.Fatalf("Expected redirect to the authorization endpoint, got '%s'", location)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("response_type") != "code" {
+		t.Errorf("Expected code flow with PKCE, got %v", query)
+	}
+	p.mu.Lock()
+	p.challenges[code] = query.Get("code_challenge")
+	p.nonces[code] = query.Get("nonce")
+	p.mu.Unlock()
+	return query
+}
+
+// sign returns a JWT with claims signed with RS256.
+func (p *fakeProvider) sign(t *testing.T, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestLogin(t *testing.T) {
+	p := newFakeProvider(t)
+	defer p.Close()
+	p.claims = map[string]interface{}{"sub": "alice", "email": "alice@example.com", "groups": []string{"staff", "dev"}}
+
+	sealer, _ := seal.New([]byte("secret"))
+	cfg := &Config{
+		Issuer:       p.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"openid", "email"},
+		RedirectPath: "/oauth2/callback",
+		LogoutPath:   "/oauth2/logout",
+		SessionTTL:   time.Hour,
+		Headers:      []HeaderClaim{{Header: "X-Email", Claim: "email"}, {Header: "X-Groups", Claim: "groups"}},
+		GroupsClaim:  "groups",
+		Rules:        []Rule{{Path: "/"}, {Path: "/admin", Groups: []string{"admins"}}},
+		Except:       []string{"/public"},
+		provider:     newProvider(p.URL),
+		sealer:       sealer,
+	}
+	var headers http.Header
+	var sub string
+	o := OIDC{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			headers = r.Header
+			sub = httpserver.NewReplacer(r, nil, "").Replace("{oidc.sub}")
+			return http.StatusOK, nil
+		}),
+		Config: cfg,
+	}
+	serve := func(target string, cookies []*http.Cookie) (int, *httptest.ResponseRecorder) {
+		r := httptest.NewRequest("GET", target, nil)
+		r.Header.Set("X-Email", "mallory@example.com")
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		status, err := o.ServeHTTP(w, r)
+		if err != nil {
+			t.Errorf("%s: Expected no error, got %v", target, err)
+		}
+		return status, w
+	}
+
+	// unprotected paths are served without login,
+	// but without headers the client made up
+	if status, _ := serve("/public/index.html", nil); status != http.StatusOK || headers.Get("X-Email") != "" {
+		t.Errorf("Expected public path to be served without claims, got %d and %v", status, headers)
+	}
+
+	// protected paths send the user to the provider
+	_, w := serve("/docs?page=2", nil)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected redirect to log in, got %d", w.Code)
+	}
+	query := p.authorize(t, w.Header().Get("Location"), "code1")
+	if query.Get("redirect_uri") != "http://example.com/oauth2/callback" || query.Get("scope") != "openid email" {
+		t.Errorf("Unexpected authorization request: %v", query)
+	}
+	stateCookies := (&http.Response{Header: w.Header()}).Cookies()
+
+	// the callback must have the state of the login
+	callback := "/oauth2/callback?code=code1&state=" + url.QueryEscape(query.Get("state"))
+	r := httptest.NewRequest("GET", "/oauth2/callback?code=code1&state=forged", nil)
+	r.AddCookie(stateCookies[0])
+	if status, err := o.ServeHTTP(httptest.NewRecorder(), r); status != http.StatusBadRequest || err == nil {
+		t.Errorf("Expected forged state to be rejected, got %d and %v", status, err)
+	}
+	_, w = serve(callback, stateCookies)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/docs?page=2" {
+		t.Fatalf("Expected redirect back to the page, got %d to '%s'", w.Code, w.Header().Get("Location"))
+	}
+	var sessionCookies []*http.Cookie
+	for _, c := range (&http.Response{Header: w.Header()}).Cookies() {
+		if c.Name == sessionCookie {
+			sessionCookies = append(sessionCookies, c)
+		}
+	}
+	if len(sessionCookies) != 1 || !sessionCookies[0].HttpOnly {
+		t.Fatalf("Expected an HttpOnly session cookie, got %v", sessionCookies)
+	}
+
+	// with the session, claims are passed on
+	if status, _ := serve("/docs", sessionCookies); status != http.StatusOK {
+		t.Errorf("Expected logged in user to be served, got %d", status)
+	}
+	if headers.Get("X-Email") != "alice@example.com" || headers.Get("X-Groups") != "staff,dev" || sub != "alice" {
+		t.Errorf("Expected claims in headers and placeholders, got %v and '%s'", headers, sub)
+	}
+
+	// but only paths for the groups of the user
+	if status, _ := serve("/admin/users", sessionCookies); status != http.StatusForbidden {
+		t.Errorf("Expected status %d for admin path, got %d", http.StatusForbidden, status)
+	}
+
+	// requests that cannot follow redirects are refused
+	r = httptest.NewRequest("POST", "/docs", nil)
+	if status, _ := o.ServeHTTP(httptest.NewRecorder(), r); status != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for POST without session, got %d", http.StatusUnauthorized, status)
+	}
+
+	// logging out clears the session
+	_, w = serve("/oauth2/logout", sessionCookies)
+	if c := (&http.Response{Header: w.Header()}).Cookies(); len(c) != 1 || c[0].Name != sessionCookie || c[0].MaxAge >= 0 {
+		t.Errorf("Expected session cookie to be deleted, got %v", c)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	p := newFakeProvider(t)
+	defer p.Close()
+	prov := newProvider(p.URL)
+	config, err := prov.discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   p.URL,
+			"aud":   []string{"other", "client"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": "n",
+			"sub":   "alice",
+		}
+	}
+	if claims, err := prov.verify(config, p.sign(t, "key1", valid()), "client", "n"); err != nil || claims["sub"] != "alice" {
+		t.Errorf("Expected valid token to verify, got %v and %v", claims, err)
+	}
+
+	for i, mutate := range []func(claims map[string]interface{}) string{
+		func(c map[string]interface{}) string {
+			c["iss"] = "https://evil.example.com"
+			return p.sign(t, "key1", c)
+		},
+		func(c map[string]interface{}) string { c["aud"] = "other"; return p.sign(t, "key1", c) },
+		func(c map[string]interface{}) string {
+			c["exp"] = time.Now().Add(-time.Hour).Unix()
+			return p.sign(t, "key1", c)
+		},
+		func(c map[string]interface{}) string { c["nonce"] = "replayed"; return p.sign(t, "key1", c) },
+		func(c map[string]interface{}) string { return p.sign(t, "key2", c) },
+		func(c map[string]interface{}) string {
+			token := p.sign(t, "key1", c)
+			payload, _ := json.Marshal(map[string]interface{}{"iss": p.URL, "aud": "client", "sub": "mallory"})
+			parts := strings.Split(token, ".")
+			return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+		},
+		func(c map[string]interface{}) string {
+			header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+			payload, _ := json.Marshal(c)
+			return header + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+		},
+	} {
+		if _, err := prov.verify(config, mutate(valid()), "client", "n"); err == nil {
+			t.Errorf("Test %d: Expected invalid token to be rejected", i)
+		}
+	}
+}
+
+func TestSealer(t *testing.T) {
+	s, _ := seal.New([]byte("secret"))
+	value, err := s.Seal(sessionCookie, session{Claims: map[string]interface{}{"sub": "alice"}, Expires: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sess session
+	if err := s.Open(sessionCookie, value, &sess); err != nil || sess.Claims["sub"] != "alice" || sess.Expires != 42 {
+		t.Errorf("Expected session to round trip, got %+v and %v", sess, err)
+	}
+	if err := s.Open(stateCookie, value, &sess); err == nil {
+		t.Error("Expected session cookie not to open as another cookie")
+	}
+	other, _ := seal.New([]byte("other"))
+	if err := other.Open(sessionCookie, value, &sess); err == nil {
+		t.Error("Expected cookie not to open with another secret")
+	}
+}
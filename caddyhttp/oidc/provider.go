@@ -0,0 +1,361 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // for crypto.SHA256
+	_ "crypto/sha512" // for crypto.SHA384 and crypto.SHA512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// provider is an OpenID Connect provider, whose endpoints
+// and keys are discovered from its issuer URL.
+type provider struct {
+	issuer string
+	client *http.Client
+
+	mu        sync.Mutex
+	config    *providerConfig
+	keys      map[string]crypto.PublicKey // by key ID
+	keysFetch time.Time
+}
+
+// providerConfig is the part of a provider's discovery
+// document that is used.
+type providerConfig struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// newProvider returns the provider with the given issuer URL.
+func newProvider(issuer string) *provider {
+	return &provider{
+		issuer: strings.TrimSuffix(issuer, "/"),
+		client: &http.Client{Timeout: providerTimeout},
+	}
+}
+
+// discover returns the configuration of p, fetching
+// it if it has not been fetched successfully yet.
+func (p *provider) discover() (*providerConfig, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.config != nil {
+		return p.config, nil
+	}
+	var config providerConfig
+	if err := p.getJSON(p.issuer+"/.well-known/openid-configuration", &config); err != nil {
+		return nil, fmt.Errorf("discovering OpenID provider: %v", err)
+	}
+	if strings.TrimSuffix(config.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("discovering OpenID provider: issuer is %s, not %s", config.Issuer, p.issuer)
+	}
+	if config.AuthorizationEndpoint == "" || config.TokenEndpoint == "" || config.JWKSURI == "" {
+		return nil, errors.New("discovering OpenID provider: endpoints missing")
+	}
+	p.config = &config
+	return p.config, nil
+}
+
+// tokenResponse is the response of a token endpoint.
+type tokenResponse struct {
+	IDToken string `json:"id_token"`
+	Error   string `json:"error"`
+}
+
+// exchange exchanges an authorization code for an ID token.
+func (p *provider) exchange(config *providerConfig, clientID, clientSecret, code, verifier, redirectURI string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {clientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest("POST", config.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("decoding token response: %v", err)
+	}
+	if token.Error != "" {
+		return "", fmt.Errorf("token endpoint: %s", token.Error)
+	}
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return "", fmt.Errorf("token endpoint: status %d without ID token", resp.StatusCode)
+	}
+	return token.IDToken, nil
+}
+
+// verify verifies the signature of an ID token and that it was
+// issued by p for clientID with nonce, and returns its claims.
+func (p *provider) verify(config *providerConfig, idToken, clientID, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("decoding ID token header: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("decoding ID token signature: %v", err)
+	}
+	key, err := p.key(config, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("decoding ID token claims: %v", err)
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != p.issuer {
+		return nil, fmt.Errorf("ID token issued by %s", iss)
+	}
+	if !audienceContains(claims["aud"], clientID) {
+		return nil, errors.New("ID token not issued for this client")
+	}
+	if exp, _ := claims["exp"].(float64); time.Now().After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return nil, errors.New("ID token expired")
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, errors.New("ID token nonce mismatch")
+	}
+	return claims, nil
+}
+
+// key returns the public key with ID kid, fetching the keys of
+// p again if it is unknown, but not more often than keysRefresh.
+func (p *provider) key(config *providerConfig, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetch) < keysRefresh {
+		return nil, fmt.Errorf("unknown signing key '%s'", kid)
+	}
+	p.keysFetch = time.Now()
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(config.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("fetching signing keys: %v", err)
+	}
+	p.keys = make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			p.keys[k.Kid] = key
+		}
+	}
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key '%s'", kid)
+}
+
+// lookupKey returns the known key with ID kid; if kid is empty,
+// there must be only one key. p.mu must be locked.
+func (p *provider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// getJSON decodes the JSON document at u into v.
+func (p *provider) getJSON(u string, v interface{}) error {
+	resp, err := p.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// jwk is a JSON Web Key.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey returns the RSA or ECDSA public key k describes.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// verifySignature verifies the JWS signature of signed with key,
+// which must be of the kind alg calls for.
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hash crypto.Hash
+	if len(alg) == 5 {
+		switch alg[2:] {
+		case "256":
+			hash = crypto.SHA256
+		case "384":
+			hash = crypto.SHA384
+		case "512":
+			hash = crypto.SHA512
+		}
+	}
+	if hash == 0 {
+		return fmt.Errorf("unsupported signing algorithm %s", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		if k, ok := key.(*rsa.PublicKey); ok {
+			return rsa.VerifyPKCS1v15(k, hash, digest, signature)
+		}
+	case "PS":
+		if k, ok := key.(*rsa.PublicKey); ok {
+			return rsa.VerifyPSS(k, hash, digest, signature, nil)
+		}
+	case "ES":
+		if k, ok := key.(*ecdsa.PublicKey); ok {
+			size := (k.Curve.Params().BitSize + 7) / 8
+			if len(signature) != 2*size {
+				return errors.New("invalid ID token signature")
+			}
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			if !ecdsa.Verify(k, digest, r, s) {
+				return errors.New("invalid ID token signature")
+			}
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported signing algorithm %s", alg)
+	}
+	return fmt.Errorf("signing key does not fit algorithm %s", alg)
+}
+
+// audienceContains returns whether the aud claim contains clientID.
+func audienceContains(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a JWT into v.
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// decodeBigInt decodes a base64url encoded big-endian integer.
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+const (
+	providerTimeout = 10 * time.Second
+
+	// keysRefresh is how often the keys of a provider may
+	// be fetched again for an unknown key ID at most.
+	keysRefresh = 1 * time.Minute
+
+	// clockSkew is how far the clock of a provider
+	// may be ahead of ours.
+	clockSkew = 1 * time.Minute
+)
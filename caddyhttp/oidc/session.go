@@ -0,0 +1,21 @@
+package oidc
+
+// session is what is stored in the session cookie of a user
+// who logged in.
+type session struct {
+	// Claims of the ID token that are used
+	Claims map[string]interface{} `json:"c"`
+
+	// Unix time after which the user must log in again
+	Expires int64 `json:"e"`
+}
+
+// loginState is what is stored in a cookie while the user
+// logs in at the provider.
+type loginState struct {
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"` // PKCE code verifier
+	Return   string `json:"r"` // URL to return to
+	Expires  int64  `json:"e"`
+}
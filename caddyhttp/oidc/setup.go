@@ -0,0 +1,153 @@
+package oidc
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/internal/seal"
+)
+
+func init() {
+	caddy.RegisterPlugin("oidc", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new OIDC middleware instance.
+func setup(c *caddy.Controller) error {
+	cfg, err := oidcParse(c)
+	if err != nil {
+		return err
+	}
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return OIDC{Next: next, Config: cfg}
+	})
+	return nil
+}
+
+// oidcParse parses the oidc directive, which has the form
+//
+//	oidc {
+//	    issuer        url
+//	    client_id     id
+//	    client_secret secret
+//	    scopes        scopes...
+//	    redirect_path path
+//	    logout_path   path
+//	    cookie_secret secret
+//	    session_ttl   duration
+//	    header        name claim
+//	    groups_claim  claim
+//	    protect       path [groups...]
+//	    except        paths...
+//	}
+//
+// Sessions are encrypted with the cookie secret, or with the client
+// secret if there is none; one of them is required. Without protect
+// lines, the whole site requires users to log in.
+func oidcParse(c *caddy.Controller) (*Config, error) {
+	var cfg *Config
+	for c.Next() {
+		if cfg != nil {
+			return nil, c.Err("oidc: only one oidc directive per site")
+		}
+		if len(c.RemainingArgs()) > 0 {
+			return nil, c.ArgErr()
+		}
+		cfg = &Config{
+			Scopes:       []string{"openid", "email", "profile"},
+			RedirectPath: "/oauth2/callback",
+			LogoutPath:   "/oauth2/logout",
+			SessionTTL:   defaultSessionTTL,
+			GroupsClaim:  "groups",
+		}
+		var cookieSecret string
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return nil, c.ArgErr()
+			}
+			switch what {
+			case "scopes":
+				cfg.Scopes = []string{"openid"}
+				for _, scope := range args {
+					if scope != "openid" {
+						cfg.Scopes = append(cfg.Scopes, scope)
+					}
+				}
+				continue
+			case "header":
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				cfg.Headers = append(cfg.Headers, HeaderClaim{Header: args[0], Claim: args[1]})
+				continue
+			case "protect":
+				cfg.Rules = append(cfg.Rules, Rule{Path: args[0], Groups: args[1:]})
+				continue
+			case "except":
+				cfg.Except = append(cfg.Except, args...)
+				continue
+			}
+
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			value := args[0]
+			switch what {
+			case "issuer":
+				u, err := url.Parse(value)
+				if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+					return nil, c.Errf("oidc: invalid issuer '%s'", value)
+				}
+				cfg.Issuer = value
+			case "client_id":
+				cfg.ClientID = value
+			case "client_secret":
+				cfg.ClientSecret = value
+			case "redirect_path":
+				cfg.RedirectPath = value
+			case "logout_path":
+				cfg.LogoutPath = value
+			case "cookie_secret":
+				cookieSecret = value
+			case "session_ttl":
+				dur, err := time.ParseDuration(value)
+				if err != nil || dur <= 0 {
+					return nil, c.Errf("oidc: invalid session_ttl '%s'", value)
+				}
+				cfg.SessionTTL = dur
+			case "groups_claim":
+				cfg.GroupsClaim = value
+			default:
+				return nil, c.Errf("oidc: unknown property '%s'", what)
+			}
+		}
+
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, c.Err("oidc: issuer and client_id are required")
+		}
+		if cookieSecret == "" {
+			cookieSecret = cfg.ClientSecret
+		}
+		if cookieSecret == "" {
+			return nil, c.Err("oidc: cookie_secret is required without client_secret")
+		}
+		if len(cfg.Rules) == 0 {
+			cfg.Rules = []Rule{{Path: "/"}}
+		}
+		sealer, err := seal.New([]byte(cookieSecret))
+		if err != nil {
+			return nil, err
+		}
+		cfg.sealer = sealer
+		cfg.provider = newProvider(cfg.Issuer)
+	}
+	return cfg, nil
+}
+
+const defaultSessionTTL = 8 * time.Hour
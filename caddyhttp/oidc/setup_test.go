@@ -0,0 +1,104 @@
+package oidc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `oidc {
+		issuer    https://accounts.example.com
+		client_id client
+		client_secret secret
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(OIDC)
+	if !ok {
+		t.Fatalf("Expected handler to be type OIDC, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestOIDCParse(t *testing.T) {
+	cfg, err := oidcParse(caddy.NewTestController("http", `oidc {
+		issuer        https://accounts.example.com/
+		client_id     client
+		scopes        email groups
+		redirect_path /auth/callback
+		logout_path   /auth/logout
+		cookie_secret s3cret
+		session_ttl   1h
+		header        X-Email email
+		header        X-User preferred_username
+		groups_claim  roles
+		protect       /admin admins ops
+		protect       /app
+		except        /app/static /app/health
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := Config{
+		Issuer:       "https://accounts.example.com/",
+		ClientID:     "client",
+		Scopes:       []string{"openid", "email", "groups"},
+		RedirectPath: "/auth/callback",
+		LogoutPath:   "/auth/logout",
+		SessionTTL:   time.Hour,
+		Headers:      []HeaderClaim{{"X-Email", "email"}, {"X-User", "preferred_username"}},
+		GroupsClaim:  "roles",
+		Rules:        []Rule{{Path: "/admin", Groups: []string{"admins", "ops"}}, {Path: "/app", Groups: []string{}}},
+		Except:       []string{"/app/static", "/app/health"},
+	}
+	if cfg.sealer == nil || cfg.provider == nil || cfg.provider.issuer != "https://accounts.example.com" {
+		t.Errorf("Expected sealer and provider to be set up, got %+v", cfg)
+	}
+	cfg.sealer, cfg.provider = nil, nil
+	if !reflect.DeepEqual(*cfg, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, *cfg)
+	}
+
+	// the whole site is protected by default
+	cfg, err = oidcParse(caddy.NewTestController("http", `oidc {
+		issuer        https://accounts.example.com
+		client_id     client
+		client_secret secret
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(cfg.Rules) != 1 || cfg.Rules[0].Path != "/" || cfg.SessionTTL != defaultSessionTTL {
+		t.Errorf("Expected defaults, got %+v", cfg)
+	}
+
+	for i, input := range []string{
+		`oidc`,
+		"oidc {\n client_id client \n client_secret secret \n}",
+		"oidc {\n issuer https://accounts.example.com \n client_secret secret \n}",
+		"oidc {\n issuer https://accounts.example.com \n client_id client \n}",
+		"oidc {\n issuer accounts.example.com \n client_id client \n client_secret secret \n}",
+		"oidc {\n issuer https://accounts.example.com \n client_id client \n client_secret secret \n session_ttl forever \n}",
+		"oidc {\n issuer https://accounts.example.com \n client_id client \n client_secret secret \n header X-Email \n}",
+		"oidc {\n issuer https://accounts.example.com \n client_id client \n client_secret secret \n login_path /login \n}",
+		"oidc {\n issuer https://accounts.example.com \n client_id a b \n client_secret secret \n}",
+		"oidc /path {\n issuer https://accounts.example.com \n client_id client \n client_secret secret \n}",
+	} {
+		if _, err := oidcParse(caddy.NewTestController("http", input)); err == nil {
+			t.Errorf("Test %d: Expected error for %q but got none", i, input)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("proxy_admin", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setupAdmin,
+		ReloadInPlace: true,
+	})
+}
+
+// Admin is middleware that serves an API to override the
+// health of upstream hosts, for example to take a host out
+// of rotation while it is being deployed, and to purge the
+// response caches of the site's proxies:
+//
+//	GET  {path}                        lists the overrides
+//	POST {path}/healthy?host=h&ttl=d   forces h healthy for d
+//	POST {path}/unhealthy?host=h&ttl=d forces h unhealthy for d
+//	POST {path}/clear?host=h           removes the override of h
+//	POST {path}/purge?url=u            purges the response to u
+//	POST {path}/purge?prefix=p         purges responses under p
+//	POST {path}/purge?tag=t            purges responses tagged t
+//	POST {path}/purge?url=*            purges all responses
+//	GET  {path}/cache                  lists the cache stats
+//	GET  {path}/conns                  lists the connection stats
+//
+// Hosts are named as in the proxy directive, with their scheme.
+// The ttl is a duration like 30m; it defaults to an hour. URLs
+// and prefixes to purge are full URLs or paths of any host, and
+// tags are the surrogate keys responses declare in their
+// Surrogate-Key or Cache-Tag headers; each parameter may be
+// given several times. The cache stats count, for each proxy
+// of the site with a response cache, the requests served from
+// it, also by the first segment of their path; they are also
+// published as the ProxyCache metric. The connection stats
+// count, for each host of each proxy of the site by its base
+// path, the connections dialed, reused and closed; they are
+// also published as the ProxyConns metric.
+type Admin struct {
+	Next httpserver.Handler
+	Path string
+
+	// AllowRemote is whether clients other than those on
+	// the loopback interface may use the API.
+	AllowRemote bool
+
+	// Token, if set, is required of clients as a bearer
+	// token in the Authorization header.
+	Token string
+
+	// Site is the address of the site, whose
+	// response caches are purged.
+	Site string
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (a Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !httpserver.Path(r.URL.Path).Matches(a.Path) {
+		return a.Next.ServeHTTP(w, r)
+	}
+	if !a.AllowRemote && !caddy.IsLoopback(r.RemoteAddr) {
+		return http.StatusForbidden, nil
+	}
+	if a.Token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+a.Token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		return http.StatusUnauthorized, nil
+	}
+
+	verb := strings.Trim(strings.TrimPrefix(r.URL.Path, a.Path), "/")
+	if verb == "" {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			return http.StatusMethodNotAllowed, nil
+		}
+		return httpserver.WriteJSONResponse(w, http.StatusOK, HealthOverrides())
+	}
+	if verb == "cache" || verb == "conns" {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			return http.StatusMethodNotAllowed, nil
+		}
+		if verb == "conns" {
+			return httpserver.WriteJSONResponse(w, http.StatusOK, siteConnStats(a.Site))
+		}
+		return httpserver.WriteJSONResponse(w, http.StatusOK, siteCacheStats(a.Site))
+	}
+	if verb != "healthy" && verb != "unhealthy" && verb != "clear" && verb != "purge" {
+		return http.StatusNotFound, nil
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		return http.StatusMethodNotAllowed, nil
+	}
+	if verb == "purge" {
+		return a.purge(w, r)
+	}
+
+	host := r.FormValue("host")
+	if host == "" {
+		httpserver.WriteTextResponse(w, http.StatusBadRequest, "host is required\n")
+		return 0, nil
+	}
+	if !knownHost(host) {
+		httpserver.WriteTextResponse(w, http.StatusNotFound, "unknown upstream host "+host+"\n")
+		return 0, nil
+	}
+	if verb == "clear" {
+		if !ClearHealthOverride(host) {
+			httpserver.WriteTextResponse(w, http.StatusNotFound, host+" has no override\n")
+			return 0, nil
+		}
+		return http.StatusNoContent, nil
+	}
+
+	ttl := defaultOverrideTTL
+	if v := r.FormValue("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxOverrideTTL {
+			httpserver.WriteTextResponse(w, http.StatusBadRequest, "invalid ttl "+v+"\n")
+			return 0, nil
+		}
+		ttl = d
+	}
+	return httpserver.WriteJSONResponse(w, http.StatusOK, SetHealthOverride(host, verb == "healthy", ttl))
+}
+
+// purge purges the responses that r asks for from
+// the response caches of the site.
+func (a Admin) purge(w http.ResponseWriter, r *http.Request) (int, error) {
+	if err := r.ParseForm(); err != nil {
+		httpserver.WriteTextResponse(w, http.StatusBadRequest, err.Error()+"\n")
+		return 0, nil
+	}
+	var matches []func(string) bool
+	for _, u := range r.Form["url"] {
+		if u == "*" {
+			matches = append(matches, func(string) bool { return true })
+			continue
+		}
+		match, ok := purgeURL(u)
+		if !ok {
+			httpserver.WriteTextResponse(w, http.StatusBadRequest, "invalid url "+u+"\n")
+			return 0, nil
+		}
+		matches = append(matches, match)
+	}
+	for _, p := range r.Form["prefix"] {
+		match, ok := purgePrefix(p)
+		if !ok {
+			httpserver.WriteTextResponse(w, http.StatusBadRequest, "invalid prefix "+p+"\n")
+			return 0, nil
+		}
+		matches = append(matches, match)
+	}
+	tags := r.Form["tag"]
+	if len(matches) == 0 && len(tags) == 0 {
+		httpserver.WriteTextResponse(w, http.StatusBadRequest, "url, prefix or tag is required\n")
+		return 0, nil
+	}
+
+	var match func(string) bool
+	if len(matches) > 0 {
+		match = func(key string) bool {
+			for _, m := range matches {
+				if m(key) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	purged := purgeSite(a.Site, tags, match)
+	return httpserver.WriteJSONResponse(w, http.StatusOK, struct {
+		Purged int `json:"purged"`
+	}{purged})
+}
+
+// setupAdmin configures a new Admin middleware instance. Syntax:
+//
+//	proxy_admin [path] {
+//	    allow_remote
+//	    token        secret
+//	}
+//
+// The path defaults to /proxy-admin. Unless allow_remote is
+// given, only clients on the loopback interface may use the
+// API; otherwise it should be protected by a token, or such
+// as by basicauth.
+func setupAdmin(c *caddy.Controller) error {
+	admin, err := adminParse(c)
+	if err != nil {
+		return err
+	}
+	cfg := httpserver.GetConfig(c)
+	admin.Site = cfg.Addr.String()
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		admin.Next = next
+		return admin
+	})
+	return nil
+}
+
+func adminParse(c *caddy.Controller) (Admin, error) {
+	admin := Admin{Path: defaultAdminPath}
+	var seen bool
+	for c.Next() {
+		if seen {
+			return admin, c.Err("proxy_admin: can only be specified once per site")
+		}
+		seen = true
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			if !strings.HasPrefix(args[0], "/") {
+				return admin, c.Errf("proxy_admin: invalid path '%s'", args[0])
+			}
+			admin.Path = args[0]
+		default:
+			return admin, c.ArgErr()
+		}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "allow_remote":
+				if c.NextArg() {
+					return admin, c.ArgErr()
+				}
+				admin.AllowRemote = true
+			case "token":
+				if !c.NextArg() {
+					return admin, c.ArgErr()
+				}
+				admin.Token = c.Val()
+				if c.NextArg() {
+					return admin, c.ArgErr()
+				}
+			default:
+				return admin, c.Errf("proxy_admin: unknown property '%s'", c.Val())
+			}
+		}
+	}
+	return admin, nil
+}
+
+const (
+	defaultAdminPath   = "/proxy-admin"
+	defaultOverrideTTL = time.Hour
+	maxOverrideTTL     = 7 * 24 * time.Hour
+)
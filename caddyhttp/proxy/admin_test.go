@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestHealthOverride(t *testing.T) {
+	upstream := &staticUpstream{MaxFails: 1}
+	uh, err := upstream.NewHost("override.example:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ClearHealthOverride(uh.Name)
+
+	uh.Unhealthy = true
+	SetHealthOverride(uh.Name, true, time.Minute)
+	if uh.Down() {
+		t.Error("Expected host forced healthy not to be down")
+	}
+
+	uh.Unhealthy = false
+	SetHealthOverride(uh.Name, false, time.Minute)
+	if !uh.Down() {
+		t.Error("Expected host forced unhealthy to be down")
+	}
+
+	SetHealthOverride(uh.Name, false, -time.Second)
+	if uh.Down() {
+		t.Error("Expected expired override to be ignored")
+	}
+	if got := HealthOverrides(); len(got) != 0 {
+		t.Errorf("Expected no overrides to be listed, got %v", got)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	upstream := &staticUpstream{MaxFails: 1}
+	uh, err := upstream.NewHost("admin.example:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ClearHealthOverride(uh.Name)
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusTeapot, nil
+	})
+	admin := Admin{Next: next, Path: "/admin"}
+	for i, test := range []struct {
+		method, target, remote string
+		expectStatus           int
+		expectBody             string
+		expectDown             bool
+	}{
+		{"POST", "/admin/unhealthy?host=http://admin.example:8080&ttl=10m", "127.0.0.1:1234", 0, `"healthy":false`, true},
+		{"GET", "/admin", "127.0.0.1:1234", 0, `"host":"http://admin.example:8080"`, true},
+		{"POST", "/admin/healthy?host=http://admin.example:8080", "[::1]:1234", 0, `"healthy":true`, false},
+		{"POST", "/admin/clear?host=http://admin.example:8080", "127.0.0.1:1234", http.StatusNoContent, "", false},
+		{"POST", "/admin/clear?host=http://admin.example:8080", "127.0.0.1:1234", 0, "has no override", false},
+		{"POST", "/admin/unhealthy?host=http://admin.example:8080", "192.0.2.1:1234", http.StatusForbidden, "", false},
+		{"POST", "/admin/unhealthy?host=http://other.example:8080", "127.0.0.1:1234", 0, "unknown upstream host", false},
+		{"POST", "/admin/unhealthy", "127.0.0.1:1234", 0, "host is required", false},
+		{"POST", "/admin/unhealthy?host=http://admin.example:8080&ttl=1y", "127.0.0.1:1234", 0, "invalid ttl", false},
+		{"POST", "/admin/unhealthy?host=http://admin.example:8080&ttl=-1m", "127.0.0.1:1234", 0, "invalid ttl", false},
+		{"GET", "/admin/unhealthy?host=http://admin.example:8080", "127.0.0.1:1234", http.StatusMethodNotAllowed, "", false},
+		{"POST", "/admin/restart", "127.0.0.1:1234", http.StatusNotFound, "", false},
+	} {
+		r := httptest.NewRequest(test.method, test.target, nil)
+		r.RemoteAddr = test.remote
+		w := httptest.NewRecorder()
+
+		status, err := admin.ServeHTTP(w, r)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if status != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if !strings.Contains(w.Body.String(), test.expectBody) {
+			t.Errorf("Test %d: Expected body to contain '%s', got '%s'", i, test.expectBody, w.Body.String())
+		}
+		if uh.Down() != test.expectDown {
+			t.Errorf("Test %d: Expected host down to be %v", i, test.expectDown)
+		}
+	}
+
+	// other requests are passed on
+	status, _ := admin.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/other", nil))
+	if status != http.StatusTeapot {
+		t.Errorf("Expected other requests to be passed on, got status %d", status)
+	}
+}
+
+func TestAdminParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  Admin
+	}{
+		{`proxy_admin`, false, Admin{Path: "/proxy-admin"}},
+		{`proxy_admin /upstreams`, false, Admin{Path: "/upstreams"}},
+		{"proxy_admin /upstreams {\n allow_remote\n}", false, Admin{Path: "/upstreams", AllowRemote: true}},
+		{"proxy_admin {\n allow_remote\n token s3cret\n}", false, Admin{Path: "/proxy-admin", AllowRemote: true, Token: "s3cret"}},
+		{"proxy_admin {\n token\n}", true, Admin{}},
+		{"proxy_admin {\n token a b\n}", true, Admin{}},
+		{`proxy_admin upstreams`, true, Admin{}},
+		{`proxy_admin /a /b`, true, Admin{}},
+		{"proxy_admin {\n allow_remote yes\n}", true, Admin{}},
+		{"proxy_admin {\n allow_all\n}", true, Admin{}},
+		{"proxy_admin\nproxy_admin /b", true, Admin{}},
+	} {
+		admin, err := adminParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if admin != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, admin)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/internal/kvstore"
+)
+
+var supportedAffinityStores = make(map[string]func(*url.URL) (AffinityStore, error))
+
+func init() {
+	RegisterAffinityStore("memory", func(*url.URL) (AffinityStore, error) { return newMemoryStore(), nil })
+	RegisterAffinityStore("redis", newRedisStore)
+	RegisterAffinityStore("memcache", newMemcacheStore)
+}
+
+func newRedisStore(u *url.URL) (AffinityStore, error) {
+	store, err := kvstore.NewRedis(u)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func newMemcacheStore(u *url.URL) (AffinityStore, error) {
+	store, err := kvstore.NewMemcache(u)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// AffinityStore maps session keys to the names of the upstream
+// hosts serving the sessions. A store shared by several Caddy
+// instances keeps each session on the same host, whichever of
+// the instances its requests reach.
+type AffinityStore interface {
+	// Get returns the name of the host for key,
+	// or "" if there is none.
+	Get(key string) (string, error)
+
+	// Set maps key to the host with the given
+	// name for the duration of ttl.
+	Set(key, host string, ttl time.Duration) error
+}
+
+// RegisterAffinityStore adds a kind of affinity store to the proxy.
+// Stores of that kind are configured with a URL of the given scheme,
+// which is passed to newStore.
+func RegisterAffinityStore(scheme string, newStore func(*url.URL) (AffinityStore, error)) {
+	supportedAffinityStores[scheme] = newStore
+}
+
+// Affinity sends the requests of a session to the same host.
+type Affinity struct {
+	// Where the session key is taken from:
+	// "cookie", "header" or "ip"
+	Source string
+
+	// Name of the cookie or header with the session key
+	Name string
+
+	// Store of the host of each session
+	Store AffinityStore
+
+	// How long the host of a session is remembered
+	TTL time.Duration
+
+	// Namespace of the keys in the store, so that
+	// upstreams don't share sessions
+	Namespace string
+}
+
+// sessionKey returns the session key of r, or "" if r
+// is not part of a session.
+func (a *Affinity) sessionKey(r *http.Request) string {
+	switch a.Source {
+	case "cookie":
+		if c, err := r.Cookie(a.Name); err == nil {
+			return c.Value
+		}
+	case "header":
+		return r.Header.Get(a.Name)
+	case "ip":
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	}
+	return ""
+}
+
+// storeKey returns the key under which the host of the
+// session is stored. Session keys are hashed, so that
+// they are valid keys for any store.
+func (a *Affinity) storeKey(session string) string {
+	sum := sha1.Sum([]byte(a.Namespace + "\x00" + session))
+	return "caddy:affinity:" + hex.EncodeToString(sum[:])
+}
+
+// lookup returns the host of the session of r if it is
+// in pool and available, or nil.
+func (a *Affinity) lookup(r *http.Request, pool HostPool) *UpstreamHost {
+	session := a.sessionKey(r)
+	if session == "" {
+		return nil
+	}
+	name, err := a.Store.Get(a.storeKey(session))
+	if err != nil {
+		log.Printf("[ERROR] Getting session affinity: %v", err)
+		return nil
+	}
+	if name == "" {
+		return nil
+	}
+	for _, host := range pool {
+		if host.Name == name && host.Available() {
+			return host
+		}
+	}
+	return nil
+}
+
+// remember stores host as the host of session.
+func (a *Affinity) remember(session string, host *UpstreamHost) {
+	if session == "" {
+		return
+	}
+	if err := a.Store.Set(a.storeKey(session), host.Name, a.TTL); err != nil {
+		log.Printf("[ERROR] Setting session affinity: %v", err)
+	}
+}
+
+// recordSession returns a respUpdateFn that remembers host
+// as the host of a session the host starts by setting the
+// session cookie, then calls next, if not nil.
+func (a *Affinity) recordSession(host *UpstreamHost, next respUpdateFn) respUpdateFn {
+	if a.Source != "cookie" {
+		return next
+	}
+	return func(resp *http.Response) {
+		for _, c := range resp.Cookies() {
+			if c.Name == a.Name && c.Value != "" && c.MaxAge >= 0 {
+				a.remember(c.Value, host)
+			}
+		}
+		if next != nil {
+			next(resp)
+		}
+	}
+}
+
+// memoryStore is an AffinityStore in memory,
+// which is not shared with other instances.
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	sets    int
+}
+
+type memoryEntry struct {
+	host    string
+	expires time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: make(map[string]memoryEntry)}
+}
+
+// Get implements AffinityStore.
+func (s *memoryStore) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return "", nil
+	}
+	return e.host, nil
+}
+
+// Set implements AffinityStore.
+func (s *memoryStore) Set(key, host string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.entries[key] = memoryEntry{host: host, expires: now.Add(ttl)}
+
+	// purge expired entries now and then
+	if s.sets++; s.sets%memoryPurgeInterval == 0 {
+		for k, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	return nil
+}
+
+const (
+	// DefaultAffinityTTL is how long the host of a
+	// session is remembered if not configured.
+	DefaultAffinityTTL = 1 * time.Hour
+
+	memoryPurgeInterval = 1024
+)
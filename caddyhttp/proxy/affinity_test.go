@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+func TestParseAffinity(t *testing.T) {
+	tests := []struct {
+		config    string
+		shouldErr bool
+		expected  Affinity
+	}{
+		{"proxy / a b {\n affinity cookie sessionid \n}", false,
+			Affinity{Source: "cookie", Name: "sessionid", TTL: DefaultAffinityTTL, Namespace: "/"}},
+		{"proxy /api a b {\n affinity header X-Session \n affinity_ttl 24h \n}", false,
+			Affinity{Source: "header", Name: "X-Session", TTL: 24 * time.Hour, Namespace: "/api"}},
+		{"proxy / a b {\n affinity_store memory \n affinity ip \n}", false,
+			Affinity{Source: "ip", TTL: DefaultAffinityTTL, Namespace: "/"}},
+		{"proxy / a b {\n affinity cookie \n}", true, Affinity{}},
+		{"proxy / a b {\n affinity ip extra \n}", true, Affinity{}},
+		{"proxy / a b {\n affinity url \n}", true, Affinity{}},
+		{"proxy / a b {\n affinity ip \n affinity_store mongodb://localhost \n}", true, Affinity{}},
+		{"proxy / a b {\n affinity ip \n affinity_store redis://localhost/x \n}", true, Affinity{}},
+		{"proxy / a b {\n affinity ip \n affinity_ttl 0s \n}", true, Affinity{}},
+		{"proxy / a b {\n affinity_store redis://localhost \n}", true, Affinity{}},
+	}
+
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		a := upstreams[0].(*staticUpstream).Affinity
+		if a == nil || a.Store == nil {
+			t.Errorf("Test %d: Expected affinity with a store, got %+v", i, a)
+			continue
+		}
+		a.Store = nil
+		if *a != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, *a)
+		}
+	}
+}
+
+func TestAffinitySelect(t *testing.T) {
+	store := newMemoryStore()
+	newUpstream := func() *staticUpstream {
+		return &staticUpstream{
+			from: "/",
+			Hosts: HostPool{
+				{Name: "http://a"},
+				{Name: "http://b"},
+				{Name: "http://c"},
+			},
+			Policy:   &RoundRobin{},
+			Affinity: &Affinity{Source: "header", Name: "X-Session", Store: store, TTL: time.Minute, Namespace: "/"},
+		}
+	}
+	// two instances sharing a store
+	u1, u2 := newUpstream(), newUpstream()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Session", "alice")
+	first := u1.Select(r)
+	for i := 0; i < 5; i++ {
+		if host := u1.Select(r); host.Name != first.Name {
+			t.Fatalf("Expected session to stay on %s, got %s", first.Name, host.Name)
+		}
+		if host := u2.Select(r); host.Name != first.Name {
+			t.Fatalf("Expected session to stay on %s on the other instance, got %s", first.Name, host.Name)
+		}
+	}
+
+	// if the host goes down, the session moves to another one and stays there
+	for _, host := range u2.Hosts {
+		if host.Name == first.Name {
+			host.Unhealthy = true
+		}
+	}
+	moved := u2.Select(r)
+	if moved.Name == first.Name {
+		t.Fatalf("Expected session to move away from unhealthy host %s", first.Name)
+	}
+	if host := u2.Select(r); host.Name != moved.Name {
+		t.Errorf("Expected moved session to stay on %s, got %s", moved.Name, host.Name)
+	}
+
+	// requests without a session are not sticky
+	r.Header.Del("X-Session")
+	if u1.Select(r).Name == u1.Select(r).Name {
+		t.Error("Expected requests without a session to be balanced")
+	}
+}
+
+func TestAffinityRecordSession(t *testing.T) {
+	a := &Affinity{Source: "cookie", Name: "sid", Store: newMemoryStore(), TTL: time.Minute}
+	host := &UpstreamHost{Name: "http://b"}
+
+	var called bool
+	fn := a.recordSession(host, func(*http.Response) { called = true })
+	resp := &http.Response{Header: http.Header{"Set-Cookie": {"sid=abc123; Path=/"}}}
+	fn(resp)
+	if !called {
+		t.Error("Expected next respUpdateFn to be called")
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", "sid=abc123")
+	if got := a.lookup(r, HostPool{{Name: "http://a"}, host}); got != host {
+		t.Errorf("Expected session started by response to be on %s, got %v", host.Name, got)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := newMemoryStore()
+	if host, err := store.Get("missing"); err != nil || host != "" {
+		t.Errorf("Expected no host and no error for missing key, got '%s' and %v", host, err)
+	}
+	for i := 0; i < 3; i++ {
+		name := "http://backend" + strconv.Itoa(i)
+		if err := store.Set("key", name, time.Minute); err != nil {
+			t.Fatalf("Expected no error setting key, got %v", err)
+		}
+		if host, err := store.Get("key"); err != nil || host != name {
+			t.Errorf("Expected '%s', got '%s' (error: %v)", name, host, err)
+		}
+	}
+	if err := store.Set("expired", "http://backend", -time.Second); err != nil {
+		t.Fatalf("Expected no error setting key, got %v", err)
+	}
+	if host, _ := store.Get("expired"); host != "" {
+		t.Errorf("Expected no host for expired key, got '%s'", host)
+	}
+}
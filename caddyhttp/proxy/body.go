@@ -8,6 +8,7 @@ import (
 
 type bufferedBody struct {
 	*bytes.Reader
+	buf []byte
 }
 
 func (*bufferedBody) Close() error {
@@ -23,6 +24,14 @@ func (b *bufferedBody) rewind() error {
 	return err
 }
 
+// bytes returns all of the body, whatever has been read.
+func (b *bufferedBody) bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.buf
+}
+
 // newBufferedBody returns *bufferedBody to use in place of src. Closes src
 // and returns Read error on src. All content from src is buffered.
 func newBufferedBody(src io.ReadCloser) (*bufferedBody, error) {
@@ -36,5 +45,6 @@ func newBufferedBody(src io.ReadCloser) (*bufferedBody, error) {
 	}
 	return &bufferedBody{
 		Reader: bytes.NewReader(b),
+		buf:    b,
 	}, nil
 }
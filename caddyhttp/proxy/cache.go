@@ -0,0 +1,487 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// ResponseCache is a shared cache of the responses of an
+// upstream, for the time they are fresh by their Cache-Control
+// or Expires headers. Entries that are stale but have validators
+// (ETag or Last-Modified) are revalidated with a conditional
+// request: if the upstream answers 304 Not Modified, the entry
+// is refreshed and served without its body being sent again.
+type ResponseCache struct {
+	// Total size of the bodies of the entries; the least
+	// recently used entries are evicted to stay below it
+	MaxSize int64
+
+	// Largest response body that is cached
+	MaxBody int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     list.List // of *cacheEntry, most recently used first
+	size    int64
+
+	// keys of the entries by their surrogate keys
+	tagged map[string]map[string]struct{}
+
+	// for the stats of the cache
+	name      string
+	collapser *RequestCollapser
+	counters  cacheCounters
+}
+
+// cacheEntry is a cached response.
+type cacheEntry struct {
+	key    string
+	status int
+	header http.Header
+	body   []byte
+
+	// values of the request header fields the
+	// response varies by, by field
+	vary map[string]string
+
+	// surrogate keys of the response, to purge it by
+	tags []string
+
+	// when the response was received or last
+	// validated, and how long it is fresh after
+	validated time.Time
+	freshFor  time.Duration
+}
+
+// newResponseCache returns a ResponseCache with default settings.
+func newResponseCache() *ResponseCache {
+	return &ResponseCache{MaxSize: defaultCacheMaxSize, MaxBody: defaultCacheMaxBody}
+}
+
+// serve writes the cached response to r to w, if there is a fresh
+// one. Otherwise it calls proxy with the request to send upstream,
+// which revalidates the cached response if there is a stale one.
+func (rc *ResponseCache) serve(w http.ResponseWriter, r *http.Request, proxy func(http.ResponseWriter, *http.Request) (int, error)) (int, error) {
+	key, ok := cacheKey(r)
+	if !ok {
+		rc.counters.count(r.URL.Path, cacheBypass, 0)
+		return proxy(w, r)
+	}
+
+	e := rc.get(key, r)
+	if e != nil && !requestNoCache(r) && cacheNow().Sub(e.validated) < e.freshFor {
+		rc.counters.count(r.URL.Path, cacheHit, e.write(w, r))
+		return 0, nil
+	}
+
+	// the conditions of the client are evaluated against the
+	// entry, so that the full response can be cached
+	outreq := new(http.Request)
+	*outreq = *r
+	outreq.Header = make(http.Header)
+	copyHeader(outreq.Header, r.Header)
+	outreq.Header.Del("If-None-Match")
+	outreq.Header.Del("If-Modified-Since")
+	var revalidating bool
+	if e != nil {
+		if etag := e.header.Get("ETag"); etag != "" {
+			outreq.Header.Set("If-None-Match", etag)
+			revalidating = true
+		}
+		if lastMod := e.header.Get("Last-Modified"); lastMod != "" {
+			outreq.Header.Set("If-Modified-Since", lastMod)
+			revalidating = true
+		}
+	}
+
+	cw := &cachingWriter{ResponseWriter: w, header: make(http.Header), revalidating: revalidating, max: rc.MaxBody}
+	status, err := proxy(cw, outreq)
+	if cw.notModified {
+		if refreshed := rc.refresh(key, e, cw.header); refreshed != nil {
+			e = refreshed
+		}
+		rc.counters.count(r.URL.Path, cacheStale, e.write(w, r))
+		return 0, nil
+	}
+	rc.counters.count(r.URL.Path, cacheMiss, 0)
+	if status != 0 || err != nil || cw.status == 0 {
+		return status, err
+	}
+
+	if freshFor, ok := cacheable(cw.status, cw.header); ok && !cw.overflow {
+		tags := surrogateKeys(cw.header)
+		for _, field := range surrogateKeyFields {
+			cw.header.Del(field)
+		}
+		rc.put(&cacheEntry{
+			key:       key,
+			status:    cw.status,
+			header:    cw.header,
+			body:      cw.body.Bytes(),
+			vary:      varyValues(r, cw.header),
+			tags:      tags,
+			validated: cacheNow(),
+			freshFor:  freshFor,
+		})
+	} else if e != nil {
+		rc.remove(key)
+	}
+	return 0, nil
+}
+
+// get returns a copy of the entry of key that was cached
+// for requests like r, if there is one.
+func (rc *ResponseCache) get(key string, r *http.Request) *cacheEntry {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	el, ok := rc.entries[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*cacheEntry)
+	for field, value := range e.vary {
+		if strings.Join(r.Header[field], ",") != value {
+			return nil
+		}
+	}
+	rc.lru.MoveToFront(el)
+	entry := *e
+	return &entry
+}
+
+// put caches e, evicting the least recently used
+// entries to make room for it.
+func (rc *ResponseCache) put(e *cacheEntry) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.entries == nil {
+		rc.entries = make(map[string]*list.Element)
+	}
+	if el, ok := rc.entries[e.key]; ok {
+		rc.removeElement(el)
+	}
+	rc.entries[e.key] = rc.lru.PushFront(e)
+	rc.size += int64(len(e.body))
+	for _, tag := range e.tags {
+		if rc.tagged == nil {
+			rc.tagged = make(map[string]map[string]struct{})
+		}
+		if rc.tagged[tag] == nil {
+			rc.tagged[tag] = make(map[string]struct{})
+		}
+		rc.tagged[tag][e.key] = struct{}{}
+	}
+	for rc.size > rc.MaxSize && rc.lru.Len() > 1 {
+		rc.removeElement(rc.lru.Back())
+	}
+}
+
+// remove removes the entry of key, if there is one.
+func (rc *ResponseCache) remove(key string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if el, ok := rc.entries[key]; ok {
+		rc.removeElement(el)
+	}
+}
+
+func (rc *ResponseCache) removeElement(el *list.Element) {
+	e := rc.lru.Remove(el).(*cacheEntry)
+	delete(rc.entries, e.key)
+	rc.size -= int64(len(e.body))
+	for _, tag := range e.tags {
+		delete(rc.tagged[tag], e.key)
+		if len(rc.tagged[tag]) == 0 {
+			delete(rc.tagged, tag)
+		}
+	}
+}
+
+// refresh updates the entry of key, which e is a copy of, with
+// the header of a 304 response that validated it, and returns
+// a copy of it, or nil if it was replaced in the meantime.
+func (rc *ResponseCache) refresh(key string, e *cacheEntry, header http.Header) *cacheEntry {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	el, ok := rc.entries[key]
+	if !ok || !bytes.Equal(el.Value.(*cacheEntry).body, e.body) {
+		return nil
+	}
+	e = el.Value.(*cacheEntry)
+	updated := make(http.Header)
+	copyHeader(updated, e.header)
+	for field, values := range header {
+		switch field {
+		case "Content-Length", "Content-Encoding", "Content-Type", "Content-Range", "Transfer-Encoding":
+			// these describe the body, which
+			// a 304 response does not have
+		case "Surrogate-Key", "Cache-Tag", "Cache-Tags":
+			// the entry keeps the keys it was stored with
+		default:
+			updated[field] = values
+		}
+	}
+	e.header = updated
+	e.validated = cacheNow()
+	e.freshFor, _ = freshness(updated)
+	entry := *e
+	return &entry
+}
+
+// write writes the response of e to r to w, or 304 Not
+// Modified if it meets the conditions of the client, and
+// returns the size of the body written.
+func (e *cacheEntry) write(w http.ResponseWriter, r *http.Request) int {
+	copyHeader(w.Header(), e.header)
+	w.Header().Set("Age", strconv.Itoa(int(cacheNow().Sub(e.validated).Seconds())))
+	if e.status == http.StatusOK && notModified(r, e.header) {
+		w.Header().Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return 0
+	}
+	w.WriteHeader(e.status)
+	n, _ := w.Write(e.body)
+	return n
+}
+
+// notModified returns whether the conditions of r hold
+// for a response with header.
+func notModified(r *http.Request, header http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		since, err := http.ParseTime(ims)
+		lastMod, err2 := http.ParseTime(header.Get("Last-Modified"))
+		return err == nil && err2 == nil && !lastMod.After(since)
+	}
+	return false
+}
+
+// cacheKey returns the key of the responses to r, and
+// whether a response to r may be cached: r must be a GET
+// request for the whole of a resource, without credentials.
+func cacheKey(r *http.Request) (string, bool) {
+	if r.Method != http.MethodGet || r.ContentLength > 0 || requestIsWebsocket(r) {
+		return "", false
+	}
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Range") != "" {
+		return "", false
+	}
+	for _, directive := range r.Header["Cache-Control"] {
+		if strings.Contains(directive, "no-store") {
+			return "", false
+		}
+	}
+	return r.Host + " " + r.URL.RequestURI(), true
+}
+
+// requestNoCache returns whether the client of r asks
+// for a response validated by the upstream.
+func requestNoCache(r *http.Request) bool {
+	for _, directive := range r.Header["Cache-Control"] {
+		if strings.Contains(directive, "no-cache") || strings.Contains(directive, "max-age=0") {
+			return true
+		}
+	}
+	return r.Header.Get("Pragma") == "no-cache"
+}
+
+// cacheable returns how long a response with status and header
+// is fresh, and whether it may be cached: it must be fresh for
+// a while or have validators.
+func cacheable(status int, header http.Header) (time.Duration, bool) {
+	switch status {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusMovedPermanently,
+		http.StatusNotFound, http.StatusGone:
+	default:
+		return 0, false
+	}
+	if header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+	for _, vary := range header["Vary"] {
+		if strings.TrimSpace(vary) == "*" {
+			return 0, false
+		}
+	}
+	freshFor, ok := freshness(header)
+	if !ok {
+		return 0, false
+	}
+	hasValidators := header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+	return freshFor, freshFor > 0 || hasValidators
+}
+
+// freshness returns how long a response with header is fresh
+// after it was received, and whether it may be stored at all.
+func freshness(header http.Header) (time.Duration, bool) {
+	var maxAge, sMaxAge time.Duration = -1, -1
+	for _, value := range header["Cache-Control"] {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			switch {
+			case directive == "no-store", directive == "private":
+				return 0, false
+			case directive == "no-cache":
+				return 0, true
+			case strings.HasPrefix(directive, "s-maxage="):
+				if secs, err := strconv.Atoi(directive[len("s-maxage="):]); err == nil {
+					sMaxAge = time.Duration(secs) * time.Second
+				}
+			case strings.HasPrefix(directive, "max-age="):
+				if secs, err := strconv.Atoi(directive[len("max-age="):]); err == nil {
+					maxAge = time.Duration(secs) * time.Second
+				}
+			}
+		}
+	}
+	var freshFor time.Duration
+	switch {
+	case sMaxAge >= 0:
+		freshFor = sMaxAge
+	case maxAge >= 0:
+		freshFor = maxAge
+	default:
+		if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+			date, err := http.ParseTime(header.Get("Date"))
+			if err != nil {
+				date = cacheNow()
+			}
+			freshFor = expires.Sub(date)
+		}
+	}
+	// the response may have aged in caches before
+	if age, err := strconv.Atoi(header.Get("Age")); err == nil {
+		freshFor -= time.Duration(age) * time.Second
+	}
+	if freshFor < 0 {
+		freshFor = 0
+	}
+	return freshFor, true
+}
+
+// varyValues returns the values of the request header fields
+// of r that a response with header varies by.
+func varyValues(r *http.Request, header http.Header) map[string]string {
+	var values map[string]string
+	for _, vary := range header["Vary"] {
+		for _, field := range strings.Split(vary, ",") {
+			field = http.CanonicalHeaderKey(strings.TrimSpace(field))
+			if field == "" {
+				continue
+			}
+			if values == nil {
+				values = make(map[string]string)
+			}
+			values[field] = strings.Join(r.Header[field], ",")
+		}
+	}
+	return values
+}
+
+// cachingWriter writes a response through, keeping its
+// status, header and as much of its body as may be cached.
+// A 304 response to a revalidation is not written through,
+// as the client gets the cached response instead.
+type cachingWriter struct {
+	http.ResponseWriter
+	header       http.Header
+	revalidating bool
+	notModified  bool
+	max          int64
+	status       int
+	body         bytes.Buffer
+	overflow     bool
+}
+
+// Header implements http.ResponseWriter.
+func (w *cachingWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *cachingWriter) WriteHeader(status int) {
+	if w.status != 0 || w.notModified {
+		return
+	}
+	if w.revalidating && status == http.StatusNotModified {
+		w.notModified = true
+		return
+	}
+	w.status = status
+	copyHeader(w.ResponseWriter.Header(), w.header)
+	for _, field := range surrogateKeyFields {
+		// for the cache only
+		w.ResponseWriter.Header().Del(field)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter.
+func (w *cachingWriter) Write(p []byte) (int, error) {
+	if w.notModified {
+		return len(p), nil
+	}
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.overflow {
+		if int64(w.body.Len()+len(p)) > w.max {
+			w.overflow = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(p)
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher, if the underlying writer does.
+func (w *cachingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && !w.notModified {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, if the underlying writer
+// does. The response of a hijacked connection is not cached.
+func (w *cachingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.overflow = true
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, httpserver.NonHijackerError{Underlying: w.ResponseWriter}
+}
+
+// cacheNow returns the current time; tests replace it.
+var cacheNow = time.Now
+
+const (
+	// defaultCacheMaxSize is the total size of the bodies
+	// of cached responses if not configured.
+	defaultCacheMaxSize = 64 << 20
+
+	// defaultCacheMaxBody is the largest response body
+	// that is cached if not configured.
+	defaultCacheMaxBody = 1 << 20
+)
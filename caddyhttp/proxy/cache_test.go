@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestParseCache(t *testing.T) {
+	tests := []struct {
+		config          string
+		shouldErr       bool
+		expectedMaxSize int64
+		expectedMaxBody int64
+	}{
+		{"proxy / a {\n cache \n}", false, defaultCacheMaxSize, defaultCacheMaxBody},
+		{"proxy / a {\n cache 10MB \n}", false, 10000000, defaultCacheMaxBody},
+		{"proxy / a {\n cache 10MB 64KB \n}", false, 10000000, 64000},
+		{"proxy / a {\n cache big \n}", true, 0, 0},
+		{"proxy / a {\n cache 10MB 0 \n}", true, 0, 0},
+		{"proxy / a {\n cache 10MB 1MB 2MB \n}", true, 0, 0},
+	}
+
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		rc := upstreams[0].(*staticUpstream).Cache
+		if rc == nil || rc.MaxSize != test.expectedMaxSize || rc.MaxBody != test.expectedMaxBody {
+			t.Errorf("Test %d: Expected cache of %d with max body %d, got %+v", i, test.expectedMaxSize, test.expectedMaxBody, rc)
+		}
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	now := time.Date(2017, 5, 1, 12, 0, 0, 0, time.UTC)
+	cacheNow = func() time.Time { return now }
+	defer func() { cacheNow = time.Now }()
+
+	var hits, notModified int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		switch r.URL.Path {
+		case "/etag":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/lastmod":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Last-Modified", "Mon, 01 May 2017 10:00:00 GMT")
+			if r.Header.Get("If-Modified-Since") == "Mon, 01 May 2017 10:00:00 GMT" {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("Hello " + r.URL.Path))
+	}))
+	defer backend.Close()
+
+	upstream := &staticUpstream{
+		from:   "/",
+		Hosts:  HostPool{{Name: backend.URL}},
+		Policy: &Random{},
+		Cache:  newResponseCache(),
+	}
+	p := &Proxy{Next: httpserver.EmptyNext, Upstreams: []Upstream{upstream}}
+
+	for i, test := range []struct {
+		path                string
+		header              []string
+		advance             time.Duration
+		expectedCode        int
+		expectedHits        int32
+		expectedNotModified int32
+	}{
+		// cached while fresh, then revalidated with If-None-Match
+		{"/etag", nil, 0, http.StatusOK, 1, 0},
+		{"/etag", nil, 30 * time.Second, http.StatusOK, 0, 0},
+		{"/etag", nil, time.Minute, http.StatusOK, 1, 1},
+		{"/etag", nil, 30 * time.Second, http.StatusOK, 0, 0},
+		// conditions of clients are answered from the cache
+		{"/etag", []string{"If-None-Match", `"v1"`}, 0, http.StatusNotModified, 0, 0},
+		{"/etag", []string{"If-None-Match", `"v0"`}, 0, http.StatusOK, 0, 0},
+		// clients may ask for revalidation
+		{"/etag", []string{"Cache-Control", "no-cache"}, 0, http.StatusOK, 1, 1},
+		// revalidated every time with If-Modified-Since
+		{"/lastmod", nil, 0, http.StatusOK, 1, 0},
+		{"/lastmod", nil, 0, http.StatusOK, 1, 1},
+		{"/lastmod", []string{"If-Modified-Since", "Mon, 01 May 2017 11:00:00 GMT"}, 0, http.StatusNotModified, 1, 1},
+		// not cached
+		{"/private", nil, 0, http.StatusOK, 1, 0},
+		{"/private", nil, 0, http.StatusOK, 1, 0},
+		{"/etag", []string{"Authorization", "Basic YTpi"}, 0, http.StatusOK, 1, 0},
+	} {
+		now = now.Add(test.advance)
+		atomic.StoreInt32(&hits, 0)
+		atomic.StoreInt32(&notModified, 0)
+		r := httptest.NewRequest("GET", test.path, nil)
+		for j := 0; j < len(test.header); j += 2 {
+			r.Header.Set(test.header[j], test.header[j+1])
+		}
+		w := httptest.NewRecorder()
+		if _, err := p.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if w.Code != test.expectedCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedCode, w.Code)
+		}
+		if test.expectedCode == http.StatusOK && w.Body.String() != "Hello "+test.path {
+			t.Errorf("Test %d: Expected body 'Hello %s', got '%s'", i, test.path, w.Body.String())
+		}
+		if got := atomic.LoadInt32(&hits); got != test.expectedHits {
+			t.Errorf("Test %d: Expected %d requests to reach the backend, got %d", i, test.expectedHits, got)
+		}
+		if got := atomic.LoadInt32(&notModified); got != test.expectedNotModified {
+			t.Errorf("Test %d: Expected %d revalidations, got %d", i, test.expectedNotModified, got)
+		}
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	rc := &ResponseCache{MaxSize: 10, MaxBody: 10}
+	for _, key := range []string{"a", "b", "c"} {
+		rc.put(&cacheEntry{key: key, body: []byte("1234")})
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	if rc.get("a", r) != nil {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	if rc.get("b", r) == nil || rc.get("c", r) == nil {
+		t.Error("Expected recent entries to be kept")
+	}
+	if rc.size != 8 {
+		t.Errorf("Expected size 8, got %d", rc.size)
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	for i, test := range []struct {
+		header   http.Header
+		expected time.Duration
+		ok       bool
+	}{
+		{http.Header{}, 0, true},
+		{http.Header{"Cache-Control": {"public, max-age=60"}}, time.Minute, true},
+		{http.Header{"Cache-Control": {"max-age=60, s-maxage=120"}}, 2 * time.Minute, true},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Age": {"20"}}, 40 * time.Second, true},
+		{http.Header{"Cache-Control": {"no-cache, max-age=60"}}, 0, true},
+		{http.Header{"Cache-Control": {"no-store"}}, 0, false},
+		{http.Header{"Expires": {"Mon, 01 May 2017 12:10:00 GMT"}, "Date": {"Mon, 01 May 2017 12:00:00 GMT"}}, 10 * time.Minute, true},
+	} {
+		got, ok := freshness(test.header)
+		if got != test.expected || ok != test.ok {
+			t.Errorf("Test %d: Expected %v, %v, got %v, %v", i, test.expected, test.ok, got, ok)
+		}
+	}
+}
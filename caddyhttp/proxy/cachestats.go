@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"expvar"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// CacheStats are counts of how the requests to an upstream
+// with a response cache or request collapsing were served.
+type CacheStats struct {
+	// Upstream is the path the upstream proxies
+	Upstream string `json:"upstream"`
+
+	// Hits are requests served from a fresh entry, Stale those
+	// served from an entry revalidated by the upstream, Misses
+	// those served by the upstream, and Bypass those that may
+	// not be cached at all
+	Hits   int64 `json:"hits"`
+	Stale  int64 `json:"stale"`
+	Misses int64 `json:"misses"`
+	Bypass int64 `json:"bypass"`
+
+	// BytesServed is the size of the bodies served from entries
+	BytesServed int64 `json:"bytes_served"`
+
+	// Collapsed are requests served the response of
+	// an identical request that was in flight
+	Collapsed int64 `json:"collapsed"`
+
+	// HitRatio is the part of the requests that may be cached
+	// that were served from entries, fresh or revalidated
+	HitRatio float64 `json:"hit_ratio"`
+
+	// Prefixes are the counts by the first segment of
+	// the request path, like /static/
+	Prefixes map[string]*PrefixStats `json:"prefixes,omitempty"`
+
+	// Entries and Size are the number of entries
+	// and the total size of their bodies
+	Entries int   `json:"entries"`
+	Size    int64 `json:"size"`
+}
+
+// PrefixStats are the counts of the requests under a path prefix.
+type PrefixStats struct {
+	Hits     int64   `json:"hits"`
+	Stale    int64   `json:"stale"`
+	Misses   int64   `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// cacheOutcome is how a request was served by a response cache.
+type cacheOutcome int
+
+const (
+	cacheHit cacheOutcome = iota
+	cacheStale
+	cacheMiss
+	cacheBypass
+)
+
+// cacheCounters are the counts of a response cache.
+type cacheCounters struct {
+	mu       sync.Mutex
+	hits     int64
+	stale    int64
+	misses   int64
+	bypass   int64
+	bytes    int64
+	prefixes map[string]*PrefixStats
+}
+
+// count counts a request for path that was served as outcome,
+// with n bytes of body from the cache.
+func (c *cacheCounters) count(path string, outcome cacheOutcome, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bytes += int64(n)
+	if outcome == cacheBypass {
+		c.bypass++
+		return
+	}
+	prefix := statsPrefix(path)
+	if c.prefixes == nil {
+		c.prefixes = make(map[string]*PrefixStats)
+	}
+	p, ok := c.prefixes[prefix]
+	if !ok && len(c.prefixes) >= maxStatsPrefixes {
+		prefix = otherPrefixes
+		p = c.prefixes[prefix]
+	}
+	if p == nil {
+		p = new(PrefixStats)
+		c.prefixes[prefix] = p
+	}
+	switch outcome {
+	case cacheHit:
+		c.hits++
+		p.Hits++
+	case cacheStale:
+		c.stale++
+		p.Stale++
+	case cacheMiss:
+		c.misses++
+		p.Misses++
+	}
+}
+
+// Stats returns the counts of the requests rc served.
+func (rc *ResponseCache) Stats() CacheStats {
+	rc.counters.mu.Lock()
+	stats := CacheStats{
+		Upstream:    rc.name,
+		Hits:        rc.counters.hits,
+		Stale:       rc.counters.stale,
+		Misses:      rc.counters.misses,
+		Bypass:      rc.counters.bypass,
+		BytesServed: rc.counters.bytes,
+		HitRatio:    hitRatio(rc.counters.hits, rc.counters.stale, rc.counters.misses),
+	}
+	if len(rc.counters.prefixes) > 0 {
+		stats.Prefixes = make(map[string]*PrefixStats, len(rc.counters.prefixes))
+		for prefix, p := range rc.counters.prefixes {
+			ps := *p
+			ps.HitRatio = hitRatio(p.Hits, p.Stale, p.Misses)
+			stats.Prefixes[prefix] = &ps
+		}
+	}
+	rc.counters.mu.Unlock()
+
+	rc.mu.Lock()
+	stats.Entries, stats.Size = rc.lru.Len(), rc.size
+	rc.mu.Unlock()
+	if rc.collapser != nil {
+		stats.Collapsed = rc.collapser.Collapsed()
+	}
+	return stats
+}
+
+// Collapsed returns how many requests rc served the
+// response of an identical request.
+func (rc *RequestCollapser) Collapsed() int64 {
+	return atomic.LoadInt64(&rc.collapsed)
+}
+
+func hitRatio(hits, stale, misses int64) float64 {
+	if total := hits + stale + misses; total > 0 {
+		return float64(hits+stale) / float64(total)
+	}
+	return 0
+}
+
+// statsPrefix returns the first segment of path, with its
+// slashes, or / for paths with a single segment.
+func statsPrefix(path string) string {
+	if i := strings.Index(strings.TrimPrefix(path, "/"), "/"); i >= 0 {
+		return path[:i+2]
+	}
+	return "/"
+}
+
+// publishCacheStats publishes the counts of the response cache
+// and the request collapser of the upstream that proxies from,
+// either of which may be nil, as a metric.
+func publishCacheStats(from string, cache *ResponseCache, collapser *RequestCollapser) {
+	publishCacheStatsOnce.Do(func() {
+		expvar.Publish("ProxyCache", cacheStats)
+	})
+	if cache != nil {
+		cache.name, cache.collapser = from, collapser
+	}
+	cacheStats.Set(from, expvar.Func(func() interface{} {
+		if cache != nil {
+			return cache.Stats()
+		}
+		return CacheStats{Upstream: from, Collapsed: collapser.Collapsed()}
+	}))
+}
+
+// siteCacheStats returns the stats of the response
+// caches of the site at addr.
+func siteCacheStats(addr string) []CacheStats {
+	siteCachesMu.Lock()
+	caches := siteCaches[addr]
+	siteCachesMu.Unlock()
+	stats := []CacheStats{}
+	for _, rc := range caches {
+		stats = append(stats, rc.Stats())
+	}
+	return stats
+}
+
+var (
+	// cacheStats are the counts of the response caches
+	// and request collapsers, by upstream
+	cacheStats            = new(expvar.Map).Init()
+	publishCacheStatsOnce sync.Once
+)
+
+const (
+	// maxStatsPrefixes is how many path prefixes are counted
+	// separately; requests under others are counted together.
+	maxStatsPrefixes = 100
+
+	// otherPrefixes is the prefix the others are counted under.
+	otherPrefixes = "*"
+)
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestCacheStats(t *testing.T) {
+	now := time.Date(2017, 5, 1, 12, 0, 0, 0, time.UTC)
+	cacheNow = func() time.Time { return now }
+	defer func() { cacheNow = time.Now }()
+
+	upstream := func(w http.ResponseWriter, r *http.Request) (int, error) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return 0, nil
+		}
+		w.Write([]byte("hello"))
+		return 0, nil
+	}
+	rc := newResponseCache()
+	collapser := newRequestCollapser()
+	collapser.collapsed = 3
+	publishCacheStats("/stats", rc, collapser)
+
+	for _, test := range []struct {
+		method, path string
+		later        time.Duration
+	}{
+		{"GET", "/static/a.css", 0},             // miss
+		{"GET", "/static/a.css", 0},             // hit
+		{"GET", "/static/a.css", 0},             // hit
+		{"GET", "/index.html", 0},               // miss
+		{"POST", "/index.html", 0},              // bypass
+		{"GET", "/index.html", 2 * time.Minute}, // stale
+	} {
+		now = now.Add(test.later)
+		r := httptest.NewRequest(test.method, "http://example.com"+test.path, nil)
+		if _, err := rc.serve(httptest.NewRecorder(), r, upstream); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+
+	stats := rc.Stats()
+	if stats.Upstream != "/stats" || stats.Hits != 2 || stats.Stale != 1 || stats.Misses != 2 || stats.Bypass != 1 {
+		t.Errorf("Expected 2 hits, 1 stale, 2 misses and 1 bypass of /stats, got %+v", stats)
+	}
+	if stats.BytesServed != 15 || stats.Collapsed != 3 || stats.HitRatio != 0.6 {
+		t.Errorf("Expected 15 bytes served, 3 collapsed and a hit ratio of 0.6, got %+v", stats)
+	}
+	if stats.Entries != 2 || stats.Size != 10 {
+		t.Errorf("Expected 2 entries of 10 bytes, got %d of %d", stats.Entries, stats.Size)
+	}
+	if p := stats.Prefixes["/static/"]; p == nil || p.Hits != 2 || p.Misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss under /static/, got %+v", p)
+	}
+	if p := stats.Prefixes["/"]; p == nil || p.Stale != 1 || p.Misses != 1 || p.HitRatio != 0.5 {
+		t.Errorf("Expected 1 stale and 1 miss under /, got %+v", p)
+	}
+
+	// the stats are published as a metric
+	v := cacheStats.Get("/stats")
+	if v == nil {
+		t.Fatal("Expected stats of /stats to be published")
+	}
+	var published CacheStats
+	if err := json.Unmarshal([]byte(v.String()), &published); err != nil || published.Hits != 2 {
+		t.Errorf("Expected published stats with 2 hits, got %s (%v)", v.String(), err)
+	}
+
+	// and listed by the admin API of the site
+	setSiteCaches("stats.example:80", []*ResponseCache{rc})
+	defer setSiteCaches("stats.example:80", nil)
+	admin := Admin{Next: httpserver.EmptyNext, Path: "/admin", Site: "stats.example:80"}
+	r := httptest.NewRequest("GET", "/admin/cache", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+	w := httptest.NewRecorder()
+	if _, err := admin.ServeHTTP(w, r); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var listed []CacheStats
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil || len(listed) != 1 || listed[0].Stale != 1 {
+		t.Errorf("Expected stats of one cache with 1 stale, got %s (%v)", w.Body.String(), err)
+	}
+}
+
+func TestStatsPrefix(t *testing.T) {
+	for i, test := range []struct {
+		path, expect string
+	}{
+		{"/", "/"},
+		{"/index.html", "/"},
+		{"/static/", "/static/"},
+		{"/static/css/a.css", "/static/"},
+	} {
+		if got := statsPrefix(test.path); got != test.expect {
+			t.Errorf("Test %d: Expected prefix '%s' of '%s', got '%s'", i, test.expect, test.path, got)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ClientConnections gives each downstream connection connections
+// of its own to the upstream hosts, which are never used for
+// requests of other clients, and keeps it on the same host.
+// Connection-oriented authentication, like NTLM and Negotiate,
+// needs this, as it authenticates the connection rather than
+// the requests. Clients are told apart by their remote address,
+// as each connection has its own.
+type ClientConnections struct {
+	// How long the connections of a client are kept
+	// after its last request; this should be longer
+	// than the idle timeout of downstream connections
+	IdleTimeout time.Duration
+
+	mu        sync.Mutex
+	clients   map[string]*client
+	lastSweep time.Time
+}
+
+// client is the state of one downstream connection.
+type client struct {
+	host       *UpstreamHost
+	transports map[*UpstreamHost]*http.Transport
+	active     int
+	lastUsed   time.Time
+}
+
+func newClientConnections() *ClientConnections {
+	return &ClientConnections{
+		IdleTimeout: DefaultClientIdleTimeout,
+		clients:     make(map[string]*client),
+	}
+}
+
+// lookup returns the host the client of r was sent to
+// before, if it is still available.
+func (cc *ClientConnections) lookup(r *http.Request) *UpstreamHost {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	c, ok := cc.clients[r.RemoteAddr]
+	if !ok || c.host == nil || !c.host.Available() {
+		return nil
+	}
+	return c.host
+}
+
+// remember notes that the client of r is sent to host.
+func (cc *ClientConnections) remember(r *http.Request, host *UpstreamHost) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.client(r.RemoteAddr).host = host
+}
+
+// client returns the client of addr, creating it if
+// necessary. cc.mu must be locked.
+func (cc *ClientConnections) client(addr string) *client {
+	c, ok := cc.clients[addr]
+	if !ok {
+		c = &client{transports: make(map[*UpstreamHost]*http.Transport)}
+		cc.clients[addr] = c
+	}
+	c.lastUsed = time.Now()
+	return c
+}
+
+// transport returns a RoundTripper for host that sends each
+// request over connections of the client that made it, made
+// like those of base, which may be nil.
+func (cc *ClientConnections) transport(host *UpstreamHost, base http.RoundTripper) http.RoundTripper {
+	template, ok := base.(*http.Transport)
+	if !ok {
+		template, _ = http.DefaultTransport.(*http.Transport)
+	}
+	return &clientTransport{cc: cc, host: host, template: template}
+}
+
+// acquire returns the transport of the client of addr to
+// host, and marks the client active until release is called.
+func (cc *ClientConnections) acquire(addr string, host *UpstreamHost, template *http.Transport) *http.Transport {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.sweep()
+	c := cc.client(addr)
+	c.active++
+	t, ok := c.transports[host]
+	if !ok {
+		t = &http.Transport{
+			// one connection at a time, as a client
+			// makes one request at a time over it
+			MaxIdleConnsPerHost: 1,
+		}
+		if template != nil {
+			t.Proxy = template.Proxy
+			t.Dial = template.Dial
+			t.DialTLS = template.DialTLS
+			t.TLSClientConfig = template.TLSClientConfig
+			t.TLSHandshakeTimeout = template.TLSHandshakeTimeout
+			t.ExpectContinueTimeout = template.ExpectContinueTimeout
+		}
+		c.transports[host] = t
+	}
+	return t
+}
+
+func (cc *ClientConnections) release(addr string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if c, ok := cc.clients[addr]; ok {
+		c.active--
+		c.lastUsed = time.Now()
+	}
+}
+
+// sweep closes the connections of clients that have been
+// idle for too long, now and then. cc.mu must be locked.
+func (cc *ClientConnections) sweep() {
+	now := time.Now()
+	if now.Sub(cc.lastSweep) < cc.IdleTimeout/2 {
+		return
+	}
+	cc.lastSweep = now
+	for addr, c := range cc.clients {
+		if c.active > 0 || now.Sub(c.lastUsed) < cc.IdleTimeout {
+			continue
+		}
+		for _, t := range c.transports {
+			t.CloseIdleConnections()
+		}
+		delete(cc.clients, addr)
+	}
+}
+
+// clientTransport is the transport of a host whose
+// requests go over connections of their client.
+type clientTransport struct {
+	cc       *ClientConnections
+	host     *UpstreamHost
+	template *http.Transport
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *clientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.cc.acquire(req.RemoteAddr, t.host, t.template)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.cc.release(req.RemoteAddr)
+		return nil, err
+	}
+	// the client is active until the body is read
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: func() { t.cc.release(req.RemoteAddr) }}
+	return resp, nil
+}
+
+// releaseBody calls release once when it is closed.
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// DefaultClientIdleTimeout is how long the connections of
+// an idle client are kept by default.
+const DefaultClientIdleTimeout = 2 * time.Minute
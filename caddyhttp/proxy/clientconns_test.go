@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestParseClientConnections(t *testing.T) {
+	tests := []struct {
+		config              string
+		shouldErr           bool
+		expectedIdleTimeout time.Duration
+	}{
+		{"proxy / a {\n client_connections \n}", false, DefaultClientIdleTimeout},
+		{"proxy / a {\n client_connections 5m \n}", false, 5 * time.Minute},
+		{"proxy / a {\n client_connections never \n}", true, 0},
+		{"proxy / a {\n client_connections -1s \n}", true, 0},
+		{"proxy / a {\n client_connections 1m 2m \n}", true, 0},
+		{"proxy / a {\n client_connections \n keepalive 0 \n}", true, 0},
+	}
+
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		upstream := upstreams[0].(*staticUpstream)
+		cc := upstream.ClientConnections
+		if cc == nil || cc.IdleTimeout != test.expectedIdleTimeout {
+			t.Errorf("Test %d: Expected idle timeout %v, got %+v", i, test.expectedIdleTimeout, cc)
+			continue
+		}
+		if _, ok := upstream.Hosts[0].ReverseProxy.Transport.(*clientTransport); !ok {
+			t.Errorf("Test %d: Expected transport of client connections, got %T", i, upstream.Hosts[0].ReverseProxy.Transport)
+		}
+	}
+}
+
+func TestClientConnections(t *testing.T) {
+	// the backends tell which connection each request came over
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + " " + r.RemoteAddr))
+		}))
+	}
+	backend1, backend2 := newBackend("1"), newBackend("2")
+	defer backend1.Close()
+	defer backend2.Close()
+
+	upstream := &staticUpstream{
+		from:              "/",
+		Policy:            &RoundRobin{},
+		KeepAlive:         http.DefaultMaxIdleConnsPerHost,
+		MaxFails:          1,
+		ClientConnections: newClientConnections(),
+	}
+	for _, name := range []string{backend1.URL, backend2.URL} {
+		host, err := upstream.NewHost(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		upstream.Hosts = append(upstream.Hosts, host)
+	}
+	p := &Proxy{Next: httpserver.EmptyNext, Upstreams: []Upstream{upstream}}
+
+	get := func(client string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = client
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	clients := []string{"10.0.0.1:1234", "10.0.0.1:1235", "10.0.0.2:1234"}
+	first := make(map[string]string)
+	for round := 0; round < 3; round++ {
+		for _, client := range clients {
+			got := get(client)
+			if round == 0 {
+				first[client] = got
+			} else if got != first[client] {
+				t.Errorf("Expected client %s to stay on host and connection '%s', got '%s'", client, first[client], got)
+			}
+		}
+	}
+	seen := make(map[string]string)
+	for client, conn := range first {
+		if other, ok := seen[conn]; ok {
+			t.Errorf("Expected clients %s and %s to have connections of their own, both got '%s'", client, other, conn)
+		}
+		seen[conn] = client
+	}
+	if strings.Fields(first[clients[0]])[0] == strings.Fields(first[clients[1]])[0] {
+		t.Error("Expected clients to be spread over hosts")
+	}
+
+	// the connections of idle clients are closed
+	cc := upstream.ClientConnections
+	cc.mu.Lock()
+	cc.clients[clients[0]].lastUsed = time.Now().Add(-time.Hour)
+	cc.lastSweep = time.Time{}
+	cc.mu.Unlock()
+	get(clients[1])
+	cc.mu.Lock()
+	_, kept := cc.clients[clients[0]]
+	active := cc.clients[clients[1]].active
+	cc.mu.Unlock()
+	if kept {
+		t.Error("Expected idle client to be forgotten")
+	}
+	if active != 0 {
+		t.Errorf("Expected client to be inactive after its response, got %d active", active)
+	}
+}
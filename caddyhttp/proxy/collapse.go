@@ -0,0 +1,237 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// RequestCollapser collapses identical GET requests to an upstream
+// that arrive while one of them is in flight: only the first is
+// proxied, and its response is sent to the others too, so that a
+// burst of requests for the same resource, like when caches of it
+// expire, reaches the hosts once.
+type RequestCollapser struct {
+	// requests served the response of another;
+	// first for alignment of atomic operations
+	collapsed int64
+
+	// Largest response body that is shared; the requests
+	// waiting for a larger response are proxied themselves
+	MaxBody int64
+
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a request in flight and the requests waiting
+// for its response.
+type flight struct {
+	done    chan struct{}
+	waiters int
+
+	// the response, once done, or the status
+	// returned instead of writing one
+	shared   bool
+	returned int
+	status   int
+	header   http.Header
+	body     []byte
+}
+
+// newRequestCollapser returns a RequestCollapser with default settings.
+func newRequestCollapser() *RequestCollapser {
+	return &RequestCollapser{MaxBody: defaultCollapseMaxBody}
+}
+
+// serve calls proxy with w to serve r, unless an identical request
+// is in flight, in which case its response is written to w when it
+// arrives, if it can be shared.
+func (rc *RequestCollapser) serve(w http.ResponseWriter, r *http.Request, proxy func(http.ResponseWriter) (int, error)) (int, error) {
+	key, ok := collapseKey(r)
+	if !ok {
+		return proxy(w)
+	}
+
+	rc.mu.Lock()
+	if f, ok := rc.flights[key]; ok {
+		f.waiters++
+		rc.mu.Unlock()
+		select {
+		case <-f.done:
+		case <-r.Context().Done():
+			return http.StatusBadGateway, r.Context().Err()
+		}
+		if !f.shared {
+			return proxy(w)
+		}
+		if f.returned != 0 {
+			atomic.AddInt64(&rc.collapsed, 1)
+			return f.returned, nil
+		}
+		for field, values := range f.header {
+			w.Header()[field] = values
+		}
+		w.WriteHeader(f.status)
+		w.Write(f.body)
+		atomic.AddInt64(&rc.collapsed, 1)
+		return 0, nil
+	}
+	if rc.flights == nil {
+		rc.flights = make(map[string]*flight)
+	}
+	f := &flight{done: make(chan struct{})}
+	rc.flights[key] = f
+	rc.mu.Unlock()
+
+	cw := &collapsingWriter{ResponseWriter: w, max: rc.MaxBody}
+	status, err := proxy(cw)
+
+	rc.mu.Lock()
+	delete(rc.flights, key)
+	rc.mu.Unlock()
+	if f.waiters > 0 {
+		f.shared = shareable(status, cw)
+		if f.shared && status != 0 {
+			f.returned = status
+		} else if f.shared {
+			f.status, f.header, f.body = cw.status, make(http.Header), cw.body.Bytes()
+			copyHeader(f.header, w.Header())
+		}
+	}
+	close(f.done)
+	return status, err
+}
+
+// collapseKey returns the key of the requests that are
+// identical to r, and whether r may be collapsed with them:
+// it must be a GET request for the whole of a resource,
+// without credentials that could make the response private.
+func collapseKey(r *http.Request) (string, bool) {
+	if r.Method != http.MethodGet || r.ContentLength > 0 || requestIsWebsocket(r) {
+		return "", false
+	}
+	for _, field := range []string{"Authorization", "Cookie", "Range"} {
+		if r.Header.Get(field) != "" {
+			return "", false
+		}
+	}
+	for _, directive := range r.Header["Cache-Control"] {
+		if strings.Contains(directive, "no-cache") {
+			return "", false
+		}
+	}
+	key := r.Host + " " + r.URL.RequestURI()
+	for _, field := range collapseVary {
+		key += "\n" + strings.Join(r.Header[field], ",")
+	}
+	// a response to a conditional request may have no body
+	for _, field := range []string{"If-None-Match", "If-Modified-Since"} {
+		key += "\n" + r.Header.Get(field)
+	}
+	return key, true
+}
+
+// collapseVary are the request header fields that
+// responses commonly vary by, which are part of the
+// key of identical requests.
+var collapseVary = []string{"Accept", "Accept-Encoding", "Accept-Language"}
+
+// shareable returns whether the response written to w, or
+// the status returned instead of writing one, can be sent to
+// the requests that waited for it.
+func shareable(status int, w *collapsingWriter) bool {
+	if status != 0 {
+		// nothing was written, so the waiters get the same status
+		return true
+	}
+	if w.status == 0 || w.overflow {
+		return false
+	}
+	header := w.Header()
+	if header.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, directive := range header["Cache-Control"] {
+		if strings.Contains(directive, "private") || strings.Contains(directive, "no-store") {
+			return false
+		}
+	}
+	for _, vary := range header["Vary"] {
+		for _, field := range strings.Split(vary, ",") {
+			field = http.CanonicalHeaderKey(strings.TrimSpace(field))
+			if field == "" {
+				continue
+			}
+			var known bool
+			for _, f := range collapseVary {
+				known = known || field == f
+			}
+			if !known {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// collapsingWriter writes a response through, keeping its
+// status and as much of its body as may be shared.
+type collapsingWriter struct {
+	http.ResponseWriter
+	max      int64
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *collapsingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter.
+func (w *collapsingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.overflow {
+		if int64(w.body.Len()+len(p)) > w.max {
+			w.overflow = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(p)
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher, if the underlying writer does.
+func (w *collapsingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, if the underlying writer
+// does. The response of a hijacked connection is not shared.
+func (w *collapsingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.overflow = true
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, httpserver.NonHijackerError{Underlying: w.ResponseWriter}
+}
+
+// defaultCollapseMaxBody is the largest response body
+// that is shared if not configured.
+const defaultCollapseMaxBody = 1 << 20
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestParseCollapseRequests(t *testing.T) {
+	tests := []struct {
+		config          string
+		shouldErr       bool
+		expectedMaxBody int64
+	}{
+		{"proxy / a {\n collapse_requests \n}", false, defaultCollapseMaxBody},
+		{"proxy / a {\n collapse_requests 64KB \n}", false, 64000},
+		{"proxy / a {\n collapse_requests big \n}", true, 0},
+		{"proxy / a {\n collapse_requests 1MB 2MB \n}", true, 0},
+	}
+
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		rc := upstreams[0].(*staticUpstream).Collapser
+		if rc == nil || rc.MaxBody != test.expectedMaxBody {
+			t.Errorf("Test %d: Expected collapser with max body %d, got %+v", i, test.expectedMaxBody, rc)
+		}
+	}
+}
+
+func TestCollapseRequests(t *testing.T) {
+	var hits int32
+	unblock := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-unblock
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "private")
+		}
+		w.Header().Set("X-Path", r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("Hello " + r.URL.Path))
+	}))
+	defer backend.Close()
+
+	upstream := &staticUpstream{
+		from:      "/",
+		Hosts:     HostPool{{Name: backend.URL}},
+		Policy:    &Random{},
+		Collapser: newRequestCollapser(),
+	}
+	p := &Proxy{Next: httpserver.EmptyNext, Upstreams: []Upstream{upstream}}
+
+	for i, test := range []struct {
+		path         string
+		expectedHits int32
+	}{
+		{"/shared", 1},
+		{"/private", 5},
+	} {
+		atomic.StoreInt32(&hits, 0)
+		unblock = make(chan struct{})
+		var wg sync.WaitGroup
+		recorders := make([]*httptest.ResponseRecorder, 5)
+		for j := range recorders {
+			recorders[j] = httptest.NewRecorder()
+			wg.Add(1)
+			go func(w *httptest.ResponseRecorder) {
+				defer wg.Done()
+				p.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+			}(recorders[j])
+			if j == 0 {
+				// the others arrive while the first is in flight
+				for start := time.Now(); atomic.LoadInt32(&hits) == 0; time.Sleep(time.Millisecond) {
+					if time.Since(start) > 5*time.Second {
+						t.Fatalf("Test %d: Timed out waiting for the first request", i)
+					}
+				}
+			}
+		}
+		for start := time.Now(); !waiting(upstream.Collapser, 4); time.Sleep(time.Millisecond) {
+			if time.Since(start) > 5*time.Second {
+				t.Fatalf("Test %d: Timed out waiting for requests to collapse", i)
+			}
+		}
+		close(unblock)
+		wg.Wait()
+
+		if got := atomic.LoadInt32(&hits); got != test.expectedHits {
+			t.Errorf("Test %d: Expected %d requests to reach the backend, got %d", i, test.expectedHits, got)
+		}
+		for j, w := range recorders {
+			if w.Code != http.StatusCreated || w.Body.String() != "Hello "+test.path || w.Header().Get("X-Path") != test.path {
+				t.Errorf("Test %d, request %d: Expected the backend's response, got %d %v '%s'", i, j, w.Code, w.Header(), w.Body.String())
+			}
+		}
+	}
+}
+
+// waiting returns whether n requests wait for
+// a request in flight of rc.
+func waiting(rc *RequestCollapser, n int) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for _, f := range rc.flights {
+		if f.waiters == n {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCollapseKey(t *testing.T) {
+	request := func(method string, header ...string) *http.Request {
+		r := httptest.NewRequest(method, "http://example.com/a?b=c", nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		return r
+	}
+	key, ok := collapseKey(request("GET", "Accept-Encoding", "gzip"))
+	if !ok {
+		t.Fatal("Expected plain GET request to be collapsed")
+	}
+	if other, _ := collapseKey(request("GET")); other == key {
+		t.Error("Expected requests with different encodings to have different keys")
+	}
+	for i, r := range []*http.Request{
+		request("POST"),
+		request("GET", "Cookie", "session=1"),
+		request("GET", "Authorization", "Bearer x"),
+		request("GET", "Range", "bytes=0-10"),
+		request("GET", "Cache-Control", "no-cache"),
+		request("GET", "Connection", "Upgrade", "Upgrade", "websocket"),
+	} {
+		if _, ok := collapseKey(r); ok {
+			t.Errorf("Test %d: Expected request not to be collapsed", i)
+		}
+	}
+}
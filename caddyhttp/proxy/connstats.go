@@ -0,0 +1,211 @@
+package proxy
+
+import (
+	"expvar"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnStats counts the connections of a proxy to a host.
+type ConnStats struct {
+	Host string `json:"host"`
+
+	// Dialed connections were made, Reused ones were
+	// taken from the idle pool for another request, and
+	// Closed ones were closed, by either side
+	Dialed int64 `json:"dialed"`
+	Reused int64 `json:"reused"`
+	Closed int64 `json:"closed"`
+
+	// Open connections are dialed and not closed yet
+	Open int64 `json:"open"`
+}
+
+// connCounters counts the connections of a transport.
+type connCounters struct {
+	dialed, reused, closed int64
+}
+
+// openConns counts the open connections to all upstream
+// hosts, which the leak watchdog watches.
+var openConns int64
+
+// countConns makes the connections of rp counted. Transports
+// other than those of the http package only have their
+// reused connections counted.
+func (rp *ReverseProxy) countConns() {
+	rp.conns = new(connCounters)
+	if rp.Transport == nil {
+		// like http.DefaultTransport, but of its own
+		rp.Transport = &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		}
+	}
+	t, ok := rp.Transport.(*http.Transport)
+	if !ok {
+		return
+	}
+	dial := t.Dial
+	if dial == nil {
+		dial = (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).Dial
+	}
+	t.Dial = func(network, addr string) (net.Conn, error) {
+		conn, err := dial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		atomic.AddInt64(&rp.conns.dialed, 1)
+		atomic.AddInt64(&openConns, 1)
+		return &countedConn{Conn: conn, counters: rp.conns}, nil
+	}
+}
+
+// traceConns returns req with a trace that counts whether
+// the connection it is sent over is reused.
+func (rp *ReverseProxy) traceConns(req *http.Request) *http.Request {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&rp.conns.reused, 1)
+			}
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// ConnStats returns the connection counts of rp to host.
+func (rp *ReverseProxy) ConnStats(host string) ConnStats {
+	stats := ConnStats{Host: host}
+	if rp.conns != nil {
+		stats.Dialed = atomic.LoadInt64(&rp.conns.dialed)
+		stats.Reused = atomic.LoadInt64(&rp.conns.reused)
+		stats.Closed = atomic.LoadInt64(&rp.conns.closed)
+		stats.Open = stats.Dialed - stats.Closed
+	}
+	return stats
+}
+
+// countedConn is a connection that counts when it closes.
+type countedConn struct {
+	net.Conn
+	counters *connCounters
+	once     sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() {
+		atomic.AddInt64(&c.counters.closed, 1)
+		atomic.AddInt64(&openConns, -1)
+	})
+	return c.Conn.Close()
+}
+
+// connStats returns the connection counts of the hosts of u.
+func (u *staticUpstream) connStats() []ConnStats {
+	stats := []ConnStats{}
+	for _, host := range u.Hosts {
+		if host.ReverseProxy != nil {
+			stats = append(stats, host.ReverseProxy.ConnStats(host.Name))
+		}
+	}
+	return stats
+}
+
+var (
+	connStatsVar         = new(expvar.Map).Init()
+	publishConnStatsOnce sync.Once
+
+	siteUpstreams   map[string][]*staticUpstream
+	siteUpstreamsMu sync.Mutex
+)
+
+// publishConnStats publishes the connection counts of u as
+// part of the ProxyConns metric, and starts the watchdog.
+func publishConnStats(u *staticUpstream) {
+	publishConnStatsOnce.Do(func() {
+		expvar.Publish("ProxyConns", connStatsVar)
+		go watchForLeaks(time.NewTicker(watchdogInterval).C)
+	})
+	connStatsVar.Set(u.from, expvar.Func(func() interface{} {
+		return u.connStats()
+	}))
+}
+
+// setSiteUpstreams records the upstreams of the proxies of the
+// site at addr, so the proxy_admin API of the site lists them.
+func setSiteUpstreams(addr string, upstreams []*staticUpstream) {
+	siteUpstreamsMu.Lock()
+	if siteUpstreams == nil {
+		siteUpstreams = make(map[string][]*staticUpstream)
+	}
+	siteUpstreams[addr] = upstreams
+	siteUpstreamsMu.Unlock()
+}
+
+// siteConnStats returns the connection counts of the proxies
+// of the site at addr, by the base path of each.
+func siteConnStats(addr string) map[string][]ConnStats {
+	siteUpstreamsMu.Lock()
+	upstreams := siteUpstreams[addr]
+	siteUpstreamsMu.Unlock()
+	stats := make(map[string][]ConnStats)
+	for _, u := range upstreams {
+		stats[u.from] = append(stats[u.from], u.connStats()...)
+	}
+	return stats
+}
+
+// growth notes whether a count grows in every sample.
+type growth struct {
+	what    string
+	samples []int64
+}
+
+// observe adds n to the samples of g, and returns whether
+// it grew in each of the last watchdogSamples of them,
+// after which it starts over.
+func (g *growth) observe(n int64) bool {
+	if len(g.samples) > 0 && n <= g.samples[len(g.samples)-1] {
+		g.samples = g.samples[:0]
+	}
+	g.samples = append(g.samples, n)
+	if len(g.samples) <= watchdogSamples {
+		return false
+	}
+	log.Printf("[WARNING] proxy: %s grew from %d to %d in the last %v without dropping; there may be a leak",
+		g.what, g.samples[0], n, time.Duration(watchdogSamples)*watchdogInterval)
+	g.samples = g.samples[:0]
+	return true
+}
+
+// watchForLeaks logs a warning when the open upstream
+// connections or the goroutines keep growing, on every
+// tick until ticks is closed.
+func watchForLeaks(ticks <-chan time.Time) {
+	conns := &growth{what: "open upstream connections"}
+	goroutines := &growth{what: "goroutines"}
+	for range ticks {
+		conns.observe(atomic.LoadInt64(&openConns))
+		goroutines.observe(int64(runtime.NumGoroutine()))
+	}
+}
+
+const (
+	// how often the watchdog samples, and how many
+	// samples in a row must grow for it to warn
+	watchdogInterval = time.Minute
+	watchdogSamples  = 15
+)
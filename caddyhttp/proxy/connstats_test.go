@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestConnStats(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello"))
+	}))
+	defer backend.Close()
+
+	upstream := &staticUpstream{
+		from:      "/",
+		Policy:    &Random{},
+		KeepAlive: http.DefaultMaxIdleConnsPerHost,
+		MaxFails:  1,
+	}
+	host, err := upstream.NewHost(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream.Hosts = HostPool{host}
+	p := &Proxy{Next: httpserver.EmptyNext, Upstreams: []Upstream{upstream}}
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Body.String() != "Hello" {
+			t.Fatalf("Expected response of backend, got %d '%s'", w.Code, w.Body.String())
+		}
+	}
+	expected := ConnStats{Host: backend.URL, Dialed: 1, Reused: 2, Open: 1}
+	if got := host.ReverseProxy.ConnStats(host.Name); got != expected {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+
+	// the backend closing it is counted too
+	backend.CloseClientConnections()
+	expected = ConnStats{Host: backend.URL, Dialed: 1, Reused: 2, Closed: 1}
+	for start := time.Now(); host.ReverseProxy.ConnStats(host.Name) != expected; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("Expected %+v, got %+v", expected, host.ReverseProxy.ConnStats(host.Name))
+		}
+	}
+
+	setSiteUpstreams("http://example.com", []*staticUpstream{upstream})
+	defer setSiteUpstreams("http://example.com", nil)
+	a := Admin{Next: httpserver.EmptyNext, Path: defaultAdminPath, Site: "http://example.com"}
+	req := httptest.NewRequest("GET", defaultAdminPath+"/conns", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, req)
+	var listed map[string][]ConnStats
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("Expected JSON, got %d '%s'", w.Code, w.Body.String())
+	}
+	if got := listed["/"]; len(got) != 1 || got[0] != expected {
+		t.Errorf("Expected stats of proxy at /, got %v", listed)
+	}
+}
+
+func TestGrowth(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	g := &growth{what: "goroutines"}
+	for i := 0; i < watchdogSamples; i++ {
+		if g.observe(int64(10 + i)) {
+			t.Fatalf("Expected no warning after %d samples", i+1)
+		}
+	}
+	// a drop starts over
+	if g.observe(5) {
+		t.Fatal("Expected no warning after a drop")
+	}
+	for i := 1; i < watchdogSamples; i++ {
+		g.observe(int64(5 + i))
+	}
+	if buf.Len() > 0 {
+		t.Fatalf("Expected nothing logged yet, got: %s", buf.String())
+	}
+	if !g.observe(100) {
+		t.Fatal("Expected warning after steady growth")
+	}
+	if !strings.Contains(buf.String(), "goroutines grew from 5 to 100") {
+		t.Errorf("Expected warning logged, got: %s", buf.String())
+	}
+	if g.observe(101) {
+		t.Error("Expected samples to start over after a warning")
+	}
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DebugOverride lets trusted clients choose the host their
+// request goes to by naming it in a header, so that a problem
+// can be reproduced on a specific host of a pool.
+type DebugOverride struct {
+	// Header is the request header that names the host, as
+	// in the proxy directive, with or without the scheme
+	Header string
+
+	// Trusted are the client addresses that may choose the
+	// host; if empty, only clients on the loopback interface
+	Trusted []*net.IPNet
+}
+
+// host returns the host that r names, if it does and its
+// client is trusted, even if the host is not available, and
+// nil if there is no such host. It returns false if r is to
+// go to a host selected as usual.
+func (d *DebugOverride) host(r *http.Request, hosts HostPool) (*UpstreamHost, bool) {
+	name := r.Header.Get(d.Header)
+	if name == "" || !d.trusts(r.RemoteAddr) {
+		return nil, false
+	}
+	for _, host := range hosts {
+		if host.Name == name || strings.TrimPrefix(strings.TrimPrefix(host.Name, "http://"), "https://") == name {
+			return host, true
+		}
+	}
+	return nil, true
+}
+
+// trusts returns whether the client at addr may choose the host.
+func (d *DebugOverride) trusts(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if len(d.Trusted) == 0 {
+		return ip.IsLoopback()
+	}
+	for _, n := range d.Trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
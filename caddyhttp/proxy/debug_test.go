@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestDebugOverride(t *testing.T) {
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(`proxy / a:80 b:80 c:80 {
+		debug_upstream_header X-Debug-Backend 10.0.0.0/8 192.168.1.5
+	}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := upstreams[0].(*staticUpstream)
+	// b and c are down, so hosts are selected as usual only if
+	// a is, but b may still be chosen
+	upstream.Hosts[1].Unhealthy = true
+	upstream.Hosts[2].Unhealthy = true
+
+	for i, test := range []struct {
+		remoteAddr, header string
+		expected           string
+	}{
+		{"10.1.2.3:1234", "", "http://a:80"},
+		{"10.1.2.3:1234", "b:80", "http://b:80"},
+		{"192.168.1.5:1234", "http://b:80", "http://b:80"},
+		{"192.168.1.6:1234", "b:80", "http://a:80"},
+		{"127.0.0.1:1234", "b:80", "http://a:80"},
+		{"10.1.2.3:1234", "d:80", ""},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.header != "" {
+			r.Header.Set("X-Debug-Backend", test.header)
+		}
+		host := upstream.Select(r)
+		var name string
+		if host != nil {
+			name = host.Name
+		}
+		if name != test.expected {
+			t.Errorf("Test %d: Expected host %q, got %q", i, test.expected, name)
+		}
+	}
+
+	// without ranges, only loopback clients are trusted
+	d := &DebugOverride{Header: "X-Debug-Backend"}
+	if !d.trusts("127.0.0.1:1234") || !d.trusts("[::1]:1234") || d.trusts("10.1.2.3:1234") {
+		t.Error("Expected only loopback clients to be trusted by default")
+	}
+}
+
+func TestDebugOverrideHeaderNotForwarded(t *testing.T) {
+	var forwarded string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("X-Debug-Backend")
+	}))
+	defer backend.Close()
+
+	upstream := &staticUpstream{
+		from:          "/",
+		Hosts:         HostPool{{Name: backend.URL}},
+		Policy:        &Random{},
+		DebugOverride: &DebugOverride{Header: "X-Debug-Backend"},
+	}
+	p := &Proxy{Next: httpserver.EmptyNext, Upstreams: []Upstream{upstream}}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+	r.Header.Set("X-Debug-Backend", backend.URL)
+	w := httptest.NewRecorder()
+	if _, err := p.ServeHTTP(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if forwarded != "" {
+		t.Errorf("Expected debug header not to be forwarded, got %q", forwarded)
+	}
+	if r.Header.Get("X-Debug-Backend") != backend.URL {
+		t.Error("Expected debug header of the downstream request to be kept")
+	}
+}
+
+func TestParseDebugOverride(t *testing.T) {
+	for i, test := range []struct {
+		config    string
+		shouldErr bool
+	}{
+		{"proxy / a {\n debug_upstream_header X-Debug-Backend \n}", false},
+		{"proxy / a {\n debug_upstream_header X-Debug-Backend 10.0.0.0/8 ::1 \n}", false},
+		{"proxy / a {\n debug_upstream_header \n}", true},
+		{"proxy / a {\n debug_upstream_header X-Debug-Backend office \n}", true},
+	} {
+		_, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error but got none", i)
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+	}
+}
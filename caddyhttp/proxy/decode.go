@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// decodeResponse decodes the body of res, if it is encoded
+// with gzip or deflate and either always is set or the client
+// of req did not offer the encoding, and fixes the header to
+// match. The response then differs by the encodings clients
+// offer, and its entity tag is weak, as the bytes differ.
+func decodeResponse(req *http.Request, res *http.Response, always bool) error {
+	encoding := strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding")))
+	if encoding == "x-gzip" {
+		encoding = "gzip"
+	}
+	if encoding != "gzip" && encoding != "deflate" {
+		return nil
+	}
+	if !always {
+		if httpserver.AcceptsEncoding(req, encoding) {
+			return nil
+		}
+		res.Header.Add("Vary", "Accept-Encoding")
+	}
+
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	if etag := res.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		res.Header.Set("ETag", "W/"+etag)
+	}
+	if req.Method == http.MethodHead || res.StatusCode == http.StatusNoContent ||
+		res.StatusCode == http.StatusNotModified {
+		return nil
+	}
+
+	var decoder io.ReadCloser
+	var err error
+	if encoding == "gzip" {
+		decoder, err = gzip.NewReader(res.Body)
+	} else {
+		decoder, err = newDeflateReader(res.Body)
+	}
+	if err != nil {
+		res.Body.Close()
+		return err
+	}
+	res.Body = &decodedBody{ReadCloser: decoder, encoded: res.Body}
+	return nil
+}
+
+// newDeflateReader returns a reader of the deflate encoded r.
+// The deflate encoding is zlib, but some servers send the raw
+// deflate stream instead, which is told apart by its header.
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint(header[0])<<8|uint(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// decodedBody is the decoded body of a response, whose
+// encoded body is closed along with it.
+type decodedBody struct {
+	io.ReadCloser
+	encoded io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.encoded.Close()
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+const decodeTestBody = "Hello, plain world"
+
+func encodeTestBody(t *testing.T, encoding string) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	default:
+		return []byte(decodeTestBody)
+	}
+	if _, err := w.Write([]byte(decodeTestBody)); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestDecodeResponse(t *testing.T) {
+	for i, test := range []struct {
+		method, accept, encoding string
+		always                   bool
+		expectDecoded            bool
+	}{
+		{"GET", "", "gzip", false, true},
+		{"GET", "br", "gzip", false, true},
+		{"GET", "gzip, br", "gzip", false, false},
+		{"GET", "gzip;q=0, br", "gzip", false, true},
+		{"GET", "*", "deflate", false, false},
+		{"GET", "gzip", "deflate", false, true},
+		{"GET", "gzip", "raw deflate", false, true},
+		{"GET", "gzip", "gzip", true, true},
+		{"GET", "", "br", true, false},
+		{"GET", "", "", true, false},
+		{"HEAD", "", "gzip", false, true},
+	} {
+		req := httptest.NewRequest(test.method, "/", nil)
+		if test.accept != "" {
+			req.Header.Set("Accept-Encoding", test.accept)
+		}
+		encoded := encodeTestBody(t, test.encoding)
+		res := &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        make(http.Header),
+			Body:          ioutil.NopCloser(bytes.NewReader(encoded)),
+			ContentLength: int64(len(encoded)),
+		}
+		res.Header.Set("ETag", `"v1"`)
+		res.Header.Set("Content-Length", "123")
+		if test.encoding != "" {
+			res.Header.Set("Content-Encoding", strings.Replace(test.encoding, "raw ", "", 1))
+		}
+		if test.method == "HEAD" {
+			res.Body = ioutil.NopCloser(strings.NewReader(""))
+		}
+
+		if err := decodeResponse(req, res, test.always); err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if !test.expectDecoded {
+			if !bytes.Equal(body, encoded) || res.Header.Get("ETag") != `"v1"` || res.Header.Get("Content-Length") != "123" {
+				t.Errorf("Test %d: Expected response untouched, got %v", i, res.Header)
+			}
+			continue
+		}
+		if test.method != "HEAD" && string(body) != decodeTestBody {
+			t.Errorf("Test %d: Expected decoded body, got %q", i, body)
+		}
+		if h := res.Header; h.Get("Content-Encoding") != "" || h.Get("Content-Length") != "" || res.ContentLength != -1 {
+			t.Errorf("Test %d: Expected encoding and length removed, got %v (%d)", i, h, res.ContentLength)
+		}
+		if etag := res.Header.Get("ETag"); etag != `W/"v1"` {
+			t.Errorf("Test %d: Expected weak ETag, got %s", i, etag)
+		}
+		if vary := res.Header.Get("Vary"); (vary == "Accept-Encoding") == test.always {
+			t.Errorf("Test %d: Expected Vary only unless always, got '%s'", i, vary)
+		}
+	}
+}
+
+func TestDecodeResponsesProxy(t *testing.T) {
+	gzipped := encodeTestBody(t, "gzip")
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// sent whatever the client offered
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(gzipped)
+	}))
+	defer backend.Close()
+
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+		strings.NewReader("proxy / "+backend.URL+" {\n decode_responses \n}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{Next: httpserver.EmptyNext, Upstreams: upstreams}
+	for i, test := range []struct {
+		accept          string
+		expectedBody    string
+		expectEncodedAs string
+	}{
+		{"br", decodeTestBody, ""},
+		{"gzip", string(gzipped), "gzip"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", test.accept)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		if w.Body.String() != test.expectedBody || w.Header().Get("Content-Encoding") != test.expectEncodedAs {
+			t.Errorf("Test %d: Expected body %q encoded as '%s', got %q %v", i, test.expectedBody, test.expectEncodedAs, w.Body.String(), w.Header())
+		}
+	}
+
+	for i, config := range []string{
+		"proxy / a {\n decode_responses always \n}",
+		"proxy / a {\n decode_responses sometimes \n}",
+		"proxy / a {\n decode_responses always now \n}",
+	} {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)))
+		if i == 0 {
+			if err != nil || !upstreams[0].(*staticUpstream).Hosts[0].ReverseProxy.DecodeAlways {
+				t.Errorf("Config %d: Expected responses always decoded, got: %v", i, err)
+			}
+		} else if err == nil {
+			t.Errorf("Config %d: Expected error but got none", i)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// HashRing is a policy that selects hosts by consistent hashing
+// (as ketama does) of a key of the request, so requests with the
+// same key go to the same host, and when a host is added or removed
+// only the keys of that host go to other hosts.
+type HashRing struct {
+	// Key is what requests are hashed by: "ip",
+	// "uri" or "header"; the client IP if empty
+	Key string
+
+	// Header is the name of the header hashed
+	// by if Key is "header"
+	Header string
+
+	// Number of points on the ring of each host,
+	// multiplied by its weight
+	Replicas int
+
+	mutex sync.RWMutex
+	hosts HostPool // the pool the ring is of
+	ring  hashRingPoints
+}
+
+// DefaultHashRingReplicas is the number of points on the ring of a
+// host unless configured otherwise, as many as there are with ketama.
+const DefaultHashRingReplicas = 160
+
+type hashRingPoint struct {
+	hash uint32
+	host *UpstreamHost
+}
+
+type hashRingPoints []hashRingPoint
+
+func (p hashRingPoints) Len() int           { return len(p) }
+func (p hashRingPoints) Less(i, j int) bool { return p[i].hash < p[j].hash }
+func (p hashRingPoints) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// Configure sets the key requests are hashed by
+// from args: ip, uri or header and its name.
+func (r *HashRing) Configure(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	r.Key = args[0]
+	switch r.Key {
+	case "header":
+		if len(args) != 2 {
+			return errors.New("key header requires a header name")
+		}
+		r.Header = args[1]
+		return nil
+	case "ip", "uri":
+	default:
+		return fmt.Errorf("unknown key '%s'", r.Key)
+	}
+	if len(args) > 1 {
+		return errors.New("too many arguments")
+	}
+	return nil
+}
+
+// Select selects the host that the key of the request falls to on
+// the ring, or the next host around the ring that is available.
+func (r *HashRing) Select(pool HostPool, request *http.Request) *UpstreamHost {
+	ring := r.ringOf(pool)
+	if len(ring) == 0 {
+		return nil
+	}
+	hash := ringHash(r.key(request))
+	i := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= hash })
+	tried := make(map[*UpstreamHost]struct{}, len(pool))
+	var skipped *UpstreamHost
+	for n := 0; n < len(ring) && len(tried) < len(pool); n++ {
+		host := ring[(i+n)%len(ring)].host
+		if _, ok := tried[host]; ok {
+			continue
+		}
+		if host.Available() {
+			if host.admits() {
+				return host
+			}
+			if skipped == nil {
+				skipped = host
+			}
+		}
+		tried[host] = struct{}{}
+	}
+	return skipped
+}
+
+// key returns what request is hashed by. Requests without the
+// header hashed by are hashed by the client IP instead.
+func (r *HashRing) key(request *http.Request) string {
+	switch r.Key {
+	case "uri":
+		return request.URL.RequestURI()
+	case "header":
+		if v := request.Header.Get(r.Header); v != "" {
+			return v
+		}
+	}
+	clientIP, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		clientIP = request.RemoteAddr
+	}
+	return clientIP
+}
+
+// ringOf returns the ring of pool, making it again
+// if the hosts are not those it was made of.
+func (r *HashRing) ringOf(pool HostPool) hashRingPoints {
+	r.mutex.RLock()
+	ring, same := r.ring, samePool(r.hosts, pool)
+	r.mutex.RUnlock()
+	if same {
+		return ring
+	}
+
+	replicas := r.Replicas
+	if replicas <= 0 {
+		replicas = DefaultHashRingReplicas
+	}
+	ring = nil
+	for _, host := range pool {
+		// each digest gives 4 points, as with ketama
+		for i := 0; i < (replicas*host.weight()+3)/4; i++ {
+			digest := md5.Sum([]byte(host.Name + "-" + strconv.Itoa(i)))
+			for j := 0; j < 4; j++ {
+				ring = append(ring, hashRingPoint{
+					hash: binary.LittleEndian.Uint32(digest[j*4:]),
+					host: host,
+				})
+			}
+		}
+	}
+	sort.Sort(ring)
+
+	r.mutex.Lock()
+	r.hosts = append(HostPool(nil), pool...)
+	r.ring = ring
+	r.mutex.Unlock()
+	return ring
+}
+
+func samePool(a, b HostPool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func ringHash(key string) uint32 {
+	digest := md5.Sum([]byte(key))
+	return binary.LittleEndian.Uint32(digest[:4])
+}
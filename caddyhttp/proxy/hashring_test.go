@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+func TestHashRingPolicy(t *testing.T) {
+	var pool HostPool
+	for i := 0; i < 5; i++ {
+		pool = append(pool, &UpstreamHost{Name: fmt.Sprintf("http://backend%d", i)})
+	}
+	hr := &HashRing{Key: "uri"}
+	selectFor := func(pool HostPool, uri string) *UpstreamHost {
+		request, _ := http.NewRequest("GET", uri, nil)
+		return hr.Select(pool, request)
+	}
+
+	before := make(map[string]*UpstreamHost)
+	selected := make(map[*UpstreamHost]int)
+	for i := 0; i < 1000; i++ {
+		uri := fmt.Sprintf("/file%d", i)
+		h := selectFor(pool, uri)
+		if h != selectFor(pool, uri) {
+			t.Fatalf("Expected %s to be pinned to the same host", uri)
+		}
+		before[uri] = h
+		selected[h]++
+	}
+	for _, host := range pool {
+		if selected[host] < 100 {
+			t.Errorf("Expected keys to be spread across hosts, %s got %d of 1000", host.Name, selected[host])
+		}
+	}
+
+	// removing a host only moves the keys of that host
+	removed := pool[2]
+	smaller := HostPool{pool[0], pool[1], pool[3], pool[4]}
+	for uri, h := range before {
+		now := selectFor(smaller, uri)
+		if h != removed && now != h {
+			t.Errorf("Expected %s to stay on %s, moved to %s", uri, h.Name, now.Name)
+		}
+	}
+
+	// an unavailable host is passed over without moving other keys
+	removed.Unhealthy = true
+	for uri, h := range before {
+		now := selectFor(pool, uri)
+		if now == removed || (h != removed && now != h) {
+			t.Errorf("Expected %s on %s not to move to %s", uri, h.Name, now.Name)
+		}
+	}
+	for _, host := range pool {
+		host.Unhealthy = true
+	}
+	if h := selectFor(pool, "/file1"); h != nil {
+		t.Error("Expected no host when all are unhealthy")
+	}
+}
+
+func TestHashRingKey(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/path?q=1", nil)
+	request.RemoteAddr = "192.0.2.1:1234"
+	request.Header.Set("X-User", "alice")
+	for i, test := range []struct {
+		hr       *HashRing
+		expected string
+	}{
+		{&HashRing{}, "192.0.2.1"},
+		{&HashRing{Key: "ip"}, "192.0.2.1"},
+		{&HashRing{Key: "uri"}, "/path?q=1"},
+		{&HashRing{Key: "header", Header: "X-User"}, "alice"},
+		{&HashRing{Key: "header", Header: "X-Missing"}, "192.0.2.1"},
+	} {
+		if got := test.hr.key(request); got != test.expected {
+			t.Errorf("Test %d: Expected key %s, got %s", i, test.expected, got)
+		}
+	}
+}
+
+func TestParseHashRing(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		key       string
+		header    string
+	}{
+		{"proxy / a b {\n policy hash_ring \n}", false, "", ""},
+		{"proxy / a b {\n policy hash_ring uri \n}", false, "uri", ""},
+		{"proxy / a b {\n policy hash_ring header X-User \n}", false, "header", "X-User"},
+		{"proxy / a b {\n policy hash_ring header \n}", true, "", ""},
+		{"proxy / a b {\n policy hash_ring cookie \n}", true, "", ""},
+		{"proxy / a b {\n policy hash_ring ip extra \n}", true, "", ""},
+	} {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.input)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		hr, ok := upstreams[0].(*staticUpstream).Policy.(*HashRing)
+		if !ok {
+			t.Fatalf("Test %d: Expected hash ring policy, got %T", i, upstreams[0].(*staticUpstream).Policy)
+		}
+		if hr.Key != test.key || hr.Header != test.header {
+			t.Errorf("Test %d: Expected key %s and header %s, got %s and %s", i, test.key, test.header, hr.Key, hr.Header)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/internal/kvstore"
+)
+
+// Lookup selects the host of each request by asking a lookup
+// service, such as which backend serves a customer, so hosts
+// can be added and moved without reloading. Requests the
+// service knows nothing about go to the configured hosts.
+type Lookup struct {
+	// Key is what is looked up, with placeholders: the
+	// URL of an HTTP service, or the key of a Redis one
+	Key string
+
+	// Source answers the lookups
+	Source LookupSource
+
+	// How long answers are remembered
+	TTL time.Duration
+
+	mu      sync.Mutex
+	answers map[string]lookupAnswer
+	sets    int
+	hosts   map[string]*UpstreamHost
+	newHost func(string) (*UpstreamHost, error)
+}
+
+// LookupSource is a service that maps keys to upstream hosts.
+type LookupSource interface {
+	// Get returns the upstream host for key,
+	// or "" if there is none.
+	Get(key string) (string, error)
+}
+
+type lookupAnswer struct {
+	host    string
+	expires time.Time
+}
+
+func newLookup() *Lookup {
+	return &Lookup{
+		TTL:     DefaultLookupTTL,
+		answers: make(map[string]lookupAnswer),
+		hosts:   make(map[string]*UpstreamHost),
+	}
+}
+
+// setSource makes l look up key in the service at source, a
+// URL: a Redis server for redis:// URLs, else the HTTP service
+// at the URL, which is the key, so key must be empty.
+func (l *Lookup) setSource(source, key string) error {
+	u, err := url.Parse(source)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "redis":
+		if key == "" {
+			return fmt.Errorf("redis lookup needs a key")
+		}
+		store, err := kvstore.NewRedis(u)
+		if err != nil {
+			return err
+		}
+		l.Key, l.Source = key, store
+	case "http", "https":
+		if key != "" {
+			return fmt.Errorf("HTTP lookup takes no key; the URL is the key")
+		}
+		l.Key, l.Source = source, httpLookup{client: &http.Client{Timeout: lookupTimeout}}
+	default:
+		return fmt.Errorf("unknown lookup service '%s'", source)
+	}
+	return nil
+}
+
+// host returns the host the service maps r to, and whether
+// it maps r at all; the host is nil if it is unavailable.
+func (l *Lookup) host(r *http.Request) (*UpstreamHost, bool) {
+	key := httpserver.NewReplacer(r, nil, "").Replace(l.Key)
+	name, ok := l.cached(key)
+	if !ok {
+		var err error
+		name, err = l.Source.Get(key)
+		if err != nil {
+			log.Printf("[ERROR] proxy: looking up %s: %v", key, err)
+			return nil, false
+		}
+		name = strings.TrimSpace(name)
+		l.remember(key, name)
+	}
+	if name == "" {
+		return nil, false
+	}
+
+	host, err := l.upstreamHost(name)
+	if err != nil {
+		log.Printf("[ERROR] proxy: looking up %s: invalid host '%s': %v", key, name, err)
+		return nil, true
+	}
+	if !host.Available() {
+		return nil, true
+	}
+	return host, true
+}
+
+func (l *Lookup) cached(key string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	a, ok := l.answers[key]
+	if !ok || time.Now().After(a.expires) {
+		return "", false
+	}
+	return a.host, true
+}
+
+func (l *Lookup) remember(key, host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.answers[key] = lookupAnswer{host: host, expires: now.Add(l.TTL)}
+
+	// purge expired answers now and then
+	if l.sets++; l.sets%memoryPurgeInterval == 0 {
+		for k, a := range l.answers {
+			if now.After(a.expires) {
+				delete(l.answers, k)
+			}
+		}
+	}
+}
+
+// upstreamHost returns the host named name, creating it
+// the first time, so its state is kept across requests.
+func (l *Lookup) upstreamHost(name string) (*UpstreamHost, error) {
+	if !strings.Contains(name, "://") {
+		name = "http://" + name
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if host, ok := l.hosts[name]; ok {
+		return host, nil
+	}
+	u, err := url.Parse(name)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("no host")
+	}
+	host, err := l.newHost(name)
+	if err != nil {
+		return nil, err
+	}
+	l.hosts[name] = host
+	return host, nil
+}
+
+// httpLookup looks up keys, which are URLs, with GET
+// requests. The first line of the body of a 200 response
+// is the host; a 404 response means there is none.
+type httpLookup struct {
+	client *http.Client
+}
+
+// Get implements LookupSource.
+func (h httpLookup) Get(key string) (string, error) {
+	resp, err := h.client.Get(key)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", nil
+	default:
+		return "", fmt.Errorf("%s", resp.Status)
+	}
+	line, err := bufio.NewReader(io.LimitReader(resp.Body, maxLookupAnswer)).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return line, nil
+}
+
+const (
+	// DefaultLookupTTL is how long answers of a
+	// lookup service are remembered by default.
+	DefaultLookupTTL = 1 * time.Minute
+
+	maxLookupAnswer = 1024
+	lookupTimeout   = 1 * time.Second
+)
@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/internal/kvstore"
+)
+
+func TestParseLookup(t *testing.T) {
+	tests := []struct {
+		config      string
+		shouldErr   bool
+		expectedKey string
+		expectedTTL time.Duration
+	}{
+		{"proxy / {\n lookup http://routes/backend?tenant={host} \n}", false, "http://routes/backend?tenant={host}", DefaultLookupTTL},
+		{"proxy / a {\n lookup_ttl 5s \n lookup redis://localhost tenant:{host} \n}", false, "tenant:{host}", 5 * time.Second},
+		{"proxy / {\n lookup redis://localhost \n}", true, "", 0},
+		{"proxy / {\n lookup http://routes/backend key \n}", true, "", 0},
+		{"proxy / {\n lookup ftp://routes/backend \n}", true, "", 0},
+		{"proxy / {\n lookup \n}", true, "", 0},
+		{"proxy / a {\n lookup_ttl 5s \n}", true, "", 0},
+		{"proxy / {\n lookup_ttl soon \n}", true, "", 0},
+		{"proxy / \n", true, "", 0},
+	}
+
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		l := upstreams[0].(*staticUpstream).Lookup
+		if l == nil || l.Key != test.expectedKey || l.TTL != test.expectedTTL {
+			t.Errorf("Test %d: Expected lookup of '%s' for %v, got %+v", i, test.expectedKey, test.expectedTTL, l)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+	}
+	backendA, backendB, fallback := newBackend("a"), newBackend("b"), newBackend("fallback")
+	defer backendA.Close()
+	defer backendB.Close()
+	defer fallback.Close()
+
+	var lookups int32
+	routes := map[string]string{
+		"a.example.com":    backendA.URL + "\n",
+		"b.example.com":    strings.TrimPrefix(backendB.URL, "http://"),
+		"gone.example.com": "127.0.0.1:1",
+		"bad.example.com":  "http://",
+	}
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&lookups, 1)
+		tenant := r.URL.Query().Get("tenant")
+		if tenant == "broken.example.com" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		backend, ok := routes[tenant]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(backend))
+	}))
+	defer service.Close()
+
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+		strings.NewReader("proxy / "+fallback.URL+" {\n lookup "+service.URL+"/route?tenant={host} \n max_fails 1 \n fail_timeout 1m \n}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{Next: httpserver.EmptyNext, Upstreams: upstreams}
+
+	for i, test := range []struct {
+		host           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"a.example.com", http.StatusOK, "a"},
+		{"b.example.com", http.StatusOK, "b"},
+		{"a.example.com", http.StatusOK, "a"},
+		{"unknown.example.com", http.StatusOK, "fallback"},
+		{"broken.example.com", http.StatusOK, "fallback"},
+		{"gone.example.com", http.StatusBadGateway, ""},
+		{"gone.example.com", http.StatusBadGateway, ""},
+		{"bad.example.com", http.StatusBadGateway, ""},
+	} {
+		req := httptest.NewRequest("GET", "http://"+test.host+"/", nil)
+		w := httptest.NewRecorder()
+		status, _ := p.ServeHTTP(w, req)
+		if status == 0 {
+			status = w.Code
+		}
+		if status != test.expectedStatus || w.Body.String() != test.expectedBody {
+			t.Errorf("Test %d: Expected %d '%s' for %s, got %d '%s'", i, test.expectedStatus, test.expectedBody, test.host, status, w.Body.String())
+		}
+	}
+	// answers are remembered, but failures are not
+	if got := atomic.LoadInt32(&lookups); got != 6 {
+		t.Errorf("Expected 6 lookups, got %d", got)
+	}
+}
+
+func TestRedisLookup(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tenant backend"))
+	}))
+	defer backend.Close()
+
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+		strings.NewReader("proxy / {\n lookup redis://:secret@localhost:6379 tenant:{host} \n}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookup := upstreams[0].(*staticUpstream).Lookup
+	if _, ok := lookup.Source.(*kvstore.Redis); !ok {
+		t.Fatalf("Expected Redis lookup source, got %T", lookup.Source)
+	}
+
+	// the store protocol is tested with the kvstore package
+	store := newMemoryStore()
+	store.Set("tenant:t1.example.com", backend.URL, time.Minute)
+	lookup.Source = store
+
+	p := &Proxy{Next: httpserver.EmptyNext, Upstreams: upstreams}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "http://t1.example.com/", nil))
+	if w.Body.String() != "tenant backend" {
+		t.Errorf("Expected response of tenant backend, got '%s'", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	if status, _ := p.ServeHTTP(w, httptest.NewRequest("GET", "http://t2.example.com/", nil)); status != http.StatusBadGateway {
+		t.Errorf("Expected 502 for unknown tenant without hosts, got %d", status)
+	}
+}
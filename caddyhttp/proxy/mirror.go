@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// Mirror copies the requests to an upstream to a shadow host and
+// discards its responses, so that a new version of a service can
+// be tried with production traffic without affecting clients. The
+// copies are sent asynchronously; the response to the client never
+// waits for the shadow host.
+type Mirror struct {
+	// copies in flight; first for alignment of atomic operations
+	inFlight int64
+
+	// Target is the shadow host
+	Target *url.URL
+
+	// Percent of the requests copied
+	Percent int
+
+	// Most copies in flight at once; requests beyond
+	// that are not copied, so a slow shadow host does
+	// not pile up goroutines and memory
+	MaxInFlight int64
+
+	// How long a copy may take
+	Timeout time.Duration
+
+	proxy *ReverseProxy
+}
+
+const (
+	defaultMirrorMaxInFlight = 100
+	defaultMirrorTimeout     = 30 * time.Second
+)
+
+// newMirror returns a Mirror to target with default settings.
+func newMirror(target *url.URL) *Mirror {
+	return &Mirror{
+		Target:      target,
+		Percent:     100,
+		MaxInFlight: defaultMirrorMaxInFlight,
+		Timeout:     defaultMirrorTimeout,
+	}
+}
+
+// send copies outreq, the request going upstream, with body,
+// which was read from it, to the shadow host, unless it is not
+// sampled or too many copies are in flight.
+func (m *Mirror) send(outreq *http.Request, body []byte) {
+	if m.Percent < 100 && rand.Intn(100) >= m.Percent {
+		return
+	}
+	if atomic.AddInt64(&m.inFlight, 1) > m.MaxInFlight {
+		atomic.AddInt64(&m.inFlight, -1)
+		return
+	}
+
+	// the copy must outlive the request of the client,
+	// so it does not share its context
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+	req := new(http.Request)
+	*req = *outreq
+	req = req.WithContext(ctx)
+	u := *outreq.URL
+	req.URL = &u
+	req.Header = make(http.Header)
+	copyHeader(req.Header, outreq.Header)
+	req.Host = m.Target.Host
+	req.RequestURI = ""
+	req.Body = nil
+	if body != nil {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+	}
+	m.proxy.Director(req)
+
+	transport := m.proxy.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	go func() {
+		defer atomic.AddInt64(&m.inFlight, -1)
+		defer cancel()
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			log.Printf("[WARNING] proxy: mirroring to %s: %v", m.Target, err)
+			return
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
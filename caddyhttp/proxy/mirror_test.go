@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestParseMirror(t *testing.T) {
+	tests := []struct {
+		config          string
+		shouldErr       bool
+		expectedTarget  string
+		expectedPercent int
+	}{
+		{"proxy / a {\n mirror shadow:8080 \n}", false, "http://shadow:8080", 100},
+		{"proxy / a {\n mirror https://shadow 10% \n}", false, "https://shadow", 10},
+		{"proxy / a {\n mirror \n}", true, "", 0},
+		{"proxy / a {\n mirror shadow 0% \n}", true, "", 0},
+		{"proxy / a {\n mirror shadow 150 \n}", true, "", 0},
+		{"proxy / a {\n mirror shadow 10% more \n}", true, "", 0},
+	}
+
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		m := upstreams[0].(*staticUpstream).Mirror
+		if m == nil || m.Target.String() != test.expectedTarget || m.Percent != test.expectedPercent || m.proxy == nil {
+			t.Errorf("Test %d: Expected mirror to %s of %d%%, got %+v", i, test.expectedTarget, test.expectedPercent, m)
+		}
+	}
+}
+
+func TestMirror(t *testing.T) {
+	type copied struct {
+		method, path, body, header string
+	}
+	copies := make(chan copied, 1)
+	unblock := make(chan struct{})
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		copies <- copied{r.Method, r.URL.Path, string(body), r.Header.Get("X-Test")}
+		<-unblock
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer shadow.Close()
+	defer close(unblock)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte("primary " + string(body)))
+	}))
+	defer backend.Close()
+
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+		strings.NewReader("proxy /api "+backend.URL+" {\n without /api \n mirror "+shadow.URL+" \n}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{Next: httpserver.EmptyNext, Upstreams: upstreams}
+
+	req := httptest.NewRequest("POST", "/api/orders", strings.NewReader("order"))
+	req.Header.Set("X-Test", "yes")
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		p.ServeHTTP(w, req)
+		close(done)
+	}()
+
+	// the client is answered while the shadow host has not
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the response, which should not wait for the mirror")
+	}
+	if w.Code != http.StatusOK || w.Body.String() != "primary order" {
+		t.Errorf("Expected the response of the primary host, got %d '%s'", w.Code, w.Body.String())
+	}
+
+	select {
+	case c := <-copies:
+		if c.method != "POST" || c.path != "/orders" || c.body != "order" || c.header != "yes" {
+			t.Errorf("Expected a copy of the request, got %+v", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the copy of the request")
+	}
+}
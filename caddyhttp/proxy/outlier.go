@@ -0,0 +1,278 @@
+package proxy
+
+import (
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OutlierDetection ejects hosts from a pool for a while when their
+// error rate or latency is much worse than that of the other hosts,
+// or at once when they fail too many requests in a row. Ejected hosts
+// are reinstated gradually: they receive a growing share of their
+// requests over one ejection time.
+type OutlierDetection struct {
+	// How often the hosts are judged
+	Interval time.Duration
+
+	// Hosts whose error rate exceeds this multiple of the
+	// median error rate of the pool are ejected; 0 disables
+	ErrorFactor float64
+
+	// Hosts whose mean latency exceeds this multiple of the
+	// median latency of the pool are ejected; 0 disables
+	LatencyFactor float64
+
+	// Requests a host must have had since the last
+	// judgement to be judged
+	MinRequests int
+
+	// Hosts that fail this many requests in a row, with a
+	// 5xx response or a connection error, are ejected at
+	// once; 0 disables
+	Consecutive int
+
+	// Most hosts of the pool that may be ejected at
+	// once, as a percentage of the pool
+	MaxEjectionPercent int
+
+	// How long a host is ejected the first time; each
+	// consecutive ejection lasts twice as long, up to
+	// MaxEjectionTime
+	EjectionTime    time.Duration
+	MaxEjectionTime time.Duration
+
+	mu    sync.Mutex
+	stats map[*UpstreamHost]*hostStats
+}
+
+// hostStats are the statistics and ejection state of a host.
+type hostStats struct {
+	requests     int
+	failures     int
+	latency      time.Duration // total of requests
+	consecutive  int           // failures in a row
+	ejections    int           // consecutive
+	ejectedUntil time.Time
+}
+
+// newOutlierDetection returns an OutlierDetection with default settings.
+func newOutlierDetection() *OutlierDetection {
+	return &OutlierDetection{
+		Interval:           defaultOutlierInterval,
+		ErrorFactor:        2,
+		LatencyFactor:      3,
+		MinRequests:        10,
+		Consecutive:        5,
+		MaxEjectionPercent: 50,
+		EjectionTime:       30 * time.Second,
+		MaxEjectionTime:    maxEjectionFactor * 30 * time.Second,
+	}
+}
+
+// observe records a response from host of pool, and ejects
+// the host if it failed too many requests in a row.
+func (od *OutlierDetection) observe(pool HostPool, host *UpstreamHost, failed bool, latency time.Duration) {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	s := od.hostStats(host)
+	s.requests++
+	s.latency += latency
+	if !failed {
+		s.consecutive = 0
+		return
+	}
+	s.failures++
+	s.consecutive++
+	if od.Consecutive == 0 || s.consecutive < od.Consecutive {
+		return
+	}
+	now := time.Now()
+	if now.Before(s.ejectedUntil) {
+		return
+	}
+	s.consecutive = 0
+	if od.ejectedCount(pool, now) >= len(pool)*od.MaxEjectionPercent/100 {
+		log.Printf("[WARNING] Not ejecting outlier %s (consecutive failures): %d%% of hosts already ejected",
+			host.Name, od.MaxEjectionPercent)
+		return
+	}
+	od.eject(host, s, now, "consecutive failures")
+}
+
+// ejectedCount returns how many hosts of pool are
+// ejected at now. od.mu must be locked.
+func (od *OutlierDetection) ejectedCount(pool HostPool, now time.Time) int {
+	var n int
+	for _, host := range pool {
+		if s, ok := od.stats[host]; ok && now.Before(s.ejectedUntil) {
+			n++
+		}
+	}
+	return n
+}
+
+// eject ejects host, whose stats are s, from now for EjectionTime,
+// doubled for each of its consecutive ejections before, up to
+// MaxEjectionTime, if set. od.mu must be locked.
+func (od *OutlierDetection) eject(host *UpstreamHost, s *hostStats, now time.Time, reason string) {
+	s.ejections++
+	ejection := od.EjectionTime
+	for i := 1; i < s.ejections && (od.MaxEjectionTime == 0 || ejection < od.MaxEjectionTime); i++ {
+		ejection *= 2
+	}
+	if od.MaxEjectionTime > 0 && ejection > od.MaxEjectionTime {
+		ejection = od.MaxEjectionTime
+	}
+	s.ejectedUntil = now.Add(ejection)
+	log.Printf("[WARNING] Ejecting outlier %s (%s) for %v", host.Name, reason, ejection)
+}
+
+// hostStats returns the stats of host. od.mu must be locked.
+func (od *OutlierDetection) hostStats(host *UpstreamHost) *hostStats {
+	if od.stats == nil {
+		od.stats = make(map[*UpstreamHost]*hostStats)
+	}
+	s, ok := od.stats[host]
+	if !ok {
+		s = new(hostStats)
+		od.stats[host] = s
+	}
+	return s
+}
+
+// ejected returns whether host is ejected.
+func (od *OutlierDetection) ejected(host *UpstreamHost) bool {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	s, ok := od.stats[host]
+	return ok && time.Now().Before(s.ejectedUntil)
+}
+
+// filter returns the hosts of pool to select from. Hosts being
+// reinstated are left out in proportion to how recently their
+// ejection ended, unless no other host would be available.
+func (od *OutlierDetection) filter(pool HostPool) HostPool {
+	od.mu.Lock()
+	now := time.Now()
+	var filtered HostPool
+	var skipped bool
+	for _, host := range pool {
+		if s, ok := od.stats[host]; ok && s.ejections > 0 && now.After(s.ejectedUntil) {
+			if ramp := now.Sub(s.ejectedUntil); ramp < od.EjectionTime &&
+				rand.Float64()*float64(od.EjectionTime) > float64(ramp) {
+				skipped = true
+				continue
+			}
+		}
+		filtered = append(filtered, host)
+	}
+	od.mu.Unlock()
+
+	if !skipped {
+		return pool
+	}
+	for _, host := range filtered {
+		if host.Available() {
+			return filtered
+		}
+	}
+	return pool
+}
+
+// evaluate judges the hosts of pool by their statistics since
+// the last evaluation, ejecting outliers, and resets the stats.
+func (od *OutlierDetection) evaluate(pool HostPool, now time.Time) {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+
+	ejected := od.ejectedCount(pool, now)
+	var judged []*UpstreamHost
+	var errorRates, latencies []float64
+	for _, host := range pool {
+		s := od.hostStats(host)
+		if now.Before(s.ejectedUntil) {
+			continue
+		}
+		if s.requests < od.MinRequests || s.requests == 0 {
+			continue
+		}
+		judged = append(judged, host)
+		errorRates = append(errorRates, float64(s.failures)/float64(s.requests))
+		latencies = append(latencies, float64(s.latency)/float64(s.requests))
+	}
+
+	if len(judged) >= 2 {
+		medianErrorRate, medianLatency := median(errorRates), median(latencies)
+		maxEjected := len(pool) * od.MaxEjectionPercent / 100
+		for i, host := range judged {
+			s := od.stats[host]
+			var reason string
+			switch {
+			case od.ErrorFactor > 0 && errorRates[i] >= minOutlierErrorRate &&
+				errorRates[i] > od.ErrorFactor*medianErrorRate:
+				reason = "error rate"
+			case od.LatencyFactor > 0 && medianLatency > 0 &&
+				latencies[i] > od.LatencyFactor*medianLatency:
+				reason = "latency"
+			}
+			if reason == "" {
+				if s.ejections > 0 && now.Sub(s.ejectedUntil) >= od.EjectionTime {
+					s.ejections-- // well behaved again since reinstated
+				}
+				continue
+			}
+			if ejected >= maxEjected {
+				log.Printf("[WARNING] Not ejecting outlier %s (%s): %d%% of hosts already ejected",
+					host.Name, reason, od.MaxEjectionPercent)
+				continue
+			}
+			ejected++
+			od.eject(host, s, now, reason)
+		}
+	}
+
+	for _, s := range od.stats {
+		s.requests, s.failures, s.latency = 0, 0, 0
+	}
+}
+
+// worker evaluates hosts every od.Interval.
+func (od *OutlierDetection) worker(pool HostPool, stop chan struct{}) {
+	ticker := time.NewTicker(od.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			od.evaluate(pool, now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// median returns the median of values.
+func median(values []float64) float64 {
+	values = append([]float64(nil), values...)
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+const (
+	defaultOutlierInterval = 10 * time.Second
+
+	// maxEjectionFactor is how many times the ejection time
+	// hosts are ejected for at most, unless set otherwise.
+	maxEjectionFactor = 10
+
+	// minOutlierErrorRate is the lowest error rate for which
+	// a host is ejected, so that a pool with few errors does
+	// not eject hosts for a single one.
+	minOutlierErrorRate = 0.1
+)
@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+func TestParseOutlierDetection(t *testing.T) {
+	tests := []struct {
+		config    string
+		shouldErr bool
+		expected  *OutlierDetection
+	}{
+		{"proxy / a b {\n outlier_detection \n}", false, newOutlierDetection()},
+		{"proxy / a b {\n outlier_detection 5s \n outlier_errors 3 \n outlier_latency 0 \n outlier_min_requests 20 \n outlier_max_ejection 30% \n outlier_ejection_time 1m \n}", false,
+			&OutlierDetection{Interval: 5 * time.Second, ErrorFactor: 3, MinRequests: 20, Consecutive: 5, MaxEjectionPercent: 30, EjectionTime: time.Minute, MaxEjectionTime: 10 * time.Minute}},
+		{"proxy / a b {\n outlier_detection \n outlier_consecutive 0 \n outlier_ejection_time 10s 1m \n}", false,
+			&OutlierDetection{Interval: defaultOutlierInterval, ErrorFactor: 2, LatencyFactor: 3, MinRequests: 10, MaxEjectionPercent: 50, EjectionTime: 10 * time.Second, MaxEjectionTime: time.Minute}},
+		{"proxy / a b {\n outlier_detection \n outlier_consecutive -1 \n}", true, nil},
+		{"proxy / a b {\n outlier_detection \n outlier_ejection_time 1m 10s \n}", true, nil},
+		{"proxy / a b {\n outlier_detection \n outlier_ejection_time 1m 2m 3m \n}", true, nil},
+		{"proxy / a b {\n outlier_errors 3 \n}", true, nil},
+		{"proxy / a b {\n outlier_detection 0s \n}", true, nil},
+		{"proxy / a b {\n outlier_detection \n outlier_errors 0.5 \n}", true, nil},
+		{"proxy / a b {\n outlier_detection \n outlier_max_ejection 150 \n}", true, nil},
+		{"proxy / a b {\n outlier_detection \n outlier_min_requests 0 \n}", true, nil},
+	}
+
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		od := upstreams[0].(*staticUpstream).OutlierDetection
+		if od == nil {
+			t.Errorf("Test %d: Expected outlier detection", i)
+			continue
+		}
+		if od.Interval != test.expected.Interval || od.ErrorFactor != test.expected.ErrorFactor ||
+			od.LatencyFactor != test.expected.LatencyFactor || od.MinRequests != test.expected.MinRequests ||
+			od.Consecutive != test.expected.Consecutive || od.MaxEjectionPercent != test.expected.MaxEjectionPercent ||
+			od.EjectionTime != test.expected.EjectionTime || od.MaxEjectionTime != test.expected.MaxEjectionTime {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, od)
+		}
+	}
+}
+
+func TestOutlierEjection(t *testing.T) {
+	pool := HostPool{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}, {Name: "e"}}
+	od := newOutlierDetection()
+	od.Consecutive = 0
+	od.MaxEjectionPercent = 20
+	od.EjectionTime = time.Minute
+
+	observe := func(host *UpstreamHost, requests, failures int, latency time.Duration) {
+		for i := 0; i < requests; i++ {
+			od.observe(pool, host, i < failures, latency)
+		}
+	}
+
+	// c fails half of its requests and d is slow, but
+	// only one host may be ejected at a time
+	now := time.Now()
+	observe(pool[0], 20, 0, 10*time.Millisecond)
+	observe(pool[1], 20, 1, 10*time.Millisecond)
+	observe(pool[2], 20, 10, 10*time.Millisecond)
+	observe(pool[3], 20, 0, 100*time.Millisecond)
+	od.evaluate(pool, now)
+	for i, expected := range []bool{false, false, true, false, false} {
+		if actual := od.ejected(pool[i]); actual != expected {
+			t.Errorf("Host %s: Expected ejected to be %v, got %v", pool[i].Name, expected, actual)
+		}
+	}
+
+	// with more room, d is ejected as well; hosts
+	// with too few requests are not judged
+	od.MaxEjectionPercent = 40
+	observe(pool[0], 20, 0, 10*time.Millisecond)
+	observe(pool[1], 20, 0, 10*time.Millisecond)
+	observe(pool[2], 20, 20, time.Second)
+	observe(pool[3], 20, 0, 100*time.Millisecond)
+	observe(pool[4], 5, 5, 10*time.Millisecond)
+	od.evaluate(pool, now.Add(od.Interval))
+	for i, expected := range []bool{false, false, true, true, false} {
+		if actual := od.ejected(pool[i]); actual != expected {
+			t.Errorf("Host %s: Expected ejected to be %v, got %v", pool[i].Name, expected, actual)
+		}
+	}
+
+	// statistics are reset after each evaluation
+	od.evaluate(pool, now.Add(2*od.Interval))
+	if s := od.stats[pool[0]]; s.requests != 0 || s.failures != 0 || s.latency != 0 {
+		t.Errorf("Expected stats to be reset, got %+v", s)
+	}
+}
+
+func TestOutlierConsecutiveFailures(t *testing.T) {
+	pool := HostPool{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}}
+	od := newOutlierDetection()
+	od.Consecutive = 3
+	od.MaxEjectionPercent = 25
+
+	// failures that are not in a row do not eject a host
+	for _, failed := range []bool{true, true, false, true, true} {
+		od.observe(pool, pool[0], failed, time.Millisecond)
+	}
+	if od.ejected(pool[0]) {
+		t.Error("Expected a host without enough failures in a row not to be ejected")
+	}
+	od.observe(pool, pool[0], true, time.Millisecond)
+	if !od.ejected(pool[0]) {
+		t.Error("Expected a host with enough failures in a row to be ejected at once")
+	}
+
+	// no more hosts than allowed are ejected
+	for i := 0; i < 3; i++ {
+		od.observe(pool, pool[1], true, time.Millisecond)
+	}
+	if od.ejected(pool[1]) {
+		t.Error("Expected a host not to be ejected when too many already are")
+	}
+}
+
+func TestOutlierEjectionTime(t *testing.T) {
+	host := &UpstreamHost{Name: "a"}
+	od := newOutlierDetection()
+	od.EjectionTime = time.Minute
+	od.MaxEjectionTime = 5 * time.Minute
+	s := od.hostStats(host)
+	now := time.Now()
+
+	// each consecutive ejection lasts twice as long, up to the maximum
+	for i, expected := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		od.eject(host, s, now, "test")
+		if actual := s.ejectedUntil.Sub(now); actual != expected {
+			t.Errorf("Ejection %d: Expected to last %v, got %v", i+1, expected, actual)
+		}
+	}
+}
+
+func TestOutlierReinstatement(t *testing.T) {
+	pool := HostPool{{Name: "a"}, {Name: "b"}}
+	od := newOutlierDetection()
+	od.EjectionTime = time.Hour
+	od.stats = map[*UpstreamHost]*hostStats{
+		pool[1]: {ejections: 1, ejectedUntil: time.Now().Add(-6 * time.Minute)},
+	}
+
+	// b was reinstated a tenth of an ejection time ago,
+	// so it should be selectable about a tenth of the time
+	var selectable int
+	for i := 0; i < 1000; i++ {
+		for _, host := range od.filter(pool) {
+			if host == pool[1] {
+				selectable++
+			}
+		}
+	}
+	if selectable < 50 || selectable > 150 {
+		t.Errorf("Expected reinstated host to be selectable about 100 of 1000 times, got %d", selectable)
+	}
+
+	// the host is not left out if no other is available
+	pool[0].Unhealthy = true
+	if filtered := od.filter(pool); len(filtered) != 2 {
+		t.Errorf("Expected both hosts when the other is unavailable, got %d", len(filtered))
+	}
+}
+
+func TestMedian(t *testing.T) {
+	values := []float64{3, 1, 2}
+	if m := median(values); m != 2 {
+		t.Errorf("Expected median 2, got %v", m)
+	}
+	if values[0] != 3 {
+		t.Error("Expected median not to reorder its argument")
+	}
+	if m := median([]float64{4, 1, 3, 2}); m != 2.5 {
+		t.Errorf("Expected median 2.5, got %v", m)
+	}
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HealthOverride forces an upstream host healthy or unhealthy,
+// regardless of health checks and failures, until it expires.
+type HealthOverride struct {
+	Host    string    `json:"host"`
+	Healthy bool      `json:"healthy"`
+	Expires time.Time `json:"expires"`
+}
+
+// SetHealthOverride forces the upstream hosts named host healthy
+// or unhealthy for ttl, replacing any override they have. Hosts
+// are named as in the proxy directive, with their scheme, such
+// as http://10.0.0.1:8080. Overrides are kept across reloads.
+func SetHealthOverride(host string, healthy bool, ttl time.Duration) HealthOverride {
+	o := HealthOverride{Host: host, Healthy: healthy, Expires: time.Now().Add(ttl)}
+	overridesMu.Lock()
+	if overrides == nil {
+		overrides = make(map[string]HealthOverride)
+	}
+	for name, old := range overrides {
+		if !time.Now().Before(old.Expires) {
+			delete(overrides, name)
+		}
+	}
+	overrides[host] = o
+	atomic.StoreInt32(&numOverrides, int32(len(overrides)))
+	overridesMu.Unlock()
+	return o
+}
+
+// ClearHealthOverride removes the override of the upstream hosts
+// named host, and returns whether they had one.
+func ClearHealthOverride(host string) bool {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	_, ok := overrides[host]
+	delete(overrides, host)
+	atomic.StoreInt32(&numOverrides, int32(len(overrides)))
+	return ok
+}
+
+// HealthOverrides returns the overrides that have not
+// expired, ordered by host.
+func HealthOverrides() []HealthOverride {
+	now := time.Now()
+	overridesMu.RLock()
+	list := make([]HealthOverride, 0, len(overrides))
+	for _, o := range overrides {
+		if now.Before(o.Expires) {
+			list = append(list, o)
+		}
+	}
+	overridesMu.RUnlock()
+	sort.Sort(byHost(list))
+	return list
+}
+
+type byHost []HealthOverride
+
+func (l byHost) Len() int           { return len(l) }
+func (l byHost) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l byHost) Less(i, j int) bool { return l[i].Host < l[j].Host }
+
+// healthOverride returns whether the upstream host named host
+// is forced healthy, and whether it has an override at all.
+func healthOverride(host string) (healthy bool, ok bool) {
+	// most of the time there are no overrides
+	if atomic.LoadInt32(&numOverrides) == 0 {
+		return false, false
+	}
+	overridesMu.RLock()
+	o, ok := overrides[host]
+	overridesMu.RUnlock()
+	if !ok || !time.Now().Before(o.Expires) {
+		return false, false
+	}
+	return o.Healthy, true
+}
+
+// knownHost returns whether an upstream host named host
+// was configured.
+func knownHost(host string) bool {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+	return knownHosts[host]
+}
+
+// addKnownHost records that an upstream host named host
+// was configured.
+func addKnownHost(host string) {
+	knownHostsMu.Lock()
+	if knownHosts == nil {
+		knownHosts = make(map[string]bool)
+	}
+	knownHosts[host] = true
+	knownHostsMu.Unlock()
+}
+
+var (
+	// overrides are the health overrides, by host name
+	overrides    map[string]HealthOverride
+	overridesMu  sync.RWMutex
+	numOverrides int32
+
+	// knownHosts are the names of the upstream hosts
+	// configured since the process started
+	knownHosts   map[string]bool
+	knownHostsMu sync.Mutex
+)
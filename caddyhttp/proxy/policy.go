@@ -1,12 +1,14 @@
 package proxy
 
 import (
+	"errors"
 	"hash/fnv"
 	"math"
 	"math/rand"
 	"net"
 	"net/http"
 	"sync"
+	"time"
 )
 
 // HostPool is a collection of UpstreamHosts.
@@ -22,17 +24,23 @@ func init() {
 	RegisterPolicy("least_conn", func() Policy { return &LeastConn{} })
 	RegisterPolicy("round_robin", func() Policy { return &RoundRobin{} })
 	RegisterPolicy("ip_hash", func() Policy { return &IPHash{} })
+	RegisterPolicy("least_latency", func() Policy { return &LeastLatency{} })
+	RegisterPolicy("weighted_round_robin", func() Policy { return &WeightedRoundRobin{} })
+	RegisterPolicy("hash_ring", func() Policy { return &HashRing{} })
+	RegisterPolicy("header", func() Policy { return &HeaderHash{} })
+	RegisterPolicy("cookie", func() Policy { return &CookieHash{} })
 }
 
 // Random is a policy that selects up hosts from a pool at random.
 type Random struct{}
 
 // Select selects an up host at random from the specified pool.
+// Hosts that are slow starting are selected less often.
 func (r *Random) Select(pool HostPool, request *http.Request) *UpstreamHost {
 
 	// Because the number of available hosts isn't known
-	// up front, the host is selected via reservoir sampling
-	// https://en.wikipedia.org/wiki/Reservoir_sampling
+	// up front, the host is selected via weighted reservoir
+	// sampling https://en.wikipedia.org/wiki/Reservoir_sampling
 	var randHost *UpstreamHost
 	count := 0
 	for _, host := range pool {
@@ -40,11 +48,12 @@ func (r *Random) Select(pool HostPool, request *http.Request) *UpstreamHost {
 			continue
 		}
 
-		// (n % 1 == 0) holds for all n, therefore randHost
-		// will always get assigned a value if there is
-		// at least 1 available host
-		count++
-		if (rand.Int() % count) == 0 {
+		// (n % share < share) holds when count is share,
+		// therefore randHost will always get assigned a
+		// value if there is at least 1 available host
+		share := host.ramp()
+		count += share
+		if (rand.Int() % count) < share {
 			randHost = host
 		}
 	}
@@ -56,7 +65,7 @@ type LeastConn struct{}
 
 // Select selects the up host with the least number of connections in the
 // pool.  If more than one host has the same least number of connections,
-// one of the hosts is chosen at random.
+// one of the hosts is chosen at random, in proportion to its weight.
 func (r *LeastConn) Select(pool HostPool, request *http.Request) *UpstreamHost {
 	var bestHost *UpstreamHost
 	count := 0
@@ -71,11 +80,12 @@ func (r *LeastConn) Select(pool HostPool, request *http.Request) *UpstreamHost {
 			count = 0
 		}
 
-		// Among hosts with same least connections, perform a reservoir
-		// sample: https://en.wikipedia.org/wiki/Reservoir_sampling
+		// Among hosts with same least connections, perform a weighted
+		// reservoir sample: https://en.wikipedia.org/wiki/Reservoir_sampling
 		if host.Conns == leastConn {
-			count++
-			if (rand.Int() % count) == 0 {
+			weight := host.weight() * host.ramp()
+			count += weight
+			if (rand.Int() % count) < weight {
 				bestHost = host
 			}
 		}
@@ -90,19 +100,65 @@ type RoundRobin struct {
 }
 
 // Select selects an up host from the pool using a round robin ordering scheme.
+// Hosts that are slow starting are skipped at times, unless no other is up.
 func (r *RoundRobin) Select(pool HostPool, request *http.Request) *UpstreamHost {
 	poolLen := uint32(len(pool))
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	// Return next available host
+	var skipped *UpstreamHost
 	for i := uint32(0); i < poolLen; i++ {
 		r.robin++
 		host := pool[r.robin%poolLen]
 		if host.Available() {
+			if !host.admits() {
+				if skipped == nil {
+					skipped = host
+				}
+				continue
+			}
 			return host
 		}
 	}
-	return nil
+	return skipped
+}
+
+// WeightedRoundRobin is a policy that selects hosts in round robin
+// ordering, each in proportion to its weight. Selections of the same
+// host are spread out rather than made in a row, as with the smooth
+// weighted round robin of nginx.
+type WeightedRoundRobin struct {
+	current map[*UpstreamHost]int
+	mutex   sync.Mutex
+}
+
+// Select selects an up host from the pool using a weighted round robin
+// ordering scheme: every available host gains its weight, the host that
+// has gained the most is selected, and it gives up the sum of the weights.
+func (r *WeightedRoundRobin) Select(pool HostPool, request *http.Request) *UpstreamHost {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.current == nil || len(r.current) > len(pool) {
+		// hosts may be replaced, as when they are looked up
+		r.current = make(map[*UpstreamHost]int, len(pool))
+	}
+	var bestHost *UpstreamHost
+	total := 0
+	for _, host := range pool {
+		if !host.Available() {
+			continue
+		}
+		weight := host.weight() * host.ramp()
+		r.current[host] += weight
+		total += weight
+		if bestHost == nil || r.current[host] > r.current[bestHost] {
+			bestHost = host
+		}
+	}
+	if bestHost != nil {
+		r.current[bestHost] -= total
+	}
+	return bestHost
 }
 
 // IPHash is a policy that selects hosts based on hashing the request ip
@@ -131,3 +187,161 @@ func (r *IPHash) Select(pool HostPool, request *http.Request) *UpstreamHost {
 	}
 	return nil
 }
+
+// HeaderHash is a policy that selects hosts based on hashing the
+// value of a request header, such as the ID of a tenant, so requests
+// with the same value go to the same host. Requests without the
+// header are balanced round robin.
+type HeaderHash struct {
+	Name     string
+	fallback RoundRobin
+}
+
+// Configure sets the name of the header hashed from args.
+func (r *HeaderHash) Configure(args []string) error {
+	if len(args) != 1 {
+		return errors.New("requires a header name")
+	}
+	r.Name = args[0]
+	return nil
+}
+
+// Select selects an up host from the pool by the value of the header.
+func (r *HeaderHash) Select(pool HostPool, request *http.Request) *UpstreamHost {
+	value := request.Header.Get(r.Name)
+	if value == "" {
+		return r.fallback.Select(pool, request)
+	}
+	return hostByHash(pool, hash(value))
+}
+
+// CookieHash is a policy that selects hosts based on hashing the
+// value of a request cookie, such as a session ID, so requests with
+// the same value go to the same host. Requests without the cookie
+// are balanced round robin.
+type CookieHash struct {
+	Name     string
+	fallback RoundRobin
+}
+
+// Configure sets the name of the cookie hashed from args.
+func (r *CookieHash) Configure(args []string) error {
+	if len(args) != 1 {
+		return errors.New("requires a cookie name")
+	}
+	r.Name = args[0]
+	return nil
+}
+
+// Select selects an up host from the pool by the value of the cookie.
+func (r *CookieHash) Select(pool HostPool, request *http.Request) *UpstreamHost {
+	cookie, err := request.Cookie(r.Name)
+	if err != nil || cookie.Value == "" {
+		return r.fallback.Select(pool, request)
+	}
+	return hostByHash(pool, hash(cookie.Value))
+}
+
+// hostByHash returns the host of pool at index h, or the next
+// one after it that is available. Hosts that are slow starting
+// are passed over at times, unless no other is available.
+func hostByHash(pool HostPool, h uint32) *UpstreamHost {
+	poolLen := uint32(len(pool))
+	var skipped *UpstreamHost
+	for i := uint32(0); i < poolLen; i++ {
+		host := pool[(h+i)%poolLen]
+		if host.Available() {
+			if !host.admits() {
+				if skipped == nil {
+					skipped = host
+				}
+				continue
+			}
+			return host
+		}
+	}
+	return skipped
+}
+
+// LeastLatency is a policy that selects the host that is expected
+// to respond soonest, by the peak-weighted moving average of its
+// recent latencies, weighted by its number of connections.
+type LeastLatency struct{}
+
+// Select selects the up host with the lowest expected latency in
+// the pool. Hosts not yet measured are tried first; if more than
+// one host has the same expected latency, one of them is chosen
+// at random.
+func (r *LeastLatency) Select(pool HostPool, request *http.Request) *UpstreamHost {
+	var bestHost *UpstreamHost
+	count := 0
+	lowest := math.MaxFloat64
+	now := time.Now()
+	for _, host := range pool {
+		if !host.Available() {
+			continue
+		}
+
+		// hosts that are slow starting cost more
+		cost := host.latency.value(now) * float64(host.Conns+1) * rampSteps / float64(host.ramp())
+		if cost < lowest {
+			lowest = cost
+			count = 0
+		}
+		if cost == lowest {
+			count++
+			if (rand.Int() % count) == 0 {
+				bestHost = host
+			}
+		}
+	}
+	return bestHost
+}
+
+// hostLatency is the peak-weighted moving average of the latencies
+// of a host: slower responses count at once, faster ones gradually,
+// and all samples decay, so a host that was slow is tried again.
+type hostLatency struct {
+	mu      sync.Mutex
+	average float64 // nanoseconds
+	last    time.Time
+}
+
+// observe records a response after d.
+func (l *hostLatency) observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	current := l.decayed(now)
+	if sample := float64(d); sample > current {
+		l.average = sample
+	} else {
+		w := math.Exp(-float64(now.Sub(l.last)) / float64(latencyDecay))
+		l.average = current*w + sample*(1-w)
+	}
+	l.last = now
+}
+
+// value returns the average at now.
+func (l *hostLatency) value(now time.Time) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.decayed(now)
+}
+
+func (l *hostLatency) decayed(now time.Time) float64 {
+	if l.last.IsZero() {
+		return 0
+	}
+	return l.average * math.Exp(-float64(now.Sub(l.last))/float64(latencyDecay))
+}
+
+const (
+	// latencyDecay is how long it takes latency samples to
+	// decay to about a third of their weight.
+	latencyDecay = 10 * time.Second
+
+	// latencyFailurePenalty is the latency a failed
+	// request counts as, unless it took longer.
+	latencyFailurePenalty = 5 * time.Second
+)
@@ -1,10 +1,17 @@
 package proxy
 
 import (
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
 var workableServer *httptest.Server
@@ -99,6 +106,124 @@ func TestLeastConnPolicy(t *testing.T) {
 	}
 }
 
+func TestLeastConnPolicyWeight(t *testing.T) {
+	pool := testPool()
+	pool[0].Weight = 0
+	pool[1].Weight = 0
+	pool[2].Weight = 8
+	lcPolicy := &LeastConn{}
+	request, _ := http.NewRequest("GET", "/", nil)
+
+	selected := make(map[*UpstreamHost]int)
+	for i := 0; i < 1000; i++ {
+		selected[lcPolicy.Select(pool, request)]++
+	}
+	// the third host should be chosen 8 in 10 times
+	if selected[pool[2]] < 700 || selected[pool[0]] == 0 || selected[pool[1]] == 0 {
+		t.Errorf("Expected ties to be broken by weight, got %d, %d and %d selections",
+			selected[pool[0]], selected[pool[1]], selected[pool[2]])
+	}
+}
+
+func TestWeightedRoundRobinPolicy(t *testing.T) {
+	pool := testPool()
+	pool[0].Weight = 5
+	pool[1].Weight = 1
+	pool[2].Weight = 0
+	wrrPolicy := &WeightedRoundRobin{}
+	request, _ := http.NewRequest("GET", "/", nil)
+
+	var order []*UpstreamHost
+	for i := 0; i < 7; i++ {
+		order = append(order, wrrPolicy.Select(pool, request))
+	}
+	expected := []*UpstreamHost{pool[0], pool[0], pool[1], pool[0], pool[2], pool[0], pool[0]}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Errorf("Selection %d: Expected %s, got %s", i, expected[i].Name, order[i].Name)
+		}
+	}
+
+	// unavailable hosts are skipped
+	pool[0].Unhealthy = true
+	for i := 0; i < 4; i++ {
+		if h := wrrPolicy.Select(pool, request); h == pool[0] {
+			t.Errorf("Selection %d: Expected unhealthy host not to be selected", i)
+		}
+	}
+	pool[1].Unhealthy = true
+	pool[2].Unhealthy = true
+	if h := wrrPolicy.Select(pool, request); h != nil {
+		t.Error("Expected no host when all are unhealthy")
+	}
+}
+
+func TestLeastLatencyPolicy(t *testing.T) {
+	pool := testPool()
+	llPolicy := &LeastLatency{}
+	request, _ := http.NewRequest("GET", "/", nil)
+
+	pool[0].latency.observe(10 * time.Millisecond)
+	pool[1].latency.observe(100 * time.Millisecond)
+	h := llPolicy.Select(pool, request)
+	if h != pool[2] {
+		t.Error("Expected host not yet measured to be third host.")
+	}
+	pool[2].latency.observe(50 * time.Millisecond)
+	h = llPolicy.Select(pool, request)
+	if h != pool[0] {
+		t.Error("Expected least latency host to be first host.")
+	}
+	pool[0].Conns = 10
+	h = llPolicy.Select(pool, request)
+	if h != pool[2] {
+		t.Error("Expected least latency host weighted by connections to be third host.")
+	}
+	pool[2].latency.observe(time.Second)
+	h = llPolicy.Select(pool, request)
+	if h != pool[1] {
+		t.Error("Expected a slow response to count at once, making second host the least latency host.")
+	}
+}
+
+func TestHostLatencyDecay(t *testing.T) {
+	now := time.Now()
+	l := &hostLatency{average: float64(time.Second), last: now.Add(-latencyDecay)}
+	if got, expected := l.value(now), float64(time.Second)/math.E; math.Abs(got-expected) > 1 {
+		t.Errorf("Expected latency decayed to %v, got %v", expected, got)
+	}
+
+	// a faster response counts gradually
+	l.observe(0)
+	if got := l.value(time.Now()); got <= 0 || got >= float64(time.Second)/math.E {
+		t.Errorf("Expected latency between 0 and the decayed average, got %v", got)
+	}
+}
+
+func TestLeastLatencyProxy(t *testing.T) {
+	var slowHits int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&slowHits, 1)
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fast.Close()
+
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+		strings.NewReader("proxy / "+slow.URL+" "+fast.URL+" {\n policy least_latency \n}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{Next: httpserver.EmptyNext, Upstreams: upstreams}
+	for i := 0; i < 10; i++ {
+		p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	if hits := atomic.LoadInt32(&slowHits); hits != 1 {
+		t.Errorf("Expected the slow host to be measured once and then avoided, got %d requests", hits)
+	}
+}
+
 func TestCustomPolicy(t *testing.T) {
 	pool := testPool()
 	customPolicy := &customPolicy{}
@@ -226,3 +351,51 @@ func TestIPHashPolicy(t *testing.T) {
 		t.Error("Expected ip hash policy host to be nil.")
 	}
 }
+
+func TestAttributeHashPolicies(t *testing.T) {
+	pool := testPool()
+	for _, policy := range []struct {
+		Policy
+		set func(r *http.Request, value string)
+	}{
+		{&HeaderHash{Name: "X-Tenant-ID"}, func(r *http.Request, value string) {
+			r.Header.Set("X-Tenant-ID", value)
+		}},
+		{&CookieHash{Name: "session_id"}, func(r *http.Request, value string) {
+			r.AddCookie(&http.Cookie{Name: "session_id", Value: value})
+		}},
+	} {
+		request := func(value string) *http.Request {
+			r, _ := http.NewRequest("GET", "/", nil)
+			if value != "" {
+				policy.set(r, value)
+			}
+			return r
+		}
+
+		// the same value goes to the same host
+		for _, value := range []string{"tenant-a", "tenant-b", "tenant-c"} {
+			h := policy.Select(pool, request(value))
+			for i := 0; i < 5; i++ {
+				if other := policy.Select(pool, request(value)); other != h {
+					t.Errorf("%T: Expected %s to stay on %s, got %s", policy.Policy, value, h.Name, other.Name)
+				}
+			}
+			// and elsewhere when its host is down
+			h.Unhealthy = true
+			if other := policy.Select(pool, request(value)); other == h || other == nil {
+				t.Errorf("%T: Expected %s to move to another host", policy.Policy, value)
+			}
+			h.Unhealthy = false
+		}
+
+		// requests without the value are balanced round robin
+		first := policy.Select(pool, request(""))
+		second := policy.Select(pool, request(""))
+		third := policy.Select(pool, request(""))
+		if first == second || second == third || first == third {
+			t.Errorf("%T: Expected round robin without the value, got %s, %s and %s",
+				policy.Policy, first.Name, second.Name, third.Name)
+		}
+	}
+}
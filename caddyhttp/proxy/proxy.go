@@ -41,6 +41,99 @@ type Upstream interface {
 	GetTryInterval() time.Duration
 }
 
+// responseUpdater is implemented by upstreams that need to see
+// or change the responses of their hosts, for example to learn
+// which host started a session.
+type responseUpdater interface {
+	// updateResponse returns a respUpdateFn for the response
+	// to r from host, which calls next, if not nil.
+	updateResponse(r *http.Request, host *UpstreamHost, next respUpdateFn) respUpdateFn
+}
+
+// hostObserver is implemented by upstreams that watch
+// how their hosts respond.
+type hostObserver interface {
+	// observe records a response from host, which failed
+	// if there was none or if it was a server error, and
+	// the latency until its header was received.
+	observe(host *UpstreamHost, failed bool, latency time.Duration)
+}
+
+// unavailableResponder is implemented by upstreams that respond
+// themselves when none of their hosts is available.
+type unavailableResponder interface {
+	// serveUnavailable writes the response to r, if
+	// the upstream has one, and returns whether it did.
+	serveUnavailable(w http.ResponseWriter, r *http.Request) bool
+}
+
+// retryBudgeter is implemented by upstreams that limit
+// how many of their requests may be retried.
+type retryBudgeter interface {
+	// countRequest records a request to the upstream.
+	countRequest()
+
+	// allowRetry returns whether a failed request may be
+	// retried, and counts the retry if so.
+	allowRetry() bool
+}
+
+// matchedUpstream is implemented by upstreams that may be
+// routed by a named matcher instead of by their base path.
+type matchedUpstream interface {
+	// Matcher returns the named matcher, or nil if
+	// requests are routed by the base path.
+	Matcher() httpserver.RequestMatcher
+}
+
+// requestCollapser is implemented by upstreams that
+// collapse identical concurrent requests into one.
+type requestCollapser interface {
+	// collapse calls proxy to serve r, unless the response
+	// to an identical request in flight is shared with r.
+	collapse(w http.ResponseWriter, r *http.Request, proxy func(http.ResponseWriter) (int, error)) (int, error)
+}
+
+// responseCacher is implemented by upstreams that
+// cache the responses of their hosts.
+type responseCacher interface {
+	// serveCached writes the cached response to r, if it is
+	// fresh, or calls proxy with the request to send upstream.
+	serveCached(w http.ResponseWriter, r *http.Request, proxy func(http.ResponseWriter, *http.Request) (int, error)) (int, error)
+}
+
+// requestMirror is implemented by upstreams that
+// copy their requests to a shadow host.
+type requestMirror interface {
+	// mirror sends a copy of outreq, with body, without
+	// waiting for the response, which is discarded.
+	mirror(outreq *http.Request, body []byte)
+}
+
+// localFileServer is implemented by upstreams whose
+// requests are served from the files of the site, by
+// the next handlers, if they are for a file there.
+type localFileServer interface {
+	// servesLocally returns whether r is for a file of the site.
+	servesLocally(r *http.Request) bool
+}
+
+// controlHeaderer is implemented by upstreams that are
+// controlled by request headers meant only for the proxy.
+type controlHeaderer interface {
+	// controlHeaders returns the names of the request
+	// headers that are not sent to the hosts.
+	controlHeaders() []string
+}
+
+// connReleaser is implemented by upstreams that
+// need to know when a connection to a host ends.
+type connReleaser interface {
+	// releaseConn is called after a request to host
+	// has been served, successfully or not.
+	releaseConn(host *UpstreamHost)
+}
+
 // UpstreamHostDownFunc can be used to customize how Down behaves.
 type UpstreamHostDownFunc func(*UpstreamHost) bool
 
@@ -48,6 +141,8 @@ type UpstreamHostDownFunc func(*UpstreamHost) bool
 type UpstreamHost struct {
 	Conns             int64 // must be first field to be 64-bit aligned on 32-bit systems
 	MaxConns          int64
+	saturatedUntil    int64  // UnixNano; must be 64-bit aligned on 32-bit systems
+	recoveredAt       int64  // UnixNano; must be 64-bit aligned on 32-bit systems
 	Name              string // hostname of this upstream host
 	UpstreamHeaders   http.Header
 	DownstreamHeaders http.Header
@@ -57,12 +152,21 @@ type UpstreamHost struct {
 	ReverseProxy      *ReverseProxy
 	Fails             int32
 	Unhealthy         bool
+	Weight            int           // share of requests relative to other hosts; 1 if unset
+	Backup            bool          // receives requests only when no other host is available
+	SlowStart         time.Duration // how long its share of requests grows for after it recovers
+	wasDown           int32
+	latency           hostLatency
 }
 
 // Down checks whether the upstream host is down or not.
+// A health override of the host takes precedence; otherwise
 // Down will try to use uh.CheckDown first, and will fall
 // back to some default criteria if necessary.
 func (uh *UpstreamHost) Down() bool {
+	if healthy, ok := healthOverride(uh.Name); ok {
+		return !healthy
+	}
 	if uh.CheckDown == nil {
 		// Default settings
 		return uh.Unhealthy || uh.Fails > 0
@@ -70,14 +174,25 @@ func (uh *UpstreamHost) Down() bool {
 	return uh.CheckDown(uh)
 }
 
+// weight returns the weight of the host, which
+// is 1 for hosts that were not given one.
+func (uh *UpstreamHost) weight() int {
+	if uh.Weight < 1 {
+		return 1
+	}
+	return uh.Weight
+}
+
 // Full checks whether the upstream host has reached its maximum connections
 func (uh *UpstreamHost) Full() bool {
-	return uh.MaxConns > 0 && uh.Conns >= uh.MaxConns
+	return uh.MaxConns > 0 && atomic.LoadInt64(&uh.Conns) >= uh.MaxConns
 }
 
 // Available checks whether the upstream host is available for proxying to
 func (uh *UpstreamHost) Available() bool {
-	return !uh.Down() && !uh.Full()
+	down := uh.Down()
+	uh.noteHealth(down)
+	return !down && !uh.Full() && !uh.Saturated()
 }
 
 // ServeHTTP satisfies the httpserver.Handler interface.
@@ -87,12 +202,43 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	if upstream == nil {
 		return p.Next.ServeHTTP(w, r)
 	}
+	if lf, ok := upstream.(localFileServer); ok && lf.servesLocally(r) {
+		return p.Next.ServeHTTP(w, r)
+	}
+
+	serve := p.proxy
+	if rc, ok := upstream.(requestCollapser); ok {
+		serve = func(w http.ResponseWriter, r *http.Request, upstream Upstream) (int, error) {
+			return rc.collapse(w, r, func(w http.ResponseWriter) (int, error) {
+				return p.proxy(w, r, upstream)
+			})
+		}
+	}
+	if rc, ok := upstream.(responseCacher); ok {
+		return rc.serveCached(w, r, func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return serve(w, r, upstream)
+		})
+	}
+	return serve(w, r, upstream)
+}
+
+// proxy sends r to a host of upstream, trying other
+// hosts if it fails, and writes the response to w.
+func (p Proxy) proxy(w http.ResponseWriter, r *http.Request, upstream Upstream) (int, error) {
+	budget, budgeted := upstream.(retryBudgeter)
+	if budgeted {
+		budget.countRequest()
+	}
 
 	// this replacer is used to fill in header field values
 	replacer := httpserver.NewReplacer(r, nil, "")
 
 	// outreq is the request that makes a roundtrip to the backend
-	outreq := createUpstreamRequest(r)
+	var controlHeaders []string
+	if ch, ok := upstream.(controlHeaderer); ok {
+		controlHeaders = ch.controlHeaders()
+	}
+	outreq := createUpstreamRequest(r, controlHeaders)
 
 	// record and replace outreq body
 	body, err := newBufferedBody(outreq.Body)
@@ -102,21 +248,38 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	if body != nil {
 		outreq.Body = body
 	}
+	if rm, ok := upstream.(requestMirror); ok && !requestIsWebsocket(r) {
+		rm.mirror(outreq, body.bytes())
+	}
 
 	// The keepRetrying function will return true if we should
 	// loop and try to select another host, or false if we
 	// should break and stop retrying.
 	start := time.Now()
-	keepRetrying := func() bool {
+	keepRetrying := func(backendFailed bool) bool {
 		// if we've tried long enough, break
 		if time.Since(start) >= upstream.GetTryDuration() {
 			return false
 		}
+		// if the retry budget is spent, fail fast rather
+		// than add to the load of struggling hosts
+		if backendFailed && budgeted && !budget.allowRetry() {
+			return false
+		}
 		// otherwise, wait and try the next available host
 		time.Sleep(upstream.GetTryInterval())
 		return true
 	}
 
+	// the response of a saturated host, written if no
+	// other host can take the request
+	var saturated *saturatedError
+	defer func() {
+		if saturated != nil {
+			saturated.res.Body.Close()
+		}
+	}()
+
 	var backendErr error
 	for {
 		// since Select() should give us "up" hosts, keep retrying
@@ -126,7 +289,7 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 			if backendErr == nil {
 				backendErr = errors.New("no hosts available upstream")
 			}
-			if !keepRetrying() {
+			if !keepRetrying(false) {
 				break
 			}
 			continue
@@ -134,6 +297,8 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 		if rr, ok := w.(*httpserver.ResponseRecorder); ok && rr.Replacer != nil {
 			rr.Replacer.Set("upstream", host.Name)
 		}
+		// also for the error log, which reads it from the request
+		httpserver.SetRequestPlaceholder(r, "upstream", host.Name)
 
 		proxy := host.ReverseProxy
 
@@ -172,16 +337,63 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 		if host.DownstreamHeaders != nil {
 			downHeaderUpdateFn = createRespHeaderUpdateFn(host.DownstreamHeaders, replacer)
 		}
+		if ru, ok := upstream.(responseUpdater); ok {
+			downHeaderUpdateFn = ru.updateResponse(r, host, downHeaderUpdateFn)
+		}
 
 		// rewind request body to its beginning
 		if err := body.rewind(); err != nil {
 			return http.StatusInternalServerError, errors.New("unable to rewind downstream request body")
 		}
 
+		// note the status and latency of the response for the
+		// host and upstreams that watch how their hosts respond
+		observer, observing := upstream.(hostObserver)
+		var status int
+		var latency time.Duration
+		sent := time.Now()
+		next := downHeaderUpdateFn
+		downHeaderUpdateFn = func(resp *http.Response) {
+			status, latency = resp.StatusCode, time.Since(sent)
+			httpserver.AddServerTiming(r, "upstream", "Upstream", latency)
+			if next != nil {
+				next(resp)
+			}
+		}
+
 		// tell the proxy to serve the request
 		atomic.AddInt64(&host.Conns, 1)
 		backendErr = proxy.ServeHTTP(w, outreq, downHeaderUpdateFn)
 		atomic.AddInt64(&host.Conns, -1)
+		if cr, ok := upstream.(connReleaser); ok {
+			cr.releaseConn(host)
+		}
+
+		// a saturated host has not failed, but is spared
+		// for a while, so the request can go elsewhere
+		if se, ok := backendErr.(*saturatedError); ok {
+			host.saturate(se.wait)
+			if saturated != nil {
+				saturated.res.Body.Close()
+			}
+			saturated = se
+			if !keepRetrying(false) {
+				break
+			}
+			continue
+		}
+
+		if status == 0 {
+			latency = time.Since(sent)
+		}
+		if backendErr != nil && latency < latencyFailurePenalty {
+			host.latency.observe(latencyFailurePenalty)
+		} else {
+			host.latency.observe(latency)
+		}
+		if observing {
+			observer.observe(host, backendErr != nil || status >= 500, latency)
+		}
 
 		// if no errors, we're done here
 		if backendErr == nil {
@@ -197,26 +409,48 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 		timeout := host.FailTimeout
 		if timeout > 0 {
 			atomic.AddInt32(&host.Fails, 1)
+			host.noteHealth(host.Down())
 			go func(host *UpstreamHost, timeout time.Duration) {
 				time.Sleep(timeout)
 				atomic.AddInt32(&host.Fails, -1)
+				host.noteHealth(host.Down())
 			}(host, timeout)
 		}
 
 		// if we've tried long enough, break
-		if !keepRetrying() {
+		if !keepRetrying(true) {
 			break
 		}
 	}
 
+	if saturated != nil {
+		saturated.write(w)
+		return 0, nil
+	}
+
+	// no host could respond, so nothing has been written yet
+	if ur, ok := upstream.(unavailableResponder); ok && !requestIsWebsocket(r) {
+		if ur.serveUnavailable(w, r) {
+			return 0, backendErr
+		}
+	}
+
 	return http.StatusBadGateway, backendErr
 }
 
 // match finds the best match for a proxy config based on r.
+// The first upstream routed by a named matcher that matches r
+// takes precedence over those routed by their base path.
 func (p Proxy) match(r *http.Request) Upstream {
 	var u Upstream
 	var longestMatch int
 	for _, upstream := range p.Upstreams {
+		if mu, ok := upstream.(matchedUpstream); ok && mu.Matcher() != nil {
+			if mu.Matcher().Match(r) {
+				return upstream
+			}
+			continue
+		}
 		basePath := upstream.From()
 		if !httpserver.Path(r.URL.Path).Matches(basePath) || !upstream.AllowedPath(r.URL.Path) {
 			continue
@@ -230,10 +464,11 @@ func (p Proxy) match(r *http.Request) Upstream {
 }
 
 // createUpstremRequest shallow-copies r into a new request
-// that can be sent upstream.
+// that can be sent upstream, without the hop-by-hop headers
+// and the given control headers of the proxy.
 //
 // Derived from reverseproxy.go in the standard Go httputil package.
-func createUpstreamRequest(r *http.Request) *http.Request {
+func createUpstreamRequest(r *http.Request, controlHeaders []string) *http.Request {
 	outreq := new(http.Request)
 	*outreq = *r // includes shallow copies of maps, but okay
 	// We should set body to nil explicitly if request body is empty.
@@ -249,11 +484,14 @@ func createUpstreamRequest(r *http.Request) *http.Request {
 
 	// Remove hop-by-hop headers to the backend. Especially
 	// important is "Connection" because we want a persistent
-	// connection, regardless of what the client sent to us. This
-	// is modifying the same underlying map from r (shallow
-	// copied above) so we only copy it if necessary.
+	// connection, regardless of what the client sent to us.
+	// Control headers are for the proxy only, so they are
+	// removed, too. This is modifying the same underlying map
+	// from r (shallow copied above) so we only copy it if
+	// necessary.
 	var copiedHeaders bool
-	for _, h := range hopHeaders {
+	removed := append(append([]string{}, hopHeaders...), controlHeaders...)
+	for _, h := range removed {
 		if outreq.Header.Get(h) != "" {
 			if !copiedHeaders {
 				outreq.Header = make(http.Header)
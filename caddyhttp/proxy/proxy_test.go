@@ -584,6 +584,106 @@ func newMultiHostTestProxy() *Proxy {
 	return p
 }
 
+func TestPreserveHeaderCase(t *testing.T) {
+	// a raw backend, as Go's server canonicalizes header names
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var head bytes.Buffer
+		br := bufio.NewReader(conn)
+		for {
+			line, err := br.ReadString('\n')
+			head.WriteString(line)
+			if err != nil || line == "\r\n" {
+				break
+			}
+		}
+		received <- head.String()
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nx-legacy-ID: 7\r\nContent-Length: 2\r\n\r\nok")
+	}()
+
+	upstream := newFakeUpstream("http://"+ln.Addr().String(), false)
+	upstream.host.ReverseProxy.HeaderCasing = map[string]string{
+		"Soapaction":  "SOAPAction",
+		"X-Legacy-Id": "x-legacy-ID",
+	}
+	p := &Proxy{Next: httpserver.EmptyNext, Upstreams: []Upstream{upstream}}
+
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("SOAPAction", "urn:Do")
+	r.Header.Set("X-Other", "1")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	var head string
+	select {
+	case head = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the upstream request")
+	}
+	if !strings.Contains(head, "\r\nSOAPAction: urn:Do\r\n") || !strings.Contains(head, "\r\nX-Other: 1\r\n") {
+		t.Errorf("Expected SOAPAction in its case and other headers canonical, got:\n%s", head)
+	}
+	if _, ok := r.Header["Soapaction"]; !ok {
+		t.Error("Expected downstream request header to be left alone")
+	}
+	if got := w.Header()["x-legacy-ID"]; len(got) != 1 || got[0] != "7" {
+		t.Errorf("Expected x-legacy-ID in its case downstream, got %v", w.Header())
+	}
+}
+
+func TestPreserveRequestURI(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RequestURI))
+	}))
+	defer backend.Close()
+
+	for i, test := range []struct {
+		target, without, requestURI, expected string
+	}{
+		{"", "", "/a%2Fb/c", "/a%2Fb/c"},
+		{"", "", "/a%2fb;v=1;x=%3B/c", "/a%2fb;v=1;x=%3B/c"},
+		{"", "", "/caf\xc3\xa9/%E2%82%AC", "/caf\xc3\xa9/%E2%82%AC"},
+		{"", "", "/a/../b/./c//d", "/a/../b/./c//d"},
+		{"", "", "/s?q=a+b%20c&r=%2F;x&&", "/s?q=a+b%20c&r=%2F;x&&"},
+		{"", "", "//double/slash", "http://{backend}//double/slash"},
+		{"", "", "/query?", "/query?"},
+		{"", "/api", "/api/a%2Fb?x=%41", "/a%2Fb?x=%41"},
+		{"/base/", "", "/a%2Fb?x", "/base/a%2Fb?x"},
+		{"/base?k=v", "", "/a;b?x", "/base/a;b?k=v&x"},
+		{"", "", "http://example.com/a%2Fb?x=1", "/a%2Fb?x=1"},
+		{"", "", "http://example.com/?x=1", "/?x=1"},
+	} {
+		uri, _ := url.Parse(backend.URL + test.target)
+		host := &UpstreamHost{Name: backend.URL, ReverseProxy: NewSingleHostReverseProxy(uri, test.without, http.DefaultMaxIdleConnsPerHost)}
+		host.ReverseProxy.PreserveRequestURI = true
+		p := &Proxy{
+			Next:      httpserver.EmptyNext,
+			Upstreams: []Upstream{&fakeUpstream{name: backend.URL, from: "/", host: host}},
+		}
+
+		r, err := http.ReadRequest(bufio.NewReader(strings.NewReader("GET " + test.requestURI + " HTTP/1.1\r\nHost: example.com\r\n\r\n")))
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		expected := strings.Replace(test.expected, "{backend}", uri.Host, 1)
+		if got := w.Body.String(); got != expected {
+			t.Errorf("Test %d: Expected backend to get %q, got %q", i, expected, got)
+		}
+	}
+}
+
 func TestMultiReverseProxyFromClient(t *testing.T) {
 	p := newMultiHostTestProxy()
 
@@ -1039,3 +1139,43 @@ func BenchmarkProxy(b *testing.B) {
 		p.ServeHTTP(w, r)
 	}
 }
+
+func TestProxyEarlyHints(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Del("Link")
+		w.Write([]byte("Hello, client"))
+	}))
+	defer backend.Close()
+
+	p := &Proxy{
+		Next:      httpserver.EmptyNext, // prevents panic in some cases when test fails
+		Upstreams: []Upstream{newFakeUpstream(backend.URL, false)},
+	}
+	for _, allowed := range []bool{true, false} {
+		var hints [][]string
+		r := httptest.NewRequest("GET", "/", nil)
+		if allowed {
+			r = httpserver.WithEarlyHints(r, func(links []string) {
+				hints = append(hints, links)
+			})
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+
+		if w.Body.String() != "Hello, client" {
+			t.Errorf("Expected final response, got %d %q", w.Code, w.Body.String())
+		}
+		if !allowed {
+			if len(hints) != 0 {
+				t.Errorf("Expected no hints to be passed on, got %v", hints)
+			}
+			continue
+		}
+		expected := [][]string{{"</style.css>; rel=preload; as=style"}}
+		if !reflect.DeepEqual(hints, expected) {
+			t.Errorf("Expected hints %v to be passed on, got %v", expected, hints)
+		}
+	}
+}
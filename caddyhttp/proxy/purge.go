@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Purge removes the entries of rc whose keys match, and
+// returns how many there were.
+func (rc *ResponseCache) Purge(match func(key string) bool) int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	var n int
+	for key, el := range rc.entries {
+		if match(key) {
+			rc.removeElement(el)
+			n++
+		}
+	}
+	return n
+}
+
+// PurgeTags removes the entries of rc that have one of the
+// surrogate keys tags, and returns how many there were.
+func (rc *ResponseCache) PurgeTags(tags ...string) int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	var n int
+	for _, tag := range tags {
+		for key := range rc.tagged[tag] {
+			if el, ok := rc.entries[key]; ok {
+				rc.removeElement(el)
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// PurgeAll removes all entries of rc.
+func (rc *ResponseCache) PurgeAll() int {
+	return rc.Purge(func(string) bool { return true })
+}
+
+// purgeURL returns a match for Purge of the response to u, which
+// is a URL, or a path with an optional query of any host.
+func purgeURL(u string) (func(string) bool, bool) {
+	host, uri, ok := splitPurgeURL(u)
+	if !ok {
+		return nil, false
+	}
+	return func(key string) bool {
+		h, reqURI := splitCacheKey(key)
+		return (host == "" || strings.EqualFold(h, host)) && reqURI == uri
+	}, true
+}
+
+// purgePrefix returns a match for Purge of the responses to
+// URLs under prefix, which is a URL or a path of any host.
+func purgePrefix(prefix string) (func(string) bool, bool) {
+	host, uri, ok := splitPurgeURL(prefix)
+	if !ok {
+		return nil, false
+	}
+	return func(key string) bool {
+		h, reqURI := splitCacheKey(key)
+		return (host == "" || strings.EqualFold(h, host)) && strings.HasPrefix(reqURI, uri)
+	}, true
+}
+
+// splitPurgeURL splits u into its host, if any, and the
+// request URI that is part of cache keys.
+func splitPurgeURL(u string) (host, uri string, ok bool) {
+	if strings.HasPrefix(u, "/") {
+		return "", u, true
+	}
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return "", "", false
+	}
+	return parsed.Host, parsed.RequestURI(), true
+}
+
+// splitCacheKey splits the key of a cache entry into
+// the host and request URI of the response.
+func splitCacheKey(key string) (host, uri string) {
+	if i := strings.Index(key, " "); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
+
+// surrogateKeys returns the surrogate keys, or cache tags,
+// that a response with header declares. Surrogate-Key
+// separates them by spaces, Cache-Tag by commas.
+func surrogateKeys(header http.Header) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, field := range surrogateKeyFields {
+		for _, value := range header[field] {
+			for _, tag := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+				if !seen[tag] {
+					seen[tag] = true
+					tags = append(tags, tag)
+				}
+			}
+		}
+	}
+	return tags
+}
+
+// surrogateKeyFields are the response header fields that
+// declare surrogate keys. They are meant for caches, so
+// the response cache removes them from responses.
+var surrogateKeyFields = []string{"Surrogate-Key", "Cache-Tag", "Cache-Tags"}
+
+// setSiteCaches records the response caches of the proxies
+// of the site at addr, so they can be purged through the
+// proxy_admin API of the site, and by cron jobs.
+func setSiteCaches(addr string, caches []*ResponseCache) {
+	siteCachesMu.Lock()
+	if siteCaches == nil {
+		siteCaches = make(map[string][]*ResponseCache)
+	}
+	siteCaches[addr] = caches
+	siteCachesMu.Unlock()
+
+	httpserver.RegisterCache("proxy responses of "+addr, func() {
+		for _, rc := range caches {
+			rc.PurgeAll()
+		}
+	})
+}
+
+// purgeSite removes the entries of the response caches of the
+// site at addr that have one of tags or whose keys match, which
+// may be nil, and returns how many there were.
+func purgeSite(addr string, tags []string, match func(string) bool) int {
+	siteCachesMu.Lock()
+	caches := siteCaches[addr]
+	siteCachesMu.Unlock()
+	var n int
+	for _, rc := range caches {
+		n += rc.PurgeTags(tags...)
+		if match != nil {
+			n += rc.Purge(match)
+		}
+	}
+	return n
+}
+
+var (
+	// siteCaches are the response caches of the
+	// proxies of each site, by site address
+	siteCaches   map[string][]*ResponseCache
+	siteCachesMu sync.Mutex
+)
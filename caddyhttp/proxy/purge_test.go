@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestAdminPurge(t *testing.T) {
+	rc := newResponseCache()
+	setSiteCaches("purge.example:80", []*ResponseCache{rc})
+	defer setSiteCaches("purge.example:80", nil)
+	fill := func() {
+		rc.PurgeAll()
+		for _, e := range []*cacheEntry{
+			{key: "purge.example /"},
+			{key: "purge.example /blog/a", tags: []string{"blog", "post-a"}},
+			{key: "purge.example /blog/b?page=2", tags: []string{"blog"}},
+			{key: "www.purge.example /blog/a", tags: []string{"post-a"}},
+		} {
+			rc.put(e)
+		}
+	}
+
+	admin := Admin{Next: httpserver.EmptyNext, Path: "/admin", AllowRemote: true, Token: "s3cret", Site: "purge.example:80"}
+	for i, test := range []struct {
+		target       string
+		token        string
+		expectStatus int
+		expectBody   string
+		expectLeft   int
+	}{
+		{"/admin/purge?url=/blog/a", "s3cret", 0, `{"purged":2}`, 2},
+		{"/admin/purge?url=http://www.purge.example/blog/a", "s3cret", 0, `{"purged":1}`, 3},
+		{"/admin/purge?url=/blog/b", "s3cret", 0, `{"purged":0}`, 4},
+		{"/admin/purge?prefix=/blog/", "s3cret", 0, `{"purged":3}`, 1},
+		{"/admin/purge?prefix=https://purge.example/blog", "s3cret", 0, `{"purged":2}`, 2},
+		{"/admin/purge?tag=post-a", "s3cret", 0, `{"purged":2}`, 2},
+		{"/admin/purge?tag=blog&url=/", "s3cret", 0, `{"purged":3}`, 1},
+		{"/admin/purge?url=*", "s3cret", 0, `{"purged":4}`, 0},
+		{"/admin/purge", "s3cret", 0, "url, prefix or tag is required", 4},
+		{"/admin/purge?url=blog", "s3cret", 0, "invalid url", 4},
+		{"/admin/purge?url=*", "wrong", http.StatusUnauthorized, "", 4},
+		{"/admin/purge?url=*", "", http.StatusUnauthorized, "", 4},
+	} {
+		fill()
+		r := httptest.NewRequest("POST", test.target, nil)
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+		status, err := admin.ServeHTTP(w, r)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if status != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if !strings.Contains(w.Body.String(), test.expectBody) {
+			t.Errorf("Test %d: Expected body to contain '%s', got '%s'", i, test.expectBody, w.Body.String())
+		}
+		if left := len(rc.entries); left != test.expectLeft {
+			t.Errorf("Test %d: Expected %d entries left, got %d", i, test.expectLeft, left)
+		}
+	}
+
+	// caches are purged with the others of the process
+	fill()
+	httpserver.PurgeCaches()
+	if len(rc.entries) != 0 {
+		t.Errorf("Expected cache to be purged, has %d entries", len(rc.entries))
+	}
+}
+
+func TestSurrogateKeys(t *testing.T) {
+	header := http.Header{"Surrogate-Key": {"a b", "c"}, "Cache-Tag": {"b,d, e"}}
+	if got := strings.Join(surrogateKeys(header), ","); got != "a,b,c,d,e" {
+		t.Errorf("Expected keys a,b,c,d,e, got %s", got)
+	}
+}
+
+func TestSurrogateKeyPurge(t *testing.T) {
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Surrogate-Key", "article-"+strings.TrimPrefix(r.URL.Path, "/")+" articles")
+		w.Write([]byte("Article " + r.URL.Path))
+	}))
+	defer backend.Close()
+
+	upstream := &staticUpstream{
+		from:   "/",
+		Hosts:  HostPool{{Name: backend.URL}},
+		Policy: &Random{},
+		Cache:  newResponseCache(),
+	}
+	setSiteCaches("keys.example:80", []*ResponseCache{upstream.Cache})
+	defer setSiteCaches("keys.example:80", nil)
+	p := &Proxy{Next: httpserver.EmptyNext, Upstreams: []Upstream{upstream}}
+	admin := Admin{Next: p, Path: "/admin", Site: "keys.example:80"}
+
+	get := func(path string) {
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Header().Get("Surrogate-Key") != "" {
+			t.Errorf("Expected surrogate keys not to be sent downstream, got '%s'", w.Header().Get("Surrogate-Key"))
+		}
+	}
+	purge := func(target string) {
+		r := httptest.NewRequest("POST", target, nil)
+		r.RemoteAddr = "127.0.0.1:1234"
+		admin.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	get("/1")
+	get("/2")
+	get("/1")
+	get("/2")
+	if got := atomic.LoadInt32(&hits); got != 2 {
+		t.Fatalf("Expected 2 requests to reach the backend, got %d", got)
+	}
+	purge("/admin/purge?tag=article-1")
+	get("/1")
+	get("/2")
+	if got := atomic.LoadInt32(&hits); got != 3 {
+		t.Errorf("Expected only the purged article to be fetched again, got %d requests", got)
+	}
+	purge("/admin/purge?tag=articles")
+	get("/1")
+	get("/2")
+	if got := atomic.LoadInt32(&hits); got != 5 {
+		t.Errorf("Expected all articles to be fetched again, got %d requests", got)
+	}
+	if n := len(upstream.Cache.tagged["articles"]); n != 2 {
+		t.Errorf("Expected 2 entries tagged articles, got %d", n)
+	}
+}
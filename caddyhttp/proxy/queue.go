@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"container/list"
+	"expvar"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RequestQueue holds requests to an upstream whose hosts all have
+// their maximum number of connections, until a connection is freed.
+// Requests are released in the order they arrived.
+type RequestQueue struct {
+	// Most requests that may wait at once; further
+	// requests fail immediately
+	MaxLength int
+
+	// Longest a request may wait
+	Timeout time.Duration
+
+	name    string // for the queue length metric
+	mu      sync.Mutex
+	waiters list.List // of chan struct{}
+}
+
+// newRequestQueue returns a RequestQueue with default settings,
+// whose length is published as a metric under name.
+func newRequestQueue(name string) *RequestQueue {
+	publishQueueLengths.Do(func() {
+		expvar.Publish("ProxyQueueLength", queueLengths)
+	})
+	return &RequestQueue{
+		MaxLength: defaultQueueLength,
+		Timeout:   defaultQueueTimeout,
+		name:      name,
+	}
+}
+
+// wait queues r until it is released or deadline passes, and
+// returns whether it was released. Requests that were released
+// but could not get a connection are queued again in front. If
+// full returns false, which it is called to check with the queue
+// locked, r is not queued at all.
+func (q *RequestQueue) wait(r *http.Request, again bool, deadline time.Time, full func() bool) bool {
+	q.mu.Lock()
+	if !full() {
+		q.mu.Unlock()
+		return true
+	}
+	if !again && q.waiters.Len() >= q.MaxLength {
+		q.mu.Unlock()
+		return false
+	}
+	ready := make(chan struct{}, 1)
+	var e *list.Element
+	if again {
+		e = q.waiters.PushFront(ready)
+	} else {
+		e = q.waiters.PushBack(ready)
+	}
+	queueLengths.Add(q.name, 1)
+	q.mu.Unlock()
+
+	timer := time.NewTimer(deadline.Sub(time.Now()))
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return true
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case <-ready:
+		// released just now, so pass it on
+		q.releaseLocked()
+	default:
+		q.waiters.Remove(e)
+		queueLengths.Add(q.name, -1)
+	}
+	return false
+}
+
+// release lets the first queued request try to
+// get a connection, if any request is queued.
+func (q *RequestQueue) release() {
+	q.mu.Lock()
+	q.releaseLocked()
+	q.mu.Unlock()
+}
+
+// releaseLocked is release with q.mu locked.
+func (q *RequestQueue) releaseLocked() {
+	if e := q.waiters.Front(); e != nil {
+		q.waiters.Remove(e)
+		queueLengths.Add(q.name, -1)
+		e.Value.(chan struct{}) <- struct{}{}
+	}
+}
+
+// Len returns the number of queued requests.
+func (q *RequestQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiters.Len()
+}
+
+var (
+	// queueLengths are the lengths of the request
+	// queues, by the path of their upstreams.
+	queueLengths        = new(expvar.Map).Init()
+	publishQueueLengths sync.Once
+)
+
+const (
+	defaultQueueLength  = 100
+	defaultQueueTimeout = 10 * time.Second
+)
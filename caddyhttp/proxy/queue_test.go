@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestParseQueue(t *testing.T) {
+	tests := []struct {
+		config         string
+		shouldErr      bool
+		expectedLength int
+		expectedTime   time.Duration
+	}{
+		{"proxy / a b {\n max_conns 10 \n queue \n}", false, defaultQueueLength, defaultQueueTimeout},
+		{"proxy / a b {\n queue 50 1m \n max_conns 10 \n}", false, 50, time.Minute},
+		{"proxy / a b {\n queue \n}", true, 0, 0},
+		{"proxy / a b {\n max_conns 10 \n queue 0 \n}", true, 0, 0},
+		{"proxy / a b {\n max_conns 10 \n queue 5 0s \n}", true, 0, 0},
+		{"proxy / a b {\n max_conns 10 \n queue 5 1s extra \n}", true, 0, 0},
+	}
+
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		q := upstreams[0].(*staticUpstream).Queue
+		if q == nil || q.MaxLength != test.expectedLength || q.Timeout != test.expectedTime || q.name != "/" {
+			t.Errorf("Test %d: Expected queue of %d for %v, got %+v", i, test.expectedLength, test.expectedTime, q)
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	unblock := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		w.Write([]byte("Hello"))
+	}))
+	defer backend.Close()
+
+	upstream := &staticUpstream{
+		from:  "/queued",
+		Hosts: HostPool{{Name: backend.URL, MaxConns: 1}},
+		Queue: newRequestQueue("/queued"),
+	}
+	upstream.Queue.MaxLength = 1
+	p := &Proxy{Next: httpserver.EmptyNext, Upstreams: []Upstream{upstream}}
+
+	serve := func(codes chan<- int) {
+		w := httptest.NewRecorder()
+		status, _ := p.ServeHTTP(w, httptest.NewRequest("GET", "/queued", nil))
+		if status == 0 {
+			status = w.Code
+		}
+		codes <- status
+	}
+	waitFor := func(what string, cond func() bool) {
+		for start := time.Now(); !cond(); time.Sleep(time.Millisecond) {
+			if time.Since(start) > 5*time.Second {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+		}
+	}
+
+	// the first request takes the only connection,
+	// and the second waits for it
+	first, second := make(chan int, 1), make(chan int, 1)
+	go serve(first)
+	waitFor("the first request", func() bool { return upstream.Hosts[0].Full() })
+	go serve(second)
+	waitFor("the second request to be queued", func() bool { return upstream.Queue.Len() == 1 })
+	if v := queueLengths.Get("/queued"); v == nil || v.String() != "1" {
+		t.Errorf("Expected queue length metric of 1, got %v", v)
+	}
+
+	// the queue is full, so the third request fails at once
+	third := make(chan int, 1)
+	serve(third)
+	if status := <-third; status != http.StatusBadGateway {
+		t.Errorf("Expected status %d with a full queue, got %d", http.StatusBadGateway, status)
+	}
+
+	// when the first request is done, the second is served
+	close(unblock)
+	for i, codes := range []chan int{first, second} {
+		select {
+		case status := <-codes:
+			if status != http.StatusOK {
+				t.Errorf("Request %d: Expected status %d, got %d", i, http.StatusOK, status)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Request %d: Timed out", i)
+		}
+	}
+	if v := queueLengths.Get("/queued"); v.String() != "0" {
+		t.Errorf("Expected queue length metric of 0, got %v", v)
+	}
+}
+
+func TestQueueTimeout(t *testing.T) {
+	upstream := &staticUpstream{
+		from:  "/",
+		Hosts: HostPool{{Name: "http://localhost:1", MaxConns: 1, Conns: 1}},
+		Queue: newRequestQueue("/"),
+	}
+	upstream.Queue.Timeout = 50 * time.Millisecond
+
+	start := time.Now()
+	if host := upstream.Select(httptest.NewRequest("GET", "/", nil)); host != nil {
+		t.Errorf("Expected no host, got %s", host.Name)
+	}
+	if waited := time.Since(start); waited < upstream.Queue.Timeout {
+		t.Errorf("Expected to wait for %v, waited %v", upstream.Queue.Timeout, waited)
+	}
+	if n := upstream.Queue.Len(); n != 0 {
+		t.Errorf("Expected empty queue after timeout, got %d", n)
+	}
+
+	// hosts that are down are not waited for
+	upstream.Hosts[0].Unhealthy = true
+	start = time.Now()
+	upstream.Select(httptest.NewRequest("GET", "/", nil))
+	if waited := time.Since(start); waited >= upstream.Queue.Timeout {
+		t.Errorf("Expected not to wait for hosts that are down, waited %v", waited)
+	}
+}
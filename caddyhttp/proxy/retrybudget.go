@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// RetryBudget limits the retries made to the hosts of a pool to a
+// share of the requests over a sliding window, so that retries do
+// not multiply the load on hosts that are already overloaded. When
+// the budget is spent, requests fail instead of being retried.
+type RetryBudget struct {
+	// Retries allowed, as a percentage of the
+	// requests within the window
+	Percent int
+
+	// How far back requests and retries count
+	Window time.Duration
+
+	// Retries allowed within the window regardless
+	// of Percent, so that a pool with little traffic
+	// may still retry
+	MinRetries int
+
+	mu      sync.Mutex
+	buckets [retryBudgetBuckets]retryBucket
+}
+
+// retryBucket counts the requests and retries within
+// one slice of the window.
+type retryBucket struct {
+	slot     int64 // number of the slice since the epoch
+	requests int
+	retries  int
+}
+
+// request records a request made to the pool at now.
+func (b *RetryBudget) request(now time.Time) {
+	b.mu.Lock()
+	b.bucket(now).requests++
+	b.mu.Unlock()
+}
+
+// allowRetry returns whether a retry may be made at now,
+// and records it if so.
+func (b *RetryBudget) allowRetry(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current := b.bucket(now)
+	var requests, retries int
+	for _, bk := range b.buckets {
+		if bk.slot > current.slot-retryBudgetBuckets {
+			requests += bk.requests
+			retries += bk.retries
+		}
+	}
+	if retries >= b.MinRetries && (retries+1)*100 > requests*b.Percent {
+		return false
+	}
+	current.retries++
+	return true
+}
+
+// bucket returns the bucket of now, emptying it if it
+// last counted an earlier slice. b.mu must be locked.
+func (b *RetryBudget) bucket(now time.Time) *retryBucket {
+	width := int64(b.Window / retryBudgetBuckets)
+	if width < 1 {
+		width = 1
+	}
+	slot := now.UnixNano() / width
+	bk := &b.buckets[slot%retryBudgetBuckets]
+	if bk.slot != slot {
+		*bk = retryBucket{slot: slot}
+	}
+	return bk
+}
+
+const (
+	// retryBudgetBuckets is how many slices the window
+	// is divided into; the window slides by one slice
+	// at a time.
+	retryBudgetBuckets = 10
+
+	defaultRetryBudgetWindow     = 10 * time.Second
+	defaultRetryBudgetMinRetries = 10
+)
@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestParseRetryBudget(t *testing.T) {
+	tests := []struct {
+		config    string
+		shouldErr bool
+		expected  *RetryBudget
+	}{
+		{"proxy / a b {\n retry_budget 20% \n}", false,
+			&RetryBudget{Percent: 20, Window: defaultRetryBudgetWindow, MinRetries: defaultRetryBudgetMinRetries}},
+		{"proxy / a b {\n retry_budget 5 1m 0 \n}", false,
+			&RetryBudget{Percent: 5, Window: time.Minute, MinRetries: 0}},
+		{"proxy / a b {\n retry_budget \n}", true, nil},
+		{"proxy / a b {\n retry_budget lots \n}", true, nil},
+		{"proxy / a b {\n retry_budget 20% 0s \n}", true, nil},
+		{"proxy / a b {\n retry_budget 20% 10s -1 \n}", true, nil},
+		{"proxy / a b {\n retry_budget 20% 10s 1 extra \n}", true, nil},
+	}
+
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		b := upstreams[0].(*staticUpstream).RetryBudget
+		if b == nil || b.Percent != test.expected.Percent || b.Window != test.expected.Window ||
+			b.MinRetries != test.expected.MinRetries {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, b)
+		}
+	}
+}
+
+func TestRetryBudgetWindow(t *testing.T) {
+	b := &RetryBudget{Percent: 20, Window: 10 * time.Second, MinRetries: 2}
+	now := time.Unix(1000, 0)
+
+	// the minimum is allowed without any requests
+	for i := 0; i < 2; i++ {
+		if !b.allowRetry(now) {
+			t.Fatalf("Expected minimum retry %d to be allowed", i)
+		}
+	}
+	if b.allowRetry(now) {
+		t.Fatal("Expected retry beyond the minimum to be denied")
+	}
+
+	// 20 requests pay for 4 retries, 2 of which are spent
+	for i := 0; i < 20; i++ {
+		b.request(now.Add(time.Second))
+	}
+	for i := 0; i < 2; i++ {
+		if !b.allowRetry(now.Add(time.Second)) {
+			t.Fatalf("Expected retry %d within the budget to be allowed", i)
+		}
+	}
+	if b.allowRetry(now.Add(time.Second)) {
+		t.Fatal("Expected retry beyond the budget to be denied")
+	}
+
+	// once the first retries slide out of the window,
+	// only the requests and retries after them count
+	later := now.Add(10 * time.Second)
+	if !b.allowRetry(later) || !b.allowRetry(later) {
+		t.Error("Expected retries to be allowed once earlier retries left the window")
+	}
+	if b.allowRetry(later) {
+		t.Error("Expected retry beyond the budget to be denied")
+	}
+
+	// after a whole window, only the minimum is left
+	later = now.Add(time.Minute)
+	if !b.allowRetry(later) || !b.allowRetry(later) || b.allowRetry(later) {
+		t.Error("Expected only the minimum retries after a quiet window")
+	}
+}
+
+func TestRetryBudgetFailsFast(t *testing.T) {
+	var attempts int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		// close the connection so that the attempt fails
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer backend.Close()
+
+	upstream := &staticUpstream{
+		from:        "/",
+		Hosts:       HostPool{{Name: backend.URL}},
+		TryDuration: time.Second,
+		RetryBudget: &RetryBudget{Percent: 0, Window: time.Minute, MinRetries: 1},
+	}
+	p := &Proxy{Next: httpserver.EmptyNext, Upstreams: []Upstream{upstream}}
+
+	start := time.Now()
+	status, err := p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if status != http.StatusBadGateway || err == nil {
+		t.Errorf("Expected status %d with an error, got %d and %v", http.StatusBadGateway, status, err)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Errorf("Expected the first attempt and one retry, got %d attempts", n)
+	}
+	if time.Since(start) >= upstream.TryDuration {
+		t.Error("Expected to fail before the try duration")
+	}
+}
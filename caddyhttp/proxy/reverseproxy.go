@@ -12,10 +12,13 @@
 package proxy
 
 import (
+	"bytes"
 	"crypto/tls"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
 	"net/url"
 	"path"
 	"strings"
@@ -54,6 +57,38 @@ type ReverseProxy struct {
 	// response body.
 	// If zero, no periodic flushing is done.
 	FlushInterval time.Duration
+
+	// HeaderCasing maps canonical header names to the
+	// case they are sent in, both upstream and back
+	// downstream, for backends that match header
+	// names case-sensitively.
+	HeaderCasing map[string]string
+
+	// PreserveRequestURI makes the path and query go to
+	// the backend exactly as the client sent them,
+	// without cleaning, decoding or re-encoding.
+	PreserveRequestURI bool
+
+	// DecodeResponses makes responses encoded with gzip or
+	// deflate decoded for clients that did not offer the
+	// encoding, or for all clients if DecodeAlways is set,
+	// such as for middleware that rewrites their bodies.
+	DecodeResponses bool
+	DecodeAlways    bool
+
+	// WebSocket, if set, inspects the messages of
+	// upgraded WebSocket connections.
+	WebSocket *WebSocketInspection
+
+	// MaxRetryAfter, if positive, makes 429 and 503 responses
+	// with a Retry-After header returned as a *saturatedError,
+	// not written, so the request can go to another host; the
+	// host is to be spared for the time asked, up to this.
+	MaxRetryAfter time.Duration
+
+	target  *url.URL
+	without string
+	conns   *connCounters
 }
 
 // Though the relevant directive prefix is just "unix:", url.Parse
@@ -123,7 +158,7 @@ func NewSingleHostReverseProxy(target *url.URL, without string, keepalive int) *
 			req.URL.RawQuery = targetQuery + "&" + req.URL.RawQuery
 		}
 	}
-	rp := &ReverseProxy{Director: director, FlushInterval: 250 * time.Millisecond} // flushing good for streaming & server-sent events
+	rp := &ReverseProxy{Director: director, FlushInterval: 250 * time.Millisecond, target: target, without: without} // flushing good for streaming & server-sent events
 	if target.Scheme == "unix" {
 		rp.Transport = &http.Transport{
 			Dial: socketDial(target.String()),
@@ -169,6 +204,20 @@ func (rp *ReverseProxy) UseInsecureTransport() {
 	}
 }
 
+// forwardEarlyHints returns a copy of req that passes on
+// the early hints of the upstream to the client.
+func forwardEarlyHints(req *http.Request) *http.Request {
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code == http.StatusEarlyHints {
+				httpserver.SendEarlyHints(req, header["Link"])
+			}
+			return nil
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
 // ServeHTTP serves the proxied request to the upstream by performing a roundtrip.
 // It is designed to handle websocket connection upgrades as well.
 func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, outreq *http.Request, respUpdateFn respUpdateFn) error {
@@ -180,15 +229,42 @@ func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, outreq *http.Request,
 	}
 
 	rp.Director(outreq)
+	if rp.PreserveRequestURI && rp.target != nil {
+		preserveRequestURI(outreq, rp.target, rp.without)
+	}
+	if rp.conns != nil {
+		outreq = rp.traceConns(outreq)
+	}
+	if httpserver.EarlyHintsAllowed(outreq) {
+		outreq = forwardEarlyHints(outreq)
+	}
 	outreq.Proto = "HTTP/1.1"
 	outreq.ProtoMajor = 1
 	outreq.ProtoMinor = 1
 	outreq.Close = false
+	if len(rp.HeaderCasing) > 0 {
+		// the header may be shared with the downstream request
+		header := make(http.Header)
+		copyHeader(header, outreq.Header)
+		recaseHeader(header, rp.HeaderCasing)
+		outreq.Header = header
+	}
 
 	res, err := transport.RoundTrip(outreq)
 	if err != nil {
 		return err
 	}
+	if rp.DecodeResponses && res.StatusCode != http.StatusSwitchingProtocols {
+		if err := decodeResponse(outreq, res, rp.DecodeAlways); err != nil {
+			return err
+		}
+	}
+
+	if rp.MaxRetryAfter > 0 {
+		if wait, ok := retryAfter(res, rp.MaxRetryAfter); ok {
+			return &saturatedError{rp: rp, res: res, update: respUpdateFn, wait: wait}
+		}
+	}
 
 	if respUpdateFn != nil {
 		respUpdateFn(res)
@@ -207,9 +283,14 @@ func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, outreq *http.Request,
 		defer conn.Close()
 
 		var backendConn net.Conn
+		var fromBackend io.Reader
 		if hj, ok := transport.(*connHijackerTransport); ok {
 			backendConn = hj.Conn
-			if _, err := conn.Write(hj.Replay); err != nil {
+			if rp.WebSocket != nil {
+				// the response is replayed through the inspection
+				replay := append([]byte(nil), hj.Replay...)
+				fromBackend = io.MultiReader(bytes.NewReader(replay), backendConn)
+			} else if _, err := conn.Write(hj.Replay); err != nil {
 				return err
 			}
 			bufferPool.Put(hj.Replay)
@@ -222,23 +303,36 @@ func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, outreq *http.Request,
 		}
 		defer backendConn.Close()
 
+		if rp.WebSocket != nil {
+			if fromBackend == nil {
+				fromBackend = backendConn
+			}
+			rp.WebSocket.proxy(outreq, conn, backendConn, fromBackend)
+			return nil
+		}
 		go func() {
 			io.Copy(backendConn, conn) // write tcp stream to backend.
 		}()
 		io.Copy(conn, backendConn) // read tcp stream from backend.
 	} else {
-		defer res.Body.Close()
-		for _, h := range hopHeaders {
-			res.Header.Del(h)
-		}
-		copyHeader(rw.Header(), res.Header)
-		rw.WriteHeader(res.StatusCode)
-		rp.copyResponse(rw, res.Body)
+		rp.writeResponse(rw, res)
 	}
 
 	return nil
 }
 
+// writeResponse writes res, which is closed, to rw.
+func (rp *ReverseProxy) writeResponse(rw http.ResponseWriter, res *http.Response) {
+	defer res.Body.Close()
+	for _, h := range hopHeaders {
+		res.Header.Del(h)
+	}
+	copyHeader(rw.Header(), res.Header)
+	recaseHeader(rw.Header(), rp.HeaderCasing)
+	rw.WriteHeader(res.StatusCode)
+	rp.copyResponse(rw, res.Body)
+}
+
 func (rp *ReverseProxy) copyResponse(dst io.Writer, src io.Reader) {
 	buf := bufferPool.Get()
 	defer bufferPool.Put(buf)
@@ -269,6 +363,62 @@ var skipHeaders = map[string]struct{}{
 	"Expires":             {},
 }
 
+// preserveRequestURI sets the URL of req, on its way to target,
+// to the request-URI its client sent, byte for byte, less the
+// without prefix and under the path of target.
+func preserveRequestURI(req *http.Request, target *url.URL, without string) {
+	raw := req.RequestURI
+	if !strings.HasPrefix(raw, "/") {
+		// absolute-form; the path begins after the authority
+		i := strings.Index(raw, "://")
+		if i < 0 {
+			return // asterisk-form, or not from a client
+		}
+		raw = raw[i+len("://"):]
+		if i = strings.IndexAny(raw, "/?"); i < 0 {
+			raw = "/"
+		} else {
+			raw = raw[i:]
+		}
+	}
+	rawPath, rawQuery := raw, ""
+	if i := strings.Index(raw, "?"); i >= 0 {
+		rawPath, rawQuery = raw[:i], raw[i+1:]
+	}
+	if without != "" {
+		rawPath = strings.TrimPrefix(rawPath, without)
+	}
+	if !strings.HasPrefix(rawPath, "/") {
+		rawPath = "/" + rawPath
+	}
+	if target.Scheme != "unix" {
+		rawPath = strings.TrimSuffix(target.EscapedPath(), "/") + rawPath
+	}
+	if strings.HasPrefix(rawPath, "//") {
+		// would otherwise be taken for an authority
+		req.URL.Opaque = "//" + req.URL.Host + rawPath
+	} else {
+		req.URL.Opaque = rawPath
+	}
+	if target.RawQuery == "" || rawQuery == "" {
+		req.URL.RawQuery = target.RawQuery + rawQuery
+	} else {
+		req.URL.RawQuery = target.RawQuery + "&" + rawQuery
+	}
+}
+
+// recaseHeader renames the fields of h in casing to the case
+// given there. Go writes header names as they are in the map,
+// but they can then only be looked up in h directly.
+func recaseHeader(h http.Header, casing map[string]string) {
+	for canonical, name := range casing {
+		if vv, ok := h[canonical]; ok && name != canonical {
+			delete(h, canonical)
+			h[name] = vv
+		}
+	}
+}
+
 func copyHeader(dst, src http.Header) {
 	for k, vv := range src {
 		if _, ok := dst[k]; ok {
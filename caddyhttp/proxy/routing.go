@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Routing sends requests to named pools of hosts: those that
+// match the condition of a rule, such as gRPC requests to a pool
+// that speaks gRPC, and shares of the others by rules that may
+// hold only at certain times of day, such as for a pool that
+// takes batch jobs only at night. Other requests go to the hosts
+// in no pool.
+type Routing struct {
+	// Rules are the shares of requests sent to pools
+	Rules []*RoutingRule
+
+	// The time zone of the times of day of the rules
+	Location *time.Location
+
+	pools       map[string][]string // host names by pool, until the hosts exist
+	poolNames   []string
+	defaultPool HostPool
+}
+
+// RoutingRule sends a share of the requests, or the requests
+// that match a condition, to a pool.
+type RoutingRule struct {
+	// The name of the pool
+	Pool string
+
+	// When, if not nil, is the condition of the requests
+	// that all go to the pool, whatever the time of day;
+	// then Percent does not apply
+	When httpserver.RequestMatcher
+
+	// The percentage of requests sent to the pool
+	Percent float64
+
+	// From and To are the times of day, as durations since
+	// midnight, between which the rule holds; if they are
+	// equal, it always does. To may be before From, for
+	// times that span midnight.
+	From, To time.Duration
+
+	hosts      HostPool
+	matcherRef string // named matcher of When, until it is resolved
+}
+
+func newRouting() *Routing {
+	return &Routing{
+		Location: time.Local,
+		pools:    make(map[string][]string),
+	}
+}
+
+// addPool adds the pool name of hosts.
+func (rt *Routing) addPool(name string, hosts []string) error {
+	if _, ok := rt.pools[name]; ok {
+		return fmt.Errorf("pool '%s' already defined", name)
+	}
+	rt.pools[name] = hosts
+	rt.poolNames = append(rt.poolNames, name)
+	return nil
+}
+
+// newHosts creates the hosts of the pools with newHost, and
+// returns them, so they can be health checked; defaultPool
+// is where the requests no rule takes go.
+func (rt *Routing) newHosts(defaultPool HostPool, newHost func(string) (*UpstreamHost, error)) (HostPool, error) {
+	rt.defaultPool = defaultPool
+	pools := make(map[string]HostPool)
+	var all HostPool
+	for _, name := range rt.poolNames {
+		for _, host := range rt.pools[name] {
+			uh, err := newHost(host)
+			if err != nil {
+				return nil, err
+			}
+			pools[name] = append(pools[name], uh)
+			all = append(all, uh)
+		}
+	}
+	routed := make(map[string]bool)
+	for _, rule := range rt.Rules {
+		hosts, ok := pools[rule.Pool]
+		if !ok {
+			return nil, fmt.Errorf("route to unknown pool '%s'", rule.Pool)
+		}
+		rule.hosts = hosts
+		routed[rule.Pool] = true
+	}
+	for _, name := range rt.poolNames {
+		if !routed[name] {
+			return nil, fmt.Errorf("pool '%s' has no route", name)
+		}
+	}
+	return all, nil
+}
+
+// pool returns the hosts r at now may go to. The first rule
+// whose condition r matches takes it, even if none of the hosts
+// of its pool is available, since others may not be able to
+// serve it. Then the rules without a condition that hold take
+// their shares in turn; a pool none of whose hosts is available
+// leaves its share to the hosts in no pool.
+func (rt *Routing) pool(r *http.Request, now time.Time) HostPool {
+	for _, rule := range rt.Rules {
+		if rule.When != nil && rule.When.Match(r) {
+			return rule.hosts
+		}
+	}
+
+	now = now.In(rt.Location)
+	roll := rand.Float64() * 100
+	var share float64
+	for _, rule := range rt.Rules {
+		if rule.When != nil || !rule.holds(now) {
+			continue
+		}
+		if share += rule.Percent; roll < share {
+			for _, host := range rule.hosts {
+				if host.Available() {
+					return rule.hosts
+				}
+			}
+			break
+		}
+	}
+	return rt.defaultPool
+}
+
+// holds returns whether the rule holds at t.
+func (rr *RoutingRule) holds(t time.Time) bool {
+	if rr.From == rr.To {
+		return true
+	}
+	hour, min, sec := t.Clock()
+	sinceMidnight := time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute + time.Duration(sec)*time.Second
+	if rr.From < rr.To {
+		return sinceMidnight >= rr.From && sinceMidnight < rr.To
+	}
+	return sinceMidnight >= rr.From || sinceMidnight < rr.To
+}
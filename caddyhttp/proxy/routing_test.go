@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestRoutingRuleHolds(t *testing.T) {
+	at := func(clock string) time.Time {
+		t, _ := time.Parse("15:04", clock)
+		return t
+	}
+	for i, test := range []struct {
+		from, to, at string
+		expected     bool
+	}{
+		{"02:00", "06:00", "02:00", true},
+		{"02:00", "06:00", "05:59", true},
+		{"02:00", "06:00", "06:00", false},
+		{"02:00", "06:00", "12:00", false},
+		{"22:00", "02:00", "23:30", true},
+		{"22:00", "02:00", "01:00", true},
+		{"22:00", "02:00", "03:00", false},
+		{"00:00", "00:00", "15:00", true},
+	} {
+		from, _ := httpserver.ParseTimeOfDay(test.from)
+		to, _ := httpserver.ParseTimeOfDay(test.to)
+		rule := &RoutingRule{From: from, To: to}
+		if got := rule.holds(at(test.at)); got != test.expected {
+			t.Errorf("Test %d: Expected %s-%s to hold at %s: %v, got %v", i, test.from, test.to, test.at, test.expected, got)
+		}
+	}
+}
+
+func TestRouting(t *testing.T) {
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(`proxy / main:80 {
+		pool batch batch1:80 batch2:80
+		pool canary canary:80
+		route batch 100% 02:00-06:00
+		route canary 30%
+		route_timezone UTC
+	}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := upstreams[0].(*staticUpstream)
+	if len(upstream.Hosts) != 4 {
+		t.Fatalf("Expected the hosts of the pools among the hosts, got %d", len(upstream.Hosts))
+	}
+	main, batch1, canary := upstream.Hosts[0], upstream.Hosts[1], upstream.Hosts[3]
+	rt := upstream.Routing
+
+	// in another time zone, 04:00 UTC is not at night
+	night := time.Date(2017, 6, 1, 6, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+	for i := 0; i < 20; i++ {
+		if pool := rt.pool(nil, night); len(pool) != 2 || pool[0] != batch1 {
+			t.Fatalf("Expected the batch pool at night, got %v", pool)
+		}
+	}
+
+	day := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	toCanary := 0
+	for i := 0; i < 1000; i++ {
+		switch pool := rt.pool(nil, day); pool[0] {
+		case canary:
+			toCanary++
+		case main:
+		default:
+			t.Fatalf("Expected the canary or the other hosts by day, got %v", pool)
+		}
+	}
+	if toCanary < 200 || toCanary > 400 {
+		t.Errorf("Expected about 30%% of requests to the canary, got %d of 1000", toCanary)
+	}
+
+	// an unavailable pool leaves its share to the others
+	for _, host := range upstream.Hosts[1:3] {
+		host.Unhealthy = true
+	}
+	if pool := rt.pool(nil, night); pool[0] == batch1 {
+		t.Errorf("Expected the requests of an unavailable pool to go elsewhere")
+	}
+}
+
+func TestConditionalRouting(t *testing.T) {
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(`proxy / main:80 {
+		pool grpc grpc:80
+		pool v2 v2a:80 v2b:80
+		route_when grpc {>Content-Type} starts_with 'application/grpc'
+		route_when v2 {>X-API-Version} == 2 || {method} == 'PATCH'
+	}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := upstreams[0].(*staticUpstream)
+	main, grpc, v2 := upstream.Hosts[0], upstream.Hosts[1], upstream.Hosts[2]
+
+	for i, test := range []struct {
+		method, header, value string
+		expected              *UpstreamHost
+	}{
+		{"GET", "", "", main},
+		{"POST", "Content-Type", "application/grpc+proto", grpc},
+		{"POST", "Content-Type", "application/json", main},
+		{"GET", "X-API-Version", "2", v2},
+		{"GET", "X-API-Version", "1", main},
+		{"PATCH", "", "", v2},
+	} {
+		r := httptest.NewRequest(test.method, "/", nil)
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+		}
+		if pool := upstream.Routing.pool(r, time.Now()); pool[0] != test.expected {
+			t.Errorf("Test %d: Expected pool of %s, got %v", i, test.expected.Name, pool)
+		}
+	}
+
+	// matching requests do not go to hosts that may not serve them
+	grpc.Unhealthy = true
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Content-Type", "application/grpc")
+	if host := upstream.Select(r); host != nil {
+		t.Errorf("Expected no host while the grpc pool is down, got %s", host.Name)
+	}
+}
+
+func TestSetupRouteWhenMatcher(t *testing.T) {
+	c := caddy.NewTestController("http", "proxy / main:80 {\n pool api api:80 \n route_when api @api \n}")
+	httpserver.GetConfig(c).AddMatcher(&httpserver.Matcher{Name: "@api", Methods: []string{"DELETE"}})
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	p := httpserver.GetConfig(c).Middleware()[0](httpserver.EmptyNext).(Proxy)
+	upstream := p.Upstreams[0].(*staticUpstream)
+	if pool := upstream.Routing.pool(httptest.NewRequest("DELETE", "/", nil), time.Now()); pool[0].Name != "http://api:80" {
+		t.Errorf("Expected the pool of the named matcher, got %v", pool)
+	}
+
+	if err := setup(caddy.NewTestController("http", "proxy / main:80 {\n pool api api:80 \n route_when api @none \n}")); err == nil {
+		t.Error("Expected error for unknown matcher, got none")
+	}
+}
+
+func TestParseRouting(t *testing.T) {
+	for i, test := range []struct {
+		config    string
+		shouldErr bool
+	}{
+		{"proxy / {\n pool batch b:80 \n route batch 100% \n}", false},
+		{"proxy / a {\n pool batch b:8080-8081 \n route batch 12.5 22:00-02:00 \n}", false},
+		{"proxy / a {\n pool batch b \n route batch 0% \n}", true},
+		{"proxy / a {\n pool batch b \n route batch 101% \n}", true},
+		{"proxy / a {\n pool batch b \n route batch some \n}", true},
+		{"proxy / a {\n pool batch b \n route batch 10% 02:00 \n}", true},
+		{"proxy / a {\n pool batch b \n route batch 10% 2am-6am \n}", true},
+		{"proxy / a {\n pool batch b \n route batch 10% 02:00-06:00 daily \n}", true},
+		{"proxy / a {\n pool batch b \n route other 10% \n}", true},
+		{"proxy / a {\n pool batch b \n pool batch c \n route batch 10% \n}", true},
+		{"proxy / a {\n pool batch b \n pool idle c \n route batch 10% \n}", true},
+		{"proxy / a {\n pool batch \n route batch 10% \n}", true},
+		{"proxy / a {\n pool batch b \n}", true},
+		{"proxy / a {\n route_timezone UTC \n}", true},
+		{"proxy / a {\n pool grpc b \n route_when grpc {>Content-Type} == 'application/grpc' \n}", false},
+		{"proxy / a {\n pool grpc b \n route_when grpc @grpc \n}", false},
+		{"proxy / a {\n pool grpc b \n route_when grpc \n}", true},
+		{"proxy / a {\n pool grpc b \n route_when grpc {method} == \n}", true},
+		{"proxy / a {\n pool grpc b \n route_when other {method} == 'GET' \n}", true},
+		{"proxy / a {\n pool batch b \n route batch 10% \n route_timezone Nowhere/Special \n}", true},
+	} {
+		_, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error but got none", i)
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+	}
+}
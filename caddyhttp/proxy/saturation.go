@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// saturatedError is returned by ReverseProxy.ServeHTTP when the
+// host responds that it is too busy, and when to retry. The
+// response has not been written, so the request may be sent to
+// another host, but if none can take it, it is written after all.
+type saturatedError struct {
+	rp     *ReverseProxy
+	res    *http.Response
+	update respUpdateFn
+	wait   time.Duration
+}
+
+func (e *saturatedError) Error() string {
+	return fmt.Sprintf("upstream saturated: %d, retry after %v", e.res.StatusCode, e.wait)
+}
+
+// write writes the response of the saturated host to w.
+func (e *saturatedError) write(w http.ResponseWriter) {
+	if e.update != nil {
+		e.update(e.res)
+	}
+	e.rp.writeResponse(w, e.res)
+}
+
+// retryAfter returns how long res asks its host to be spared, at
+// most max, if it is a 429 or 503 response with a Retry-After
+// header in the future.
+func retryAfter(res *http.Response, max time.Duration) (time.Duration, bool) {
+	if res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	value := strings.TrimSpace(res.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	var wait time.Duration
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds > int64(max/time.Second) {
+			return max, true
+		}
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		wait = date.Sub(time.Now())
+	}
+	if wait <= 0 {
+		return 0, false
+	}
+	if wait > max {
+		wait = max
+	}
+	return wait, true
+}
+
+// saturate marks uh saturated for d, unless it already is for longer.
+func (uh *UpstreamHost) saturate(d time.Duration) {
+	until := time.Now().Add(d).UnixNano()
+	for {
+		current := atomic.LoadInt64(&uh.saturatedUntil)
+		if current >= until || atomic.CompareAndSwapInt64(&uh.saturatedUntil, current, until) {
+			return
+		}
+	}
+}
+
+// Saturated returns whether the host asked not to be sent
+// requests for now, without having failed.
+func (uh *UpstreamHost) Saturated() bool {
+	return time.Now().UnixNano() < atomic.LoadInt64(&uh.saturatedUntil)
+}
+
+// DefaultMaxRetryAfter is the longest a host is spared when
+// it asks to be, unless another maximum is set.
+const DefaultMaxRetryAfter = 1 * time.Minute
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	for i, test := range []struct {
+		status     int
+		retryAfter string
+		expectWait time.Duration
+		expectOK   bool
+	}{
+		{http.StatusServiceUnavailable, "30", 30 * time.Second, true},
+		{http.StatusTooManyRequests, " 5 ", 5 * time.Second, true},
+		{http.StatusTooManyRequests, "3600", time.Minute, true},
+		{http.StatusTooManyRequests, "99999999999999999", time.Minute, true},
+		{http.StatusServiceUnavailable, time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), time.Minute, true},
+		{http.StatusServiceUnavailable, time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, false},
+		{http.StatusServiceUnavailable, "0", 0, false},
+		{http.StatusServiceUnavailable, "-1", 0, false},
+		{http.StatusServiceUnavailable, "soon", 0, false},
+		{http.StatusServiceUnavailable, "", 0, false},
+		{http.StatusInternalServerError, "30", 0, false},
+		{http.StatusOK, "30", 0, false},
+	} {
+		res := &http.Response{StatusCode: test.status, Header: make(http.Header)}
+		if test.retryAfter != "" {
+			res.Header.Set("Retry-After", test.retryAfter)
+		}
+		wait, ok := retryAfter(res, time.Minute)
+		if ok != test.expectOK || wait != test.expectWait {
+			t.Errorf("Test %d: Expected %v %v, got %v %v", i, test.expectWait, test.expectOK, wait, ok)
+		}
+	}
+}
+
+func TestHonorRetryAfter(t *testing.T) {
+	var busyHits int32
+	busy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&busyHits, 1)
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("busy"))
+	}))
+	defer busy.Close()
+	idle := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("idle"))
+	}))
+	defer idle.Close()
+
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+		strings.NewReader("proxy / "+busy.URL+" "+idle.URL+" {\n honor_retry_after 10s \n try_duration 1s \n try_interval 0 \n}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{Next: httpserver.EmptyNext, Upstreams: upstreams}
+	for i := 0; i < 10; i++ {
+		w := httptest.NewRecorder()
+		if _, err := p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil)); err != nil || w.Body.String() != "idle" {
+			t.Fatalf("Request %d: Expected the idle host to respond, got '%s' %v", i, w.Body.String(), err)
+		}
+	}
+	if hits := atomic.LoadInt32(&busyHits); hits > 1 {
+		t.Errorf("Expected the busy host to be spared after its response, got %d requests", hits)
+	}
+	busyHost := upstreams[0].(*staticUpstream).Hosts[0]
+	if !busyHost.Saturated() || busyHost.Fails != 0 {
+		t.Errorf("Expected the busy host saturated without failing, got %v %d", busyHost.Saturated(), busyHost.Fails)
+	}
+	if until := time.Unix(0, busyHost.saturatedUntil); until.After(time.Now().Add(10 * time.Second)) {
+		t.Errorf("Expected the wait capped at 10s, got until %v", until)
+	}
+
+	// with no other host, the response is passed on
+	upstreams, err = NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+		strings.NewReader("proxy / "+busy.URL+" {\n honor_retry_after \n}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = &Proxy{Next: httpserver.EmptyNext, Upstreams: upstreams}
+	w := httptest.NewRecorder()
+	status, err := p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if status != 0 || err != nil || w.Code != http.StatusServiceUnavailable ||
+		w.Header().Get("Retry-After") != "30" || w.Body.String() != "busy" {
+		t.Errorf("Expected the busy response, got %d %v: %d %v '%s'", status, err, w.Code, w.Header(), w.Body.String())
+	}
+
+	for i, config := range []string{
+		"proxy / a {\n honor_retry_after soon \n}",
+		"proxy / a {\n honor_retry_after 0s \n}",
+		"proxy / a {\n honor_retry_after 1m 2m \n}",
+	} {
+		if _, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config))); err == nil {
+			t.Errorf("Config %d: Expected error but got none", i)
+		}
+	}
+}
@@ -1,14 +1,17 @@
 package proxy
 
 import (
+	"path/filepath"
+
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
 func init() {
 	caddy.RegisterPlugin("proxy", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
@@ -18,7 +21,56 @@ func setup(c *caddy.Controller) error {
 	if err != nil {
 		return err
 	}
-	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+	cfg := httpserver.GetConfig(c)
+	var caches []*ResponseCache
+	var statics []*staticUpstream
+	for _, upstream := range upstreams {
+		su, ok := upstream.(*staticUpstream)
+		if !ok {
+			continue
+		}
+		statics = append(statics, su)
+		if su.staticFirst {
+			if err := httpserver.CheckStaticRoot(c); err != nil {
+				return err
+			}
+			su.files = cfg.FileSystem()
+		}
+		if su.Cache != nil {
+			caches = append(caches, su.Cache)
+		}
+		// unavailable pages are relative to the site root
+		if su.UnavailablePage != nil {
+			if file := su.UnavailablePage.File; file != "" && !filepath.IsAbs(file) {
+				if err := httpserver.CheckStaticRoot(c); err != nil {
+					return err
+				}
+				su.UnavailablePage.File = filepath.Join(cfg.Root, file)
+			}
+		}
+		if httpserver.IsMatcherRef(su.from) {
+			m, err := httpserver.MatcherRef(c, su.from)
+			if err != nil {
+				return err
+			}
+			su.matcher = m
+		}
+		if rt := su.Routing; rt != nil {
+			for _, rule := range rt.Rules {
+				if rule.matcherRef == "" {
+					continue
+				}
+				m, err := httpserver.MatcherRef(c, rule.matcherRef)
+				if err != nil {
+					return err
+				}
+				rule.When = m
+			}
+		}
+	}
+	setSiteCaches(cfg.Addr.String(), caches)
+	setSiteUpstreams(cfg.Addr.String(), statics)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
 		return Proxy{Next: next, Upstreams: upstreams}
 	})
 	return nil
@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"net/http/httptest"
 	"reflect"
 	"testing"
 
@@ -175,3 +176,25 @@ func TestSetup(t *testing.T) {
 		}
 	}
 }
+
+func TestSetupNamedMatcher(t *testing.T) {
+	c := caddy.NewTestController("http", "proxy / localhost:8080\nproxy @api localhost:9000")
+	httpserver.GetConfig(c).AddMatcher(&httpserver.Matcher{Name: "@api", Headers: []httpserver.HeaderMatch{{Field: "X-Api", Values: []string{"*"}}}})
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	p := httpserver.GetConfig(c).Middleware()[0](httpserver.EmptyNext).(Proxy)
+
+	r := httptest.NewRequest("GET", "/items", nil)
+	if u := p.match(r); u == nil || u.From() != "/" {
+		t.Errorf("Expected upstream for /, got %v", u)
+	}
+	r.Header.Set("X-Api", "1")
+	if u := p.match(r); u == nil || u.From() != "@api" {
+		t.Errorf("Expected upstream for @api, got %v", u)
+	}
+
+	if err := setup(caddy.NewTestController("http", "proxy @web localhost:9000")); err == nil {
+		t.Error("Expected error for unknown matcher, got none")
+	}
+}
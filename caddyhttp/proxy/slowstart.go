@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// rampSteps is the share of the requests a policy would send it
+// that a host gets when it is not slow starting; while it is, it
+// gets a share that grows from 1 to rampSteps.
+const rampSteps = 100
+
+// noteHealth records whether the host is down, so that when
+// it recovers, it can be sent requests gradually.
+func (uh *UpstreamHost) noteHealth(down bool) {
+	if uh.SlowStart <= 0 {
+		return
+	}
+	if down {
+		atomic.StoreInt32(&uh.wasDown, 1)
+	} else if atomic.CompareAndSwapInt32(&uh.wasDown, 1, 0) {
+		atomic.StoreInt64(&uh.recoveredAt, time.Now().UnixNano())
+	}
+}
+
+// ramp returns the share, out of rampSteps, of the requests a
+// policy would send it that the host gets, which grows linearly
+// over SlowStart after it recovered.
+func (uh *UpstreamHost) ramp() int {
+	recovered := atomic.LoadInt64(&uh.recoveredAt)
+	if uh.SlowStart <= 0 || recovered == 0 {
+		return rampSteps
+	}
+	elapsed := time.Now().UnixNano() - recovered
+	if elapsed >= int64(uh.SlowStart) {
+		return rampSteps
+	}
+	share := int(rampSteps * elapsed / int64(uh.SlowStart))
+	if share < 1 {
+		return 1
+	}
+	return share
+}
+
+// SlowStarting returns whether the host recovered too recently
+// to be sent its full share of requests.
+func (uh *UpstreamHost) SlowStarting() bool {
+	return uh.ramp() < rampSteps
+}
+
+// admits returns whether the host takes a request that a policy
+// which does not weigh hosts selected it for, which it does at
+// random in proportion to its ramp.
+func (uh *UpstreamHost) admits() bool {
+	share := uh.ramp()
+	return share >= rampSteps || rand.Intn(rampSteps) < share
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+func TestSlowStart(t *testing.T) {
+	host := &UpstreamHost{Name: "a", SlowStart: time.Hour}
+	if host.ramp() != rampSteps {
+		t.Errorf("Expected a host that never recovered to get its full share, got %d", host.ramp())
+	}
+
+	host.Unhealthy = true
+	if host.Available() {
+		t.Fatal("Expected unhealthy host to be unavailable")
+	}
+	host.Unhealthy = false
+	if !host.Available() {
+		t.Fatal("Expected healthy host to be available")
+	}
+	if share := host.ramp(); share != 1 {
+		t.Errorf("Expected a host that just recovered to get a share of 1, got %d", share)
+	}
+	if !host.SlowStarting() {
+		t.Error("Expected a host that just recovered to be slow starting")
+	}
+
+	host.recoveredAt = time.Now().Add(-15 * time.Minute).UnixNano()
+	if share := host.ramp(); share != 25 {
+		t.Errorf("Expected a share of 25 a quarter of the way in, got %d", share)
+	}
+	host.recoveredAt = time.Now().Add(-time.Hour).UnixNano()
+	if host.SlowStarting() {
+		t.Error("Expected a host to be done slow starting after the window")
+	}
+
+	// without slow start, recoveries are not noted
+	host = &UpstreamHost{Name: "b", Unhealthy: true}
+	host.Available()
+	host.Unhealthy = false
+	host.Available()
+	if host.SlowStarting() {
+		t.Error("Expected a host without slow start never to be slow starting")
+	}
+}
+
+func TestSlowStartPolicies(t *testing.T) {
+	newPool := func() HostPool {
+		pool := HostPool{
+			&UpstreamHost{Name: "a", SlowStart: time.Hour},
+			&UpstreamHost{Name: "b", SlowStart: time.Hour},
+		}
+		// b recovered a quarter of the way through its slow start
+		pool[1].recoveredAt = time.Now().Add(-15 * time.Minute).UnixNano()
+		return pool
+	}
+
+	for name, policy := range map[string]Policy{
+		"random":               &Random{},
+		"least_conn":           &LeastConn{},
+		"round_robin":          &RoundRobin{},
+		"weighted_round_robin": &WeightedRoundRobin{},
+	} {
+		pool := newPool()
+		counts := make(map[string]int)
+		for i := 0; i < 10000; i++ {
+			counts[policy.Select(pool, nil).Name]++
+		}
+		// b gets 25 for each 100 of a, so a fifth of the requests
+		if counts["b"] < 1500 || counts["b"] > 2500 {
+			t.Errorf("%s: Expected about 2000 of 10000 requests to go to b, got %d", name, counts["b"])
+		}
+	}
+
+	// a host that is slow starting is selected if no other is available
+	pool := newPool()
+	pool[0].Unhealthy = true
+	for i := 0; i < 10; i++ {
+		if host := (&RoundRobin{}).Select(pool, nil); host != pool[1] {
+			t.Fatalf("Expected the only available host to be selected, got %v", host)
+		}
+	}
+}
+
+func TestParseSlowStart(t *testing.T) {
+	for i, test := range []struct {
+		config    string
+		shouldErr bool
+		expected  time.Duration
+	}{
+		{"proxy / a b {\n slow_start 30s \n}", false, 30 * time.Second},
+		{"proxy / a b {\n slow_start 0s \n}", false, 0},
+		{"proxy / a b {\n slow_start \n}", true, 0},
+		{"proxy / a b {\n slow_start -1s \n}", true, 0},
+		{"proxy / a b {\n slow_start soon \n}", true, 0},
+	} {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		for _, host := range upstreams[0].(*staticUpstream).Hosts {
+			if host.SlowStart != test.expected {
+				t.Errorf("Test %d: Expected slow start of %s to be %v, got %v", i, host.Name, test.expected, host.SlowStart)
+			}
+		}
+	}
+}
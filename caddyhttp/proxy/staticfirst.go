@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+// servesLocally implements localFileServer. Only GET and HEAD
+// requests are served from files, as the file server serves
+// nothing else, and directories only if they have an index page.
+func (u *staticUpstream) servesLocally(r *http.Request) bool {
+	if !u.staticFirst || u.files == nil {
+		return false
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	name := path.Clean("/" + r.URL.Path)
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		return isFile(u.files, name)
+	}
+	for _, indexPage := range staticfiles.IndexPages {
+		if isFile(u.files, path.Join(name, indexPage)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFile returns whether name exists in fs and
+// is not a directory.
+func isFile(fs http.FileSystem, name string) bool {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	return err == nil && !info.IsDir()
+}
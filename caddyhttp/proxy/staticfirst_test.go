@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+func TestStaticFirst(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_proxy_static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for name, content := range map[string]string{
+		"style.css":       "local css",
+		"docs/index.html": "local docs",
+		"empty/.keep":     "",
+	} {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxied " + r.URL.Path))
+	}))
+	defer backend.Close()
+
+	c := caddy.NewTestController("http", "proxy / "+backend.URL+" {\n static_first \n}")
+	cfg := httpserver.GetConfig(c)
+	cfg.Root = root
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	next := staticfiles.FileServer{Root: http.Dir(root)}
+	handler := cfg.Middleware()[0](next)
+
+	for i, test := range []struct {
+		method, path, expected string
+	}{
+		{"GET", "/style.css", "local css"},
+		{"HEAD", "/style.css", ""},
+		{"GET", "/docs/", "local docs"},
+		{"GET", "/app.js", "proxied /app.js"},
+		{"GET", "/empty/", "proxied /empty/"},
+		{"GET", "/docs", "proxied /docs"},
+		{"GET", "/../style.css", "local css"},
+		{"POST", "/style.css", "proxied /style.css"},
+	} {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		status, err := handler.ServeHTTP(w, req)
+		if err != nil || (status != 0 && status != http.StatusOK) {
+			t.Errorf("Test %d: Expected success, got %d %v", i, status, err)
+		}
+		if got := w.Body.String(); got != test.expected {
+			t.Errorf("Test %d: Expected '%s', got '%s'", i, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// UnavailablePage is served instead of a bare 502 response
+// when no upstream host is available. It tells clients when
+// to retry, and refreshes itself ever more slowly while the
+// upstream stays down.
+type UnavailablePage struct {
+	// File with the HTML of the page; if empty,
+	// a default page is served. The placeholders
+	// {retry_after} and {refresh} are replaced with
+	// the number of seconds until the upstream is
+	// expected to be back and until the page refreshes.
+	File string
+}
+
+// serve writes the page to w, given that the upstream is
+// expected to be back after retryAfter. The refresh delay
+// doubles with each refresh, counted in a cookie.
+func (p *UnavailablePage) serve(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	var attempts uint
+	if c, err := r.Cookie(backoffCookie); err == nil {
+		if n, err := strconv.Atoi(c.Value); err == nil && n > 0 {
+			attempts = uint(n)
+		}
+	}
+	refresh := retryAfter
+	for i := uint(0); i < attempts && refresh < maxRefreshDelay; i++ {
+		refresh *= 2
+	}
+	if refresh > maxRefreshDelay {
+		refresh = maxRefreshDelay
+	}
+
+	page := defaultUnavailablePage
+	if p.File != "" {
+		body, err := ioutil.ReadFile(p.File)
+		if err != nil {
+			log.Printf("[ERROR] Reading unavailable page: %v", err)
+		} else {
+			page = string(body)
+		}
+	}
+	repl := httpserver.NewReplacer(r, nil, "")
+	repl.Set("retry_after", seconds(retryAfter))
+	repl.Set("refresh", seconds(refresh))
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     backoffCookie,
+		Value:    strconv.Itoa(int(attempts) + 1),
+		Path:     "/",
+		MaxAge:   int(backoffCookieMaxAge / time.Second),
+		HttpOnly: true,
+	})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", seconds(retryAfter))
+	w.Header().Set("Refresh", seconds(refresh))
+	w.WriteHeader(http.StatusBadGateway)
+	w.Write([]byte(repl.Replace(page)))
+}
+
+// resetBackoff returns a respUpdateFn that clears the refresh
+// count of the client of r, if it has one, then calls next.
+func (p *UnavailablePage) resetBackoff(r *http.Request, next respUpdateFn) respUpdateFn {
+	if _, err := r.Cookie(backoffCookie); err != nil {
+		return next
+	}
+	return func(resp *http.Response) {
+		resp.Header.Add("Set-Cookie", (&http.Cookie{Name: backoffCookie, Path: "/", MaxAge: -1}).String())
+		if next != nil {
+			next(resp)
+		}
+	}
+}
+
+// seconds formats d as a whole number of seconds, at least 1.
+func seconds(d time.Duration) string {
+	s := int64((d + time.Second - 1) / time.Second)
+	if s < 1 {
+		s = 1
+	}
+	return strconv.FormatInt(s, 10)
+}
+
+const (
+	// backoffCookie counts how often a client
+	// was served the unavailable page.
+	backoffCookie       = "caddy_backoff"
+	backoffCookieMaxAge = 1 * time.Hour
+
+	// defaultRetryAfter is how long an upstream without health
+	// checks or fail_timeout is expected to be unavailable.
+	defaultRetryAfter = 10 * time.Second
+
+	maxRefreshDelay = 5 * time.Minute
+)
+
+const defaultUnavailablePage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{refresh}">
+<title>We'll be right back</title>
+<style>
+body { font-family: sans-serif; color: #333; text-align: center; padding: 10% 1em; }
+h1 { font-weight: normal; }
+</style>
+</head>
+<body>
+<h1>We'll be right back</h1>
+<p>This site is temporarily unavailable. This page will try again in {refresh} seconds.</p>
+</body>
+</html>
+`
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupUnavailablePage(t *testing.T) {
+	c := caddy.NewTestController("http", "proxy / localhost:8080 {\n unavailable_page down.html \n}")
+	httpserver.GetConfig(c).Root = "/srv/www"
+	if err := setup(c); err != nil {
+		t.Fatal(err)
+	}
+	handler := httpserver.GetConfig(c).Middleware()[0](httpserver.EmptyNext).(Proxy)
+	page := handler.Upstreams[0].(*staticUpstream).UnavailablePage
+	if expected := filepath.Join("/srv/www", "down.html"); page == nil || page.File != expected {
+		t.Errorf("Expected unavailable page %s, got %+v", expected, page)
+	}
+}
+
+func TestUnavailablePage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_unavailable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "down.html")
+	if err := ioutil.WriteFile(file, []byte("Back in {retry_after}s, reloading in {refresh}s"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	upstream := &staticUpstream{
+		from:            "/",
+		Hosts:           HostPool{{Name: "http://localhost:1", Unhealthy: true}},
+		FailTimeout:     20 * time.Second,
+		UnavailablePage: &UnavailablePage{File: file},
+	}
+	p := Proxy{Next: httpserver.EmptyNext, Upstreams: []Upstream{upstream}}
+
+	var cookie string
+	for i, expected := range []string{
+		"Back in 20s, reloading in 20s",
+		"Back in 20s, reloading in 40s",
+		"Back in 20s, reloading in 80s",
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if cookie != "" {
+			r.Header.Set("Cookie", cookie)
+		}
+		w := httptest.NewRecorder()
+		status, err := p.ServeHTTP(w, r)
+		if status != 0 || err == nil {
+			t.Errorf("Test %d: Expected status 0 with the upstream error, got %d and %v", i, status, err)
+		}
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("Test %d: Expected status %d, got %d", i, http.StatusBadGateway, w.Code)
+		}
+		if got := w.Body.String(); got != expected {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, expected, got)
+		}
+		if got := w.Header().Get("Retry-After"); got != "20" {
+			t.Errorf("Test %d: Expected Retry-After 20, got '%s'", i, got)
+		}
+		cookie = strings.SplitN(w.Header().Get("Set-Cookie"), ";", 2)[0]
+	}
+
+	// the default page is served if there is no file
+	upstream.UnavailablePage.File = ""
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(w.Body.String(), `content="20"`) {
+		t.Errorf("Expected default page refreshing in 20 seconds, got: %s", w.Body.String())
+	}
+
+	// a successful response resets the backoff
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", cookie)
+	resp := &http.Response{Header: make(http.Header)}
+	upstream.updateResponse(r, upstream.Hosts[0], nil)(resp)
+	if got := resp.Header.Get("Set-Cookie"); !strings.HasPrefix(got, backoffCookie+"=;") || !strings.Contains(got, "Max-Age=0") {
+		t.Errorf("Expected backoff cookie to be cleared, got '%s'", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	u := &staticUpstream{}
+	if got := u.retryAfter(); got != defaultRetryAfter {
+		t.Errorf("Expected default of %v, got %v", defaultRetryAfter, got)
+	}
+
+	u.FailTimeout = 30 * time.Second
+	if got := u.retryAfter(); got != 30*time.Second {
+		t.Errorf("Expected fail timeout of 30s, got %v", got)
+	}
+
+	u.HealthCheck.Path = "/health"
+	u.HealthCheck.Interval = time.Minute
+	if got := u.retryAfter(); got != time.Minute {
+		t.Errorf("Expected health check interval before the first check, got %v", got)
+	}
+	atomic.StoreInt64(&u.lastHealthCheck, time.Now().Add(-45*time.Second).UnixNano())
+	if got := u.retryAfter(); got > 15*time.Second || got < 14*time.Second {
+		t.Errorf("Expected about 15s until the next health check, got %v", got)
+	}
+}
+
+func TestSeconds(t *testing.T) {
+	for d, expected := range map[time.Duration]string{
+		0:                       "1",
+		300 * time.Millisecond:  "1",
+		2 * time.Second:         "2",
+		2500 * time.Millisecond: "3",
+	} {
+		if got := seconds(d); got != expected {
+			t.Errorf("Expected %v to be %s seconds, got %s", d, expected, got)
+		}
+	}
+}
@@ -9,8 +9,10 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/mholt/caddy/caddyfile"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
@@ -21,6 +23,7 @@ var (
 )
 
 type staticUpstream struct {
+	lastHealthCheck   int64 // UnixNano; must be first field to be 64-bit aligned on 32-bit systems
 	from              string
 	upstreamHeaders   http.Header
 	downstreamHeaders http.Header
@@ -40,7 +43,29 @@ type staticUpstream struct {
 	WithoutPathPrefix  string
 	IgnoredSubPaths    []string
 	insecureSkipVerify bool
+	headerCasing       map[string]string
+	preserveRequestURI bool
+	decodeResponses    string
+	staticFirst        bool
+	maxRetryAfter      time.Duration
+	hasBackups         bool
+	files              http.FileSystem
 	MaxFails           int32
+	SlowStart          time.Duration
+	Affinity           *Affinity
+	UnavailablePage    *UnavailablePage
+	OutlierDetection   *OutlierDetection
+	RetryBudget        *RetryBudget
+	Queue              *RequestQueue
+	Collapser          *RequestCollapser
+	Cache              *ResponseCache
+	Mirror             *Mirror
+	DebugOverride      *DebugOverride
+	ClientConnections  *ClientConnections
+	Lookup             *Lookup
+	Routing            *Routing
+	WebSocket          *WebSocketInspection
+	matcher            httpserver.RequestMatcher
 }
 
 // NewStaticUpstreams parses the configuration input and sets up
@@ -65,6 +90,8 @@ func NewStaticUpstreams(c caddyfile.Dispenser) ([]Upstream, error) {
 		}
 
 		var to []string
+		weights := make(map[string]int)
+		backups := make(map[string]bool)
 		for _, t := range c.RemainingArgs() {
 			parsed, err := parseUpstream(t)
 			if err != nil {
@@ -83,6 +110,25 @@ func NewStaticUpstreams(c caddyfile.Dispenser) ([]Upstream, error) {
 				if err != nil {
 					return upstreams, err
 				}
+				weight := 1
+				for _, arg := range c.RemainingArgs() {
+					if arg == "backup" {
+						for _, host := range parsed {
+							backups[host] = true
+						}
+						continue
+					}
+					if !strings.HasPrefix(arg, "weight=") {
+						return upstreams, c.Errf("unknown upstream option '%s'", arg)
+					}
+					weight, err = strconv.Atoi(strings.TrimPrefix(arg, "weight="))
+					if err != nil || weight < 1 {
+						return upstreams, c.Errf("invalid upstream weight '%s'", arg)
+					}
+				}
+				for _, host := range parsed {
+					weights[host] = weight
+				}
 				to = append(to, parsed...)
 			default:
 				if err := parseBlock(&c, upstream); err != nil {
@@ -91,9 +137,40 @@ func NewStaticUpstreams(c caddyfile.Dispenser) ([]Upstream, error) {
 			}
 		}
 
-		if len(to) == 0 {
+		if len(to) == 0 && upstream.Lookup == nil && upstream.Routing == nil {
 			return upstreams, c.ArgErr()
 		}
+		if l := upstream.Lookup; l != nil {
+			if l.Source == nil {
+				return upstreams, c.Err("lookup_ttl requires lookup")
+			}
+			l.newHost = upstream.NewHost
+		}
+
+		if a := upstream.Affinity; a != nil {
+			if a.Source == "" {
+				return upstreams, c.Err("affinity_store and affinity_ttl require affinity")
+			}
+			if a.Store == nil {
+				a.Store = newMemoryStore()
+			}
+			a.Namespace = upstream.from
+		}
+		if od := upstream.OutlierDetection; od != nil && od.Interval == 0 {
+			return upstreams, c.Err("outlier_* properties require outlier_detection")
+		}
+		if upstream.Queue != nil {
+			if upstream.MaxConns <= 0 {
+				return upstreams, c.Err("queue requires max_conns")
+			}
+			upstream.Queue.name = upstream.from
+		}
+		if upstream.ClientConnections != nil && upstream.KeepAlive == 0 {
+			return upstreams, c.Err("client_connections requires keepalive")
+		}
+		if upstream.Cache != nil || upstream.Collapser != nil {
+			publishCacheStats(upstream.from, upstream.Cache, upstream.Collapser)
+		}
 
 		upstream.Hosts = make([]*UpstreamHost, len(to))
 		for i, host := range to {
@@ -101,8 +178,34 @@ func NewStaticUpstreams(c caddyfile.Dispenser) ([]Upstream, error) {
 			if err != nil {
 				return upstreams, err
 			}
+			if w, ok := weights[host]; ok {
+				uh.Weight = w
+			}
+			if backups[host] {
+				uh.Backup = true
+				upstream.hasBackups = true
+			}
 			upstream.Hosts[i] = uh
 		}
+		if rt := upstream.Routing; rt != nil {
+			if len(rt.Rules) == 0 {
+				return upstreams, c.Err("pool and route_timezone require route or route_when")
+			}
+			pools, err := rt.newHosts(upstream.Hosts, upstream.NewHost)
+			if err != nil {
+				return upstreams, c.Err(err.Error())
+			}
+			upstream.Hosts = append(upstream.Hosts[:len(upstream.Hosts):len(upstream.Hosts)], pools...)
+		}
+
+		if m := upstream.Mirror; m != nil {
+			m.proxy = NewSingleHostReverseProxy(m.Target, upstream.WithoutPathPrefix, upstream.KeepAlive)
+			if upstream.insecureSkipVerify {
+				m.proxy.UseInsecureTransport()
+			}
+		}
+
+		publishConnStats(upstream)
 
 		if upstream.HealthCheck.Path != "" {
 			upstream.HealthCheck.Client = http.Client{
@@ -110,6 +213,9 @@ func NewStaticUpstreams(c caddyfile.Dispenser) ([]Upstream, error) {
 			}
 			go upstream.HealthCheckWorker(nil)
 		}
+		if upstream.OutlierDetection != nil {
+			go upstream.OutlierDetection.worker(upstream.Hosts, nil)
+		}
 		upstreams = append(upstreams, upstream)
 	}
 	return upstreams, nil
@@ -119,6 +225,12 @@ func (u *staticUpstream) From() string {
 	return u.from
 }
 
+// Matcher returns the named matcher that routes requests to
+// u, or nil if they are routed by its base path.
+func (u *staticUpstream) Matcher() httpserver.RequestMatcher {
+	return u.matcher
+}
+
 func (u *staticUpstream) NewHost(host string) (*UpstreamHost, error) {
 	if !strings.HasPrefix(host, "http") &&
 		!strings.HasPrefix(host, "unix:") {
@@ -140,22 +252,38 @@ func (u *staticUpstream) NewHost(host string) (*UpstreamHost, error) {
 				if uh.Fails >= u.MaxFails {
 					return true
 				}
+				if u.OutlierDetection != nil && u.OutlierDetection.ejected(uh) {
+					return true
+				}
 				return false
 			}
 		}(u),
 		WithoutPathPrefix: u.WithoutPathPrefix,
 		MaxConns:          u.MaxConns,
+		Weight:            1,
+		SlowStart:         u.SlowStart,
 	}
 
 	baseURL, err := url.Parse(uh.Name)
 	if err != nil {
 		return nil, err
 	}
+	addKnownHost(uh.Name)
 
 	uh.ReverseProxy = NewSingleHostReverseProxy(baseURL, uh.WithoutPathPrefix, u.KeepAlive)
 	if u.insecureSkipVerify {
 		uh.ReverseProxy.UseInsecureTransport()
 	}
+	uh.ReverseProxy.HeaderCasing = u.headerCasing
+	uh.ReverseProxy.PreserveRequestURI = u.preserveRequestURI
+	uh.ReverseProxy.DecodeResponses = u.decodeResponses != ""
+	uh.ReverseProxy.DecodeAlways = u.decodeResponses == "always"
+	uh.ReverseProxy.WebSocket = u.WebSocket
+	uh.ReverseProxy.MaxRetryAfter = u.maxRetryAfter
+	uh.ReverseProxy.countConns()
+	if u.ClientConnections != nil {
+		uh.ReverseProxy.Transport = u.ClientConnections.transport(uh, uh.ReverseProxy.Transport)
+	}
 
 	return uh, nil
 }
@@ -214,7 +342,320 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream) error {
 		if !ok {
 			return c.ArgErr()
 		}
+		name := c.Val()
 		u.Policy = policyCreateFunc()
+		args := c.RemainingArgs()
+		if cp, ok := u.Policy.(ConfigurablePolicy); ok {
+			if err := cp.Configure(args); err != nil {
+				return c.Errf("policy %s: %v", name, err)
+			}
+		} else if len(args) > 0 {
+			return c.ArgErr()
+		}
+	case "affinity":
+		a := u.affinity()
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		a.Source = c.Val()
+		switch a.Source {
+		case "cookie", "header":
+			if !c.NextArg() {
+				return c.ArgErr()
+			}
+			a.Name = c.Val()
+		case "ip":
+		default:
+			return c.Errf("unknown affinity source '%s'", a.Source)
+		}
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+	case "affinity_store":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		storeURL, err := url.Parse(c.Val())
+		if err != nil {
+			return c.Errf("invalid affinity store '%s': %v", c.Val(), err)
+		}
+		scheme := storeURL.Scheme
+		if scheme == "" {
+			scheme = c.Val() // stores that need no address, like "memory"
+		}
+		newStore, ok := supportedAffinityStores[scheme]
+		if !ok {
+			return c.Errf("unknown affinity store '%s'", c.Val())
+		}
+		store, err := newStore(storeURL)
+		if err != nil {
+			return c.Err(err.Error())
+		}
+		u.affinity().Store = store
+	case "lookup":
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		var key string
+		if len(args) == 2 {
+			key = args[1]
+		}
+		if u.Lookup == nil {
+			u.Lookup = newLookup()
+		}
+		if err := u.Lookup.setSource(args[0], key); err != nil {
+			return c.Errf("invalid lookup: %v", err)
+		}
+	case "lookup_ttl":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(c.Val())
+		if err != nil || dur <= 0 {
+			return c.Errf("invalid lookup_ttl '%s'", c.Val())
+		}
+		if u.Lookup == nil {
+			u.Lookup = newLookup()
+		}
+		u.Lookup.TTL = dur
+	case "affinity_ttl":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(c.Val())
+		if err != nil {
+			return err
+		}
+		if dur <= 0 {
+			return c.Err("affinity_ttl must be positive")
+		}
+		u.affinity().TTL = dur
+	case "unavailable_page":
+		u.UnavailablePage = new(UnavailablePage)
+		if c.NextArg() {
+			u.UnavailablePage.File = c.Val()
+		}
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+	case "outlier_detection":
+		od := u.outlierDetection()
+		od.Interval = defaultOutlierInterval
+		if c.NextArg() {
+			dur, err := time.ParseDuration(c.Val())
+			if err != nil {
+				return err
+			}
+			if dur <= 0 {
+				return c.Err("outlier_detection interval must be positive")
+			}
+			od.Interval = dur
+		}
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+	case "outlier_errors", "outlier_latency":
+		property := c.Val()
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		factor, err := strconv.ParseFloat(c.Val(), 64)
+		if err != nil || (factor != 0 && factor <= 1) {
+			return c.Errf("%s must be a factor greater than 1, or 0 to disable", property)
+		}
+		if property == "outlier_errors" {
+			u.outlierDetection().ErrorFactor = factor
+		} else {
+			u.outlierDetection().LatencyFactor = factor
+		}
+	case "outlier_min_requests":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		n, err := strconv.Atoi(c.Val())
+		if err != nil || n < 1 {
+			return c.Err("outlier_min_requests must be at least 1")
+		}
+		u.outlierDetection().MinRequests = n
+	case "outlier_consecutive":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		n, err := strconv.Atoi(c.Val())
+		if err != nil || n < 0 {
+			return c.Err("outlier_consecutive must be a number of failures, or 0 to disable")
+		}
+		u.outlierDetection().Consecutive = n
+	case "outlier_max_ejection":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		percent, err := strconv.Atoi(strings.TrimSuffix(c.Val(), "%"))
+		if err != nil || percent < 0 || percent > 100 {
+			return c.Err("outlier_max_ejection must be a percentage")
+		}
+		u.outlierDetection().MaxEjectionPercent = percent
+	case "outlier_ejection_time":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(c.Val())
+		if err != nil {
+			return err
+		}
+		if dur <= 0 {
+			return c.Err("outlier_ejection_time must be positive")
+		}
+		u.outlierDetection().EjectionTime = dur
+		if c.NextArg() {
+			max, err := time.ParseDuration(c.Val())
+			if err != nil {
+				return err
+			}
+			if max < dur {
+				return c.Err("outlier_ejection_time maximum must not be less than the ejection time")
+			}
+			u.outlierDetection().MaxEjectionTime = max
+		} else {
+			u.outlierDetection().MaxEjectionTime = dur * maxEjectionFactor
+		}
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+	case "retry_budget":
+		args := c.RemainingArgs()
+		if len(args) < 1 || len(args) > 3 {
+			return c.ArgErr()
+		}
+		percent, err := strconv.Atoi(strings.TrimSuffix(args[0], "%"))
+		if err != nil || percent < 0 {
+			return c.Err("retry_budget must be a percentage")
+		}
+		budget := &RetryBudget{
+			Percent:    percent,
+			Window:     defaultRetryBudgetWindow,
+			MinRetries: defaultRetryBudgetMinRetries,
+		}
+		if len(args) > 1 {
+			dur, err := time.ParseDuration(args[1])
+			if err != nil {
+				return err
+			}
+			if dur <= 0 {
+				return c.Err("retry_budget window must be positive")
+			}
+			budget.Window = dur
+		}
+		if len(args) > 2 {
+			n, err := strconv.Atoi(args[2])
+			if err != nil || n < 0 {
+				return c.Err("retry_budget minimum retries must be a number")
+			}
+			budget.MinRetries = n
+		}
+		u.RetryBudget = budget
+	case "queue":
+		args := c.RemainingArgs()
+		if len(args) > 2 {
+			return c.ArgErr()
+		}
+		u.Queue = newRequestQueue("")
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return c.Err("queue length must be at least 1")
+			}
+			u.Queue.MaxLength = n
+		}
+		if len(args) > 1 {
+			dur, err := time.ParseDuration(args[1])
+			if err != nil {
+				return err
+			}
+			if dur <= 0 {
+				return c.Err("queue timeout must be positive")
+			}
+			u.Queue.Timeout = dur
+		}
+	case "collapse_requests":
+		u.Collapser = newRequestCollapser()
+		if c.NextArg() {
+			size, err := humanize.ParseBytes(c.Val())
+			if err != nil || size == 0 {
+				return c.Errf("invalid collapse_requests body size '%s'", c.Val())
+			}
+			u.Collapser.MaxBody = int64(size)
+		}
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+	case "cache":
+		u.Cache = newResponseCache()
+		if c.NextArg() {
+			size, err := humanize.ParseBytes(c.Val())
+			if err != nil || size == 0 {
+				return c.Errf("invalid cache size '%s'", c.Val())
+			}
+			u.Cache.MaxSize = int64(size)
+		}
+		if c.NextArg() {
+			size, err := humanize.ParseBytes(c.Val())
+			if err != nil || size == 0 {
+				return c.Errf("invalid cache body size '%s'", c.Val())
+			}
+			u.Cache.MaxBody = int64(size)
+		}
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+	case "mirror":
+		args := c.RemainingArgs()
+		if len(args) < 1 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		target := args[0]
+		if !strings.HasPrefix(target, "http") && !strings.HasPrefix(target, "unix:") {
+			target = "http://" + target
+		}
+		targetURL, err := url.Parse(target)
+		if err != nil {
+			return c.Errf("invalid mirror '%s'", args[0])
+		}
+		u.Mirror = newMirror(targetURL)
+		if len(args) > 1 {
+			percent, err := strconv.Atoi(strings.TrimSuffix(args[1], "%"))
+			if err != nil || percent < 1 || percent > 100 {
+				return c.Errf("invalid mirror percentage '%s'", args[1])
+			}
+			u.Mirror.Percent = percent
+		}
+	case "debug_upstream_header":
+		args := c.RemainingArgs()
+		if len(args) < 1 {
+			return c.ArgErr()
+		}
+		d := &DebugOverride{Header: args[0]}
+		for _, arg := range args[1:] {
+			n, err := httpserver.ParseIPRange(arg)
+			if err != nil {
+				return c.Errf("invalid debug_upstream_header client range '%s'", arg)
+			}
+			d.Trusted = append(d.Trusted, n)
+		}
+		u.DebugOverride = d
+	case "client_connections":
+		u.ClientConnections = newClientConnections()
+		if c.NextArg() {
+			dur, err := time.ParseDuration(c.Val())
+			if err != nil || dur <= 0 {
+				return c.Errf("invalid client_connections idle timeout '%s'", c.Val())
+			}
+			u.ClientConnections.IdleTimeout = dur
+		}
+		if c.NextArg() {
+			return c.ArgErr()
+		}
 	case "fail_timeout":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -224,6 +665,15 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream) error {
 			return err
 		}
 		u.FailTimeout = dur
+	case "slow_start":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(c.Val())
+		if err != nil || dur < 0 {
+			return c.Errf("invalid slow_start '%s'", c.Val())
+		}
+		u.SlowStart = dur
 	case "max_fails":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -328,6 +778,47 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream) error {
 	case "websocket":
 		u.upstreamHeaders.Add("Connection", "{>Connection}")
 		u.upstreamHeaders.Add("Upgrade", "{>Upgrade}")
+	case "websocket_max_message":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		size, err := humanize.ParseBytes(c.Val())
+		if err != nil || size == 0 {
+			return c.Errf("invalid websocket_max_message size '%s'", c.Val())
+		}
+		u.webSocket().MaxMessage = int64(size)
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+	case "websocket_rate":
+		args := c.RemainingArgs()
+		if len(args) < 1 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return c.Errf("invalid websocket_rate '%s'", args[0])
+		}
+		u.webSocket().Rate = n
+		if len(args) > 1 {
+			dur, err := time.ParseDuration(args[1])
+			if err != nil || dur <= 0 {
+				return c.Errf("invalid websocket_rate interval '%s'", args[1])
+			}
+			u.webSocket().Per = dur
+		}
+	case "websocket_inspect":
+		names := c.RemainingArgs()
+		if len(names) == 0 {
+			return c.ArgErr()
+		}
+		for _, name := range names {
+			newInspector, ok := supportedWebSocketInspectors[name]
+			if !ok {
+				return c.Errf("unknown WebSocket inspector '%s'", name)
+			}
+			u.webSocket().Inspectors = append(u.webSocket().Inspectors, newInspector())
+		}
 	case "without":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -339,6 +830,122 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream) error {
 			return c.ArgErr()
 		}
 		u.IgnoredSubPaths = ignoredPaths
+	case "preserve_header_case":
+		names := c.RemainingArgs()
+		if len(names) == 0 {
+			return c.ArgErr()
+		}
+		if u.headerCasing == nil {
+			u.headerCasing = make(map[string]string)
+		}
+		for _, name := range names {
+			canonical := http.CanonicalHeaderKey(name)
+			if strings.ContainsAny(name, ": \t") || managedHeaders[canonical] {
+				return c.Errf("invalid header name '%s'", name)
+			}
+			u.headerCasing[canonical] = name
+		}
+	case "preserve_request_uri":
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		u.preserveRequestURI = true
+	case "decode_responses":
+		u.decodeResponses = "unsupported"
+		if c.NextArg() {
+			if c.Val() != "always" {
+				return c.Errf("invalid decode_responses mode '%s'", c.Val())
+			}
+			u.decodeResponses = c.Val()
+		}
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+	case "static_first":
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		u.staticFirst = true
+	case "honor_retry_after":
+		u.maxRetryAfter = DefaultMaxRetryAfter
+		if c.NextArg() {
+			dur, err := time.ParseDuration(c.Val())
+			if err != nil || dur <= 0 {
+				return c.Errf("invalid honor_retry_after maximum '%s'", c.Val())
+			}
+			u.maxRetryAfter = dur
+		}
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+	case "pool":
+		args := c.RemainingArgs()
+		if len(args) < 2 {
+			return c.ArgErr()
+		}
+		var hosts []string
+		for _, arg := range args[1:] {
+			parsed, err := parseUpstream(arg)
+			if err != nil {
+				return err
+			}
+			hosts = append(hosts, parsed...)
+		}
+		if err := u.routing().addPool(args[0], hosts); err != nil {
+			return c.Err(err.Error())
+		}
+	case "route":
+		args := c.RemainingArgs()
+		if len(args) < 2 || len(args) > 3 {
+			return c.ArgErr()
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(args[1], "%"), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return c.Errf("invalid route percentage '%s'", args[1])
+		}
+		rule := &RoutingRule{Pool: args[0], Percent: percent}
+		if len(args) > 2 {
+			times := strings.Split(args[2], "-")
+			if len(times) != 2 {
+				return c.Errf("invalid route times '%s'", args[2])
+			}
+			if rule.From, err = httpserver.ParseTimeOfDay(times[0]); err == nil {
+				rule.To, err = httpserver.ParseTimeOfDay(times[1])
+			}
+			if err != nil {
+				return c.Errf("invalid route times '%s'", args[2])
+			}
+		}
+		u.routing().Rules = append(u.routing().Rules, rule)
+	case "route_when":
+		args := c.RemainingArgs()
+		if len(args) < 2 {
+			return c.ArgErr()
+		}
+		rule := &RoutingRule{Pool: args[0]}
+		if len(args) == 2 && httpserver.IsMatcherRef(args[1]) {
+			// resolved once the matchers of the site are known
+			rule.matcherRef = args[1]
+		} else {
+			expr, err := httpserver.ParseExprArgs(args[1:])
+			if err != nil {
+				return c.Errf("invalid route_when condition: %v", err)
+			}
+			rule.When = expr
+		}
+		u.routing().Rules = append(u.routing().Rules, rule)
+	case "route_timezone":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		loc, err := time.LoadLocation(c.Val())
+		if err != nil {
+			return c.Errf("invalid route_timezone '%s'", c.Val())
+		}
+		u.routing().Location = loc
+		if c.NextArg() {
+			return c.ArgErr()
+		}
 	case "insecure_skip_verify":
 		u.insecureSkipVerify = true
 	case "keepalive":
@@ -359,6 +966,18 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream) error {
 	return nil
 }
 
+// managedHeaders are the header fields the http package
+// itself writes, unless they are there in canonical case,
+// so their case cannot be preserved.
+var managedHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Date":              true,
+	"Host":              true,
+	"Transfer-Encoding": true,
+}
+
 func (u *staticUpstream) healthCheck() {
 	for _, host := range u.Hosts {
 		hostURL := host.Name + u.HealthCheck.Path
@@ -369,7 +988,9 @@ func (u *staticUpstream) healthCheck() {
 		} else {
 			host.Unhealthy = true
 		}
+		host.noteHealth(host.Down())
 	}
+	atomic.StoreInt64(&u.lastHealthCheck, time.Now().UnixNano())
 }
 
 func (u *staticUpstream) HealthCheckWorker(stop chan struct{}) {
@@ -388,7 +1009,67 @@ func (u *staticUpstream) HealthCheckWorker(stop chan struct{}) {
 }
 
 func (u *staticUpstream) Select(r *http.Request) *UpstreamHost {
+	if u.DebugOverride != nil {
+		if host, ok := u.DebugOverride.host(r, u.Hosts); ok {
+			return host
+		}
+	}
+	host := u.selectHost(r)
+	if host != nil || u.Queue == nil {
+		return host
+	}
+	// wait for a connection to be freed if the hosts are
+	// only unavailable because they have too many
+	deadline := time.Now().Add(u.Queue.Timeout)
+	for again := false; host == nil && u.allFull(); again = true {
+		if !u.Queue.wait(r, again, deadline, u.allFull) {
+			return nil
+		}
+		host = u.selectHost(r)
+	}
+	return host
+}
+
+// allFull returns whether there are hosts that are not
+// down, and all of them have their maximum connections.
+func (u *staticUpstream) allFull() bool {
+	var up bool
+	for _, host := range u.Hosts {
+		if host.Down() {
+			continue
+		}
+		if !host.Full() {
+			return false
+		}
+		up = true
+	}
+	return up
+}
+
+// releaseConn implements connReleaser.
+func (u *staticUpstream) releaseConn(host *UpstreamHost) {
+	if u.Queue != nil {
+		u.Queue.release()
+	}
+}
+
+// selectHost selects a host of u to send r to, or returns
+// nil if none is available.
+func (u *staticUpstream) selectHost(r *http.Request) *UpstreamHost {
+	if u.Lookup != nil {
+		// hosts the service maps a request to are
+		// the only ones it may go to
+		if host, ok := u.Lookup.host(r); ok {
+			return host
+		}
+	}
 	pool := u.Hosts
+	if u.Routing != nil {
+		pool = u.Routing.pool(r, time.Now())
+	}
+	if u.hasBackups {
+		pool = failover(pool)
+	}
 	if len(pool) == 1 {
 		if !pool[0].Available() {
 			return nil
@@ -405,10 +1086,174 @@ func (u *staticUpstream) Select(r *http.Request) *UpstreamHost {
 	if allUnavailable {
 		return nil
 	}
+	if u.ClientConnections != nil {
+		if host := u.ClientConnections.lookup(r); host != nil {
+			return host
+		}
+	}
+	if u.Affinity != nil {
+		if host := u.Affinity.lookup(r, pool); host != nil {
+			return host
+		}
+	}
+	if u.OutlierDetection != nil {
+		pool = u.OutlierDetection.filter(pool)
+	}
+	var host *UpstreamHost
 	if u.Policy == nil {
-		return (&Random{}).Select(pool, r)
+		host = (&Random{}).Select(pool, r)
+	} else {
+		host = u.Policy.Select(pool, r)
+	}
+	if u.Affinity != nil && host != nil {
+		u.Affinity.remember(u.Affinity.sessionKey(r), host)
 	}
-	return u.Policy.Select(pool, r)
+	if u.ClientConnections != nil && host != nil {
+		u.ClientConnections.remember(r, host)
+	}
+	return host
+}
+
+// failover returns the hosts of pool that are not backups or,
+// if none of them is available, the backup hosts.
+func failover(pool HostPool) HostPool {
+	var primaries, backups HostPool
+	for _, host := range pool {
+		if host.Backup {
+			backups = append(backups, host)
+		} else {
+			primaries = append(primaries, host)
+		}
+	}
+	for _, host := range primaries {
+		if host.Available() {
+			return primaries
+		}
+	}
+	return backups
+}
+
+// outlierDetection returns u.OutlierDetection, creating
+// it with Interval unset if necessary.
+func (u *staticUpstream) routing() *Routing {
+	if u.Routing == nil {
+		u.Routing = newRouting()
+	}
+	return u.Routing
+}
+
+func (u *staticUpstream) webSocket() *WebSocketInspection {
+	if u.WebSocket == nil {
+		u.WebSocket = newWebSocketInspection()
+	}
+	return u.WebSocket
+}
+
+func (u *staticUpstream) outlierDetection() *OutlierDetection {
+	if u.OutlierDetection == nil {
+		u.OutlierDetection = newOutlierDetection()
+		u.OutlierDetection.Interval = 0
+	}
+	return u.OutlierDetection
+}
+
+// observe implements hostObserver.
+func (u *staticUpstream) observe(host *UpstreamHost, failed bool, latency time.Duration) {
+	if u.OutlierDetection != nil {
+		u.OutlierDetection.observe(u.Hosts, host, failed, latency)
+	}
+}
+
+// countRequest implements retryBudgeter.
+func (u *staticUpstream) countRequest() {
+	if u.RetryBudget != nil {
+		u.RetryBudget.request(time.Now())
+	}
+}
+
+// allowRetry implements retryBudgeter.
+func (u *staticUpstream) allowRetry() bool {
+	return u.RetryBudget == nil || u.RetryBudget.allowRetry(time.Now())
+}
+
+// affinity returns u.Affinity, creating it if necessary.
+func (u *staticUpstream) affinity() *Affinity {
+	if u.Affinity == nil {
+		u.Affinity = &Affinity{TTL: DefaultAffinityTTL}
+	}
+	return u.Affinity
+}
+
+// updateResponse implements responseUpdater.
+func (u *staticUpstream) updateResponse(r *http.Request, host *UpstreamHost, next respUpdateFn) respUpdateFn {
+	if u.Affinity != nil {
+		next = u.Affinity.recordSession(host, next)
+	}
+	if u.UnavailablePage != nil {
+		next = u.UnavailablePage.resetBackoff(r, next)
+	}
+	return next
+}
+
+// serveUnavailable implements unavailableResponder.
+func (u *staticUpstream) serveUnavailable(w http.ResponseWriter, r *http.Request) bool {
+	if u.UnavailablePage == nil {
+		return false
+	}
+	u.UnavailablePage.serve(w, r, u.retryAfter())
+	return true
+}
+
+// collapse implements requestCollapser.
+func (u *staticUpstream) collapse(w http.ResponseWriter, r *http.Request, proxy func(http.ResponseWriter) (int, error)) (int, error) {
+	if u.Collapser == nil {
+		return proxy(w)
+	}
+	return u.Collapser.serve(w, r, proxy)
+}
+
+// mirror implements requestMirror.
+func (u *staticUpstream) mirror(outreq *http.Request, body []byte) {
+	if u.Mirror != nil {
+		u.Mirror.send(outreq, body)
+	}
+}
+
+// controlHeaders implements controlHeaderer.
+func (u *staticUpstream) controlHeaders() []string {
+	if u.DebugOverride == nil {
+		return nil
+	}
+	return []string{u.DebugOverride.Header}
+}
+
+// serveCached implements responseCacher.
+func (u *staticUpstream) serveCached(w http.ResponseWriter, r *http.Request, proxy func(http.ResponseWriter, *http.Request) (int, error)) (int, error) {
+	if u.Cache == nil {
+		return proxy(w, r)
+	}
+	return u.Cache.serve(w, r, proxy)
+}
+
+// retryAfter estimates how long it will be until a host is
+// available again: until the next health check, if there are
+// health checks, or else until failures are forgotten.
+func (u *staticUpstream) retryAfter() time.Duration {
+	if u.HealthCheck.Path != "" && u.HealthCheck.Interval > 0 {
+		last := atomic.LoadInt64(&u.lastHealthCheck)
+		if last == 0 {
+			return u.HealthCheck.Interval
+		}
+		next := time.Unix(0, last).Add(u.HealthCheck.Interval)
+		if d := next.Sub(time.Now()); d > 0 {
+			return d
+		}
+		return time.Second // a check is due
+	}
+	if u.FailTimeout > 0 {
+		return u.FailTimeout
+	}
+	return defaultRetryAfter
 }
 
 func (u *staticUpstream) AllowedPath(requestPath string) bool {
@@ -430,6 +1275,13 @@ func (u *staticUpstream) GetTryInterval() time.Duration {
 	return u.TryInterval
 }
 
+// ConfigurablePolicy is a Policy that takes the arguments
+// given after its name in the policy property.
+type ConfigurablePolicy interface {
+	Policy
+	Configure(args []string) error
+}
+
 // RegisterPolicy adds a custom policy to the proxy.
 func RegisterPolicy(name string, policy func() Policy) {
 	supportedPolicies[name] = policy
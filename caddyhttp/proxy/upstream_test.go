@@ -2,6 +2,8 @@ package proxy
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -226,3 +228,162 @@ func TestParseBlock(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePreserveHeaderCase(t *testing.T) {
+	tests := []struct {
+		config    string
+		shouldErr bool
+		expected  map[string]string
+	}{
+		{"proxy / a {\n preserve_header_case SOAPAction x-legacy-ID \n}", false, map[string]string{
+			"Soapaction": "SOAPAction", "X-Legacy-Id": "x-legacy-ID",
+		}},
+		{"proxy / a {\n preserve_header_case SOAPAction \n preserve_header_case ETag \n}", false, map[string]string{
+			"Soapaction": "SOAPAction", "Etag": "ETag",
+		}},
+		{"proxy / a {\n preserve_header_case \n}", true, nil},
+		{"proxy / a {\n preserve_header_case X-A:b \n}", true, nil},
+		{"proxy / a {\n preserve_header_case content-type \n}", true, nil},
+	}
+
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		got := upstreams[0].(*staticUpstream).Hosts[0].ReverseProxy.HeaderCasing
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Test %d: Expected casing %v, got %v", i, test.expected, got)
+		}
+	}
+}
+
+func TestParsePreserveRequestURI(t *testing.T) {
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader("proxy / a {\n preserve_request_uri \n}")))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !upstreams[0].(*staticUpstream).Hosts[0].ReverseProxy.PreserveRequestURI {
+		t.Error("Expected request-URI to be preserved")
+	}
+	_, err = NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader("proxy / a {\n preserve_request_uri on \n}")))
+	if err == nil {
+		t.Error("Expected error for argument")
+	}
+}
+
+func TestParseUpstreamWeight(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		weights   []int
+	}{
+		{"proxy / a {\n upstream b weight=5 \n upstream c \n}", false, []int{1, 5, 1}},
+		{"proxy / {\n upstream srv:8080-8081 weight=2 \n}", false, []int{2, 2}},
+		{"proxy / a {\n upstream b weight=0 \n}", true, nil},
+		{"proxy / a {\n upstream b weight=x \n}", true, nil},
+		{"proxy / a {\n upstream b heavy \n}", true, nil},
+	} {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.input)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		hosts := upstreams[0].(*staticUpstream).Hosts
+		if len(hosts) != len(test.weights) {
+			t.Fatalf("Test %d: Expected %d hosts, got %d", i, len(test.weights), len(hosts))
+		}
+		for j, host := range hosts {
+			if host.Weight != test.weights[j] {
+				t.Errorf("Test %d: Expected host %s to have weight %d, got %d", i, host.Name, test.weights[j], host.Weight)
+			}
+		}
+	}
+}
+
+func TestParsePolicyArgs(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  Policy
+	}{
+		{"proxy / a b {\n policy header X-Tenant-ID \n}", false, &HeaderHash{Name: "X-Tenant-ID"}},
+		{"proxy / a b {\n policy cookie session_id \n}", false, &CookieHash{Name: "session_id"}},
+		{"proxy / a b {\n policy header \n}", true, nil},
+		{"proxy / a b {\n policy cookie a b \n}", true, nil},
+		{"proxy / a b {\n policy round_robin fast \n}", true, nil},
+	} {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.input)))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if policy := upstreams[0].(*staticUpstream).Policy; !reflect.DeepEqual(policy, test.expected) {
+			t.Errorf("Test %d: Expected policy %#v, got %#v", i, test.expected, policy)
+		}
+	}
+}
+
+func TestSelectBackup(t *testing.T) {
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(
+		"proxy / a b {\n upstream c backup \n upstream d:80-81 weight=2 backup \n policy round_robin \n}")))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	upstream := upstreams[0].(*staticUpstream)
+	hosts := upstream.Hosts
+	for i, expected := range []bool{false, false, true, true, true} {
+		if hosts[i].Backup != expected {
+			t.Errorf("Expected host %s to be a backup: %v", hosts[i].Name, expected)
+		}
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+
+	for i := 0; i < 4; i++ {
+		if h := upstream.Select(r); h == nil || h.Backup {
+			t.Fatalf("Expected a primary host while primaries are available, got %v", h)
+		}
+	}
+	hosts[0].Unhealthy = true
+	for i := 0; i < 4; i++ {
+		if h := upstream.Select(r); h != hosts[1] {
+			t.Fatalf("Expected the available primary host, got %v", h)
+		}
+	}
+	hosts[1].MaxConns = 1
+	hosts[1].Conns = 1
+	for i := 0; i < 4; i++ {
+		if h := upstream.Select(r); h == nil || !h.Backup {
+			t.Fatalf("Expected a backup host when primaries are down or full, got %v", h)
+		}
+	}
+	for _, host := range hosts[2:] {
+		host.Unhealthy = true
+	}
+	if h := upstream.Select(r); h != nil {
+		t.Errorf("Expected no host when backups are down too, got %s", h.Name)
+	}
+	hosts[0].Unhealthy = false
+	if h := upstream.Select(r); h != hosts[0] {
+		t.Errorf("Expected a recovered primary host to be selected, got %v", h)
+	}
+}
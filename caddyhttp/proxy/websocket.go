@@ -0,0 +1,350 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WebSocketInspection inspects the messages of proxied WebSocket
+// connections, after the upgrade, limiting their size and rate
+// and passing them to inspectors, which may veto them. A
+// connection breaking the rules is closed.
+type WebSocketInspection struct {
+	// The largest message either side may send, in bytes; 0 is
+	// no limit, unless there are inspectors, for which messages
+	// are buffered: then DefaultWebSocketMaxMessage is the limit.
+	MaxMessage int64
+
+	// How many messages the client may send per Per; 0 is no limit
+	Rate int
+	Per  time.Duration
+
+	// Inspectors see each message before it is forwarded
+	Inspectors []WebSocketInspector
+}
+
+// WebSocketInspector observes the messages of WebSocket connections.
+type WebSocketInspector interface {
+	// InspectMessage is called with each message, once it is
+	// complete and before it is forwarded; r is the request that
+	// upgraded the connection. Returning an error vetoes the
+	// message, closing the connection.
+	InspectMessage(r *http.Request, msg *WebSocketMessage) error
+}
+
+// WebSocketMessage is a message of a WebSocket connection.
+type WebSocketMessage struct {
+	// Whether the client sent the message, else the backend
+	FromClient bool
+
+	// WebSocketText or WebSocketBinary
+	Opcode byte
+
+	// Whether the payload is compressed by an extension,
+	// such as permessage-deflate
+	Compressed bool
+
+	// The unmasked payload; it is only valid during the call
+	Payload []byte
+}
+
+// The opcodes of WebSocket data messages.
+const (
+	WebSocketText   byte = 1
+	WebSocketBinary byte = 2
+)
+
+// The status codes a connection is closed with.
+const (
+	closeProtocolError   = 1002
+	closePolicyViolation = 1008
+	closeMessageTooBig   = 1009
+)
+
+// webSocketViolation is why a connection is closed.
+type webSocketViolation struct {
+	code   int
+	reason string
+}
+
+func newWebSocketInspection() *WebSocketInspection {
+	return &WebSocketInspection{Per: time.Second}
+}
+
+func (w *WebSocketInspection) maxMessage() int64 {
+	if w.MaxMessage == 0 && len(w.Inspectors) > 0 {
+		return DefaultWebSocketMaxMessage
+	}
+	return w.MaxMessage
+}
+
+// proxy relays the WebSocket connection between client and
+// backend, whose upgrade response, not yet sent to the client,
+// is read from fromBackend, followed by the messages, until
+// the backend closes it or it breaks the rules.
+func (w *WebSocketInspection) proxy(r *http.Request, client, backend net.Conn, fromBackend io.Reader) {
+	toClient := &frameWriter{w: client}
+	fromBackendBuf := bufio.NewReader(fromBackend)
+	if err := copyResponseHead(toClient, fromBackendBuf); err != nil {
+		return
+	}
+
+	var once sync.Once
+	stop := func(v *webSocketViolation) {
+		once.Do(func() {
+			log.Printf("[WARNING] proxy: closing WebSocket connection of %s: %s", r.RemoteAddr, v.reason)
+			// unblocks the relay from the backend
+			backend.Close()
+			toClient.writeClose(v.code, v.reason)
+			client.Close()
+		})
+	}
+	go func() {
+		if v := w.relay(r, &frameWriter{w: backend}, bufio.NewReader(client), true); v != nil {
+			stop(v)
+		}
+	}()
+	if v := w.relay(r, toClient, fromBackendBuf, false); v != nil {
+		stop(v)
+	}
+}
+
+// relay relays the messages from src to dst until src is
+// closed, returning why the connection is to be closed if
+// the messages break the rules.
+func (w *WebSocketInspection) relay(r *http.Request, dst *frameWriter, src *bufio.Reader, fromClient bool) *webSocketViolation {
+	maxMessage := w.maxMessage()
+	inspect := len(w.Inspectors) > 0
+
+	var (
+		inMessage   bool
+		msg         WebSocketMessage
+		size        int64
+		frames      []byte
+		windowStart time.Time
+		windowCount int
+	)
+	for {
+		h, err := readFrameHeader(src)
+		if err != nil {
+			return nil
+		}
+
+		// control frames are never fragmented and may come
+		// between the frames of a message
+		if h.opcode >= 8 {
+			if h.length > 125 || !h.fin {
+				return &webSocketViolation{closeProtocolError, "invalid control frame"}
+			}
+			if dst.copyFrame(h, src) != nil {
+				return nil
+			}
+			continue
+		}
+
+		if (h.opcode == 0) != inMessage {
+			return &webSocketViolation{closeProtocolError, "unexpected frame"}
+		}
+		if !inMessage {
+			inMessage, size = true, 0
+			msg = WebSocketMessage{FromClient: fromClient, Opcode: h.opcode, Compressed: h.rsv1, Payload: msg.Payload[:0]}
+			if fromClient && w.Rate > 0 {
+				if now := time.Now(); now.Sub(windowStart) >= w.Per {
+					windowStart, windowCount = now, 0
+				}
+				if windowCount++; windowCount > w.Rate {
+					return &webSocketViolation{closePolicyViolation, "message rate exceeded"}
+				}
+			}
+		}
+		if size += h.length; maxMessage > 0 && size > maxMessage {
+			return &webSocketViolation{closeMessageTooBig, "message too big"}
+		}
+
+		if !inspect {
+			if dst.copyFrame(h, src) != nil {
+				return nil
+			}
+		} else {
+			start := len(msg.Payload)
+			msg.Payload = append(msg.Payload, make([]byte, h.length)...)
+			if _, err := io.ReadFull(src, msg.Payload[start:]); err != nil {
+				return nil
+			}
+			frames = append(frames, h.raw...)
+			frames = append(frames, msg.Payload[start:]...)
+			if h.masked {
+				for i := range msg.Payload[start:] {
+					msg.Payload[start+i] ^= h.mask[i%4]
+				}
+			}
+		}
+		if !h.fin {
+			continue
+		}
+
+		inMessage = false
+		if inspect {
+			for _, inspector := range w.Inspectors {
+				if err := inspector.InspectMessage(r, &msg); err != nil {
+					return &webSocketViolation{closePolicyViolation, err.Error()}
+				}
+			}
+			if dst.write(frames) != nil {
+				return nil
+			}
+			frames = frames[:0]
+		}
+	}
+}
+
+// frameHeader is the header of a WebSocket frame.
+type frameHeader struct {
+	raw    []byte
+	fin    bool
+	rsv1   bool
+	opcode byte
+	masked bool
+	mask   [4]byte
+	length int64
+}
+
+func readFrameHeader(r io.Reader) (frameHeader, error) {
+	var h frameHeader
+	var b [14]byte
+	if _, err := io.ReadFull(r, b[:2]); err != nil {
+		return h, err
+	}
+	h.fin = b[0]&0x80 != 0
+	h.rsv1 = b[0]&0x40 != 0
+	h.opcode = b[0] & 0x0f
+	h.masked = b[1]&0x80 != 0
+
+	n := 2
+	switch length := b[1] & 0x7f; length {
+	case 126:
+		if _, err := io.ReadFull(r, b[n:n+2]); err != nil {
+			return h, err
+		}
+		h.length = int64(binary.BigEndian.Uint16(b[n:]))
+		n += 2
+	case 127:
+		if _, err := io.ReadFull(r, b[n:n+8]); err != nil {
+			return h, err
+		}
+		l := binary.BigEndian.Uint64(b[n:])
+		if l > 1<<63-1 {
+			return h, errors.New("invalid frame length")
+		}
+		h.length = int64(l)
+		n += 8
+	default:
+		h.length = int64(length)
+	}
+	if h.masked {
+		if _, err := io.ReadFull(r, b[n:n+4]); err != nil {
+			return h, err
+		}
+		copy(h.mask[:], b[n:])
+		n += 4
+	}
+	h.raw = append([]byte(nil), b[:n]...)
+	return h, nil
+}
+
+// copyResponseHead copies the head of the response to the
+// upgrade request, up to the empty line, from src to dst.
+func copyResponseHead(dst *frameWriter, src *bufio.Reader) error {
+	var head []byte
+	for {
+		line, err := src.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull {
+			return err
+		}
+		head = append(head, line...)
+		if len(head) > maxResponseHead {
+			return errors.New("response head too large")
+		}
+		if bytes.Equal(line, []byte("\r\n")) || bytes.Equal(line, []byte("\n")) {
+			return dst.write(head)
+		}
+	}
+}
+
+// frameWriter writes whole frames to a connection, so
+// frames written concurrently do not interleave.
+type frameWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (fw *frameWriter) write(b []byte) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	_, err := fw.w.Write(b)
+	return err
+}
+
+// copyFrame writes the frame with header h, whose
+// payload is read from src.
+func (fw *frameWriter) copyFrame(h frameHeader, src io.Reader) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if _, err := fw.w.Write(h.raw); err != nil {
+		return err
+	}
+	_, err := io.CopyN(fw.w, src, h.length)
+	return err
+}
+
+// writeClose writes a close frame, as a server does, with
+// the status code and reason.
+func (fw *frameWriter) writeClose(code int, reason string) error {
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	frame := []byte{0x88, byte(2 + len(reason)), byte(code >> 8), byte(code)}
+	return fw.write(append(frame, reason...))
+}
+
+// RegisterWebSocketInspector adds a custom WebSocket
+// inspector to the proxy.
+func RegisterWebSocketInspector(name string, inspector func() WebSocketInspector) {
+	supportedWebSocketInspectors[name] = inspector
+}
+
+var supportedWebSocketInspectors = make(map[string]func() WebSocketInspector)
+
+func init() {
+	RegisterWebSocketInspector("log", func() WebSocketInspector { return logInspector{} })
+}
+
+// logInspector logs every message.
+type logInspector struct{}
+
+// InspectMessage implements WebSocketInspector.
+func (logInspector) InspectMessage(r *http.Request, msg *WebSocketMessage) error {
+	from := "backend"
+	if msg.FromClient {
+		from = "client"
+	}
+	log.Printf("[INFO] proxy: WebSocket %s of %s: %d byte message from %s",
+		r.URL.Path, r.RemoteAddr, len(msg.Payload), from)
+	return nil
+}
+
+const (
+	// DefaultWebSocketMaxMessage is the largest message
+	// inspectors are passed, if no limit is set.
+	DefaultWebSocketMaxMessage = 1 << 20
+
+	maxResponseHead = 64 * 1024
+)
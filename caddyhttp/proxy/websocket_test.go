@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"golang.org/x/net/websocket"
+)
+
+// recordingInspector records the messages it sees,
+// vetoing those that say "forbidden".
+type recordingInspector struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (ri *recordingInspector) InspectMessage(r *http.Request, msg *WebSocketMessage) error {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	from := "backend"
+	if msg.FromClient {
+		from = "client"
+	}
+	ri.messages = append(ri.messages, from+": "+string(msg.Payload))
+	if string(msg.Payload) == "forbidden" {
+		return errors.New("forbidden message")
+	}
+	return nil
+}
+
+func maskedFrame(first byte, payload string) []byte {
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{first, 0x80 | byte(len(payload))}, mask...)
+	for i := range payload {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	return frame
+}
+
+func TestWebSocketRelay(t *testing.T) {
+	var in []byte
+	in = append(in, maskedFrame(0x01, "Hel")...) // text, not final
+	in = append(in, maskedFrame(0x89, "ping")...)
+	in = append(in, maskedFrame(0x80, "lo")...) // final continuation
+	in = append(in, maskedFrame(0x82, "\x00\x01")...)
+
+	inspector := &recordingInspector{}
+	w := &WebSocketInspection{Inspectors: []WebSocketInspector{inspector}}
+	var out bytes.Buffer
+	req := httptest.NewRequest("GET", "/", nil)
+	if v := w.relay(req, &frameWriter{w: &out}, bufio.NewReader(bytes.NewReader(in)), true); v != nil {
+		t.Fatalf("Expected no violation, got %+v", v)
+	}
+	// the ping is forwarded while the message is inspected
+	var expectedOut []byte
+	expectedOut = append(expectedOut, maskedFrame(0x89, "ping")...)
+	expectedOut = append(expectedOut, maskedFrame(0x01, "Hel")...)
+	expectedOut = append(expectedOut, maskedFrame(0x80, "lo")...)
+	expectedOut = append(expectedOut, maskedFrame(0x82, "\x00\x01")...)
+	if !bytes.Equal(out.Bytes(), expectedOut) {
+		t.Errorf("Expected frames forwarded as they were, got %v", out.Bytes())
+	}
+	expected := []string{"client: Hello", "client: \x00\x01"}
+	if strings.Join(inspector.messages, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected messages %q, got %q", expected, inspector.messages)
+	}
+
+	for i, test := range []struct {
+		frames       []byte
+		expectedCode int
+	}{
+		{maskedFrame(0x80, "stray"), closeProtocolError},
+		{append(maskedFrame(0x01, "a"), maskedFrame(0x81, "b")...), closeProtocolError},
+		{maskedFrame(0x09, "unfinished ping"), closeProtocolError},
+		{maskedFrame(0x81, strings.Repeat("x", 11)), closeMessageTooBig},
+		{append(maskedFrame(0x01, "123456"), maskedFrame(0x80, "789012")...), closeMessageTooBig},
+		{bytes.Repeat(maskedFrame(0x81, "hi"), 3), closePolicyViolation},
+	} {
+		w := &WebSocketInspection{MaxMessage: 10, Rate: 2, Per: time.Minute}
+		v := w.relay(req, &frameWriter{w: ioutil.Discard}, bufio.NewReader(bytes.NewReader(test.frames)), true)
+		if v == nil || v.code != test.expectedCode {
+			t.Errorf("Test %d: Expected close with %d, got %+v", i, test.expectedCode, v)
+		}
+	}
+}
+
+func TestWebSocketInspection(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	wsEcho := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		io.Copy(ws, ws)
+	}))
+	defer wsEcho.Close()
+
+	for i, test := range []struct {
+		config       string
+		send         []string
+		expectEchoes int
+	}{
+		{"websocket", []string{"hello", "forbidden", "never"}, 1},
+		{"websocket \n websocket_max_message 8", []string{"short", "far too long", "never"}, 1},
+		{"websocket \n websocket_rate 2 1m", []string{"one", "two", "three"}, 2},
+	} {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+			strings.NewReader("proxy / "+wsEcho.URL+" {\n "+test.config+" \n}")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		inspector := &recordingInspector{}
+		upstream := upstreams[0].(*staticUpstream)
+		upstream.webSocket().Inspectors = []WebSocketInspector{inspector}
+		upstream.Hosts[0].ReverseProxy.WebSocket = upstream.WebSocket
+		p := &Proxy{Next: httpserver.EmptyNext, Upstreams: upstreams}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p.ServeHTTP(w, r)
+		}))
+
+		ws, err := websocket.Dial(strings.Replace(server.URL, "http://", "ws://", 1), "", server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		echoes := 0
+		for _, msg := range test.send {
+			if websocket.Message.Send(ws, msg) != nil {
+				break
+			}
+			var echo string
+			if websocket.Message.Receive(ws, &echo) != nil {
+				break
+			}
+			if echo != msg {
+				t.Errorf("Test %d: Expected echo '%s', got '%s'", i, msg, echo)
+			}
+			echoes++
+		}
+		if echoes != test.expectEchoes {
+			t.Errorf("Test %d: Expected %d echoes before the connection was closed, got %d (seen %q)",
+				i, test.expectEchoes, echoes, inspector.messages)
+		}
+		ws.Close()
+		server.Close()
+	}
+}
+
+func TestParseWebSocketInspection(t *testing.T) {
+	for i, test := range []struct {
+		config    string
+		shouldErr bool
+	}{
+		{"websocket_max_message 64KB \n websocket_rate 10 \n websocket_inspect log", false},
+		{"websocket_rate 10 1m", false},
+		{"websocket_max_message", true},
+		{"websocket_max_message 0", true},
+		{"websocket_max_message lots", true},
+		{"websocket_rate", true},
+		{"websocket_rate 0", true},
+		{"websocket_rate 10 never", true},
+		{"websocket_rate 10 1s 2", true},
+		{"websocket_inspect", true},
+		{"websocket_inspect nosy", true},
+	} {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+			strings.NewReader("proxy / localhost:8080 {\n "+test.config+" \n}")))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		upstream := upstreams[0].(*staticUpstream)
+		if upstream.WebSocket == nil || upstream.Hosts[0].ReverseProxy.WebSocket != upstream.WebSocket {
+			t.Errorf("Test %d: Expected WebSocket inspection for the hosts", i)
+		}
+	}
+}
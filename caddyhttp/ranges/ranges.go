@@ -0,0 +1,77 @@
+// Package ranges configures the byte ranges that may be requested
+// of the static files of a site, to stop clients from abusing range
+// requests for large files to exhaust the server.
+package ranges
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+func init() {
+	caddy.RegisterPlugin("ranges", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupRanges,
+	})
+}
+
+// setupRanges sets the range policy of the site. Syntax:
+//
+//	ranges {
+//	    max      count
+//	    disable  paths...
+//	}
+//
+// Requests for more than count ranges get the whole file, as do
+// requests for ranges of files under the disabled path prefixes.
+func setupRanges(c *caddy.Controller) error {
+	policy, err := parseRanges(c)
+	if err != nil {
+		return err
+	}
+	httpserver.GetConfig(c).Ranges = policy
+	return nil
+}
+
+func parseRanges(c *caddy.Controller) (staticfiles.RangePolicy, error) {
+	var policy staticfiles.RangePolicy
+
+	for c.Next() {
+		if len(c.RemainingArgs()) > 0 {
+			return policy, c.ArgErr()
+		}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "max":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return policy, c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 1 {
+					return policy, c.Errf("ranges: invalid count '%s'", args[0])
+				}
+				policy.MaxRanges = n
+			case "disable":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return policy, c.ArgErr()
+				}
+				for _, path := range args {
+					if !strings.HasPrefix(path, "/") {
+						return policy, c.Errf("ranges: invalid path '%s'", path)
+					}
+				}
+				policy.Disabled = append(policy.Disabled, args...)
+			default:
+				return policy, c.Errf("ranges: unknown property '%s'", c.Val())
+			}
+		}
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,59 @@
+package ranges
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+func TestSetupRanges(t *testing.T) {
+	cases := []struct {
+		input    string
+		hasError bool
+		expected staticfiles.RangePolicy
+	}{
+		{`ranges {
+			max 5
+			disable /videos /isos
+			disable /backups
+		}`, false, staticfiles.RangePolicy{MaxRanges: 5, Disabled: []string{"/videos", "/isos", "/backups"}}},
+		{`ranges {
+			max 1
+		}`, false, staticfiles.RangePolicy{MaxRanges: 1}},
+
+		// Wrong formats
+		{`ranges 5`, true, staticfiles.RangePolicy{}},
+		{`ranges {
+			max
+		}`, true, staticfiles.RangePolicy{}},
+		{`ranges {
+			max 0
+		}`, true, staticfiles.RangePolicy{}},
+		{`ranges {
+			disable videos
+		}`, true, staticfiles.RangePolicy{}},
+		{`ranges {
+			disable
+		}`, true, staticfiles.RangePolicy{}},
+		{`ranges {
+			overlaps 2
+		}`, true, staticfiles.RangePolicy{}},
+	}
+	for caseNum, c := range cases {
+		controller := caddy.NewTestController("http", c.input)
+		err := setupRanges(controller)
+
+		if c.hasError && (err == nil) {
+			t.Errorf("Expecting error for case %v but none encountered", caseNum)
+		}
+		if !c.hasError && (err != nil) {
+			t.Errorf("Expecting no error for case %v but encountered %v", caseNum, err)
+		}
+		if actual := httpserver.GetConfig(controller).Ranges; !c.hasError && !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("Case %v: Expected %+v, got %+v", caseNum, c.expected, actual)
+		}
+	}
+}
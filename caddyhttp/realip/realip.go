@@ -0,0 +1,131 @@
+// Package realip provides middleware that takes the address of the
+// client of a request from the header a trusted proxy in front of
+// the server sets, so that {remote}, the logs and the middleware
+// that limit or filter clients all see the client, not the proxy.
+package realip
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// RealIP is middleware that sets the remote address of
+// requests from trusted proxies to that of their client.
+type RealIP struct {
+	Next httpserver.Handler
+
+	// Header the client address is taken from, such as
+	// X-Forwarded-For, X-Real-IP, CF-Connecting-IP or Forwarded
+	Header string
+
+	// Hops is how many proxies append to a list header, such
+	// as X-Forwarded-For: the client is the address that many
+	// from the end. If 0, the list is read from the end until
+	// an address that is not trusted.
+	Hops int
+
+	// Trusted are the networks of the proxies
+	// whose header is taken for the truth
+	Trusted []*net.IPNet
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (ri RealIP) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	host, port, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ri.trusted(net.ParseIP(host)) {
+		if ip := ri.clientIP(r.Header); ip != nil {
+			// the proxy's address stays available as {peer}
+			r = httpserver.SetRequestPlaceholder(r, "peer", r.RemoteAddr)
+			if port == "" {
+				r.RemoteAddr = ip.String()
+			} else {
+				r.RemoteAddr = net.JoinHostPort(ip.String(), port)
+			}
+		}
+	}
+	return ri.Next.ServeHTTP(w, r)
+}
+
+// clientIP returns the address of the client in h,
+// or nil if there is none.
+func (ri RealIP) clientIP(h http.Header) net.IP {
+	values := h[http.CanonicalHeaderKey(ri.Header)]
+	if len(values) == 0 {
+		return nil
+	}
+	if !isListHeader(ri.Header) {
+		return net.ParseIP(strings.TrimSpace(values[len(values)-1]))
+	}
+
+	// the header may be split across lines
+	var list []string
+	for _, v := range values {
+		list = append(list, strings.Split(v, ",")...)
+	}
+	parse := parseAddress
+	if strings.EqualFold(ri.Header, "Forwarded") {
+		parse = parseForwarded
+	}
+
+	if ri.Hops > 0 {
+		i := len(list) - ri.Hops
+		if i < 0 {
+			i = 0
+		}
+		return parse(list[i])
+	}
+	var ip net.IP
+	for i := len(list) - 1; i >= 0; i-- {
+		if ip = parse(list[i]); ip == nil || !ri.trusted(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+func (ri RealIP) trusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range ri.Trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isListHeader returns whether every proxy appends the
+// address it was sent by to the header field.
+func isListHeader(field string) bool {
+	return strings.EqualFold(field, "X-Forwarded-For") || strings.EqualFold(field, "Forwarded")
+}
+
+// parseAddress parses an address in a list header,
+// which may have a port and brackets.
+func parseAddress(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+}
+
+// parseForwarded parses the for parameter of an element
+// of a Forwarded header (RFC 7239), such as
+// for="[2001:db8::1]:4711";proto=https.
+func parseForwarded(element string) net.IP {
+	for _, pair := range strings.Split(element, ";") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) > 4 && strings.EqualFold(pair[:4], "for=") {
+			return parseAddress(strings.Trim(pair[4:], `"`))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package realip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted := func(networks ...string) RealIP {
+		var ri RealIP
+		if err := ri.addTrusted(networks); err != nil {
+			t.Fatal(err)
+		}
+		return ri
+	}
+
+	for i, test := range []struct {
+		header     string
+		hops       int
+		trusted    []string
+		remoteAddr string
+		values     []string
+		expected   string
+	}{
+		// untrusted peers are not believed
+		{"X-Forwarded-For", 0, []string{"10.0.0.0/8"}, "203.0.113.9:1234", []string{"198.51.100.1"}, "203.0.113.9:1234"},
+		{"X-Forwarded-For", 0, []string{"10.0.0.0/8"}, "10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1:1234"},
+		{"X-Forwarded-For", 0, []string{"10.0.0.0/8"}, "10.0.0.1:1234", nil, "10.0.0.1:1234"},
+		{"X-Forwarded-For", 0, []string{"10.0.0.0/8"}, "10.0.0.1:1234", []string{"garbage"}, "10.0.0.1:1234"},
+		// spoofed addresses on the left are skipped
+		{"X-Forwarded-For", 0, []string{"10.0.0.0/8"}, "10.0.0.1:1234", []string{"1.2.3.4, 198.51.100.1, 10.0.0.2"}, "198.51.100.1:1234"},
+		{"X-Forwarded-For", 0, []string{"10.0.0.0/8"}, "10.0.0.1:1234", []string{"1.2.3.4", "198.51.100.1,10.0.0.2"}, "198.51.100.1:1234"},
+		{"X-Forwarded-For", 0, []string{"private"}, "[::1]:1234", []string{"2001:db8::1"}, "[2001:db8::1]:1234"},
+		{"X-Forwarded-For", 2, []string{"10.0.0.0/8"}, "10.0.0.1:1234", []string{"1.2.3.4, 198.51.100.1, 203.0.113.7"}, "198.51.100.1:1234"},
+		{"X-Forwarded-For", 5, []string{"10.0.0.0/8"}, "10.0.0.1:1234", []string{"198.51.100.1, 203.0.113.7"}, "198.51.100.1:1234"},
+		{"X-Real-IP", 0, []string{"10.0.0.0/8"}, "10.0.0.1:1234", []string{" 198.51.100.1 "}, "198.51.100.1:1234"},
+		{"Cf-Connecting-Ip", 0, []string{"10.0.0.0/8"}, "10.0.0.1:1234", []string{"2001:db8::2"}, "[2001:db8::2]:1234"},
+		{"Forwarded", 0, []string{"10.0.0.0/8"}, "10.0.0.1:1234",
+			[]string{`for=1.2.3.4, For="[2001:db8::1]:4711";proto=https, for=10.0.0.3;by=10.0.0.1`}, "[2001:db8::1]:1234"},
+		{"Forwarded", 0, []string{"10.0.0.0/8"}, "10.0.0.1:1234", []string{`for=_hidden;proto=https`}, "10.0.0.1:1234"},
+		{"Forwarded", 0, []string{"10.0.0.0/8"}, "10.0.0.1:1234", []string{`proto=https`}, "10.0.0.1:1234"},
+	} {
+		ri := trusted(test.trusted...)
+		ri.Header, ri.Hops = test.header, test.hops
+		var remote, peer string
+		ri.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			remote = r.RemoteAddr
+			peer = httpserver.NewReplacer(r, nil, "").Replace("{peer}")
+			return 0, nil
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		for _, v := range test.values {
+			req.Header.Add(test.header, v)
+		}
+		ri.ServeHTTP(httptest.NewRecorder(), req)
+		if remote != test.expected {
+			t.Errorf("Test %d: Expected remote address %s, got %s", i, test.expected, remote)
+		}
+		if remote != test.remoteAddr && peer != test.remoteAddr {
+			t.Errorf("Test %d: Expected {peer} to be %s, got %s", i, test.remoteAddr, peer)
+		}
+	}
+}
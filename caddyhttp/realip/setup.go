@@ -0,0 +1,125 @@
+package realip
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("real_ip", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new RealIP middleware instance. Syntax:
+//
+//	real_ip [networks...] {
+//	    from   networks...
+//	    header X-Forwarded-For|X-Real-IP|CF-Connecting-IP|Forwarded|field
+//	    hops   n
+//	}
+//
+// Networks are CIDR ranges, single addresses or "private", for the
+// loopback and private networks. Only requests from them are
+// trusted. The header is X-Forwarded-For by default.
+func setup(c *caddy.Controller) error {
+	ri, err := realIPParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		ri.Next = next
+		return ri
+	})
+
+	return nil
+}
+
+func realIPParse(c *caddy.Controller) (RealIP, error) {
+	ri := RealIP{Header: "X-Forwarded-For"}
+
+	var seen bool
+	for c.Next() {
+		if seen {
+			return ri, c.Err("real_ip: can only be specified once per site")
+		}
+		seen = true
+
+		if err := ri.addTrusted(c.RemainingArgs()); err != nil {
+			return ri, c.Err("real_ip: " + err.Error())
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "from":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return ri, c.ArgErr()
+				}
+				if err := ri.addTrusted(args); err != nil {
+					return ri, c.Err("real_ip: " + err.Error())
+				}
+			case "header":
+				if !c.NextArg() {
+					return ri, c.ArgErr()
+				}
+				ri.Header = http.CanonicalHeaderKey(c.Val())
+				if c.NextArg() {
+					return ri, c.ArgErr()
+				}
+			case "hops":
+				if !c.NextArg() {
+					return ri, c.ArgErr()
+				}
+				n, err := strconv.Atoi(c.Val())
+				if err != nil || n < 1 {
+					return ri, c.Errf("real_ip: invalid hops '%s'", c.Val())
+				}
+				ri.Hops = n
+				if c.NextArg() {
+					return ri, c.ArgErr()
+				}
+			default:
+				return ri, c.Errf("real_ip: unknown property '%s'", c.Val())
+			}
+		}
+	}
+
+	if len(ri.Trusted) == 0 {
+		return ri, c.Err("real_ip: no trusted networks")
+	}
+	if ri.Hops > 0 && !isListHeader(ri.Header) {
+		return ri, c.Errf("real_ip: hops requires a list header, not %s", ri.Header)
+	}
+	return ri, nil
+}
+
+// addTrusted adds the networks to those trusted.
+func (ri *RealIP) addTrusted(networks []string) error {
+	for _, s := range networks {
+		if strings.ToLower(s) == "private" {
+			if err := ri.addTrusted(privateNetworks); err != nil {
+				return err
+			}
+			continue
+		}
+		n, err := httpserver.ParseIPRange(s)
+		if err != nil {
+			return err
+		}
+		ri.Trusted = append(ri.Trusted, n)
+	}
+	return nil
+}
+
+// privateNetworks are the loopback and private networks.
+var privateNetworks = []string{
+	"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16",
+	"::1/128", "fc00::/7",
+}
@@ -0,0 +1,86 @@
+package realip
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `real_ip 10.0.0.0/8`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	ri, ok := handler.(RealIP)
+	if !ok {
+		t.Fatalf("Expected handler to be type RealIP, got: %#v", handler)
+	}
+	if !httpserver.SameNext(ri.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestRealIPParse(t *testing.T) {
+	for i, test := range []struct {
+		input         string
+		shouldErr     bool
+		header        string
+		hops          int
+		trustedRanges int
+	}{
+		{`real_ip 10.0.0.0/8 192.168.1.1`, false, "X-Forwarded-For", 0, 2},
+		{`real_ip private`, false, "X-Forwarded-For", 0, 6},
+		{`real_ip {
+			from 10.0.0.0/8
+			from 2001:db8::/32
+			header cf-connecting-ip
+		}`, false, "Cf-Connecting-Ip", 0, 2},
+		{`real_ip 10.0.0.0/8 {
+			header Forwarded
+			hops 2
+		}`, false, "Forwarded", 2, 1},
+		{`real_ip`, true, "", 0, 0},
+		{`real_ip 10.0.0.0/33`, true, "", 0, 0},
+		{`real_ip proxy.local`, true, "", 0, 0},
+		{`real_ip 10.0.0.0/8 {
+			from
+		}`, true, "", 0, 0},
+		{`real_ip 10.0.0.0/8 {
+			header
+		}`, true, "", 0, 0},
+		{`real_ip 10.0.0.0/8 {
+			header X-Real-IP
+			hops 1
+		}`, true, "", 0, 0},
+		{`real_ip 10.0.0.0/8 {
+			hops 0
+		}`, true, "", 0, 0},
+		{`real_ip 10.0.0.0/8 {
+			trust everyone
+		}`, true, "", 0, 0},
+		{`real_ip 10.0.0.0/8
+		real_ip 192.168.0.0/16`, true, "", 0, 0},
+	} {
+		ri, err := realIPParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if ri.Header != test.header || ri.Hops != test.hops || len(ri.Trusted) != test.trustedRanges {
+			t.Errorf("Test %d: Expected %s, %d hops and %d trusted networks, got %s, %d and %d",
+				i, test.header, test.hops, test.trustedRanges, ri.Header, ri.Hops, len(ri.Trusted))
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package recentrequests provides middleware that keeps summaries
+// of the most recent requests of a site in memory, published as
+// a metric, so that what was happening before an incident can be
+// seen without access logs.
+package recentrequests
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// RecentRequests is middleware that records a summary
+// of each request in a ring.
+type RecentRequests struct {
+	Next httpserver.Handler
+	Ring *Ring
+}
+
+// Summary is what is recorded about a request.
+type Summary struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Host      string    `json:"host"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	Size      int       `json:"size"`
+	LatencyMS float64   `json:"latency_ms"`
+	Remote    string    `json:"remote"`
+	Upstream  string    `json:"upstream,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (rr RecentRequests) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	start := time.Now()
+	rec := httpserver.NewResponseRecorder(w)
+	r = httpserver.WithRequestPlaceholders(r)
+
+	status, err := rr.Next.ServeHTTP(rec, r)
+
+	summary := Summary{
+		Time:      start,
+		Method:    r.Method,
+		Host:      r.Host,
+		Path:      r.URL.Path,
+		Status:    status,
+		Size:      rec.Size(),
+		LatencyMS: float64(time.Since(start)) / float64(time.Millisecond),
+		Remote:    r.RemoteAddr,
+	}
+	// statuses below 400 are returned by handlers that
+	// wrote the response; errors are written further out
+	if status < 400 {
+		summary.Status = rec.Status()
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		summary.Remote = host
+	}
+	summary.Upstream, _ = httpserver.RequestPlaceholder(r, "upstream")
+	summary.RequestID, _ = httpserver.RequestPlaceholder(r, "request_id")
+	rr.Ring.add(summary)
+
+	return status, err
+}
+
+// Ring keeps the summaries of the most recent requests.
+type Ring struct {
+	mu        sync.Mutex
+	summaries []Summary
+	next      int
+	full      bool
+}
+
+// NewRing returns a ring that keeps size summaries.
+func NewRing(size int) *Ring {
+	return &Ring{summaries: make([]Summary, size)}
+}
+
+// add adds s to the ring, replacing the oldest
+// summary if it is full.
+func (r *Ring) add(s Summary) {
+	r.mu.Lock()
+	r.summaries[r.next] = s
+	r.next = (r.next + 1) % len(r.summaries)
+	r.full = r.full || r.next == 0
+	r.mu.Unlock()
+}
+
+// Recent returns the summaries in the ring, newest first.
+func (r *Ring) Recent() []Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.next
+	if r.full {
+		n = len(r.summaries)
+	}
+	recent := make([]Summary, 0, n)
+	for i := 1; i <= n; i++ {
+		recent = append(recent, r.summaries[(r.next-i+len(r.summaries))%len(r.summaries)])
+	}
+	return recent
+}
+
+// Size returns how many summaries r keeps.
+func (r *Ring) Size() int {
+	return len(r.summaries)
+}
@@ -0,0 +1,64 @@
+package recentrequests
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestRecentRequests(t *testing.T) {
+	rr := RecentRequests{
+		Ring: NewRing(2),
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			switch r.URL.Path {
+			case "/proxied":
+				httpserver.SetRequestPlaceholder(r, "upstream", "http://backend:8080")
+				httpserver.SetRequestPlaceholder(r, "request_id", "abc")
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, "created")
+				return 0, nil
+			case "/missing":
+				return http.StatusNotFound, nil
+			}
+			return http.StatusBadGateway, errors.New("no upstream")
+		}),
+	}
+
+	for _, path := range []string{"/first", "/proxied?secret=1", "/missing"} {
+		req := httptest.NewRequest("POST", "http://example.com"+path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rr.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	recent := rr.Ring.Recent()
+	if len(recent) != 2 {
+		t.Fatalf("Expected 2 recent requests, got %d: %+v", len(recent), recent)
+	}
+	if s := recent[0]; s.Path != "/missing" || s.Status != http.StatusNotFound {
+		t.Errorf("Expected newest request first, got %+v", s)
+	}
+	s := recent[1]
+	if s.Method != "POST" || s.Host != "example.com" || s.Path != "/proxied" || s.Status != http.StatusCreated ||
+		s.Size != len("created") || s.Remote != "10.0.0.1" || s.Upstream != "http://backend:8080" ||
+		s.RequestID != "abc" || s.Time.IsZero() || s.LatencyMS < 0 {
+		t.Errorf("Unexpected summary %+v", s)
+	}
+}
+
+func TestRing(t *testing.T) {
+	ring := NewRing(3)
+	for i, expected := range []string{"[0]", "[1 0]", "[2 1 0]", "[3 2 1]", "[4 3 2]"} {
+		ring.add(Summary{Status: i})
+		var statuses []int
+		for _, s := range ring.Recent() {
+			statuses = append(statuses, s.Status)
+		}
+		if actual := fmt.Sprint(statuses); actual != expected {
+			t.Errorf("After %d requests: expected %s, got %s", i+1, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package recentrequests
+
+import (
+	"expvar"
+	"strconv"
+	"sync"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("recent_requests", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
+	})
+}
+
+// setup configures a new RecentRequests middleware instance. Syntax:
+//
+//	recent_requests [size]
+//
+// The summaries of the last size requests of the site (100 by
+// default) are published with the expvar directive, under
+// RecentRequests and the site's address, newest first. The ring
+// of a site is kept when the configuration is reloaded.
+func setup(c *caddy.Controller) error {
+	size, err := recentRequestsParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	ring := siteRing(cfg.Addr.String(), size)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return RecentRequests{Next: next, Ring: ring}
+	})
+	return nil
+}
+
+func recentRequestsParse(c *caddy.Controller) (int, error) {
+	size := defaultSize
+	var seen bool
+	for c.Next() {
+		if seen {
+			return 0, c.Err("recent_requests: can only be specified once per site")
+		}
+		seen = true
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 || n > maxSize {
+				return 0, c.Errf("recent_requests: invalid size '%s'", args[0])
+			}
+			size = n
+		default:
+			return 0, c.ArgErr()
+		}
+		if c.NextBlock() {
+			return 0, c.ArgErr()
+		}
+	}
+	return size, nil
+}
+
+// siteRing returns the ring of the site at addr, which
+// is new unless the site had a ring of the same size.
+func siteRing(addr string, size int) *Ring {
+	ringsMu.Lock()
+	defer ringsMu.Unlock()
+	if rings == nil {
+		rings = make(map[string]*Ring)
+		expvar.Publish("RecentRequests", expvar.Func(recent))
+	}
+	if ring, ok := rings[addr]; ok && ring.Size() == size {
+		return ring
+	}
+	rings[addr] = NewRing(size)
+	return rings[addr]
+}
+
+// recent returns the recent requests of all sites.
+func recent() interface{} {
+	ringsMu.Lock()
+	defer ringsMu.Unlock()
+	sites := make(map[string][]Summary, len(rings))
+	for addr, ring := range rings {
+		sites[addr] = ring.Recent()
+	}
+	return sites
+}
+
+var (
+	// rings are the rings of the sites, by address
+	rings   map[string]*Ring
+	ringsMu sync.Mutex
+)
+
+const (
+	defaultSize = 100
+	maxSize     = 100000
+)
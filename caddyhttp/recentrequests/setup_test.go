@@ -0,0 +1,81 @@
+package recentrequests
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `recent_requests 10`)
+	cfg := httpserver.GetConfig(c)
+	cfg.Addr = httpserver.Address{Host: "example.com", Port: "443"}
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := cfg.Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler, ok := mids[0](httpserver.EmptyNext).(RecentRequests)
+	if !ok {
+		t.Fatalf("Expected handler to be type RecentRequests, got: %#v", mids[0](httpserver.EmptyNext))
+	}
+	if !httpserver.SameNext(handler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if handler.Ring.Size() != 10 {
+		t.Errorf("Expected ring of size 10, got %d", handler.Ring.Size())
+	}
+	handler.Ring.add(Summary{Path: "/published"})
+
+	// a reload keeps the ring
+	c = caddy.NewTestController("http", `recent_requests 10`)
+	httpserver.GetConfig(c).Addr = cfg.Addr
+	if err := setup(c); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded := httpserver.GetConfig(c).Middleware()[0](httpserver.EmptyNext).(RecentRequests); reloaded.Ring != handler.Ring {
+		t.Error("Expected ring to be kept on reload")
+	}
+
+	var published map[string][]Summary
+	if err := json.Unmarshal([]byte(expvar.Get("RecentRequests").String()), &published); err != nil {
+		t.Fatal(err)
+	}
+	if s := published[cfg.Addr.String()]; len(s) != 1 || s[0].Path != "/published" {
+		t.Errorf("Expected recent requests of site to be published, got %v", published)
+	}
+}
+
+func TestRecentRequestsParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		size      int
+	}{
+		{`recent_requests`, false, defaultSize},
+		{`recent_requests 500`, false, 500},
+		{`recent_requests 0`, true, 0},
+		{`recent_requests many`, true, 0},
+		{`recent_requests 10 20`, true, 0},
+		{"recent_requests 10\nrecent_requests 20", true, 0},
+		{`recent_requests { size 10 }`, true, 0},
+	} {
+		size, err := recentRequestsParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+		} else if size != test.size {
+			t.Errorf("Test %d: Expected size %d, got %d", i, test.size, size)
+		}
+	}
+}
@@ -9,8 +9,9 @@ import (
 
 func init() {
 	caddy.RegisterPlugin("redir", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
@@ -0,0 +1,166 @@
+// Package reloadadmin provides middleware that serves an API to
+// switch to a new configuration blue/green style: the new
+// configuration is tried on internal ports first, and traffic
+// only cuts over to it if it passes smoke checks.
+package reloadadmin
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// DefaultPath is the path of the API by default.
+const DefaultPath = "/reload-admin"
+
+// ReloadAdmin is middleware that serves the API at Path:
+//
+//	GET  {path}  reports the state of the last switch
+//	POST {path}  switches to a new configuration
+//
+// The body of a POST is the new Caddyfile; if it is empty, the
+// Caddyfile is loaded again like on SIGUSR1. Each check query
+// parameter, as "url [status]", adds a smoke check to Checks.
+// The switch happens in the background; GET reports how it went.
+type ReloadAdmin struct {
+	Next   httpserver.Handler
+	Path   string
+	Checks []caddy.SmokeCheck
+
+	// AllowRemote is whether clients other than those on
+	// the loopback interface may use the API.
+	AllowRemote bool
+}
+
+// Switch is the state of a switch to a new configuration.
+type Switch struct {
+	State    string    `json:"state"`
+	Checks   int       `json:"checks"`
+	Started  time.Time `json:"started,omitempty"`
+	Finished time.Time `json:"finished,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// The states of a switch.
+const (
+	StateIdle      = "idle"
+	StateSwitching = "switching"
+	StateDone      = "done"
+	StateFailed    = "failed"
+)
+
+// last is the last switch; it outlives the instance
+// that started it, since the switch replaces it.
+var (
+	last   = Switch{State: StateIdle}
+	lastMu sync.Mutex
+)
+
+// reloadChecked applies a new configuration; it is a
+// variable so tests can replace it.
+var reloadChecked = caddy.ReloadChecked
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (a ReloadAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !httpserver.Path(r.URL.Path).Matches(a.Path) {
+		return a.Next.ServeHTTP(w, r)
+	}
+	if !a.AllowRemote && !caddy.IsLoopback(r.RemoteAddr) {
+		return http.StatusForbidden, nil
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if strings.Trim(strings.TrimPrefix(r.URL.Path, a.Path), "/") != "" {
+		return http.StatusNotFound, nil
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		lastMu.Lock()
+		s := last
+		lastMu.Unlock()
+		return httpserver.WriteJSONResponse(w, http.StatusOK, s)
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		return http.StatusMethodNotAllowed, nil
+	}
+
+	checks := append([]caddy.SmokeCheck(nil), a.Checks...)
+	for _, v := range r.URL.Query()["check"] {
+		check, ok := parseCheck(strings.Fields(v))
+		if !ok {
+			httpserver.WriteTextResponse(w, http.StatusBadRequest, "invalid check "+v+"\n")
+			return 0, nil
+		}
+		checks = append(checks, check)
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxCaddyfileSize))
+	if err != nil {
+		httpserver.WriteTextResponse(w, http.StatusRequestEntityTooLarge, "Caddyfile too large\n")
+		return 0, nil
+	}
+	var newCaddyfile caddy.Input
+	if len(body) > 0 {
+		newCaddyfile = caddy.CaddyfileInput{
+			Contents:       body,
+			Filepath:       "reload_admin",
+			ServerTypeName: "http",
+		}
+	}
+
+	lastMu.Lock()
+	if last.State == StateSwitching {
+		s := last
+		lastMu.Unlock()
+		return httpserver.WriteJSONResponse(w, http.StatusConflict, s)
+	}
+	last = Switch{State: StateSwitching, Checks: len(checks), Started: time.Now()}
+	s := last
+	lastMu.Unlock()
+
+	// the switch stops the server serving this request,
+	// which waits for the request to finish
+	go func() {
+		err := reloadChecked(newCaddyfile, checks)
+		lastMu.Lock()
+		last.State = StateDone
+		last.Finished = time.Now()
+		if err != nil {
+			last.State = StateFailed
+			last.Error = err.Error()
+		}
+		lastMu.Unlock()
+	}()
+	return httpserver.WriteJSONResponse(w, http.StatusAccepted, s)
+}
+
+// parseCheck parses the arguments of a smoke check,
+// a URL and optionally the status it should respond
+// with, which is 200 by default.
+func parseCheck(args []string) (caddy.SmokeCheck, bool) {
+	check := caddy.SmokeCheck{Status: http.StatusOK}
+	if len(args) < 1 || len(args) > 2 {
+		return check, false
+	}
+	if !strings.HasPrefix(args[0], "http://") && !strings.HasPrefix(args[0], "https://") {
+		return check, false
+	}
+	check.URL = args[0]
+	if len(args) == 2 {
+		status, err := strconv.Atoi(args[1])
+		if err != nil || status < 100 || status > 599 {
+			return check, false
+		}
+		check.Status = status
+	}
+	return check, true
+}
+
+// maxCaddyfileSize is the size limit of a posted Caddyfile.
+const maxCaddyfileSize = 10 << 20
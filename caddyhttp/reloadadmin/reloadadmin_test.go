@@ -0,0 +1,126 @@
+package reloadadmin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestReloadAdmin(t *testing.T) {
+	type call struct {
+		body   string
+		checks []caddy.SmokeCheck
+	}
+	calls := make(chan call, 1)
+	release := make(chan error)
+	defer func(fn func(caddy.Input, []caddy.SmokeCheck) error) { reloadChecked = fn }(reloadChecked)
+	reloadChecked = func(newCaddyfile caddy.Input, checks []caddy.SmokeCheck) error {
+		var c call
+		if newCaddyfile != nil {
+			c.body = string(newCaddyfile.Body())
+		}
+		c.checks = checks
+		calls <- c
+		return <-release
+	}
+	defer func() { last = Switch{State: StateIdle} }()
+
+	admin := ReloadAdmin{
+		Next:   httpserver.EmptyNext,
+		Path:   DefaultPath,
+		Checks: []caddy.SmokeCheck{{URL: "https://example.com/health", Status: 200}},
+	}
+	do := func(method, target, body, remote string) (*httptest.ResponseRecorder, Switch) {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		status, _ := admin.ServeHTTP(w, r)
+		if status != 0 {
+			w.Code = status
+		}
+		var s Switch
+		json.Unmarshal(w.Body.Bytes(), &s)
+		return w, s
+	}
+	waitState := func(state string) Switch {
+		for i := 0; i < 100; i++ {
+			_, s := do("GET", DefaultPath, "", "127.0.0.1:1234")
+			if s.State == state {
+				return s
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("Expected state %s", state)
+		return Switch{}
+	}
+
+	if w, s := do("GET", DefaultPath, "", "127.0.0.1:1234"); w.Code != http.StatusOK || s.State != StateIdle {
+		t.Errorf("Expected idle state, got %d %+v", w.Code, s)
+	}
+	if w, _ := do("GET", DefaultPath, "", "10.0.0.1:1234"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected remote clients to be forbidden, got %d", w.Code)
+	}
+	if w, _ := do("POST", DefaultPath+"?check=nope", "", "127.0.0.1:1234"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected invalid check to be rejected, got %d", w.Code)
+	}
+
+	// a posted Caddyfile, with an extra check
+	w, s := do("POST", DefaultPath+"?check=http://example.com/+503", "example.com", "127.0.0.1:1234")
+	if w.Code != http.StatusAccepted || s.State != StateSwitching || s.Checks != 2 {
+		t.Errorf("Expected switch to start with 2 checks, got %d %+v", w.Code, s)
+	}
+	c := <-calls
+	expected := []caddy.SmokeCheck{{URL: "https://example.com/health", Status: 200}, {URL: "http://example.com/", Status: 503}}
+	if c.body != "example.com" || !reflect.DeepEqual(c.checks, expected) {
+		t.Errorf("Expected Caddyfile and checks to be applied, got %+v", c)
+	}
+	if w, _ := do("POST", DefaultPath, "", "127.0.0.1:1234"); w.Code != http.StatusConflict {
+		t.Errorf("Expected conflict while switching, got %d", w.Code)
+	}
+	release <- errors.New("smoke check failed")
+	if s := waitState(StateFailed); s.Error != "smoke check failed" || s.Finished.IsZero() {
+		t.Errorf("Expected failed switch with error, got %+v", s)
+	}
+
+	// without a body, the Caddyfile is loaded again
+	do("POST", DefaultPath, "", "127.0.0.1:1234")
+	if c := <-calls; c.body != "" {
+		t.Errorf("Expected no Caddyfile, got %q", c.body)
+	}
+	release <- nil
+	if s := waitState(StateDone); s.Error != "" {
+		t.Errorf("Expected no error, got %+v", s)
+	}
+}
+
+func TestParseCheck(t *testing.T) {
+	for i, test := range []struct {
+		args  []string
+		ok    bool
+		check caddy.SmokeCheck
+	}{
+		{[]string{"https://example.com/"}, true, caddy.SmokeCheck{URL: "https://example.com/", Status: 200}},
+		{[]string{"http://example.com/down", "503"}, true, caddy.SmokeCheck{URL: "http://example.com/down", Status: 503}},
+		{[]string{"example.com"}, false, caddy.SmokeCheck{}},
+		{[]string{"http://example.com/", "ok"}, false, caddy.SmokeCheck{}},
+		{[]string{"http://example.com/", "600"}, false, caddy.SmokeCheck{}},
+		{[]string{}, false, caddy.SmokeCheck{}},
+		{[]string{"http://a/", "200", "x"}, false, caddy.SmokeCheck{}},
+	} {
+		check, ok := parseCheck(test.args)
+		if ok != test.ok {
+			t.Errorf("Test %d: Expected ok %v, got %v", i, test.ok, ok)
+		}
+		if ok && check != test.check {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.check, check)
+		}
+	}
+}
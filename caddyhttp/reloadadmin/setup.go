@@ -0,0 +1,82 @@
+package reloadadmin
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("reload_admin", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
+	})
+}
+
+// setup configures a new ReloadAdmin middleware instance. Syntax:
+//
+//	reload_admin [path] {
+//	    check url [status]
+//	    allow_remote
+//	}
+//
+// The path defaults to /reload-admin. Each check is a smoke
+// check that every switch runs; the status defaults to 200.
+// Unless allow_remote is given, only clients on the loopback
+// interface may use the API; otherwise it should be protected,
+// such as by basicauth.
+func setup(c *caddy.Controller) error {
+	admin, err := reloadAdminParse(c)
+	if err != nil {
+		return err
+	}
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		admin.Next = next
+		return admin
+	})
+	return nil
+}
+
+func reloadAdminParse(c *caddy.Controller) (ReloadAdmin, error) {
+	admin := ReloadAdmin{Path: DefaultPath}
+	var seen bool
+	for c.Next() {
+		if seen {
+			return admin, c.Err("reload_admin: can only be specified once per site")
+		}
+		seen = true
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			if !strings.HasPrefix(args[0], "/") {
+				return admin, c.Errf("reload_admin: invalid path '%s'", args[0])
+			}
+			admin.Path = args[0]
+		default:
+			return admin, c.ArgErr()
+		}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "check":
+				args := c.RemainingArgs()
+				check, ok := parseCheck(args)
+				if !ok {
+					return admin, c.Errf("reload_admin: invalid check '%s'", strings.Join(args, " "))
+				}
+				admin.Checks = append(admin.Checks, check)
+			case "allow_remote":
+				if c.NextArg() {
+					return admin, c.ArgErr()
+				}
+				admin.AllowRemote = true
+			default:
+				return admin, c.Errf("reload_admin: unknown property '%s'", c.Val())
+			}
+		}
+	}
+	return admin, nil
+}
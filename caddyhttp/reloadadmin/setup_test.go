@@ -0,0 +1,71 @@
+package reloadadmin
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `reload_admin /switch`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler, ok := mids[0](httpserver.EmptyNext).(ReloadAdmin)
+	if !ok {
+		t.Fatalf("Expected handler to be type ReloadAdmin, got: %#v", mids[0](httpserver.EmptyNext))
+	}
+	if !httpserver.SameNext(handler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if handler.Path != "/switch" {
+		t.Errorf("Expected path /switch, got %s", handler.Path)
+	}
+}
+
+func TestReloadAdminParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  ReloadAdmin
+	}{
+		{`reload_admin`, false, ReloadAdmin{Path: DefaultPath}},
+		{`reload_admin /switch`, false, ReloadAdmin{Path: "/switch"}},
+		{"reload_admin {\n check https://example.com/health\n check http://example.com/gone 404\n allow_remote\n}", false, ReloadAdmin{
+			Path: DefaultPath,
+			Checks: []caddy.SmokeCheck{
+				{URL: "https://example.com/health", Status: 200},
+				{URL: "http://example.com/gone", Status: 404},
+			},
+			AllowRemote: true,
+		}},
+		{`reload_admin switch`, true, ReloadAdmin{}},
+		{`reload_admin /a /b`, true, ReloadAdmin{}},
+		{"reload_admin {\n check example.com\n}", true, ReloadAdmin{}},
+		{"reload_admin {\n check\n}", true, ReloadAdmin{}},
+		{"reload_admin {\n allow_remote yes\n}", true, ReloadAdmin{}},
+		{"reload_admin {\n foo\n}", true, ReloadAdmin{}},
+		{"reload_admin\nreload_admin /b", true, ReloadAdmin{}},
+	} {
+		admin, err := reloadAdminParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(admin, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, admin)
+		}
+	}
+}
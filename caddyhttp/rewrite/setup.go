@@ -1,7 +1,6 @@
 package rewrite
 
 import (
-	"net/http"
 	"strings"
 
 	"github.com/mholt/caddy"
@@ -10,13 +9,17 @@ import (
 
 func init() {
 	caddy.RegisterPlugin("rewrite", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
 // setup configures a new Rewrite middleware instance.
 func setup(c *caddy.Controller) error {
+	if err := httpserver.CheckStaticRoot(c); err != nil {
+		return err
+	}
 	rewrites, err := rewriteParse(c)
 	if err != nil {
 		return err
@@ -27,7 +30,7 @@ func setup(c *caddy.Controller) error {
 	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
 		return Rewrite{
 			Next:    next,
-			FileSys: http.Dir(cfg.Root),
+			FileSys: cfg.FileSystem(),
 			Rules:   rewrites,
 		}
 	})
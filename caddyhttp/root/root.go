@@ -15,25 +15,42 @@ func init() {
 	})
 }
 
+// setupRoot sets the root of the site. Syntax:
+//
+//	root path [fallbacks...]
+//
+// Files that are not in path are served from the fallback
+// directories, in order; for example, a site's theme can
+// override some of the files of a base theme. Roots may have
+// placeholders, like /srv/{label1}, which are replaced for each
+// request; values that are not a single path element are not
+// served.
 func setupRoot(c *caddy.Controller) error {
 	config := httpserver.GetConfig(c)
 
 	for c.Next() {
-		if !c.NextArg() {
+		args := c.RemainingArgs()
+		if len(args) == 0 {
 			return c.ArgErr()
 		}
-		config.Root = c.Val()
+		config.Root = args[0]
+		config.FallbackRoots = args[1:]
 	}
 
-	// Check if root path exists
-	_, err := os.Stat(config.Root)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Allow this, because the folder might appear later.
-			// But make sure the user knows!
-			log.Printf("[WARNING] Root path does not exist: %s", config.Root)
-		} else {
-			return c.Errf("Unable to access root path '%s': %v", config.Root, err)
+	// Check if root paths exist
+	for _, root := range append([]string{config.Root}, config.FallbackRoots...) {
+		if httpserver.IsDynamicRoot(root) {
+			continue
+		}
+		_, err := os.Stat(root)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Allow this, because the folder might appear later.
+				// But make sure the user knows!
+				log.Printf("[WARNING] Root path does not exist: %s", root)
+			} else {
+				return c.Errf("Unable to access root path '%s': %v", root, err)
+			}
 		}
 	}
 
@@ -88,6 +88,20 @@ func TestRoot(t *testing.T) {
 	}
 }
 
+func TestRootFallbacks(t *testing.T) {
+	c := caddy.NewTestController("http", "root /srv/themes/blue /srv/themes/base /srv/default")
+	if err := setupRoot(c); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	cfg := httpserver.GetConfig(c)
+	if cfg.Root != "/srv/themes/blue" {
+		t.Errorf("Expected root /srv/themes/blue, got %s", cfg.Root)
+	}
+	if strings.Join(cfg.FallbackRoots, " ") != "/srv/themes/base /srv/default" {
+		t.Errorf("Expected fallback roots /srv/themes/base /srv/default, got %v", cfg.FallbackRoots)
+	}
+}
+
 // getTempDirPath returnes the path to the system temp directory. If it does not exists - an error is returned.
 func getTempDirPath() (string, error) {
 	tempDir := os.TempDir()
@@ -0,0 +1,68 @@
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// entityDescriptor is the part of the metadata of an
+// identity provider that is used.
+type entityDescriptor struct {
+	XMLName          xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID         string   `xml:"entityID,attr"`
+	IDPSSODescriptor *struct {
+		KeyDescriptors []struct {
+			Use   string   `xml:"use,attr"`
+			Certs []string `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo>X509Data>X509Certificate"`
+		} `xml:"KeyDescriptor"`
+		SingleSignOnServices []struct {
+			Binding  string `xml:"Binding,attr"`
+			Location string `xml:"Location,attr"`
+		} `xml:"SingleSignOnService"`
+	} `xml:"IDPSSODescriptor"`
+}
+
+// parseMetadata reads the metadata of an identity provider.
+func parseMetadata(r io.Reader) (IdentityProvider, error) {
+	var idp IdentityProvider
+	var ed entityDescriptor
+	if err := xml.NewDecoder(r).Decode(&ed); err != nil {
+		return idp, err
+	}
+	if ed.IDPSSODescriptor == nil {
+		return idp, errors.New("no identity provider in metadata")
+	}
+	idp.EntityID = ed.EntityID
+	for _, kd := range ed.IDPSSODescriptor.KeyDescriptors {
+		if kd.Use != "" && kd.Use != "signing" {
+			continue
+		}
+		for _, c := range kd.Certs {
+			der, err := decodeBase64(c)
+			if err != nil {
+				return idp, fmt.Errorf("decoding certificate: %v", err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return idp, err
+			}
+			idp.Certs = append(idp.Certs, cert)
+		}
+	}
+	for _, sso := range ed.IDPSSODescriptor.SingleSignOnServices {
+		if sso.Binding == redirectBinding {
+			idp.SSOURL = sso.Location
+			break
+		}
+	}
+	if idp.SSOURL == "" {
+		return idp, errors.New("no single sign-on service with the HTTP-Redirect binding in metadata")
+	}
+	if len(idp.Certs) == 0 {
+		return idp, errors.New("no signing certificate in metadata")
+	}
+	return idp, nil
+}
@@ -0,0 +1,548 @@
+// Package saml provides middleware that logs users in with a
+// SAML 2.0 identity provider, as a service provider using the
+// HTTP-Redirect binding for requests and the HTTP-POST binding
+// for responses, and keeps them logged in with an encrypted
+// session cookie.
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/internal/seal"
+	"github.com/mholt/caddy/caddyhttp/internal/xmltree"
+)
+
+// SAML is middleware that requires users to log in with a
+// SAML identity provider to access protected paths.
+type SAML struct {
+	Next   httpserver.Handler
+	Config *Config
+}
+
+// Config is the configuration of the SAML middleware.
+type Config struct {
+	// Entity ID of this service provider; if empty,
+	// the URL of the metadata on the site is used
+	EntityID string
+
+	// The identity provider users log in with
+	IDP IdentityProvider
+
+	// Paths of the metadata of this service provider,
+	// of its assertion consumer service, and to log
+	// users out
+	MetadataPath string
+	ACSPath      string
+	LogoutPath   string
+
+	// How long users stay logged in, unless
+	// the identity provider says otherwise
+	SessionTTL time.Duration
+
+	// Request headers to set to attributes of the user
+	Headers []HeaderAttribute
+
+	// Attribute that lists the groups of the user
+	GroupsAttribute string
+
+	// Paths that require users to log in; if there
+	// are none, the whole site does
+	Rules []Rule
+
+	// Paths that do not require users to log in
+	Except []string
+
+	sealer *seal.Sealer
+	replay *replayCache
+}
+
+// IdentityProvider describes a SAML identity provider.
+type IdentityProvider struct {
+	// Entity ID of the identity provider; if not
+	// empty, assertions must be issued by it
+	EntityID string
+
+	// URL of the single sign-on service with
+	// the HTTP-Redirect binding
+	SSOURL string
+
+	// Certificates that assertions may be signed with
+	Certs []*x509.Certificate
+}
+
+// HeaderAttribute maps an attribute to a request header.
+// Attributes match by name or by friendly name.
+type HeaderAttribute struct {
+	Header    string
+	Attribute string
+}
+
+// Rule requires users to log in to access a base path,
+// and, if there are groups, to be in one of them.
+type Rule struct {
+	Path   string
+	Groups []string
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (s SAML) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	cfg := s.Config
+	switch r.URL.Path {
+	case cfg.MetadataPath:
+		return s.metadata(w, r)
+	case cfg.ACSPath:
+		return s.acs(w, r)
+	case cfg.LogoutPath:
+		http.SetCookie(w, s.cookie(r, sessionCookie, "", -1))
+		http.Redirect(w, r, "/", http.StatusFound)
+		return 0, nil
+	}
+
+	// clients must not be able to pass off
+	// their own values as those of attributes
+	for _, ha := range cfg.Headers {
+		r.Header.Del(ha.Header)
+	}
+
+	sess := s.session(r)
+	if sess != nil {
+		r = httpserver.SetRequestPlaceholder(r, "saml.name_id", sess.NameID)
+		for name, values := range sess.Attributes {
+			r = httpserver.SetRequestPlaceholder(r, "saml."+name, strings.Join(values, ","))
+		}
+		for _, ha := range cfg.Headers {
+			if values := sess.Attributes[ha.Attribute]; len(values) > 0 {
+				r.Header.Set(ha.Header, strings.Join(values, ","))
+			}
+		}
+	}
+
+	rule := cfg.match(r.URL.Path)
+	if rule == nil {
+		return s.Next.ServeHTTP(w, r)
+	}
+	if sess == nil {
+		return s.login(w, r)
+	}
+	if !rule.allows(sess.Attributes[cfg.GroupsAttribute]) {
+		return http.StatusForbidden, nil
+	}
+	return s.Next.ServeHTTP(w, r)
+}
+
+// match returns the rule protecting urlPath, or nil if it is not protected.
+func (cfg *Config) match(urlPath string) *Rule {
+	for _, except := range cfg.Except {
+		if httpserver.Path(urlPath).Matches(except) {
+			return nil
+		}
+	}
+	var rule *Rule
+	for i := range cfg.Rules {
+		candidate := &cfg.Rules[i]
+		if httpserver.Path(urlPath).Matches(candidate.Path) &&
+			(rule == nil || len(candidate.Path) > len(rule.Path)) {
+			rule = candidate
+		}
+	}
+	return rule
+}
+
+// allows returns whether a user in groups may access the path of rule.
+func (rule *Rule) allows(groups []string) bool {
+	if len(rule.Groups) == 0 {
+		return true
+	}
+	for _, group := range groups {
+		for _, allowed := range rule.Groups {
+			if group == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// session returns the session of the user of r, or nil
+// if the user has not logged in or the session expired.
+func (s SAML) session(r *http.Request) *session {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	var sess session
+	if err := s.Config.sealer.Open(sessionCookie, cookie.Value, &sess); err != nil || seal.Expired(sess.Expires) {
+		return nil
+	}
+	return &sess
+}
+
+// login sends the user to the identity provider with an
+// AuthnRequest, to log in and then return to the URL of r.
+func (s SAML) login(w http.ResponseWriter, r *http.Request) (int, error) {
+	// other requests than page loads cannot follow the
+	// user through the identity provider's login page
+	if (r.Method != "GET" && r.Method != "HEAD") || r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		return http.StatusUnauthorized, nil
+	}
+	cfg := s.Config
+
+	// the state is kept in a cookie rather than in the
+	// RelayState, which is limited to 80 bytes
+	state := loginState{
+		ID:         "_" + seal.RandomString(20),
+		RelayState: seal.RandomString(16),
+		Return:     r.URL.RequestURI(),
+		Expires:    time.Now().Add(loginTimeout).Unix(),
+	}
+	value, err := cfg.sealer.Seal(stateCookie, state)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	s.setStateCookie(w, r, value, loginTimeout)
+
+	var request bytes.Buffer
+	fmt.Fprintf(&request, `<samlp:AuthnRequest xmlns:samlp="%s" xmlns:saml="%s" ID="%s" Version="2.0" IssueInstant="%s" Destination="%s" AssertionConsumerServiceURL="%s" ProtocolBinding="%s">`,
+		protocolNamespace, assertionNamespace, state.ID, time.Now().UTC().Format(timeFormat),
+		escape(cfg.IDP.SSOURL), escape(cfg.acsURL(r)), postBinding)
+	fmt.Fprintf(&request, `<saml:Issuer>%s</saml:Issuer><samlp:NameIDPolicy AllowCreate="true"/></samlp:AuthnRequest>`,
+		escape(cfg.entityID(r)))
+
+	var deflated bytes.Buffer
+	fw, _ := flate.NewWriter(&deflated, flate.DefaultCompression)
+	fw.Write(request.Bytes())
+	fw.Close()
+	query := url.Values{
+		"SAMLRequest": {base64.StdEncoding.EncodeToString(deflated.Bytes())},
+		"RelayState":  {state.RelayState},
+	}
+	sep := "?"
+	if strings.Contains(cfg.IDP.SSOURL, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, cfg.IDP.SSOURL+sep+query.Encode(), http.StatusFound)
+	return 0, nil
+}
+
+// acs is the assertion consumer service, which completes the
+// login of a user whose browser posts the identity provider's
+// response to it.
+func (s SAML) acs(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != "POST" {
+		return http.StatusMethodNotAllowed, nil
+	}
+	cfg := s.Config
+	cookie, err := r.Cookie(stateCookie)
+	if err != nil {
+		return http.StatusBadRequest, errors.New("saml: no login in progress")
+	}
+	var state loginState
+	if err := cfg.sealer.Open(stateCookie, cookie.Value, &state); err != nil || seal.Expired(state.Expires) {
+		return http.StatusBadRequest, errors.New("saml: invalid or expired login")
+	}
+	if r.PostFormValue("RelayState") != state.RelayState {
+		return http.StatusBadRequest, errors.New("saml: relay state mismatch")
+	}
+	raw, err := decodeBase64(r.PostFormValue("SAMLResponse"))
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("saml: decoding response: %v", err)
+	}
+	sess, err := cfg.verifyResponse(raw, state.ID, cfg.acsURL(r), time.Now())
+	if err != nil {
+		return http.StatusUnauthorized, fmt.Errorf("saml: %v", err)
+	}
+
+	value, err := cfg.sealer.Seal(sessionCookie, sess)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	http.SetCookie(w, s.cookie(r, sessionCookie, value, time.Unix(sess.Expires, 0).Sub(time.Now())))
+	s.setStateCookie(w, r, "", -1)
+	// 303 makes the browser follow with a GET
+	http.Redirect(w, r, state.Return, http.StatusSeeOther)
+	return 0, nil
+}
+
+// verifyResponse verifies a SAML response to the AuthnRequest
+// with ID requestID, received at acsURL at now, and returns the
+// session of the user it asserts.
+func (cfg *Config) verifyResponse(raw []byte, requestID, acsURL string, now time.Time) (*session, error) {
+	response, err := xmltree.Parse(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	if !response.Is(protocolNamespace, "Response") {
+		return nil, errors.New("not a SAML response")
+	}
+	if dest := response.Attr("Destination"); dest != "" && dest != acsURL {
+		return nil, fmt.Errorf("response is for %s", dest)
+	}
+	if response.Attr("InResponseTo") != requestID {
+		return nil, errors.New("response is not to the login request")
+	}
+	var status string
+	if code := response.Child(protocolNamespace, "Status"); code != nil {
+		if code = code.Child(protocolNamespace, "StatusCode"); code != nil {
+			status = code.Attr("Value")
+		}
+	}
+	if status != statusSuccess {
+		return nil, fmt.Errorf("login failed: %s", status)
+	}
+
+	if len(response.Children(assertionNamespace, "EncryptedAssertion")) > 0 {
+		return nil, errors.New("encrypted assertions are not supported")
+	}
+	assertions := response.Children(assertionNamespace, "Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.New("response must have exactly one assertion")
+	}
+	assertion := assertions[0]
+
+	// either the response or the assertion must be signed,
+	// and whatever is signed must be signed correctly
+	var signed bool
+	for _, el := range []*xmltree.Node{response, assertion} {
+		if el.Child(dsigNamespace, "Signature") == nil {
+			continue
+		}
+		if err := verifySignature(el, cfg.IDP.Certs); err != nil {
+			return nil, err
+		}
+		signed = true
+	}
+	if !signed {
+		return nil, errors.New("neither response nor assertion is signed")
+	}
+
+	if cfg.IDP.EntityID != "" {
+		issuer := assertion.Child(assertionNamespace, "Issuer")
+		if issuer == nil || issuer.Text() != cfg.IDP.EntityID {
+			return nil, errors.New("assertion is not issued by the identity provider")
+		}
+	}
+
+	expires := now.Add(cfg.SessionTTL)
+	conditions := assertion.Child(assertionNamespace, "Conditions")
+	if conditions == nil {
+		return nil, errors.New("assertion without conditions")
+	}
+	if err := checkTimes(conditions, now); err != nil {
+		return nil, err
+	}
+	if !audienceAllowed(conditions, cfg.entityIDFor(acsURL)) {
+		return nil, errors.New("assertion is not for this service provider")
+	}
+
+	subject := assertion.Child(assertionNamespace, "Subject")
+	if subject == nil {
+		return nil, errors.New("assertion without subject")
+	}
+	nameID := subject.Child(assertionNamespace, "NameID")
+	if nameID == nil || nameID.Text() == "" {
+		return nil, errors.New("assertion without name ID")
+	}
+	var confirmed bool
+	var replayUntil time.Time
+	for _, sc := range subject.Children(assertionNamespace, "SubjectConfirmation") {
+		data := sc.Child(assertionNamespace, "SubjectConfirmationData")
+		if sc.Attr("Method") != bearerMethod || data == nil ||
+			data.Attr("Recipient") != acsURL || data.Attr("InResponseTo") != requestID {
+			continue
+		}
+		notOnOrAfter, err := time.Parse(time.RFC3339, data.Attr("NotOnOrAfter"))
+		if err != nil || !now.Add(-clockSkew).Before(notOnOrAfter) {
+			continue
+		}
+		confirmed, replayUntil = true, notOnOrAfter.Add(clockSkew)
+		break
+	}
+	if !confirmed {
+		return nil, errors.New("subject is not confirmed for this login")
+	}
+	if id := assertion.Attr("ID"); id == "" || !cfg.replay.use(id, replayUntil) {
+		return nil, errors.New("assertion was used before")
+	}
+
+	if authn := assertion.Child(assertionNamespace, "AuthnStatement"); authn != nil {
+		if t, err := time.Parse(time.RFC3339, authn.Attr("SessionNotOnOrAfter")); err == nil && t.Before(expires) {
+			expires = t
+		}
+	}
+
+	// keep only the attributes that are used, so
+	// that the session cookie stays small
+	sess := &session{
+		NameID:     nameID.Text(),
+		Attributes: make(map[string][]string),
+		Expires:    expires.Unix(),
+	}
+	used := map[string]bool{cfg.GroupsAttribute: true}
+	for _, ha := range cfg.Headers {
+		used[ha.Attribute] = true
+	}
+	for _, statement := range assertion.Children(assertionNamespace, "AttributeStatement") {
+		for _, attr := range statement.Children(assertionNamespace, "Attribute") {
+			name := attr.Attr("Name")
+			if !used[name] {
+				name = attr.Attr("FriendlyName")
+			}
+			if !used[name] {
+				continue
+			}
+			for _, value := range attr.Children(assertionNamespace, "AttributeValue") {
+				sess.Attributes[name] = append(sess.Attributes[name], value.Text())
+			}
+		}
+	}
+	return sess, nil
+}
+
+// checkTimes returns an error if now is outside the
+// validity period of conditions.
+func checkTimes(conditions *xmltree.Node, now time.Time) error {
+	if v := conditions.Attr("NotBefore"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil || now.Add(clockSkew).Before(t) {
+			return errors.New("assertion is not yet valid")
+		}
+	}
+	if v := conditions.Attr("NotOnOrAfter"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil || !now.Add(-clockSkew).Before(t) {
+			return errors.New("assertion expired")
+		}
+	}
+	return nil
+}
+
+// audienceAllowed returns whether the audience restrictions
+// of conditions, if any, include entityID.
+func audienceAllowed(conditions *xmltree.Node, entityID string) bool {
+	for _, restriction := range conditions.Children(assertionNamespace, "AudienceRestriction") {
+		var allowed bool
+		for _, audience := range restriction.Children(assertionNamespace, "Audience") {
+			if audience.Text() == entityID {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// metadata serves the metadata of this service provider, with
+// which it is registered at the identity provider.
+func (s SAML) metadata(w http.ResponseWriter, r *http.Request) (int, error) {
+	cfg := s.Config
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<md:EntityDescriptor xmlns:md="%s" entityID="%s">
+  <md:SPSSODescriptor AuthnRequestsSigned="false" protocolSupportEnumeration="%s">
+    <md:AssertionConsumerService Binding="%s" Location="%s" index="0" isDefault="true"/>
+  </md:SPSSODescriptor>
+</md:EntityDescriptor>
+`, metadataNamespace, escape(cfg.entityID(r)), protocolNamespace, postBinding, escape(cfg.acsURL(r)))
+	return 0, nil
+}
+
+// cookie returns a cookie for r that expires after maxAge,
+// or is deleted if maxAge is negative.
+func (s SAML) cookie(r *http.Request, name, value string, maxAge time.Duration) *http.Cookie {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+	}
+	if maxAge < 0 {
+		c.MaxAge = -1
+	} else {
+		c.MaxAge = int(maxAge / time.Second)
+	}
+	return c
+}
+
+// setStateCookie sets the login state cookie. Browsers must send
+// it with the cross-site POST from the identity provider, which
+// needs SameSite=None, and that is only allowed on secure cookies.
+func (s SAML) setStateCookie(w http.ResponseWriter, r *http.Request, value string, maxAge time.Duration) {
+	c := s.cookie(r, stateCookie, value, maxAge).String()
+	if r.TLS != nil {
+		c += "; SameSite=None"
+	}
+	w.Header().Add("Set-Cookie", c)
+}
+
+// baseURL returns the URL of the site of r.
+func baseURL(r *http.Request) string {
+	if r.TLS != nil {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
+
+// acsURL returns the URL of the assertion consumer
+// service on the site of r.
+func (cfg *Config) acsURL(r *http.Request) string {
+	return baseURL(r) + cfg.ACSPath
+}
+
+// entityID returns the entity ID of this service
+// provider on the site of r.
+func (cfg *Config) entityID(r *http.Request) string {
+	if cfg.EntityID != "" {
+		return cfg.EntityID
+	}
+	return baseURL(r) + cfg.MetadataPath
+}
+
+// entityIDFor is like entityID, for the site of acsURL.
+func (cfg *Config) entityIDFor(acsURL string) string {
+	if cfg.EntityID != "" {
+		return cfg.EntityID
+	}
+	return strings.TrimSuffix(acsURL, cfg.ACSPath) + cfg.MetadataPath
+}
+
+// escape escapes s for use in XML attributes and text.
+func escape(s string) string {
+	var buf bytes.Buffer
+	escapeAttr(&buf, s)
+	return strings.Replace(buf.String(), ">", "&gt;", -1)
+}
+
+const (
+	protocolNamespace  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	assertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+	metadataNamespace  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	postBinding        = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	redirectBinding    = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	statusSuccess      = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	bearerMethod       = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	timeFormat         = "2006-01-02T15:04:05Z"
+
+	sessionCookie = "caddy_saml"
+	stateCookie   = "caddy_saml_login"
+
+	// loginTimeout is how long users have to log
+	// in at the identity provider.
+	loginTimeout = 10 * time.Minute
+
+	// clockSkew is how much the clocks of the identity
+	// provider and this server may differ.
+	clockSkew = 2 * time.Minute
+)
@@ -0,0 +1,336 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/internal/seal"
+	"github.com/mholt/caddy/caddyhttp/internal/xmltree"
+)
+
+// fakeIDP is an identity provider that signs assertions.
+type fakeIDP struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newFakeIDP(t *testing.T) *fakeIDP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fakeIDP{key: key, cert: cert}
+}
+
+// requestID returns the ID of the AuthnRequest in a redirect
+// to the single sign-on service.
+func (idp *fakeIDP) requestID(t *testing.T, location string) (id, relayState string) {
+	if !strings.HasPrefix(location, "https://idp.example.com/sso?") {
+		t.Fatalf("Expected redirect to the identity provider, got '%s'", location)
+	}
+	u, _ := url.Parse(location)
+	deflated, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := xmltree.Parse(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !request.Is(protocolNamespace, "AuthnRequest") ||
+		request.Attr("AssertionConsumerServiceURL") != "http://example.com/saml/acs" {
+		t.Errorf("Unexpected AuthnRequest: %s", canonicalize(request, nil, nil))
+	}
+	return request.Attr("ID"), u.Query().Get("RelayState")
+}
+
+// response returns a response to the request with requestID, with
+// an assertion signed by idp. edit changes the assertion before it
+// is signed.
+func (idp *fakeIDP) response(t *testing.T, requestID string, edit func(string) string) string {
+	now := time.Now().UTC()
+	assertion := `<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="assertion-` + requestID + `" Version="2.0" IssueInstant="` + now.Format(timeFormat) + `">` +
+		`<saml:Issuer>https://idp.example.com</saml:Issuer>SIGNATURE` +
+		`<saml:Subject><saml:NameID>alice@example.com</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer"><saml:SubjectConfirmationData InResponseTo="` + requestID + `" NotOnOrAfter="LATER" Recipient="http://example.com/saml/acs"/></saml:SubjectConfirmation></saml:Subject>` +
+		`<saml:Conditions NotBefore="` + now.Add(-time.Minute).Format(timeFormat) + `" NotOnOrAfter="LATER"><saml:AudienceRestriction><saml:Audience>http://example.com/saml/metadata</saml:Audience></saml:AudienceRestriction></saml:Conditions>` +
+		`<saml:AuthnStatement AuthnInstant="` + now.Format(timeFormat) + `"/>` +
+		`<saml:AttributeStatement>` +
+		`<saml:Attribute Name="urn:oid:0.9.2342.19200300.100.1.3" FriendlyName="email"><saml:AttributeValue>alice@example.com</saml:AttributeValue></saml:Attribute>` +
+		`<saml:Attribute Name="groups"><saml:AttributeValue>staff</saml:AttributeValue><saml:AttributeValue>dev</saml:AttributeValue></saml:Attribute>` +
+		`</saml:AttributeStatement></saml:Assertion>`
+	assertion = strings.Replace(assertion, "LATER", now.Add(5*time.Minute).Format(timeFormat), -1)
+	if edit != nil {
+		assertion = edit(assertion)
+	}
+	doc := `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="response-` + requestID + `" Version="2.0" InResponseTo="` + requestID + `" Destination="http://example.com/saml/acs">` +
+		`<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>` + assertion + `</samlp:Response>`
+	return idp.sign(t, doc, "assertion-"+requestID)
+}
+
+// sign replaces SIGNATURE in doc with a signature
+// of the element with id.
+func (idp *fakeIDP) sign(t *testing.T, doc, id string) string {
+	find := func(doc string) *xmltree.Node {
+		root, err := xmltree.Parse(strings.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var search func(n *xmltree.Node) *xmltree.Node
+		search = func(n *xmltree.Node) *xmltree.Node {
+			if n.Attr("ID") == id {
+				return n
+			}
+			for _, c := range n.Content {
+				if c, ok := c.(*xmltree.Node); ok {
+					if found := search(c); found != nil {
+						return found
+					}
+				}
+			}
+			return nil
+		}
+		return search(root)
+	}
+
+	digest := sha256.Sum256(canonicalize(find(strings.Replace(doc, "SIGNATURE", "", 1)), nil, nil))
+	signature := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo>` +
+		`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>` +
+		`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/>` +
+		`<ds:Reference URI="#` + id + `"><ds:Transforms>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>` +
+		`</ds:Transforms><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue></ds:Reference>` +
+		`</ds:SignedInfo><ds:SignatureValue>VALUE</ds:SignatureValue></ds:Signature>`
+	doc = strings.Replace(doc, "SIGNATURE", signature, 1)
+
+	signedInfo := find(doc).Child(dsigNamespace, "Signature").Child(dsigNamespace, "SignedInfo")
+	hashed := sha256.Sum256(canonicalize(signedInfo, nil, nil))
+	value, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Replace(doc, "VALUE", base64.StdEncoding.EncodeToString(value), 1)
+}
+
+func newTestConfig(idp *fakeIDP) *Config {
+	sealer, _ := seal.New([]byte("secret"))
+	return &Config{
+		IDP: IdentityProvider{
+			EntityID: "https://idp.example.com",
+			SSOURL:   "https://idp.example.com/sso",
+			Certs:    []*x509.Certificate{idp.cert},
+		},
+		MetadataPath:    "/saml/metadata",
+		ACSPath:         "/saml/acs",
+		LogoutPath:      "/saml/logout",
+		SessionTTL:      time.Hour,
+		Headers:         []HeaderAttribute{{Header: "X-Email", Attribute: "email"}, {Header: "X-Groups", Attribute: "groups"}},
+		GroupsAttribute: "groups",
+		Rules:           []Rule{{Path: "/"}, {Path: "/admin", Groups: []string{"admins"}}},
+		Except:          []string{"/public"},
+		sealer:          sealer,
+		replay:          newReplayCache(),
+	}
+}
+
+func TestLogin(t *testing.T) {
+	idp := newFakeIDP(t)
+	var headers http.Header
+	var nameID string
+	s := SAML{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			headers = r.Header
+			nameID = httpserver.NewReplacer(r, nil, "").Replace("{saml.name_id}")
+			return http.StatusOK, nil
+		}),
+		Config: newTestConfig(idp),
+	}
+	serve := func(r *http.Request, cookies []*http.Cookie) (int, *httptest.ResponseRecorder) {
+		r.Header.Set("X-Email", "mallory@example.com")
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		status, err := s.ServeHTTP(w, r)
+		if err != nil {
+			t.Logf("%s: %v", r.URL, err)
+		}
+		return status, w
+	}
+
+	// unprotected paths are served without login,
+	// but without headers the client made up
+	if status, _ := serve(httptest.NewRequest("GET", "/public/index.html", nil), nil); status != http.StatusOK || headers.Get("X-Email") != "" {
+		t.Errorf("Expected public path to be served without attributes, got %d and %v", status, headers)
+	}
+
+	// the metadata describes the assertion consumer service
+	_, w := serve(httptest.NewRequest("GET", "/saml/metadata", nil), nil)
+	if body := w.Body.String(); !strings.Contains(body, `entityID="http://example.com/saml/metadata"`) ||
+		!strings.Contains(body, `Location="http://example.com/saml/acs"`) {
+		t.Errorf("Unexpected metadata: %s", body)
+	}
+
+	// protected paths send the user to the identity provider
+	_, w = serve(httptest.NewRequest("GET", "/docs?page=2", nil), nil)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected redirect to log in, got %d", w.Code)
+	}
+	requestID, relayState := idp.requestID(t, w.Header().Get("Location"))
+	stateCookies := (&http.Response{Header: w.Header()}).Cookies()
+
+	post := func(relayState, response string) *http.Request {
+		form := url.Values{"RelayState": {relayState}, "SAMLResponse": {base64.StdEncoding.EncodeToString([]byte(response))}}
+		r := httptest.NewRequest("POST", "/saml/acs", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+	response := idp.response(t, requestID, nil)
+	if status, _ := serve(post("forged", response), stateCookies); status != http.StatusBadRequest {
+		t.Errorf("Expected forged relay state to be rejected, got %d", status)
+	}
+	_, w = serve(post(relayState, response), stateCookies)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/docs?page=2" {
+		t.Fatalf("Expected redirect back to the page, got %d to '%s'", w.Code, w.Header().Get("Location"))
+	}
+	var sessionCookies []*http.Cookie
+	for _, c := range (&http.Response{Header: w.Header()}).Cookies() {
+		if c.Name == sessionCookie {
+			sessionCookies = append(sessionCookies, c)
+		}
+	}
+	if len(sessionCookies) != 1 || !sessionCookies[0].HttpOnly {
+		t.Fatalf("Expected an HttpOnly session cookie, got %v", sessionCookies)
+	}
+
+	// assertions can be used only once
+	if status, _ := serve(post(relayState, response), stateCookies); status != http.StatusUnauthorized {
+		t.Errorf("Expected replayed assertion to be rejected, got %d", status)
+	}
+
+	// with the session, attributes are passed on
+	if status, _ := serve(httptest.NewRequest("GET", "/docs", nil), sessionCookies); status != http.StatusOK {
+		t.Errorf("Expected logged in user to be served, got %d", status)
+	}
+	if headers.Get("X-Email") != "alice@example.com" || headers.Get("X-Groups") != "staff,dev" || nameID != "alice@example.com" {
+		t.Errorf("Expected attributes in headers and placeholders, got %v and '%s'", headers, nameID)
+	}
+
+	// but only paths for the groups of the user
+	if status, _ := serve(httptest.NewRequest("GET", "/admin/users", nil), sessionCookies); status != http.StatusForbidden {
+		t.Errorf("Expected status %d for admin path, got %d", http.StatusForbidden, status)
+	}
+
+	// requests that cannot follow redirects are refused
+	if status, _ := serve(httptest.NewRequest("POST", "/docs", nil), nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for POST without session, got %d", http.StatusUnauthorized, status)
+	}
+
+	// logging out clears the session
+	_, w = serve(httptest.NewRequest("GET", "/saml/logout", nil), sessionCookies)
+	if c := (&http.Response{Header: w.Header()}).Cookies(); len(c) != 1 || c[0].Name != sessionCookie || c[0].MaxAge >= 0 {
+		t.Errorf("Expected session cookie to be deleted, got %v", c)
+	}
+}
+
+func TestVerifyResponse(t *testing.T) {
+	idp := newFakeIDP(t)
+	other := newFakeIDP(t)
+	cfg := newTestConfig(idp)
+	const acsURL = "http://example.com/saml/acs"
+
+	sess, err := cfg.verifyResponse([]byte(idp.response(t, "req", nil)), "req", acsURL, time.Now())
+	if err != nil {
+		t.Fatalf("Expected valid response to verify, got %v", err)
+	}
+	if sess.NameID != "alice@example.com" || len(sess.Attributes["groups"]) != 2 || sess.Attributes["email"][0] != "alice@example.com" {
+		t.Errorf("Unexpected session %+v", sess)
+	}
+
+	replace := func(old, new string) func(string) string {
+		return func(s string) string { return strings.Replace(s, old, new, -1) }
+	}
+	for i, test := range []struct {
+		id       string
+		response string
+	}{
+		// not signed
+		{"1", regexp.MustCompile(`<ds:Signature.*</ds:Signature>`).ReplaceAllString(idp.response(t, "1", nil), "")},
+		// signed by someone else
+		{"2", other.response(t, "2", nil)},
+		// changed after it was signed
+		{"3", strings.Replace(idp.response(t, "3", nil), ">staff<", ">admins<", 1)},
+		// not to the login request
+		{"4", idp.response(t, "other", nil)},
+		// for another service provider
+		{"5", idp.response(t, "5", replace("http://example.com/saml/metadata", "https://other.example.com"))},
+		// for another assertion consumer service
+		{"6", idp.response(t, "6", replace(`Recipient="http://example.com`, `Recipient="https://other.example.com`))},
+		// issued by someone else
+		{"7", idp.response(t, "7", replace("<saml:Issuer>https://idp.example.com", "<saml:Issuer>https://evil.example.com"))},
+		// a signed assertion next to a forged one
+		{"8", strings.Replace(idp.response(t, "8", nil), "</samlp:Response>",
+			`<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="forged"></saml:Assertion></samlp:Response>`, 1)},
+		// the signature is of another element
+		{"9", strings.Replace(idp.response(t, "9", nil), `ID="assertion-9"`, `ID="assertion-x"`, 1)},
+		// login failed
+		{"10", strings.Replace(idp.response(t, "10", nil), "status:Success", "status:Requester", 1)},
+	} {
+		if _, err := cfg.verifyResponse([]byte(test.response), test.id, acsURL, time.Now()); err == nil {
+			t.Errorf("Test %d: Expected invalid response to be rejected", i)
+		}
+	}
+
+	// expired
+	response := idp.response(t, "expired", nil)
+	if _, err := cfg.verifyResponse([]byte(response), "expired", acsURL, time.Now().Add(10*time.Minute)); err == nil {
+		t.Error("Expected expired response to be rejected")
+	}
+}
+
+func TestSealer(t *testing.T) {
+	s, _ := seal.New([]byte("secret"))
+	value, err := s.Seal(sessionCookie, session{NameID: "alice", Expires: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sess session
+	if err := s.Open(sessionCookie, value, &sess); err != nil || sess.NameID != "alice" || sess.Expires != 42 {
+		t.Errorf("Expected session to round trip, got %+v and %v", sess, err)
+	}
+	if err := s.Open(stateCookie, value, &sess); err == nil {
+		t.Error("Expected session cookie not to open as another cookie")
+	}
+}
@@ -0,0 +1,56 @@
+package saml
+
+import (
+	"sync"
+	"time"
+)
+
+// session is what is stored in the session cookie of a user
+// who logged in.
+type session struct {
+	NameID string `json:"n"`
+
+	// Attributes of the assertion that are used
+	Attributes map[string][]string `json:"a"`
+
+	// Unix time after which the user must log in again
+	Expires int64 `json:"e"`
+}
+
+// loginState is what is stored in a cookie while the user
+// logs in at the identity provider.
+type loginState struct {
+	ID         string `json:"i"` // of the AuthnRequest
+	RelayState string `json:"s"`
+	Return     string `json:"r"` // URL to return to
+	Expires    int64  `json:"e"`
+}
+
+// replayCache remembers the IDs of assertions that were used
+// until they expire, so that each can be used only once.
+type replayCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{seen: make(map[string]time.Time)}
+}
+
+// use records that the assertion id, valid until expires, was
+// used, and returns false if it was used before.
+func (rc *replayCache) use(id string, expires time.Time) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	now := time.Now()
+	for seenID, exp := range rc.seen {
+		if now.After(exp) {
+			delete(rc.seen, seenID)
+		}
+	}
+	if _, ok := rc.seen[id]; ok {
+		return false
+	}
+	rc.seen[id] = expires
+	return true
+}
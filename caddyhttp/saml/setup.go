@@ -0,0 +1,224 @@
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/internal/seal"
+)
+
+func init() {
+	caddy.RegisterPlugin("saml", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new SAML middleware instance.
+func setup(c *caddy.Controller) error {
+	cfg, err := samlParse(c)
+	if err != nil {
+		return err
+	}
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return SAML{Next: next, Config: cfg}
+	})
+	return nil
+}
+
+// samlParse parses the saml directive, which has the form
+//
+//	saml {
+//	    entity_id        id
+//	    idp_metadata     file|url
+//	    idp_sso_url      url
+//	    idp_cert         file
+//	    idp_entity_id    id
+//	    metadata_path    path
+//	    acs_path         path
+//	    logout_path      path
+//	    cookie_secret    secret
+//	    session_ttl      duration
+//	    header           name attribute
+//	    groups_attribute attribute
+//	    protect          path [groups...]
+//	    except           paths...
+//	}
+//
+// The identity provider is configured either with its metadata,
+// or with the URL of its single sign-on service and a PEM file of
+// its signing certificate. The cookie secret is required. Without
+// protect lines, the whole site requires users to log in.
+func samlParse(c *caddy.Controller) (*Config, error) {
+	var cfg *Config
+	for c.Next() {
+		if cfg != nil {
+			return nil, c.Err("saml: only one saml directive per site")
+		}
+		if len(c.RemainingArgs()) > 0 {
+			return nil, c.ArgErr()
+		}
+		cfg = &Config{
+			MetadataPath:    "/saml/metadata",
+			ACSPath:         "/saml/acs",
+			LogoutPath:      "/saml/logout",
+			SessionTTL:      defaultSessionTTL,
+			GroupsAttribute: "groups",
+		}
+		var cookieSecret, idpEntityID string
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return nil, c.ArgErr()
+			}
+			switch what {
+			case "header":
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				cfg.Headers = append(cfg.Headers, HeaderAttribute{Header: args[0], Attribute: args[1]})
+				continue
+			case "protect":
+				cfg.Rules = append(cfg.Rules, Rule{Path: args[0], Groups: args[1:]})
+				continue
+			case "except":
+				cfg.Except = append(cfg.Except, args...)
+				continue
+			}
+
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			value := args[0]
+			switch what {
+			case "entity_id":
+				cfg.EntityID = value
+			case "idp_metadata":
+				idp, err := loadMetadata(value)
+				if err != nil {
+					return nil, c.Errf("saml: loading idp_metadata '%s': %v", value, err)
+				}
+				cfg.IDP = idp
+			case "idp_sso_url":
+				u, err := url.Parse(value)
+				if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+					return nil, c.Errf("saml: invalid idp_sso_url '%s'", value)
+				}
+				cfg.IDP.SSOURL = value
+			case "idp_cert":
+				certs, err := loadCerts(value)
+				if err != nil {
+					return nil, c.Errf("saml: loading idp_cert '%s': %v", value, err)
+				}
+				cfg.IDP.Certs = append(cfg.IDP.Certs, certs...)
+			case "idp_entity_id":
+				idpEntityID = value
+			case "metadata_path":
+				cfg.MetadataPath = value
+			case "acs_path":
+				cfg.ACSPath = value
+			case "logout_path":
+				cfg.LogoutPath = value
+			case "cookie_secret":
+				cookieSecret = value
+			case "session_ttl":
+				dur, err := time.ParseDuration(value)
+				if err != nil || dur <= 0 {
+					return nil, c.Errf("saml: invalid session_ttl '%s'", value)
+				}
+				cfg.SessionTTL = dur
+			case "groups_attribute":
+				cfg.GroupsAttribute = value
+			default:
+				return nil, c.Errf("saml: unknown property '%s'", what)
+			}
+		}
+
+		if cfg.IDP.SSOURL == "" || len(cfg.IDP.Certs) == 0 {
+			return nil, c.Err("saml: idp_metadata, or idp_sso_url and idp_cert, are required")
+		}
+		if idpEntityID != "" {
+			cfg.IDP.EntityID = idpEntityID
+		}
+		if cookieSecret == "" {
+			return nil, c.Err("saml: cookie_secret is required")
+		}
+		if len(cfg.Rules) == 0 {
+			cfg.Rules = []Rule{{Path: "/"}}
+		}
+		sealer, err := seal.New([]byte(cookieSecret))
+		if err != nil {
+			return nil, err
+		}
+		cfg.sealer = sealer
+		cfg.replay = newReplayCache()
+	}
+	return cfg, nil
+}
+
+// loadMetadata reads the metadata of an identity
+// provider from a file or a URL.
+func loadMetadata(location string) (IdentityProvider, error) {
+	var r io.Reader
+	if strings.HasPrefix(location, "https://") || strings.HasPrefix(location, "http://") {
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Get(location)
+		if err != nil {
+			return IdentityProvider{}, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return IdentityProvider{}, fmt.Errorf("status %d", resp.StatusCode)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(location)
+		if err != nil {
+			return IdentityProvider{}, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return parseMetadata(r)
+}
+
+// loadCerts reads the PEM encoded certificates in a file.
+func loadCerts(filename string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates in %s", filename)
+	}
+	return certs, nil
+}
+
+const defaultSessionTTL = 8 * time.Hour
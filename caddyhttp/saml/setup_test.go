@@ -0,0 +1,164 @@
+package saml
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// writeIDPFiles writes a PEM file with the certificate of idp
+// and a metadata file of idp to dir.
+func writeIDPFiles(t *testing.T, dir string, idp *fakeIDP) (certFile, metadataFile string) {
+	certFile = filepath.Join(dir, "idp.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: idp.cert.Raw})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	metadataFile = filepath.Join(dir, "idp.xml")
+	metadata := `<?xml version="1.0"?>
+<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://idp.example.com/metadata">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="encryption">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:X509Data><ds:X509Certificate>bm90IGEgY2VydA==</ds:X509Certificate></ds:X509Data></ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:KeyDescriptor use="signing">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:X509Data><ds:X509Certificate>
+        ` + base64.StdEncoding.EncodeToString(idp.cert.Raw) + `
+      </ds:X509Certificate></ds:X509Data></ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://idp.example.com/sso/post"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`
+	if err := ioutil.WriteFile(metadataFile, []byte(metadata), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, metadataFile
+}
+
+func TestSetup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_saml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	_, metadataFile := writeIDPFiles(t, dir, newFakeIDP(t))
+
+	c := caddy.NewTestController("http", `saml {
+		idp_metadata  `+metadataFile+`
+		cookie_secret secret
+	}`)
+	err = setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(SAML)
+	if !ok {
+		t.Fatalf("Expected handler to be type SAML, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestSAMLParse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_saml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idp := newFakeIDP(t)
+	certFile, metadataFile := writeIDPFiles(t, dir, idp)
+
+	cfg, err := samlParse(caddy.NewTestController("http", `saml {
+		entity_id        https://app.example.com
+		idp_sso_url      https://idp.example.com/sso
+		idp_cert         `+certFile+`
+		idp_entity_id    https://idp.example.com
+		metadata_path    /sso/metadata
+		acs_path         /sso/acs
+		logout_path      /sso/logout
+		cookie_secret    s3cret
+		session_ttl      1h
+		header           X-Email email
+		header           X-Name displayName
+		groups_attribute memberOf
+		protect          /admin admins ops
+		protect          /app
+		except           /app/static /app/health
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(cfg.IDP.Certs) != 1 || !cfg.IDP.Certs[0].Equal(idp.cert) {
+		t.Errorf("Expected certificate of the identity provider, got %v", cfg.IDP.Certs)
+	}
+	if cfg.sealer == nil || cfg.replay == nil {
+		t.Errorf("Expected sealer and replay cache to be set up, got %+v", cfg)
+	}
+	cfg.IDP.Certs, cfg.sealer, cfg.replay = nil, nil, nil
+	expected := Config{
+		EntityID:        "https://app.example.com",
+		IDP:             IdentityProvider{EntityID: "https://idp.example.com", SSOURL: "https://idp.example.com/sso"},
+		MetadataPath:    "/sso/metadata",
+		ACSPath:         "/sso/acs",
+		LogoutPath:      "/sso/logout",
+		SessionTTL:      time.Hour,
+		Headers:         []HeaderAttribute{{"X-Email", "email"}, {"X-Name", "displayName"}},
+		GroupsAttribute: "memberOf",
+		Rules:           []Rule{{Path: "/admin", Groups: []string{"admins", "ops"}}, {Path: "/app", Groups: []string{}}},
+		Except:          []string{"/app/static", "/app/health"},
+	}
+	if !reflect.DeepEqual(*cfg, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, *cfg)
+	}
+
+	// the identity provider can be configured with its metadata,
+	// and the whole site is protected by default
+	cfg, err = samlParse(caddy.NewTestController("http", `saml {
+		idp_metadata  `+metadataFile+`
+		cookie_secret secret
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cfg.IDP.EntityID != "https://idp.example.com/metadata" || cfg.IDP.SSOURL != "https://idp.example.com/sso" ||
+		len(cfg.IDP.Certs) != 1 || !cfg.IDP.Certs[0].Equal(idp.cert) {
+		t.Errorf("Expected identity provider from metadata, got %+v", cfg.IDP)
+	}
+	if len(cfg.Rules) != 1 || cfg.Rules[0].Path != "/" || cfg.SessionTTL != defaultSessionTTL || cfg.ACSPath != "/saml/acs" {
+		t.Errorf("Expected defaults, got %+v", cfg)
+	}
+
+	for i, input := range []string{
+		`saml`,
+		"saml {\n idp_metadata " + metadataFile + " \n}",
+		"saml {\n idp_sso_url https://idp.example.com/sso \n cookie_secret secret \n}",
+		"saml {\n idp_cert " + certFile + " \n cookie_secret secret \n}",
+		"saml {\n idp_sso_url idp.example.com/sso \n idp_cert " + certFile + " \n cookie_secret secret \n}",
+		"saml {\n idp_metadata " + certFile + " \n cookie_secret secret \n}",
+		"saml {\n idp_metadata " + filepath.Join(dir, "missing.xml") + " \n cookie_secret secret \n}",
+		"saml {\n idp_sso_url https://idp.example.com/sso \n idp_cert " + metadataFile + " \n cookie_secret secret \n}",
+		"saml {\n idp_metadata " + metadataFile + " \n cookie_secret secret \n session_ttl forever \n}",
+		"saml {\n idp_metadata " + metadataFile + " \n cookie_secret secret \n header X-Email \n}",
+		"saml {\n idp_metadata " + metadataFile + " \n cookie_secret secret \n login_path /login \n}",
+		"saml /path {\n idp_metadata " + metadataFile + " \n cookie_secret secret \n}",
+	} {
+		if _, err := samlParse(caddy.NewTestController("http", input)); err == nil {
+			t.Errorf("Test %d: Expected error for %q but got none", i, input)
+		}
+	}
+}
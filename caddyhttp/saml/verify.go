@@ -0,0 +1,142 @@
+package saml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	_ "crypto/sha1"   // for crypto.SHA1
+	_ "crypto/sha256" // for crypto.SHA256
+	_ "crypto/sha512" // for crypto.SHA512
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/internal/xmltree"
+)
+
+// verifySignature verifies the enveloped XML signature of el,
+// which must be a child of el that signs all of el, with one
+// of certs.
+func verifySignature(el *xmltree.Node, certs []*x509.Certificate) error {
+	sig := el.Child(dsigNamespace, "Signature")
+	if sig == nil {
+		return errors.New("not signed")
+	}
+	signedInfo := sig.Child(dsigNamespace, "SignedInfo")
+	if signedInfo == nil {
+		return errors.New("signature without SignedInfo")
+	}
+
+	c14nMethod := signedInfo.Child(dsigNamespace, "CanonicalizationMethod")
+	if c14nMethod == nil || c14nMethod.Attr("Algorithm") != excC14N {
+		return errors.New("unsupported canonicalization method")
+	}
+	var signatureHash crypto.Hash
+	if method := signedInfo.Child(dsigNamespace, "SignatureMethod"); method != nil {
+		signatureHash = signatureMethods[method.Attr("Algorithm")]
+	}
+	if signatureHash == 0 {
+		return errors.New("unsupported signature method")
+	}
+
+	// the one reference must be to el, so that
+	// what is verified is what is used
+	refs := signedInfo.Children(dsigNamespace, "Reference")
+	if len(refs) != 1 {
+		return errors.New("signature must have exactly one reference")
+	}
+	ref := refs[0]
+	if id := el.Attr("ID"); id == "" || ref.Attr("URI") != "#"+id {
+		return errors.New("signature does not reference the signed element")
+	}
+	var refInclusive []string
+	var hasC14N bool
+	if transforms := ref.Child(dsigNamespace, "Transforms"); transforms != nil {
+		for _, t := range transforms.Children(dsigNamespace, "Transform") {
+			switch t.Attr("Algorithm") {
+			case envelopedSignature:
+			case excC14N:
+				hasC14N = true
+				refInclusive = inclusivePrefixes(t)
+			default:
+				return fmt.Errorf("unsupported transform %s", t.Attr("Algorithm"))
+			}
+		}
+	}
+	if !hasC14N {
+		return errors.New("reference must be canonicalized with exclusive canonicalization")
+	}
+	var digestHash crypto.Hash
+	if method := ref.Child(dsigNamespace, "DigestMethod"); method != nil {
+		digestHash = digestMethods[method.Attr("Algorithm")]
+	}
+	if digestHash == 0 {
+		return errors.New("unsupported digest method")
+	}
+	digestValue := ref.Child(dsigNamespace, "DigestValue")
+	if digestValue == nil {
+		return errors.New("reference without digest")
+	}
+	expected, err := decodeBase64(digestValue.Text())
+	if err != nil {
+		return fmt.Errorf("decoding digest: %v", err)
+	}
+	h := digestHash.New()
+	h.Write(canonicalize(el, sig, refInclusive))
+	if !bytes.Equal(h.Sum(nil), expected) {
+		return errors.New("digest mismatch")
+	}
+
+	signatureValue := sig.Child(dsigNamespace, "SignatureValue")
+	if signatureValue == nil {
+		return errors.New("signature without value")
+	}
+	signature, err := decodeBase64(signatureValue.Text())
+	if err != nil {
+		return fmt.Errorf("decoding signature: %v", err)
+	}
+	h = signatureHash.New()
+	h.Write(canonicalize(signedInfo, nil, inclusivePrefixes(c14nMethod)))
+	digest := h.Sum(nil)
+	for _, cert := range certs {
+		if key, ok := cert.PublicKey.(*rsa.PublicKey); ok &&
+			rsa.VerifyPKCS1v15(key, signatureHash, digest, signature) == nil {
+			return nil
+		}
+	}
+	return errors.New("invalid signature")
+}
+
+// inclusivePrefixes returns the prefixes of the InclusiveNamespaces
+// child of a canonicalization method or transform.
+func inclusivePrefixes(method *xmltree.Node) []string {
+	if in := method.Child(excC14N, "InclusiveNamespaces"); in != nil {
+		return strings.Fields(in.Attr("PrefixList"))
+	}
+	return nil
+}
+
+// decodeBase64 decodes base64 that may be broken into lines.
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
+
+const (
+	dsigNamespace      = "http://www.w3.org/2000/09/xmldsig#"
+	excC14N            = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	envelopedSignature = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+)
+
+var signatureMethods = map[string]crypto.Hash{
+	"http://www.w3.org/2000/09/xmldsig#rsa-sha1":        crypto.SHA1,
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha256": crypto.SHA256,
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha512": crypto.SHA512,
+}
+
+var digestMethods = map[string]crypto.Hash{
+	"http://www.w3.org/2000/09/xmldsig#sha1":  crypto.SHA1,
+	"http://www.w3.org/2001/04/xmlenc#sha256": crypto.SHA256,
+	"http://www.w3.org/2001/04/xmlenc#sha512": crypto.SHA512,
+}
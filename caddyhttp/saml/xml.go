@@ -0,0 +1,143 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"sort"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/internal/xmltree"
+)
+
+// canonicalize returns n in Exclusive XML Canonicalization form
+// (without comments), leaving out the element exclude, if any.
+// inclusive lists prefixes, "#default" for the default namespace,
+// that are treated as if n used them.
+func canonicalize(n *xmltree.Node, exclude *xmltree.Node, inclusive []string) []byte {
+	var buf bytes.Buffer
+	c14n(&buf, n, map[string]string{}, exclude, inclusive)
+	return buf.Bytes()
+}
+
+func c14n(buf *bytes.Buffer, n *xmltree.Node, rendered map[string]string, exclude *xmltree.Node, inclusive []string) {
+	// namespaces are rendered where they are visibly used, unless
+	// an ancestor in the output rendered them with the same value
+	used := map[string]bool{n.Prefix: true}
+	for _, a := range n.Attrs {
+		if a.Name.Space != "" && a.Name.Space != "xmlns" && a.Name.Space != "xml" {
+			used[a.Name.Space] = true
+		}
+	}
+	for _, prefix := range inclusive {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		if prefix == "" || n.Namespace(prefix) != "" {
+			used[prefix] = true
+		}
+	}
+	var prefixes []string
+	for prefix := range used {
+		uri := n.Namespace(prefix)
+		if prefix != "" && uri == "" {
+			continue
+		}
+		if rendered[prefix] != uri {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Strings(prefixes)
+	if len(prefixes) > 0 {
+		inherited := rendered
+		rendered = make(map[string]string, len(inherited)+len(prefixes))
+		for k, v := range inherited {
+			rendered[k] = v
+		}
+	}
+
+	buf.WriteByte('<')
+	writeName(buf, n.Prefix, n.Local)
+	for _, prefix := range prefixes {
+		uri := n.Namespace(prefix)
+		rendered[prefix] = uri
+		if prefix == "" {
+			buf.WriteString(` xmlns="`)
+		} else {
+			buf.WriteString(` xmlns:` + prefix + `="`)
+		}
+		escapeAttr(buf, uri)
+		buf.WriteByte('"')
+	}
+
+	var attrs []xml.Attr
+	for _, a := range n.Attrs {
+		if a.Name.Space != "xmlns" && !(a.Name.Space == "" && a.Name.Local == "xmlns") {
+			attrs = append(attrs, a)
+		}
+	}
+	sort.Sort(byNamespace{attrs, n})
+	for _, a := range attrs {
+		buf.WriteByte(' ')
+		writeName(buf, a.Name.Space, a.Name.Local)
+		buf.WriteString(`="`)
+		escapeAttr(buf, a.Value)
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('>')
+
+	for _, c := range n.Content {
+		switch c := c.(type) {
+		case string:
+			escapeText(buf, c)
+		case *xmltree.Node:
+			if c != exclude {
+				c14n(buf, c, rendered, exclude, inclusive)
+			}
+		}
+	}
+
+	buf.WriteString("</")
+	writeName(buf, n.Prefix, n.Local)
+	buf.WriteByte('>')
+}
+
+// byNamespace sorts the attributes of an element by namespace
+// URI, then local name, as canonicalization requires.
+type byNamespace struct {
+	attrs []xml.Attr
+	n     *xmltree.Node
+}
+
+func (b byNamespace) Len() int      { return len(b.attrs) }
+func (b byNamespace) Swap(i, j int) { b.attrs[i], b.attrs[j] = b.attrs[j], b.attrs[i] }
+func (b byNamespace) Less(i, j int) bool {
+	si, sj := b.space(b.attrs[i]), b.space(b.attrs[j])
+	if si != sj {
+		return si < sj
+	}
+	return b.attrs[i].Name.Local < b.attrs[j].Name.Local
+}
+
+func (b byNamespace) space(a xml.Attr) string {
+	if a.Name.Space == "" {
+		return ""
+	}
+	return b.n.Namespace(a.Name.Space)
+}
+
+func writeName(buf *bytes.Buffer, prefix, local string) {
+	if prefix != "" {
+		buf.WriteString(prefix)
+		buf.WriteByte(':')
+	}
+	buf.WriteString(local)
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;",
+		"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeText(buf *bytes.Buffer, s string) { textEscaper.WriteString(buf, s) }
+func escapeAttr(buf *bytes.Buffer, s string) { attrEscaper.WriteString(buf, s) }
@@ -0,0 +1,34 @@
+package saml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/internal/xmltree"
+)
+
+func TestCanonicalize(t *testing.T) {
+	root, err := xmltree.Parse(strings.NewReader(`<?xml version="1.0"?>
+<a:root xmlns:a="urn:a" xmlns:b="urn:b" xmlns="urn:d"><!-- comment --><b:child z="1" b:x="3" a:y="2" xmlns:c="urn:c">text &amp; &gt; <a:leaf/><other   q='"'/></b:child></a:root>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	child := root.Child("urn:b", "child")
+	if child == nil {
+		t.Fatal("Expected to find child element")
+	}
+
+	for i, test := range []struct {
+		exclude   *xmltree.Node
+		inclusive []string
+		expected  string
+	}{
+		{nil, nil, `<b:child xmlns:a="urn:a" xmlns:b="urn:b" z="1" a:y="2" b:x="3">text &amp; &gt; <a:leaf></a:leaf><other xmlns="urn:d" q="&quot;"></other></b:child>`},
+		{nil, []string{"#default"}, `<b:child xmlns="urn:d" xmlns:a="urn:a" xmlns:b="urn:b" z="1" a:y="2" b:x="3">text &amp; &gt; <a:leaf></a:leaf><other q="&quot;"></other></b:child>`},
+		{child.Child("urn:a", "leaf"), nil, `<b:child xmlns:a="urn:a" xmlns:b="urn:b" z="1" a:y="2" b:x="3">text &amp; &gt; <other xmlns="urn:d" q="&quot;"></other></b:child>`},
+	} {
+		if actual := string(canonicalize(child, test.exclude, test.inclusive)); actual != test.expected {
+			t.Errorf("Test %d: Expected\n%s\ngot\n%s", i, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Package schedule provides middleware that limits how many requests
+// are served at once, and shares the capacity among classes of
+// requests by weight, so that important requests never starve
+// behind bulk ones.
+package schedule
+
+import (
+	"container/list"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Schedule is middleware that makes requests wait for their
+// turn while the server is at its concurrency limit.
+type Schedule struct {
+	Next      httpserver.Handler
+	Scheduler *Scheduler
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (s Schedule) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	class := s.Scheduler.classify(r)
+	if !s.Scheduler.acquire(r, class) {
+		w.Header().Set("Retry-After", strconv.Itoa(int((s.Scheduler.Timeout+time.Second-1)/time.Second)))
+		return http.StatusServiceUnavailable, nil
+	}
+	defer s.Scheduler.release(class)
+	return s.Next.ServeHTTP(w, r)
+}
+
+// Class is a class of requests that share capacity.
+type Class struct {
+	Name string
+
+	// Share of the capacity relative to other
+	// classes when they compete for it
+	Weight int
+
+	// Most requests of the class served at
+	// once; 0 means no limit of its own
+	MaxConcurrent int
+
+	running int
+	pass    float64   // virtual time of the next request
+	waiters list.List // of chan struct{}
+}
+
+// full returns whether c serves as many requests as it may.
+func (c *Class) full() bool {
+	return c.MaxConcurrent > 0 && c.running >= c.MaxConcurrent
+}
+
+// Rule assigns a class to requests for a host, or to a base path.
+type Rule struct {
+	Host  string
+	Path  string
+	Class *Class
+}
+
+// Scheduler decides the order in which requests are served.
+// While it serves MaxConcurrent requests, other requests wait.
+// When one is done, the next request is taken from the class
+// that has had the least of its weighted share so far; classes
+// listed first win ties.
+type Scheduler struct {
+	// Most requests served at once
+	MaxConcurrent int
+
+	// Longest a request may wait
+	Timeout time.Duration
+
+	// Most requests that may wait at once
+	MaxQueued int
+
+	// Classes, from highest to lowest priority
+	Classes []*Class
+
+	// Rules that assign requests to classes. The
+	// longest matching path wins; host rules apply
+	// if no path matches.
+	Rules []Rule
+
+	// Class of requests no rule matches
+	Default *Class
+
+	mu      sync.Mutex
+	running int
+	queued  int
+	vtime   float64 // pass of the last request served
+}
+
+// classify returns the class of r.
+func (s *Scheduler) classify(r *http.Request) *Class {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	var byHost, byPath *Class
+	var longest int
+	for _, rule := range s.Rules {
+		switch {
+		case rule.Path != "":
+			if httpserver.Path(r.URL.Path).Matches(rule.Path) && len(rule.Path) > longest {
+				byPath, longest = rule.Class, len(rule.Path)
+			}
+		case byHost == nil && rule.Host == host:
+			byHost = rule.Class
+		}
+	}
+	switch {
+	case byPath != nil:
+		return byPath
+	case byHost != nil:
+		return byHost
+	}
+	return s.Default
+}
+
+// acquire waits until a request of class may be served, and
+// returns whether it may; if so, release must be called when
+// it is done. It returns false if too many requests are waiting
+// already, or the request waited too long.
+func (s *Scheduler) acquire(r *http.Request, class *Class) bool {
+	s.mu.Lock()
+	if s.running < s.MaxConcurrent && !class.full() && class.waiters.Len() == 0 {
+		s.activate(class)
+		s.start(class)
+		s.mu.Unlock()
+		return true
+	}
+	if s.queued >= s.MaxQueued {
+		s.mu.Unlock()
+		return false
+	}
+	if class.waiters.Len() == 0 {
+		s.activate(class)
+	}
+	ready := make(chan struct{}, 1)
+	e := class.waiters.PushBack(ready)
+	s.queued++
+	s.mu.Unlock()
+
+	timer := time.NewTimer(s.Timeout)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return true
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-ready:
+		// started just now, so make way for the next one
+		s.finish(class)
+	default:
+		class.waiters.Remove(e)
+		s.queued--
+	}
+	return false
+}
+
+// release is called when a request of class is done.
+func (s *Scheduler) release(class *Class) {
+	s.mu.Lock()
+	s.finish(class)
+	s.mu.Unlock()
+}
+
+// activate brings the pass of class, which had no requests
+// waiting, up to date, so that it cannot make up for the
+// time it did not use. s.mu must be locked.
+func (s *Scheduler) activate(class *Class) {
+	if class.pass < s.vtime {
+		class.pass = s.vtime
+	}
+}
+
+// start counts a request of class as being served and
+// advances the pass of class. s.mu must be locked.
+func (s *Scheduler) start(class *Class) {
+	s.running++
+	class.running++
+	s.vtime = class.pass
+	class.pass += 1 / float64(class.Weight)
+}
+
+// finish counts a request of class as done and starts
+// waiting requests while there is room. s.mu must be locked.
+func (s *Scheduler) finish(class *Class) {
+	s.running--
+	class.running--
+	for s.running < s.MaxConcurrent {
+		var next *Class
+		for _, c := range s.Classes {
+			if c.waiters.Len() > 0 && !c.full() && (next == nil || c.pass < next.pass) {
+				next = c
+			}
+		}
+		if next == nil {
+			return
+		}
+		e := next.waiters.Front()
+		next.waiters.Remove(e)
+		s.queued--
+		s.start(next)
+		e.Value.(chan struct{}) <- struct{}{}
+	}
+}
+
+const (
+	defaultTimeout   = 30 * time.Second
+	defaultMaxQueued = 1000
+)
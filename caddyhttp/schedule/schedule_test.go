@@ -0,0 +1,167 @@
+package schedule
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func newTestScheduler(max int, classes ...*Class) *Scheduler {
+	return &Scheduler{
+		MaxConcurrent: max,
+		Timeout:       time.Minute,
+		MaxQueued:     defaultMaxQueued,
+		Classes:       classes,
+		Default:       classes[len(classes)-1],
+	}
+}
+
+// waitQueued waits until n requests are waiting in s.
+func waitQueued(t *testing.T, s *Scheduler, n int) {
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		s.mu.Lock()
+		queued := s.queued
+		s.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("Timed out waiting for %d queued requests, have %d", n, queued)
+		}
+	}
+}
+
+func TestWeightedFairness(t *testing.T) {
+	admin, bulk, web := &Class{Name: "admin", Weight: 3}, &Class{Name: "bulk", Weight: 1}, &Class{Name: "web", Weight: 1}
+	s := newTestScheduler(1, admin, bulk, web)
+	r := httptest.NewRequest("GET", "/", nil)
+
+	// one request is served while many of two classes wait
+	if !s.acquire(r, web) {
+		t.Fatal("Expected first request to be served at once")
+	}
+	started := make(chan *Class, 40)
+	for _, class := range []*Class{bulk, admin} {
+		for i := 0; i < 20; i++ {
+			go func(class *Class) {
+				if s.acquire(r, class) {
+					started <- class
+				}
+			}(class)
+		}
+	}
+	waitQueued(t, s, 40)
+
+	// as requests finish, admin gets three times the turns
+	counts := make(map[string]int)
+	last := web
+	for i := 0; i < 8; i++ {
+		s.release(last)
+		select {
+		case last = <-started:
+			counts[last.Name]++
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for a request to start")
+		}
+	}
+	if counts["admin"] != 6 || counts["bulk"] != 2 {
+		t.Errorf("Expected 6 admin and 2 bulk requests served, got %v", counts)
+	}
+}
+
+func TestClassLimit(t *testing.T) {
+	web, bulk := &Class{Name: "web", Weight: 1}, &Class{Name: "bulk", Weight: 1, MaxConcurrent: 1}
+	s := newTestScheduler(3, web, bulk)
+	r := httptest.NewRequest("GET", "/", nil)
+
+	if !s.acquire(r, bulk) {
+		t.Fatal("Expected first bulk request to be served at once")
+	}
+	started := make(chan bool, 1)
+	go func() { started <- s.acquire(r, bulk) }()
+	waitQueued(t, s, 1)
+
+	// other classes are not held up by the capped one
+	if !s.acquire(r, web) {
+		t.Error("Expected web request to be served at once")
+	}
+	s.release(bulk)
+	select {
+	case ok := <-started:
+		if !ok {
+			t.Error("Expected second bulk request to be served")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the second bulk request")
+	}
+}
+
+func TestScheduleRejects(t *testing.T) {
+	class := &Class{Name: "default", Weight: 1}
+	s := newTestScheduler(1, class)
+	s.Timeout = 20 * time.Millisecond
+	h := Schedule{Next: httpserver.EmptyNext, Scheduler: s}
+
+	if !s.acquire(httptest.NewRequest("GET", "/", nil), class) {
+		t.Fatal("Expected first request to be served at once")
+	}
+
+	// a request that waits too long is rejected
+	w := httptest.NewRecorder()
+	if status, _ := h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil)); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d after timeout, got %d", http.StatusServiceUnavailable, status)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Expected Retry-After 1, got '%s'", got)
+	}
+
+	// and so is one that cannot wait at all
+	s.MaxQueued = 0
+	start := time.Now()
+	if status, _ := h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d with a full queue, got %d", http.StatusServiceUnavailable, status)
+	}
+	if time.Since(start) >= s.Timeout {
+		t.Error("Expected request to be rejected without waiting")
+	}
+
+	// once the first request is done, requests are served again
+	s.release(class)
+	if status, _ := h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)); status != 0 {
+		t.Errorf("Expected request to be passed on, got status %d", status)
+	}
+	if s.running != 0 || s.queued != 0 {
+		t.Errorf("Expected no requests running or queued, got %d and %d", s.running, s.queued)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	admin, bulk, web := &Class{Name: "admin"}, &Class{Name: "bulk"}, &Class{Name: "web"}
+	s := &Scheduler{
+		Rules: []Rule{
+			{Host: "admin.example.com", Class: admin},
+			{Path: "/health", Class: admin},
+			{Path: "/files", Class: bulk},
+			{Path: "/files/small", Class: web},
+		},
+		Default: web,
+	}
+	for i, test := range []struct {
+		url      string
+		expected *Class
+	}{
+		{"http://example.com/", web},
+		{"http://example.com/health", admin},
+		{"http://example.com/files/big.iso", bulk},
+		{"http://example.com/files/small/a.txt", web},
+		{"http://admin.example.com:8080/", admin},
+		{"http://admin.example.com/files/big.iso", bulk},
+	} {
+		if actual := s.classify(httptest.NewRequest("GET", test.url, nil)); actual != test.expected {
+			t.Errorf("Test %d: Expected class %s for %s, got %s", i, test.expected.Name, test.url, actual.Name)
+		}
+	}
+}
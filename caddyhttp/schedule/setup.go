@@ -0,0 +1,152 @@
+package schedule
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("schedule", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Schedule middleware instance.
+func setup(c *caddy.Controller) error {
+	scheduler, err := scheduleParse(c)
+	if err != nil {
+		return err
+	}
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Schedule{Next: next, Scheduler: scheduler}
+	})
+	return nil
+}
+
+// scheduleParse parses the schedule directive, which has the form
+//
+//	schedule max_concurrent {
+//	    class   name [weight [max_concurrent]]
+//	    path    class paths...
+//	    host    class hosts...
+//	    default class
+//	    timeout duration
+//	    queue   max_queued
+//	}
+//
+// Classes are listed from highest to lowest priority, and have a
+// weight of 1 by default. Requests no rule matches belong to the
+// default class, which is a class named "default" of weight 1 and
+// lowest priority unless another one is given.
+func scheduleParse(c *caddy.Controller) (*Scheduler, error) {
+	var s *Scheduler
+	for c.Next() {
+		if s != nil {
+			return nil, c.Err("schedule: only one schedule directive per site")
+		}
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return nil, c.ArgErr()
+		}
+		max, err := strconv.Atoi(args[0])
+		if err != nil || max < 1 {
+			return nil, c.Errf("schedule: invalid max_concurrent '%s'", args[0])
+		}
+		s = &Scheduler{MaxConcurrent: max, Timeout: defaultTimeout, MaxQueued: defaultMaxQueued}
+
+		classes := make(map[string]*Class)
+		var defaultClass string
+		type ruleArgs struct {
+			what  string
+			class string
+			args  []string
+		}
+		var rules []ruleArgs
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "class":
+				if len(args) < 1 || len(args) > 3 {
+					return nil, c.ArgErr()
+				}
+				if _, ok := classes[args[0]]; ok {
+					return nil, c.Errf("schedule: duplicate class '%s'", args[0])
+				}
+				class := &Class{Name: args[0], Weight: 1}
+				if len(args) > 1 {
+					class.Weight, err = strconv.Atoi(args[1])
+					if err != nil || class.Weight < 1 {
+						return nil, c.Errf("schedule: invalid weight '%s'", args[1])
+					}
+				}
+				if len(args) > 2 {
+					class.MaxConcurrent, err = strconv.Atoi(args[2])
+					if err != nil || class.MaxConcurrent < 1 {
+						return nil, c.Errf("schedule: invalid max_concurrent '%s'", args[2])
+					}
+				}
+				classes[class.Name] = class
+				s.Classes = append(s.Classes, class)
+			case "path", "host":
+				if len(args) < 2 {
+					return nil, c.ArgErr()
+				}
+				rules = append(rules, ruleArgs{what: what, class: args[0], args: args[1:]})
+			case "default":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				defaultClass = args[0]
+			case "timeout":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				s.Timeout, err = time.ParseDuration(args[0])
+				if err != nil || s.Timeout <= 0 {
+					return nil, c.Errf("schedule: invalid timeout '%s'", args[0])
+				}
+			case "queue":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				s.MaxQueued, err = strconv.Atoi(args[0])
+				if err != nil || s.MaxQueued < 0 {
+					return nil, c.Errf("schedule: invalid queue length '%s'", args[0])
+				}
+			default:
+				return nil, c.Errf("schedule: unknown property '%s'", what)
+			}
+		}
+
+		for _, rule := range rules {
+			class, ok := classes[rule.class]
+			if !ok {
+				return nil, c.Errf("schedule: unknown class '%s'", rule.class)
+			}
+			for _, arg := range rule.args {
+				if rule.what == "path" {
+					s.Rules = append(s.Rules, Rule{Path: arg, Class: class})
+				} else {
+					s.Rules = append(s.Rules, Rule{Host: arg, Class: class})
+				}
+			}
+		}
+		if defaultClass == "" {
+			defaultClass = "default"
+			if _, ok := classes[defaultClass]; !ok {
+				class := &Class{Name: defaultClass, Weight: 1}
+				classes[defaultClass] = class
+				s.Classes = append(s.Classes, class)
+			}
+		}
+		if s.Default = classes[defaultClass]; s.Default == nil {
+			return nil, c.Errf("schedule: unknown class '%s'", defaultClass)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,111 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `schedule 100`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Schedule)
+	if !ok {
+		t.Fatalf("Expected handler to be type Schedule, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestScheduleParse(t *testing.T) {
+	s, err := scheduleParse(caddy.NewTestController("http", `schedule 50 {
+		class   admin 10 5
+		class   web   4
+		class   bulk  1 10
+		path    admin /health /admin
+		host    admin admin.example.com
+		path    bulk  /downloads
+		default web
+		timeout 5s
+		queue   200
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if s.MaxConcurrent != 50 || s.Timeout != 5*time.Second || s.MaxQueued != 200 {
+		t.Errorf("Expected 50 concurrent, 5s timeout, 200 queued, got %d, %v, %d", s.MaxConcurrent, s.Timeout, s.MaxQueued)
+	}
+	if len(s.Classes) != 3 {
+		t.Fatalf("Expected 3 classes, got %d", len(s.Classes))
+	}
+	for i, expected := range []Class{
+		{Name: "admin", Weight: 10, MaxConcurrent: 5},
+		{Name: "web", Weight: 4},
+		{Name: "bulk", Weight: 1, MaxConcurrent: 10},
+	} {
+		class := s.Classes[i]
+		if class.Name != expected.Name || class.Weight != expected.Weight || class.MaxConcurrent != expected.MaxConcurrent {
+			t.Errorf("Class %d: Expected %s of weight %d and max %d, got %s of weight %d and max %d", i,
+				expected.Name, expected.Weight, expected.MaxConcurrent, class.Name, class.Weight, class.MaxConcurrent)
+		}
+	}
+	expectedRules := []Rule{
+		{Path: "/health", Class: s.Classes[0]},
+		{Path: "/admin", Class: s.Classes[0]},
+		{Host: "admin.example.com", Class: s.Classes[0]},
+		{Path: "/downloads", Class: s.Classes[2]},
+	}
+	if len(s.Rules) != len(expectedRules) {
+		t.Fatalf("Expected %d rules, got %d", len(expectedRules), len(s.Rules))
+	}
+	for i, rule := range s.Rules {
+		if rule != expectedRules[i] {
+			t.Errorf("Rule %d: Expected %+v, got %+v", i, expectedRules[i], rule)
+		}
+	}
+	if s.Default != s.Classes[1] {
+		t.Errorf("Expected default class web, got %s", s.Default.Name)
+	}
+
+	// without classes, there is only the default one
+	s, err = scheduleParse(caddy.NewTestController("http", `schedule 10`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(s.Classes) != 1 || s.Default != s.Classes[0] || s.Default.Name != "default" {
+		t.Errorf("Expected only a default class, got %+v", s.Classes)
+	}
+
+	for i, input := range []string{
+		`schedule`,
+		`schedule many`,
+		`schedule 0`,
+		`schedule 10 20`,
+		"schedule 10 {\n class \n}",
+		"schedule 10 {\n class a 0 \n}",
+		"schedule 10 {\n class a 1 0 \n}",
+		"schedule 10 {\n class a \n class a \n}",
+		"schedule 10 {\n path a /x \n}",
+		"schedule 10 {\n class a \n path a \n}",
+		"schedule 10 {\n default b \n}",
+		"schedule 10 {\n timeout 0s \n}",
+		"schedule 10 {\n queue -1 \n}",
+		"schedule 10 {\n weight 5 \n}",
+		"schedule 10\nschedule 20",
+	} {
+		if _, err := scheduleParse(caddy.NewTestController("http", input)); err == nil {
+			t.Errorf("Test %d: Expected error for %q but got none", i, input)
+		}
+	}
+}
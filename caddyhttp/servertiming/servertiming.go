@@ -0,0 +1,107 @@
+// Package servertiming provides middleware that reports how long
+// the phases of handling a request took in the Server-Timing
+// response header, where browser developer tools show them.
+package servertiming
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// ServerTiming is middleware that times the handling of requests.
+type ServerTiming struct {
+	Next httpserver.Handler
+
+	// Phases are the phases reported: "total", for the
+	// middleware chain until the response header is written,
+	// "upstream", for the time waiting for the header of the
+	// response from the upstream of a proxy, and "tls", for
+	// the handshake of the connection of its first request
+	Phases map[string]bool
+
+	// AllowOrigins are the origins, or *, whose pages may read
+	// the timings of cross-origin requests to the site
+	AllowOrigins []string
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (st ServerTiming) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	start := time.Now()
+	r, timings := httpserver.WithServerTimings(r)
+	if d, ok := httpserver.TLSHandshakeDuration(r); ok {
+		timings.Add("tls", "TLS handshake", d)
+	}
+	tw := &timingWriter{ResponseWriter: w, st: st, timings: timings, start: start}
+	return st.Next.ServeHTTP(tw, r)
+}
+
+// timingWriter adds the Server-Timing header to a
+// response when its header is written.
+type timingWriter struct {
+	http.ResponseWriter
+	st          ServerTiming
+	timings     *httpserver.ServerTimings
+	start       time.Time
+	wroteHeader bool
+}
+
+// WriteHeader adds the timings so far to the header and writes it.
+func (w *timingWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.timings.Add("total", "Middleware chain", time.Since(w.start))
+	if value := w.timings.Header(w.st.Phases); value != "" {
+		w.Header().Add("Server-Timing", value)
+		if len(w.st.AllowOrigins) > 0 {
+			w.Header().Set("Timing-Allow-Origin", strings.Join(w.st.AllowOrigins, ", "))
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes the header, if it was not yet, and then p.
+func (w *timingWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher. It simply wraps the underlying
+// ResponseWriter's Flush method if there is one, or panics.
+func (w *timingWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	} else {
+		panic(httpserver.NonFlusherError{Underlying: w.ResponseWriter}) // should be recovered at the beginning of middleware stack
+	}
+}
+
+// Hijack implements http.Hijacker. It simply wraps the underlying
+// ResponseWriter's Hijack method if there is one, or returns an error.
+func (w *timingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, httpserver.NonHijackerError{Underlying: w.ResponseWriter}
+}
+
+// CloseNotify implements http.CloseNotifier.
+// It just inherits the underlying ResponseWriter's CloseNotify method.
+// It panics if the underlying ResponseWriter is not a CloseNotifier.
+func (w *timingWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	panic(httpserver.NonCloseNotifierError{Underlying: w.ResponseWriter})
+}
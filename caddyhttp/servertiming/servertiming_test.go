@@ -0,0 +1,64 @@
+package servertiming
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestServerTiming(t *testing.T) {
+	for i, test := range []struct {
+		phases       map[string]bool
+		allowOrigins []string
+		expected     []string
+		unexpected   []string
+	}{
+		{map[string]bool{"total": true, "upstream": true}, nil,
+			[]string{`total;desc="Middleware chain";dur=`, `upstream;desc="Upstream";dur=5`}, []string{"tls"}},
+		{map[string]bool{"upstream": true}, []string{"https://example.com"},
+			[]string{`upstream;desc="Upstream";dur=5`}, []string{"total"}},
+		{map[string]bool{"tls": true}, []string{"*"}, nil, nil},
+	} {
+		st := ServerTiming{
+			Phases:       test.phases,
+			AllowOrigins: test.allowOrigins,
+			Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				httpserver.AddServerTiming(r, "upstream", "Upstream", 5*time.Millisecond)
+				w.Write([]byte("body"))
+				return 0, nil
+			}),
+		}
+		w := httptest.NewRecorder()
+		st.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		header := w.Header().Get("Server-Timing")
+		for _, s := range test.expected {
+			if !strings.Contains(header, s) {
+				t.Errorf("Test %d: Expected Server-Timing to contain %s, got %s", i, s, header)
+			}
+		}
+		for _, s := range test.unexpected {
+			if strings.Contains(header, s) {
+				t.Errorf("Test %d: Expected Server-Timing not to contain %s, got %s", i, s, header)
+			}
+		}
+		if test.expected == nil && header != "" {
+			t.Errorf("Test %d: Expected no Server-Timing, got %s", i, header)
+		}
+
+		allow := w.Header().Get("Timing-Allow-Origin")
+		if expected := strings.Join(test.allowOrigins, ", "); header != "" && allow != expected {
+			t.Errorf("Test %d: Expected Timing-Allow-Origin %s, got %s", i, expected, allow)
+		}
+		if header == "" && allow != "" {
+			t.Errorf("Test %d: Expected no Timing-Allow-Origin without timings, got %s", i, allow)
+		}
+		if w.Body.String() != "body" {
+			t.Errorf("Test %d: Expected body to be written, got %q", i, w.Body.String())
+		}
+	}
+}
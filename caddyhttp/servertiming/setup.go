@@ -0,0 +1,79 @@
+package servertiming
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("server_timing", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new ServerTiming middleware instance. Syntax:
+//
+//	server_timing [total] [upstream] [tls] {
+//	    allow_origin origins...
+//	}
+//
+// All phases are reported unless some are given. Browsers
+// only show the timings of cross-origin requests to pages
+// of the origins allowed, which may be *.
+func setup(c *caddy.Controller) error {
+	st, err := serverTimingParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	cfg.TimeTLSHandshakes = st.Phases["tls"]
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		st.Next = next
+		return st
+	})
+
+	return nil
+}
+
+func serverTimingParse(c *caddy.Controller) (ServerTiming, error) {
+	var st ServerTiming
+
+	var seen bool
+	for c.Next() {
+		if seen {
+			return st, c.Err("server_timing: can only be specified once per site")
+		}
+		seen = true
+
+		st.Phases = make(map[string]bool)
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			args = []string{"total", "upstream", "tls"}
+		}
+		for _, phase := range args {
+			switch phase {
+			case "total", "upstream", "tls":
+				st.Phases[phase] = true
+			default:
+				return st, c.Errf("server_timing: unknown phase '%s'", phase)
+			}
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "allow_origin":
+				origins := c.RemainingArgs()
+				if len(origins) == 0 {
+					return st, c.ArgErr()
+				}
+				st.AllowOrigins = append(st.AllowOrigins, origins...)
+			default:
+				return st, c.Errf("server_timing: unknown property '%s'", c.Val())
+			}
+		}
+	}
+
+	return st, nil
+}
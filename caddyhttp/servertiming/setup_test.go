@@ -0,0 +1,73 @@
+package servertiming
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `server_timing`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	cfg := httpserver.GetConfig(c)
+	if !cfg.TimeTLSHandshakes {
+		t.Error("Expected TLS handshakes to be timed")
+	}
+	mids := cfg.Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	st, ok := handler.(ServerTiming)
+	if !ok {
+		t.Fatalf("Expected handler to be type ServerTiming, got: %#v", handler)
+	}
+	if !httpserver.SameNext(st.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestServerTimingParse(t *testing.T) {
+	all := map[string]bool{"total": true, "upstream": true, "tls": true}
+	for i, test := range []struct {
+		input        string
+		shouldErr    bool
+		phases       map[string]bool
+		allowOrigins []string
+	}{
+		{`server_timing`, false, all, nil},
+		{`server_timing total upstream`, false, map[string]bool{"total": true, "upstream": true}, nil},
+		{`server_timing {
+			allow_origin https://example.com https://example.org
+		}`, false, all, []string{"https://example.com", "https://example.org"}},
+		{`server_timing db`, true, nil, nil},
+		{`server_timing {
+			allow_origin
+		}`, true, nil, nil},
+		{`server_timing {
+			precision 2
+		}`, true, nil, nil},
+		{`server_timing
+		server_timing tls`, true, nil, nil},
+	} {
+		st, err := serverTimingParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(st.Phases, test.phases) || !reflect.DeepEqual(st.AllowOrigins, test.allowOrigins) {
+			t.Errorf("Test %d: Expected phases %v and origins %v, got %v and %v",
+				i, test.phases, test.allowOrigins, st.Phases, st.AllowOrigins)
+		}
+	}
+}
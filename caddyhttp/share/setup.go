@@ -0,0 +1,147 @@
+package share
+
+import (
+	"crypto/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("share", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
+	})
+}
+
+// setup configures a new Share middleware instance. Syntax:
+//
+//	share [path] {
+//	    admin        path
+//	    allow_remote
+//	    max_ttl      duration
+//	    secret       key
+//	}
+//
+// Links are served under path (/share by default) and minted
+// under the admin path (/share-admin by default). Unless
+// allow_remote is given, only clients on the loopback interface
+// may mint links; otherwise the admin path should be protected,
+// such as by basicauth. Links are valid for at most max_ttl
+// (30 days by default). Without a secret, links are signed with
+// a random key, which is kept on reloads but not on restarts.
+func setup(c *caddy.Controller) error {
+	if err := httpserver.CheckStaticRoot(c); err != nil {
+		return err
+	}
+	share, err := shareParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	share.Root = cfg.Root
+	share.Hide = cfg.HiddenFiles
+	if share.Secret == nil {
+		share.Secret, err = siteSecret(cfg.Addr.String())
+		if err != nil {
+			return err
+		}
+	}
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		share.Next = next
+		return share
+	})
+	return nil
+}
+
+func shareParse(c *caddy.Controller) (Share, error) {
+	share := Share{Path: defaultPath, AdminPath: defaultAdminPath, MaxTTL: defaultMaxTTL}
+	var seen bool
+	for c.Next() {
+		if seen {
+			return share, c.Err("share: can only be specified once per site")
+		}
+		seen = true
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			if !strings.HasPrefix(args[0], "/") || args[0] == "/" {
+				return share, c.Errf("share: invalid path '%s'", args[0])
+			}
+			share.Path = strings.TrimSuffix(args[0], "/")
+		default:
+			return share, c.ArgErr()
+		}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "admin":
+				if !c.NextArg() {
+					return share, c.ArgErr()
+				}
+				if !strings.HasPrefix(c.Val(), "/") {
+					return share, c.Errf("share: invalid admin path '%s'", c.Val())
+				}
+				share.AdminPath = c.Val()
+			case "allow_remote":
+				share.AllowRemote = true
+			case "max_ttl":
+				if !c.NextArg() {
+					return share, c.ArgErr()
+				}
+				d, err := time.ParseDuration(c.Val())
+				if err != nil || d <= 0 {
+					return share, c.Errf("share: invalid max_ttl '%s'", c.Val())
+				}
+				share.MaxTTL = d
+			case "secret":
+				if !c.NextArg() {
+					return share, c.ArgErr()
+				}
+				if len(c.Val()) < minSecretLength {
+					return share, c.Errf("share: secret must be at least %d characters", minSecretLength)
+				}
+				share.Secret = []byte(c.Val())
+			default:
+				return share, c.Errf("share: unknown property '%s'", c.Val())
+			}
+			if c.NextArg() {
+				return share, c.ArgErr()
+			}
+		}
+	}
+	if httpserver.Path(share.AdminPath).Matches(share.Path + "/") {
+		return share, c.Errf("share: admin path '%s' is under path '%s'", share.AdminPath, share.Path)
+	}
+	return share, nil
+}
+
+// siteSecret returns the random secret of the site at addr,
+// which is made the first time a site at addr is set up.
+func siteSecret(addr string) ([]byte, error) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	if secret, ok := secrets[addr]; ok {
+		return secret, nil
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	secrets[addr] = secret
+	return secret, nil
+}
+
+var (
+	// secrets are the random secrets of the sites, by address
+	secrets   = make(map[string][]byte)
+	secretsMu sync.Mutex
+)
+
+const minSecretLength = 16
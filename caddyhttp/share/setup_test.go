@@ -0,0 +1,80 @@
+package share
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `share`)
+	cfg := httpserver.GetConfig(c)
+	cfg.Addr = httpserver.Address{Host: "share.example.com", Port: "443"}
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := cfg.Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler, ok := mids[0](httpserver.EmptyNext).(Share)
+	if !ok {
+		t.Fatalf("Expected handler to be type Share, got: %#v", mids[0](httpserver.EmptyNext))
+	}
+	if !httpserver.SameNext(handler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if len(handler.Secret) != 32 {
+		t.Errorf("Expected random secret, got %x", handler.Secret)
+	}
+
+	// a reload keeps the secret
+	c = caddy.NewTestController("http", `share`)
+	httpserver.GetConfig(c).Addr = cfg.Addr
+	if err := setup(c); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded := httpserver.GetConfig(c).Middleware()[0](httpserver.EmptyNext).(Share); !bytes.Equal(reloaded.Secret, handler.Secret) {
+		t.Error("Expected secret to be kept on reload")
+	}
+}
+
+func TestShareParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  Share
+	}{
+		{`share`, false, Share{Path: "/share", AdminPath: "/share-admin", MaxTTL: defaultMaxTTL}},
+		{"share /files/ {\n admin /mint\n allow_remote\n max_ttl 2h\n secret 0123456789abcdef\n}", false,
+			Share{Path: "/files", AdminPath: "/mint", AllowRemote: true, MaxTTL: 2 * time.Hour, Secret: []byte("0123456789abcdef")}},
+		{`share files`, true, Share{}},
+		{`share /`, true, Share{}},
+		{"share {\n admin /share/admin\n}", true, Share{}},
+		{"share {\n max_ttl 0s\n}", true, Share{}},
+		{"share {\n secret short\n}", true, Share{}},
+		{"share {\n allow_remote yes\n}", true, Share{}},
+		{"share {\n foo\n}", true, Share{}},
+		{"share\nshare", true, Share{}},
+	} {
+		share, err := shareParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if share.Path != test.expected.Path || share.AdminPath != test.expected.AdminPath ||
+			share.AllowRemote != test.expected.AllowRemote || share.MaxTTL != test.expected.MaxTTL ||
+			!bytes.Equal(share.Secret, test.expected.Secret) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, share)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Package share provides middleware that serves files of the site
+// through expiring links, which can be minted for single files or
+// directories without exposing the rest of the site.
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+// Share is middleware that serves the files that links under
+// Path were minted for, and an API under AdminPath to mint them:
+//
+//	POST {admin}?path=p&ttl=d[&password=pw]
+//
+// mints a link to the file or directory p, relative to the root,
+// that expires after d (24h by default). A link with a password
+// asks for it with basic authentication, with any username.
+type Share struct {
+	Next      httpserver.Handler
+	Path      string
+	AdminPath string
+
+	// AllowRemote is whether clients other than those on
+	// the loopback interface may mint links.
+	AllowRemote bool
+
+	// MaxTTL is the longest time a link may be valid for.
+	MaxTTL time.Duration
+
+	// Root is the site root, and Hide are the
+	// files that are never served.
+	Root string
+	Hide []string
+
+	// Secret is the key links are signed with.
+	Secret []byte
+}
+
+// Link is a minted link.
+type Link struct {
+	URL     string    `json:"url"`
+	Path    string    `json:"path"`
+	Expires time.Time `json:"expires"`
+}
+
+// token is what a link grants: the file or directory
+// at Path until Expires, given the password whose
+// verifier is Verifier, if any.
+type token struct {
+	Path     string `json:"p"`
+	Expires  int64  `json:"e"`
+	Verifier string `json:"v,omitempty"`
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (s Share) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if httpserver.Path(r.URL.Path).Matches(s.AdminPath) {
+		return s.serveAdmin(w, r)
+	}
+	if httpserver.Path(r.URL.Path).Matches(s.Path + "/") {
+		return s.serveShared(w, r)
+	}
+	return s.Next.ServeHTTP(w, r)
+}
+
+// serveAdmin mints a link.
+func (s Share) serveAdmin(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !s.AllowRemote && !caddy.IsLoopback(r.RemoteAddr) {
+		return http.StatusForbidden, nil
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		return http.StatusMethodNotAllowed, nil
+	}
+
+	if r.FormValue("path") == "" {
+		httpserver.WriteTextResponse(w, http.StatusBadRequest, "path is required\n")
+		return 0, nil
+	}
+	name := path.Clean("/" + r.FormValue("path"))
+	fi, err := os.Stat(filepath.Join(s.Root, filepath.FromSlash(name)))
+	if err != nil {
+		httpserver.WriteTextResponse(w, http.StatusNotFound, "no such file "+name+"\n")
+		return 0, nil
+	}
+	ttl := defaultTTL
+	if v := r.FormValue("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > s.MaxTTL {
+			httpserver.WriteTextResponse(w, http.StatusBadRequest, "invalid ttl "+v+"\n")
+			return 0, nil
+		}
+		ttl = d
+	}
+
+	tok := token{Path: name, Expires: time.Now().Add(ttl).Unix()}
+	if password := r.FormValue("password"); password != "" {
+		tok.Verifier = s.verifier(tok, password)
+	}
+	signed, err := s.sign(tok)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	link := Link{URL: s.Path + "/" + signed, Path: name, Expires: time.Unix(tok.Expires, 0).UTC()}
+	if fi.IsDir() {
+		link.URL += "/"
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	return httpserver.WriteJSONResponse(w, http.StatusOK, link)
+}
+
+// serveShared serves a file that a link grants.
+func (s Share) serveShared(w http.ResponseWriter, r *http.Request) (int, error) {
+	rest := strings.TrimPrefix(r.URL.Path, s.Path+"/")
+	signed, sub := rest, ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		signed, sub = rest[:i], rest[i:]
+	}
+	tok, err := s.verify(signed)
+	if err != nil || time.Now().Unix() >= tok.Expires {
+		return http.StatusNotFound, nil
+	}
+	if tok.Verifier != "" {
+		_, password, _ := r.BasicAuth()
+		given := s.verifier(tok, password)
+		if subtle.ConstantTimeCompare([]byte(given), []byte(tok.Verifier)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="share"`)
+			return http.StatusUnauthorized, nil
+		}
+	}
+
+	// only the shared file, or files in the shared
+	// directory, can be reached through the link
+	name := path.Join(tok.Path, sub)
+	if name != tok.Path && !strings.HasPrefix(name, strings.TrimSuffix(tok.Path, "/")+"/") {
+		return http.StatusNotFound, nil
+	}
+	if sub == "" {
+		// the links to directories end in a slash,
+		// so relative references stay in them
+		if fi, err := os.Stat(filepath.Join(s.Root, filepath.FromSlash(name))); err == nil && fi.IsDir() {
+			staticfiles.Redirect(w, r, path.Base(r.URL.Path)+"/", http.StatusMovedPermanently)
+			return http.StatusMovedPermanently, nil
+		}
+	}
+	if strings.HasSuffix(sub, "/") {
+		name += "/"
+	}
+
+	fs := staticfiles.FileServer{Root: http.Dir(s.Root), Hide: s.Hide}
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = name
+	w.Header().Set("Cache-Control", "private, no-store")
+	return fs.ServeHTTP(w, r2)
+}
+
+// sign returns tok encoded and signed with the secret.
+func (s Share) sign(tok token) (string, error) {
+	payload, err := json.Marshal(tok)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verify returns the token that signed encodes, if
+// it was signed with the secret.
+func (s Share) verify(signed string) (token, error) {
+	var tok token
+	dot := strings.Index(signed, ".")
+	if dot < 0 {
+		return tok, errInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(signed[:dot])
+	if err != nil {
+		return tok, errInvalidToken
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signed[dot+1:])
+	if err != nil {
+		return tok, errInvalidToken
+	}
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write(payload)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return tok, errInvalidToken
+	}
+	if err := json.Unmarshal(payload, &tok); err != nil {
+		return tok, errInvalidToken
+	}
+	return tok, nil
+}
+
+// verifier returns what checks password for tok; only
+// the secret can make it, so it can't be guessed offline
+// by the holders of the link.
+func (s Share) verifier(tok token, password string) string {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte("password\x00" + tok.Path + "\x00" + strconv.FormatInt(tok.Expires, 10) + "\x00" + password))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+var errInvalidToken = errors.New("invalid share token")
+
+const (
+	defaultPath      = "/share"
+	defaultAdminPath = "/share-admin"
+	defaultTTL       = 24 * time.Hour
+	defaultMaxTTL    = 30 * 24 * time.Hour
+)
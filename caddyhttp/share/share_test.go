@@ -0,0 +1,110 @@
+package share
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestShare(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_share")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	os.Mkdir(filepath.Join(root, "docs"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("shared a"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "docs", "Caddyfile"), []byte("hidden"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "top.txt"), []byte("top"), 0644)
+
+	s := Share{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Path:      defaultPath,
+		AdminPath: defaultAdminPath,
+		MaxTTL:    time.Hour,
+		Root:      root,
+		Hide:      []string{"/docs/Caddyfile"},
+		Secret:    []byte("0123456789abcdef"),
+	}
+	mint := func(form url.Values, remote string) (*httptest.ResponseRecorder, int) {
+		r := httptest.NewRequest("POST", defaultAdminPath, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		status, _ := s.ServeHTTP(w, r)
+		return w, status
+	}
+
+	// only local clients may mint links, for files that exist
+	if _, status := mint(url.Values{"path": {"/top.txt"}}, "192.0.2.1:1234"); status != http.StatusForbidden {
+		t.Errorf("Expected remote client to be forbidden, got %d", status)
+	}
+	if w, _ := mint(url.Values{"path": {"/missing.txt"}}, "127.0.0.1:1234"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected missing file to be refused, got %d", w.Code)
+	}
+	if w, _ := mint(url.Values{"path": {"/top.txt"}, "ttl": {"2h"}}, "127.0.0.1:1234"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected ttl over maximum to be refused, got %d", w.Code)
+	}
+
+	var dirLink, fileLink Link
+	w, _ := mint(url.Values{"path": {"docs"}, "password": {"secret"}}, "127.0.0.1:1234")
+	if err := json.Unmarshal(w.Body.Bytes(), &dirLink); err != nil {
+		t.Fatalf("Expected link, got %s", w.Body.String())
+	}
+	if !strings.HasPrefix(dirLink.URL, "/share/") || !strings.HasSuffix(dirLink.URL, "/") || dirLink.Path != "/docs" {
+		t.Errorf("Expected link to directory, got %+v", dirLink)
+	}
+	w, _ = mint(url.Values{"path": {"/top.txt"}, "ttl": {"30m"}}, "127.0.0.1:1234")
+	if err := json.Unmarshal(w.Body.Bytes(), &fileLink); err != nil {
+		t.Fatalf("Expected link, got %s", w.Body.String())
+	}
+	if d := fileLink.Expires.Sub(time.Now()); d < 29*time.Minute || d > 31*time.Minute {
+		t.Errorf("Expected link to expire in 30m, got %v", fileLink.Expires)
+	}
+
+	expired, _ := s.sign(token{Path: "/top.txt", Expires: time.Now().Add(-time.Second).Unix()})
+	forged, _ := (Share{Secret: []byte("fedcba9876543210")}).sign(token{Path: "/top.txt", Expires: time.Now().Add(time.Hour).Unix()})
+
+	for i, test := range []struct {
+		path, password string
+		expectStatus   int
+		expectBody     string
+	}{
+		{fileLink.URL, "", http.StatusOK, "top"},
+		{fileLink.URL + "/other", "", http.StatusNotFound, ""},
+		{dirLink.URL + "a.txt", "secret", http.StatusOK, "shared a"},
+		{dirLink.URL + "a.txt", "", http.StatusUnauthorized, ""},
+		{dirLink.URL + "a.txt", "wrong", http.StatusUnauthorized, ""},
+		{strings.TrimSuffix(dirLink.URL, "/"), "secret", http.StatusMovedPermanently, ""},
+		{dirLink.URL + "../top.txt", "secret", http.StatusNotFound, ""},
+		{dirLink.URL + "Caddyfile", "secret", http.StatusNotFound, ""},
+		{"/share/" + expired, "", http.StatusNotFound, ""},
+		{"/share/" + forged, "", http.StatusNotFound, ""},
+		{"/share/garbage", "", http.StatusNotFound, ""},
+		{"/top.txt", "", http.StatusTeapot, ""},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		if test.password != "" {
+			r.SetBasicAuth("anyone", test.password)
+		}
+		w := httptest.NewRecorder()
+		status, _ := s.ServeHTTP(w, r)
+		if status != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if test.expectBody != "" && w.Body.String() != test.expectBody {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.expectBody, w.Body.String())
+		}
+	}
+}
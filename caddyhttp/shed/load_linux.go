@@ -0,0 +1,20 @@
+package shed
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// loadAverage returns the load average of the system
+// over the last minute.
+func loadAverage() (float64, error) {
+	contents, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.Fields(string(contents) + " 0")[0], 64)
+}
+
+// loadSupported is whether loadAverage works on this platform.
+const loadSupported = true
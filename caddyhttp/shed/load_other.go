@@ -0,0 +1,14 @@
+// +build !linux
+
+package shed
+
+import "errors"
+
+// loadAverage returns the load average of the system
+// over the last minute.
+func loadAverage() (float64, error) {
+	return 0, errors.New("load average not supported on this platform")
+}
+
+// loadSupported is whether loadAverage works on this platform.
+const loadSupported = false
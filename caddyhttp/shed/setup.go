@@ -0,0 +1,117 @@
+package shed
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("shed", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Shed middleware instance.
+func setup(c *caddy.Controller) error {
+	shedder, err := shedParse(c)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	c.OnStartup(func() error {
+		go shedder.worker(stop)
+		return nil
+	})
+	c.OnShutdown(func() error {
+		close(stop)
+		return nil
+	})
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Shed{Next: next, Shedder: shedder}
+	})
+	return nil
+}
+
+// shedParse parses the shed directive, which has the form
+//
+//	shed {
+//	    load       factor
+//	    goroutines count
+//	    latency    duration
+//	    interval   duration
+//	    low|normal|high|critical paths...
+//	}
+//
+// where load is the one-minute load average per CPU. At least
+// one of load, goroutines and latency (the 99th percentile of
+// response latency) is required.
+func shedParse(c *caddy.Controller) (*Shedder, error) {
+	var shedder *Shedder
+	for c.Next() {
+		if shedder != nil {
+			return nil, c.Err("shed: only one shed directive per site")
+		}
+		shedder = &Shedder{Interval: defaultInterval}
+		if len(c.RemainingArgs()) > 0 {
+			return nil, c.ArgErr()
+		}
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return nil, c.ArgErr()
+			}
+			if priority, ok := priorities[what]; ok {
+				for _, path := range args {
+					shedder.Classes = append(shedder.Classes, PathClass{Path: path, Priority: priority})
+				}
+				continue
+			}
+			if len(args) > 1 {
+				return nil, c.ArgErr()
+			}
+			var err error
+			switch what {
+			case "load":
+				if !loadSupported {
+					return nil, c.Err("shed: load is not supported on this platform")
+				}
+				shedder.Load, err = strconv.ParseFloat(args[0], 64)
+				if err == nil && shedder.Load <= 0 {
+					return nil, c.Err("shed: load must be positive")
+				}
+			case "goroutines":
+				shedder.Goroutines, err = strconv.Atoi(args[0])
+				if err == nil && shedder.Goroutines <= 0 {
+					return nil, c.Err("shed: goroutines must be positive")
+				}
+			case "latency", "interval":
+				var dur time.Duration
+				dur, err = time.ParseDuration(args[0])
+				if err == nil && dur <= 0 {
+					return nil, c.Errf("shed: %s must be positive", what)
+				}
+				if what == "latency" {
+					shedder.Latency = dur
+				} else {
+					shedder.Interval = dur
+				}
+			default:
+				return nil, c.Errf("shed: unknown property '%s'", what)
+			}
+			if err != nil {
+				return nil, c.Errf("shed: invalid %s '%s'", what, args[0])
+			}
+		}
+		if shedder.Load == 0 && shedder.Goroutines == 0 && shedder.Latency == 0 {
+			return nil, c.Err("shed: at least one of load, goroutines or latency is required")
+		}
+	}
+	return shedder, nil
+}
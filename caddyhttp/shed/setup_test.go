@@ -0,0 +1,112 @@
+package shed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `shed {
+		goroutines 10000
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Shed)
+	if !ok {
+		t.Fatalf("Expected handler to be type Shed, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestShedParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  *Shedder
+	}{
+		{`shed {
+			latency 500ms
+		}`, false, &Shedder{Latency: 500 * time.Millisecond, Interval: defaultInterval}},
+		{`shed {
+			goroutines 5000
+			latency    2s
+			interval   5s
+			low        /search /export
+			critical   /health
+			high       /checkout
+		}`, false, &Shedder{Goroutines: 5000, Latency: 2 * time.Second, Interval: 5 * time.Second, Classes: []PathClass{
+			{Path: "/search", Priority: Low},
+			{Path: "/export", Priority: Low},
+			{Path: "/health", Priority: Critical},
+			{Path: "/checkout", Priority: High},
+		}}},
+		{`shed`, true, nil},
+		{`shed /api {
+			goroutines 10
+		}`, true, nil},
+		{`shed {
+			low /search
+		}`, true, nil},
+		{`shed {
+			goroutines many
+		}`, true, nil},
+		{`shed {
+			latency 0s
+		}`, true, nil},
+		{`shed {
+			latency 1s 2s
+		}`, true, nil},
+		{`shed {
+			latency 1s
+			low
+		}`, true, nil},
+		{`shed {
+			cpu 90%
+		}`, true, nil},
+		{`shed {
+			goroutines 10
+		}
+		shed {
+			goroutines 20
+		}`, true, nil},
+	}
+
+	for i, test := range tests {
+		actual, err := shedParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error but got none", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error but got: %v", i, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		if actual.Load != test.expected.Load || actual.Goroutines != test.expected.Goroutines ||
+			actual.Latency != test.expected.Latency || actual.Interval != test.expected.Interval {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+		if len(actual.Classes) != len(test.expected.Classes) {
+			t.Errorf("Test %d: Expected %d classes, got %d", i, len(test.expected.Classes), len(actual.Classes))
+			continue
+		}
+		for j, class := range actual.Classes {
+			if class != test.expected.Classes[j] {
+				t.Errorf("Test %d, class %d: Expected %+v, got %+v", i, j, test.expected.Classes[j], class)
+			}
+		}
+	}
+}
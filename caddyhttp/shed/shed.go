@@ -0,0 +1,212 @@
+// Package shed provides middleware that rejects requests of low
+// priority while the server is overloaded, so that it stays
+// responsive for the requests that matter most.
+package shed
+
+import (
+	"log"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Priority is the priority class of requests. When the
+// server is overloaded, requests of the lowest priority
+// are shed first.
+type Priority int
+
+// Priority classes, from lowest to highest.
+const (
+	Low Priority = iota
+	Normal
+	High
+	// Critical requests are never shed.
+	Critical
+)
+
+// priorities maps the names of priority classes to them.
+var priorities = map[string]Priority{
+	"low":      Low,
+	"normal":   Normal,
+	"high":     High,
+	"critical": Critical,
+}
+
+// Shed is middleware that responds with 503 Service Unavailable
+// to requests whose priority is below the current shed level.
+type Shed struct {
+	Next    httpserver.Handler
+	Shedder *Shedder
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (s Shed) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if s.Shedder.sheds(s.Shedder.priority(r.URL.Path)) {
+		w.Header().Set("Retry-After", strconv.Itoa(int((s.Shedder.Interval+time.Second-1)/time.Second)))
+		return http.StatusServiceUnavailable, nil
+	}
+	start := time.Now()
+	status, err := s.Next.ServeHTTP(w, r)
+	s.Shedder.record(time.Since(start))
+	return status, err
+}
+
+// PathClass assigns a priority to requests to a base path.
+type PathClass struct {
+	Path     string
+	Priority Priority
+}
+
+// Shedder watches the load of the server and decides which
+// requests to shed. While any threshold is exceeded, it sheds
+// one more priority class every interval, starting with the
+// lowest; when none is, it stops shedding one class at a time.
+type Shedder struct {
+	// CPU load average per CPU above which the server
+	// is overloaded; 0 disables
+	Load float64
+
+	// Number of goroutines above which the server
+	// is overloaded; 0 disables
+	Goroutines int
+
+	// 99th percentile of response latency above which
+	// the server is overloaded; 0 disables
+	Latency time.Duration
+
+	// How often the load is measured
+	Interval time.Duration
+
+	// Priorities of requests by path; requests to
+	// other paths have Normal priority
+	Classes []PathClass
+
+	level int32 // requests below this priority are shed
+
+	mu        sync.Mutex
+	latencies []time.Duration // since the last measurement
+	next      int             // where to record once latencies is full
+}
+
+// priority returns the priority of requests to urlPath.
+func (s *Shedder) priority(urlPath string) Priority {
+	priority := Normal
+	var longest int
+	for _, class := range s.Classes {
+		if httpserver.Path(urlPath).Matches(class.Path) && len(class.Path) > longest {
+			priority, longest = class.Priority, len(class.Path)
+		}
+	}
+	return priority
+}
+
+// sheds returns whether requests of priority p are shed.
+func (s *Shedder) sheds(p Priority) bool {
+	return p < Critical && int32(p) < atomic.LoadInt32(&s.level)
+}
+
+// record records the latency of a response.
+func (s *Shedder) record(latency time.Duration) {
+	s.mu.Lock()
+	if len(s.latencies) < maxLatencySamples {
+		s.latencies = append(s.latencies, latency)
+	} else {
+		s.latencies[s.next] = latency
+		s.next = (s.next + 1) % maxLatencySamples
+	}
+	s.mu.Unlock()
+}
+
+// measurements are the load of the server at some time.
+type measurements struct {
+	load       float64 // per CPU
+	goroutines int
+	p99        time.Duration
+}
+
+// measure returns the current load of the server, with
+// the latency of the responses since the last measurement.
+func (s *Shedder) measure() measurements {
+	var m measurements
+	if s.Load > 0 {
+		if load, err := loadAverage(); err == nil {
+			m.load = load / float64(runtime.NumCPU())
+		}
+	}
+	m.goroutines = runtime.NumGoroutine()
+
+	s.mu.Lock()
+	latencies := s.latencies
+	s.latencies, s.next = nil, 0
+	s.mu.Unlock()
+	if len(latencies) > 0 {
+		sort.Sort(durations(latencies))
+		m.p99 = latencies[(len(latencies)*99-1)/100]
+	}
+	return m
+}
+
+// overloaded returns what is overloaded according to m,
+// or the empty string if nothing is.
+func (s *Shedder) overloaded(m measurements) string {
+	switch {
+	case s.Load > 0 && m.load > s.Load:
+		return "load " + strconv.FormatFloat(m.load, 'f', 2, 64) + " per CPU"
+	case s.Goroutines > 0 && m.goroutines > s.Goroutines:
+		return strconv.Itoa(m.goroutines) + " goroutines"
+	case s.Latency > 0 && m.p99 > s.Latency:
+		return "p99 latency " + m.p99.String()
+	}
+	return ""
+}
+
+// adjust raises or lowers the shed level by one
+// depending on whether m shows an overload.
+func (s *Shedder) adjust(m measurements) {
+	level := atomic.LoadInt32(&s.level)
+	if reason := s.overloaded(m); reason != "" {
+		if level < int32(Critical) {
+			atomic.StoreInt32(&s.level, level+1)
+			log.Printf("[WARNING] Overloaded (%s); shedding requests below priority %d", reason, level+1)
+		}
+	} else if level > 0 {
+		atomic.StoreInt32(&s.level, level-1)
+		log.Printf("[INFO] Load decreased; shedding requests below priority %d", level-1)
+	}
+}
+
+// worker adjusts the shed level every s.Interval
+// until stop is closed.
+func (s *Shedder) worker(stop chan struct{}) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.adjust(s.measure())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// durations implements sort.Interface.
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+const (
+	defaultInterval = 1 * time.Second
+
+	// maxLatencySamples is the most latencies that
+	// are kept between measurements.
+	maxLatencySamples = 10000
+)
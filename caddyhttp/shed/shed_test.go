@@ -0,0 +1,95 @@
+package shed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestShed(t *testing.T) {
+	shedder := &Shedder{
+		Latency:  100 * time.Millisecond,
+		Interval: 2 * time.Second,
+		Classes: []PathClass{
+			{Path: "/search", Priority: Low},
+			{Path: "/checkout", Priority: High},
+			{Path: "/health", Priority: Critical},
+		},
+	}
+	s := Shed{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+		Shedder: shedder,
+	}
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		status, _ := s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if status == http.StatusServiceUnavailable && w.Header().Get("Retry-After") != "2" {
+			t.Errorf("Expected Retry-After of 2 seconds, got '%s'", w.Header().Get("Retry-After"))
+		}
+		return status
+	}
+	check := func(stage string, expected map[string]int) {
+		for path, status := range expected {
+			if actual := serve(path); actual != status {
+				t.Errorf("%s: Expected %s to get %d, got %d", stage, path, status, actual)
+			}
+		}
+	}
+
+	overloaded := measurements{p99: time.Second}
+	fine := measurements{p99: 10 * time.Millisecond}
+
+	check("Not overloaded", map[string]int{"/search": 200, "/": 200, "/checkout": 200, "/health": 200})
+
+	// each interval of overload sheds one more priority class
+	shedder.adjust(overloaded)
+	check("Overloaded once", map[string]int{"/search": 503, "/": 200, "/checkout": 200, "/health": 200})
+	shedder.adjust(overloaded)
+	check("Overloaded twice", map[string]int{"/search": 503, "/": 503, "/checkout": 200, "/health": 200})
+	shedder.adjust(overloaded)
+	shedder.adjust(overloaded)
+	check("Overloaded for long", map[string]int{"/search/x": 503, "/": 503, "/checkout": 503, "/health": 200})
+
+	// and each interval without one sheds one class less
+	shedder.adjust(fine)
+	check("Recovering", map[string]int{"/search": 503, "/": 503, "/checkout": 200, "/health": 200})
+	shedder.adjust(fine)
+	shedder.adjust(fine)
+	check("Recovered", map[string]int{"/search": 200, "/": 200, "/checkout": 200, "/health": 200})
+}
+
+func TestMeasureLatency(t *testing.T) {
+	shedder := &Shedder{Latency: time.Second}
+	for i := 1; i <= 200; i++ {
+		shedder.record(time.Duration(i) * time.Millisecond)
+	}
+	if m := shedder.measure(); m.p99 != 198*time.Millisecond {
+		t.Errorf("Expected p99 of 198ms, got %v", m.p99)
+	}
+	// latencies are only those since the last measurement
+	if m := shedder.measure(); m.p99 != 0 {
+		t.Errorf("Expected no latency without responses, got %v", m.p99)
+	}
+}
+
+func TestOverloaded(t *testing.T) {
+	shedder := &Shedder{Load: 0.8, Goroutines: 1000, Latency: time.Second}
+	for i, test := range []struct {
+		m          measurements
+		overloaded bool
+	}{
+		{measurements{load: 0.5, goroutines: 100, p99: 100 * time.Millisecond}, false},
+		{measurements{load: 0.9}, true},
+		{measurements{goroutines: 1001}, true},
+		{measurements{p99: 2 * time.Second}, true},
+	} {
+		if actual := shedder.overloaded(test.m) != ""; actual != test.overloaded {
+			t.Errorf("Test %d: Expected overloaded to be %v, got %v", i, test.overloaded, actual)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package sitemap
+
+import (
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("sitemap", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
+	})
+}
+
+// setup configures a new Sitemap middleware instance. Syntax:
+//
+//	sitemap [base_url] {
+//	    include     globs...
+//	    exclude     globs...
+//	    priority    glob priority [changefreq]
+//	    allow       agent paths...
+//	    disallow    agent paths...
+//	    crawl_delay agent seconds
+//	    refresh     duration
+//	}
+//
+// The sitemap lists the files that match an include glob
+// (*.html and *.htm by default) and no exclude glob, with the
+// priority and change frequency of the first rule that matches
+// them. Globs without a slash match file names, others paths.
+// The rules of robots.txt are grouped by agent (* for all) in
+// the order they are given. The file tree is walked again for
+// changes at most every refresh (1m by default). URLs are made
+// with the scheme and host of the request without base_url.
+func setup(c *caddy.Controller) error {
+	if err := httpserver.CheckStaticRoot(c); err != nil {
+		return err
+	}
+	s, err := sitemapParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	s.Root = cfg.FileSystem()
+	s.Hide = cfg.HiddenFiles
+	s.cache = new(cache)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		s.Next = next
+		return s
+	})
+	return nil
+}
+
+func sitemapParse(c *caddy.Controller) (Sitemap, error) {
+	s := Sitemap{Refresh: defaultRefresh}
+	var seen bool
+	for c.Next() {
+		if seen {
+			return s, c.Err("sitemap: can only be specified once per site")
+		}
+		seen = true
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			u, err := url.Parse(args[0])
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return s, c.Errf("sitemap: invalid base URL '%s'", args[0])
+			}
+			s.BaseURL = strings.TrimSuffix(args[0], "/")
+		default:
+			return s, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "include", "exclude":
+				if len(args) == 0 {
+					return s, c.ArgErr()
+				}
+				if g := badGlob(args); g != "" {
+					return s, c.Errf("sitemap: invalid glob '%s'", g)
+				}
+				if what == "include" {
+					s.Include = append(s.Include, args...)
+				} else {
+					s.Exclude = append(s.Exclude, args...)
+				}
+			case "priority":
+				if len(args) < 2 || len(args) > 3 {
+					return s, c.ArgErr()
+				}
+				if badGlob(args[:1]) != "" {
+					return s, c.Errf("sitemap: invalid glob '%s'", args[0])
+				}
+				p := Priority{Glob: args[0]}
+				prio, err := strconv.ParseFloat(args[1], 64)
+				if err != nil || prio < 0 || prio > 1 {
+					return s, c.Errf("sitemap: invalid priority '%s'", args[1])
+				}
+				p.Priority = prio
+				if len(args) == 3 {
+					if !changeFreqs[args[2]] {
+						return s, c.Errf("sitemap: invalid change frequency '%s'", args[2])
+					}
+					p.ChangeFreq = args[2]
+				}
+				s.Priorities = append(s.Priorities, p)
+			case "allow", "disallow":
+				if len(args) < 2 {
+					return s, c.ArgErr()
+				}
+				a := s.agent(args[0])
+				for _, p := range args[1:] {
+					if !strings.HasPrefix(p, "/") {
+						return s, c.Errf("sitemap: invalid path '%s'", p)
+					}
+				}
+				if what == "allow" {
+					a.Allow = append(a.Allow, args[1:]...)
+				} else {
+					a.Disallow = append(a.Disallow, args[1:]...)
+				}
+			case "crawl_delay":
+				if len(args) != 2 {
+					return s, c.ArgErr()
+				}
+				delay, err := strconv.Atoi(args[1])
+				if err != nil || delay < 1 {
+					return s, c.Errf("sitemap: invalid crawl delay '%s'", args[1])
+				}
+				s.agent(args[0]).CrawlDelay = delay
+			case "refresh":
+				if len(args) != 1 {
+					return s, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d < 0 {
+					return s, c.Errf("sitemap: invalid refresh '%s'", args[0])
+				}
+				s.Refresh = d
+			default:
+				return s, c.Errf("sitemap: unknown property '%s'", what)
+			}
+		}
+	}
+	return s, nil
+}
+
+// agent returns the group of rules of the agent name,
+// adding it if there is none yet.
+func (s *Sitemap) agent(name string) *Agent {
+	for _, a := range s.Agents {
+		if a.Name == name {
+			return a
+		}
+	}
+	a := &Agent{Name: name}
+	s.Agents = append(s.Agents, a)
+	return a
+}
+
+// badGlob returns the first of globs that is malformed, if any.
+func badGlob(globs []string) string {
+	for _, g := range globs {
+		if _, err := path.Match(g, ""); err != nil {
+			return g
+		}
+	}
+	return ""
+}
+
+// changeFreqs are the change frequencies of the sitemap protocol.
+var changeFreqs = map[string]bool{
+	"always":  true,
+	"hourly":  true,
+	"daily":   true,
+	"weekly":  true,
+	"monthly": true,
+	"yearly":  true,
+	"never":   true,
+}
+
+const defaultRefresh = time.Minute
@@ -0,0 +1,70 @@
+package sitemap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", "sitemap https://example.com/ {\n exclude /drafts/*\n priority /index.html 1.0 daily\n disallow * /admin\n crawl_delay * 5\n allow Bot /blog\n refresh 5m\n}")
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) != 1 {
+		t.Fatalf("Expected 1 middleware, had %d instead", len(mids))
+	}
+	s, ok := mids[0](httpserver.EmptyNext).(Sitemap)
+	if !ok {
+		t.Fatalf("Expected handler to be type Sitemap, got: %#v", mids[0](httpserver.EmptyNext))
+	}
+	if s.BaseURL != "https://example.com" {
+		t.Errorf("Expected base URL https://example.com, got %s", s.BaseURL)
+	}
+	if s.Refresh != 5*time.Minute {
+		t.Errorf("Expected refresh 5m, got %v", s.Refresh)
+	}
+	if len(s.Agents) != 2 || s.Agents[0].Name != "*" || s.Agents[0].CrawlDelay != 5 ||
+		len(s.Agents[0].Disallow) != 1 || s.Agents[1].Name != "Bot" {
+		t.Errorf("Expected agents * and Bot, got %+v", s.Agents)
+	}
+	if len(s.Priorities) != 1 || s.Priorities[0].Priority != 1 || s.Priorities[0].ChangeFreq != "daily" {
+		t.Errorf("Expected priority of /index.html, got %+v", s.Priorities)
+	}
+}
+
+func TestSitemapParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+	}{
+		{"sitemap", false},
+		{"sitemap http://example.com", false},
+		{"sitemap {\n include *.html *.md\n exclude /private/*\n}", false},
+		{"sitemap {\n priority *.html 0.5\n}", false},
+		{"sitemap example.com", true},
+		{"sitemap http://example.com http://example.org", true},
+		{"sitemap\nsitemap", true},
+		{"sitemap {\n include\n}", true},
+		{"sitemap {\n exclude [\n}", true},
+		{"sitemap {\n priority *.html\n}", true},
+		{"sitemap {\n priority *.html 1.5\n}", true},
+		{"sitemap {\n priority *.html 0.5 sometimes\n}", true},
+		{"sitemap {\n disallow *\n}", true},
+		{"sitemap {\n disallow * admin\n}", true},
+		{"sitemap {\n crawl_delay * 0\n}", true},
+		{"sitemap {\n refresh soon\n}", true},
+		{"sitemap {\n lastmod now\n}", true},
+	} {
+		_, err := sitemapParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error, got none", i)
+		}
+		if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+	}
+}
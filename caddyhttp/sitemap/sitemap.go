@@ -0,0 +1,278 @@
+// Package sitemap provides middleware that serves a sitemap.xml
+// generated from the files of a site and a robots.txt made from
+// rules per user agent, both kept up to date as files change.
+package sitemap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Sitemap is middleware that serves /sitemap.xml, listing the
+// files of the site that are included and not excluded, and
+// /robots.txt, which points to it.
+type Sitemap struct {
+	Next httpserver.Handler
+	Root http.FileSystem
+	Hide []string
+
+	// BaseURL is the scheme and host of the URLs in the
+	// sitemap; that of each request if empty
+	BaseURL string
+
+	// Include and Exclude are globs of the paths of files;
+	// those without a slash match the file name only
+	Include []string
+	Exclude []string
+
+	// Priorities set the priority and change frequency of
+	// URLs by the first rule whose glob matches
+	Priorities []Priority
+
+	// Agents are the rules of robots.txt, in order
+	Agents []*Agent
+
+	// Refresh is how long the file tree is kept before
+	// it is walked again to find changes
+	Refresh time.Duration
+
+	cache *cache
+}
+
+// Priority is a rule for the sitemap entries of files.
+type Priority struct {
+	Glob       string
+	Priority   float64
+	ChangeFreq string
+}
+
+// Agent is the group of robots.txt rules of a user agent.
+type Agent struct {
+	Name       string
+	Allow      []string
+	Disallow   []string
+	CrawlDelay int
+}
+
+// cache is the file tree of the site as walked last.
+type cache struct {
+	sync.Mutex
+	files   []file
+	expires time.Time
+}
+
+// file is a page of the site.
+type file struct {
+	path    string
+	modTime time.Time
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (s Sitemap) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return s.Next.ServeHTTP(w, r)
+	}
+	switch r.URL.Path {
+	case sitemapPath:
+		files, err := s.files()
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		body, err := s.sitemap(s.baseURL(r), files)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+		return 0, nil
+	case robotsPath:
+		body := s.robots(s.baseURL(r))
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+		return 0, nil
+	}
+	return s.Next.ServeHTTP(w, r)
+}
+
+func (s Sitemap) baseURL(r *http.Request) string {
+	if s.BaseURL != "" {
+		return s.BaseURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// files returns the pages of the site, walking the file tree
+// again if the one walked last is older than s.Refresh.
+func (s Sitemap) files() ([]file, error) {
+	s.cache.Lock()
+	defer s.cache.Unlock()
+	if s.cache.files != nil && time.Now().Before(s.cache.expires) {
+		return s.cache.files, nil
+	}
+	files := []file{}
+	if err := s.walk("/", &files); err != nil {
+		return nil, err
+	}
+	sort.Sort(byPath(files))
+	s.cache.files = files
+	s.cache.expires = time.Now().Add(s.Refresh)
+	return files, nil
+}
+
+type byPath []file
+
+func (l byPath) Len() int           { return len(l) }
+func (l byPath) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l byPath) Less(i, j int) bool { return l[i].path < l[j].path }
+
+func (s Sitemap) walk(dir string, files *[]file) error {
+	d, err := s.Root.Open(dir)
+	if err != nil {
+		return err
+	}
+	infos, err := d.Readdir(-1)
+	d.Close()
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		name := path.Join(dir, info.Name())
+		if strings.HasPrefix(info.Name(), ".") || s.hidden(name) {
+			continue
+		}
+		if info.IsDir() {
+			if err := s.walk(name, files); err != nil {
+				return err
+			}
+			continue
+		}
+		if s.included(name) {
+			*files = append(*files, file{path: name, modTime: info.ModTime()})
+		}
+	}
+	return nil
+}
+
+func (s Sitemap) hidden(name string) bool {
+	for _, h := range s.Hide {
+		if strings.TrimPrefix(h, "/") == strings.TrimPrefix(name, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Sitemap) included(name string) bool {
+	include := s.Include
+	if len(include) == 0 {
+		include = defaultInclude
+	}
+	return matchGlobs(include, name) && !matchGlobs(s.Exclude, name)
+}
+
+// matchGlobs returns whether name matches one of globs; globs
+// without a slash match the file name only.
+func matchGlobs(globs []string, name string) bool {
+	for _, g := range globs {
+		target := name
+		if !strings.Contains(g, "/") {
+			target = path.Base(name)
+		}
+		if ok, _ := path.Match(g, target); ok {
+			return true
+		}
+		// a trailing /* matches everything below
+		if strings.HasSuffix(g, "/*") && httpserver.Path(name).Matches(strings.TrimSuffix(g, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+type urlset struct {
+	XMLName xml.Name `xml:"urlset"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	URLs    []entry  `xml:"url"`
+}
+
+type entry struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+// sitemap renders the sitemap of files.
+func (s Sitemap) sitemap(baseURL string, files []file) ([]byte, error) {
+	set := urlset{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for _, f := range files {
+		loc := f.path
+		if base := path.Base(loc); base == "index.html" || base == "index.htm" {
+			loc = strings.TrimSuffix(loc, base)
+		}
+		u := entry{Loc: baseURL + loc, LastMod: f.modTime.UTC().Format(time.RFC3339)}
+		for _, p := range s.Priorities {
+			if matchGlobs([]string{p.Glob}, f.path) {
+				u.Priority = strconv.FormatFloat(p.Priority, 'f', 1, 64)
+				u.ChangeFreq = p.ChangeFreq
+				break
+			}
+		}
+		set.URLs = append(set.URLs, u)
+	}
+	body, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(body, '\n')...), nil
+}
+
+// robots renders the robots.txt of the site.
+func (s Sitemap) robots(baseURL string) []byte {
+	var buf bytes.Buffer
+	agents := s.Agents
+	if len(agents) == 0 {
+		agents = []*Agent{{Name: "*"}}
+	}
+	for _, a := range agents {
+		fmt.Fprintf(&buf, "User-agent: %s\n", a.Name)
+		for _, p := range a.Allow {
+			fmt.Fprintf(&buf, "Allow: %s\n", p)
+		}
+		for _, p := range a.Disallow {
+			fmt.Fprintf(&buf, "Disallow: %s\n", p)
+		}
+		if len(a.Allow) == 0 && len(a.Disallow) == 0 {
+			buf.WriteString("Disallow:\n")
+		}
+		if a.CrawlDelay > 0 {
+			fmt.Fprintf(&buf, "Crawl-delay: %d\n", a.CrawlDelay)
+		}
+		buf.WriteString("\n")
+	}
+	fmt.Fprintf(&buf, "Sitemap: %s%s\n", baseURL, sitemapPath)
+	return buf.Bytes()
+}
+
+const (
+	sitemapPath = "/sitemap.xml"
+	robotsPath  = "/robots.txt"
+)
+
+var defaultInclude = []string{"*.html", "*.htm"}
@@ -0,0 +1,99 @@
+package sitemap
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSitemap(t *testing.T) {
+	root, err := ioutil.TempDir("", "sitemap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{"index.html", "about.html", "blog/index.html", "blog/post.html",
+		"drafts/wip.html", "style.css", ".hidden.html", "secret.html"} {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := Sitemap{
+		Next:       httpserver.EmptyNext,
+		Root:       http.Dir(root),
+		Hide:       []string{"/secret.html"},
+		Exclude:    []string{"/drafts/*"},
+		Priorities: []Priority{{"/index.html", 1, "daily"}, {"/blog/*", 0.8, "weekly"}},
+		Refresh:    time.Hour,
+		cache:      new(cache),
+	}
+
+	body := get(t, s, "/sitemap.xml")
+	for _, loc := range []string{"http://example.com/", "http://example.com/about.html",
+		"http://example.com/blog/", "http://example.com/blog/post.html"} {
+		if !strings.Contains(body, "<loc>"+loc+"</loc>") {
+			t.Errorf("Expected sitemap to have %s, got:\n%s", loc, body)
+		}
+	}
+	for _, name := range []string{"wip.html", "style.css", "hidden", "secret"} {
+		if strings.Contains(body, name) {
+			t.Errorf("Expected sitemap not to have %s, got:\n%s", name, body)
+		}
+	}
+	if !strings.Contains(body, "<loc>http://example.com/blog/post.html</loc>") ||
+		!strings.Contains(body, "<changefreq>weekly</changefreq>\n    <priority>0.8</priority>") {
+		t.Errorf("Expected priority of blog posts, got:\n%s", body)
+	}
+
+	// changes show after the refresh interval
+	ioutil.WriteFile(filepath.Join(root, "new.html"), []byte("x"), 0644)
+	if body := get(t, s, "/sitemap.xml"); strings.Contains(body, "new.html") {
+		t.Error("Expected sitemap to be cached")
+	}
+	s.cache.expires = time.Now()
+	if body := get(t, s, "/sitemap.xml"); !strings.Contains(body, "new.html") {
+		t.Errorf("Expected sitemap to have new.html, got:\n%s", body)
+	}
+}
+
+func TestRobots(t *testing.T) {
+	s := Sitemap{Next: httpserver.EmptyNext, BaseURL: "https://example.com", cache: new(cache)}
+	expected := "User-agent: *\nDisallow:\n\nSitemap: https://example.com/sitemap.xml\n"
+	if body := get(t, s, "/robots.txt"); body != expected {
+		t.Errorf("Expected robots.txt:\n%s\ngot:\n%s", expected, body)
+	}
+
+	s.Agents = []*Agent{
+		{Name: "*", Disallow: []string{"/admin", "/tmp"}},
+		{Name: "BadBot", Disallow: []string{"/"}},
+		{Name: "Slurp", Allow: []string{"/blog"}, Disallow: []string{"/"}, CrawlDelay: 10},
+	}
+	expected = "User-agent: *\nDisallow: /admin\nDisallow: /tmp\n\n" +
+		"User-agent: BadBot\nDisallow: /\n\n" +
+		"User-agent: Slurp\nAllow: /blog\nDisallow: /\nCrawl-delay: 10\n\n" +
+		"Sitemap: https://example.com/sitemap.xml\n"
+	if body := get(t, s, "/robots.txt"); body != expected {
+		t.Errorf("Expected robots.txt:\n%s\ngot:\n%s", expected, body)
+	}
+}
+
+func get(t *testing.T, s Sitemap, target string) string {
+	r := httptest.NewRequest("GET", "http://example.com"+target, nil)
+	w := httptest.NewRecorder()
+	if _, err := s.ServeHTTP(w, r); err != nil {
+		t.Fatalf("Expected no error serving %s, got: %v", target, err)
+	}
+	return w.Body.String()
+}
@@ -0,0 +1,126 @@
+package soap
+
+import (
+	"path/filepath"
+	"text/template"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("soap", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
+	})
+}
+
+// setup configures a new SOAP middleware instance.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+	rules, err := soapParse(c, cfg.Root)
+	if err != nil {
+		return err
+	}
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return SOAP{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// soapParse parses soap directives of the form
+//
+//	soap path {
+//	    envelope template_file
+//	    action   soap_action
+//	    version  1.1|1.2
+//	    field    name xpath
+//	    list     name xpath
+//	}
+//
+// The envelope template, relative to the site root, is a Go text
+// template executed with the JSON object of the request, whose
+// strings are escaped for XML; requests without the fields it
+// uses are refused. Each field of the JSON response is the first
+// value the XPath expression selects, or null, and each list all
+// of them. The version defaults to 1.1.
+func soapParse(c *caddy.Controller, root string) ([]*Rule, error) {
+	var rules []*Rule
+
+	for c.Next() {
+		rule := &Rule{Version: "1.1"}
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return rules, c.ArgErr()
+		}
+		rule.Path = args[0]
+
+		names := make(map[string]bool)
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "envelope":
+				if len(args) != 1 {
+					return rules, c.ArgErr()
+				}
+				file := args[0]
+				if !filepath.IsAbs(file) {
+					if err := httpserver.CheckStaticRoot(c); err != nil {
+						return rules, err
+					}
+					file = filepath.Join(root, file)
+				}
+				tpl, err := template.ParseFiles(file)
+				if err != nil {
+					return rules, c.Errf("soap: envelope: %v", err)
+				}
+				// requests without the fields used are refused
+				rule.Envelope = tpl.Option("missingkey=error")
+			case "action":
+				if len(args) != 1 {
+					return rules, c.ArgErr()
+				}
+				rule.Action = args[0]
+			case "version":
+				if len(args) != 1 {
+					return rules, c.ArgErr()
+				}
+				if args[0] != "1.1" && args[0] != "1.2" {
+					return rules, c.Errf("soap: invalid version '%s'", args[0])
+				}
+				rule.Version = args[0]
+			case "field", "list":
+				if len(args) != 2 {
+					return rules, c.ArgErr()
+				}
+				if names[args[0]] {
+					return rules, c.Errf("soap: duplicate field '%s'", args[0])
+				}
+				names[args[0]] = true
+				path, err := ParsePath(args[1])
+				if err != nil {
+					return rules, c.Errf("soap: %v", err)
+				}
+				rule.Fields = append(rule.Fields, Field{Name: args[0], Path: path, List: what == "list"})
+			default:
+				return rules, c.Errf("soap: unknown property '%s'", what)
+			}
+		}
+		if rule.Envelope == nil {
+			return rules, c.Err("soap: envelope is required")
+		}
+
+		for _, existing := range rules {
+			if existing.Path == rule.Path {
+				return rules, c.Errf("soap: duplicate path '%s'", rule.Path)
+			}
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,83 @@
+package soap
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `soap /users {
+		envelope envelope.xml
+		field name //Name
+	}`)
+	httpserver.GetConfig(c).Root = "testdata"
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) != 1 {
+		t.Fatalf("Expected 1 middleware, got %d", len(mids))
+	}
+	handler, ok := mids[0](httpserver.EmptyNext).(SOAP)
+	if !ok {
+		t.Fatalf("Expected handler to be type SOAP, got: %#v", handler)
+	}
+	if !httpserver.SameNext(handler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestSOAPParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		path      string
+		version   string
+		action    string
+		fields    []string
+	}{
+		{`soap /users {
+			envelope envelope.xml
+			action   urn:GetUser
+			version  1.2
+			field    name //Name
+			list     tags //Tag
+		}`, false, "/users", "1.2", "urn:GetUser", []string{"name", "tags"}},
+		{"soap /users {\n envelope envelope.xml\n}", false, "/users", "1.1", "", nil},
+		{`soap`, true, "", "", "", nil},
+		{`soap /a /b`, true, "", "", "", nil},
+		{"soap /users {\n action x\n}", true, "", "", "", nil},
+		{"soap /users {\n envelope missing.xml\n}", true, "", "", "", nil},
+		{"soap /users {\n envelope envelope.xml\n version 2\n}", true, "", "", "", nil},
+		{"soap /users {\n envelope envelope.xml\n field name\n}", true, "", "", "", nil},
+		{"soap /users {\n envelope envelope.xml\n field name /a[0]\n}", true, "", "", "", nil},
+		{"soap /users {\n envelope envelope.xml\n field a //A\n list a //B\n}", true, "", "", "", nil},
+		{"soap /users {\n envelope envelope.xml\n method GET\n}", true, "", "", "", nil},
+		{"soap /a {\n envelope envelope.xml\n}\nsoap /a {\n envelope envelope.xml\n}", true, "", "", "", nil},
+	} {
+		rules, err := soapParse(caddy.NewTestController("http", test.input), "testdata")
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		rule := rules[0]
+		if rule.Path != test.path || rule.Version != test.version || rule.Action != test.action {
+			t.Errorf("Test %d: Unexpected rule %+v", i, rule)
+		}
+		var fields []string
+		for _, f := range rule.Fields {
+			fields = append(fields, f.Name)
+		}
+		if len(fields) != len(test.fields) || (len(fields) == 2 && (fields[0] != "name" || !rule.Fields[1].List)) {
+			t.Errorf("Test %d: Expected fields %v, got %v", i, test.fields, fields)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Package soap provides middleware that exposes SOAP services
+// as JSON APIs: JSON requests are turned into SOAP envelopes
+// from a template, and the XML responses are turned into JSON
+// objects by mapping XPath expressions to fields.
+package soap
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/internal/xmltree"
+)
+
+// SOAP is middleware that bridges JSON requests to
+// SOAP services, for requests matching a rule.
+type SOAP struct {
+	Next  httpserver.Handler
+	Rules []*Rule
+}
+
+// Rule bridges requests to a base path.
+type Rule struct {
+	Path string
+
+	// Envelope is executed with the JSON object of the request,
+	// whose strings are escaped for XML, to make its body
+	Envelope *template.Template
+
+	// Action is the SOAP action of the requests
+	Action string
+
+	// Version is the SOAP version, 1.1 or 1.2
+	Version string
+
+	// Fields map fields of the JSON response to what
+	// XPath expressions select in the XML response
+	Fields []Field
+}
+
+// Field is a field of the JSON response.
+type Field struct {
+	Name string
+	Path Path
+
+	// List is whether the field is a list of all that
+	// Path selects, rather than the first
+	List bool
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (s SOAP) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var rule *Rule
+	for _, candidate := range s.Rules {
+		if !httpserver.Path(r.URL.Path).Matches(candidate.Path) {
+			continue
+		}
+		if rule == nil || len(candidate.Path) > len(rule.Path) {
+			rule = candidate
+		}
+	}
+	if rule == nil {
+		return s.Next.ServeHTTP(w, r)
+	}
+
+	data := make(map[string]interface{})
+	if r.Body != nil {
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		if len(body) > maxBodySize {
+			return http.StatusRequestEntityTooLarge, nil
+		}
+		if len(bytes.TrimSpace(body)) > 0 {
+			dec := json.NewDecoder(bytes.NewReader(body))
+			dec.UseNumber()
+			if err := dec.Decode(&data); err != nil {
+				return httpserver.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "request body is not a JSON object"})
+			}
+		}
+	}
+	var envelope bytes.Buffer
+	if err := rule.Envelope.Execute(&envelope, escapeStrings(data)); err != nil {
+		return httpserver.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "request does not fit the envelope: " + err.Error()})
+	}
+
+	r.Method = http.MethodPost
+	r.Body = ioutil.NopCloser(&envelope)
+	r.ContentLength = int64(envelope.Len())
+	r.Header.Del("Content-Length")
+	if rule.Version == "1.2" {
+		r.Header.Set("Content-Type", `application/soap+xml; charset=utf-8; action="`+rule.Action+`"`)
+	} else {
+		r.Header.Set("Content-Type", "text/xml; charset=utf-8")
+		r.Header.Set("SOAPAction", `"`+rule.Action+`"`)
+	}
+	r.Header.Set("Accept", "application/soap+xml, text/xml")
+	r.Header.Del("Accept-Encoding") // encoded responses cannot be converted
+
+	bw := &bufferWriter{ResponseWriter: w, header: make(http.Header), status: http.StatusOK}
+	status, err := s.Next.ServeHTTP(bw, r)
+	if status >= 400 {
+		return status, err
+	}
+	if !isXML(bw.header.Get("Content-Type")) {
+		return httpserver.WriteJSONResponse(w, http.StatusBadGateway, map[string]string{"error": "upstream did not respond with XML"})
+	}
+	doc, parseErr := xmltree.Parse(&bw.buf)
+	if parseErr != nil {
+		return httpserver.WriteJSONResponse(w, http.StatusBadGateway, map[string]string{"error": "invalid XML response: " + parseErr.Error()})
+	}
+
+	if fault := fault(doc); fault != "" {
+		code := http.StatusBadGateway
+		if bw.status >= 400 && bw.status < 500 {
+			code = bw.status
+		}
+		return httpserver.WriteJSONResponse(w, code, map[string]string{"error": fault})
+	}
+	result := make(map[string]interface{}, len(rule.Fields))
+	for _, f := range rule.Fields {
+		values := f.Path.Select(doc)
+		switch {
+		case f.List:
+			if values == nil {
+				values = []string{}
+			}
+			result[f.Name] = values
+		case len(values) > 0:
+			result[f.Name] = values[0]
+		default:
+			result[f.Name] = nil
+		}
+	}
+	return httpserver.WriteJSONResponse(w, bw.status, result)
+}
+
+// fault returns the message of the SOAP fault in doc, if any.
+func fault(doc *xmltree.Node) string {
+	if len(faultPath.Select(doc)) == 0 {
+		return ""
+	}
+	// SOAP 1.1 has faultstring; SOAP 1.2 has Reason/Text
+	for _, p := range []Path{faultStringPath, faultReasonPath} {
+		if msg := p.Select(doc); len(msg) > 0 && msg[0] != "" {
+			return msg[0]
+		}
+	}
+	return "SOAP fault"
+}
+
+var (
+	faultPath, _       = ParsePath("/Envelope/Body/Fault")
+	faultStringPath, _ = ParsePath("/Envelope/Body/Fault/faultstring")
+	faultReasonPath, _ = ParsePath("/Envelope/Body/Fault/Reason/Text")
+)
+
+// escapeStrings returns v with the strings in it
+// escaped for XML, so templates can insert them.
+func escapeStrings(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(v))
+		return buf.String()
+	case map[string]interface{}:
+		escaped := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			escaped[key] = escapeStrings(value)
+		}
+		return escaped
+	case []interface{}:
+		escaped := make([]interface{}, len(v))
+		for i, value := range v {
+			escaped[i] = escapeStrings(value)
+		}
+		return escaped
+	}
+	return v
+}
+
+// isXML returns whether contentType is that of XML.
+func isXML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/xml" || mediaType == "application/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+// bufferWriter buffers a response, with its own header,
+// so it can be converted. It cannot be hijacked.
+type bufferWriter struct {
+	http.ResponseWriter
+	header      http.Header
+	buf         bytes.Buffer
+	status      int
+	wroteHeader bool
+}
+
+func (w *bufferWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.status = status
+	}
+}
+
+func (w *bufferWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.buf.Len()+len(p) > maxBodySize {
+		return 0, errResponseTooLarge
+	}
+	return w.buf.Write(p)
+}
+
+// Flush implements http.Flusher; buffered
+// responses are only written when complete.
+func (w *bufferWriter) Flush() {}
+
+// CloseNotify implements http.CloseNotifier.
+// It just inherits the underlying ResponseWriter's CloseNotify method.
+// It panics if the underlying ResponseWriter is not a CloseNotifier.
+func (w *bufferWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	panic(httpserver.NonCloseNotifierError{Underlying: w.ResponseWriter})
+}
+
+var errResponseTooLarge = errors.New("response too large to convert")
+
+// maxBodySize limits the size of requests and responses.
+const maxBodySize = 4 << 20
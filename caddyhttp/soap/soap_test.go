@@ -0,0 +1,106 @@
+package soap
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSOAP(t *testing.T) {
+	envelope := template.Must(template.New("envelope").Option("missingkey=error").Parse(
+		`<Envelope><Body><GetUser><Id>{{.id}}</Id><Name>{{.user.name}}</Name></GetUser></Body></Envelope>`))
+	mustPath := func(expr string) Path {
+		p, err := ParsePath(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	rule := &Rule{
+		Path:     "/users",
+		Envelope: envelope,
+		Action:   "urn:GetUser",
+		Version:  "1.1",
+		Fields: []Field{
+			{Name: "name", Path: mustPath("//User/Name")},
+			{Name: "email", Path: mustPath("//User/Email")},
+			{Name: "tags", Path: mustPath("//User/Tag"), List: true},
+		},
+	}
+
+	for i, test := range []struct {
+		body           string
+		upstreamType   string
+		upstreamStatus int
+		upstreamBody   string
+		expectEnvelope string
+		expectStatus   int
+		expectBody     string
+	}{
+		{
+			`{"id": 42, "user": {"name": "<b>&"}}`,
+			"text/xml; charset=utf-8", http.StatusOK,
+			`<Envelope><Body><User><Name>Ann</Name><Tag>a</Tag><Tag>b</Tag></User></Body></Envelope>`,
+			`<Envelope><Body><GetUser><Id>42</Id><Name>&lt;b&gt;&amp;</Name></GetUser></Body></Envelope>`,
+			http.StatusOK, `{"email":null,"name":"Ann","tags":["a","b"]}`,
+		},
+		{
+			`{"id": 1, "user": {"name": "x"}}`,
+			"text/xml", http.StatusInternalServerError,
+			`<Envelope><Body><Fault><faultcode>Server</faultcode><faultstring>no such user</faultstring></Fault></Body></Envelope>`,
+			"", http.StatusBadGateway, `{"error":"no such user"}`,
+		},
+		{
+			`{"id": 1, "user": {"name": "x"}}`,
+			"application/soap+xml", http.StatusOK,
+			`<Envelope><Body><Result/></Body></Envelope>`,
+			"", http.StatusOK, `{"email":null,"name":null,"tags":[]}`,
+		},
+		{
+			`{"id": 1, "user": {"name": "x"}}`,
+			"text/html", http.StatusOK, `<p>maintenance</p>`,
+			"", http.StatusBadGateway, `{"error":"upstream did not respond with XML"}`,
+		},
+		{
+			`{"id": 1, "user": {"name": "x"}}`,
+			"text/xml", http.StatusOK, `<Envelope>`,
+			"", http.StatusBadGateway, `invalid XML response`,
+		},
+		{`{"id": 1}`, "", 0, "", "", http.StatusBadRequest, `request does not fit the envelope`},
+		{`[1]`, "", 0, "", "", http.StatusBadRequest, `request body is not a JSON object`},
+	} {
+		var gotEnvelope string
+		next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			body, _ := ioutil.ReadAll(r.Body)
+			gotEnvelope = string(body)
+			if r.Method != http.MethodPost {
+				t.Errorf("Test %d: Expected POST to upstream, got %s", i, r.Method)
+			}
+			if got := r.Header.Get("SOAPAction"); got != `"urn:GetUser"` {
+				t.Errorf("Test %d: Expected SOAPAction header, got '%s'", i, got)
+			}
+			w.Header().Set("Content-Type", test.upstreamType)
+			w.WriteHeader(test.upstreamStatus)
+			w.Write([]byte(test.upstreamBody))
+			return 0, nil
+		})
+		s := SOAP{Next: next, Rules: []*Rule{rule}}
+		w := httptest.NewRecorder()
+
+		s.ServeHTTP(w, httptest.NewRequest("PUT", "/users/42", strings.NewReader(test.body)))
+		if test.expectEnvelope != "" && gotEnvelope != test.expectEnvelope {
+			t.Errorf("Test %d: Expected envelope '%s', got '%s'", i, test.expectEnvelope, gotEnvelope)
+		}
+		if w.Code != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), test.expectBody) {
+			t.Errorf("Test %d: Expected body containing '%s', got '%s'", i, test.expectBody, w.Body.String())
+		}
+	}
+}
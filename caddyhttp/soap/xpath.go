@@ -0,0 +1,176 @@
+package soap
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/internal/xmltree"
+)
+
+// value returns the text of e and its descendants, trimmed.
+func value(e *xmltree.Node) string {
+	var b bytes.Buffer
+	writeText(&b, e)
+	return strings.TrimSpace(b.String())
+}
+
+func writeText(b *bytes.Buffer, e *xmltree.Node) {
+	for _, c := range e.Content {
+		switch c := c.(type) {
+		case string:
+			b.WriteString(c)
+		case *xmltree.Node:
+			writeText(b, c)
+		}
+	}
+}
+
+// Path is a parsed XPath expression of the supported subset:
+// steps separated by / or, for any depth, //, which are element
+// names, * or, last, @attribute or text(), with an optional
+// 1-based position, as in /Envelope/Body//User[1]/@id. Names
+// match local names, whatever their namespace prefix.
+type Path struct {
+	expr  string
+	steps []step
+}
+
+type step struct {
+	descendant bool   // preceded by //
+	name       string // element name, *, @attribute or text()
+	position   int    // 1-based; 0 for all
+}
+
+// ParsePath parses expr into a Path.
+func ParsePath(expr string) (Path, error) {
+	p := Path{expr: expr}
+	rest := expr
+	if !strings.HasPrefix(rest, "/") {
+		rest = "//" + rest // relative paths match anywhere
+	}
+	for rest != "" {
+		var s step
+		switch {
+		case strings.HasPrefix(rest, "//"):
+			s.descendant = true
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "/"):
+			rest = rest[1:]
+		default:
+			return p, fmt.Errorf("invalid path %s", expr)
+		}
+		end := strings.Index(rest, "/")
+		if end < 0 {
+			end = len(rest)
+		}
+		s.name, rest = rest[:end], rest[end:]
+
+		if i := strings.Index(s.name, "["); i >= 0 {
+			if !strings.HasSuffix(s.name, "]") {
+				return p, fmt.Errorf("invalid path %s", expr)
+			}
+			n, err := strconv.Atoi(s.name[i+1 : len(s.name)-1])
+			if err != nil || n < 1 {
+				return p, fmt.Errorf("invalid position in path %s", expr)
+			}
+			s.name, s.position = s.name[:i], n
+		}
+		if i := strings.Index(s.name, ":"); i >= 0 && !strings.HasPrefix(s.name, "@") {
+			s.name = s.name[i+1:] // prefixes are ignored
+		}
+		if s.name == "" {
+			return p, fmt.Errorf("invalid path %s", expr)
+		}
+		if (strings.HasPrefix(s.name, "@") || s.name == "text()") && (rest != "" || s.position != 0) {
+			return p, fmt.Errorf("%s must be the last step of path %s", s.name, expr)
+		}
+		p.steps = append(p.steps, s)
+	}
+	return p, nil
+}
+
+// String returns the expression p was parsed from.
+func (p Path) String() string {
+	return p.expr
+}
+
+// Select returns the values of what p matches in the
+// document whose root element is root, in document order.
+func (p Path) Select(root *xmltree.Node) []string {
+	nodes := []*xmltree.Node{{Content: []interface{}{root}}}
+	for i, s := range p.steps {
+		last := i == len(p.steps)-1
+		if last && (strings.HasPrefix(s.name, "@") || s.name == "text()") {
+			return s.values(nodes)
+		}
+		var next []*xmltree.Node
+		for _, n := range nodes {
+			var matched []*xmltree.Node
+			if s.descendant {
+				descendants(n, s.name, &matched)
+			} else {
+				for _, child := range n.Elements() {
+					if s.name == "*" || child.Local == s.name {
+						matched = append(matched, child)
+					}
+				}
+			}
+			if s.position > 0 {
+				if s.position > len(matched) {
+					continue
+				}
+				matched = matched[s.position-1 : s.position]
+			}
+			next = append(next, matched...)
+		}
+		nodes = next
+	}
+
+	var values []string
+	for _, n := range nodes {
+		values = append(values, value(n))
+	}
+	return values
+}
+
+// values returns the attribute or own text, named by
+// the step's name, of each of nodes that has it.
+func (s step) values(nodes []*xmltree.Node) []string {
+	var values []string
+	for _, n := range nodes {
+		var candidates []*xmltree.Node
+		if s.descendant {
+			descendants(n, "*", &candidates)
+		} else {
+			candidates = []*xmltree.Node{n}
+		}
+		for _, c := range candidates {
+			if s.name == "text()" {
+				if text := c.Text(); text != "" {
+					values = append(values, text)
+				}
+				continue
+			}
+			for _, a := range c.Attrs {
+				if a.Name.Local == s.name[1:] {
+					values = append(values, a.Value)
+					break
+				}
+			}
+		}
+	}
+	return values
+}
+
+// descendants adds the descendants of e named name,
+// or all of them for *, to matched.
+func descendants(e *xmltree.Node, name string, matched *[]*xmltree.Node) {
+	for _, child := range e.Elements() {
+		if name == "*" || child.Local == name {
+			*matched = append(*matched, child)
+		}
+		descendants(child, name, matched)
+	}
+}
@@ -0,0 +1,60 @@
+package soap
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/internal/xmltree"
+)
+
+func TestPath(t *testing.T) {
+	doc, err := xmltree.Parse(strings.NewReader(`<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <s:Body>
+    <m:GetUsersResponse xmlns:m="urn:users">
+      <m:User id="1"><m:Name>Ann</m:Name><m:Tag>a</m:Tag></m:User>
+      <m:User id="2"><m:Name>Bob &amp; Co</m:Name><m:Tag>b</m:Tag><m:Tag>c</m:Tag></m:User>
+      <m:Total>2</m:Total>
+    </m:GetUsersResponse>
+  </s:Body>
+</s:Envelope>`))
+	if err != nil {
+		t.Fatalf("Expected no error parsing, got: %v", err)
+	}
+
+	for i, test := range []struct {
+		expr     string
+		expected []string
+	}{
+		{"/Envelope/Body/GetUsersResponse/Total", []string{"2"}},
+		{"/s:Envelope/s:Body/m:GetUsersResponse/m:Total", []string{"2"}},
+		{"//User/Name", []string{"Ann", "Bob & Co"}},
+		{"Name", []string{"Ann", "Bob & Co"}},
+		{"//User[2]/Name", []string{"Bob & Co"}},
+		{"//User/Tag[2]", []string{"c"}},
+		{"//User/@id", []string{"1", "2"}},
+		{"//User[1]", []string{"Anna"}}, // all the text of the element
+		{"/Envelope/*/*/Total/text()", []string{"2"}},
+		{"/Body", nil},
+		{"//User[3]/Name", nil},
+		{"//User/@missing", nil},
+	} {
+		p, err := ParsePath(test.expr)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error parsing %s, got: %v", i, test.expr, err)
+			continue
+		}
+		if got := p.Select(doc); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.expected, got)
+		}
+	}
+}
+
+func TestParsePathErrors(t *testing.T) {
+	for _, expr := range []string{"", "/", "a//", "/a/@id/b", "/a/text()/b", "/a[0]", "/a[x]", "/a[1", "/@id[1]"} {
+		if _, err := ParsePath(expr); err == nil {
+			t.Errorf("Expected error parsing %q, got none", expr)
+		}
+	}
+}
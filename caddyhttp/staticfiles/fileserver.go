@@ -1,8 +1,11 @@
 package staticfiles
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"math/rand"
+	"mime"
 	"net/http"
 	"os"
 	"path"
@@ -29,6 +32,9 @@ type FileServer struct {
 
 	// List of files to treat as "Not Found"
 	Hide []string
+
+	// Limits on the byte ranges that may be requested
+	Ranges RangePolicy
 }
 
 // ServeHTTP serves static files for r according to fs's configuration.
@@ -37,9 +43,48 @@ func (fs FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, err
 	if r.URL.Path == "" {
 		r.URL.Path = "/"
 	}
+	if root, ok := r.Context().Value(rootCtxKey).(http.FileSystem); ok {
+		fs.Root = root
+	}
 	return fs.serveFile(w, r, r.URL.Path)
 }
 
+// WithRoot returns a copy of r for which the file server
+// serves files from root instead of the site's root. It
+// lets middleware choose the root of each request.
+func WithRoot(r *http.Request, root http.FileSystem) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), rootCtxKey, root))
+}
+
+// WithPrecompressed returns a copy of r for which the file server
+// sends the compressed copy of a file, with the extension of the
+// first of encodings that has one (.br for br, .gz for gzip), if
+// it is not older than the file. Middleware which writes such
+// copies sets the encodings that the client accepts.
+func WithPrecompressed(r *http.Request, encodings []string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), encodingsCtxKey, encodings))
+}
+
+// ctxKey is the type of context keys used by this package.
+type ctxKey string
+
+const (
+	// rootCtxKey is the context key under which
+	// the root set by WithRoot is stored.
+	rootCtxKey ctxKey = "root"
+
+	// encodingsCtxKey is the context key under which the
+	// encodings set by WithPrecompressed are stored.
+	encodingsCtxKey ctxKey = "encodings"
+)
+
+// precompressedExts are the extensions of the compressed
+// copies of files, by their encoding.
+var precompressedExts = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+}
+
 // serveFile writes the specified file to the HTTP response.
 // name is '/'-separated, not filepath.Separator.
 func (fs FileServer) serveFile(w http.ResponseWriter, r *http.Request, name string) (int, error) {
@@ -105,6 +150,7 @@ func (fs FileServer) serveFile(w http.ResponseWriter, r *http.Request, name stri
 				if err == nil {
 					d = dd
 					f = ff
+					name = index
 					break
 				}
 			}
@@ -121,17 +167,57 @@ func (fs FileServer) serveFile(w http.ResponseWriter, r *http.Request, name stri
 		return http.StatusNotFound, nil
 	}
 
+	// send the compressed copy of the file, if the client accepts it
+	content, size := io.ReadSeeker(f), d.Size()
+	if encodings, ok := r.Context().Value(encodingsCtxKey).([]string); ok {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if cf, cd, encoding := fs.precompressed(name, d, encodings); cf != nil {
+			defer cf.Close()
+			if ctype := mime.TypeByExtension(filepath.Ext(d.Name())); ctype != "" {
+				w.Header().Set("Content-Type", ctype)
+			}
+			w.Header().Set("Content-Encoding", encoding)
+			content, size = cf, cd.Size()
+		}
+	}
+
 	// Experimental ETag header
-	e := fmt.Sprintf(`W/"%x-%x"`, d.ModTime().Unix(), d.Size())
+	e := fmt.Sprintf(`W/"%x-%x"`, d.ModTime().Unix(), size)
 	w.Header().Set("ETag", e)
 
+	r = fs.Ranges.rangeRequest(r, d.ModTime(), e)
+
 	// Note: Errors generated by ServeContent are written immediately
 	// to the response. This usually only happens if seeking fails (rare).
-	http.ServeContent(w, r, d.Name(), d.ModTime(), f)
+	http.ServeContent(w, r, d.Name(), d.ModTime(), content)
 
 	return http.StatusOK, nil
 }
 
+// precompressed opens the compressed copy of the file name,
+// whose info is d, for the first of encodings that has one
+// which is not older than the file, and returns it, its info
+// and the encoding, or nil if there is none.
+func (fs FileServer) precompressed(name string, d os.FileInfo, encodings []string) (http.File, os.FileInfo, string) {
+	for _, encoding := range encodings {
+		ext, ok := precompressedExts[encoding]
+		if !ok {
+			continue
+		}
+		f, err := fs.Root.Open(name + ext)
+		if err != nil {
+			continue
+		}
+		cd, err := f.Stat()
+		if err != nil || !cd.Mode().IsRegular() || cd.ModTime().Before(d.ModTime()) {
+			f.Close()
+			continue
+		}
+		return f, cd, encoding
+	}
+	return nil, nil, ""
+}
+
 // isHidden checks if file with FileInfo d is on hide list.
 func (fs FileServer) isHidden(d os.FileInfo) bool {
 	// If the file is supposed to be hidden, return a 404
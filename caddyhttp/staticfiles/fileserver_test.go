@@ -390,3 +390,18 @@ func TestServeHTTPFailingStat(t *testing.T) {
 		}
 	}
 }
+
+// TestServeHTTPWithRoot tests that a root set on the
+// request takes precedence over the file server's.
+func TestServeHTTPWithRoot(t *testing.T) {
+	fileserver := FileServer{Root: failingFS{err: os.ErrNotExist}}
+
+	request, err := http.NewRequest("GET", "https://foo/file", nil)
+	if err != nil {
+		t.Fatalf("Failed to build request. Error was: %v", err)
+	}
+	status, _ := fileserver.ServeHTTP(httptest.NewRecorder(), WithRoot(request, failingFS{err: os.ErrPermission}))
+	if status != http.StatusForbidden {
+		t.Errorf("Expected status %d from the request's root, found %d", http.StatusForbidden, status)
+	}
+}
@@ -0,0 +1,26 @@
+package staticfiles
+
+import (
+	"net/http"
+	"os"
+)
+
+// Overlay is a file system that opens files from the first of
+// its file systems that has them, so that the files of one
+// directory, such as a theme, can override those of another.
+// Directories are not merged: a directory is opened from the
+// first file system that has it.
+type Overlay []http.FileSystem
+
+// Open implements the http.FileSystem interface.
+func (o Overlay) Open(name string) (http.File, error) {
+	err := os.ErrNotExist
+	for _, fs := range o {
+		var f http.File
+		f, err = fs.Open(name)
+		if err == nil || !os.IsNotExist(err) {
+			return f, err
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,96 @@
+package staticfiles
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOverlay(t *testing.T) {
+	theme, err := ioutil.TempDir("", "caddy_overlay_theme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(theme)
+	base, err := ioutil.TempDir("", "caddy_overlay_base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+	ioutil.WriteFile(filepath.Join(theme, "style.css"), []byte("theme style"), 0644)
+	ioutil.WriteFile(filepath.Join(base, "style.css"), []byte("base style"), 0644)
+	ioutil.WriteFile(filepath.Join(base, "index.html"), []byte("base index"), 0644)
+	os.Mkdir(filepath.Join(theme, "unreadable"), 0)
+	defer os.Chmod(filepath.Join(theme, "unreadable"), 0755)
+
+	fileserver := FileServer{Root: Overlay{http.Dir(theme), http.Dir(base)}}
+	for i, test := range []struct {
+		path         string
+		expectStatus int
+		expectBody   string
+	}{
+		{"/style.css", http.StatusOK, "theme style"},
+		{"/index.html", http.StatusOK, "base index"},
+		{"/", http.StatusOK, "base index"},
+		{"/missing.css", http.StatusNotFound, ""},
+	} {
+		w := httptest.NewRecorder()
+		status, _ := fileserver.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if status != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if test.expectBody != "" && w.Body.String() != test.expectBody {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.expectBody, w.Body.String())
+		}
+	}
+
+	// errors other than files not existing are not hidden
+	// by the file systems underneath
+	if os.Getuid() != 0 {
+		if _, err := (Overlay{http.Dir(theme), http.Dir(base)}).Open("/unreadable/x"); err == nil || os.IsNotExist(err) {
+			t.Errorf("Expected permission error, got: %v", err)
+		}
+	}
+}
+
+func TestOverlayPrecompressed(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_overlay_root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	fallback, err := ioutil.TempDir("", "caddy_overlay_fallback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fallback)
+	ioutil.WriteFile(filepath.Join(fallback, "app.js"), []byte("plain"), 0644)
+	ioutil.WriteFile(filepath.Join(fallback, "app.js.br"), []byte("brotli"), 0644)
+
+	fs := FileServer{Root: Overlay{http.Dir(root), http.Dir(fallback)}}
+	for i, test := range []struct {
+		encodings        []string
+		expectedEncoding string
+		expectedBody     string
+	}{
+		{[]string{"br", "gzip"}, "br", "brotli"},
+		{[]string{"gzip"}, "", "plain"},
+		{nil, "", "plain"},
+	} {
+		r := httptest.NewRequest("GET", "/app.js", nil)
+		if test.encodings != nil {
+			r = WithPrecompressed(r, test.encodings)
+		}
+		w := httptest.NewRecorder()
+		fs.ServeHTTP(w, r)
+		if enc := w.Header().Get("Content-Encoding"); enc != test.expectedEncoding {
+			t.Errorf("Test %d: Expected encoding %q, got %q", i, test.expectedEncoding, enc)
+		}
+		if w.Body.String() != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package staticfiles
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RangePolicy limits the byte ranges that may be requested of
+// files, since requests for many small or overlapping ranges of
+// large files can make the server do far more work than the
+// requests are worth.
+type RangePolicy struct {
+	// The most ranges a request may ask for; the whole
+	// file is served for requests asking for more. If
+	// 0, there is no limit.
+	MaxRanges int
+
+	// Path prefixes under which ranges are not served
+	Disabled []string
+}
+
+// rangeRequest returns r, or a copy of r without the Range header
+// if its ranges should not be served from a file with modtime and
+// etag. The If-Range precondition is evaluated here rather than by
+// http.ServeContent, so that weak validators never satisfy it.
+func (p RangePolicy) rangeRequest(r *http.Request, modtime time.Time, etag string) *http.Request {
+	rangeHeader, ifRange := r.Header.Get("Range"), r.Header.Get("If-Range")
+	if rangeHeader == "" && ifRange == "" {
+		return r
+	}
+	serveRanges := rangeHeader != "" && p.allows(r.URL.Path, rangeHeader) &&
+		ifRangeMatches(ifRange, modtime, etag)
+
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.Header = make(http.Header, len(r.Header))
+	for name, values := range r.Header {
+		r2.Header[name] = values
+	}
+	r2.Header.Del("If-Range")
+	if !serveRanges {
+		r2.Header.Del("Range")
+	}
+	return r2
+}
+
+// allows returns whether the ranges in rangeHeader
+// may be served for the file at urlPath.
+func (p RangePolicy) allows(urlPath, rangeHeader string) bool {
+	for _, prefix := range p.Disabled {
+		if strings.HasPrefix(urlPath, prefix) {
+			return false
+		}
+	}
+	return p.MaxRanges == 0 || strings.Count(rangeHeader, ",") < p.MaxRanges
+}
+
+// ifRangeMatches returns whether the If-Range value, if any,
+// is satisfied by a file with modtime and etag. Only strong
+// validators satisfy it (RFC 7233 §3.2): an entity tag that
+// is not weak, or a modification time at least a second old,
+// since the file may change again within the same second.
+func ifRangeMatches(ifRange string, modtime time.Time, etag string) bool {
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return ifRange == etag && !strings.HasPrefix(etag, "W/")
+	}
+	t, err := http.ParseTime(ifRange)
+	if err != nil || modtime.IsZero() || time.Since(modtime) < time.Second {
+		return false
+	}
+	return modtime.Unix() == t.Unix()
+}
@@ -0,0 +1,77 @@
+package staticfiles
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRangePolicy(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_ranges")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	os.Mkdir(filepath.Join(root, "isos"), 0755)
+	for _, name := range []string{"file.txt", "isos/big.iso"} {
+		fname := filepath.Join(root, filepath.FromSlash(name))
+		ioutil.WriteFile(fname, []byte("0123456789"), 0644)
+		old := time.Now().Add(-time.Hour)
+		os.Chtimes(fname, old, old)
+	}
+	fi, _ := os.Stat(filepath.Join(root, "file.txt"))
+	lastModified := fi.ModTime().UTC().Format(http.TimeFormat)
+
+	fileserver := FileServer{
+		Root:   http.Dir(root),
+		Ranges: RangePolicy{MaxRanges: 2, Disabled: []string{"/isos"}},
+	}
+	for i, test := range []struct {
+		path, rangeHeader, ifRange string
+		expectStatus               int
+	}{
+		{"/file.txt", "bytes=0-1", "", http.StatusPartialContent},
+		{"/file.txt", "bytes=0-1,3-4", "", http.StatusPartialContent},
+		{"/file.txt", "bytes=0-1,3-4,6-7", "", http.StatusOK},
+		{"/isos/big.iso", "bytes=0-1", "", http.StatusOK},
+		{"/file.txt", "bytes=0-1", lastModified, http.StatusPartialContent},
+		{"/file.txt", "bytes=0-1", "Mon, 02 Jan 2006 15:04:05 GMT", http.StatusOK},
+		{"/file.txt", "bytes=0-1", "garbage", http.StatusOK},
+		// the ETag is weak, so it can't satisfy If-Range
+		{"/file.txt", "bytes=0-1", "etag", http.StatusOK},
+		{"/file.txt", "bytes=0-1", `"other"`, http.StatusOK},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.Header.Set("Range", test.rangeHeader)
+		w := httptest.NewRecorder()
+		if test.ifRange == "etag" {
+			fileserver.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+			test.ifRange = w.Header().Get("ETag")
+			w = httptest.NewRecorder()
+		}
+		if test.ifRange != "" {
+			r.Header.Set("If-Range", test.ifRange)
+		}
+		fileserver.ServeHTTP(w, r)
+		if w.Code != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, w.Code)
+		}
+		if r.Header.Get("Range") != test.rangeHeader {
+			t.Errorf("Test %d: Expected request's own headers to be left alone", i)
+		}
+	}
+}
+
+func TestIfRangeMatchesRecentModification(t *testing.T) {
+	now := time.Now()
+	if ifRangeMatches(now.UTC().Format(http.TimeFormat), now, `W/"x"`) {
+		t.Error("Expected modification time within the last second not to be a strong validator")
+	}
+	if !ifRangeMatches(`"x"`, now, `"x"`) || ifRangeMatches(`W/"x"`, now, `W/"x"`) {
+		t.Error("Expected only strong entity tags to match")
+	}
+}
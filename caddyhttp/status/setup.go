@@ -10,8 +10,9 @@ import (
 // init registers Status plugin
 func init() {
 	caddy.RegisterPlugin("status", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
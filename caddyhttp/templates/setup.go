@@ -1,21 +1,23 @@
 package templates
 
 import (
-	"net/http"
-
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
 func init() {
 	caddy.RegisterPlugin("templates", caddy.Plugin{
-		ServerType: "http",
-		Action:     setup,
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
 	})
 }
 
 // setup configures a new Templates middleware instance.
 func setup(c *caddy.Controller) error {
+	if err := httpserver.CheckStaticRoot(c); err != nil {
+		return err
+	}
 	rules, err := templatesParse(c)
 	if err != nil {
 		return err
@@ -26,7 +28,7 @@ func setup(c *caddy.Controller) error {
 	tmpls := Templates{
 		Rules:   rules,
 		Root:    cfg.Root,
-		FileSys: http.Dir(cfg.Root),
+		FileSys: cfg.FileSystem(),
 	}
 
 	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
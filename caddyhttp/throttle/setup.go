@@ -0,0 +1,108 @@
+package throttle
+
+import (
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("throttle", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
+	})
+}
+
+// setup configures a new Throttle middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := throttleParse(c)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	c.OnStartup(func() error {
+		go sweeper(rules, sweepInterval, stop)
+		return nil
+	})
+	c.OnShutdown(func() error {
+		close(stop)
+		return nil
+	})
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Throttle{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// throttleParse parses throttle directives of the form
+//
+//	throttle [path] rate {
+//	    burst size
+//	    per   connection|ip
+//	}
+//
+// where rate is in bytes per second, like 512KB or 1MiB. The
+// burst defaults to one second's worth of data at the rate.
+func throttleParse(c *caddy.Controller) ([]*Rule, error) {
+	var rules []*Rule
+
+	for c.Next() {
+		rule := &Rule{Path: "/", Per: PerConnection}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 1:
+		case 2:
+			rule.Path = args[0]
+			args = args[1:]
+		default:
+			return rules, c.ArgErr()
+		}
+		rate, err := humanize.ParseBytes(args[0])
+		if err != nil || rate == 0 {
+			return rules, c.Errf("throttle: invalid rate '%s'", args[0])
+		}
+		rule.Rate = int64(rate)
+		rule.Burst = rule.Rate
+
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return rules, c.ArgErr()
+			}
+			value := c.Val()
+			if c.NextArg() {
+				return rules, c.ArgErr()
+			}
+
+			switch what {
+			case "burst":
+				burst, err := humanize.ParseBytes(value)
+				if err != nil || burst == 0 {
+					return rules, c.Errf("throttle: invalid burst '%s'", value)
+				}
+				rule.Burst = int64(burst)
+			case "per":
+				if value != PerConnection && value != PerIP {
+					return rules, c.Errf("throttle: invalid scope '%s'", value)
+				}
+				rule.Per = value
+			default:
+				return rules, c.Errf("throttle: unknown property '%s'", what)
+			}
+		}
+
+		for _, existing := range rules {
+			if existing.Path == rule.Path {
+				return rules, c.Errf("throttle: duplicate path '%s'", rule.Path)
+			}
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,92 @@
+package throttle
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `throttle 1MB`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Throttle)
+	if !ok {
+		t.Fatalf("Expected handler to be type Throttle, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestThrottleParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{`throttle 1MB`, false, []Rule{
+			{Path: "/", Rate: 1000000, Burst: 1000000, Per: PerConnection},
+		}},
+		{`throttle /downloads 512KiB {
+			burst 2MiB
+			per ip
+		}`, false, []Rule{
+			{Path: "/downloads", Rate: 512 * 1024, Burst: 2 * 1024 * 1024, Per: PerIP},
+		}},
+		{`throttle /a 1KB
+		  throttle /b 2KB`, false, []Rule{
+			{Path: "/a", Rate: 1000, Burst: 1000, Per: PerConnection},
+			{Path: "/b", Rate: 2000, Burst: 2000, Per: PerConnection},
+		}},
+		{`throttle`, true, nil},
+		{`throttle /a`, true, nil},
+		{`throttle /a fast`, true, nil},
+		{`throttle /a 1KB 2KB`, true, nil},
+		{`throttle 1KB {
+			burst
+		}`, true, nil},
+		{`throttle 1KB {
+			per host
+		}`, true, nil},
+		{`throttle 1KB {
+			delay 1s
+		}`, true, nil},
+		{`throttle 1KB
+		  throttle 2KB`, true, nil},
+	}
+	for i, test := range tests {
+		actual, err := throttleParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error but got none", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error but got: %v", i, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		if len(actual) != len(test.expected) {
+			t.Errorf("Test %d: Expected %d rules, got %d", i, len(test.expected), len(actual))
+			continue
+		}
+		for j, rule := range actual {
+			expected := &test.expected[j]
+			if rule.Path != expected.Path || rule.Rate != expected.Rate ||
+				rule.Burst != expected.Burst || rule.Per != expected.Per {
+				t.Errorf("Test %d, rule %d: Expected %+v, got %+v", i, j, expected, rule)
+			}
+		}
+	}
+}
@@ -0,0 +1,257 @@
+// Package throttle provides middleware that limits the bandwidth
+// of responses per connection or per client IP address.
+package throttle
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Scopes of a throttling rule.
+const (
+	// PerConnection throttles each connection separately.
+	PerConnection = "connection"
+
+	// PerIP shares the bandwidth among all connections
+	// from the same client IP address.
+	PerIP = "ip"
+)
+
+// Throttle is middleware that limits the rate at which
+// responses are written for requests matching a rule.
+type Throttle struct {
+	Next  httpserver.Handler
+	Rules []*Rule
+}
+
+// Rule limits the bandwidth of responses to requests
+// to a base path.
+type Rule struct {
+	// Base path of requests this rule applies to
+	Path string
+
+	// Sustained rate in bytes per second
+	Rate int64
+
+	// Bytes that may be sent at once above the rate
+	Burst int64
+
+	// Whether the rate applies per connection or per IP
+	Per string
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (t Throttle) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var rule *Rule
+	for _, candidate := range t.Rules {
+		if !httpserver.Path(r.URL.Path).Matches(candidate.Path) {
+			continue
+		}
+		if rule == nil || len(candidate.Path) > len(rule.Path) {
+			rule = candidate
+		}
+	}
+	if rule == nil {
+		return t.Next.ServeHTTP(w, r)
+	}
+
+	key := r.RemoteAddr
+	if rule.Per == PerIP {
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			key = host
+		}
+	}
+	b := rule.acquire(key)
+	defer rule.release(key)
+
+	return t.Next.ServeHTTP(&throttledWriter{ResponseWriter: w, bucket: b}, r)
+}
+
+// acquire returns the bucket for key, creating it if necessary.
+// Every call must be paired with a call to release.
+func (rule *Rule) acquire(key string) *bucket {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+	if rule.buckets == nil {
+		rule.buckets = make(map[string]*bucket)
+	}
+	b, ok := rule.buckets[key]
+	if !ok {
+		b = newBucket(rule.Rate, rule.Burst)
+		rule.buckets[key] = b
+	}
+	b.refs++
+	return b
+}
+
+// release releases the bucket for key. Buckets are kept once
+// nothing uses them, so that clients which make one request after
+// another do not get a new burst each time, until sweep forgets them.
+func (rule *Rule) release(key string) {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+	if b, ok := rule.buckets[key]; ok {
+		b.refs--
+	}
+}
+
+// sweep forgets the buckets that nothing uses and that are full
+// again, which would be the same as new ones.
+func (rule *Rule) sweep() {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+	for key, b := range rule.buckets {
+		if b.refs <= 0 && b.full() {
+			delete(rule.buckets, key)
+		}
+	}
+}
+
+// sweeper sweeps rules every interval until stop is closed.
+func sweeper(rules []*Rule, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, rule := range rules {
+				rule.sweep()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// bucket is a token bucket where each token is one byte.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64 // max tokens
+	tokens float64
+	last   time.Time
+	refs   int // guarded by the rule's mutex
+}
+
+func newBucket(rate, burst int64) *bucket {
+	return &bucket{rate: float64(rate), burst: float64(burst), tokens: float64(burst), last: now()}
+}
+
+// reserve takes n tokens from the bucket and returns how long
+// to wait before they may be used. The bucket may go into debt.
+func (b *bucket) reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := now()
+	b.tokens += t.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = t
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// full returns whether the bucket has refilled up to its burst.
+func (b *bucket) full() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens+now().Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// chunkSize returns how many bytes to write at once,
+// so that writes are smooth rather than bursty.
+func (b *bucket) chunkSize() int {
+	size := int(b.burst)
+	if size > maxChunkSize {
+		size = maxChunkSize
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+const (
+	// maxChunkSize is the most bytes that are written at once.
+	maxChunkSize = 32 * 1024
+
+	// sweepInterval is how often unused buckets are forgotten.
+	sweepInterval = time.Minute
+)
+
+// now and sleep are variables so they can be mocked in tests.
+var (
+	now   = time.Now
+	sleep = time.Sleep
+)
+
+// throttledWriter is a response writer whose writes
+// are paced by a token bucket.
+type throttledWriter struct {
+	http.ResponseWriter
+	bucket *bucket
+}
+
+// Write writes p in chunks, waiting as needed to keep
+// within the bucket's rate.
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	var written int
+	size := w.bucket.chunkSize()
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > size {
+			chunk = chunk[:size]
+		}
+		if delay := w.bucket.reserve(len(chunk)); delay > 0 {
+			sleep(delay)
+		}
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// Hijack implements http.Hijacker. It simply wraps the underlying
+// ResponseWriter's Hijack method if there is one, or returns an error.
+func (w *throttledWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, httpserver.NonHijackerError{Underlying: w.ResponseWriter}
+}
+
+// Flush implements http.Flusher. It simply wraps the underlying
+// ResponseWriter's Flush method if there is one, or panics.
+func (w *throttledWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	} else {
+		panic(httpserver.NonFlusherError{Underlying: w.ResponseWriter}) // should be recovered at the beginning of middleware stack
+	}
+}
+
+// CloseNotify implements http.CloseNotifier.
+// It just inherits the underlying ResponseWriter's CloseNotify method.
+// It panics if the underlying ResponseWriter is not a CloseNotifier.
+func (w *throttledWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	panic(httpserver.NonCloseNotifierError{Underlying: w.ResponseWriter})
+}
@@ -0,0 +1,124 @@
+package throttle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// mockClock replaces now and sleep with a fake clock which
+// only advances by sleeping, and returns a function that
+// restores them and the total time slept.
+func mockClock() func() time.Duration {
+	clock := time.Unix(0, 0)
+	var slept time.Duration
+	now = func() time.Time { return clock }
+	sleep = func(d time.Duration) {
+		clock = clock.Add(d)
+		slept += d
+	}
+	return func() time.Duration {
+		now, sleep = time.Now, time.Sleep
+		return slept
+	}
+}
+
+func TestBucket(t *testing.T) {
+	restore := mockClock()
+	defer restore()
+
+	b := newBucket(100, 50)
+	if d := b.reserve(50); d != 0 {
+		t.Errorf("Expected burst to be sent without delay, got %v", d)
+	}
+	if d := b.reserve(50); d != 500*time.Millisecond {
+		t.Errorf("Expected delay of 500ms, got %v", d)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	restore := mockClock()
+
+	body := make([]byte, 3000)
+	th := Throttle{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Write(body)
+			return http.StatusOK, nil
+		}),
+		Rules: []*Rule{
+			{Path: "/slow", Rate: 1000, Burst: 1000, Per: PerIP},
+		},
+	}
+
+	req, err := http.NewRequest("GET", "/slow/file", nil)
+	if err != nil {
+		t.Fatalf("Could not create HTTP request: %v", err)
+	}
+	req.RemoteAddr = "10.0.0.1:1234"
+	rec := httptest.NewRecorder()
+	th.ServeHTTP(rec, req)
+
+	// the first 1000 bytes are the burst, then 1000 bytes/s
+	if slept := restore(); slept != 2*time.Second {
+		t.Errorf("Expected to take 2s, took %v", slept)
+	}
+	if rec.Body.Len() != len(body) {
+		t.Errorf("Expected %d bytes to be written, got %d", len(body), rec.Body.Len())
+	}
+	if b := th.Rules[0].buckets["10.0.0.1"]; b == nil || b.refs != 0 {
+		t.Error("Expected bucket to be released and kept")
+	}
+
+	// requests outside the rule's path are not throttled
+	restore = mockClock()
+	req, _ = http.NewRequest("GET", "/fast", nil)
+	th.ServeHTTP(httptest.NewRecorder(), req)
+	if slept := restore(); slept != 0 {
+		t.Errorf("Expected no throttling, took %v", slept)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	restore := mockClock()
+	defer restore()
+
+	th := Throttle{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Write(make([]byte, 1000))
+			return http.StatusOK, nil
+		}),
+		Rules: []*Rule{
+			{Path: "/", Rate: 1000, Burst: 1000, Per: PerIP},
+		},
+	}
+	serve := func() time.Duration {
+		start := now()
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		th.ServeHTTP(httptest.NewRecorder(), req)
+		return now().Sub(start)
+	}
+	rule := th.Rules[0]
+
+	serve()
+	// the next request of the client gets no new burst
+	if took := serve(); took != time.Second {
+		t.Errorf("Expected second request to take 1s, took %v", took)
+	}
+	rule.sweep()
+	if len(rule.buckets) != 1 {
+		t.Error("Expected bucket that is not full to be kept")
+	}
+
+	sleep(time.Second)
+	rule.sweep()
+	if len(rule.buckets) != 0 {
+		t.Error("Expected full bucket to be forgotten")
+	}
+	if took := serve(); took != 0 {
+		t.Errorf("Expected request with a new bucket to take no time, took %v", took)
+	}
+}
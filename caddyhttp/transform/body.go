@@ -0,0 +1,159 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Formats of bodies that can be transformed.
+const (
+	JSON = "json"
+	Form = "form"
+)
+
+// contentTypes are the content types of the formats.
+var contentTypes = map[string]string{
+	JSON: "application/json; charset=utf-8",
+	Form: "application/x-www-form-urlencoded",
+}
+
+// format returns the format of a body with contentType,
+// or "" if it cannot be transformed.
+func format(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return JSON
+	case mediaType == "application/x-www-form-urlencoded":
+		return Form
+	}
+	return ""
+}
+
+// decode decodes body, in format f, into an object. The
+// dotted keys of forms, like user.name, become nested objects.
+func decode(body []byte, f string) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+	if len(bytes.TrimSpace(body)) == 0 {
+		return doc, nil
+	}
+	if f == JSON {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber() // keep numbers exactly as they were
+		if err := dec.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("body is not a JSON object: %v", err)
+		}
+		return doc, nil
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var value interface{} = values[key][0]
+		if len(values[key]) > 1 {
+			list := make([]interface{}, len(values[key]))
+			for i, v := range values[key] {
+				list[i] = v
+			}
+			value = list
+		}
+		set(doc, key, value)
+	}
+	return doc, nil
+}
+
+// encode encodes doc in format f.
+func encode(doc map[string]interface{}, f string) ([]byte, error) {
+	if f == JSON {
+		return json.Marshal(doc)
+	}
+	values := make(url.Values)
+	flatten(values, "", doc)
+	return []byte(values.Encode()), nil
+}
+
+// flatten adds the fields of object to values, with their keys
+// prefixed by prefix, so nested objects get dotted keys.
+func flatten(values url.Values, prefix string, object map[string]interface{}) {
+	for key, value := range object {
+		addValue(values, prefix+key, value)
+	}
+}
+
+func addValue(values url.Values, key string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		flatten(values, key+".", v)
+	case []interface{}:
+		for _, item := range v {
+			addValue(values, key, item)
+		}
+	case nil:
+		values.Add(key, "")
+	case string:
+		values.Add(key, v)
+	default:
+		values.Add(key, fmt.Sprint(v))
+	}
+}
+
+// get returns the field of doc at path, whose keys
+// are separated by dots.
+func get(doc map[string]interface{}, path string) (interface{}, bool) {
+	keys := strings.Split(path, ".")
+	object := doc
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := object[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		object = next
+	}
+	value, ok := object[keys[len(keys)-1]]
+	return value, ok
+}
+
+// set sets the field of doc at path to value, creating
+// the objects it is nested in as needed.
+func set(doc map[string]interface{}, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	object := doc
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := object[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			object[key] = next
+		}
+		object = next
+	}
+	object[keys[len(keys)-1]] = value
+}
+
+// remove removes the field of doc at path, if any.
+func remove(doc map[string]interface{}, path string) {
+	keys := strings.Split(path, ".")
+	object := doc
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := object[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		object = next
+	}
+	delete(object, keys[len(keys)-1])
+}
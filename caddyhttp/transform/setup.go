@@ -0,0 +1,124 @@
+package transform
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("transform", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
+	})
+}
+
+// setup configures a new Transform middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := transformParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Transform{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// transformParse parses transform directives of the form
+//
+//	transform [path] {
+//	    request|response rename field new_name
+//	    request|response remove field
+//	    request|response set    field value
+//	    request|response to_json|to_form
+//	}
+//
+// The operations are applied in order, to JSON and form-encoded
+// bodies only. Values that are set may contain placeholders, and
+// are strings. The keys of form fields are split at dots, like
+// those of fields, and joined with dots when converting to forms.
+func transformParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{Path: "/"}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			rule.Path = args[0]
+		default:
+			return rules, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			direction := c.Val()
+			if direction != "request" && direction != "response" {
+				return rules, c.Errf("transform: unknown property '%s'", direction)
+			}
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return rules, c.ArgErr()
+			}
+			op := Op{Action: args[0]}
+			args = args[1:]
+
+			switch op.Action {
+			case "rename", "set":
+				if len(args) != 2 {
+					return rules, c.ArgErr()
+				}
+				op.Field, op.Arg = args[0], args[1]
+			case "remove":
+				if len(args) != 1 {
+					return rules, c.ArgErr()
+				}
+				op.Field = args[0]
+			case "to_json", "to_form":
+				if len(args) != 0 {
+					return rules, c.ArgErr()
+				}
+			default:
+				return rules, c.Errf("transform: unknown action '%s'", op.Action)
+			}
+			if !validPath(op.Field) || op.Action == "rename" && !validPath(op.Arg) {
+				return rules, c.Errf("transform: invalid field in '%s'", strings.Join(append([]string{op.Action}, args...), " "))
+			}
+
+			if direction == "request" {
+				rule.Request = append(rule.Request, op)
+			} else {
+				rule.Response = append(rule.Response, op)
+			}
+		}
+
+		for _, existing := range rules {
+			if existing.Path == rule.Path {
+				return rules, c.Errf("transform: duplicate path '%s'", rule.Path)
+			}
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// validPath returns whether path names a field, with
+// no empty keys; actions without a field have "".
+func validPath(path string) bool {
+	if path == "" {
+		return true
+	}
+	for _, key := range strings.Split(path, ".") {
+		if key == "" {
+			return false
+		}
+	}
+	return true
+}
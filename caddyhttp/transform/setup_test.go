@@ -0,0 +1,83 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `transform /api {
+		request to_json
+	}`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) != 1 {
+		t.Fatalf("Expected 1 middleware, got %d", len(mids))
+	}
+	handler, ok := mids[0](httpserver.EmptyNext).(Transform)
+	if !ok {
+		t.Fatalf("Expected handler to be type Transform, got: %#v", handler)
+	}
+	if !httpserver.SameNext(handler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestTransformParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{`transform`, false, []Rule{{Path: "/"}}},
+		{`transform /api {
+			request  rename user.name username
+			request  set    client {remote}
+			request  to_form
+			response remove secret
+			response to_json
+		}`, false, []Rule{{
+			Path: "/api",
+			Request: []Op{
+				{Action: "rename", Field: "user.name", Arg: "username"},
+				{Action: "set", Field: "client", Arg: "{remote}"},
+				{Action: "to_form"},
+			},
+			Response: []Op{
+				{Action: "remove", Field: "secret"},
+				{Action: "to_json"},
+			},
+		}}},
+		{"transform /a\ntransform /b", false, []Rule{{Path: "/a"}, {Path: "/b"}}},
+		{"transform /a\ntransform /a", true, nil},
+		{`transform /a /b`, true, nil},
+		{"transform {\n body remove a\n}", true, nil},
+		{"transform {\n request\n}", true, nil},
+		{"transform {\n request copy a b\n}", true, nil},
+		{"transform {\n request rename a\n}", true, nil},
+		{"transform {\n request remove a b\n}", true, nil},
+		{"transform {\n request set a\n}", true, nil},
+		{"transform {\n request to_json now\n}", true, nil},
+		{"transform {\n request remove a..b\n}", true, nil},
+		{"transform {\n request rename a .b\n}", true, nil},
+	} {
+		rules, err := transformParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if !reflect.DeepEqual(rules, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, rules)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Package transform provides middleware that rewrites JSON and
+// form-encoded request and response bodies on their way to and
+// from the upstream: renaming, removing and setting fields, and
+// converting between the two formats.
+package transform
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Transform is middleware that transforms the bodies of
+// requests and responses matching a rule.
+type Transform struct {
+	Next  httpserver.Handler
+	Rules []Rule
+}
+
+// Rule transforms the bodies of requests to a base path
+// and of their responses.
+type Rule struct {
+	Path     string
+	Request  []Op
+	Response []Op
+}
+
+// Op is an operation on a body. Fields are named by
+// their path, with the keys of nested objects separated
+// by dots, like user.name.
+type Op struct {
+	// Action is rename, remove, set, to_json or to_form
+	Action string
+
+	// Field the action applies to
+	Field string
+
+	// Arg is the new name of a renamed field, or the
+	// value of a field being set, with placeholders
+	Arg string
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (t Transform) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var rule *Rule
+	for i := range t.Rules {
+		if !httpserver.Path(r.URL.Path).Matches(t.Rules[i].Path) {
+			continue
+		}
+		if rule == nil || len(t.Rules[i].Path) > len(rule.Path) {
+			rule = &t.Rules[i]
+		}
+	}
+	if rule == nil {
+		return t.Next.ServeHTTP(w, r)
+	}
+	repl := httpserver.NewReplacer(r, nil, "")
+
+	if len(rule.Request) > 0 && r.Body != nil {
+		if f := format(r.Header.Get("Content-Type")); f != "" {
+			body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+			if err != nil {
+				return http.StatusBadRequest, err
+			}
+			if len(body) > maxBodySize {
+				return http.StatusRequestEntityTooLarge, nil
+			}
+			body, f, err = apply(rule.Request, body, f, repl)
+			if err != nil {
+				return http.StatusBadRequest, err
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+			r.Header.Del("Content-Length")
+			r.Header.Set("Content-Type", contentTypes[f])
+		}
+	}
+	if len(rule.Response) == 0 || r.Method == http.MethodHead {
+		return t.Next.ServeHTTP(w, r)
+	}
+
+	// encoded responses cannot be transformed
+	r.Header.Del("Accept-Encoding")
+	tw := &transformWriter{ResponseWriter: w}
+	status, err := t.Next.ServeHTTP(tw, r)
+	if !tw.buffering {
+		return status, err
+	}
+	// errors are written further out, so there is nothing to transform
+	if status >= 400 {
+		return status, err
+	}
+
+	body, f, applyErr := apply(rule.Response, tw.buf.Bytes(), tw.format, repl)
+	if applyErr != nil {
+		// not what it claims to be; leave it as it is
+		body, f = tw.buf.Bytes(), ""
+	}
+	if f != "" {
+		w.Header().Set("Content-Type", contentTypes[f])
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(tw.status)
+	w.Write(body)
+	return status, err
+}
+
+// apply applies ops to body, in format f, and returns
+// the transformed body and its format.
+func apply(ops []Op, body []byte, f string, repl httpserver.Replacer) ([]byte, string, error) {
+	doc, err := decode(body, f)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, op := range ops {
+		switch op.Action {
+		case "rename":
+			if value, ok := get(doc, op.Field); ok {
+				remove(doc, op.Field)
+				set(doc, op.Arg, value)
+			}
+		case "remove":
+			remove(doc, op.Field)
+		case "set":
+			set(doc, op.Field, repl.Replace(op.Arg))
+		case "to_json":
+			f = JSON
+		case "to_form":
+			f = Form
+		}
+	}
+	body, err = encode(doc, f)
+	return body, f, err
+}
+
+// transformWriter buffers a response to transform it, if
+// it is JSON or form-encoded and not too large; otherwise
+// it writes the response through.
+type transformWriter struct {
+	http.ResponseWriter
+	buf         bytes.Buffer
+	format      string
+	status      int
+	wroteHeader bool
+	buffering   bool
+}
+
+// WriteHeader decides whether to buffer the response.
+func (w *transformWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	h := w.Header()
+	w.format = format(h.Get("Content-Type"))
+	if w.format != "" && h.Get("Content-Encoding") == "" &&
+		status != http.StatusNoContent && status != http.StatusNotModified {
+		w.buffering = true
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write buffers p, unless the response is not being
+// transformed or grows too large to be.
+func (w *transformWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.buffering {
+		return w.ResponseWriter.Write(p)
+	}
+	if w.buf.Len()+len(p) > maxBodySize {
+		// write what was buffered as it is
+		w.buffering = false
+		w.ResponseWriter.WriteHeader(w.status)
+		if _, err := w.buf.WriteTo(w.ResponseWriter); err != nil {
+			return 0, err
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+// Flush implements http.Flusher. Buffered responses
+// are not flushed until they are complete.
+func (w *transformWriter) Flush() {
+	if w.buffering {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	} else {
+		panic(httpserver.NonFlusherError{Underlying: w.ResponseWriter}) // should be recovered at the beginning of middleware stack
+	}
+}
+
+// Hijack implements http.Hijacker. It simply wraps the underlying
+// ResponseWriter's Hijack method if there is one, or returns an error.
+func (w *transformWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, httpserver.NonHijackerError{Underlying: w.ResponseWriter}
+}
+
+// CloseNotify implements http.CloseNotifier.
+// It just inherits the underlying ResponseWriter's CloseNotify method.
+// It panics if the underlying ResponseWriter is not a CloseNotifier.
+func (w *transformWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	panic(httpserver.NonCloseNotifierError{Underlying: w.ResponseWriter})
+}
+
+// maxBodySize is the largest body that is transformed.
+const maxBodySize = 4 << 20
@@ -0,0 +1,134 @@
+package transform
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestTransformRequest(t *testing.T) {
+	var gotBody, gotType string
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		body, _ := ioutil.ReadAll(r.Body)
+		gotBody, gotType = string(body), r.Header.Get("Content-Type")
+		if int64(len(body)) != r.ContentLength {
+			t.Errorf("Expected content length %d, got %d", len(body), r.ContentLength)
+		}
+		return http.StatusOK, nil
+	})
+
+	for i, test := range []struct {
+		ops                    []Op
+		contentType, body      string
+		expectType, expectBody string
+		expectStatus           int
+	}{
+		{
+			[]Op{{Action: "rename", Field: "user.name", Arg: "username"}, {Action: "remove", Field: "password"}},
+			"application/json", `{"user": {"name": "a", "id": 12345678901234567890}, "password": "x"}`,
+			"application/json; charset=utf-8", `{"user":{"id":12345678901234567890},"username":"a"}`, http.StatusOK,
+		},
+		{
+			[]Op{{Action: "set", Field: "client.method", Arg: "{method}"}, {Action: "to_form"}},
+			"application/json", `{"a": [1, true, null], "b": {"c": "d"}}`,
+			"application/x-www-form-urlencoded", `a=1&a=true&a=&b.c=d&client.method=POST`, http.StatusOK,
+		},
+		{
+			[]Op{{Action: "to_json"}},
+			"application/x-www-form-urlencoded", `user.name=a&tag=x&tag=y`,
+			"application/json; charset=utf-8", `{"tag":["x","y"],"user":{"name":"a"}}`, http.StatusOK,
+		},
+		{
+			[]Op{{Action: "rename", Field: "missing", Arg: "other"}},
+			"application/json", ``,
+			"application/json; charset=utf-8", `{}`, http.StatusOK,
+		},
+		{
+			[]Op{{Action: "remove", Field: "a"}},
+			"text/plain", `a`,
+			"text/plain", `a`, http.StatusOK,
+		},
+		{
+			[]Op{{Action: "remove", Field: "a"}},
+			"application/json", `[1, 2]`,
+			"", "", http.StatusBadRequest,
+		},
+	} {
+		gotBody, gotType = "", ""
+		tr := Transform{Next: next, Rules: []Rule{{Path: "/", Request: test.ops}}}
+		r := httptest.NewRequest("POST", "/api", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", test.contentType)
+
+		status, _ := tr.ServeHTTP(httptest.NewRecorder(), r)
+		if status != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if gotType != test.expectType {
+			t.Errorf("Test %d: Expected content type '%s', got '%s'", i, test.expectType, gotType)
+		}
+		if gotBody != test.expectBody {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.expectBody, gotBody)
+		}
+	}
+}
+
+func TestTransformResponse(t *testing.T) {
+	for i, test := range []struct {
+		contentType, body      string
+		expectType, expectBody string
+	}{
+		{"application/json", `{"Name": "a", "secret": "x"}`, "application/x-www-form-urlencoded", `name=a`},
+		{"application/json", `not json`, "application/json", `not json`},
+		{"text/html", `<p>hi</p>`, "text/html", `<p>hi</p>`},
+	} {
+		next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if r.Header.Get("Accept-Encoding") != "" {
+				t.Errorf("Test %d: Expected Accept-Encoding to be removed", i)
+			}
+			w.Header().Set("Content-Type", test.contentType)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(test.body))
+			return 0, nil
+		})
+		tr := Transform{Next: next, Rules: []Rule{{Path: "/api", Response: []Op{
+			{Action: "rename", Field: "Name", Arg: "name"},
+			{Action: "remove", Field: "secret"},
+			{Action: "to_form"},
+		}}}}
+		r := httptest.NewRequest("GET", "/api/users", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+
+		tr.ServeHTTP(w, r)
+		if w.Code != http.StatusCreated {
+			t.Errorf("Test %d: Expected status %d, got %d", i, http.StatusCreated, w.Code)
+		}
+		if got := w.Header().Get("Content-Type"); got != test.expectType {
+			t.Errorf("Test %d: Expected content type '%s', got '%s'", i, test.expectType, got)
+		}
+		if got := w.Body.String(); got != test.expectBody {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.expectBody, got)
+		}
+	}
+}
+
+func TestTransformLargeResponse(t *testing.T) {
+	body := `{"a": "` + strings.Repeat("x", maxBodySize) + `"}`
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body[:10]))
+		w.Write([]byte(body[10:]))
+		return 0, nil
+	})
+	tr := Transform{Next: next, Rules: []Rule{{Path: "/", Response: []Op{{Action: "remove", Field: "a"}}}}}
+	w := httptest.NewRecorder()
+
+	tr.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Body.String() != body {
+		t.Errorf("Expected response too large to transform to be written as it is")
+	}
+}
@@ -0,0 +1,458 @@
+package tunnel
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Relay is the public end of tunnels. Clients connect to its
+// tunnel listener and register a hostname; connections made to
+// its HTTP and HTTPS listeners are routed to the client for the
+// hostname in the Host header or TLS ServerName, respectively.
+// The relay does not terminate TLS: certificates are obtained
+// and used by the clients. A hostname belongs to the first client
+// that registers it for as long as that client stays connected.
+type Relay struct {
+	// Token must be presented by clients. It may only
+	// be empty if Open is true.
+	Token string
+
+	// Open lets clients register without a token.
+	Open bool
+
+	// Domain, if not empty, restricts the hostnames clients
+	// may register to subdomains of it.
+	Domain string
+
+	// MaxIdle is the maximum number of idle connections to
+	// keep for each hostname; 0 means DefaultMaxIdle.
+	MaxIdle int
+
+	mu        sync.Mutex
+	idle      map[string][]*tunnelConn // keyed by hostname; newest last
+	owners    map[string]*owner        // keyed by hostname
+	listeners []net.Listener
+	closed    bool
+}
+
+// owner is the client a hostname belongs to.
+type owner struct {
+	client string // the ID the client registered with
+	conns  int    // open tunnel connections of the client
+}
+
+// tunnelConn is a tunnel connection registered for host.
+type tunnelConn struct {
+	net.Conn
+	host    string
+	watched chan struct{} // closed once watch returns
+	broken  bool          // set by watch if the client hung up
+}
+
+// Serve accepts tunnel connections from clients on tunnelLn and
+// public connections on httpLn and httpsLn, either of which may
+// be nil. It blocks until one of the listeners fails or the relay
+// is closed.
+func (rl *Relay) Serve(tunnelLn, httpLn, httpsLn net.Listener) error {
+	if rl.Token == "" && !rl.Open {
+		return errors.New("relay needs a token unless it is open")
+	}
+	rl.mu.Lock()
+	if rl.closed {
+		rl.mu.Unlock()
+		return errClosed
+	}
+	if rl.idle == nil {
+		rl.idle = make(map[string][]*tunnelConn)
+		rl.owners = make(map[string]*owner)
+	}
+	errs := make(chan error, 3)
+	serve := func(ln net.Listener, handle func(net.Conn)) {
+		if ln == nil {
+			return
+		}
+		rl.listeners = append(rl.listeners, ln)
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					if ne, ok := err.(net.Error); ok && ne.Temporary() {
+						time.Sleep(100 * time.Millisecond)
+						continue
+					}
+					errs <- err
+					return
+				}
+				go handle(conn)
+			}
+		}()
+	}
+	serve(tunnelLn, rl.register)
+	serve(httpLn, func(conn net.Conn) { rl.route(conn, kindHTTP) })
+	serve(httpsLn, func(conn net.Conn) { rl.route(conn, kindTLS) })
+	rl.mu.Unlock()
+
+	err := <-errs
+	rl.Close()
+	return err
+}
+
+// Close closes the relay's listeners and idle tunnel connections.
+// Connections already routed through a tunnel are not interrupted.
+func (rl *Relay) Close() error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.closed = true
+	for _, ln := range rl.listeners {
+		ln.Close()
+	}
+	rl.listeners = nil
+	for host, conns := range rl.idle {
+		for _, conn := range conns {
+			conn.Close()
+		}
+		delete(rl.idle, host)
+	}
+	for host := range rl.owners {
+		delete(rl.owners, host)
+	}
+	return nil
+}
+
+// register reads the first line of conn, a new tunnel connection,
+// and adds conn to the idle connections of the client's hostname.
+func (rl *Relay) register(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	line, err := readLine(byteReader{conn})
+	if err != nil {
+		conn.Close()
+		return
+	}
+	host, client, err := rl.checkRegistration(line)
+	if err == nil {
+		err = rl.claim(host, client)
+	}
+	if err != nil {
+		fmt.Fprintf(conn, "ERROR %v\n", err)
+		log.Printf("[WARNING] Tunnel from %s: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	tc := &tunnelConn{Conn: conn, host: host, watched: make(chan struct{})}
+	if _, err := io.WriteString(conn, "OK\n"); err != nil {
+		rl.closeTunnel(tc)
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	maxIdle := rl.MaxIdle
+	if maxIdle <= 0 {
+		maxIdle = DefaultMaxIdle
+	}
+	var evicted []*tunnelConn
+	rl.mu.Lock()
+	if rl.closed {
+		rl.mu.Unlock()
+		rl.closeTunnel(tc)
+		return
+	}
+	conns := append(rl.idle[host], tc)
+	for len(conns) > maxIdle {
+		evicted = append(evicted, conns[0])
+		conns = conns[1:]
+	}
+	rl.idle[host] = conns
+	rl.mu.Unlock()
+
+	go rl.watch(tc)
+	for _, old := range evicted {
+		rl.closeTunnel(old)
+	}
+}
+
+// claim counts a new tunnel connection of client for host, unless
+// host belongs to another client.
+func (rl *Relay) claim(host, client string) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.closed {
+		return errClosed
+	}
+	o := rl.owners[host]
+	if o == nil {
+		o = &owner{client: client}
+		rl.owners[host] = o
+	}
+	if subtle.ConstantTimeCompare([]byte(o.client), []byte(client)) != 1 {
+		return fmt.Errorf("hostname %s belongs to another client", host)
+	}
+	o.conns++
+	return nil
+}
+
+// closeTunnel closes tc, which is no longer idle, and frees its
+// hostname if it was the last connection of the hostname's client.
+func (rl *Relay) closeTunnel(tc *tunnelConn) {
+	tc.Close()
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if o := rl.owners[tc.host]; o != nil {
+		if o.conns--; o.conns <= 0 {
+			delete(rl.owners, tc.host)
+		}
+	}
+}
+
+// watch waits for tc, an idle tunnel connection, to be closed by
+// the client, which sends nothing until the connection is used,
+// and discards it if so. takeIdle interrupts watch by setting a
+// read deadline.
+func (rl *Relay) watch(tc *tunnelConn) {
+	var b [1]byte
+	_, err := tc.Read(b[:])
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		tc.broken = true
+	}
+	close(tc.watched)
+
+	rl.mu.Lock()
+	idle := rl.idle[tc.host]
+	for i, conn := range idle {
+		if conn == tc {
+			rl.idle[tc.host] = append(idle[:i:i], idle[i+1:]...)
+			rl.mu.Unlock()
+			rl.closeTunnel(tc)
+			return
+		}
+	}
+	rl.mu.Unlock()
+}
+
+// checkRegistration parses line, the first line sent by a client,
+// and returns the hostname to register and the ID of the client
+// if the client may do so.
+func (rl *Relay) checkRegistration(line string) (host, client string, err error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != protocolVersion {
+		return "", "", errors.New("unsupported protocol")
+	}
+	if len(fields) < 3 || len(fields) > 4 {
+		return "", "", errors.New("malformed registration")
+	}
+	host, client = strings.ToLower(fields[1]), fields[2]
+	var token string
+	if len(fields) == 4 {
+		token = fields[3]
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(rl.Token)) != 1 {
+		return "", "", errors.New("invalid token")
+	}
+	if host == "" || strings.ContainsAny(host, "/:*") {
+		return "", "", fmt.Errorf("invalid hostname %q", host)
+	}
+	if rl.Domain != "" && !strings.HasSuffix(host, "."+strings.ToLower(rl.Domain)) {
+		return "", "", fmt.Errorf("hostname %s is not under %s", host, rl.Domain)
+	}
+	return host, client, nil
+}
+
+// route finds out which hostname conn, a public connection of the
+// given kind, is for and hands it to a client over a tunnel.
+func (rl *Relay) route(conn net.Conn, kind string) {
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	rec := &recordingConn{Conn: conn}
+	var host string
+	if kind == kindTLS {
+		host = sniffServerName(rec)
+	} else {
+		host = sniffHost(rec)
+	}
+	conn.SetReadDeadline(time.Time{})
+	if host == "" {
+		return
+	}
+
+	tunnel := rl.takeIdle(host, kind, conn)
+	if tunnel == nil {
+		if kind == kindHTTP {
+			io.WriteString(conn, noTunnelResponse)
+		}
+		return
+	}
+	defer rl.closeTunnel(tunnel)
+
+	// replay what was read while looking for the hostname,
+	// then copy in both directions until either side is done
+	if _, err := tunnel.Write(rec.buf); err != nil {
+		return
+	}
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(tunnel, conn)
+		if cw, ok := tunnel.Conn.(closeWriter); ok {
+			cw.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, tunnel)
+		if cw, ok := conn.(closeWriter); ok {
+			cw.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+// takeIdle removes an idle tunnel connection for host and tells
+// the client it is being used for conn, a connection of the given
+// kind, and where conn comes from, in a PROXY protocol header.
+// Connections the client does not confirm are discarded. It
+// returns nil if there is no usable tunnel for host.
+func (rl *Relay) takeIdle(host, kind string, conn net.Conn) *tunnelConn {
+	host = strings.ToLower(host)
+	for {
+		rl.mu.Lock()
+		conns := rl.idle[host]
+		if len(conns) == 0 {
+			rl.mu.Unlock()
+			return nil
+		}
+		tunnel := conns[len(conns)-1]
+		rl.idle[host] = conns[:len(conns)-1]
+		rl.mu.Unlock()
+
+		// stop watching the connection before using it
+		tunnel.SetReadDeadline(time.Now())
+		<-tunnel.watched
+		if tunnel.broken {
+			rl.closeTunnel(tunnel)
+			continue
+		}
+
+		tunnel.SetDeadline(time.Now().Add(handshakeTimeout))
+		_, err := io.WriteString(tunnel, kind+"\n"+proxyHeader(conn.RemoteAddr(), conn.LocalAddr()))
+		if err == nil {
+			var line string
+			line, err = readLine(byteReader{tunnel})
+			if err == nil && line != "OK" {
+				err = fmt.Errorf("unexpected confirmation %q", line)
+			}
+		}
+		if err != nil {
+			rl.closeTunnel(tunnel)
+			continue
+		}
+		tunnel.SetDeadline(time.Time{})
+		return tunnel
+	}
+}
+
+// proxyHeader returns a PROXY protocol (version 1) header
+// for a TCP connection from src to dst.
+func proxyHeader(src, dst net.Addr) string {
+	s, ok1 := src.(*net.TCPAddr)
+	d, ok2 := dst.(*net.TCPAddr)
+	if !ok1 || !ok2 {
+		return "PROXY UNKNOWN\r\n"
+	}
+	proto := "TCP4"
+	if s.IP.To4() == nil && d.IP.To4() == nil {
+		proto = "TCP6"
+	} else if s.IP.To4() == nil || d.IP.To4() == nil {
+		return "PROXY UNKNOWN\r\n"
+	}
+	return fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, s.IP, d.IP, s.Port, d.Port)
+}
+
+// sniffServerName reads the TLS ClientHello from conn and returns
+// the ServerName in it, or "" if there is none.
+func sniffServerName(conn net.Conn) string {
+	var name string
+	tls.Server(conn, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name = hello.ServerName
+			return nil, errSniffed
+		},
+	}).Handshake()
+	return name
+}
+
+// sniffHost reads the head of an HTTP request from conn and
+// returns the hostname in its Host header, or "" if there is none.
+func sniffHost(conn net.Conn) string {
+	req, err := http.ReadRequest(bufio.NewReader(io.LimitReader(conn, maxSniffBytes)))
+	if err != nil {
+		return ""
+	}
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host
+}
+
+// recordingConn is a net.Conn that records what is read from it
+// and discards what is written to it, so that a connection can be
+// inspected without affecting it.
+type recordingConn struct {
+	net.Conn
+	buf []byte
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.buf = append(c.buf, p[:n]...)
+	return n, err
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// byteReader reads one byte at a time from a connection, so that
+// nothing past the end of a line is consumed.
+type byteReader struct {
+	io.Reader
+}
+
+func (r byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(r.Reader, b[:])
+	return b[0], err
+}
+
+// closeWriter is a connection that can be half-closed.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// DefaultMaxIdle is the default maximum number of idle
+// tunnel connections the relay keeps for each hostname.
+const DefaultMaxIdle = 32
+
+// maxSniffBytes is the most that is read from an HTTP
+// connection to find its Host header.
+const maxSniffBytes = 16 * 1024
+
+var errSniffed = errors.New("server name sniffed")
+
+const noTunnelResponse = "HTTP/1.1 502 Bad Gateway\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Connection: close\r\n" +
+	"Content-Length: 25\r\n" +
+	"\r\n" +
+	"No tunnel for this host.\n"
@@ -0,0 +1,126 @@
+package tunnel
+
+import (
+	"crypto/tls"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddytls"
+)
+
+func init() {
+	caddy.RegisterPlugin("tunnel", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup connects the site to a relay. Syntax:
+//
+//	tunnel relay[:port] {
+//	    token       secret
+//	    connections count
+//	    tls         [insecure]
+//	}
+//
+// The relay routes connections for the site's hostname to this
+// process. The tunnel is opened during setup so that certificates
+// can be obtained through it.
+func setup(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+
+	client, err := parseTunnel(c)
+	if err != nil {
+		return err
+	}
+
+	client.Hostname = config.Addr.Host
+	if client.Hostname == "" || strings.Contains(client.Hostname, "*") {
+		return c.Errf("tunnel needs a site with a specific hostname, not '%s'", config.Addr.Host)
+	}
+	if config.TLS != nil {
+		client.ChallengeHost = config.TLS.ListenHost
+		client.ChallengePort = config.TLS.AltHTTPPort
+	}
+	if client.ChallengePort == "" {
+		client.ChallengePort = caddytls.DefaultHTTPAlternatePort
+	}
+
+	err = client.Start(startTimeout)
+	if err != nil {
+		return err
+	}
+	c.OnShutdown(client.Close)
+
+	config.AddListener(client.Listen)
+
+	return nil
+}
+
+func parseTunnel(c *caddy.Controller) (*Client, error) {
+	client := &Client{Conns: defaultConns}
+
+	for c.Next() {
+		if client.Relay != "" {
+			return nil, c.Err("tunnel can only be specified once per site")
+		}
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return nil, c.ArgErr()
+		}
+		client.Relay = args[0]
+		if _, _, err := net.SplitHostPort(client.Relay); err != nil {
+			client.Relay = net.JoinHostPort(client.Relay, DefaultRelayPort)
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "token":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				client.Token = c.Val()
+			case "connections":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n, err := strconv.Atoi(c.Val())
+				if err != nil || n < 1 {
+					return nil, c.Errf("invalid number of connections '%s'", c.Val())
+				}
+				client.Conns = n
+			case "tls":
+				client.RelayTLS = new(tls.Config)
+				args := c.RemainingArgs()
+				switch {
+				case len(args) == 0:
+				case len(args) == 1 && args[0] == "insecure":
+					client.RelayTLS.InsecureSkipVerify = true
+				default:
+					return nil, c.ArgErr()
+				}
+				continue
+			default:
+				return nil, c.Errf("unknown tunnel property '%s'", c.Val())
+			}
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+		}
+	}
+
+	return client, nil
+}
+
+// DefaultRelayPort is the port of the relay's
+// tunnel listener if none is given.
+const DefaultRelayPort = "4443"
+
+const (
+	defaultConns = 4
+	startTimeout = 30 * time.Second
+)
@@ -0,0 +1,80 @@
+package tunnel
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+)
+
+func TestParseTunnel(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		relay     string
+		token     string
+		conns     int
+		tls       bool
+		insecure  bool
+	}{
+		{`tunnel relay.example.com`, false, "relay.example.com:4443", "", defaultConns, false, false},
+		{`tunnel relay.example.com:9000`, false, "relay.example.com:9000", "", defaultConns, false, false},
+		{`tunnel relay.example.com {
+			token secret
+			connections 8
+		}`, false, "relay.example.com:4443", "secret", 8, false, false},
+		{`tunnel relay.example.com {
+			tls
+		}`, false, "relay.example.com:4443", "", defaultConns, true, false},
+		{`tunnel relay.example.com {
+			tls insecure
+		}`, false, "relay.example.com:4443", "", defaultConns, true, true},
+		{`tunnel`, true, "", "", 0, false, false},
+		{`tunnel a b`, true, "", "", 0, false, false},
+		{`tunnel relay.example.com {
+			connections 0
+		}`, true, "", "", 0, false, false},
+		{`tunnel relay.example.com {
+			token
+		}`, true, "", "", 0, false, false},
+		{`tunnel relay.example.com {
+			token a b
+		}`, true, "", "", 0, false, false},
+		{`tunnel relay.example.com {
+			tls verify
+		}`, true, "", "", 0, false, false},
+		{`tunnel relay.example.com {
+			foo
+		}`, true, "", "", 0, false, false},
+		{"tunnel a\ntunnel b", true, "", "", 0, false, false},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("http", test.input)
+		client, err := parseTunnel(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got: %v", i, err)
+			continue
+		}
+		if client.Relay != test.relay {
+			t.Errorf("Test %d: expected relay %s, got %s", i, test.relay, client.Relay)
+		}
+		if client.Token != test.token {
+			t.Errorf("Test %d: expected token %s, got %s", i, test.token, client.Token)
+		}
+		if client.Conns != test.conns {
+			t.Errorf("Test %d: expected %d connections, got %d", i, test.conns, client.Conns)
+		}
+		if got := client.RelayTLS != nil; got != test.tls {
+			t.Errorf("Test %d: expected TLS to relay to be %v, got %v", i, test.tls, got)
+		}
+		if test.tls && client.RelayTLS.InsecureSkipVerify != test.insecure {
+			t.Errorf("Test %d: expected insecure to be %v", i, test.insecure)
+		}
+	}
+}
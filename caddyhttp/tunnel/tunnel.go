@@ -0,0 +1,452 @@
+// Package tunnel serves sites through an outbound tunnel to a
+// relay, so that a machine without a public address (for example,
+// one behind NAT) can serve a site, including obtaining and using
+// certificates, without any port forwarding. The relay is run
+// separately; see Relay and the caddyrelay command.
+package tunnel
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/internal/seal"
+	"github.com/mholt/caddy/caddytls"
+)
+
+// Client keeps a pool of idle connections open to a relay. When
+// somebody connects to the relay for Hostname, the relay hands the
+// connection to the client over one of the idle connections, and
+// the client replaces it with a fresh one.
+type Client struct {
+	// Relay is the address of the relay's tunnel port.
+	Relay string
+
+	// Hostname is the name the relay routes to this client.
+	Hostname string
+
+	// Token authenticates the client to the relay.
+	Token string
+
+	// Conns is the number of idle connections to keep open.
+	Conns int
+
+	// RelayTLS, if not nil, is used to connect to the relay
+	// over TLS.
+	RelayTLS *tls.Config
+
+	// ChallengeHost and ChallengePort locate the ACME HTTP
+	// challenge solver when it is not on the standard port;
+	// challenge requests that come through the tunnel for
+	// a site served over HTTPS are proxied to it.
+	ChallengeHost, ChallengePort string
+
+	mu        sync.Mutex
+	listening bool        // whether a server is accepting connections
+	tlsConfig *tls.Config // the serving site's TLS config, if any
+	idle      map[net.Conn]struct{}
+	accepted  chan net.Conn
+	plain     *chanListener // plaintext connections we handle ourselves
+	ready     chan struct{} // closed after the first successful handshake
+	readyOnce sync.Once
+	closed    chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// Start connects to the relay and keeps c.Conns idle connections
+// open until c is closed. It returns once the relay has accepted
+// the client, or with an error if it did not do so within timeout.
+func (c *Client) Start(timeout time.Duration) error {
+	if c.Conns < 1 {
+		c.Conns = 1
+	}
+	c.idle = make(map[net.Conn]struct{})
+	c.accepted = make(chan net.Conn)
+	c.ready = make(chan struct{})
+	c.closed = make(chan struct{})
+	c.plain = newChanListener(c.closed)
+	go http.Serve(c.plain, http.HandlerFunc(c.servePlaintext))
+
+	errs := make(chan error, c.Conns)
+	for i := 0; i < c.Conns; i++ {
+		c.wg.Add(1)
+		go c.worker(errs)
+	}
+
+	select {
+	case <-c.ready:
+		return nil
+	case err := <-errs:
+		c.Close()
+		return err
+	case <-time.After(timeout):
+		c.Close()
+		return fmt.Errorf("tunnel to %s: timed out connecting to relay", c.Relay)
+	}
+}
+
+// Listen returns a listener on which connections that come through
+// the tunnel are accepted. If tlsConfig is not nil, TLS connections
+// are accepted and their handshake is performed with it, while
+// plaintext connections are redirected to HTTPS (after solving any
+// ACME challenge). Otherwise only plaintext connections are accepted.
+func (c *Client) Listen(tlsConfig *tls.Config) (net.Listener, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.listening {
+		return nil, fmt.Errorf("tunnel to %s: already listening", c.Relay)
+	}
+	c.listening = true
+	c.tlsConfig = tlsConfig
+	return &listener{client: c, closed: make(chan struct{})}, nil
+}
+
+// Close disconnects c from the relay.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.mu.Lock()
+		for conn := range c.idle {
+			conn.Close()
+		}
+		c.mu.Unlock()
+	})
+	c.wg.Wait()
+	return nil
+}
+
+// worker keeps one idle connection open to the relay at a time.
+// Errors are sent on errs until the client has connected once.
+func (c *Client) worker(errs chan<- error) {
+	defer c.wg.Done()
+	backoff := minBackoff
+	for {
+		conn, kind, err := c.waitForConn()
+		select {
+		case <-c.closed:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		default:
+		}
+		if err != nil {
+			select {
+			case <-c.ready:
+				log.Printf("[ERROR] Tunnel to %s: %v; retrying in %v", c.Relay, err, backoff)
+			default:
+				if _, ok := err.(relayError); ok {
+					errs <- err // the relay refused us; don't wait for the timeout
+					return
+				}
+			}
+			select {
+			case <-time.After(backoff):
+			case <-c.closed:
+				return
+			}
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		backoff = minBackoff
+		go c.dispatch(kind, conn)
+	}
+}
+
+// waitForConn dials the relay, registers with it, and waits until
+// the relay uses the connection for a client. It returns the
+// connection, whose RemoteAddr is that of the client, and the
+// kind of client connection it carries.
+func (c *Client) waitForConn() (net.Conn, string, error) {
+	var conn net.Conn
+	var err error
+	if c.RelayTLS != nil {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", c.Relay, c.RelayTLS)
+	} else {
+		conn, err = net.DialTimeout("tcp", c.Relay, dialTimeout)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	c.mu.Lock()
+	select {
+	case <-c.closed:
+		c.mu.Unlock()
+		conn.Close()
+		return nil, "", errClosed
+	default:
+	}
+	c.idle[conn] = struct{}{}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.idle, conn)
+		c.mu.Unlock()
+	}()
+
+	br := bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	_, err = fmt.Fprintf(conn, "%s %s %s %s\n", protocolVersion, c.Hostname, clientID, c.Token)
+	if err != nil {
+		conn.Close()
+		return nil, "", err
+	}
+	line, err := readLine(br)
+	if err != nil {
+		conn.Close()
+		return nil, "", err
+	}
+	if line != "OK" {
+		conn.Close()
+		return nil, "", relayError(fmt.Sprintf("tunnel to %s: relay refused %s: %s",
+			c.Relay, c.Hostname, strings.TrimPrefix(line, "ERROR ")))
+	}
+	conn.SetDeadline(time.Time{})
+	c.readyOnce.Do(func() { close(c.ready) })
+
+	// wait for the relay to hand us a client, then confirm
+	kind, err := readLine(br)
+	if err != nil {
+		conn.Close()
+		return nil, "", err
+	}
+	if kind != kindTLS && kind != kindHTTP {
+		conn.Close()
+		return nil, "", fmt.Errorf("unexpected message from relay: %q", kind)
+	}
+	line, err = readLine(br)
+	if err != nil {
+		conn.Close()
+		return nil, "", err
+	}
+	remote, err := parseProxyHeader(line)
+	if err != nil {
+		conn.Close()
+		return nil, "", err
+	}
+	_, err = io.WriteString(conn, "OK\n")
+	if err != nil {
+		conn.Close()
+		return nil, "", err
+	}
+	return bufferedConn{Conn: conn, r: br, remote: remote}, kind, nil
+}
+
+// parseProxyHeader parses line, a PROXY protocol (version 1)
+// header, and returns the source address in it, which is nil
+// if the relay does not know it.
+func parseProxyHeader(line string) (net.Addr, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 2 && fields[0] == "PROXY" && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || fields[0] != "PROXY" || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed PROXY header from relay: %q", line)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("malformed PROXY header from relay: %q", line)
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// dispatch hands conn, a client connection of the given kind, to
+// whoever should serve it.
+func (c *Client) dispatch(kind string, conn net.Conn) {
+	c.mu.Lock()
+	listening, tlsConfig := c.listening, c.tlsConfig
+	c.mu.Unlock()
+
+	switch {
+	case kind == kindTLS && listening && tlsConfig != nil:
+		c.accept(tls.Server(conn, tlsConfig))
+	case kind == kindHTTP && listening && tlsConfig == nil:
+		c.accept(conn)
+	case kind == kindHTTP:
+		c.plain.deliver(conn)
+	default:
+		conn.Close()
+	}
+}
+
+// accept passes conn on to the listener.
+func (c *Client) accept(conn net.Conn) {
+	select {
+	case c.accepted <- conn:
+	case <-c.closed:
+		conn.Close()
+	}
+}
+
+// servePlaintext serves plaintext requests that came through the
+// tunnel for a site that is served over HTTPS: ACME challenges are
+// proxied to the solver and everything else is redirected.
+func (c *Client) servePlaintext(w http.ResponseWriter, r *http.Request) {
+	port := caddytls.HTTPChallengePort
+	if caddy.HasListenerWithAddress(net.JoinHostPort(c.ChallengeHost, caddytls.HTTPChallengePort)) {
+		// the solver is not on the standard port if something else is
+		port = c.ChallengePort
+	}
+	if caddytls.HTTPChallengeHandler(w, r, port) {
+		return
+	}
+	w.Header().Set("Connection", "close")
+	http.Redirect(w, r, "https://"+c.Hostname+r.RequestURI, http.StatusMovedPermanently)
+}
+
+// listener is a net.Listener that accepts connections
+// that came through the tunnel.
+type listener struct {
+	client    *Client
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Accept waits for the next connection through the tunnel.
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.client.accepted:
+		return conn, nil
+	case <-l.closed:
+		return nil, errClosed
+	case <-l.client.closed:
+		return nil, errClosed
+	}
+}
+
+// Close stops accepting connections. Connections that come
+// through the tunnel afterward wait until the next Listen.
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		l.client.mu.Lock()
+		l.client.listening = false
+		l.client.tlsConfig = nil
+		l.client.mu.Unlock()
+	})
+	return nil
+}
+
+// Addr returns the address of the relay.
+func (l *listener) Addr() net.Addr {
+	return tunnelAddr(l.client.Hostname + " via " + l.client.Relay)
+}
+
+// chanListener is a net.Listener that accepts
+// connections delivered to it.
+type chanListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+}
+
+func newChanListener(closed chan struct{}) *chanListener {
+	return &chanListener{conns: make(chan net.Conn), closed: closed}
+}
+
+func (l *chanListener) deliver(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+func (l *chanListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, errClosed
+	}
+}
+
+func (l *chanListener) Close() error   { return nil }
+func (l *chanListener) Addr() net.Addr { return tunnelAddr("tunnel") }
+
+// bufferedConn is a net.Conn that reads from r first,
+// which buffers reads from the connection, and whose
+// remote address is remote, if not nil.
+type bufferedConn struct {
+	net.Conn
+	r      *bufio.Reader
+	remote net.Addr
+}
+
+func (c bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c bufferedConn) RemoteAddr() net.Addr {
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// tunnelAddr is the net.Addr of tunnel listeners.
+type tunnelAddr string
+
+func (a tunnelAddr) Network() string { return "tunnel" }
+func (a tunnelAddr) String() string  { return string(a) }
+
+// relayError is an error reported by the relay.
+type relayError string
+
+func (e relayError) Error() string { return string(e) }
+
+// readLine reads a newline-terminated line of at most
+// maxLineLength bytes from br, without the newline.
+func readLine(br io.ByteReader) (string, error) {
+	var line []byte
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == '\n' {
+			return strings.TrimSuffix(string(line), "\r"), nil
+		}
+		if len(line) >= maxLineLength {
+			return "", errors.New("line too long")
+		}
+		line = append(line, b)
+	}
+}
+
+// clientID identifies this process to relays, which give a
+// hostname to the first client that registers it. It stays
+// the same when a site's client is replaced on reload.
+var clientID = seal.RandomString(16)
+
+// errClosed is returned by listeners after they are closed.
+var errClosed = errors.New("use of closed network connection")
+
+const (
+	// protocolVersion starts the first line a client sends to the relay.
+	protocolVersion = "CADDY-TUNNEL/1"
+
+	// The kinds of client connections the relay hands over.
+	kindTLS  = "TLS"
+	kindHTTP = "HTTP"
+
+	maxLineLength    = 1024
+	dialTimeout      = 10 * time.Second
+	handshakeTimeout = 10 * time.Second
+	minBackoff       = 1 * time.Second
+	maxBackoff       = 1 * time.Minute
+)
@@ -0,0 +1,269 @@
+package tunnel
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startRelay starts a relay on loopback listeners and
+// returns it with the addresses of its listeners.
+func startRelay(t *testing.T, relay *Relay) (tunnelAddr, httpAddr, httpsAddr string) {
+	var lns []net.Listener
+	for i := 0; i < 3; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lns = append(lns, ln)
+	}
+	go relay.Serve(lns[0], lns[1], lns[2])
+	return lns[0].Addr().String(), lns[1].Addr().String(), lns[2].Addr().String()
+}
+
+func TestTunnelHTTP(t *testing.T) {
+	relay := &Relay{Token: "secret"}
+	tunnelAddr, httpAddr, _ := startRelay(t, relay)
+	defer relay.Close()
+
+	client := &Client{Relay: tunnelAddr, Hostname: "example.com", Token: "secret", Conns: 2}
+	if err := client.Start(5 * time.Second); err != nil {
+		t.Fatalf("Expected no error starting client, got: %v", err)
+	}
+	defer client.Close()
+
+	ln, err := client.Listen(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Remote-Addr", r.RemoteAddr)
+		w.Write([]byte("hello " + r.Host + r.URL.Path))
+	}))
+
+	for i := 0; i < 5; i++ {
+		body, status := get(t, "http://"+httpAddr+"/foo", "example.com")
+		if status != http.StatusOK || body != "hello example.com/foo" {
+			t.Errorf("Request %d: expected 200 and greeting, got %d: %s", i, status, body)
+		}
+	}
+
+	_, status := get(t, "http://"+httpAddr+"/foo", "other.example.com")
+	if status != http.StatusBadGateway {
+		t.Errorf("Expected %d for unknown host, got %d", http.StatusBadGateway, status)
+	}
+
+	// the site sees the address of the client, not of the relay
+	conn, err := net.Dial("tcp", httpAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got, want := resp.Header.Get("X-Remote-Addr"), conn.LocalAddr().String(); got != want {
+		t.Errorf("Expected remote address %s, got %s", want, got)
+	}
+}
+
+func TestTunnelTLS(t *testing.T) {
+	relay := &Relay{Open: true}
+	tunnelAddr, httpAddr, httpsAddr := startRelay(t, relay)
+	defer relay.Close()
+
+	client := &Client{Relay: tunnelAddr, Hostname: "example.com"}
+	if err := client.Start(5 * time.Second); err != nil {
+		t.Fatalf("Expected no error starting client, got: %v", err)
+	}
+	defer client.Close()
+
+	// borrow the test server's certificate, which is for example.com
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	ts.Close()
+	ln, err := client.Listen(&tls.Config{Certificates: ts.TLS.Certificates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure " + r.Host))
+	}))
+
+	httpClient := ts.Client()
+	httpClient.Transport.(*http.Transport).TLSClientConfig.ServerName = "example.com"
+	resp, err := httpClient.Get("https://" + httpsAddr + "/")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.HasPrefix(string(body), "secure ") {
+		t.Errorf("Expected response from site, got: %s", body)
+	}
+
+	// plaintext requests are redirected to HTTPS
+	_, status := get(t, "http://"+httpAddr+"/path?q", "example.com")
+	if status != http.StatusMovedPermanently {
+		t.Errorf("Expected redirect, got %d", status)
+	}
+}
+
+func TestTunnelRefused(t *testing.T) {
+	relay := &Relay{Token: "secret", Domain: "example.com"}
+	tunnelAddr, _, _ := startRelay(t, relay)
+	defer relay.Close()
+
+	for i, client := range []*Client{
+		{Relay: tunnelAddr, Hostname: "a.example.com", Token: "wrong"},
+		{Relay: tunnelAddr, Hostname: "example.org", Token: "secret"},
+	} {
+		if err := client.Start(5 * time.Second); err == nil {
+			t.Errorf("Test %d: expected relay to refuse client", i)
+			client.Close()
+		}
+	}
+}
+
+func TestRelayNeedsToken(t *testing.T) {
+	relay := &Relay{}
+	if err := relay.Serve(nil, nil, nil); err == nil {
+		t.Error("Expected relay without token to refuse to start")
+	}
+}
+
+func TestTunnelHostnameTaken(t *testing.T) {
+	relay := &Relay{Token: "secret"}
+	tunnelAddr, _, _ := startRelay(t, relay)
+	defer relay.Close()
+
+	client := &Client{Relay: tunnelAddr, Hostname: "example.com", Token: "secret"}
+	if err := client.Start(5 * time.Second); err != nil {
+		t.Fatalf("Expected no error starting client, got: %v", err)
+	}
+
+	// another client with the token can't take over the hostname...
+	if reply := register(t, tunnelAddr, "example.com other secret"); !strings.HasPrefix(reply, "ERROR") {
+		t.Errorf("Expected hostname of connected client to be refused, got: %s", reply)
+	}
+
+	// ...until the client that has it disconnects
+	client.Close()
+	var reply string
+	for i := 0; i < 50; i++ {
+		if reply = register(t, tunnelAddr, "example.com other secret"); reply == "OK" {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if reply != "OK" {
+		t.Errorf("Expected hostname to be free after client disconnected, got: %s", reply)
+	}
+}
+
+func TestProxyHeader(t *testing.T) {
+	for i, test := range []struct {
+		src, dst net.Addr
+		header   string
+	}{
+		{&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5000}, &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 80},
+			"PROXY TCP4 192.0.2.1 192.0.2.2 5000 80\r\n"},
+		{&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 5000}, &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443},
+			"PROXY TCP6 2001:db8::1 2001:db8::2 5000 443\r\n"},
+		{&net.UnixAddr{Name: "/tmp/sock", Net: "unix"}, &net.UnixAddr{Name: "/tmp/sock", Net: "unix"},
+			"PROXY UNKNOWN\r\n"},
+	} {
+		header := proxyHeader(test.src, test.dst)
+		if header != test.header {
+			t.Errorf("Test %d: expected header %q, got %q", i, test.header, header)
+		}
+		addr, err := parseProxyHeader(strings.TrimSuffix(header, "\r\n"))
+		if err != nil {
+			t.Errorf("Test %d: expected no error parsing header, got: %v", i, err)
+		}
+		if _, ok := test.src.(*net.TCPAddr); ok && (addr == nil || addr.String() != test.src.String()) {
+			t.Errorf("Test %d: expected address %s, got %v", i, test.src, addr)
+		}
+	}
+
+	for _, line := range []string{"", "PROXY", "PROXY TCP4 a b 1 2", "PROXY TCP4 192.0.2.1 192.0.2.2 x 80", "HTTP"} {
+		if _, err := parseProxyHeader(line); err == nil {
+			t.Errorf("Expected error parsing %q", line)
+		}
+	}
+}
+
+func TestCheckRegistration(t *testing.T) {
+	relay := &Relay{Open: true, Domain: "Example.com"}
+	for i, test := range []struct {
+		line      string
+		host      string
+		shouldErr bool
+	}{
+		{"CADDY-TUNNEL/1 a.example.com id", "a.example.com", false},
+		{"CADDY-TUNNEL/1 A.Example.COM id", "a.example.com", false},
+		{"CADDY-TUNNEL/1 a.example.com id token", "", true},
+		{"CADDY-TUNNEL/1 a.example.com", "", true},
+		{"CADDY-TUNNEL/1 example.com id", "", true},
+		{"CADDY-TUNNEL/1 a.example.org id", "", true},
+		{"CADDY-TUNNEL/1 *.example.com id", "", true},
+		{"CADDY-TUNNEL/2 a.example.com id", "", true},
+		{"CADDY-TUNNEL/1", "", true},
+		{"", "", true},
+	} {
+		host, _, err := relay.checkRegistration(test.line)
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: expected error %v, got: %v", i, test.shouldErr, err)
+		}
+		if host != test.host {
+			t.Errorf("Test %d: expected host %s, got %s", i, test.host, host)
+		}
+	}
+}
+
+// register registers with the relay at addr as a client would,
+// sending the protocol version and fields, and returns the reply.
+func register(t *testing.T, addr, fields string) string {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte(protocolVersion + " " + fields + "\n"))
+	reply, _ := readLine(bufio.NewReader(conn))
+	return reply
+}
+
+func get(t *testing.T, url, host string) (string, int) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = host
+	// a fresh transport for every request, since the relay
+	// routes connections, not requests
+	client := &http.Client{
+		Transport: &http.Transport{},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request for %s: %v", host, err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return string(body), resp.StatusCode
+}
@@ -0,0 +1,107 @@
+package vars
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("vars", caddy.Plugin{
+		ServerType:    "http",
+		Action:        setup,
+		ReloadInPlace: true,
+	})
+}
+
+// setup configures a new Vars middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := varsParse(c)
+	if err != nil {
+		return err
+	}
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Vars{Next: next, Rules: rules}
+	})
+	return nil
+}
+
+// varsParse parses vars directives. Syntax:
+//
+//	vars name value [match regexp] [default value]
+//
+//	vars [path] {
+//	    name value [match regexp] [default value]
+//	}
+//
+// Each defines the placeholder {name} for requests under path
+// (/ by default). The value may combine placeholders, including
+// the variables defined before it; match extracts the first
+// submatch of the regular expression from it, and default is
+// used if it comes out empty.
+func varsParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+	for c.Next() {
+		rule := Rule{PathScope: "/"}
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			if !strings.HasPrefix(args[0], "/") {
+				return rules, c.Errf("vars: invalid path '%s'", args[0])
+			}
+			rule.PathScope = args[0]
+		default:
+			v, err := parseVar(c, args)
+			if err != nil {
+				return rules, err
+			}
+			rule.Vars = append(rule.Vars, v)
+		}
+		for c.NextBlock() {
+			if len(args) > 1 {
+				return rules, c.ArgErr()
+			}
+			v, err := parseVar(c, append([]string{c.Val()}, c.RemainingArgs()...))
+			if err != nil {
+				return rules, err
+			}
+			rule.Vars = append(rule.Vars, v)
+		}
+		if len(rule.Vars) == 0 {
+			return rules, c.ArgErr()
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseVar(c *caddy.Controller, args []string) (Var, error) {
+	if len(args) < 2 {
+		return Var{}, c.ArgErr()
+	}
+	v := Var{Name: args[0], Value: args[1]}
+	if strings.ContainsAny(v.Name, "{} \t") {
+		return v, c.Errf("vars: invalid name '%s'", v.Name)
+	}
+	for rest := args[2:]; len(rest) > 0; rest = rest[2:] {
+		if len(rest) < 2 {
+			return v, c.ArgErr()
+		}
+		switch rest[0] {
+		case "match":
+			re, err := regexp.Compile(rest[1])
+			if err != nil {
+				return v, c.Errf("vars: invalid regexp '%s': %v", rest[1], err)
+			}
+			v.Match = re
+		case "default":
+			v.Default = rest[1]
+		default:
+			return v, c.Errf("vars: unknown option '%s'", rest[0])
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,84 @@
+package vars
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `vars tenant {label1}`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler, ok := mids[0](httpserver.EmptyNext).(Vars)
+	if !ok {
+		t.Fatalf("Expected handler to be type Vars, got: %#v", mids[0](httpserver.EmptyNext))
+	}
+	if !httpserver.SameNext(handler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestVarsParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{`vars tenant {label1}`, false, []Rule{{PathScope: "/", Vars: []Var{{Name: "tenant", Value: "{label1}"}}}}},
+		{`vars lang {>Accept-Language} default en`, false, []Rule{{PathScope: "/", Vars: []Var{{Name: "lang", Value: "{>Accept-Language}", Default: "en"}}}}},
+		{"vars /users {\n id {path} match ^/users/(\\d+)\n key {host}-{id}\n}", false, []Rule{{PathScope: "/users", Vars: []Var{
+			{Name: "id", Value: "{path}"},
+			{Name: "key", Value: "{host}-{id}"},
+		}}}},
+		{"vars {\n a 1\n}\nvars /b {\n b 2\n}", false, []Rule{
+			{PathScope: "/", Vars: []Var{{Name: "a", Value: "1"}}},
+			{PathScope: "/b", Vars: []Var{{Name: "b", Value: "2"}}},
+		}},
+		{`vars`, true, nil},
+		{`vars tenant`, true, nil},
+		{`vars {tenant} x`, true, nil},
+		{`vars id {path} match (`, true, nil},
+		{`vars id {path} match`, true, nil},
+		{`vars id {path} fallback x`, true, nil},
+		{"vars {\n a\n}", true, nil},
+		{"vars a 1 {\n b 2\n}", true, nil},
+	} {
+		rules, err := varsParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if len(rules) != len(test.expected) {
+			t.Fatalf("Test %d: Expected %d rules, got %d", i, len(test.expected), len(rules))
+		}
+		for j, rule := range rules {
+			expected := test.expected[j]
+			if rule.PathScope != expected.PathScope || len(rule.Vars) != len(expected.Vars) {
+				t.Errorf("Test %d, rule %d: Expected %+v, got %+v", i, j, expected, rule)
+				continue
+			}
+			for k, v := range rule.Vars {
+				e := expected.Vars[k]
+				if v.Name != e.Name || v.Value != e.Value || v.Default != e.Default {
+					t.Errorf("Test %d, var %d: Expected %+v, got %+v", i, k, e, v)
+				}
+			}
+		}
+	}
+	if rules, _ := varsParse(caddy.NewTestController("http", `vars id {path} match ^/u/(\d+)`)); rules[0].Vars[0].Match == nil {
+		t.Error("Expected a match expression")
+	}
+}
@@ -0,0 +1,85 @@
+// Package vars implements user-defined placeholders: values
+// computed from other placeholders for each request, which
+// the middleware after it can use like the built-in ones.
+package vars
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Vars is middleware that sets placeholders for requests
+// matching the path scopes of its rules.
+type Vars struct {
+	Next  httpserver.Handler
+	Rules []Rule
+}
+
+// Rule is the variables set for requests under a path.
+type Rule struct {
+	// Base path of requests the variables are set for
+	PathScope string
+
+	// Variables, in the order they are set
+	Vars []Var
+}
+
+// Var defines the placeholder {Name}.
+type Var struct {
+	Name string
+
+	// Value may contain placeholders, including
+	// those of the variables set before this one
+	Value string
+
+	// Match, if set, extracts the first submatch
+	// from the value, or the whole match if it has
+	// no groups; if it does not match, the value is
+	// empty
+	Match *regexp.Regexp
+
+	// Default is used if the value is empty; it
+	// may contain placeholders
+	Default string
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (v Vars) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var repl httpserver.Replacer
+	for _, rule := range v.Rules {
+		if !httpserver.Path(r.URL.Path).Matches(rule.PathScope) {
+			continue
+		}
+		if repl == nil {
+			repl = httpserver.NewReplacer(r, nil, "")
+		}
+		for _, vr := range rule.Vars {
+			value := vr.Eval(repl)
+			repl.Set(vr.Name, value)
+			r = httpserver.SetRequestPlaceholder(r, vr.Name, value)
+		}
+	}
+	return v.Next.ServeHTTP(w, r)
+}
+
+// Eval returns the value of v, replacing placeholders with repl.
+func (v Var) Eval(repl httpserver.Replacer) string {
+	value := repl.Replace(v.Value)
+	if v.Match != nil {
+		m := v.Match.FindStringSubmatch(value)
+		switch {
+		case m == nil:
+			value = ""
+		case len(m) > 1:
+			value = m[1]
+		default:
+			value = m[0]
+		}
+	}
+	if value == "" {
+		value = repl.Replace(v.Default)
+	}
+	return value
+}
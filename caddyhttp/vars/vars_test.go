@@ -0,0 +1,56 @@
+package vars
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestVars(t *testing.T) {
+	v := Vars{
+		Rules: []Rule{
+			{PathScope: "/", Vars: []Var{
+				{Name: "tenant", Value: "{label1}"},
+				{Name: "lang", Value: "{>Accept-Language}", Match: regexp.MustCompile(`^([a-z]{2})`), Default: "en"},
+			}},
+			{PathScope: "/users", Vars: []Var{
+				{Name: "user_id", Value: "{path}", Match: regexp.MustCompile(`^/users/(\d+)`)},
+				{Name: "key", Value: "{tenant}:{user_id}"},
+			}},
+		},
+	}
+
+	for i, test := range []struct {
+		url, acceptLanguage string
+		expected            map[string]string
+	}{
+		{"http://acme.example.com/", "de-DE,de;q=0.9", map[string]string{"tenant": "acme", "lang": "de"}},
+		{"http://acme.example.com/", "", map[string]string{"tenant": "acme", "lang": "en"}},
+		{"http://acme.example.com/users/42/posts", "", map[string]string{"user_id": "42", "key": "acme:42"}},
+		{"http://acme.example.com/users/me", "", map[string]string{"user_id": "", "key": "acme:"}},
+	} {
+		var got *http.Request
+		v.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			got = r
+			return 0, nil
+		})
+		r := httptest.NewRequest("GET", test.url, nil)
+		if test.acceptLanguage != "" {
+			r.Header.Set("Accept-Language", test.acceptLanguage)
+		}
+		v.ServeHTTP(httptest.NewRecorder(), r)
+		for name, expected := range test.expected {
+			if value, _ := httpserver.RequestPlaceholder(got, name); value != expected {
+				t.Errorf("Test %d: Expected {%s} to be '%s', got '%s'", i, name, expected, value)
+			}
+		}
+		// later middleware sees them in its replacers
+		repl := httpserver.NewReplacer(got, nil, "")
+		if value := repl.Replace("{tenant}"); value != "acme" {
+			t.Errorf("Test %d: Expected replacer to substitute {tenant}, got '%s'", i, value)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Package vhost refines how requests are matched to the site:
+// by a regular expression on the host, and by priority over
+// other sites that match the same request.
+package vhost
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("vhost", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupVHost,
+	})
+}
+
+// setupVHost configures host matching for the site. Syntax:
+//
+//	vhost {
+//	    regexp   pattern
+//	    priority number
+//	}
+//
+// With a regexp, the site only matches hosts that match both its
+// address and pattern. Groups captured by the pattern (or labels
+// matched by wildcards in the address) are available to other
+// directives as {vhost.1}, {vhost.2}, ... and {vhost.name}.
+//
+// Once a site of a server uses vhost, requests that the most specific
+// matching site does not take, by its paths or regexp, fall through to
+// less specific sites; otherwise they are not served by any site.
+func setupVHost(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+
+	for c.Next() {
+		if len(c.RemainingArgs()) > 0 {
+			return c.ArgErr()
+		}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "regexp":
+				if !c.NextArg() {
+					return c.ArgErr()
+				}
+				re, err := regexp.Compile("(?i)" + c.Val())
+				if err != nil {
+					return c.Errf("invalid host regexp: %v", err)
+				}
+				config.HostRegexp = re
+			case "priority":
+				if !c.NextArg() {
+					return c.ArgErr()
+				}
+				n, err := strconv.Atoi(c.Val())
+				if err != nil {
+					return c.Errf("invalid priority '%s'", c.Val())
+				}
+				config.HostPriority = n
+			default:
+				return c.Errf("unknown vhost property '%s'", c.Val())
+			}
+			if c.NextArg() {
+				return c.ArgErr()
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package vhost
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupVHost(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		regexp    string
+		priority  int
+	}{
+		{"vhost {\n}", false, "", 0},
+		{"vhost {\npriority 10\n}", false, "", 10},
+		{"vhost {\npriority -1\n}", false, "", -1},
+		{"vhost {\nregexp ^(?P<app>[a-z]+)\\.\n}", false, `(?i)^(?P<app>[a-z]+)\.`, 0},
+		{"vhost {\nregexp ^api\\.\npriority 5\n}", false, `(?i)^api\.`, 5},
+		{"vhost foo", true, "", 0},
+		{"vhost {\nregexp\n}", true, "", 0},
+		{"vhost {\nregexp (\n}", true, "", 0},
+		{"vhost {\npriority high\n}", true, "", 0},
+		{"vhost {\npriority 1 2\n}", true, "", 0},
+		{"vhost {\nweight 1\n}", true, "", 0},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setupVHost(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		cfg := httpserver.GetConfig(c)
+		var re string
+		if cfg.HostRegexp != nil {
+			re = cfg.HostRegexp.String()
+		}
+		if re != test.regexp {
+			t.Errorf("Test %d: Expected regexp %s, got %s", i, test.regexp, re)
+		}
+		if cfg.HostPriority != test.priority {
+			t.Errorf("Test %d: Expected priority %d, got %d", i, test.priority, cfg.HostPriority)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package wellknown
+
+import (
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("well_known", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new WellKnown middleware instance.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+	files, err := wellKnownParse(c, cfg.Root)
+	if err != nil {
+		return err
+	}
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return WellKnown{Next: next, Files: files}
+	})
+
+	return nil
+}
+
+// wellKnownParse parses the well_known directive, of the form
+//
+//	well_known {
+//	    favicon  [file path]
+//	    robots   text|file path
+//	    security text|file path
+//	}
+//
+// Files are read when the server starts; paths are relative to
+// the site root. Without a file, requests for the favicon are
+// answered with 204 No Content. Without a block, only the favicon
+// is answered.
+func wellKnownParse(c *caddy.Controller, root string) (map[string]File, error) {
+	files := make(map[string]File)
+	now := time.Now()
+
+	for c.Next() {
+		if len(files) > 0 {
+			return files, c.Err("well_known: can only be specified once per site")
+		}
+		if len(c.RemainingArgs()) > 0 {
+			return files, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			name := c.Val()
+			path, ok := Paths[name]
+			if !ok {
+				return files, c.Errf("well_known: unknown file '%s'", name)
+			}
+			if _, dup := files[path]; dup {
+				return files, c.Errf("well_known: duplicate file '%s'", name)
+			}
+			f := File{ContentType: "text/plain; charset=utf-8", ModTime: now}
+
+			args := c.RemainingArgs()
+			switch {
+			case len(args) == 0 && name == "favicon":
+			case len(args) == 1:
+				f.Content = []byte(args[0])
+			case len(args) == 2 && args[0] == "file":
+				where := args[1]
+				if !filepath.IsAbs(where) {
+					if err := httpserver.CheckStaticRoot(c); err != nil {
+						return files, err
+					}
+					where = filepath.Join(root, where)
+				}
+				info, err := os.Stat(where)
+				if err != nil {
+					return files, c.Errf("well_known: %v", err)
+				}
+				if f.Content, err = ioutil.ReadFile(where); err != nil {
+					return files, c.Errf("well_known: %v", err)
+				}
+				f.ModTime = info.ModTime()
+				if ctype := mime.TypeByExtension(filepath.Ext(where)); ctype != "" {
+					f.ContentType = ctype
+				}
+			default:
+				return files, c.ArgErr()
+			}
+			if name == "favicon" && len(args) == 1 {
+				return files, c.Err("well_known: the favicon can only be a file")
+			}
+			files[path] = f
+		}
+
+		if len(files) == 0 {
+			files[Paths["favicon"]] = File{}
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,104 @@
+package wellknown
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `well_known`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	wk, ok := handler.(WellKnown)
+	if !ok {
+		t.Fatalf("Expected handler to be type WellKnown, got: %#v", handler)
+	}
+	if !httpserver.SameNext(wk.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestWellKnownParse(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_well_known")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "security.txt"), []byte("Contact: mailto:security@example.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "favicon.png"), []byte("\x89PNG"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  map[string]string // content by path
+	}{
+		{`well_known`, false, map[string]string{"/favicon.ico": ""}},
+		{`well_known {
+			robots "User-agent: *"
+			security file security.txt
+		}`, false, map[string]string{
+			"/robots.txt":               "User-agent: *",
+			"/.well-known/security.txt": "Contact: mailto:security@example.com\n",
+		}},
+		{`well_known {
+			favicon file favicon.png
+		}`, false, map[string]string{"/favicon.ico": "\x89PNG"}},
+		{`well_known {
+			favicon
+		}`, false, map[string]string{"/favicon.ico": ""}},
+		{`well_known /favicon.ico`, true, nil},
+		{`well_known {
+			favicon "not an icon"
+		}`, true, nil},
+		{`well_known {
+			robots
+		}`, true, nil},
+		{`well_known {
+			robots file missing.txt
+		}`, true, nil},
+		{`well_known {
+			humans "We are people"
+		}`, true, nil},
+		{`well_known {
+			robots "a"
+			robots "b"
+		}`, true, nil},
+		{`well_known
+		well_known`, true, nil},
+	} {
+		files, err := wellKnownParse(caddy.NewTestController("http", test.input), root)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if len(files) != len(test.expected) {
+			t.Errorf("Test %d: Expected %d files, got %d", i, len(test.expected), len(files))
+		}
+		for path, content := range test.expected {
+			if f, ok := files[path]; !ok || string(f.Content) != content {
+				t.Errorf("Test %d: Expected %s to be %q, got %q", i, path, content, f.Content)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Package wellknown provides middleware that answers requests for
+// files that browsers and crawlers ask every site for, such as
+// /favicon.ico and /robots.txt, from memory, so they are not passed
+// on to the backends of sites that only proxy.
+package wellknown
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// WellKnown is middleware that answers requests for its files.
+type WellKnown struct {
+	Next  httpserver.Handler
+	Files map[string]File // by path
+}
+
+// File is the content of a well-known file.
+type File struct {
+	Content     []byte
+	ContentType string
+	ModTime     time.Time
+}
+
+// Paths of the files that can be configured by name.
+var Paths = map[string]string{
+	"favicon":  "/favicon.ico",
+	"robots":   "/robots.txt",
+	"security": "/.well-known/security.txt",
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (wk WellKnown) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	f, ok := wk.Files[r.URL.Path]
+	if !ok {
+		return wk.Next.ServeHTTP(w, r)
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		return http.StatusMethodNotAllowed, nil
+	}
+
+	// a favicon without content tells browsers there is none
+	if f.Content == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return 0, nil
+	}
+	w.Header().Set("Content-Type", f.ContentType)
+	http.ServeContent(w, r, r.URL.Path, f.ModTime, bytes.NewReader(f.Content))
+	return 0, nil
+}
@@ -0,0 +1,58 @@
+package wellknown
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestWellKnown(t *testing.T) {
+	modTime := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	wk := WellKnown{
+		Files: map[string]File{
+			"/favicon.ico": {},
+			"/robots.txt":  {Content: []byte("User-agent: *\nDisallow:\n"), ContentType: "text/plain; charset=utf-8", ModTime: modTime},
+		},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Write([]byte("next"))
+			return 0, nil
+		}),
+	}
+
+	for i, test := range []struct {
+		method, path    string
+		ifModifiedSince string
+		expectedStatus  int
+		expectedBody    string
+	}{
+		{"GET", "/robots.txt", "", http.StatusOK, "User-agent: *\nDisallow:\n"},
+		{"HEAD", "/robots.txt", "", http.StatusOK, ""},
+		{"GET", "/robots.txt", modTime.Format(http.TimeFormat), http.StatusNotModified, ""},
+		{"GET", "/favicon.ico", "", http.StatusNoContent, ""},
+		{"POST", "/robots.txt", "", http.StatusMethodNotAllowed, ""},
+		{"GET", "/.well-known/security.txt", "", http.StatusOK, "next"},
+		{"GET", "/robots.txt/more", "", http.StatusOK, "next"},
+	} {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		if test.ifModifiedSince != "" {
+			req.Header.Set("If-Modified-Since", test.ifModifiedSince)
+		}
+		w := httptest.NewRecorder()
+		status, err := wk.ServeHTTP(w, req)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if status == 0 {
+			status = w.Code
+		}
+		if status != test.expectedStatus || w.Body.String() != test.expectedBody {
+			t.Errorf("Test %d: Expected %d %q, got %d %q", i, test.expectedStatus, test.expectedBody, status, w.Body.String())
+		}
+		if test.expectedBody != "" && test.expectedBody != "next" && w.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+			t.Errorf("Test %d: Expected the type of the file, got %s", i, w.Header().Get("Content-Type"))
+		}
+	}
+}
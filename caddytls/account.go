@@ -0,0 +1,304 @@
+package caddytls
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/xenolf/lego/acme"
+)
+
+// Account describes an ACME account in storage.
+type Account struct {
+	Email          string `json:"email"`
+	URI            string `json:"uri,omitempty"`
+	TermsOfService string `json:"terms_of_service,omitempty"`
+	KeyType        string `json:"key_type"`
+	KeyThumbprint  string `json:"key_thumbprint"`
+}
+
+// userLister is implemented by storage that can
+// list the email addresses of its users.
+type userLister interface {
+	Users() ([]string, error)
+}
+
+// userDeleter is implemented by storage that
+// can delete its users.
+type userDeleter interface {
+	DeleteUser(email string) error
+}
+
+// Accounts returns the accounts with the CA at caURL in
+// storage, by email address. If the storage cannot list
+// its users, only the most recent one is returned.
+func Accounts(caURL string) ([]Account, error) {
+	storage, err := new(Config).StorageFor(caURL)
+	if err != nil {
+		return nil, err
+	}
+	var emails []string
+	if l, ok := storage.(userLister); ok {
+		emails, err = l.Users()
+		if err != nil {
+			return nil, err
+		}
+	} else if email := storage.MostRecentUserEmail(); email != "" {
+		emails = []string{email}
+	}
+	sort.Strings(emails)
+
+	var accounts []Account
+	for _, email := range emails {
+		account, err := loadAccount(storage, email)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", email, err)
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+// UpdateAccountContact changes the contact of the account of
+// email with the CA at caURL to newEmail, and stores the
+// account under newEmail too, so configurations with either
+// email address use it.
+func UpdateAccountContact(caURL, email, newEmail string) error {
+	storage, user, err := storedUser(caURL, email)
+	if err != nil {
+		return err
+	}
+	contact := []string{}
+	if newEmail != "" {
+		contact = []string{"mailto:" + newEmail}
+	}
+	payload := map[string]interface{}{"resource": "reg", "contact": contact}
+	if _, err := acmePost(caURL, user.key, user.Registration.URI, payload); err != nil {
+		return fmt.Errorf("updating contact: %v", err)
+	}
+	user.Email = strings.ToLower(newEmail)
+	return saveUser(storage, user)
+}
+
+// DeactivateAccount deactivates the account of email with the
+// CA at caURL, after which it can no longer be used, and
+// removes it from storage if the storage can delete users.
+func DeactivateAccount(caURL, email string) error {
+	storage, user, err := storedUser(caURL, email)
+	if err != nil {
+		return err
+	}
+	payload := map[string]interface{}{"resource": "reg", "status": "deactivated"}
+	if _, err := acmePost(caURL, user.key, user.Registration.URI, payload); err != nil {
+		return fmt.Errorf("deactivating account: %v", err)
+	}
+	if d, ok := storage.(userDeleter); ok {
+		return d.DeleteUser(user.Email)
+	}
+	return nil
+}
+
+// RolloverAccountKey replaces the key of the account of email
+// with the CA at caURL with a new key of the same type, and
+// stores it once the CA accepted it.
+func RolloverAccountKey(caURL, email string) error {
+	storage, user, err := storedUser(caURL, email)
+	if err != nil {
+		return err
+	}
+	dir, err := acmeDirectory(caURL)
+	if err != nil {
+		return err
+	}
+	if dir.KeyChange == "" {
+		return errors.New("CA does not support key rollover")
+	}
+	newKey, err := newKeyLike(user.key)
+	if err != nil {
+		return err
+	}
+	newJWK, _, _, err := publicJWK(newKey)
+	if err != nil {
+		return err
+	}
+
+	// the request, signed by the old key, carries the
+	// change, signed by the new key, to prove both
+	inner, err := json.Marshal(map[string]interface{}{
+		"resource": "key-change",
+		"account":  user.Registration.URI,
+		"newKey":   newJWK,
+	})
+	if err != nil {
+		return err
+	}
+	change, err := signJWS(newKey, "", inner)
+	if err != nil {
+		return err
+	}
+	payload := struct {
+		Resource string `json:"resource"`
+		*jws
+	}{"key-change", change}
+	if _, err := acmePost(caURL, user.key, dir.KeyChange, payload); err != nil {
+		return fmt.Errorf("rolling over key: %v", err)
+	}
+	user.key = newKey
+	return saveUser(storage, user)
+}
+
+// storedUser loads the user of email with the CA at caURL,
+// which must be registered, and the storage it is in. An
+// empty email means the one of the -email flag, if set,
+// else the most recent user.
+func storedUser(caURL, email string) (Storage, User, error) {
+	storage, err := new(Config).StorageFor(caURL)
+	if err != nil {
+		return nil, User{}, err
+	}
+	if email == "" {
+		email = DefaultEmail
+	}
+	if email == "" {
+		email = storage.MostRecentUserEmail()
+	}
+	data, err := storage.LoadUser(email)
+	if err != nil {
+		if _, ok := err.(ErrNotExist); ok {
+			return nil, User{}, fmt.Errorf("no account for '%s'", email)
+		}
+		return nil, User{}, err
+	}
+	user, err := decodeUser(data)
+	if err != nil {
+		return nil, User{}, err
+	}
+	if user.Registration == nil || user.Registration.URI == "" {
+		return nil, User{}, fmt.Errorf("account for '%s' is not registered", email)
+	}
+	return storage, user, nil
+}
+
+func loadAccount(storage Storage, email string) (Account, error) {
+	data, err := storage.LoadUser(email)
+	if err != nil {
+		return Account{}, err
+	}
+	user, err := decodeUser(data)
+	if err != nil {
+		return Account{}, err
+	}
+	account := Account{Email: user.Email}
+	if user.Registration != nil {
+		account.URI = user.Registration.URI
+		account.TermsOfService = user.Registration.TosURL
+	}
+	switch key := user.key.(type) {
+	case *ecdsa.PrivateKey:
+		account.KeyType = "EC " + key.Curve.Params().Name
+	case *rsa.PrivateKey:
+		account.KeyType = fmt.Sprintf("RSA %d", key.N.BitLen())
+	}
+	account.KeyThumbprint, err = jwkThumbprint(user.key)
+	return account, err
+}
+
+// newKeyLike returns a new key of the type and size of key.
+func newKeyLike(key crypto.PrivateKey) (crypto.PrivateKey, error) {
+	switch key := key.(type) {
+	case *ecdsa.PrivateKey:
+		return ecdsa.GenerateKey(key.Curve, rand.Reader)
+	case *rsa.PrivateKey:
+		return rsa.GenerateKey(rand.Reader, key.N.BitLen())
+	}
+	return nil, errors.New("unsupported private key type")
+}
+
+// directory is the part of the directory of an ACME CA
+// that account management needs.
+type directory struct {
+	KeyChange string `json:"key-change"`
+}
+
+func acmeDirectory(caURL string) (directory, error) {
+	var dir directory
+	resp, err := acmeRequest("GET", caURL, nil)
+	if err != nil {
+		return dir, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return dir, fmt.Errorf("getting directory: %s", resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&dir)
+	return dir, err
+}
+
+// acmePost sends payload, signed by key, to url of the
+// CA at caURL, and returns the body of the response.
+func acmePost(caURL string, key crypto.PrivateKey, url string, payload interface{}) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// every request needs a fresh nonce from the CA
+	resp, err := acmeRequest("HEAD", caURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return nil, errors.New("CA sent no nonce")
+	}
+
+	signed, err := signJWS(key, nonce, body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := json.Marshal(signed)
+	if err != nil {
+		return nil, err
+	}
+	resp, err = acmeRequest("POST", url, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		var problem struct {
+			Detail string `json:"detail"`
+		}
+		if json.Unmarshal(respBody, &problem) == nil && problem.Detail != "" {
+			return nil, fmt.Errorf("%s: %s", resp.Status, problem.Detail)
+		}
+		return nil, errors.New(resp.Status)
+	}
+	return respBody, nil
+}
+
+func acmeRequest(method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", acme.UserAgent)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/jose+json")
+	}
+	return acme.HTTPClient.Do(req)
+}
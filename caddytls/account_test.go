@@ -0,0 +1,268 @@
+package caddytls
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/xenolf/lego/acme"
+)
+
+func TestAccounts(t *testing.T) {
+	ca := newTestCA()
+	defer ca.Close()
+	defer setTestStorageBase(t)()
+
+	storage, err := new(Config).StorageFor(ca.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := newUser("me@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Registration = &acme.RegistrationResource{URI: ca.URL + "/reg/1"}
+	if err := saveUser(storage, user); err != nil {
+		t.Fatal(err)
+	}
+	unregistered, _ := newUser("new@example.com")
+	if err := saveUser(storage, unregistered); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := Accounts(ca.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(accounts) != 2 || accounts[0].Email != "me@example.com" || accounts[1].Email != "new@example.com" {
+		t.Fatalf("Expected accounts of me@ and new@example.com, got %+v", accounts)
+	}
+	thumbprint, _ := jwkThumbprint(user.key)
+	if a := accounts[0]; a.URI != ca.URL+"/reg/1" || a.KeyType != "EC P-384" || a.KeyThumbprint != thumbprint {
+		t.Errorf("Expected registered account with P-384 key %s, got %+v", thumbprint, a)
+	}
+
+	if err := UpdateAccountContact(ca.URL, "new@example.com", "other@example.com"); err == nil {
+		t.Error("Expected error updating unregistered account")
+	}
+	if err := UpdateAccountContact(ca.URL, "me@example.com", "You@example.com"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if p := ca.last(); p.url != "/reg/1" || p.thumbprint != thumbprint || p.payload["resource"] != "reg" {
+		t.Errorf("Expected reg request signed by account key, got %+v", p)
+	} else if contact, _ := p.payload["contact"].([]interface{}); len(contact) != 1 || contact[0] != "mailto:You@example.com" {
+		t.Errorf("Expected new contact, got %v", p.payload["contact"])
+	}
+	if _, err := storage.LoadUser("you@example.com"); err != nil {
+		t.Errorf("Expected account stored under new email, got: %v", err)
+	}
+
+	if err := RolloverAccountKey(ca.URL, "me@example.com"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	p := ca.last()
+	if p.url != "/key-change" || p.thumbprint != thumbprint {
+		t.Errorf("Expected key change signed by old key, got %+v", p)
+	}
+	rolled, err := getUser(storage, "me@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newThumbprint, _ := jwkThumbprint(rolled.key)
+	if newThumbprint == thumbprint {
+		t.Error("Expected new key to be stored")
+	}
+	var change jws
+	raw, _ := json.Marshal(p.payload)
+	json.Unmarshal(raw, &change)
+	inner, innerThumbprint, err := verifyJWS(change)
+	if err != nil || innerThumbprint != newThumbprint {
+		t.Errorf("Expected change signed by new key %s, got %s (%v)", newThumbprint, innerThumbprint, err)
+	} else if inner["account"] != ca.URL+"/reg/1" || inner["newKey"] == nil {
+		t.Errorf("Expected change of account key, got %v", inner)
+	}
+
+	ca.fail = true
+	if err := DeactivateAccount(ca.URL, "me@example.com"); err == nil || err.Error() != "deactivating account: 403 Forbidden: not allowed" {
+		t.Errorf("Expected error of CA, got: %v", err)
+	}
+	ca.fail = false
+	if err := DeactivateAccount(ca.URL, "me@example.com"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if p := ca.last(); p.thumbprint != newThumbprint || p.payload["status"] != "deactivated" {
+		t.Errorf("Expected deactivation signed by new key, got %+v", p)
+	}
+	if _, err := storage.LoadUser("me@example.com"); err == nil {
+		t.Error("Expected deactivated account to be deleted")
+	}
+}
+
+func TestSignJWS(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	for i, key := range []crypto.PrivateKey{ecKey, rsaKey} {
+		signed, err := signJWS(key, "nonce", []byte(`{"a":"b"}`))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		payload, thumbprint, err := verifyJWS(*signed)
+		if err != nil {
+			t.Errorf("Test %d: Expected valid signature, got: %v", i, err)
+		}
+		if expected, _ := jwkThumbprint(key); thumbprint != expected {
+			t.Errorf("Test %d: Expected key %s, got %s", i, expected, thumbprint)
+		}
+		if payload["a"] != "b" {
+			t.Errorf("Test %d: Expected payload, got %v", i, payload)
+		}
+	}
+}
+
+// verifyJWS verifies s with the key in its protected header, and
+// returns its payload and the thumbprint of the key.
+func verifyJWS(s jws) (map[string]interface{}, string, error) {
+	var header struct {
+		Alg string `json:"alg"`
+		JWK jwk    `json:"jwk"`
+	}
+	if err := decodeSegment(s.Protected, &header); err != nil {
+		return nil, "", err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(s.Signature)
+	if err != nil {
+		return nil, "", err
+	}
+	num := func(v string) *big.Int {
+		b, _ := base64.RawURLEncoding.DecodeString(v)
+		return new(big.Int).SetBytes(b)
+	}
+	signingInput := []byte(s.Protected + "." + s.Payload)
+	var pub crypto.PrivateKey
+	switch header.Alg {
+	case "ES256", "ES384":
+		curve, hash := elliptic.P256(), crypto.SHA256
+		if header.Alg == "ES384" {
+			curve, hash = elliptic.P384(), crypto.SHA384
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: num(header.JWK.X), Y: num(header.JWK.Y)}
+		h := hash.New()
+		h.Write(signingInput)
+		half := len(sig) / 2
+		if !ecdsa.Verify(key, h.Sum(nil), new(big.Int).SetBytes(sig[:half]), new(big.Int).SetBytes(sig[half:])) {
+			return nil, "", errBadSignature
+		}
+		pub = &ecdsa.PrivateKey{PublicKey: *key}
+	case "RS256":
+		key := &rsa.PublicKey{N: num(header.JWK.N), E: int(num(header.JWK.E).Int64())}
+		h := crypto.SHA256.New()
+		h.Write(signingInput)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, h.Sum(nil), sig); err != nil {
+			return nil, "", err
+		}
+		pub = &rsa.PrivateKey{PublicKey: *key}
+	default:
+		return nil, "", errBadSignature
+	}
+	var payload map[string]interface{}
+	if err := decodeSegment(s.Payload, &payload); err != nil {
+		return nil, "", err
+	}
+	thumbprint, err := jwkThumbprint(pub)
+	return payload, thumbprint, err
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+var errBadSignature = errors.New("bad signature")
+
+// testCA is an ACME CA that records the signed
+// requests it gets.
+type testCA struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []signedRequest
+	fail     bool
+}
+
+type signedRequest struct {
+	url        string
+	thumbprint string
+	payload    map[string]interface{}
+}
+
+func newTestCA() *testCA {
+	ca := new(testCA)
+	ca.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "n0nce")
+		switch r.Method {
+		case "HEAD":
+			return
+		case "GET":
+			json.NewEncoder(w).Encode(map[string]string{"key-change": ca.URL + "/key-change"})
+			return
+		}
+		var s jws
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		payload, thumbprint, err := verifyJWS(s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ca.fail {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"detail":"not allowed"}`))
+			return
+		}
+		ca.mu.Lock()
+		ca.requests = append(ca.requests, signedRequest{r.URL.Path, thumbprint, payload})
+		ca.mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	return ca
+}
+
+func (ca *testCA) last() signedRequest {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if len(ca.requests) == 0 {
+		return signedRequest{}
+	}
+	return ca.requests[len(ca.requests)-1]
+}
+
+// setTestStorageBase stores assets in a temporary directory
+// until the returned function is called.
+func setTestStorageBase(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "caddytls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := storageBasePath
+	storageBasePath = dir
+	return func() {
+		storageBasePath = old
+		os.RemoveAll(dir)
+	}
+}
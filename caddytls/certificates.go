@@ -38,6 +38,10 @@ type Certificate struct {
 	// Config is the configuration with which the certificate was
 	// loaded or obtained and with which it should be maintained.
 	Config *Config
+
+	// Source is the file the certificate was loaded from, if
+	// it is not managed; managed ones are found in storage.
+	Source string
 }
 
 // getCertificate gets a certificate that matches name (a server name)
@@ -119,19 +123,22 @@ func cacheUnmanagedCertificatePEMFile(certFile, keyFile string) error {
 	if err != nil {
 		return err
 	}
+	cert.Source = certFile
 	cacheCertificate(cert)
 	return nil
 }
 
 // cacheUnmanagedCertificatePEMBytes makes a certificate out of the PEM bytes
-// of the certificate and key, then caches it in memory.
+// of the certificate and key, which were read from source, then caches it
+// in memory.
 //
 // This function is safe for concurrent use.
-func cacheUnmanagedCertificatePEMBytes(certBytes, keyBytes []byte) error {
+func cacheUnmanagedCertificatePEMBytes(certBytes, keyBytes []byte, source string) error {
 	cert, err := makeCertificate(certBytes, keyBytes)
 	if err != nil {
 		return err
 	}
+	cert.Source = source
 	cacheCertificate(cert)
 	return nil
 }
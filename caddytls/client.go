@@ -137,6 +137,17 @@ var newACMEClient = func(config *Config, allowPrompts bool) (*ACMEClient, error)
 		if caddy.HasListenerWithAddress(net.JoinHostPort(config.ListenHost, TLSSNIChallengePort)) {
 			c.acmeClient.SetChallengeProvider(acme.TLSSNI01, tlsSniSolver{})
 		}
+
+		// Shared challenges are answered by whichever instance
+		// the CA's request reaches; TLS-SNI challenges can't be
+		if config.SharedChallenges {
+			cs, err := shareChallenges(config)
+			if err != nil {
+				return nil, err
+			}
+			c.acmeClient.ExcludeChallenges([]acme.Challenge{acme.TLSSNI01})
+			c.acmeClient.SetChallengeProvider(acme.HTTP01, sharedChallengeSolver{storage: cs})
+		}
 	} else {
 		// Otherwise, DNS challenge it is
 
@@ -146,9 +157,9 @@ var newACMEClient = func(config *Config, allowPrompts bool) (*ACMEClient, error)
 			return nil, errors.New("unknown DNS provider by name '" + config.DNSProvider + "'")
 		}
 
-		// We could pass credentials to create the provider, but for now
-		// just let the solver package get them from the environment
-		prov, err := provFn()
+		// Credentials not given in the config are left for the
+		// solver package to get from the environment
+		prov, err := provFn(config.DNSCredentials...)
 		if err != nil {
 			return nil, err
 		}
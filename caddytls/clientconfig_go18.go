@@ -0,0 +1,64 @@
+// +build go1.8
+
+package caddytls
+
+import (
+	"crypto/tls"
+	"sync"
+)
+
+// setConfigForClient makes handshakes use the protocol versions,
+// cipher suites, curves, ALPN protocols and client authentication
+// of the config that matches the server name, rather than the union
+// of the settings of all the configs on the listener, which config
+// has. Servers must make sure the requests on a connection are for
+// the site it was made for if client authentication differs.
+func setConfigForClient(config *tls.Config, cg configGroup) {
+	// the site configs are made at the first handshake for
+	// each site, since config may be changed until serving
+	var mu sync.Mutex
+	siteConfigs := make(map[*Config]*tls.Config)
+
+	config.GetConfigForClient = func(clientHello *tls.ClientHelloInfo) (*tls.Config, error) {
+		cfg := cg.getConfig(clientHello.ServerName)
+		if cfg == nil || !cfg.Enabled {
+			return nil, nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if siteConfig, ok := siteConfigs[cfg]; ok {
+			return siteConfig, nil
+		}
+		siteConfig := config.Clone()
+		siteConfig.GetConfigForClient = nil
+		applySiteParams(siteConfig, cfg)
+		siteConfigs[cfg] = siteConfig
+		return siteConfig, nil
+	}
+}
+
+// applySiteParams overrides the settings of config
+// with those that cfg has.
+func applySiteParams(config *tls.Config, cfg *Config) {
+	if cfg.ProtocolMinVersion != 0 {
+		config.MinVersion = cfg.ProtocolMinVersion
+	}
+	if cfg.ProtocolMaxVersion != 0 {
+		config.MaxVersion = cfg.ProtocolMaxVersion
+	}
+	if len(cfg.Ciphers) > 0 {
+		config.CipherSuites = cfg.Ciphers
+		if config.CipherSuites[0] != tls.TLS_FALLBACK_SCSV {
+			config.CipherSuites = append([]uint16{tls.TLS_FALLBACK_SCSV}, config.CipherSuites...)
+		}
+	}
+	config.PreferServerCipherSuites = cfg.PreferServerCipherSuites
+	if len(cfg.CurvePreferences) > 0 {
+		config.CurvePreferences = cfg.CurvePreferences
+	}
+	if len(cfg.ALPN) > 0 {
+		config.NextProtos = cfg.ALPN
+	}
+	config.ClientAuth = cfg.ClientAuth
+	config.ClientCAs = cfg.clientCAs
+}
@@ -0,0 +1,169 @@
+// +build go1.8
+
+package caddytls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSiteTLSParams(t *testing.T) {
+	tlsCert, err := tls.X509KeyPair(testCert, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2Site := &Config{Hostname: "h2.example.com", Enabled: true}
+	SetDefaultTLSParams(h2Site)
+	legacySite := &Config{
+		Hostname:           "legacy.example.com",
+		Enabled:            true,
+		ProtocolMaxVersion: tls.VersionTLS11,
+		Ciphers:            []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA},
+		ALPN:               []string{"http/1.1"},
+	}
+	SetDefaultTLSParams(legacySite)
+
+	config, err := MakeTLSConfig([]*Config{h2Site, legacySite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.NextProtos = []string{"h2"}
+	config.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return &tlsCert, nil
+	}
+
+	for i, test := range []struct {
+		serverName string
+		proto      string
+		version    uint16
+		cipher     uint16
+	}{
+		{"h2.example.com", "h2", tls.VersionTLS12, 0},
+		{"legacy.example.com", "http/1.1", tls.VersionTLS11, tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA},
+	} {
+		client, server := net.Pipe()
+		go func() {
+			tls.Server(server, config).Handshake()
+			server.Close()
+		}()
+		conn := tls.Client(client, &tls.Config{
+			ServerName:         test.serverName,
+			InsecureSkipVerify: true,
+			MinVersion:         tls.VersionTLS10,
+			NextProtos:         []string{"h2", "http/1.1"},
+		})
+		if err := conn.Handshake(); err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		state := conn.ConnectionState()
+		conn.Close()
+		if state.NegotiatedProtocol != test.proto {
+			t.Errorf("Test %d: Expected protocol %s, got %s", i, test.proto, state.NegotiatedProtocol)
+		}
+		if state.Version != test.version {
+			t.Errorf("Test %d: Expected version %x, got %x", i, test.version, state.Version)
+		}
+		if test.cipher != 0 && state.CipherSuite != test.cipher {
+			t.Errorf("Test %d: Expected cipher %x, got %x", i, test.cipher, state.CipherSuite)
+		}
+	}
+}
+
+func TestSiteClientAuth(t *testing.T) {
+	tlsCert, err := tls.X509KeyPair(testCert, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a CA for site A, and a client certificate from it
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	clientDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caTemplate, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert := tls.Certificate{Certificate: [][]byte{clientDER}, PrivateKey: clientKey}
+
+	caFile, err := ioutil.TempFile("", "caddytls_client_ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(caFile.Name())
+	pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	caFile.Close()
+
+	config, err := MakeTLSConfig([]*Config{
+		{Hostname: "a.example.com", Enabled: true, ClientAuth: tls.RequireAndVerifyClientCert, ClientCerts: []string{caFile.Name()}},
+		{Hostname: "b.example.com", Enabled: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return &tlsCert, nil
+	}
+
+	for i, test := range []struct {
+		serverName string
+		clientCert bool
+		shouldErr  bool
+	}{
+		{"a.example.com", true, false},
+		{"a.example.com", false, true},
+		{"b.example.com", false, false},
+		{"", false, true},
+	} {
+		client, server := net.Pipe()
+		serverErr := make(chan error, 1)
+		go func() {
+			serverErr <- tls.Server(server, config).Handshake()
+			server.Close()
+		}()
+		clientConfig := &tls.Config{ServerName: test.serverName, InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12}
+		if test.clientCert {
+			clientConfig.Certificates = []tls.Certificate{clientCert}
+		}
+		conn := tls.Client(client, clientConfig)
+		conn.Handshake()
+		err := <-serverErr
+		conn.Close()
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error, got none", i)
+		}
+		if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+	}
+}
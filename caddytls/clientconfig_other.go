@@ -0,0 +1,10 @@
+// +build !go1.8
+
+package caddytls
+
+import "crypto/tls"
+
+// setConfigForClient does nothing, since handshakes cannot choose
+// a config before Go 1.8; the union of the settings of the configs
+// on the listener is used for every handshake.
+func setConfigForClient(config *tls.Config, cg configGroup) {}
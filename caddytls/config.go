@@ -38,6 +38,10 @@ type Config struct {
 	// The list of preferred curves
 	CurvePreferences []tls.CurveID
 
+	// The protocols to offer with ALPN, in order of
+	// preference; if empty, the server's are offered
+	ALPN []string
+
 	// Client authentication policy
 	ClientAuth tls.ClientAuthType
 
@@ -45,6 +49,10 @@ type Config struct {
 	// client authentication is enabled
 	ClientCerts []string
 
+	// The pool of the ClientCerts, which is loaded
+	// when the config is made into a tls.Config
+	clientCAs *x509.CertPool
+
 	// Manual means user provides own certs and keys
 	Manual bool
 
@@ -88,6 +96,10 @@ type Config struct {
 	// to use when solving the ACME DNS challenge
 	DNSProvider string
 
+	// The credentials to give the DNS provider, if any;
+	// providers may read them from the environment instead
+	DNSCredentials []string
+
 	// The email address to use when creating or
 	// using an ACME account (fun fact: if this
 	// is set to "off" then this config will not
@@ -108,6 +120,33 @@ type Config struct {
 
 	// Add the must staple TLS extension to the CSR generated by lego/acme
 	MustStaple bool
+
+	// If true, handshakes on this config's listener for names
+	// that have no certificate get this config's certificate
+	DefaultServer bool
+
+	// If true, handshakes on this config's listener for names
+	// that have no certificate fail instead of getting the
+	// default certificate
+	RejectUnknownSNI bool
+
+	// If true, the answers to HTTP challenges are kept in storage,
+	// so that any instance sharing it can answer challenges for
+	// certificates another instance is obtaining, such as when
+	// instances are behind a load balancer
+	SharedChallenges bool
+
+	// If true, the certificate transparency logs are checked
+	// for certificates of this config's names that were not
+	// obtained by this process, which are reported to the
+	// CTWebhook URL, if any
+	CTMonitor bool
+	CTWebhook string
+
+	// If true, a certificate is obtained from the staging CA
+	// and checked to serve a valid chain before one is obtained
+	// from the CA; renewals are not rehearsed
+	StagingFirst bool
 }
 
 // OnDemandState contains some state relevant for providing
@@ -152,6 +191,12 @@ func (c *Config) ObtainCert(name string, allowPrompts bool) error {
 		c.ACMEEmail = getEmail(storage, allowPrompts)
 	}
 
+	if c.StagingFirst && c.caURL() != StagingCAUrl {
+		if err := c.rehearse(name, allowPrompts); err != nil {
+			return fmt.Errorf("%s: not obtaining certificate, %v", name, err)
+		}
+	}
+
 	client, err := newACMEClient(c, allowPrompts)
 	if err != nil {
 		return err
@@ -311,27 +356,33 @@ func MakeTLSConfig(configs []*Config) (*tls.Config, error) {
 		config.CipherSuites = append([]uint16{tls.TLS_FALLBACK_SCSV}, config.CipherSuites...)
 	}
 
-	// Set up client authentication if enabled
+	// Set up client authentication if enabled; each config
+	// gets a pool of its own CAs, the listener gets all of them
 	if config.ClientAuth != tls.NoClientCert {
 		pool := x509.NewCertPool()
-		clientCertsAdded := make(map[string]struct{})
+		clientCertsAdded := make(map[string][]byte)
 		for _, cfg := range configs {
+			if len(cfg.ClientCerts) > 0 {
+				cfg.clientCAs = x509.NewCertPool()
+			}
 			for _, caFile := range cfg.ClientCerts {
-				// don't add cert to pool more than once
-				if _, ok := clientCertsAdded[caFile]; ok {
+				// don't read or add cert to pool more than once
+				if caCrt, ok := clientCertsAdded[caFile]; ok {
+					cfg.clientCAs.AppendCertsFromPEM(caCrt)
 					continue
 				}
-				clientCertsAdded[caFile] = struct{}{}
 
 				// Any client with a certificate from this CA will be allowed to connect
 				caCrt, err := ioutil.ReadFile(caFile)
 				if err != nil {
 					return nil, err
 				}
+				clientCertsAdded[caFile] = caCrt
 
 				if !pool.AppendCertsFromPEM(caCrt) {
 					return nil, fmt.Errorf("error loading client certificate '%s': no certificates were successfully parsed", caFile)
 				}
+				cfg.clientCAs.AppendCertsFromPEM(caCrt)
 			}
 		}
 		config.ClientCAs = pool
@@ -340,6 +391,10 @@ func MakeTLSConfig(configs []*Config) (*tls.Config, error) {
 	// Associate the GetCertificate callback, or almost nothing we just did will work
 	config.GetCertificate = configMap.GetCertificate
 
+	// Let each site have its own protocols, ciphers, curves
+	// and client authentication where possible
+	setConfigForClient(config, configMap)
+
 	return config, nil
 }
 
@@ -396,6 +451,17 @@ var supportedProtocols = map[string]uint16{
 	"tls1.2": tls.VersionTLS12,
 }
 
+// ProtocolName returns the name of the TLS protocol version v
+// as written in the Caddyfile, or "" if v is not supported.
+func ProtocolName(v uint16) string {
+	for name, version := range supportedProtocols {
+		if version == v {
+			return name
+		}
+	}
+	return ""
+}
+
 // Map of supported ciphers, used only for parsing config.
 //
 // Note that, at time of writing, HTTP/2 blacklists 276 cipher suites,
@@ -421,6 +487,47 @@ var supportedCiphersMap = map[string]uint16{
 	"RSA-3DES-EDE-CBC-SHA":          tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
 }
 
+// orderCiphers returns ciphers ordered strongest first, in the
+// order of defaultCiphers, keeping the order of ciphers that are
+// not in it at the end. A server that prefers its own cipher
+// suites must prefer those allowed by HTTP/2, or clients that
+// negotiate it can fail.
+func orderCiphers(ciphers []uint16) []uint16 {
+	ordered := make([]uint16, 0, len(ciphers))
+	for _, def := range defaultCiphers {
+		for _, ciph := range ciphers {
+			if ciph == def {
+				ordered = append(ordered, ciph)
+				break
+			}
+		}
+	}
+	for _, ciph := range ciphers {
+		var isDefault bool
+		for _, def := range defaultCiphers {
+			if ciph == def {
+				isDefault = true
+				break
+			}
+		}
+		if !isDefault {
+			ordered = append(ordered, ciph)
+		}
+	}
+	return ordered
+}
+
+// CipherName returns the name of the cipher suite id as
+// written in the Caddyfile, or "" if id is not supported.
+func CipherName(id uint16) string {
+	for name, cipher := range supportedCiphersMap {
+		if cipher == id {
+			return name
+		}
+	}
+	return ""
+}
+
 // List of all the ciphers we want to use by default
 var defaultCiphers = []uint16{
 	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
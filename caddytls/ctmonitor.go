@@ -0,0 +1,189 @@
+package caddytls
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CTSearchURL is the URL of the certificate transparency search
+// service that is queried for the certificates logged for a
+// domain, which is appended to it. The service must respond
+// like crt.sh does with output=json.
+var CTSearchURL = "https://crt.sh/?output=json&q="
+
+// UnknownCertificate is a certificate for a monitored domain
+// that appeared in the certificate transparency logs but was
+// not obtained or loaded by this process.
+type UnknownCertificate struct {
+	Domain    string `json:"domain"`
+	Names     string `json:"names"`
+	Serial    string `json:"serial"`
+	Issuer    string `json:"issuer"`
+	NotBefore string `json:"not_before"`
+	LogEntry  int64  `json:"log_entry"`
+}
+
+// ctEntry is a certificate in the response of the search service.
+type ctEntry struct {
+	ID           int64  `json:"id"`
+	IssuerName   string `json:"issuer_name"`
+	NameValue    string `json:"name_value"`
+	SerialNumber string `json:"serial_number"`
+	NotBefore    string `json:"not_before"`
+}
+
+// ctSeen is the set of serial numbers of the logged certificates
+// that are known for each domain. The first check of a domain
+// sees the certificates issued before the process started.
+var ctSeen = make(map[string]map[string]struct{})
+var ctSeenMu sync.Mutex
+
+// ctStart is when monitoring started.
+var ctStart = time.Now()
+
+// CheckCertificateTransparency queries the certificate transparency
+// logs for the names of the managed certificates whose configs
+// monitor them, and reports certificates that appeared since the
+// names were first checked and were not obtained or loaded by this
+// process, which may have been mis-issued.
+func CheckCertificateTransparency() {
+	// the names to check, with their configs, and
+	// the serial numbers of the certificates we have
+	monitored := make(map[string]*Config)
+	ours := make(map[string]struct{})
+	certCacheMu.RLock()
+	for name, cert := range certCache {
+		if len(cert.Certificate.Certificate) > 0 {
+			if leaf, err := x509.ParseCertificate(cert.Certificate.Certificate[0]); err == nil {
+				ours[fmt.Sprintf("%x", leaf.SerialNumber)] = struct{}{}
+			}
+		}
+		if name == "" || !cert.Config.Managed || !cert.Config.CTMonitor {
+			continue
+		}
+		monitored[name] = cert.Config
+	}
+	certCacheMu.RUnlock()
+
+	for name, cfg := range monitored {
+		entries, err := searchCTLogs(name)
+		if err != nil {
+			log.Printf("[ERROR] Checking certificate transparency logs for %s: %v", name, err)
+			continue
+		}
+
+		ctSeenMu.Lock()
+		seen, checked := ctSeen[name]
+		if !checked {
+			seen = make(map[string]struct{})
+			ctSeen[name] = seen
+		}
+		var unknown []UnknownCertificate
+		for _, e := range entries {
+			serial := normalizeSerial(e.SerialNumber)
+			if _, ok := seen[serial]; ok {
+				continue
+			}
+			seen[serial] = struct{}{}
+			if _, ok := ours[serial]; ok {
+				continue
+			}
+			if !checked && !issuedAfter(e.NotBefore, ctStart) {
+				continue
+			}
+			unknown = append(unknown, UnknownCertificate{
+				Domain:    name,
+				Names:     e.NameValue,
+				Serial:    serial,
+				Issuer:    e.IssuerName,
+				NotBefore: e.NotBefore,
+				LogEntry:  e.ID,
+			})
+		}
+		ctSeenMu.Unlock()
+
+		for _, uc := range unknown {
+			log.Printf("[WARNING] Unknown certificate for %s in certificate transparency logs: serial %s issued by %s (crt.sh ID %d)",
+				uc.Domain, uc.Serial, uc.Issuer, uc.LogEntry)
+			if cfg.CTWebhook != "" {
+				if err := postUnknownCertificate(cfg.CTWebhook, uc); err != nil {
+					log.Printf("[ERROR] Reporting unknown certificate for %s to %s: %v", uc.Domain, cfg.CTWebhook, err)
+				}
+			}
+		}
+	}
+}
+
+// searchCTLogs returns the logged certificates for name.
+func searchCTLogs(name string) ([]ctEntry, error) {
+	resp, err := ctClient.Get(CTSearchURL + url.QueryEscape(name))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("search service responded with HTTP %d", resp.StatusCode)
+	}
+	var all []ctEntry
+	if err := json.NewDecoder(resp.Body).Decode(&all); err != nil {
+		return nil, fmt.Errorf("decoding search results: %v", err)
+	}
+
+	// the service may match more than this very name
+	var entries []ctEntry
+	for _, e := range all {
+		for _, n := range strings.Split(e.NameValue, "\n") {
+			if strings.EqualFold(strings.TrimSpace(n), name) {
+				entries = append(entries, e)
+				break
+			}
+		}
+	}
+	return entries, nil
+}
+
+// issuedAfter returns whether notBefore, as formatted by
+// the search service, is after t.
+func issuedAfter(notBefore string, t time.Time) bool {
+	issued, err := time.Parse("2006-01-02T15:04:05", notBefore)
+	return err == nil && issued.After(t)
+}
+
+// postUnknownCertificate sends uc to webhook as JSON.
+func postUnknownCertificate(webhook string, uc UnknownCertificate) error {
+	body, err := json.Marshal(uc)
+	if err != nil {
+		return err
+	}
+	resp, err := ctClient.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// normalizeSerial returns serial as lowercase hex
+// without leading zeros or separators.
+func normalizeSerial(serial string) string {
+	serial = strings.ToLower(strings.Replace(serial, ":", "", -1))
+	serial = strings.TrimLeft(serial, "0")
+	if serial == "" {
+		return "0"
+	}
+	return serial
+}
+
+// ctClient is the HTTP client for the search service and webhooks.
+var ctClient = &http.Client{Timeout: 30 * time.Second}
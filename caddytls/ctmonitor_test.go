@@ -0,0 +1,121 @@
+package caddytls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+)
+
+func TestCheckCertificateTransparency(t *testing.T) {
+	tlsCert, err := tls.X509KeyPair(testCert, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ourSerial := fmt.Sprintf("%X", leaf.SerialNumber)
+
+	var mu sync.Mutex
+	later := ctStart.Add(time.Hour).UTC().Format("2006-01-02T15:04:05")
+	logged := []ctEntry{
+		{ID: 1, NameValue: "ct.example.com", SerialNumber: ourSerial, NotBefore: later},
+		{ID: 2, NameValue: "ct.example.com\nwww.ct.example.com", SerialNumber: "0a0b", NotBefore: "2015-01-01T00:00:00"},
+		{ID: 3, NameValue: "other.ct.example.com", SerialNumber: "0c", NotBefore: later},
+		{ID: 4, NameValue: "CT.example.com", SerialNumber: "0d", NotBefore: later},
+	}
+	search := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("q"); got != "ct.example.com" {
+			t.Errorf("Expected query for ct.example.com, got '%s'", got)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		json.NewEncoder(w).Encode(logged)
+	}))
+	defer search.Close()
+
+	var reported []UnknownCertificate
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var uc UnknownCertificate
+		if err := json.NewDecoder(r.Body).Decode(&uc); err != nil {
+			t.Errorf("Expected JSON report, got error: %v", err)
+		}
+		mu.Lock()
+		reported = append(reported, uc)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	defer func(u string) { CTSearchURL = u }(CTSearchURL)
+	CTSearchURL = search.URL + "/?output=json&q="
+	certCacheMu.Lock()
+	certCache["ct.example.com"] = Certificate{
+		Certificate: tlsCert,
+		Names:       []string{"ct.example.com"},
+		Config:      &Config{Managed: true, CTMonitor: true, CTWebhook: webhook.URL},
+	}
+	certCacheMu.Unlock()
+	defer func() {
+		certCacheMu.Lock()
+		delete(certCache, "ct.example.com")
+		certCacheMu.Unlock()
+		ctSeenMu.Lock()
+		delete(ctSeen, "ct.example.com")
+		ctSeenMu.Unlock()
+	}()
+
+	// only the certificate issued since monitoring started is reported
+	CheckCertificateTransparency()
+	if len(reported) != 1 || reported[0].Serial != "d" || reported[0].LogEntry != 4 {
+		t.Fatalf("Expected certificate 4 to be reported, got %+v", reported)
+	}
+
+	// new certificates are reported, and each only once
+	mu.Lock()
+	logged = append(logged, ctEntry{ID: 5, NameValue: "ct.example.com", SerialNumber: "00:0E", NotBefore: "2015-01-01T00:00:00"})
+	mu.Unlock()
+	CheckCertificateTransparency()
+	CheckCertificateTransparency()
+	if len(reported) != 2 || reported[1].Serial != "e" || reported[1].Domain != "ct.example.com" {
+		t.Errorf("Expected certificate 5 to be reported once, got %+v", reported)
+	}
+}
+
+func TestSetupCTMonitor(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		webhook   string
+	}{
+		{"tls {\n ct_monitor\n}", false, ""},
+		{"tls {\n ct_monitor https://hooks.example.com/ct\n}", false, "https://hooks.example.com/ct"},
+		{"tls {\n ct_monitor hooks.example.com\n}", true, ""},
+		{"tls {\n ct_monitor https://a https://b\n}", true, ""},
+	} {
+		cfg := new(Config)
+		RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+		err := setupTLS(caddy.NewTestController("", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if !cfg.CTMonitor || cfg.CTWebhook != test.webhook {
+			t.Errorf("Test %d: Expected monitoring with webhook '%s', got %v '%s'", i, test.webhook, cfg.CTMonitor, cfg.CTWebhook)
+		}
+	}
+}
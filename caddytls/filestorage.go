@@ -238,6 +238,51 @@ func (s *FileStorage) StoreUser(email string, data *UserData) error {
 	return nil
 }
 
+// Sites returns the domains of the certificates in storage.
+func (s *FileStorage) Sites() ([]string, error) {
+	siteDirs, err := ioutil.ReadDir(s.sites())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var domains []string
+	for _, dir := range siteDirs {
+		if dir.IsDir() {
+			domains = append(domains, dir.Name())
+		}
+	}
+	return domains, nil
+}
+
+// Users returns the email addresses of the users in storage.
+func (s *FileStorage) Users() ([]string, error) {
+	userDirs, err := ioutil.ReadDir(s.users())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var emails []string
+	for _, dir := range userDirs {
+		if dir.IsDir() {
+			emails = append(emails, dir.Name())
+		}
+	}
+	return emails, nil
+}
+
+// DeleteUser deletes the account folder of the user with email.
+// If it is not present, an instance of ErrNotExist is returned.
+func (s *FileStorage) DeleteUser(email string) error {
+	if _, err := os.Stat(s.user(email)); os.IsNotExist(err) {
+		return ErrNotExist(err)
+	}
+	return os.RemoveAll(s.user(email))
+}
+
 // TryLock attempts to get a lock for name, otherwise it returns
 // a Waiter value to wait until the other process is finished.
 func (s *FileStorage) TryLock(name string) (Waiter, error) {
@@ -291,3 +336,39 @@ func (s *FileStorage) MostRecentUserEmail() string {
 	}
 	return ""
 }
+
+// challenge returns the path to the answer to the
+// challenge with token for domain.
+func (s *FileStorage) challenge(domain, token string) string {
+	domain = strings.ToLower(domain)
+	return filepath.Join(s.Path, "challenges", domain, token)
+}
+
+// StoreChallenge implements ChallengeStorage.StoreChallenge by
+// writing the answer to disk, which may be shared by instances.
+func (s *FileStorage) StoreChallenge(domain, token, keyAuth string) error {
+	file := s.challenge(domain, token)
+	err := os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return fmt.Errorf("making challenge directory: %v", err)
+	}
+	return ioutil.WriteFile(file, []byte(keyAuth), 0600)
+}
+
+// LoadChallenge implements ChallengeStorage.LoadChallenge by reading
+// the answer from disk. If it is not present, an instance of
+// ErrNotExist is returned.
+func (s *FileStorage) LoadChallenge(domain, token string) (string, error) {
+	keyAuth, err := s.readFile(s.challenge(domain, token))
+	return string(keyAuth), err
+}
+
+// DeleteChallenge implements ChallengeStorage.DeleteChallenge
+// by deleting the answer from disk.
+func (s *FileStorage) DeleteChallenge(domain, token string) error {
+	err := os.Remove(s.challenge(domain, token))
+	if os.IsNotExist(err) {
+		return ErrNotExist(err)
+	}
+	return err
+}
@@ -77,6 +77,10 @@ func (cg configGroup) GetCertificate(clientHello *tls.ClientHelloInfo) (*tls.Cer
 func (cg configGroup) getCertDuringHandshake(name string, loadIfNecessary, obtainIfNecessary bool) (Certificate, error) {
 	// First check our in-memory cache to see if we've already loaded it
 	cert, matched, defaulted := getCertificate(name)
+	if name == "" {
+		// the default certificate is keyed by the empty name
+		matched, defaulted = false, matched
+	}
 	if matched {
 		return cert, nil
 	}
@@ -84,7 +88,7 @@ func (cg configGroup) getCertDuringHandshake(name string, loadIfNecessary, obtai
 	// Get the relevant TLS config for this name. If OnDemand is enabled,
 	// then we might be able to load or obtain a needed certificate.
 	cfg := cg.getConfig(name)
-	if cfg != nil && cfg.OnDemand && loadIfNecessary {
+	if cfg != nil && cfg.OnDemand && loadIfNecessary && name != "" {
 		// Then check to see if we have one on disk
 		loadedCert, err := CacheManagedCertificate(name, cfg)
 		if err == nil {
@@ -115,6 +119,18 @@ func (cg configGroup) getCertDuringHandshake(name string, loadIfNecessary, obtai
 		}
 	}
 
+	// Let the listener's default server have the handshake, if any
+	for _, cfg := range cg {
+		if cfg.DefaultServer {
+			if cert, matched, _ := getCertificate(cfg.Hostname); matched {
+				return cert, nil
+			}
+		}
+		if cfg.RejectUnknownSNI {
+			return Certificate{}, fmt.Errorf("no site for %s", name)
+		}
+	}
+
 	// Fall back to the default certificate if there is one
 	if defaulted {
 		return cert, nil
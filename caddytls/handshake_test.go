@@ -54,3 +54,42 @@ func TestGetCertificate(t *testing.T) {
 		t.Errorf("Expected default cert with no matches, got: %v", cert)
 	}
 }
+
+func TestGetCertificateDefaultServer(t *testing.T) {
+	defer func() { certCache = make(map[string]Certificate) }()
+
+	defaultCert := Certificate{Names: []string{"example.com", ""}, Certificate: tls.Certificate{Leaf: &x509.Certificate{DNSNames: []string{"example.com"}}}}
+	otherCert := Certificate{Names: []string{"other.com"}, Certificate: tls.Certificate{Leaf: &x509.Certificate{DNSNames: []string{"other.com"}}}}
+	certCache[""] = defaultCert
+	certCache["example.com"] = defaultCert
+	certCache["other.com"] = otherCert
+
+	helloNoMatch := &tls.ClientHelloInfo{ServerName: "nomatch"}
+	helloNoSNI := &tls.ClientHelloInfo{}
+
+	// the listener's default server's certificate is used for unknown names
+	cg := configGroup{
+		"example.com": &Config{Hostname: "example.com"},
+		"other.com":   &Config{Hostname: "other.com", DefaultServer: true},
+	}
+	for _, hello := range []*tls.ClientHelloInfo{helloNoMatch, helloNoSNI} {
+		if cert, err := cg.GetCertificate(hello); err != nil {
+			t.Errorf("Expected no error for '%s', got: %v", hello.ServerName, err)
+		} else if cert.Leaf.DNSNames[0] != "other.com" {
+			t.Errorf("Expected default server's certificate for '%s', got: %v", hello.ServerName, cert.Leaf.DNSNames)
+		}
+	}
+
+	// or handshakes for unknown names fail
+	cg = configGroup{
+		"example.com": &Config{Hostname: "example.com", RejectUnknownSNI: true},
+	}
+	for _, hello := range []*tls.ClientHelloInfo{helloNoMatch, helloNoSNI} {
+		if _, err := cg.GetCertificate(hello); err == nil {
+			t.Errorf("Expected error for '%s', got none", hello.ServerName)
+		}
+	}
+	if _, err := cg.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"}); err != nil {
+		t.Errorf("Expected no error for known name, got: %v", err)
+	}
+}
@@ -12,13 +12,17 @@ import (
 const challengeBasePath = "/.well-known/acme-challenge"
 
 // HTTPChallengeHandler proxies challenge requests to ACME client if the
-// request path starts with challengeBasePath. It returns true if it
+// request path starts with challengeBasePath, unless the challenge is
+// answered from a storage that shares challenges. It returns true if it
 // handled the request and no more needs to be done; it returns false
 // if this call was a no-op and the request still needs handling.
 func HTTPChallengeHandler(w http.ResponseWriter, r *http.Request, altPort string) bool {
 	if !strings.HasPrefix(r.URL.Path, challengeBasePath) {
 		return false
 	}
+	if serveSharedChallenge(w, r) {
+		return true
+	}
 	if !namesObtaining.Has(r.Host) {
 		return false
 	}
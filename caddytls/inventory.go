@@ -0,0 +1,215 @@
+package caddytls
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// CertificateInfo describes a certificate for an inventory.
+type CertificateInfo struct {
+	Names    []string  `json:"names"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"not_after"`
+
+	// Managed is whether the certificate is renewed
+	// automatically, and OnDemand whether it was
+	// obtained during a TLS handshake
+	Managed  bool `json:"managed"`
+	OnDemand bool `json:"on_demand,omitempty"`
+
+	// OCSP is the status of the stapled OCSP response:
+	// good, revoked or unknown, or none if there is none
+	OCSP           string    `json:"ocsp"`
+	OCSPNextUpdate time.Time `json:"ocsp_next_update"`
+
+	// Storage is where the certificate is stored
+	// or was loaded from, if known
+	Storage string `json:"storage,omitempty"`
+}
+
+// siteLister is implemented by storage that can list
+// the domains of the certificates it has.
+type siteLister interface {
+	Sites() ([]string, error)
+}
+
+// CachedCertificates returns the certificates that are
+// loaded in memory, sorted by their first name.
+func CachedCertificates() []CertificateInfo {
+	certCacheMu.RLock()
+	var certs []Certificate
+	seen := make(map[string]bool)
+	for _, cert := range certCache {
+		if len(cert.Certificate.Certificate) == 0 {
+			continue
+		}
+		// a certificate is cached under each of its names
+		der := string(cert.Certificate.Certificate[0])
+		if seen[der] {
+			continue
+		}
+		seen[der] = true
+		certs = append(certs, cert)
+	}
+	certCacheMu.RUnlock()
+
+	infos := []CertificateInfo{}
+	for _, cert := range certs {
+		infos = append(infos, certificateInfo(cert))
+	}
+	sort.Sort(byFirstName(infos))
+	return infos
+}
+
+// StoredCertificates returns the certificates in storage for
+// the CA at caURL, sorted by their first name. If the storage
+// cannot list its certificates, none are returned.
+func StoredCertificates(caURL string) ([]CertificateInfo, error) {
+	storage, err := new(Config).StorageFor(caURL)
+	if err != nil {
+		return nil, err
+	}
+	infos := []CertificateInfo{}
+	l, ok := storage.(siteLister)
+	if !ok {
+		return infos, nil
+	}
+	domains, err := l.Sites()
+	if err != nil {
+		return nil, err
+	}
+	for _, domain := range domains {
+		siteData, err := storage.LoadSite(domain)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", domain, err)
+		}
+		cert, err := makeCertificate(siteData.Cert, siteData.Key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", domain, err)
+		}
+		cert.Config = &Config{Managed: true, CAUrl: caURL}
+		infos = append(infos, certificateInfo(cert))
+	}
+	sort.Sort(byFirstName(infos))
+	return infos, nil
+}
+
+// RenewCertificate renews the managed certificate for name
+// that is loaded in memory now, regardless of when it expires,
+// and loads the renewed one in its place.
+func RenewCertificate(name string) error {
+	certCacheMu.RLock()
+	cert, ok := certCache[strings.ToLower(name)]
+	certCacheMu.RUnlock()
+	if !ok || name == "" {
+		return fmt.Errorf("no certificate for %s", name)
+	}
+	if cert.Config == nil || !cert.Config.Managed || cert.Config.SelfSigned {
+		return fmt.Errorf("certificate for %s is not managed", name)
+	}
+	if err := cert.Config.RenewCert(renewName(cert), false); err != nil {
+		return err
+	}
+	if cert.Names[len(cert.Names)-1] == "" {
+		// the default certificate must point to the renewed one
+		certCacheMu.Lock()
+		delete(certCache, "")
+		certCacheMu.Unlock()
+	}
+	_, err := CacheManagedCertificate(cert.Names[0], cert.Config)
+	return err
+}
+
+// RenewStoredCertificate renews the certificate for name in
+// storage for the CA at caURL, regardless of when it expires,
+// with the account of the -email flag, else the most recent one.
+// Processes that serve it load it when they next check storage.
+func RenewStoredCertificate(caURL, name string) error {
+	cfg := &Config{Managed: true, CAUrl: caURL}
+	storage, err := cfg.StorageFor(caURL)
+	if err != nil {
+		return err
+	}
+	exists, err := storage.SiteExists(name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("no certificate for %s in storage", name)
+	}
+	cfg.ACMEEmail = getEmail(storage, false)
+	if cfg.ACMEEmail == "" {
+		return errors.New("no account to renew with; use -email")
+	}
+	return cfg.RenewCert(strings.ToLower(name), false)
+}
+
+// renewName returns the name to renew cert with, its first
+// one, as only certificates of one name are managed.
+func renewName(cert Certificate) string {
+	for _, name := range cert.Names {
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+func certificateInfo(cert Certificate) CertificateInfo {
+	info := CertificateInfo{NotAfter: cert.NotAfter, OCSP: "none", Storage: cert.Source}
+	for _, name := range cert.Names {
+		if name != "" {
+			info.Names = append(info.Names, name)
+		}
+	}
+	if leaf, err := x509.ParseCertificate(cert.Certificate.Certificate[0]); err == nil {
+		info.Issuer = leaf.Issuer.CommonName
+		if info.Issuer == "" && len(leaf.Issuer.Organization) > 0 {
+			info.Issuer = leaf.Issuer.Organization[0]
+		}
+	}
+	if cert.OCSP != nil {
+		switch cert.OCSP.Status {
+		case ocsp.Good:
+			info.OCSP = "good"
+		case ocsp.Revoked:
+			info.OCSP = "revoked"
+		default:
+			info.OCSP = "unknown"
+		}
+		info.OCSPNextUpdate = cert.OCSP.NextUpdate
+	}
+	if cfg := cert.Config; cfg != nil && cfg.Managed && !cfg.SelfSigned {
+		info.Managed, info.OnDemand = true, cfg.OnDemand
+		if storage, err := cfg.StorageFor(cfg.CAUrl); err == nil {
+			info.Storage = storageLocation(storage, renewName(cert))
+		}
+	}
+	return info
+}
+
+// storageLocation returns where storage keeps the certificate
+// for domain, if it is on disk.
+func storageLocation(storage Storage, domain string) string {
+	if fs, ok := storage.(*FileStorage); ok {
+		return fs.siteCertFile(domain)
+	}
+	return ""
+}
+
+type byFirstName []CertificateInfo
+
+func (l byFirstName) Len() int      { return len(l) }
+func (l byFirstName) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byFirstName) Less(i, j int) bool {
+	if len(l[i].Names) == 0 || len(l[j].Names) == 0 {
+		return len(l[i].Names) < len(l[j].Names)
+	}
+	return l[i].Names[0] < l[j].Names[0]
+}
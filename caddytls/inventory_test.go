@@ -0,0 +1,120 @@
+package caddytls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestCertificateInventory(t *testing.T) {
+	defer func() { certCache = make(map[string]Certificate) }()
+	defer setTestStorageBase(t)()
+	caURL := "https://ca.example.com/directory"
+
+	// a managed certificate, issued by a CA and stored
+	now := time.Now()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake Intermediate"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	leafKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "managed.example.com"},
+		DNSNames:     []string{"managed.example.com", "www.managed.example.com"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour).Truncate(time.Second),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, caTemplate, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, _ := savePrivateKey(leafKey)
+	cfg := &Config{Managed: true, CAUrl: caURL}
+	storage, err := cfg.StorageFor(caURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.StoreSite("managed.example.com", &SiteData{
+		Cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}),
+		Key:  keyPEM,
+		Meta: []byte("{}"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := StoredCertificates(caURL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(stored) != 1 {
+		t.Fatalf("Expected 1 stored certificate, got %+v", stored)
+	}
+	certFile := storage.(*FileStorage).siteCertFile("managed.example.com")
+	expected := CertificateInfo{
+		Names:    []string{"managed.example.com", "www.managed.example.com"},
+		Issuer:   "Fake Intermediate",
+		NotAfter: leafTemplate.NotAfter,
+		Managed:  true,
+		OCSP:     "none",
+		Storage:  certFile,
+	}
+	if !sameInfo(stored[0], expected) {
+		t.Errorf("Expected %+v, got %+v", expected, stored[0])
+	}
+
+	// loaded in memory with a self-signed one
+	if _, err := CacheManagedCertificate("managed.example.com", cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := makeSelfSignedCert(&Config{Hostname: "self.example.com", SelfSigned: true}); err != nil {
+		t.Fatal(err)
+	}
+	cached := CachedCertificates()
+	if len(cached) != 2 {
+		t.Fatalf("Expected 2 cached certificates, got %+v", cached)
+	}
+	if !sameInfo(cached[0], expected) {
+		t.Errorf("Expected %+v, got %+v", expected, cached[0])
+	}
+	if c := cached[1]; c.Names[0] != "self.example.com" || c.Managed || c.Issuer != "Caddy Self-Signed" {
+		t.Errorf("Expected unmanaged self-signed certificate, got %+v", c)
+	}
+
+	if err := RenewCertificate("self.example.com"); err == nil {
+		t.Error("Expected error renewing unmanaged certificate")
+	}
+	if err := RenewCertificate("other.example.com"); err == nil {
+		t.Error("Expected error renewing unknown certificate")
+	}
+	if err := RenewStoredCertificate(caURL, "other.example.com"); err == nil {
+		t.Error("Expected error renewing certificate not in storage")
+	}
+}
+
+func sameInfo(a, b CertificateInfo) bool {
+	if len(a.Names) != len(b.Names) {
+		return false
+	}
+	for i := range a.Names {
+		if a.Names[i] != b.Names[i] {
+			return false
+		}
+	}
+	return a.Issuer == b.Issuer && a.NotAfter.Equal(b.NotAfter) && a.Managed == b.Managed &&
+		a.OnDemand == b.OnDemand && a.OCSP == b.OCSP && a.Storage == b.Storage
+}
@@ -0,0 +1,133 @@
+package caddytls
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512" // for ES384 and ES512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+)
+
+// jwk is a public key in the JSON Web Key format
+// (RFC 7517), with its members in lexical order, as
+// needed for the thumbprint.
+type jwk struct {
+	Crv string `json:"crv,omitempty"`
+	E   string `json:"e,omitempty"`
+	Kty string `json:"kty"`
+	N   string `json:"n,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// jws is a JSON Web Signature (RFC 7515) in the
+// flattened JSON serialization.
+type jws struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// publicJWK returns the public key of key as a JWK, and the
+// JWS algorithm and hash that key signs with.
+func publicJWK(key crypto.PrivateKey) (jwk, string, crypto.Hash, error) {
+	switch key := key.(type) {
+	case *ecdsa.PrivateKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		k := jwk{
+			Kty: "EC",
+			Crv: key.Curve.Params().Name,
+			X:   base64url(padded(key.X, size)),
+			Y:   base64url(padded(key.Y, size)),
+		}
+		switch k.Crv {
+		case "P-256":
+			return k, "ES256", crypto.SHA256, nil
+		case "P-384":
+			return k, "ES384", crypto.SHA384, nil
+		case "P-521":
+			return k, "ES512", crypto.SHA512, nil
+		}
+		return jwk{}, "", 0, errors.New("unsupported curve " + k.Crv)
+	case *rsa.PrivateKey:
+		k := jwk{
+			Kty: "RSA",
+			N:   base64url(key.N.Bytes()),
+			E:   base64url(big.NewInt(int64(key.E)).Bytes()),
+		}
+		return k, "RS256", crypto.SHA256, nil
+	}
+	return jwk{}, "", 0, errors.New("unsupported private key type")
+}
+
+// signJWS signs payload with key, embedding the public
+// key and nonce in the protected header.
+func signJWS(key crypto.PrivateKey, nonce string, payload []byte) (*jws, error) {
+	pub, alg, hash, err := publicJWK(key)
+	if err != nil {
+		return nil, err
+	}
+	header, err := json.Marshal(struct {
+		Alg   string `json:"alg"`
+		JWK   jwk    `json:"jwk"`
+		Nonce string `json:"nonce,omitempty"`
+	}{alg, pub, nonce})
+	if err != nil {
+		return nil, err
+	}
+	s := &jws{Protected: base64url(header), Payload: base64url(payload)}
+
+	h := hash.New()
+	h.Write([]byte(s.Protected + "." + s.Payload))
+	digest := h.Sum(nil)
+	var sig []byte
+	switch key := key.(type) {
+	case *ecdsa.PrivateKey:
+		r, ss, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			return nil, err
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		sig = append(padded(r, size), padded(ss, size)...)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, hash, digest)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.Signature = base64url(sig)
+	return s, nil
+}
+
+// jwkThumbprint returns the SHA-256 thumbprint (RFC 7638)
+// of the public key of key.
+func jwkThumbprint(key crypto.PrivateKey) (string, error) {
+	pub, _, _, err := publicJWK(key)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return base64url(sum[:]), nil
+}
+
+// padded returns the big-endian bytes of n, left-padded to size.
+func padded(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
+
+func base64url(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -27,6 +27,10 @@ const (
 
 	// OCSPInterval is how often to check if OCSP stapling needs updating.
 	OCSPInterval = 1 * time.Hour
+
+	// CTInterval is how often to check the certificate transparency
+	// logs for unknown certificates of monitored names.
+	CTInterval = 6 * time.Hour
 )
 
 // maintainAssets is a permanently-blocking function
@@ -42,6 +46,7 @@ const (
 func maintainAssets(stopChan chan struct{}) {
 	renewalTicker := time.NewTicker(RenewInterval)
 	ocspTicker := time.NewTicker(OCSPInterval)
+	ctTicker := time.NewTicker(CTInterval)
 
 	for {
 		select {
@@ -54,9 +59,12 @@ func maintainAssets(stopChan chan struct{}) {
 			UpdateOCSPStaples()
 			DeleteOldStapleFiles()
 			log.Println("[INFO] Done checking OCSP staples")
+		case <-ctTicker.C:
+			CheckCertificateTransparency()
 		case <-stopChan:
 			renewalTicker.Stop()
 			ocspTicker.Stop()
+			ctTicker.Stop()
 			log.Println("[INFO] Stopped background maintenance routine")
 			return
 		}
@@ -104,15 +112,7 @@ func RenewManagedCertificates(allowPrompts bool) (err error) {
 			// so this should be easy. We can't rely on cert.Config.Hostname
 			// because it may be a wildcard value from the Caddyfile (e.g.
 			// *.something.com) which, as of 2016, is not supported by ACME.
-			var renewName string
-			for _, name := range cert.Names {
-				if name != "" {
-					renewName = name
-					break
-				}
-			}
-
-			err := cert.Config.RenewCert(renewName, allowPrompts)
+			err := cert.Config.RenewCert(renewName(cert), allowPrompts)
 			if err != nil {
 				if allowPrompts && timeLeft < 0 {
 					// Certificate renewal failed, the operator is present, and the certificate
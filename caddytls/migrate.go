@@ -0,0 +1,145 @@
+package caddytls
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+)
+
+// Migration is the outcome of copying the assets of a CA
+// from one storage to another.
+type Migration struct {
+	Sites   []string // certificates copied, by domain
+	Users   []string // accounts copied, by email
+	Skipped []string // assets the destination already had
+}
+
+// MigrateStorage copies the certificates, keys and accounts
+// for the CA at caURL from the storage provider named from to
+// the one named to. Every asset is checked to be valid before
+// it is copied and to read back the same after. Assets the
+// destination already has are skipped unless overwrite is set.
+// The source must be able to list its assets, like the file
+// storage can.
+func MigrateStorage(caURL, from, to string, overwrite bool) (Migration, error) {
+	var m Migration
+	if from == to {
+		return m, fmt.Errorf("source and destination are both '%s'", from)
+	}
+	src, err := (&Config{StorageProvider: from}).StorageFor(caURL)
+	if err != nil {
+		return m, err
+	}
+	dst, err := (&Config{StorageProvider: to}).StorageFor(caURL)
+	if err != nil {
+		return m, err
+	}
+	sites, ok1 := src.(siteLister)
+	users, ok2 := src.(userLister)
+	if !ok1 || !ok2 {
+		return m, fmt.Errorf("storage '%s' cannot list its assets", from)
+	}
+
+	domains, err := sites.Sites()
+	if err != nil {
+		return m, err
+	}
+	for _, domain := range domains {
+		copied, err := migrateSite(src, dst, domain, overwrite)
+		if err != nil {
+			return m, fmt.Errorf("%s: %v", domain, err)
+		}
+		if copied {
+			m.Sites = append(m.Sites, domain)
+		} else {
+			m.Skipped = append(m.Skipped, domain)
+		}
+	}
+
+	emails, err := users.Users()
+	if err != nil {
+		return m, err
+	}
+	for _, email := range emails {
+		copied, err := migrateUser(src, dst, email, overwrite)
+		if err != nil {
+			return m, fmt.Errorf("account %s: %v", email, err)
+		}
+		if copied {
+			m.Users = append(m.Users, email)
+		} else {
+			m.Skipped = append(m.Skipped, email)
+		}
+	}
+	return m, nil
+}
+
+// migrateSite copies the certificate of domain from src to
+// dst, and returns whether it did.
+func migrateSite(src, dst Storage, domain string, overwrite bool) (bool, error) {
+	if !overwrite {
+		exists, err := dst.SiteExists(domain)
+		if err != nil || exists {
+			return false, err
+		}
+	}
+	data, err := src.LoadSite(domain)
+	if err != nil {
+		return false, err
+	}
+	if _, err := tls.X509KeyPair(data.Cert, data.Key); err != nil {
+		return false, fmt.Errorf("invalid certificate or key: %v", err)
+	}
+
+	// the lock keeps renewals from writing it meanwhile
+	waiter, err := dst.TryLock(domain)
+	if err != nil {
+		return false, err
+	}
+	if waiter != nil {
+		return false, fmt.Errorf("certificate is being obtained or renewed in the destination")
+	}
+	defer dst.Unlock(domain)
+
+	if err := dst.StoreSite(domain, data); err != nil {
+		return false, err
+	}
+	stored, err := dst.LoadSite(domain)
+	if err != nil {
+		return false, fmt.Errorf("reading back: %v", err)
+	}
+	if !bytes.Equal(stored.Cert, data.Cert) || !bytes.Equal(stored.Key, data.Key) || !bytes.Equal(stored.Meta, data.Meta) {
+		return false, fmt.Errorf("reading back: copy differs")
+	}
+	return true, nil
+}
+
+// migrateUser copies the account of email from src to
+// dst, and returns whether it did.
+func migrateUser(src, dst Storage, email string, overwrite bool) (bool, error) {
+	if !overwrite {
+		if _, err := dst.LoadUser(email); err == nil {
+			return false, nil
+		} else if _, ok := err.(ErrNotExist); !ok {
+			return false, err
+		}
+	}
+	data, err := src.LoadUser(email)
+	if err != nil {
+		return false, err
+	}
+	if _, err := decodeUser(data); err != nil {
+		return false, fmt.Errorf("invalid account: %v", err)
+	}
+	if err := dst.StoreUser(email, data); err != nil {
+		return false, err
+	}
+	stored, err := dst.LoadUser(email)
+	if err != nil {
+		return false, fmt.Errorf("reading back: %v", err)
+	}
+	if !bytes.Equal(stored.Reg, data.Reg) || !bytes.Equal(stored.Key, data.Key) {
+		return false, fmt.Errorf("reading back: copy differs")
+	}
+	return true, nil
+}
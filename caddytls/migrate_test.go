@@ -0,0 +1,112 @@
+package caddytls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+)
+
+func TestMigrateStorage(t *testing.T) {
+	defer setTestStorageBase(t)()
+	dir, err := ioutil.TempDir("", "caddytls-migrated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	RegisterStorageProvider("migrated", func(caURL *url.URL) (Storage, error) {
+		return &FileStorage{Path: dir, nameLocks: make(map[string]*sync.WaitGroup)}, nil
+	})
+	defer delete(storageProviders, "migrated")
+	caURL := "https://ca.example.com/directory"
+
+	src, _ := new(Config).StorageFor(caURL)
+	dst, _ := (&Config{StorageProvider: "migrated"}).StorageFor(caURL)
+	certPEM, keyPEM := testCertificatePEM(t, "a.example.com")
+	for _, domain := range []string{"a.example.com", "b.example.com"} {
+		if err := src.StoreSite(domain, &SiteData{Cert: certPEM, Key: keyPEM, Meta: []byte(`{"domain":"` + domain + `"}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	user, _ := newUser("me@example.com")
+	user.Registration = &acme.RegistrationResource{URI: "https://ca.example.com/reg/1"}
+	if err := saveUser(src, user); err != nil {
+		t.Fatal(err)
+	}
+	// already migrated
+	if err := dst.StoreSite("b.example.com", &SiteData{Cert: certPEM, Key: keyPEM, Meta: []byte("{}")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := MigrateStorage(caURL, "file", "file", false); err == nil {
+		t.Error("Expected error migrating storage to itself")
+	}
+	if _, err := MigrateStorage(caURL, "file", "nonexistent", false); err == nil {
+		t.Error("Expected error migrating to unknown storage")
+	}
+
+	m, err := MigrateStorage(caURL, "file", "migrated", false)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(m.Sites) != 1 || m.Sites[0] != "a.example.com" || len(m.Users) != 1 || m.Users[0] != "me@example.com" {
+		t.Errorf("Expected a.example.com and me@example.com copied, got %+v", m)
+	}
+	if len(m.Skipped) != 1 || m.Skipped[0] != "b.example.com" {
+		t.Errorf("Expected b.example.com skipped, got %+v", m.Skipped)
+	}
+	if data, err := dst.LoadSite("a.example.com"); err != nil || string(data.Meta) != `{"domain":"a.example.com"}` {
+		t.Errorf("Expected a.example.com in destination, got %v", err)
+	}
+	if migrated, err := getUser(dst, "me@example.com"); err != nil || migrated.Registration == nil {
+		t.Errorf("Expected registered account in destination, got %+v (%v)", migrated, err)
+	}
+
+	m, err = MigrateStorage(caURL, "file", "migrated", true)
+	if err != nil || len(m.Sites) != 2 || len(m.Skipped) != 0 {
+		t.Errorf("Expected all assets copied again, got %+v (%v)", m, err)
+	}
+
+	// invalid assets are not copied
+	if err := src.StoreSite("c.example.com", &SiteData{Cert: certPEM, Key: []byte("garbage")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MigrateStorage(caURL, "file", "migrated", false); err == nil {
+		t.Error("Expected error migrating invalid certificate")
+	}
+	if exists, _ := dst.SiteExists("c.example.com"); exists {
+		t.Error("Expected invalid certificate not to be copied")
+	}
+}
+
+// testCertificatePEM returns a self-signed certificate
+// for name and its key, PEM-encoded.
+func testCertificatePEM(t *testing.T, name string) ([]byte, []byte) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := savePrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM
+}
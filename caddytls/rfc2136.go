@@ -0,0 +1,480 @@
+package caddytls
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+)
+
+func init() {
+	RegisterDNSProvider("rfc2136", NewRFC2136Provider)
+}
+
+// RFC2136Provider solves ACME DNS challenges by adding and removing
+// TXT records with dynamic updates (RFC 2136), signed with TSIG
+// (RFC 2845) if a key is given, so any standards-compliant DNS
+// server, such as BIND, Knot or PowerDNS, can be used.
+type RFC2136Provider struct {
+	// Nameserver is the host:port of the primary server of the zone
+	Nameserver string
+
+	// Zone is the zone to update; if empty, it is looked
+	// up with an SOA query to the nameserver
+	Zone string
+
+	// TSIGKey is the name of the key to sign updates with,
+	// and TSIGSecret its secret; updates are not signed if
+	// TSIGKey is empty
+	TSIGKey    string
+	TSIGSecret []byte
+
+	// TSIGAlgorithm is the name of the HMAC algorithm of the key;
+	// empty means hmac-sha256
+	TSIGAlgorithm string
+
+	// TTL of the challenge records
+	TTL uint32
+
+	// Timeout of each exchange with the nameserver
+	Timeout time.Duration
+}
+
+// NewRFC2136Provider returns an RFC2136Provider for the credentials,
+// which are the nameserver, TSIG key name, base64-encoded TSIG secret
+// and TSIG algorithm, in that order. Credentials not given are read
+// from the environment variables RFC2136_NAMESERVER, RFC2136_TSIG_KEY,
+// RFC2136_TSIG_SECRET and RFC2136_TSIG_ALGORITHM. The zone may be set
+// with RFC2136_ZONE, and the timeout with RFC2136_TIMEOUT.
+func NewRFC2136Provider(credentials ...string) (acme.ChallengeProvider, error) {
+	if len(credentials) > 4 {
+		return nil, errors.New("rfc2136: too many credentials")
+	}
+	creds := make([]string, 4)
+	for i, env := range []string{"RFC2136_NAMESERVER", "RFC2136_TSIG_KEY", "RFC2136_TSIG_SECRET", "RFC2136_TSIG_ALGORITHM"} {
+		if i < len(credentials) {
+			creds[i] = credentials[i]
+		} else {
+			creds[i] = os.Getenv(env)
+		}
+	}
+
+	p := &RFC2136Provider{
+		Nameserver:    creds[0],
+		Zone:          os.Getenv("RFC2136_ZONE"),
+		TSIGKey:       creds[1],
+		TSIGAlgorithm: creds[3],
+		TTL:           120,
+		Timeout:       10 * time.Second,
+	}
+	if p.Nameserver == "" {
+		return nil, errors.New("rfc2136: no nameserver")
+	}
+	if _, _, err := net.SplitHostPort(p.Nameserver); err != nil {
+		p.Nameserver = net.JoinHostPort(p.Nameserver, "53")
+	}
+	if p.TSIGKey != "" {
+		secret, err := base64.StdEncoding.DecodeString(creds[2])
+		if err != nil || len(secret) == 0 {
+			return nil, errors.New("rfc2136: invalid TSIG secret")
+		}
+		p.TSIGSecret = secret
+		if _, ok := tsigAlgorithm(p.TSIGAlgorithm); !ok {
+			return nil, fmt.Errorf("rfc2136: unsupported TSIG algorithm '%s'", p.TSIGAlgorithm)
+		}
+	}
+	if timeout := os.Getenv("RFC2136_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("rfc2136: invalid timeout '%s'", timeout)
+		}
+		p.Timeout = d
+	}
+	return p, nil
+}
+
+// Present adds the TXT record of the challenge.
+func (p *RFC2136Provider) Present(domain, token, keyAuth string) error {
+	name, value := dnsChallengeRecord(domain, keyAuth)
+	return p.update(name, value, true)
+}
+
+// CleanUp removes the TXT record of the challenge.
+func (p *RFC2136Provider) CleanUp(domain, token, keyAuth string) error {
+	name, value := dnsChallengeRecord(domain, keyAuth)
+	return p.update(name, value, false)
+}
+
+// dnsChallengeRecord returns the name and value of the
+// TXT record that answers the DNS challenge for domain.
+func dnsChallengeRecord(domain, keyAuth string) (string, string) {
+	sum := sha256.Sum256([]byte(keyAuth))
+	value := base64.RawURLEncoding.EncodeToString(sum[:])
+	return "_acme-challenge." + fqdn(domain), value
+}
+
+// fqdn returns name with a trailing dot.
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// DNS message constants used by the provider.
+const (
+	dnsTypeSOA  = 6
+	dnsTypeTXT  = 16
+	dnsTypeTSIG = 250
+
+	dnsClassIN   = 1
+	dnsClassNone = 254
+	dnsClassAny  = 255
+
+	dnsOpcodeUpdate = 5
+	dnsFlagTC       = 1 << 9
+
+	tsigFudge = 300
+)
+
+// update adds the TXT record name with value, or deletes it.
+func (p *RFC2136Provider) update(name, value string, add bool) error {
+	zone := p.Zone
+	if zone == "" {
+		var err error
+		zone, err = p.findZone(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	var rr bytes.Buffer
+	class, ttl := uint16(dnsClassIN), p.TTL
+	if !add {
+		// class NONE deletes the record with this value (RFC 2136 §2.5.4)
+		class, ttl = dnsClassNone, 0
+	}
+	rdata := append([]byte{byte(len(value))}, value...)
+	if err := packRR(&rr, name, dnsTypeTXT, class, ttl, rdata); err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	id := newDNSID()
+	// header: ZOCOUNT 1, PRCOUNT 0, UPCOUNT 1, ADCOUNT 0
+	writeUint16s(&msg, id, dnsOpcodeUpdate<<11, 1, 0, 1, 0)
+	if err := packName(&msg, fqdn(zone)); err != nil {
+		return err
+	}
+	writeUint16s(&msg, dnsTypeSOA, dnsClassIN)
+	msg.Write(rr.Bytes())
+
+	request := msg.Bytes()
+	if p.TSIGKey != "" {
+		var err error
+		request, err = p.sign(request, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := p.exchange(request, id)
+	if err != nil {
+		return err
+	}
+	if rcode := resp[3] & 0x0f; rcode != 0 {
+		return fmt.Errorf("rfc2136: updating %s in zone %s: %s", name, zone, rcodeName(rcode))
+	}
+	return nil
+}
+
+// findZone returns the zone of name, from the SOA record that
+// the nameserver answers or refers to when asked for name.
+func (p *RFC2136Provider) findZone(name string) (string, error) {
+	var msg bytes.Buffer
+	id := newDNSID()
+	writeUint16s(&msg, id, 0, 1, 0, 0, 0)
+	if err := packName(&msg, name); err != nil {
+		return "", err
+	}
+	writeUint16s(&msg, dnsTypeSOA, dnsClassIN)
+
+	resp, err := p.exchange(msg.Bytes(), id)
+	if err != nil {
+		return "", err
+	}
+	zone, err := soaOwner(resp)
+	if err != nil {
+		return "", fmt.Errorf("rfc2136: finding zone of %s: %v", name, err)
+	}
+	return zone, nil
+}
+
+// soaOwner returns the owner of the first SOA record in the
+// answer or authority sections of the DNS message msg.
+func soaOwner(msg []byte) (string, error) {
+	if len(msg) < 12 {
+		return "", errors.New("short message")
+	}
+	if rcode := msg[3] & 0x0f; rcode != 0 && rcode != 3 { // NXDOMAIN still has the SOA
+		return "", errors.New(rcodeName(rcode))
+	}
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	rrcount := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:]))
+	off := 12
+	for i := 0; i < qdcount; i++ {
+		_, next, err := readName(msg, off)
+		if err != nil {
+			return "", err
+		}
+		off = next + 4
+	}
+	for i := 0; i < rrcount; i++ {
+		name, next, err := readName(msg, off)
+		if err != nil {
+			return "", err
+		}
+		if next+10 > len(msg) {
+			return "", errors.New("short record")
+		}
+		rrtype := binary.BigEndian.Uint16(msg[next:])
+		rdlength := int(binary.BigEndian.Uint16(msg[next+8:]))
+		if rrtype == dnsTypeSOA {
+			return name, nil
+		}
+		off = next + 10 + rdlength
+	}
+	return "", errors.New("no SOA record; set RFC2136_ZONE")
+}
+
+// sign returns msg with a TSIG record signed at now appended.
+func (p *RFC2136Provider) sign(msg []byte, now time.Time) ([]byte, error) {
+	newHash, _ := tsigAlgorithm(p.TSIGAlgorithm)
+	algorithm := tsigAlgorithmName(p.TSIGAlgorithm)
+	key := strings.ToLower(fqdn(p.TSIGKey))
+
+	// the variables covered by the MAC (RFC 2845 §3.4.2)
+	var vars bytes.Buffer
+	if err := packName(&vars, key); err != nil {
+		return nil, err
+	}
+	writeUint16s(&vars, dnsClassAny, 0, 0) // class, TTL
+	if err := packName(&vars, algorithm); err != nil {
+		return nil, err
+	}
+	signed := uint64(now.Unix())
+	writeUint16s(&vars, uint16(signed>>32), uint16(signed>>16), uint16(signed), tsigFudge, 0, 0) // time, fudge, error, other length
+
+	mac := hmac.New(newHash, p.TSIGSecret)
+	mac.Write(msg)
+	mac.Write(vars.Bytes())
+	sum := mac.Sum(nil)
+
+	var rdata bytes.Buffer
+	packName(&rdata, algorithm)
+	writeUint16s(&rdata, uint16(signed>>32), uint16(signed>>16), uint16(signed), tsigFudge, uint16(len(sum)))
+	rdata.Write(sum)
+	writeUint16s(&rdata, binary.BigEndian.Uint16(msg), 0, 0) // original ID, error, other length
+
+	signedMsg := bytes.NewBuffer(append([]byte(nil), msg...))
+	if err := packRR(signedMsg, key, dnsTypeTSIG, dnsClassAny, 0, rdata.Bytes()); err != nil {
+		return nil, err
+	}
+	b := signedMsg.Bytes()
+	binary.BigEndian.PutUint16(b[10:], binary.BigEndian.Uint16(b[10:])+1) // ARCOUNT
+	return b, nil
+}
+
+// exchange sends msg to the nameserver over UDP, or over TCP if the
+// response is truncated, and returns the response to the ID id.
+func (p *RFC2136Provider) exchange(msg []byte, id uint16) ([]byte, error) {
+	resp, err := p.exchangeOver("udp", msg, id)
+	if err == nil && binary.BigEndian.Uint16(resp[2:])&dnsFlagTC != 0 {
+		resp, err = p.exchangeOver("tcp", msg, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rfc2136: %s: %v", p.Nameserver, err)
+	}
+	return resp, nil
+}
+
+func (p *RFC2136Provider) exchangeOver(network string, msg []byte, id uint16) ([]byte, error) {
+	conn, err := net.DialTimeout(network, p.Nameserver, p.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(p.Timeout))
+
+	if network == "tcp" {
+		length := make([]byte, 2)
+		binary.BigEndian.PutUint16(length, uint16(len(msg)))
+		if _, err := conn.Write(append(length, msg...)); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return nil, err
+		}
+		resp := make([]byte, binary.BigEndian.Uint16(length))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, err
+		}
+		if len(resp) < 12 || binary.BigEndian.Uint16(resp) != id {
+			return nil, errors.New("invalid response")
+		}
+		return resp, nil
+	}
+
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// ignore stray responses to other queries
+		if n >= 12 && binary.BigEndian.Uint16(buf) == id {
+			return buf[:n], nil
+		}
+	}
+}
+
+// tsigAlgorithm returns the hash function of the TSIG algorithm
+// name, and whether it is supported.
+func tsigAlgorithm(name string) (func() hash.Hash, bool) {
+	switch tsigAlgorithmName(name) {
+	case "hmac-md5.sig-alg.reg.int.":
+		return md5.New, true
+	case "hmac-sha1.":
+		return sha1.New, true
+	case "hmac-sha256.":
+		return sha256.New, true
+	case "hmac-sha512.":
+		return sha512.New, true
+	}
+	return nil, false
+}
+
+// tsigAlgorithmName returns the canonical domain name of
+// the TSIG algorithm name, which defaults to hmac-sha256.
+func tsigAlgorithmName(name string) string {
+	name = strings.ToLower(fqdn(name))
+	switch name {
+	case ".":
+		return "hmac-sha256."
+	case "hmac-md5.":
+		return "hmac-md5.sig-alg.reg.int."
+	}
+	return name
+}
+
+// rcodeName returns the name of a DNS response code.
+func rcodeName(rcode byte) string {
+	names := map[byte]string{
+		1: "FORMERR", 2: "SERVFAIL", 3: "NXDOMAIN", 4: "NOTIMP", 5: "REFUSED",
+		6: "YXDOMAIN", 7: "YXRRSET", 8: "NXRRSET", 9: "NOTAUTH", 10: "NOTZONE",
+	}
+	if name, ok := names[rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+// packRR writes a resource record to buf.
+func packRR(buf *bytes.Buffer, name string, rrtype, class uint16, ttl uint32, rdata []byte) error {
+	if err := packName(buf, name); err != nil {
+		return err
+	}
+	writeUint16s(buf, rrtype, class, uint16(ttl>>16), uint16(ttl), uint16(len(rdata)))
+	buf.Write(rdata)
+	return nil
+}
+
+// packName writes the domain name name, which must be
+// fully qualified, to buf without compression.
+func packName(buf *bytes.Buffer, name string) error {
+	if !strings.HasSuffix(name, ".") || len(name) > 254 {
+		return fmt.Errorf("rfc2136: invalid domain name '%s'", name)
+	}
+	if name == "." {
+		buf.WriteByte(0)
+		return nil
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return fmt.Errorf("rfc2136: invalid domain name '%s'", name)
+		}
+		buf.WriteByte(byte(len(label)))
+		buf.WriteString(label)
+	}
+	buf.WriteByte(0)
+	return nil
+}
+
+// readName reads the possibly compressed domain name at off
+// in msg, and returns it and the offset of what follows it.
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errors.New("short name")
+		}
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case length&0xc0 == 0xc0:
+			if off+1 >= len(msg) || jumps > 64 {
+				return "", 0, errors.New("invalid name compression")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			jumps++
+		default:
+			if off+1+length > len(msg) {
+				return "", 0, errors.New("short label")
+			}
+			labels = append(labels, string(msg[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
+
+// writeUint16s writes the values to buf in network byte order.
+func writeUint16s(buf *bytes.Buffer, values ...uint16) {
+	b := make([]byte, 2)
+	for _, v := range values {
+		binary.BigEndian.PutUint16(b, v)
+		buf.Write(b)
+	}
+}
+
+// newDNSID returns a random message ID.
+func newDNSID() uint16 {
+	b := make([]byte, 2)
+	rand.Read(b)
+	return binary.BigEndian.Uint16(b)
+}
@@ -0,0 +1,201 @@
+package caddytls
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+)
+
+// fakeUpdate is an update received by the fake nameserver.
+type fakeUpdate struct {
+	zone, name, value string
+	class             uint16
+	signed            bool
+}
+
+// fakeNameserver answers SOA queries with the zone example.com
+// and applies updates signed with secret, sending them to updates.
+func fakeNameserver(t *testing.T, secret []byte, updates chan<- fakeUpdate) net.PacketConn {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			msg := append([]byte(nil), buf[:n]...)
+			resp := make([]byte, 12)
+			copy(resp, msg[:12])
+			resp[2] |= 0x80 // QR
+			if msg[2]>>3&0x0f == 0 {
+				// NXDOMAIN, with the SOA of the zone in the authority section,
+				// its name compressed to point into the question
+				qname, next, _ := readName(msg, 12)
+				resp = append(resp, msg[12:next+4]...)
+				binary.BigEndian.PutUint16(resp[4:], 1)
+				binary.BigEndian.PutUint16(resp[8:], 1)
+				resp[3] = 3
+				zoneOff := 12 + strings.Index(qname, "example.com.")
+				resp = append(resp, 0xc0|byte(zoneOff>>8), byte(zoneOff))
+				resp = append(resp, 0, dnsTypeSOA, 0, dnsClassIN, 0, 0, 0, 60, 0, 0)
+				pc.WriteTo(resp, addr)
+				continue
+			}
+
+			var u fakeUpdate
+			zone, off, _ := readName(msg, 12)
+			u.zone = zone
+			name, off, _ := readName(msg, off+4)
+			u.name = name
+			u.class = binary.BigEndian.Uint16(msg[off+2:])
+			rdlength := int(binary.BigEndian.Uint16(msg[off+8:]))
+			u.value = string(msg[off+11 : off+10+rdlength])
+			end := off + 10 + rdlength
+
+			if binary.BigEndian.Uint16(msg[10:]) == 1 {
+				// verify the TSIG record
+				key, next, _ := readName(msg, end)
+				rdata := msg[next+10:]
+				alg, algEnd, _ := readName(rdata, 0)
+				macSize := int(binary.BigEndian.Uint16(rdata[algEnd+8:]))
+				mac := rdata[algEnd+10 : algEnd+10+macSize]
+
+				unsigned := append([]byte(nil), msg[:end]...)
+				binary.BigEndian.PutUint16(unsigned[10:], 0)
+				var vars bytes.Buffer
+				packName(&vars, key)
+				vars.Write([]byte{0, dnsClassAny, 0, 0, 0, 0})
+				packName(&vars, alg)
+				vars.Write(rdata[algEnd : algEnd+8]) // time signed, fudge
+				vars.Write([]byte{0, 0, 0, 0})
+				h := hmac.New(sha256.New, secret)
+				h.Write(unsigned)
+				h.Write(vars.Bytes())
+				u.signed = key == "acme-key." && alg == "hmac-sha256." && hmac.Equal(mac, h.Sum(nil))
+			}
+			if !u.signed {
+				resp[3] = 5 // REFUSED
+			}
+			updates <- u
+			pc.WriteTo(resp, addr)
+		}
+	}()
+	return pc
+}
+
+func TestRFC2136Provider(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	updates := make(chan fakeUpdate, 10)
+	pc := fakeNameserver(t, secret, updates)
+	defer pc.Close()
+
+	prov, err := NewRFC2136Provider(pc.LocalAddr().String(), "acme-key", base64.StdEncoding.EncodeToString(secret))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	name, value := dnsChallengeRecord("sub.example.com", "token.thumbprint")
+
+	if err := prov.Present("sub.example.com", "token", "token.thumbprint"); err != nil {
+		t.Fatalf("Expected no error presenting, got: %v", err)
+	}
+	expected := fakeUpdate{zone: "example.com.", name: name, value: value, class: dnsClassIN, signed: true}
+	if u := <-updates; u != expected {
+		t.Errorf("Expected update %+v, got %+v", expected, u)
+	}
+
+	if err := prov.CleanUp("sub.example.com", "token", "token.thumbprint"); err != nil {
+		t.Fatalf("Expected no error cleaning up, got: %v", err)
+	}
+	expected.class = dnsClassNone
+	if u := <-updates; u != expected {
+		t.Errorf("Expected update %+v, got %+v", expected, u)
+	}
+
+	// updates signed with the wrong secret are refused
+	prov, err = NewRFC2136Provider(pc.LocalAddr().String(), "acme-key", base64.StdEncoding.EncodeToString([]byte("wrong")))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	prov.(*RFC2136Provider).Zone = "example.com"
+	if err := prov.Present("sub.example.com", "token", "token.thumbprint"); err == nil || !strings.Contains(err.Error(), "REFUSED") {
+		t.Errorf("Expected REFUSED error, got: %v", err)
+	}
+	<-updates
+}
+
+func TestNewRFC2136Provider(t *testing.T) {
+	for i, test := range []struct {
+		credentials []string
+		shouldErr   bool
+		nameserver  string
+	}{
+		{[]string{"ns1.example.com"}, false, "ns1.example.com:53"},
+		{[]string{"[::1]:5353", "key", "c2VjcmV0", "hmac-sha512"}, false, "[::1]:5353"},
+		{[]string{"ns1", "key", "c2VjcmV0", "HMAC-MD5"}, false, "ns1:53"},
+		{[]string{""}, true, ""},
+		{[]string{"ns1", "key", "!!"}, true, ""},
+		{[]string{"ns1", "key", "c2VjcmV0", "hmac-sha3"}, true, ""},
+		{[]string{"ns1", "key", "c2VjcmV0", "hmac-sha256", "extra"}, true, ""},
+	} {
+		prov, err := NewRFC2136Provider(test.credentials...)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if got := prov.(*RFC2136Provider).Nameserver; got != test.nameserver {
+			t.Errorf("Test %d: Expected nameserver '%s', got '%s'", i, test.nameserver, got)
+		}
+	}
+}
+
+func TestSetupDNSCredentials(t *testing.T) {
+	cfg := new(Config)
+	RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+	c := caddy.NewTestController("", "tls {\n dns rfc2136 ns1.example.com acme-key c2VjcmV0\n}")
+
+	if err := setupTLS(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	if cfg.DNSProvider != "rfc2136" {
+		t.Errorf("Expected DNS provider rfc2136, got '%s'", cfg.DNSProvider)
+	}
+	if strings.Join(cfg.DNSCredentials, " ") != "ns1.example.com acme-key c2VjcmV0" {
+		t.Errorf("Expected DNS credentials, got %v", cfg.DNSCredentials)
+	}
+}
+
+func TestTSIGTimeSigned(t *testing.T) {
+	p := &RFC2136Provider{TSIGKey: "k", TSIGSecret: []byte("s")}
+	msg := make([]byte, 12)
+	signed, err := p.sign(msg, time.Unix(0x123456789a, 0))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if binary.BigEndian.Uint16(signed[10:]) != 1 {
+		t.Error("Expected ARCOUNT to count the TSIG record")
+	}
+	// the rdata starts with the algorithm name and the 48-bit time
+	rdata := signed[12+3+10:]
+	_, off, _ := readName(rdata, 0)
+	if !bytes.Equal(rdata[off:off+6], []byte{0, 0x12, 0x34, 0x56, 0x78, 0x9a}) {
+		t.Errorf("Expected 48-bit time signed, got %x", rdata[off:off+6])
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -105,6 +106,7 @@ func setupTLS(c *caddy.Controller) error {
 					}
 					config.Ciphers = append(config.Ciphers, value)
 				}
+				config.Ciphers = orderCiphers(config.Ciphers)
 			case "curves":
 				for c.NextArg() {
 					value, ok := supportedCurvesMap[strings.ToUpper(c.Val())]
@@ -113,6 +115,12 @@ func setupTLS(c *caddy.Controller) error {
 					}
 					config.CurvePreferences = append(config.CurvePreferences, value)
 				}
+			case "alpn":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return c.ArgErr()
+				}
+				config.ALPN = args
 			case "clients":
 				clientCertList := c.RemainingArgs()
 				if len(clientCertList) == 0 {
@@ -146,7 +154,7 @@ func setupTLS(c *caddy.Controller) error {
 				config.OnDemand = true
 			case "dns":
 				args := c.RemainingArgs()
-				if len(args) != 1 {
+				if len(args) == 0 {
 					return c.ArgErr()
 				}
 				dnsProvName := args[0]
@@ -154,6 +162,7 @@ func setupTLS(c *caddy.Controller) error {
 					return c.Errf("Unsupported DNS provider '%s'", args[0])
 				}
 				config.DNSProvider = args[0]
+				config.DNSCredentials = args[1:]
 			case "storage":
 				args := c.RemainingArgs()
 				if len(args) != 1 {
@@ -166,6 +175,23 @@ func setupTLS(c *caddy.Controller) error {
 				config.StorageProvider = args[0]
 			case "muststaple":
 				config.MustStaple = true
+			case "shared_challenges":
+				config.SharedChallenges = true
+			case "staging_first":
+				config.StagingFirst = true
+			case "ct_monitor":
+				args := c.RemainingArgs()
+				if len(args) > 1 {
+					return c.ArgErr()
+				}
+				config.CTMonitor = true
+				if len(args) == 1 {
+					u, err := url.Parse(args[0])
+					if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+						return c.Errf("Invalid ct_monitor webhook '%s'", args[0])
+					}
+					config.CTWebhook = args[0]
+				}
 			default:
 				return c.Errf("Unknown keyword '%s'", c.Val())
 			}
@@ -210,6 +236,13 @@ func setupTLS(c *caddy.Controller) error {
 
 	SetDefaultTLSParams(config)
 
+	// answer the challenges of other instances sharing the storage
+	if config.SharedChallenges {
+		if _, err := shareChallenges(config); err != nil {
+			return fmt.Errorf("shared_challenges: %v", err)
+		}
+	}
+
 	// generate self-signed cert if needed
 	if config.SelfSigned {
 		err := makeSelfSignedCert(config)
@@ -291,7 +324,7 @@ func loadCertsInDir(c *caddy.Controller, dir string) error {
 				return c.Errf("%s: no private key block found", path)
 			}
 
-			err = cacheUnmanagedCertificatePEMBytes(certPEMBytes, keyPEMBytes)
+			err = cacheUnmanagedCertificatePEMBytes(certPEMBytes, keyPEMBytes, path)
 			if err != nil {
 				return c.Errf("%s: failed to load cert and key for '%s': %v", path, c.Key, err)
 			}
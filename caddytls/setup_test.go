@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/mholt/caddy"
@@ -103,6 +104,7 @@ func TestSetupParseWithOptionalParams(t *testing.T) {
 	params := `tls ` + certFile + ` ` + keyFile + ` {
             protocols tls1.0 tls1.2
             ciphers RSA-AES256-CBC-SHA ECDHE-RSA-AES128-GCM-SHA256 ECDHE-ECDSA-AES256-GCM-SHA384
+            alpn http/1.1
             muststaple
         }`
 	cfg := new(Config)
@@ -126,6 +128,20 @@ func TestSetupParseWithOptionalParams(t *testing.T) {
 		t.Errorf("Expected 3 Ciphers (not including TLS_FALLBACK_SCSV), got %v", len(cfg.Ciphers)-1)
 	}
 
+	expectedCiphers := []uint16{
+		tls.TLS_FALLBACK_SCSV,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	}
+	if !reflect.DeepEqual(cfg.Ciphers, expectedCiphers) {
+		t.Errorf("Expected ciphers ordered strongest first %v, got %v", expectedCiphers, cfg.Ciphers)
+	}
+
+	if !reflect.DeepEqual(cfg.ALPN, []string{"http/1.1"}) {
+		t.Errorf("Expected ALPN protocols [http/1.1], got %v", cfg.ALPN)
+	}
+
 	if !cfg.MustStaple {
 		t.Errorf("Expected must staple to be true")
 	}
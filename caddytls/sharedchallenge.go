@@ -0,0 +1,117 @@
+package caddytls
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ChallengeStorage is implemented by Storage that can share the
+// key authorizations of HTTP challenges between Caddy instances,
+// so that any instance behind a load balancer can answer the
+// challenge for a certificate another instance is obtaining.
+type ChallengeStorage interface {
+	// StoreChallenge persists keyAuth, the answer to the
+	// challenge with token for domain.
+	StoreChallenge(domain, token, keyAuth string) error
+
+	// LoadChallenge returns the answer to the challenge with
+	// token for domain. If there is no such challenge, an error
+	// value of type ErrNotExist is returned.
+	LoadChallenge(domain, token string) (string, error)
+
+	// DeleteChallenge deletes the challenge with token for domain.
+	DeleteChallenge(domain, token string) error
+}
+
+// sharedChallengeSolver solves HTTP challenges by storing their
+// answers, which every instance using the storage serves.
+type sharedChallengeSolver struct {
+	storage ChallengeStorage
+}
+
+// Present stores the answer to the challenge.
+func (s sharedChallengeSolver) Present(domain, token, keyAuth string) error {
+	return s.storage.StoreChallenge(domain, token, keyAuth)
+}
+
+// CleanUp deletes the answer to the challenge.
+func (s sharedChallengeSolver) CleanUp(domain, token, keyAuth string) error {
+	return s.storage.DeleteChallenge(domain, token)
+}
+
+var errStorageCannotShare = errors.New("storage cannot share challenges")
+
+// challengeStorages are the storages of the configs that share
+// their challenges, by storage provider and CA URL.
+var challengeStorages = make(map[string]ChallengeStorage)
+var challengeStoragesMu sync.RWMutex
+
+// shareChallenges makes the HTTP challenge handler answer the
+// challenges in the storage of c, which must implement
+// ChallengeStorage.
+func shareChallenges(c *Config) (ChallengeStorage, error) {
+	storage, err := c.StorageFor(c.CAUrl)
+	if err != nil {
+		return nil, err
+	}
+	cs, ok := storage.(ChallengeStorage)
+	if !ok {
+		return nil, errStorageCannotShare
+	}
+	caURL := c.CAUrl
+	if caURL == "" {
+		caURL = DefaultCAUrl
+	}
+	challengeStoragesMu.Lock()
+	challengeStorages[c.StorageProvider+" "+caURL] = cs
+	challengeStoragesMu.Unlock()
+	return cs, nil
+}
+
+// serveSharedChallenge answers r if it is the request for a
+// challenge in a shared storage, and returns whether it did.
+func serveSharedChallenge(w http.ResponseWriter, r *http.Request) bool {
+	token := strings.TrimPrefix(r.URL.Path, challengeBasePath+"/")
+	if !validChallengeToken(token) {
+		return false
+	}
+	domain, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		domain = r.Host
+	}
+	domain = strings.ToLower(domain)
+	if domain == "" || strings.ContainsAny(domain, `/\`) || strings.Contains(domain, "..") {
+		return false
+	}
+
+	challengeStoragesMu.RLock()
+	defer challengeStoragesMu.RUnlock()
+	for _, cs := range challengeStorages {
+		keyAuth, err := cs.LoadChallenge(domain, token)
+		if err != nil {
+			continue
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, keyAuth)
+		return true
+	}
+	return false
+}
+
+// validChallengeToken returns whether token consists of only
+// the base64url characters that ACME tokens are made of.
+func validChallengeToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, ch := range token {
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '-' || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
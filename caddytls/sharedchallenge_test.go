@@ -0,0 +1,90 @@
+package caddytls
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/mholt/caddy"
+)
+
+func TestSharedChallenges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddytls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	storage := &FileStorage{Path: dir, nameLocks: make(map[string]*sync.WaitGroup)}
+
+	challengeStoragesMu.Lock()
+	challengeStorages["test"] = storage
+	challengeStoragesMu.Unlock()
+	defer func() {
+		challengeStoragesMu.Lock()
+		delete(challengeStorages, "test")
+		challengeStoragesMu.Unlock()
+	}()
+
+	// another instance presents the challenge
+	solver := sharedChallengeSolver{storage: storage}
+	if err := solver.Present("Example.com", "tok-EN_1", "tok-EN_1.thumbprint"); err != nil {
+		t.Fatalf("Expected no error presenting challenge, got: %v", err)
+	}
+
+	for i, test := range []struct {
+		url      string
+		handled  bool
+		expected string
+	}{
+		{"http://example.com/.well-known/acme-challenge/tok-EN_1", true, "tok-EN_1.thumbprint"},
+		{"http://EXAMPLE.com:80/.well-known/acme-challenge/tok-EN_1", true, "tok-EN_1.thumbprint"},
+		{"http://example.com/.well-known/acme-challenge/other", false, ""},
+		{"http://other.com/.well-known/acme-challenge/tok-EN_1", false, ""},
+		{"http://example.com/.well-known/acme-challenge/../tok-EN_1", false, ""},
+		{"http://example.com/tok-EN_1", false, ""},
+	} {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not craft request, got error: %v", i, err)
+		}
+		rw := httptest.NewRecorder()
+		if got := HTTPChallengeHandler(rw, req, DefaultHTTPAlternatePort); got != test.handled {
+			t.Errorf("Test %d: Expected handled to be %v, got %v", i, test.handled, got)
+		}
+		if test.handled && rw.Body.String() != test.expected {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.expected, rw.Body.String())
+		}
+	}
+
+	if err := solver.CleanUp("example.com", "tok-EN_1", "tok-EN_1.thumbprint"); err != nil {
+		t.Fatalf("Expected no error cleaning up challenge, got: %v", err)
+	}
+	req, _ := http.NewRequest("GET", "http://example.com/.well-known/acme-challenge/tok-EN_1", nil)
+	if HTTPChallengeHandler(httptest.NewRecorder(), req, DefaultHTTPAlternatePort) {
+		t.Error("Expected challenge not to be answered after clean up")
+	}
+}
+
+func TestSetupSharedChallenges(t *testing.T) {
+	defer func(caURL string) { DefaultCAUrl = caURL }(DefaultCAUrl)
+	DefaultCAUrl = "https://ca.example.com/directory"
+	cfg := new(Config)
+	RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+	c := caddy.NewTestController("", "tls {\n shared_challenges\n}")
+
+	if err := setupTLS(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	if !cfg.SharedChallenges {
+		t.Error("Expected shared challenges to be enabled")
+	}
+	challengeStoragesMu.RLock()
+	_, ok := challengeStorages["file "+DefaultCAUrl]
+	challengeStoragesMu.RUnlock()
+	if !ok {
+		t.Error("Expected the storage to be used to answer challenges")
+	}
+}
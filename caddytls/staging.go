@@ -0,0 +1,102 @@
+package caddytls
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+)
+
+// StagingCAUrl is the directory endpoint of the staging
+// environment of the default CA, which does not count
+// issuances against the production rate limits.
+const StagingCAUrl = "https://acme-staging.api.letsencrypt.org/directory"
+
+// caURL returns the URL of the CA that c obtains certificates from.
+func (c *Config) caURL() string {
+	if c.CAUrl != "" {
+		return c.CAUrl
+	}
+	return DefaultCAUrl
+}
+
+// rehearse obtains a certificate for name from the staging CA
+// and makes sure it serves a valid chain, before a certificate
+// is obtained from the production CA.
+func (c *Config) rehearse(name string, allowPrompts bool) error {
+	staging := *c
+	staging.CAUrl = StagingCAUrl
+	err := staging.ObtainCert(name, allowPrompts)
+	if err != nil {
+		return fmt.Errorf("obtaining staging certificate: %v", err)
+	}
+
+	storage, err := staging.StorageFor(staging.CAUrl)
+	if err != nil {
+		return err
+	}
+	siteData, err := storage.LoadSite(name)
+	if err != nil {
+		return fmt.Errorf("loading staging certificate: %v", err)
+	}
+	cert, err := tls.X509KeyPair(siteData.Cert, siteData.Key)
+	if err != nil {
+		return fmt.Errorf("loading staging certificate: %v", err)
+	}
+	if err := checkServedChain(name, cert); err != nil {
+		return fmt.Errorf("staging certificate: %v", err)
+	}
+	log.Printf("[INFO][%s] Staging certificate serves a valid chain", name)
+	return nil
+}
+
+// checkServedChain serves cert on an internal port and checks
+// that the chain a client gets is valid for name: the first
+// certificate is for name, each is signed by the next, and
+// all are currently valid. The root need not be trusted.
+func checkServedChain(name string, cert tls.Certificate) error {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn.(*tls.Conn).Handshake()
+		conn.Close()
+	}()
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", ln.Addr().String(), &tls.Config{
+		ServerName:         name,
+		InsecureSkipVerify: true, // the staging root is not trusted; the chain is checked below
+	})
+	if err != nil {
+		return err
+	}
+	chain := conn.ConnectionState().PeerCertificates
+	conn.Close()
+
+	if len(chain) < 2 {
+		return errors.New("served chain has no intermediate certificate")
+	}
+	if err := chain[0].VerifyHostname(name); err != nil {
+		return err
+	}
+	now := time.Now()
+	for i, c := range chain {
+		if now.Before(c.NotBefore) || now.After(c.NotAfter) {
+			return fmt.Errorf("certificate %d of served chain is not currently valid", i)
+		}
+		if i+1 < len(chain) {
+			if err := c.CheckSignatureFrom(chain[i+1]); err != nil {
+				return fmt.Errorf("certificate %d of served chain is not signed by the next: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package caddytls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+)
+
+func TestCheckServedChain(t *testing.T) {
+	now := time.Now()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake Staging Intermediate"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "staging.example.com"},
+		DNSNames:     []string{"staging.example.com"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, caTemplate, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, leafTemplate, &leafKey.PublicKey, leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		name      string
+		chain     [][]byte
+		shouldErr bool
+	}{
+		{"staging.example.com", [][]byte{leafDER, caDER}, false},
+		{"other.example.com", [][]byte{leafDER, caDER}, true},
+		{"staging.example.com", [][]byte{leafDER}, true},
+		{"staging.example.com", [][]byte{leafDER, otherDER}, true},
+	} {
+		err := checkServedChain(test.name, tls.Certificate{Certificate: test.chain, PrivateKey: leafKey})
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error, got none", i)
+		}
+		if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+	}
+}
+
+func TestSetupStagingFirst(t *testing.T) {
+	cfg := new(Config)
+	RegisterConfigGetter("", func(c *caddy.Controller) *Config { return cfg })
+	if err := setupTLS(caddy.NewTestController("", "tls {\n staging_first\n}")); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	if !cfg.StagingFirst {
+		t.Error("Expected staging first to be enabled")
+	}
+
+	defer func(caURL string) { DefaultCAUrl = caURL }(DefaultCAUrl)
+	DefaultCAUrl = StagingCAUrl
+	if cfg.caURL() != StagingCAUrl {
+		t.Errorf("Expected the default CA to be used, got '%s'", cfg.caURL())
+	}
+	cfg.CAUrl = "https://ca.example.com/directory"
+	if cfg.caURL() != cfg.CAUrl {
+		t.Errorf("Expected the config's CA to be used, got '%s'", cfg.caURL())
+	}
+}
@@ -98,8 +98,6 @@ func getEmail(storage Storage, userPresent bool) string {
 // users to the disk or register them via ACME. It does
 // NOT prompt the user.
 func getUser(storage Storage, email string) (User, error) {
-	var user User
-
 	// open user reg
 	userData, err := storage.LoadUser(email)
 	if err != nil {
@@ -107,17 +105,22 @@ func getUser(storage Storage, email string) (User, error) {
 			// create a new user
 			return newUser(email)
 		}
-		return user, err
+		return User{}, err
 	}
 
-	// load user information
-	err = json.Unmarshal(userData.Reg, &user)
-	if err != nil {
+	// load user information and their private key
+	return decodeUser(userData)
+}
+
+// decodeUser decodes the user whose registration
+// and private key are data.
+func decodeUser(data *UserData) (User, error) {
+	var user User
+	if err := json.Unmarshal(data.Reg, &user); err != nil {
 		return user, err
 	}
-
-	// load their private key
-	user.key, err = loadPrivateKey(userData.Key)
+	var err error
+	user.key, err = loadPrivateKey(data.Key)
 	return user, err
 }
 
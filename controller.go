@@ -17,6 +17,9 @@ type Controller struct {
 	// The instance in which the setup is occurring
 	instance *Instance
 
+	// directive is the name of the directive being set up
+	directive string
+
 	// Key is the key from the top of the server block, usually
 	// an address, hostname, or identifier of some sort.
 	Key string
@@ -54,34 +57,45 @@ func (c *Controller) ServerType() string {
 	return c.instance.serverType
 }
 
+// Directive returns the name of the directive being set up.
+func (c *Controller) Directive() string {
+	return c.directive
+}
+
 // OnFirstStartup adds fn to the list of callback functions to execute
 // when the server is about to be started NOT as part of a restart.
 func (c *Controller) OnFirstStartup(fn func() error) {
-	c.instance.onFirstStartup = append(c.instance.onFirstStartup, fn)
+	c.instance.onFirstStartup = append(c.instance.onFirstStartup, c.callback(fn))
 }
 
 // OnStartup adds fn to the list of callback functions to execute
 // when the server is about to be started (including restarts).
 func (c *Controller) OnStartup(fn func() error) {
-	c.instance.onStartup = append(c.instance.onStartup, fn)
+	c.instance.onStartup = append(c.instance.onStartup, c.callback(fn))
 }
 
 // OnRestart adds fn to the list of callback functions to execute
 // when the server is about to be restarted.
 func (c *Controller) OnRestart(fn func() error) {
-	c.instance.onRestart = append(c.instance.onRestart, fn)
+	c.instance.onRestart = append(c.instance.onRestart, c.callback(fn))
 }
 
 // OnShutdown adds fn to the list of callback functions to execute
 // when the server is about to be shut down (including restarts).
 func (c *Controller) OnShutdown(fn func() error) {
-	c.instance.onShutdown = append(c.instance.onShutdown, fn)
+	c.instance.onShutdown = append(c.instance.onShutdown, c.callback(fn))
 }
 
 // OnFinalShutdown adds fn to the list of callback functions to execute
 // when the server is about to be shut down NOT as part of a restart.
 func (c *Controller) OnFinalShutdown(fn func() error) {
-	c.instance.onFinalShutdown = append(c.instance.onFinalShutdown, fn)
+	c.instance.onFinalShutdown = append(c.instance.onFinalShutdown, c.callback(fn))
+}
+
+// callback returns fn as a callback of the directive
+// and the server block of c.
+func (c *Controller) callback(fn func() error) callback {
+	return callback{fn: fn, block: strings.Join(c.ServerBlockKeys, " "), directive: c.directive}
 }
 
 // Context gets the context associated with the instance associated with c.
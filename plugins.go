@@ -134,6 +134,24 @@ type Context interface {
 	MakeServers() ([]Server, error)
 }
 
+// InPlaceReloader is a Context whose servers, once running, can
+// take over the sites of servers made by another Context of the
+// same server type, so that changes to directives that can be
+// reloaded in place are applied without restarting them.
+type InPlaceReloader interface {
+	// ReplaceSites returns a function that makes the servers made
+	// by the Context serve the sites of servers instead of the
+	// same sites they serve, or an error if that is not possible,
+	// in which case the servers must be restarted instead.
+	ReplaceSites(servers []Server) (func(), error)
+
+	// ReloadContext returns a new Context in which only the
+	// directives that can be reloaded in place are set up again.
+	// Each of its sites starts out as the running site with the
+	// same key, without what those directives set up on it.
+	ReloadContext() Context
+}
+
 // RegisterServerType registers a server type srv by its
 // name, typeName.
 func RegisterServerType(typeName string, srv ServerType) {
@@ -176,6 +194,13 @@ type Plugin struct {
 	// Action is the plugin's setup function, if associated
 	// with a directive in the Caddyfile.
 	Action SetupFunc
+
+	// ReloadInPlace is whether changes to the directive can be
+	// applied by setting up the server blocks it changed in again,
+	// without restarting the servers. This is only the case if
+	// Action adds nothing but request handling, such as middleware,
+	// and does not affect listeners or other server settings.
+	ReloadInPlace bool
 }
 
 // RegisterPlugin plugs in plugin. All plugins should register
@@ -236,6 +261,18 @@ func DirectiveAction(serverType, dir string) (SetupFunc, error) {
 		dir, serverType)
 }
 
+// DirectiveReloadsInPlace returns whether the plugin for dir can
+// be reloaded in place; see Plugin.ReloadInPlace.
+func DirectiveReloadsInPlace(serverType, dir string) bool {
+	if plugin, ok := plugins[serverType][dir]; ok {
+		return plugin.ReloadInPlace
+	}
+	if plugin, ok := plugins[""][dir]; ok {
+		return plugin.ReloadInPlace
+	}
+	return false
+}
+
 // Loader is a type that can load a Caddyfile.
 // It is passed the name of the server type.
 // It returns an error only if something went
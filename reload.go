@@ -0,0 +1,224 @@
+package caddy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+// Reload loads the Caddyfile of the running instance again, with
+// the loader it was loaded with, and applies it, like SIGUSR1 does.
+func Reload() error {
+	return ReloadChecked(nil, nil)
+}
+
+// ReloadChecked applies newCaddyfile to the running instance, after
+// the smoke checks pass against it on internal ports; see
+// Instance.RestartChecked. If newCaddyfile is nil, the Caddyfile is
+// loaded again with the loader it was loaded with.
+func ReloadChecked(newCaddyfile Input, checks []SmokeCheck) error {
+	instancesMu.Lock()
+	if len(instances) == 0 {
+		instancesMu.Unlock()
+		return errors.New("no running instance to reload")
+	}
+	inst := instances[0] // we only support one instance at this time
+	instancesMu.Unlock()
+
+	if newCaddyfile == nil {
+		// Start with the existing Caddyfile
+		newCaddyfile = inst.caddyfileInput
+		if newCaddyfile == nil {
+			// Hmm, did spawing process forget to close stdin? Anyhow, this is unusual.
+			return errors.New("no Caddyfile to reload (was stdin left open?)")
+		}
+		if loaderUsed.loader == nil {
+			// This also should never happen
+			return errors.New("no Caddyfile loader with which to reload Caddyfile")
+		}
+
+		// Load the updated Caddyfile
+		updatedCaddyfile, err := loaderUsed.loader.Load(inst.serverType)
+		if err != nil {
+			return fmt.Errorf("loading updated Caddyfile: %v", err)
+		}
+		if updatedCaddyfile != nil {
+			newCaddyfile = updatedCaddyfile
+		}
+	}
+
+	_, err := inst.RestartChecked(newCaddyfile, checks)
+	return err
+}
+
+// reloadInPlace applies newCaddyfile to the running servers of i
+// without restarting them, if it only changes directives that can
+// be reloaded in place. Only those directives of the server blocks
+// that changed are set up again, and their callbacks replace theirs
+// in i. It returns false if the servers must be restarted to apply
+// newCaddyfile, which includes when it did not change at all, so
+// that what the directives read from files is read again.
+func (i *Instance) reloadInPlace(newCaddyfile Input) (bool, error) {
+	reloader, ok := i.context.(InPlaceReloader)
+	if !ok || newCaddyfile.ServerType() != i.serverType {
+		return false, nil
+	}
+	stype, err := getServerType(i.serverType)
+	if err != nil {
+		return false, err
+	}
+
+	sblocks, err := loadServerBlocks(i.serverType, newCaddyfile.Path(), bytes.NewReader(newCaddyfile.Body()))
+	if err != nil {
+		return false, err
+	}
+	// inspect them like the running ones were, so they compare
+	sblocks, err = stype.NewContext().InspectServerBlocks(newCaddyfile.Path(), sblocks)
+	if err != nil {
+		return false, err
+	}
+	changed, ok := changedServerBlocks(i.serverType, i.serverBlocks, sblocks)
+	if !ok || len(changed) == 0 {
+		return false, nil
+	}
+
+	// the other directives are not set up again; what they
+	// set up stays, as the reload context starts out with it
+	var directives []string
+	for _, dir := range stype.Directives() {
+		if DirectiveReloadsInPlace(i.serverType, dir) {
+			directives = append(directives, dir)
+		}
+	}
+
+	newInst := &Instance{serverType: i.serverType, wg: i.wg, context: reloader.ReloadContext()}
+	changedKeys := make(map[string]bool)
+	var blocks []caddyfile.ServerBlock
+	for _, j := range changed {
+		blocks = append(blocks, sblocks[j])
+		changedKeys[strings.Join(sblocks[j].Keys, " ")] = true
+	}
+	blocks, err = newInst.context.InspectServerBlocks(newCaddyfile.Path(), blocks)
+	if err != nil {
+		return false, err
+	}
+	err = executeDirectives(newInst, newCaddyfile.Path(), directives, blocks)
+	if err != nil {
+		return false, err
+	}
+	servers, err := newInst.context.MakeServers()
+	if err != nil {
+		return false, err
+	}
+	replaceSites, err := reloader.ReplaceSites(servers)
+	if err != nil {
+		// release what the setup acquired; nothing was started
+		for _, shutdownFunc := range newInst.onShutdown {
+			shutdownFunc.fn()
+		}
+		log.Printf("[INFO] Restarting servers: %v", err)
+		return false, nil
+	}
+
+	for _, startupFunc := range newInst.onStartup {
+		if err := startupFunc.fn(); err != nil {
+			return false, err
+		}
+	}
+	replaceSites()
+	log.Printf("[INFO] Reloaded %d of %d server blocks in place", len(changed), len(sblocks))
+
+	// the callbacks of the directives set up again are those of their new setup
+	replaced := func(cb callback) bool {
+		return changedKeys[cb.block] && DirectiveReloadsInPlace(i.serverType, cb.directive)
+	}
+	for _, shutdownFunc := range i.onShutdown {
+		if replaced(shutdownFunc) {
+			if err := shutdownFunc.fn(); err != nil {
+				log.Printf("[ERROR] Shutting down replaced sites: %v", err)
+			}
+		}
+	}
+	i.onFirstStartup = replaceCallbacks(i.onFirstStartup, nil, replaced)
+	i.onStartup = replaceCallbacks(i.onStartup, newInst.onStartup, replaced)
+	i.onRestart = replaceCallbacks(i.onRestart, newInst.onRestart, replaced)
+	i.onShutdown = replaceCallbacks(i.onShutdown, newInst.onShutdown, replaced)
+	i.onFinalShutdown = replaceCallbacks(i.onFinalShutdown, newInst.onFinalShutdown, replaced)
+
+	i.caddyfileInput = newCaddyfile
+	i.serverBlocks = sblocks
+	return true, nil
+}
+
+// changedServerBlocks returns the indices of the server blocks
+// in newBlocks that differ from those in oldBlocks, and whether
+// they only differ in directives that can be reloaded in place.
+// The blocks must have the same keys in the same order.
+func changedServerBlocks(serverType string, oldBlocks, newBlocks []caddyfile.ServerBlock) ([]int, bool) {
+	if len(oldBlocks) != len(newBlocks) {
+		return nil, false
+	}
+	var changed []int
+	for j := range newBlocks {
+		oldBlock, newBlock := oldBlocks[j], newBlocks[j]
+		if strings.Join(oldBlock.Keys, " ") != strings.Join(newBlock.Keys, " ") {
+			return nil, false
+		}
+		var blockChanged bool
+		for dir := range unionKeys(oldBlock.Tokens, newBlock.Tokens) {
+			if sameTokens(oldBlock.Tokens[dir], newBlock.Tokens[dir]) {
+				continue
+			}
+			if !DirectiveReloadsInPlace(serverType, dir) {
+				return nil, false
+			}
+			blockChanged = true
+		}
+		if blockChanged {
+			changed = append(changed, j)
+		}
+	}
+	return changed, true
+}
+
+// unionKeys returns the directives in a or b.
+func unionKeys(a, b map[string][]caddyfile.Token) map[string]struct{} {
+	keys := make(map[string]struct{}, len(a))
+	for dir := range a {
+		keys[dir] = struct{}{}
+	}
+	for dir := range b {
+		keys[dir] = struct{}{}
+	}
+	return keys
+}
+
+// sameTokens returns whether a and b have the same text; where
+// they are in the file does not matter.
+func sameTokens(a, b []caddyfile.Token) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for j := range a {
+		if a[j].Text != b[j].Text {
+			return false
+		}
+	}
+	return true
+}
+
+// replaceCallbacks returns callbacks without those that are
+// replaced, followed by replacements.
+func replaceCallbacks(callbacks, replacements []callback, replaced func(callback) bool) []callback {
+	var kept []callback
+	for _, cb := range callbacks {
+		if !replaced(cb) {
+			kept = append(kept, cb)
+		}
+	}
+	return append(kept, replacements...)
+}
@@ -0,0 +1,80 @@
+package caddy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+func init() {
+	RegisterPlugin("inplace", Plugin{ServerType: "reloadtest", ReloadInPlace: true})
+	RegisterPlugin("restart", Plugin{ServerType: "reloadtest"})
+}
+
+func TestChangedServerBlocks(t *testing.T) {
+	parse := func(input string) []caddyfile.ServerBlock {
+		sblocks, err := caddyfile.Parse("Testfile", strings.NewReader(input), []string{"inplace", "restart"})
+		if err != nil {
+			t.Fatalf("Parsing %q: %v", input, err)
+		}
+		return sblocks
+	}
+	old := `a.com {
+		inplace x
+		restart y
+	}
+	b.com {
+		inplace z
+	}`
+
+	for i, test := range []struct {
+		input   string
+		changed []int
+		ok      bool
+	}{
+		{old, nil, true},
+		// whitespace and position do not matter
+		{"a.com {\n\n inplace x\n restart y\n}\nb.com {\n inplace z\n}", nil, true},
+		{"a.com {\n inplace x\n restart y\n}\nb.com {\n inplace w\n}", []int{1}, true},
+		{"a.com {\n inplace x x\n restart y\n}\nb.com {\n}", []int{0, 1}, true},
+		{"a.com {\n restart y\n}\nb.com {\n inplace z\n}", []int{0}, true},
+		{"a.com {\n inplace x\n restart w\n}\nb.com {\n inplace z\n}", nil, false},
+		{"a.com {\n inplace x\n}\nb.com {\n inplace z\n}", nil, false},
+		{"a.com {\n inplace x\n restart y\n}\nb.com {\n inplace z\n restart y\n}", nil, false},
+		{"a.com {\n inplace x\n restart y\n}\nc.com {\n inplace z\n}", nil, false},
+		{"a.com {\n inplace x\n restart y\n}", nil, false},
+	} {
+		changed, ok := changedServerBlocks("reloadtest", parse(old), parse(test.input))
+		if ok != test.ok {
+			t.Errorf("Test %d: Expected ok to be %v, got %v", i, test.ok, ok)
+		}
+		if !reflect.DeepEqual(changed, test.changed) {
+			t.Errorf("Test %d: Expected changed blocks %v, got %v", i, test.changed, changed)
+		}
+	}
+}
+
+func TestReplaceCallbacks(t *testing.T) {
+	var calls []string
+	cb := func(name, block, directive string) callback {
+		return callback{fn: func() error { calls = append(calls, name); return nil }, block: block, directive: directive}
+	}
+	callbacks := []callback{
+		cb("a1", "a.com", "inplace"), cb("b1", "b.com", "inplace"), cb("a2", "a.com", "restart"),
+		cb("a3", "a.com", "inplace"), cb("c1", "c.com", "inplace"),
+	}
+	replacements := []callback{cb("a4", "a.com", "inplace")}
+	changed := map[string]bool{"a.com": true, "c.com": true}
+	replaced := func(cb callback) bool {
+		return changed[cb.block] && DirectiveReloadsInPlace("reloadtest", cb.directive)
+	}
+
+	for _, cb := range replaceCallbacks(callbacks, replacements, replaced) {
+		cb.fn()
+	}
+	if expected := []string{"b1", "a2", "a4"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected callbacks %v, got %v", expected, calls)
+	}
+}
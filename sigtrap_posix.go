@@ -46,36 +46,7 @@ func trapSignalsPosix() {
 
 			case syscall.SIGUSR1:
 				log.Println("[INFO] SIGUSR1: Reloading")
-
-				// Start with the existing Caddyfile
-				instancesMu.Lock()
-				inst := instances[0] // we only support one instance at this time
-				instancesMu.Unlock()
-				updatedCaddyfile := inst.caddyfileInput
-				if updatedCaddyfile == nil {
-					// Hmm, did spawing process forget to close stdin? Anyhow, this is unusual.
-					log.Println("[ERROR] SIGUSR1: no Caddyfile to reload (was stdin left open?)")
-					continue
-				}
-				if loaderUsed.loader == nil {
-					// This also should never happen
-					log.Println("[ERROR] SIGUSR1: no Caddyfile loader with which to reload Caddyfile")
-					continue
-				}
-
-				// Load the updated Caddyfile
-				newCaddyfile, err := loaderUsed.loader.Load(inst.serverType)
-				if err != nil {
-					log.Printf("[ERROR] SIGUSR1: loading updated Caddyfile: %v", err)
-					continue
-				}
-				if newCaddyfile != nil {
-					updatedCaddyfile = newCaddyfile
-				}
-
-				// Kick off the restart; our work is done
-				inst, err = inst.Restart(updatedCaddyfile)
-				if err != nil {
+				if err := Reload(); err != nil {
 					log.Printf("[ERROR] SIGUSR1: %v", err)
 				}
 			}
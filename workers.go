@@ -0,0 +1,22 @@
+package caddy
+
+import (
+	"os"
+	"strconv"
+)
+
+// WorkerEnv is the environment variable that tells a worker
+// process its number when Caddy runs with worker processes.
+const WorkerEnv = "CADDY_WORKER"
+
+// WorkerID returns the number of this worker process, starting
+// at 1, if Caddy runs with worker processes, or 0 otherwise.
+// Workers share their listeners with each other using
+// SO_REUSEPORT.
+func WorkerID() int {
+	id, err := strconv.Atoi(os.Getenv(WorkerEnv))
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}